@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/audio"
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// audioCmd represents the audio command group
+var audioCmd = &cobra.Command{
+	Use:   "audio",
+	Short: "Play sound files on the machine's audio hardware",
+	Long: `Play sound files on the target machine's audio hardware through the debug
+port, to audition assets without building a program.
+
+The audio hardware is found through regions of the target machine, defined in
+its [machine.NAME] section of foenixmgr.ini as seen by the debug port:
+  region.audio.psg    SN76489 data port
+  region.audio.opl3   YMF262: register select at +0, data at +1, register
+                      select for the second register bank at +2
+  region.audio.pcm    Sample buffer (address,size) that WAV samples are
+                      streamed into as a ring buffer
+
+Example:
+  foenixmgr audio play tune.vgm --target f256k
+  foenixmgr audio play effect.wav --target f256k`,
+}
+
+// audioPlayCmd represents the audio play command
+var audioPlayCmd = &cobra.Command{
+	Use:   "play <file>",
+	Short: "Play a VGM/VGZ register log or stream a WAV file",
+	Long: `Play a sound file on the target machine until it ends or Ctrl+C is pressed.
+
+VGM and VGZ files are played by writing their SN76489 and YMF262 (or YM3812)
+register writes to the audio.psg and audio.opl3 regions at the times recorded
+in the file. Writes to other chips are skipped.
+
+WAV files are converted to 8-bit unsigned mono and streamed into the
+audio.pcm region at the file's sample rate, wrapping around at its end.
+
+Example:
+  foenixmgr audio play tune.vgm --target f256k
+  foenixmgr audio play effect.wav --target f256k`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return playAudio(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(audioCmd)
+	audioCmd.AddCommand(audioPlayCmd)
+}
+
+// audioStreamInterval is how much PCM is streamed per write
+const audioStreamInterval = 20 * time.Millisecond
+
+// playAudio plays a VGM or WAV file
+func playAudio(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	data, err := util.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	ctx := handleInterrupts()
+
+	switch {
+	case audio.IsVGM(data):
+		song, err := audio.ParseVGM(data)
+		if err != nil {
+			return err
+		}
+		return playVGM(ctx, song)
+	case audio.IsWAV(data):
+		pcm, err := audio.DecodeWAV(data)
+		if err != nil {
+			return err
+		}
+		return streamPCM(ctx, pcm)
+	}
+	return fmt.Errorf("%s is not a VGM, VGZ or WAV file", filename)
+}
+
+// playVGM writes the register writes of a song at their recorded times
+func playVGM(ctx context.Context, song *audio.Song) error {
+	var psg, opl3 *config.Region
+	for _, w := range song.Writes {
+		name, region := "audio.psg", &psg
+		if w.Chip == audio.ChipOPL3 {
+			name, region = "audio.opl3", &opl3
+		}
+		if *region == nil {
+			r, err := cfg.MachineRegion(name)
+			if err != nil {
+				return err
+			}
+			*region = &r
+		}
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Playing %d register writes over %.1fs (Ctrl+C to stop)...\n",
+		len(song.Writes), float64(song.Length)/audio.VGMSampleRate)
+	if song.Skipped > 0 {
+		printInfo("Skipping %d writes for other sound chips.\n", song.Skipped)
+	}
+
+	start := time.Now()
+	for _, w := range song.Writes {
+		if !sleepUntil(ctx, start.Add(samplesToDuration(w.At, audio.VGMSampleRate))) {
+			break
+		}
+
+		var err error
+		if w.Chip == audio.ChipPSG {
+			err = dp.WriteBlock(psg.Address, []byte{w.Value})
+		} else {
+			err = dp.WriteBlock(opl3.Address+uint32(w.Port)*2, []byte{w.Register})
+			if err == nil {
+				err = dp.WriteBlock(opl3.Address+1, []byte{w.Value})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write audio register: %w", err)
+		}
+	}
+
+	if psg != nil {
+		silencePSG(dp, psg.Address)
+	}
+	printInfo("Playback finished.\n")
+	return nil
+}
+
+// silencePSG turns the volume of the four SN76489 channels off
+func silencePSG(dp *protocol.DebugPort, address uint32) {
+	for _, value := range []byte{0x9F, 0xBF, 0xDF, 0xFF} {
+		dp.WriteBlock(address, []byte{value})
+	}
+}
+
+// streamPCM streams samples into the audio.pcm ring buffer at their rate
+func streamPCM(ctx context.Context, pcm *audio.PCM) error {
+	buffer, err := cfg.MachineRegion("audio.pcm")
+	if err != nil {
+		return err
+	}
+	if buffer.Size == 0 {
+		return fmt.Errorf("the audio.pcm region needs a size (region.audio.pcm=ADDRESS,SIZE)")
+	}
+	if pcm.Rate <= 0 {
+		return fmt.Errorf("invalid WAV sample rate %d", pcm.Rate)
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Streaming %d samples at %d Hz to 0x%06X (Ctrl+C to stop)...\n", len(pcm.Samples), pcm.Rate, buffer.Address)
+
+	block := samplesPerBlock(pcm.Rate)
+	start := time.Now()
+	offset := uint32(0) // Write position in the buffer
+	for sent := 0; sent < len(pcm.Samples); {
+		if !sleepUntil(ctx, start.Add(samplesToDuration(uint64(sent), pcm.Rate))) {
+			break
+		}
+
+		end := sent + block
+		if end > len(pcm.Samples) {
+			end = len(pcm.Samples)
+		}
+		if room := int(buffer.Size - offset); end-sent > room {
+			end = sent + room
+		}
+
+		if err := dp.WriteRange(buffer.Address+offset, pcm.Samples[sent:end]); err != nil {
+			return fmt.Errorf("failed to write samples: %w", err)
+		}
+		offset = (offset + uint32(end-sent)) % buffer.Size
+		sent = end
+	}
+
+	printInfo("Playback finished.\n")
+	return nil
+}
+
+// samplesPerBlock returns the number of samples streamed per write
+func samplesPerBlock(rate int) int {
+	block := int(int64(rate) * int64(audioStreamInterval) / int64(time.Second))
+	if block < 1 {
+		block = 1
+	}
+	return block
+}
+
+// samplesToDuration converts a sample count at a rate to a duration
+func samplesToDuration(samples uint64, rate int) time.Duration {
+	return time.Duration(samples * uint64(time.Second) / uint64(rate))
+}
+
+// sleepUntil waits until t, returning false if ctx is cancelled first
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
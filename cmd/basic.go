@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/basic"
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// basicSourceRegion is the region the machine's BASIC loads program text from
+const basicSourceRegion = "basic.source"
+
+// basicKeyTimeout is how long a key may sit in the console.key mailbox before
+// typing the BASIC command is given up
+const basicKeyTimeout = 5 * time.Second
+
+var (
+	basicCommand string
+	basicForce   bool
+)
+
+// basicCmd groups the BASIC program commands
+var basicCmd = &cobra.Command{
+	Use:   "basic",
+	Short: "Load and run BASIC programs",
+	Long: `Load and run BASIC programs written on the host, so they can be edited in
+an editor instead of retyped on the machine.
+
+Example:
+  foenixmgr basic run game.bas --target f256k`,
+}
+
+// basicRunCmd represents the basic run command
+var basicRunCmd = &cobra.Command{
+	Use:   "run <program.bas>",
+	Short: "Load a BASIC program into the machine and run it",
+	Long: `Write a BASIC program in text form to the basic.source region of the target
+machine, where the machine's BASIC tokenizes and loads it, and type the
+command that loads and runs it.
+
+On the F256, SuperBASIC's XGO command loads the program text at 028000 and
+runs it (XLOAD only loads it). Define the region for the machine in
+foenixmgr.ini:
+
+  [machine.f256k]
+  region.basic.source=028000,8000
+
+The text is written as it is, ending with a line break and a 00 byte. A
+program saved tokenized is refused.
+
+The debug port has no access to the keyboard. If the machine has a
+console.key region (see 'console --keys'), the command is typed through that
+mailbox byte, which needs a program on the machine that takes keys from it.
+Otherwise, type the command on the machine.
+
+Example:
+  foenixmgr basic run game.bas --target f256k
+  foenixmgr basic run game.bas --command XLOAD`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBasic(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(basicCmd)
+	basicCmd.AddCommand(basicRunCmd)
+
+	basicRunCmd.Flags().StringVar(&basicCommand, "command", "XGO", "BASIC command that loads and runs the program text")
+	basicRunCmd.Flags().BoolVar(&basicForce, "force", false, "Write the program outside the RAM of the target machine")
+}
+
+// runBasic writes a BASIC program to the basic.source region and types the
+// command that runs it
+func runBasic(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	source, err := util.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	text, err := basic.Prepare(source)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	region, err := cfg.MachineRegion(basicSourceRegion)
+	if err != nil {
+		return err
+	}
+	if region.Size != 0 && uint32(len(text)) > region.Size {
+		return fmt.Errorf("%s is %d bytes, larger than the 0x%X byte %s region", filename, len(text), region.Size, basicSourceRegion)
+	}
+	if err := checkWrite(region.Address, len(text), basicForce, config.MemoryRAM); err != nil {
+		return err
+	}
+	mailbox, hasMailbox := config.Region{}, false
+	if m := cfg.Machine(); m != nil {
+		mailbox, hasMailbox = m.Region(consoleKeyRegion)
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Writing %d lines of %s to 0x%06X...\n", basic.Lines(text), filename, region.Address)
+	if err := dp.WriteRange(region.Address, text); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+
+	if !hasMailbox {
+		printInfo("Type %s on the machine to run it.\n", basicCommand)
+		return nil
+	}
+	printInfo("Typing %s...\n", basicCommand)
+	return typeKeys(dp, mailbox.Address, []byte(basicCommand+"\r"))
+}
+
+// typeKeys delivers keys one at a time through the console.key mailbox byte,
+// writing each when the program on the machine has cleared the previous one.
+// A stopped CPU is run while waiting, as the console does.
+func typeKeys(dp *protocol.DebugPort, mailbox uint32, keys []byte) error {
+	pulse := util.IsStopped(cfg.Port)
+	for _, key := range keys {
+		deadline := time.Now().Add(basicKeyTimeout)
+		for {
+			value, err := dp.ReadBlock(mailbox, 1)
+			if err != nil {
+				return fmt.Errorf("failed to read key mailbox: %w", err)
+			}
+			if value[0] == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("the %s mailbox wasn't emptied in %s; is a program on the machine reading it?", consoleKeyRegion, basicKeyTimeout)
+			}
+			if err := waitForMachine(dp, pulse); err != nil {
+				return err
+			}
+		}
+		if err := dp.WriteBlock(mailbox, []byte{key}); err != nil {
+			return fmt.Errorf("failed to write key mailbox: %w", err)
+		}
+	}
+	return nil
+}
+
+// waitForMachine gives the program on the machine time to run, starting a
+// stopped CPU for the time and stopping it again
+func waitForMachine(dp *protocol.DebugPort, pulse bool) error {
+	if pulse {
+		if err := dp.StartCPU(); err != nil {
+			return fmt.Errorf("failed to start CPU: %w", err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if pulse {
+		if err := dp.StopCPU(); err != nil {
+			return fmt.Errorf("failed to stop CPU: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchmarkAddress string
+	benchmarkSize    string
+	benchmarkSweep   bool
+	benchmarkForce   bool
+)
+
+// benchmarkCmd represents the benchmark command
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Measure upload and download speed",
+	Long: `Measure the effective upload and download bandwidth of the debug port by
+writing a block of random data to RAM and reading it back. The memory used is
+saved first and restored afterwards.
+
+By default the configured chunk size is measured (tuned as it goes when
+adaptive_chunks is enabled). With --sweep every chunk size from 256 bytes to
+32KB is measured, to find the best chunk_size for a machine and connection.
+
+The size is hex, or a number of bytes with a K or M suffix. Afterwards a link
+quality report counts the retried exchanges and LRC mismatches, compares the
+throughput with what the serial data rate allows, and suggests chunk_size and
+data_rate values for foenixmgr.ini.
+
+Example:
+  foenixmgr benchmark
+  foenixmgr benchmark --size 1M
+  foenixmgr benchmark --sweep --address 10000 --size 20000`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBenchmark()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchmarkCmd)
+
+	benchmarkCmd.Flags().StringVar(&benchmarkAddress, "address", "", "RAM address to use (hex or label, default: the address setting)")
+	benchmarkCmd.Flags().StringVar(&benchmarkSize, "size", "10000", "Number of bytes to transfer (hex, or with a K or M suffix, e.g. 1M)")
+	benchmarkCmd.Flags().BoolVar(&benchmarkSweep, "sweep", false, "Measure every chunk size from 256 bytes to 32KB")
+	benchmarkCmd.Flags().BoolVar(&benchmarkForce, "force", false, "Use memory that isn't RAM of the target machine")
+}
+
+// benchmarkResult is the measured bandwidth at one chunk size, and the link
+// errors seen measuring it
+type benchmarkResult struct {
+	ChunkSize int     `json:"chunk_size"`
+	Upload    float64 `json:"upload_bytes_per_second"`
+	Download  float64 `json:"download_bytes_per_second"`
+	Failures  int     `json:"failures"`
+	Retries   int     `json:"retries"`
+	LRCErrors int     `json:"lrc_errors"`
+}
+
+// clean returns true if no errors were seen on the link
+func (r benchmarkResult) clean() bool {
+	return r.Failures == 0 && r.LRCErrors == 0
+}
+
+// serialDataRates are the data rates suggested for serial connections
+var serialDataRates = []int{115200, 230400, 460800, 921600, 1000000, 2000000, 3000000, 6000000}
+
+// runBenchmark measures transfer speeds and restores the memory it used
+func runBenchmark() (err error) {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if benchmarkAddress == "" {
+		benchmarkAddress = cfg.Address
+	}
+	addr, err := resolveAddress(benchmarkAddress)
+	if err != nil {
+		return err
+	}
+	size, err := parseBenchmarkSize(benchmarkSize)
+	if err != nil {
+		return fmt.Errorf("invalid size: %w", err)
+	}
+	if size == 0 {
+		return fmt.Errorf("size must not be zero")
+	}
+	if err := checkWrite(addr, int(size), benchmarkForce, config.MemoryRAM); err != nil {
+		return err
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Saving %d bytes at 0x%X...\n", size, addr)
+	saved, err := dp.ReadRange(addr, size)
+	if err != nil {
+		return fmt.Errorf("failed to save memory: %w", err)
+	}
+	defer func() {
+		printInfo("Restoring memory...\n")
+		if restoreErr := dp.WriteRange(addr, saved); restoreErr != nil && err == nil {
+			err = fmt.Errorf("failed to restore memory: %w", restoreErr)
+		}
+	}()
+
+	pattern := make([]byte, size)
+	rand.Read(pattern)
+
+	sizes := []int{dp.ChunkSize()}
+	if benchmarkSweep {
+		sizes = nil
+		for s := protocol.MinChunkSize; s <= protocol.MaxChunkSize; s *= 2 {
+			sizes = append(sizes, s)
+		}
+	}
+
+	var results []benchmarkResult
+	for _, chunkSize := range sizes {
+		if benchmarkSweep {
+			dp.SetChunkSize(chunkSize)
+		}
+
+		result, err := measureTransfers(dp, addr, pattern)
+		if err != nil {
+			return fmt.Errorf("chunk size %d: %w", chunkSize, err)
+		}
+		results = append(results, result)
+		if !jsonFlag {
+			fmt.Printf("Chunk size %5d: upload %s, download %s", result.ChunkSize, formatRate(result.Upload), formatRate(result.Download))
+			if !result.clean() {
+				fmt.Printf(", %d failed exchanges, %d LRC mismatches", result.Failures, result.LRCErrors)
+			}
+			fmt.Println()
+		}
+	}
+
+	if jsonFlag {
+		return printJSON(results)
+	}
+
+	reportLinkQuality(results)
+	return nil
+}
+
+// parseBenchmarkSize parses the --size flag: hex, or bytes with a K, M or G
+// suffix, which can't be mistaken for hex digits
+func parseBenchmarkSize(s string) (uint32, error) {
+	if !strings.ContainsAny(strings.ToUpper(s), "KMG") {
+		return util.ParseHexCount(s)
+	}
+	size, err := util.ParseByteSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if size > 1<<24 {
+		return 0, fmt.Errorf("%s is larger than 16MB", s)
+	}
+	return uint32(size), nil
+}
+
+// reportLinkQuality prints the errors seen on the link and the chunk_size
+// and data_rate that suit it
+func reportLinkQuality(results []benchmarkResult) {
+	var total benchmarkResult
+	for _, r := range results {
+		total.Failures += r.Failures
+		total.Retries += r.Retries
+		total.LRCErrors += r.LRCErrors
+	}
+
+	fmt.Printf("\nLink quality:\n")
+	fmt.Printf("  Failed exchanges: %d (%d retried)\n", total.Failures, total.Retries)
+	fmt.Printf("  LRC mismatches:   %d\n", total.LRCErrors)
+
+	// The fastest chunk size that ran without errors, or the fastest of all
+	best := results[0]
+	for _, r := range results {
+		if (r.clean() && !best.clean()) || (r.clean() == best.clean() && r.Upload+r.Download > best.Upload+best.Download) {
+			best = r
+		}
+	}
+
+	var suggestions []string
+	switch {
+	case benchmarkSweep && best.ChunkSize != cfg.ChunkSize:
+		suggestions = append(suggestions, fmt.Sprintf("chunk_size=%d", best.ChunkSize))
+	case !benchmarkSweep && !total.clean() && best.ChunkSize/2 >= protocol.MinChunkSize:
+		// Smaller chunks lose less to each corrupted exchange
+		suggestions = append(suggestions, fmt.Sprintf("chunk_size=%d", best.ChunkSize/2))
+	}
+
+	if connection.IsTCPPort(cfg.Port) || connection.IsMockPort(cfg.Port) {
+		fmt.Printf("  Data rate:        not applicable to %s\n", cfg.Port)
+	} else if cfg.DataRate > 0 {
+		lineRate := float64(cfg.DataRate) / 10 // 8N1: 10 bits per byte
+		efficiency := max(best.Upload, best.Download) / lineRate
+		fmt.Printf("  Line usage:       %.0f%% of %d baud\n", efficiency*100, cfg.DataRate)
+
+		switch {
+		case !total.clean():
+			if rate, ok := nextDataRate(cfg.DataRate, -1); ok {
+				suggestions = append(suggestions, fmt.Sprintf("data_rate=%d", rate))
+			}
+		case efficiency >= 0.8:
+			// The serial line is the bottleneck
+			if rate, ok := nextDataRate(cfg.DataRate, 1); ok {
+				suggestions = append(suggestions, fmt.Sprintf("data_rate=%d", rate))
+			}
+		}
+	}
+
+	if len(suggestions) == 0 {
+		if !benchmarkSweep {
+			fmt.Printf("\nNo changes suggested. Run with --sweep to compare every chunk size.\n")
+		} else {
+			fmt.Printf("\nNo changes suggested.\n")
+		}
+		return
+	}
+	fmt.Printf("\nSuggested settings for foenixmgr.ini:\n")
+	for _, s := range suggestions {
+		fmt.Printf("  %s\n", s)
+	}
+	if !total.clean() {
+		fmt.Printf("Errors were seen, so run the benchmark again with these settings to confirm them.\n")
+	}
+}
+
+// nextDataRate returns the next standard serial data rate above (direction
+// 1) or below (-1) rate
+func nextDataRate(rate int, direction int) (int, bool) {
+	if direction > 0 {
+		for _, r := range serialDataRates {
+			if r > rate {
+				return r, true
+			}
+		}
+		return 0, false
+	}
+	for i := len(serialDataRates) - 1; i >= 0; i-- {
+		if serialDataRates[i] < rate {
+			return serialDataRates[i], true
+		}
+	}
+	return 0, false
+}
+
+// measureTransfers writes pattern at addr, reads it back and checks it. The
+// chunk size reported is the one in use at the end, which differs from the
+// start when it is tuned.
+func measureTransfers(dp *protocol.DebugPort, addr uint32, pattern []byte) (benchmarkResult, error) {
+	dp.ResetStats()
+	start := time.Now()
+	if err := dp.WriteRange(addr, pattern); err != nil {
+		return benchmarkResult{}, err
+	}
+	upload := time.Since(start)
+
+	start = time.Now()
+	data, err := dp.ReadRange(addr, uint32(len(pattern)))
+	if err != nil {
+		return benchmarkResult{}, err
+	}
+	download := time.Since(start)
+
+	if !bytes.Equal(data, pattern) {
+		return benchmarkResult{}, fmt.Errorf("data read back doesn't match what was written")
+	}
+
+	stats := dp.Stats()
+	return benchmarkResult{
+		ChunkSize: dp.ChunkSize(),
+		Upload:    float64(len(pattern)) / upload.Seconds(),
+		Download:  float64(len(pattern)) / download.Seconds(),
+		Failures:  stats.Failures,
+		Retries:   stats.Retries,
+		LRCErrors: stats.LRCErrors,
+	}, nil
+}
+
+// formatRate formats a transfer rate in KB/s
+func formatRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%8.1f KB/s", bytesPerSecond/1024)
+}
@@ -4,9 +4,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
 	"github.com/daschewie/foenixmgr/pkg/protocol"
-	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
 )
 
@@ -43,29 +41,20 @@ func setBootSource(source string) error {
 		return err
 	}
 
+	if err := checkCapability(protocol.CapBootSource); err != nil {
+		return err
+	}
+
 	// Normalize source
 	source = strings.ToLower(source)
 	if source != "ram" && source != "flash" {
 		return fmt.Errorf("invalid boot source '%s' (must be 'ram' or 'flash')", source)
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
-	}
-	defer conn.Close()
-
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
-
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
 
 	// Set boot source
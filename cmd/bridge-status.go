@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/spf13/cobra"
+)
+
+// bridgeStatusCmd represents the bridge-status command
+var bridgeStatusCmd = &cobra.Command{
+	Use:   "bridge-status <host:port>",
+	Short: "Show the statistics of a running TCP bridge",
+	Long: `Fetch and display the statistics of a tcp-bridge started with --status-port:
+the serial port state, connected clients, packets relayed, serial errors and
+throughput.
+
+Example:
+  foenixmgr bridge-status raspberrypi.local:2561
+  foenixmgr bridge-status raspberrypi.local:2561 --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showBridgeStatus(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bridgeStatusCmd)
+}
+
+// showBridgeStatus fetches and prints a bridge's statistics
+func showBridgeStatus(hostPort string) error {
+	url := hostPort
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	url = strings.TrimSuffix(url, "/") + "/status"
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to contact bridge: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bridge status request failed: %s", resp.Status)
+	}
+
+	var stats connection.BridgeStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return fmt.Errorf("invalid bridge status: %w", err)
+	}
+
+	if jsonFlag {
+		return printJSON(stats)
+	}
+
+	state := "closed"
+	if stats.SerialOpen {
+		state = "open"
+	}
+	fmt.Printf("Serial port:   %s (%s, opened %d times)\n", stats.SerialPort, state, stats.SerialOpens)
+	fmt.Printf("Uptime:        %s\n", time.Duration(stats.Uptime*float64(time.Second)).Round(time.Second))
+	fmt.Printf("Clients:       %d connected, %d total\n", len(stats.Clients), stats.TotalClients)
+	for _, c := range stats.Clients {
+		if c == stats.Owner {
+			fmt.Printf("               %s (owner)\n", c)
+		} else {
+			fmt.Printf("               %s\n", c)
+		}
+	}
+	fmt.Printf("Busy refusals: %d\n", stats.Refusals)
+	fmt.Printf("Packets:       %d (%d in frames, %d batches)\n", stats.Packets, stats.Frames, stats.Batches)
+	fmt.Printf("Traffic:       %d bytes sent, %d received (%.1f bytes/s)\n", stats.BytesSent, stats.BytesRecv, stats.Throughput)
+	fmt.Printf("Serial errors: %d\n", stats.SerialErrors)
+	if stats.LastResponse.IsZero() {
+		fmt.Printf("Last response: never\n")
+	} else if stats.Revision >= 0 {
+		fmt.Printf("Last response: %s ago (revision %d)\n", time.Since(stats.LastResponse).Round(time.Second), stats.Revision)
+	} else {
+		fmt.Printf("Last response: %s ago\n", time.Since(stats.LastResponse).Round(time.Second))
+	}
+	return nil
+}
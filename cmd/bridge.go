@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/bridgeconf"
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/spf13/cobra"
+)
+
+// bridgeShutdownTimeout is how long the status endpoints get to finish their
+// requests when the bridges stop
+const bridgeShutdownTimeout = 5 * time.Second
+
+// bridgeCmd represents the bridge command group
+var bridgeCmd = &cobra.Command{
+	Use:   "bridge",
+	Short: "Run TCP-to-serial bridges as a service",
+	Long: `Run TCP-to-serial bridges as a long-running service, such as on a Raspberry
+Pi that hosts several machines. For a single bridge started by hand, see
+'tcp-bridge'.
+
+Example:
+  foenixmgr bridge serve --config /etc/foenixmgr/bridge.yaml`,
+}
+
+// bridgeServeCmd represents the bridge serve command
+var bridgeServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the serial ports in a bridge configuration file",
+	Long: `Serve each serial port listed in a YAML configuration file on its own TCP
+port, until stopped with Ctrl+C or SIGTERM.
+
+The configuration file lists the bridges:
+
+  log: journal              # text (with timestamps) or journal; by default
+                            # journal when started by systemd, else text
+  bridges:
+    - name: jr              # Name in log lines (default: the serial port)
+      serial: /dev/ttyUSB0
+      listen: 0.0.0.0:2560
+      status: 0.0.0.0:2561  # Optional: statistics at http://HOST:PORT/status
+                            # and Prometheus metrics at /metrics
+    - name: a2560k
+      serial: /dev/ttyUSB1
+      listen: 0.0.0.0:2570
+      data_rate: 2000000
+
+A bridge can also set timeout, reconnect_timeout, lock_wait, parity,
+stop_bits, flow_control, dtr and rts. Settings that aren't given come from
+foenixmgr.ini.
+
+One client at a time can be in a debug session on a bridge, from entering
+debug mode until it exits debug mode or disconnects. Other clients' requests
+wait up to lock_wait seconds for the session to end, then are refused with a
+"device busy" error.
+
+Each serial port is opened when the first request arrives and kept open. If
+it fails, for example when the machine is switched off or the adapter is
+unplugged, it is closed and reopened for the next request, waiting up to
+reconnect_timeout seconds for it to come back. Log lines go to standard
+error, prefixed with the bridge's name.
+
+On Ctrl+C or SIGTERM, the bridges stop accepting clients, let the request in
+progress finish, disconnect their clients and close their serial ports.
+
+Example:
+  foenixmgr bridge serve --config bridge.yaml
+  foenixmgr bridge serve --config /etc/foenixmgr/bridge.yaml`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveBridges(bridgeConfigFile)
+	},
+}
+
+var bridgeConfigFile string
+
+func init() {
+	rootCmd.AddCommand(bridgeCmd)
+	bridgeCmd.AddCommand(bridgeServeCmd)
+
+	bridgeServeCmd.Flags().StringVar(&bridgeConfigFile, "config", "bridge.yaml", "Bridge configuration file")
+}
+
+// servedBridge is a bridge started by serveBridges
+type servedBridge struct {
+	name     string
+	bridge   *connection.Bridge
+	listener net.Listener
+	status   *http.Server
+	statusOn net.Listener
+	logger   *log.Logger
+}
+
+// serveBridges serves the bridges in a configuration file until interrupted
+func serveBridges(filename string) error {
+	bc, err := bridgeconf.Load(filename)
+	if err != nil {
+		return err
+	}
+	logFlags := log.LstdFlags
+	if bc.LogFormat() == bridgeconf.LogJournal {
+		logFlags = 0 // journald adds the time
+	}
+
+	// Open every listener first, so a port in use stops the service before
+	// any bridge starts
+	var bridges []*servedBridge
+	closeAll := func() {
+		for _, s := range bridges {
+			s.listener.Close()
+			if s.statusOn != nil {
+				s.statusOn.Close()
+			}
+		}
+	}
+	for i := range bc.Bridges {
+		s, err := startBridge(&bc.Bridges[i], logFlags)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		bridges = append(bridges, s)
+	}
+
+	ctx := handleInterrupts()
+	failed := make(chan error, 2*len(bridges))
+	var wg sync.WaitGroup
+	for _, s := range bridges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.bridge.Serve(s.listener); err != nil {
+				failed <- fmt.Errorf("%s: %w", s.name, err)
+			}
+		}()
+		if s.status != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.status.Serve(s.statusOn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					failed <- fmt.Errorf("%s: status endpoint: %w", s.name, err)
+				}
+			}()
+		}
+	}
+
+	// Run until interrupted, or until a bridge stops on its own
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-failed:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), bridgeShutdownTimeout)
+	defer cancel()
+	for _, s := range bridges {
+		s.logger.Printf("Shutting down")
+		if closeErr := s.bridge.Shutdown(); closeErr != nil {
+			s.logger.Printf("Error closing serial port: %v", closeErr)
+		}
+		if s.status != nil {
+			s.status.Shutdown(shutdownCtx)
+		}
+	}
+	wg.Wait()
+	return err
+}
+
+// startBridge opens the listeners of a bridge in the configuration file
+func startBridge(p *bridgeconf.Port, logFlags int) (*servedBridge, error) {
+	serialConfig := p.SerialConfig(cfg)
+	if err := connection.CheckSerialSettings(serialConfig); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name, err)
+	}
+
+	host, portStr, _ := net.SplitHostPort(p.Listen)
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid port number: %w", p.Name, err)
+	}
+
+	logger := log.New(os.Stderr, "["+p.Name+"] ", logFlags)
+	bridge := connection.NewBridge(host, port, p.Serial, serialConfig.DataRate, serialConfig.Timeout)
+	bridge.SetSerialConfig(serialConfig)
+	bridge.SetLogger(logger)
+	bridge.SetBusyWait(time.Duration(serialConfig.LockWait) * time.Second)
+
+	s := &servedBridge{name: p.Name, bridge: bridge, logger: logger}
+	s.listener, err = net.Listen("tcp", p.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to listen on %s: %w", p.Name, p.Listen, err)
+	}
+	logger.Printf("Relaying %s to %s (%d baud)", p.Listen, p.Serial, serialConfig.DataRate)
+
+	if p.Status != "" {
+		s.statusOn, err = net.Listen("tcp", p.Status)
+		if err != nil {
+			s.listener.Close()
+			return nil, fmt.Errorf("%s: failed to listen on %s: %w", p.Name, p.Status, err)
+		}
+		s.status = &http.Server{Handler: bridge.StatusHandler()}
+		logger.Printf("Serving bridge status on http://%s/status", p.Status)
+	}
+	return s, nil
+}
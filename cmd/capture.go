@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/capture"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	captureAddress  string
+	captureCount    string
+	captureRate     float64
+	captureOutput   string
+	captureFormat   string
+	captureSamples  int
+	captureDuration time.Duration
+)
+
+// captureCmd represents the capture command
+var captureCmd = &cobra.Command{
+	Use:   "capture",
+	Short: "Sample memory at a fixed rate and record it",
+	Long: `Read a memory window at a fixed rate and record timestamped samples as
+CSV or JSON lines, like a logic analyzer, so the behaviour of hardware
+registers such as raster line counters can be graphed on the host.
+
+CSV has a header row and one row per sample with the time, the milliseconds
+since the first sample and one column per byte in decimal. JSON lines have
+the same fields with the bytes as hex and as numbers. The format follows the
+--output extension (.jsonl, .ndjson or .json for JSON lines) unless --format
+or --json is given.
+
+Capturing runs until --samples samples or --duration have been taken, or
+until interrupted with Ctrl+C. Each sample is one debug port read, so the
+rate is limited by the connection; how many samples were late is reported at
+the end. As with watch, a CPU stopped with 'foenixmgr stop' runs between
+samples.
+
+Example:
+  foenixmgr capture --address D01A --count 2 --rate 50 --output raster.csv
+  foenixmgr capture --address frame_counter --rate 10 --duration 30s --output trace.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return captureMemory()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(captureCmd)
+
+	captureCmd.Flags().StringVar(&captureAddress, "address", "", "Starting address (hex) or label")
+	captureCmd.Flags().StringVar(&captureCount, "count", "1", "Number of bytes to sample (hex)")
+	captureCmd.Flags().Float64Var(&captureRate, "rate", 50, "Samples per second")
+	captureCmd.Flags().StringVar(&captureOutput, "output", "-", "Output file (- for standard output)")
+	captureCmd.Flags().StringVar(&captureFormat, "format", "", "Output format: csv or jsonl (default from the --output extension)")
+	captureCmd.Flags().IntVar(&captureSamples, "samples", 0, "Number of samples to take (0 for no limit)")
+	captureCmd.Flags().DurationVar(&captureDuration, "duration", 0, "How long to capture (0 for no limit)")
+}
+
+// captureMemory samples memory at a fixed rate until a limit is reached or
+// it is interrupted
+func captureMemory() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if captureAddress == "" {
+		captureAddress = cfg.Address
+	}
+	addr, err := resolveAddress(captureAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	count, err := util.ParseHexCount(captureCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+	if captureRate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if captureSamples < 0 || captureDuration < 0 {
+		return fmt.Errorf("samples and duration can't be negative")
+	}
+
+	format := captureFormat
+	if format == "" && jsonFlag {
+		format = capture.FormatJSONL
+	} else if format == "" {
+		format = capture.FormatForFile(captureOutput)
+	}
+
+	var out io.Writer = os.Stdout
+	if captureOutput != "-" {
+		f, err := os.Create(captureOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+	defer buffered.Flush()
+	w, err := capture.NewWriter(buffered, format, addr, int(count))
+	if err != nil {
+		return err
+	}
+
+	pulse := util.IsStopped(cfg.Port)
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	ctx := handleInterrupts()
+	if captureDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, captureDuration)
+		defer cancel()
+	}
+
+	period := time.Duration(float64(time.Second) / captureRate)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	if captureOutput != "-" {
+		printInfo("Capturing %d bytes at %06X, %g samples per second, to %s (Ctrl+C to stop)...\n", count, addr, captureRate, captureOutput)
+	}
+
+	var start time.Time
+	taken, late := 0, 0
+	next := time.Now()
+	for captureSamples == 0 || taken < captureSamples {
+		now := time.Now()
+		data, err := dp.ReadRange(addr, count)
+		if err != nil {
+			return fmt.Errorf("failed to read memory: %w", err)
+		}
+		if taken == 0 {
+			start = now
+			next = now
+		} else if now.Sub(next) > period/2 {
+			late++
+		}
+		if err := w.Write(capture.Sample{Time: now, Elapsed: now.Sub(start), Data: data}); err != nil {
+			return fmt.Errorf("failed to write sample: %w", err)
+		}
+		taken++
+		next = next.Add(period)
+		if captureSamples != 0 && taken >= captureSamples {
+			break
+		}
+
+		if pulse {
+			if err := dp.StartCPU(); err != nil {
+				return fmt.Errorf("failed to start CPU: %w", err)
+			}
+		}
+		interrupted := false
+		select {
+		case <-ctx.Done():
+			interrupted = true
+		case <-ticker.C:
+		}
+		if pulse {
+			if err := dp.StopCPU(); err != nil {
+				return fmt.Errorf("failed to stop CPU: %w", err)
+			}
+		}
+		if interrupted {
+			break
+		}
+	}
+	return finishCapture(w, buffered, taken, late, time.Since(start))
+}
+
+// finishCapture flushes the output and reports the rate achieved. When the
+// samples go to standard output the report goes to standard error.
+func finishCapture(w capture.Writer, buffered *bufio.Writer, taken, late int, elapsed time.Duration) error {
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write samples: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write samples: %w", err)
+	}
+	if quietFlag {
+		return nil
+	}
+
+	var report io.Writer = os.Stdout
+	if captureOutput == "-" {
+		report = os.Stderr
+	}
+	rate := 0.0
+	if taken > 1 && elapsed > 0 {
+		rate = float64(taken-1) / elapsed.Seconds()
+	}
+	fmt.Fprintf(report, "Captured %d samples in %s (%.1f per second).\n", taken, elapsed.Round(time.Millisecond), rate)
+	if late > 0 {
+		fmt.Fprintf(report, "%d samples were late; the connection may be too slow for %g samples per second.\n", late, captureRate)
+	}
+	return nil
+}
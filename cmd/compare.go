@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	compareAddress string
+	compareCount   string
+)
+
+// compareCmd represents the memory compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare <file>",
+	Short: "Compare device memory with a binary file",
+	Long: `Read memory from the Foenix hardware and compare it with a local binary
+file loaded at the given address.
+
+Mismatched ranges are listed, followed by the differing lines in hex dump
+format: the device line first, then the file line. On a terminal differing
+bytes are highlighted; otherwise matching bytes are shown as "..". The command
+fails if any byte differs.
+
+Example:
+  foenixmgr compare program.bin --address 2000
+  foenixmgr compare font.bin --address C000 --count 800`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return compareMemory(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVar(&compareAddress, "address", "", "Address the file is loaded at (hex) or label")
+	compareCmd.Flags().StringVar(&compareCount, "count", "", "Number of bytes to compare (hex, default whole file)")
+}
+
+// compareMemory reads memory and reports differences from the file
+func compareMemory(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if compareAddress == "" {
+		compareAddress = cfg.Address
+	}
+
+	addr, err := resolveAddress(compareAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	expected, err := util.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if compareCount != "" {
+		count, err := util.ParseHexCount(compareCount)
+		if err != nil {
+			return fmt.Errorf("invalid count: %w", err)
+		}
+		if count < uint32(len(expected)) {
+			expected = expected[:count]
+		}
+	}
+
+	if len(expected) == 0 {
+		return fmt.Errorf("%s is empty", filename)
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Comparing %d bytes at 0x%X with %s...\n", len(expected), addr, filename)
+	actual, err := dp.ReadRange(addr, uint32(len(expected)))
+	if err != nil {
+		return fmt.Errorf("failed to read memory: %w", err)
+	}
+
+	ranges := mismatchedRanges(expected, actual)
+	if jsonFlag {
+		return printCompareJSON(filename, addr, expected, actual, ranges)
+	}
+
+	if len(ranges) == 0 {
+		printOutcome("Memory matches %s.\n", filename)
+		return nil
+	}
+
+	differing := 0
+	for _, r := range ranges {
+		fmt.Printf("Mismatch at 0x%06X-0x%06X (%d bytes)\n", addr+r[0], addr+r[1]-1, r[1]-r[0])
+		differing += int(r[1] - r[0])
+	}
+	fmt.Println()
+
+	device := "device"
+	if dryRunFlag {
+		device = "simulated device"
+	}
+	highlight := util.IsTerminal(os.Stdout)
+	deviceLines := util.DiffLines(expected, actual, addr, highlight)
+	fileLines := util.DiffLines(actual, expected, addr, highlight)
+	for i := range deviceLines {
+		fmt.Printf("%s  %s\n", deviceLines[i], device)
+		fmt.Printf("%s  file\n", fileLines[i])
+	}
+
+	return &protocol.Error{Kind: protocol.ErrVerify, Err: fmt.Errorf("%d bytes in %d ranges differ from %s", differing, len(ranges), filename)}
+}
+
+// printCompareJSON prints the comparison result as JSON. A mismatch still
+// fails the command.
+func printCompareJSON(filename string, addr uint32, expected, actual []byte, ranges [][2]uint32) error {
+	type mismatch struct {
+		Address uint32 `json:"address"`
+		Length  uint32 `json:"length"`
+		Device  string `json:"device"` // Hex encoded
+		File    string `json:"file"`   // Hex encoded
+	}
+
+	mismatches := []mismatch{}
+	differing := uint32(0)
+	for _, r := range ranges {
+		mismatches = append(mismatches, mismatch{
+			Address: addr + r[0],
+			Length:  r[1] - r[0],
+			Device:  hexData(actual[r[0]:r[1]]),
+			File:    hexData(expected[r[0]:r[1]]),
+		})
+		differing += r[1] - r[0]
+	}
+
+	if err := printJSON(struct {
+		File       string     `json:"file"`
+		Address    uint32     `json:"address"`
+		Length     int        `json:"length"`
+		Match      bool       `json:"match"`
+		Mismatches []mismatch `json:"mismatches"`
+	}{filename, addr, len(expected), len(ranges) == 0, mismatches}); err != nil {
+		return err
+	}
+
+	if len(ranges) > 0 {
+		return reportedError{&protocol.Error{Kind: protocol.ErrVerify, Err: fmt.Errorf("%d bytes in %d ranges differ from %s", differing, len(ranges), filename)}}
+	}
+	return nil
+}
+
+// mismatchedRanges returns the [start, end) offsets of runs of differing bytes
+func mismatchedRanges(expected, actual []byte) [][2]uint32 {
+	var ranges [][2]uint32
+	for i := 0; i < len(expected); i++ {
+		if expected[i] == actual[i] {
+			continue
+		}
+		start := i
+		for i < len(expected) && expected[i] != actual[i] {
+			i++
+		}
+		ranges = append(ranges, [2]uint32{uint32(start), uint32(i)})
+	}
+	return ranges
+}
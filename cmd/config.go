@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the configuration command group
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "View and edit settings",
+	Long: `View the effective configuration and change settings in foenixmgr.ini.
+
+Values shown by 'get' and 'list' include any command line overrides, such as
+--port and --target. 'set' writes to the [DEFAULT] section of the
+foenixmgr.ini file that was loaded.
+
+Example:
+  foenixmgr config list
+  foenixmgr config get port
+  foenixmgr config set port /dev/ttyUSB1
+  foenixmgr config path`,
+}
+
+// configGetCmd prints one setting
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show the effective value of a setting",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := cfg.Get(args[0])
+		if err != nil {
+			return err
+		}
+		if jsonFlag {
+			return printJSON(map[string]string{args[0]: value})
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+// configSetCmd changes one setting in foenixmgr.ini
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Save a setting to foenixmgr.ini",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setConfigValue(args[0], args[1])
+	},
+}
+
+// configListCmd prints every setting
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the effective value of every setting",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings := make(map[string]string)
+		for _, key := range config.Keys() {
+			value, err := cfg.Get(key)
+			if err != nil {
+				return err
+			}
+			if jsonFlag {
+				settings[key] = value
+				continue
+			}
+			fmt.Printf("%-14s = %-20s # %s\n", key, value, config.KeyDescription(key))
+		}
+		if jsonFlag {
+			return printJSON(settings)
+		}
+		return nil
+	},
+}
+
+// configProfilesCmd lists the profiles defined in foenixmgr.ini
+var configProfilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List the profiles defined in foenixmgr.ini",
+	Long: `List the [profile.NAME] sections of foenixmgr.ini with their settings. A
+profile is selected with --profile NAME or FOENIX_PROFILE=NAME; the selected
+profile is marked.
+
+Example:
+  foenixmgr config profiles
+  foenixmgr --profile jr revision`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listProfiles()
+	},
+}
+
+// configPathCmd prints the location of the loaded foenixmgr.ini
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Show which foenixmgr.ini file is used",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := config.ConfigPath()
+		if err != nil {
+			return err
+		}
+		if jsonFlag {
+			return printJSON(struct {
+				Path string `json:"path"`
+			}{path})
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configProfilesCmd)
+}
+
+// setConfigValue saves a setting to the loaded foenixmgr.ini
+func setConfigValue(key, value string) error {
+	path, err := config.ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Save(path, key, value); err != nil {
+		return err
+	}
+
+	printInfo("Set %s = %s in %s\n", key, value, path)
+	return nil
+}
+
+// listProfiles prints the profiles and their settings
+func listProfiles() error {
+	selected := ""
+	if p := cfg.Profile(); p != nil {
+		selected = p.Name
+	}
+
+	if jsonFlag {
+		type profileJSON struct {
+			Name     string            `json:"name"`
+			Selected bool              `json:"selected"`
+			Settings map[string]string `json:"settings"`
+		}
+		profiles := []profileJSON{}
+		for _, p := range cfg.Profiles() {
+			profiles = append(profiles, profileJSON{p.Name, p.Name == selected, p.Settings})
+		}
+		return printJSON(profiles)
+	}
+
+	profiles := cfg.Profiles()
+	if len(profiles) == 0 {
+		fmt.Println("No profiles defined (add [profile.NAME] sections to foenixmgr.ini)")
+		return nil
+	}
+	for _, p := range profiles {
+		marker := " "
+		if p.Name == selected {
+			marker = "*"
+		}
+		keys := make([]string, 0, len(p.Settings))
+		for key := range p.Settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = key + "=" + p.Settings[key]
+		}
+		fmt.Printf("%s %-12s %s\n", marker, p.Name, strings.Join(fields, " "))
+	}
+	return nil
+}
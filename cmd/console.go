@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/daschewie/foenixmgr/pkg/video"
+	"github.com/spf13/cobra"
+)
+
+var (
+	consoleColumns  int
+	consoleRows     int
+	consoleInterval time.Duration
+	consoleKeys     bool
+)
+
+// consoleKeyRegion is the region of the keystroke mailbox byte
+const consoleKeyRegion = "console.key"
+
+// consoleCmd represents the console command
+var consoleCmd = &cobra.Command{
+	Use:   "console",
+	Short: "Show the text screen in the terminal",
+	Long: `Poll the text screen of the target machine and show it in the terminal,
+redrawing it when it changes, until interrupted with Ctrl+C.
+
+The text screen is read from the video.text region of the target machine.
+Printable ASCII is shown as is, character 0 as a space and other characters
+as dots.
+
+With --keys, lines typed on the host are sent to the machine when Enter is
+pressed, one key code at a time followed by a carriage return (0x0D). The
+debug port has no access to the keyboard controller, so keys are delivered
+through a mailbox byte at the console.key region: foenixmgr writes a key code
+when the byte is 0, and the program running on the machine reads it and
+clears it to 0.
+
+As with watch, the machine is in debug mode while polling. To follow a
+running program on machines with stop/start support, stop the CPU first: the
+console lets it run for each interval and stops it again to read the screen.
+
+Example:
+  foenixmgr stop && foenixmgr console --target f256k
+  foenixmgr console --columns 40 --rows 30 --keys --target f256k`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConsole()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(consoleCmd)
+
+	consoleCmd.Flags().IntVar(&consoleColumns, "columns", 80, "Text screen width in characters")
+	consoleCmd.Flags().IntVar(&consoleRows, "rows", 60, "Text screen height in characters")
+	consoleCmd.Flags().DurationVar(&consoleInterval, "interval", 250*time.Millisecond, "Time between screen reads")
+	consoleCmd.Flags().BoolVar(&consoleKeys, "keys", false, "Send typed lines to the console.key mailbox")
+}
+
+// runConsole polls the text screen and shows it until interrupted
+func runConsole() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if consoleColumns <= 0 || consoleRows <= 0 {
+		return fmt.Errorf("the screen size must be positive")
+	}
+	if consoleInterval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	cells := uint32(consoleColumns * consoleRows)
+	text, err := cfg.MachineRegion(video.RegionText)
+	if err != nil {
+		return err
+	}
+	if text.Size != 0 && text.Size < cells {
+		return fmt.Errorf("the %s region is 0x%X bytes, 0x%X are needed", video.RegionText, text.Size, cells)
+	}
+
+	var mailbox config.Region
+	var keys chan byte
+	if consoleKeys {
+		if mailbox, err = cfg.MachineRegion(consoleKeyRegion); err != nil {
+			return err
+		}
+		keys = readConsoleKeys()
+	}
+
+	// A stopped CPU is released for each interval, so a running program can
+	// be observed
+	pulse := util.IsStopped(cfg.Port)
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	ctx := handleInterrupts()
+
+	terminal := util.IsTerminal(os.Stdout)
+	if terminal {
+		fmt.Print("\x1b[2J")
+	}
+
+	var previous, pending []byte
+	for {
+		screen, err := dp.ReadRange(text.Address, cells)
+		if err != nil {
+			return fmt.Errorf("failed to read text screen: %w", err)
+		}
+		if !bytes.Equal(screen, previous) {
+			lines := video.TextLines(screen, consoleColumns)
+			if terminal {
+				fmt.Print("\x1b[H" + strings.Join(lines, "\n") + "\n")
+			} else {
+				fmt.Printf("--- %s\n%s\n", time.Now().Format("15:04:05.000"), strings.Join(lines, "\n"))
+			}
+			previous = screen
+		}
+
+		// Collect typed keys and deliver the next one if the mailbox is free
+		for drained := keys == nil; !drained; {
+			select {
+			case k := <-keys:
+				pending = append(pending, k)
+			default:
+				drained = true
+			}
+		}
+		if len(pending) > 0 {
+			value, err := dp.ReadBlock(mailbox.Address, 1)
+			if err != nil {
+				return fmt.Errorf("failed to read key mailbox: %w", err)
+			}
+			if value[0] == 0 {
+				if err := dp.WriteBlock(mailbox.Address, pending[:1]); err != nil {
+					return fmt.Errorf("failed to write key mailbox: %w", err)
+				}
+				pending = pending[1:]
+			}
+		}
+
+		if pulse {
+			if err := dp.StartCPU(); err != nil {
+				return fmt.Errorf("failed to start CPU: %w", err)
+			}
+		}
+
+		interrupted := false
+		select {
+		case <-ctx.Done():
+			interrupted = true
+		case <-time.After(consoleInterval):
+		}
+
+		if pulse {
+			if err := dp.StopCPU(); err != nil {
+				return fmt.Errorf("failed to stop CPU: %w", err)
+			}
+		}
+		if interrupted {
+			return nil
+		}
+	}
+}
+
+// readConsoleKeys reads lines from standard input in the background and
+// returns their characters, each line ending with a carriage return
+func readConsoleKeys() chan byte {
+	keys := make(chan byte, 256)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			for _, c := range scanner.Bytes() {
+				keys <- c
+			}
+			keys <- '\r'
+		}
+	}()
+	return keys
+}
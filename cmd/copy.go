@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
 	"github.com/daschewie/foenixmgr/pkg/protocol"
 	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
@@ -13,9 +14,9 @@ import (
 
 // copyCmd represents the copy command for F256jr SD card
 var copyCmd = &cobra.Command{
-	Use:   "copy <file>",
-	Short: "Copy file to F256jr SD card",
-	Long: `Copy a file to the F256jr SD card.
+	Use:   "copy <file|dir>...",
+	Short: "Copy files to F256jr SD card",
+	Long: `Copy files to the F256jr SD card.
 
 This command uploads a file to the F256jr's RAM and signals the firmware
 to copy it to the SD card. The file is uploaded along with its filename,
@@ -23,64 +24,187 @@ size, and CRC32 checksum.
 
 The maximum file size is (7*65536)-(9*1024) bytes (approximately 448 KB).
 
-This command is specific to F256jr hardware.
+Several files can be given, and a directory copies the files in it (not its
+subdirectories). All files are checked before anything is uploaded. The
+firmware copies a file when the machine leaves debug mode, so after each file
+but the last the machine leaves debug mode and foenixmgr waits --interval for
+the copy before uploading the next one.
+
+--dest-name stores a single file under a different 8.3 name on the card.
+
+Progress is shown while the file is uploaded. With --verify the uploaded data
+is read back and its CRC32 checked before the firmware is signalled. The
+firmware doesn't report the copy's result anywhere the debug port can read,
+so completion can't be polled.
+
+This command is specific to F256jr hardware. The firmware's file exchange
+area only handles copies to the card: there is no request to list the card or
+read a file back, so files can't be retrieved this way.
 
 Example:
-  foenixmgr copy program.bin`,
-	Args: cobra.ExactArgs(1),
+  foenixmgr copy program.bin
+  foenixmgr copy program.bin --verify
+  foenixmgr copy build/program.pgz --dest-name GAME.PGZ
+  foenixmgr copy file1.bin file2.bin assets/`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return copyFile(args[0])
+		return copyFiles(args)
 	},
 }
 
+var (
+	copyVerify   bool
+	copyDestName string
+	copyInterval time.Duration
+)
+
+// copyMaxFileSize is the largest file the firmware can copy: (7*65536)-(9*1024)
+const copyMaxFileSize = (7 * 65536) - (9 * 1024)
+
 func init() {
 	rootCmd.AddCommand(copyCmd)
+
+	copyCmd.Flags().BoolVar(&copyVerify, "verify", false, "Read the uploaded file back and check its CRC32 before signalling the firmware")
+	copyCmd.Flags().StringVar(&copyDestName, "dest-name", "", "Name (8.3) to store a single file under on the card")
+	copyCmd.Flags().DurationVar(&copyInterval, "interval", 5*time.Second, "Time to let the firmware copy each file before uploading the next")
+}
+
+// copyJob is one file to copy to the card
+type copyJob struct {
+	filename string
+	destName string // Name on the card
+	data     []byte
 }
 
-// copyFile copies a file to the F256jr SD card
-func copyFile(filename string) error {
+// copyFiles copies files, and the files in directories, to the F256jr SD card
+func copyFiles(args []string) error {
 	if err := validateConnectionFlags(); err != nil {
 		return err
 	}
 
-	// Maximum file size: (7*65536)-(9*1024)
-	const maxFileSize = (7 * 65536) - (9 * 1024)
+	jobs, err := planCopy(args)
+	if err != nil {
+		return err
+	}
 
-	// Read file
-	fileData, err := os.ReadFile(filename)
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
 
-	fileSize := len(fileData)
-	if fileSize >= maxFileSize {
-		return fmt.Errorf("file too large (%d bytes, max %d bytes)", fileSize, maxFileSize)
+	total := 0
+	for i, job := range jobs {
+		if i > 0 {
+			printInfo("\n")
+		}
+		if len(jobs) > 1 {
+			printInfo("[%d/%d] ", i+1, len(jobs))
+		}
+		if err := copyFile(dp, job); err != nil {
+			return fmt.Errorf("%s: %w", job.filename, err)
+		}
+		total += len(job.data)
+
+		// Let the firmware copy this file before the next one replaces it
+		if i < len(jobs)-1 {
+			if err := session.ExitDebug(); err != nil {
+				return fmt.Errorf("failed to exit debug mode: %w", err)
+			}
+			printInfo("Waiting %v for the firmware to copy %s...\n", copyInterval, job.destName)
+			time.Sleep(copyInterval)
+			if err := session.EnterDebug(); err != nil {
+				return fmt.Errorf("failed to enter debug mode: %w", err)
+			}
+		}
 	}
 
-	// Calculate CRC32
-	crc32 := util.CalculateCRC32(fileData)
+	if len(jobs) > 1 {
+		printInfo("\nSent %d files (%d bytes) to the firmware.\n", len(jobs), total)
+	}
+	return nil
+}
 
-	printInfo("File: %s\n", filename)
-	printInfo("Size: %d bytes\n", fileSize)
-	printInfo("CRC32: 0x%08X\n", crc32)
+// planCopy expands directories into the files they hold and reads and checks
+// every file before anything is uploaded
+func planCopy(args []string) ([]copyJob, error) {
+	var filenames []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if !info.IsDir() {
+			filenames = append(filenames, arg)
+			continue
+		}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				filenames = append(filenames, filepath.Join(arg, entry.Name()))
+			}
+		}
 	}
-	defer conn.Close()
 
-	dp := protocol.NewDebugPort(conn, cfg)
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no files to copy")
+	}
+	if copyDestName != "" {
+		if len(filenames) > 1 {
+			return nil, fmt.Errorf("--dest-name can only be used when copying a single file")
+		}
+		if !isShortName(copyDestName) {
+			return nil, fmt.Errorf("invalid --dest-name '%s': expected an 8.3 name such as GAME.PGZ", copyDestName)
+		}
+	}
+
+	var jobs []copyJob
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if len(data) >= copyMaxFileSize {
+			return nil, fmt.Errorf("%s is too large (%d bytes, max %d bytes)", filename, len(data), copyMaxFileSize)
+		}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
+		destName := filepath.Base(filename)
+		if copyDestName != "" {
+			destName = copyDestName
 		}
-		defer dp.ExitDebug()
+		jobs = append(jobs, copyJob{filename: filename, destName: destName, data: data})
+	}
+	return jobs, nil
+}
+
+// isShortName returns true for an 8.3 file name: up to eight characters,
+// optionally followed by a dot and up to three
+func isShortName(name string) bool {
+	base, ext, _ := strings.Cut(name, ".")
+	if base == "" || len(base) > 8 || len(ext) > 3 || strings.Contains(ext, ".") {
+		return false
+	}
+	return !strings.ContainsAny(name, ` "*+,/:;<=>?\[]|`)
+}
+
+// copyFile uploads one file and signals the firmware to copy it to the SD card
+func copyFile(dp *protocol.DebugPort, job copyJob) error {
+	fileData := job.data
+	fileSize := len(fileData)
+
+	// Calculate CRC32
+	crc32 := util.CalculateCRC32(fileData)
+
+	printInfo("File: %s\n", job.filename)
+	if job.destName != filepath.Base(job.filename) {
+		printInfo("Card name: %s\n", job.destName)
 	}
+	printInfo("Size: %d bytes\n", fileSize)
+	printInfo("CRC32: 0x%08X\n", crc32)
 
 	// Upload file data to RAM starting at 0x10000
 	printInfo("Uploading file data to RAM...\n")
@@ -88,8 +212,7 @@ func copyFile(filename string) error {
 	currentAddr := uint32(0x10000)
 
 	// 1. Write filename (null-terminated)
-	basename := filepath.Base(filename)
-	filenameBytes := []byte(basename)
+	filenameBytes := []byte(job.destName)
 	if err := dp.WriteBlock(currentAddr, filenameBytes); err != nil {
 		return fmt.Errorf("failed to write filename: %w", err)
 	}
@@ -124,25 +247,29 @@ func copyFile(filename string) error {
 	}
 	currentAddr += 3
 
-	// 4. Write file data in chunks
-	chunkSize := cfg.ChunkSize
-	totalLength := len(fileData)
-	chunkOffset := 0
-
-	for totalLength > 0 {
-		currentChunkSize := chunkSize
-		if totalLength < chunkSize {
-			currentChunkSize = totalLength
+	// 4. Write file data in chunks, showing progress
+	dataAddr := currentAddr
+	chunkSize := dp.ChunkSize()
+	for offset := 0; offset < fileSize; offset += chunkSize {
+		end := offset + chunkSize
+		if end > fileSize {
+			end = fileSize
 		}
-
-		chunk := fileData[chunkOffset : chunkOffset+currentChunkSize]
-		if err := dp.WriteBlock(currentAddr, chunk); err != nil {
+		if err := dp.WriteRange(dataAddr+uint32(offset), fileData[offset:end]); err != nil {
 			return fmt.Errorf("failed to write file chunk: %w", err)
 		}
+		printProgress("Uploading", end, fileSize)
+	}
 
-		currentAddr += uint32(currentChunkSize)
-		totalLength -= currentChunkSize
-		chunkOffset += currentChunkSize
+	if copyVerify {
+		printInfo("Verifying upload...\n")
+		readCRC, err := dp.ChecksumRegion(dataAddr, uint32(fileSize))
+		if err != nil {
+			return fmt.Errorf("verification read failed: %w", err)
+		}
+		if readCRC != crc32 {
+			return fmt.Errorf("%w: uploaded data has CRC32 0x%08X, file has 0x%08X", protocol.ErrVerify, readCRC, crc32)
+		}
 	}
 
 	// 5. Trigger firmware copy by writing "COPYFILE" signature to 0x0080
@@ -152,6 +279,26 @@ func copyFile(filename string) error {
 		return fmt.Errorf("failed to write copy signature: %w", err)
 	}
 
-	printInfo("Copy request sent to firmware.\n")
+	printInfo("Copy request sent to firmware. The copy runs when the machine leaves debug mode.\n")
 	return nil
 }
+
+// printProgress shows how much of a transfer is done. On a terminal the line
+// is updated in place; otherwise only the end of the transfer is reported.
+func printProgress(label string, done, total int) {
+	if quietFlag {
+		return
+	}
+	percent := 100
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	if util.IsTerminal(os.Stdout) {
+		fmt.Printf("\r%s: %d/%d bytes (%d%%)", label, done, total, percent)
+		if done >= total {
+			fmt.Println()
+		}
+	} else if done >= total {
+		fmt.Printf("%s: %d/%d bytes (%d%%)\n", label, done, total, percent)
+	}
+}
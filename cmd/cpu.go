@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
 	"github.com/daschewie/foenixmgr/pkg/protocol"
 	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
@@ -18,8 +17,9 @@ var stopCmd = &cobra.Command{
 This command is specific to F256 machines and puts the CPU into a stopped state.
 The CPU will remain stopped until a 'start' command is issued.
 
-This creates a persistent stopped state tracked by the f256.stp file, allowing
-multiple debug operations without CPU reset between commands.
+This creates a persistent stopped state for the port, kept in the user's config
+directory (see 'status'), allowing multiple debug operations without CPU reset
+between commands.
 
 Example:
   foenixmgr stop`,
@@ -37,7 +37,7 @@ var startCmd = &cobra.Command{
 This command resumes CPU execution without triggering a reset. The CPU will
 continue from where it was stopped.
 
-This clears the persistent stopped state (f256.stp file).
+This clears the persistent stopped state of the port.
 
 Example:
   foenixmgr start`,
@@ -57,18 +57,18 @@ func stopCPU() error {
 		return err
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	if err := checkCapability(protocol.CapStopCPU); err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	// Open the shared connection
+	dp, err := openDebugPort()
+	if err != nil {
+		return err
+	}
 
 	// Enter debug mode first
-	if err := dp.EnterDebug(); err != nil {
+	if err := session.EnterDebug(); err != nil {
 		return fmt.Errorf("failed to enter debug mode: %w", err)
 	}
 
@@ -78,8 +78,11 @@ func stopCPU() error {
 		return fmt.Errorf("failed to stop CPU: %w", err)
 	}
 
+	// Leave the machine in debug mode when the session closes
+	session.ReleaseDebug()
+
 	// Set the stop indicator file
-	if err := util.SetStopIndicator(); err != nil {
+	if err := util.SetStopIndicator(cfg.Port); err != nil {
 		return fmt.Errorf("failed to set stop indicator: %w", err)
 	}
 
@@ -93,21 +96,21 @@ func startCPU() error {
 		return err
 	}
 
+	if err := checkCapability(protocol.CapStopCPU); err != nil {
+		return err
+	}
+
 	// Check if CPU is actually stopped
-	if !util.IsStopped() {
+	if !util.IsStopped(cfg.Port) {
 		printInfo("CPU is not in stopped state.\n")
 		return nil
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	// Open the shared connection
+	dp, err := openDebugPort()
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
-
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
 
 	// Start the CPU (no need to enter debug mode, we're already in it)
 	printInfo("Starting CPU...\n")
@@ -116,12 +119,12 @@ func startCPU() error {
 	}
 
 	// Exit debug mode
-	if err := dp.ExitDebug(); err != nil {
+	if err := session.ExitDebug(); err != nil {
 		return fmt.Errorf("failed to exit debug mode: %w", err)
 	}
 
 	// Clear the stop indicator file
-	if err := util.ClearStopIndicator(); err != nil {
+	if err := util.ClearStopIndicator(cfg.Port); err != nil {
 		return fmt.Errorf("failed to clear stop indicator: %w", err)
 	}
 
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/dap"
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var dapListen string
+
+// dapCmd represents the Debug Adapter Protocol server command
+var dapCmd = &cobra.Command{
+	Use:   "dap",
+	Short: "Serve the Debug Adapter Protocol over the debug port",
+	Long: `Run a Debug Adapter Protocol (DAP) server, so editors such as VS Code can
+debug programs on the Foenix hardware.
+
+By default the adapter talks DAP on stdin/stdout, the way VS Code starts
+debug adapters; informational output is suppressed. With --listen it accepts
+editor connections over TCP instead, one at a time.
+
+Requests map to debug port operations:
+  launch          Halt the CPU, upload the program (by file extension: .hex,
+                  .srec, .pgx, .pgz, .elf) and set the reset vectors
+  attach          Halt the CPU
+  pause/continue  Stop and start the CPU
+  next/stepIn     Release the CPU briefly and stop it again
+  readMemory,     Read and write memory
+  writeMemory
+  variables       Registers from the register snapshot your code writes to
+                  register_address (see 'registers --help')
+
+The same limitations as gdb-server apply: halting needs stop/start support
+(F256 machines), and breakpoints are reported as unverified because the debug
+port can't report reaching them. A launched program starts at its entry point
+when the CPU is reset, e.g. when the adapter exits debug mode.
+
+Example:
+  foenixmgr dap --target f256k
+  foenixmgr dap --listen :4711 --target f256k`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDAP()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dapCmd)
+
+	dapCmd.Flags().StringVar(&dapListen, "listen", "", "Address to listen on for editor connections (default: stdin/stdout)")
+}
+
+// runDAP serves DAP sessions on stdio or a TCP listener
+func runDAP() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	// stdout carries DAP messages only
+	if dapListen == "" {
+		quietFlag = true
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	target := &dapTarget{&debugTarget{
+		dp:      dp,
+		canStop: checkCapability(protocol.CapStopCPU) == nil,
+		stopped: util.IsStopped(cfg.Port),
+	}}
+	if address, err := registerAddress(); err == nil {
+		target.registers = &address
+	} else {
+		printInfo("Registers unavailable: %v\n", err)
+	}
+
+	if dapListen == "" {
+		return dap.NewSession(target, os.Stdin, os.Stdout).Serve()
+	}
+
+	listener, err := net.Listen("tcp", dapListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", dapListen, err)
+	}
+
+	interrupted := handleInterrupts()
+	go func() {
+		<-interrupted.Done()
+		listener.Close()
+	}()
+
+	printInfo("Waiting for editor connections on %s (Ctrl+C to stop)\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		printInfo("Connection from %s\n", conn.RemoteAddr())
+		if err := dap.NewSession(target, conn, conn).Serve(); err != nil && err != io.EOF {
+			printInfo("Session ended: %v\n", err)
+		}
+		conn.Close()
+	}
+}
+
+// dapTarget adapts the debug port to the DAP server
+type dapTarget struct {
+	*debugTarget
+}
+
+// Load uploads a program file and points the reset vectors at its start
+// address, when it has one
+func (t *dapTarget) Load(program string) error {
+	format, err := loader.FormatForFile(program)
+	if err != nil {
+		return err
+	}
+	ldr, err := loader.New(format, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := ldr.Open(program); err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer ldr.Close()
+
+	batch := t.dp.NewWriteBatch()
+	ldr.SetHandler(batch.Write)
+	if err := ldr.Process(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	return setVectorsFromFile(ldr, t.dp.WriteBlock, false)
+}
+
+// Registers reads the register snapshot
+func (t *dapTarget) Registers() ([]dap.Register, uint32, error) {
+	if t.registers == nil {
+		return nil, 0, fmt.Errorf("no register_address set for the target")
+	}
+
+	regs, err := t.dp.ReadRegisters(*t.registers, cfg.CPU)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var registers []dap.Register
+	for _, r := range regs.Registers {
+		registers = append(registers, dap.Register{Name: r.Name, Value: r.String()})
+	}
+	registers = append(registers, dap.Register{Name: "Flags", Value: regs.Flags})
+	return registers, regs.PC(), nil
+}
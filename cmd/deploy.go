@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/deploy"
+	"github.com/spf13/cobra"
+)
+
+var deployManifest string
+
+// deployCmd represents the manifest deployment command
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Deploy a build described by a manifest over one connection",
+	Long: `Deploy a build as described by a YAML manifest: flash to program, the boot
+source, files to upload and the actions that finish the deployment. Every
+step runs over a single connection, so one Makefile rule or CI job replaces
+a chain of foenixmgr invocations.
+
+The whole manifest is checked first, including that its files exist, so a
+mistake stops the deployment before anything is written. The steps then run
+in order: flash, boot, uploads, after. The first step that fails stops the
+deployment and is named in the error, with the exit code of the failure.
+
+File names are relative to the manifest, and can be http(s) URLs. A manifest
+that programs flash asks for confirmation once, unless --yes is given.
+
+Manifest:
+  target: f256k              # unless --target is given
+  port: 192.168.1.114:2560   # unless --port is given
+  flash:
+    - file: kernel.bin
+      sectors: 3F            # omit to program the whole flash
+      address: 10000         # RAM address the data is staged at
+      verify: true
+  boot: ram                  # ram or flash
+  uploads:
+    - file: game.pgz         # format from the extension, or set format:
+    - file: data.bin
+      format: bin            # pgz, pgx, hex, srec, wdc, elf, bin, m68k-bin
+      address: 20000
+  after:
+    - run                    # reset, start, or run the last upload
+
+Example:
+  foenixmgr deploy
+  foenixmgr deploy --manifest release/deploy.yaml --yes
+  foenixmgr deploy --manifest deploy.yaml --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDeploy()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deployCmd)
+
+	deployCmd.Flags().StringVar(&deployManifest, "manifest", "deploy.yaml", "Deployment manifest (YAML)")
+}
+
+// runDeploy checks a manifest and runs its steps in this process, so they
+// share one connection
+func runDeploy() error {
+	m, err := deploy.Load(deployManifest)
+	if err != nil {
+		return err
+	}
+	steps, err := m.Steps()
+	if err != nil {
+		return fmt.Errorf("%s: %w", deployManifest, err)
+	}
+
+	// Every step starts from the global flags given to 'deploy', with the
+	// manifest's target and port unless they were given
+	flags := rootCmd.PersistentFlags()
+	globals := saveFlags(flags)
+	if m.Target != "" && !flags.Changed("target") {
+		globals["target"] = savedFlag{m.Target, true}
+	}
+	if m.Port != "" && !flags.Changed("port") {
+		globals["port"] = savedFlag{m.Port, true}
+	}
+
+	if m.HasFlash() {
+		ok, err := confirm(fmt.Sprintf("%s reprograms flash memory. Proceed? (y/n): ", deployManifest))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			printInfo("Deployment cancelled.\n")
+			return nil
+		}
+		// Confirmed once for the whole deployment
+		globals["yes"] = savedFlag{"true", true}
+	}
+
+	for i, step := range steps {
+		printInfo("[%d/%d] %s\n", i+1, len(steps), step.Name)
+		if err := runScriptCommand(step.Args, globals); err != nil {
+			return fmt.Errorf("deploy step %d of %d (%s) failed: %w", i+1, len(steps), step.Name, err)
+		}
+	}
+
+	printInfo("Deployment complete (%d steps).\n", len(steps))
+	return nil
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/spf13/cobra"
+	"go.bug.st/serial"
+)
+
+var (
+	detectTimeout int
+	detectSave    bool
+)
+
+// detectCmd represents the detect command
+var detectCmd = &cobra.Command{
+	Use:   "detect",
+	Short: "Find the serial port a Foenix is connected to",
+	Long: `Probe every serial port with a revision request and report which ports
+answer like a Foenix debug port. The revision request doesn't enter debug
+mode, so a running program is not disturbed.
+
+With --save, the port found is written to foenixmgr.ini. This fails if more
+than one port answers.
+
+Example:
+  foenixmgr detect
+  foenixmgr detect --save
+  foenixmgr detect --probe-timeout 2`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return detectPorts()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(detectCmd)
+
+	detectCmd.Flags().IntVar(&detectTimeout, "probe-timeout", 1, "Seconds to wait for each port to answer")
+	detectCmd.Flags().BoolVar(&detectSave, "save", false, "Save the port found to foenixmgr.ini")
+}
+
+// portProbe is the result of probing one serial port
+type portProbe struct {
+	Port     string `json:"port"`
+	Found    bool   `json:"found"`
+	Revision byte   `json:"revision,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// detectPorts probes every serial port and reports the Foenix machines found
+func detectPorts() error {
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		return fmt.Errorf("failed to get port list: %w", err)
+	}
+
+	probes := []portProbe{}
+	var found []string
+	for _, port := range ports {
+		printInfo("Probing %s...\n", port)
+		probe := probePort(port)
+		if probe.Found {
+			found = append(found, port)
+		}
+		probes = append(probes, probe)
+	}
+
+	if jsonFlag {
+		if err := printJSON(probes); err != nil {
+			return err
+		}
+	} else {
+		if len(ports) == 0 {
+			fmt.Println("No serial ports found")
+		}
+		for _, p := range probes {
+			if p.Found {
+				fmt.Printf("  %-20s Foenix debug port (revision %X)\n", p.Port, p.Revision)
+			} else {
+				fmt.Printf("  %-20s no response\n", p.Port)
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return fmt.Errorf("no Foenix found")
+	}
+
+	if detectSave {
+		if len(found) > 1 {
+			return fmt.Errorf("found a Foenix on %d ports, use 'config set port' to choose one", len(found))
+		}
+		return setConfigValue("port", found[0])
+	}
+	return nil
+}
+
+// probePort sends a revision request to a serial port with a short timeout
+// and no retries
+func probePort(port string) portProbe {
+	probe := portProbe{Port: port}
+
+	probeCfg := *cfg
+	probeCfg.Timeout = detectTimeout
+	probeCfg.Retries = 0
+
+	conn := connection.NewSerialConnection(&probeCfg)
+	if err := conn.Open(port); err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	defer conn.Close()
+
+	rev, err := protocol.NewDebugPort(conn, &probeCfg).GetRevision()
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+
+	probe.Found = true
+	probe.Revision = rev
+	return probe
+}
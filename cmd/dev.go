@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+var (
+	devFormat   string
+	devDebounce time.Duration
+)
+
+// devCmd represents the watch-and-reload development command
+var devCmd = &cobra.Command{
+	Use:   "dev <file>",
+	Short: "Upload and run a program again every time it is rebuilt",
+	Long: `Upload and run a program, then watch the file and do it again every time
+it changes: the machine re-enters debug mode, the file is uploaded, the reset
+vectors are pointed at its start address and the CPU is restarted. Leave it
+running next to the editor for a tight edit-assemble-run loop.
+
+The format is taken from the file's extension unless --format is given
+(pgz, pgx, hex, srec, wdc or elf). Assemblers often write a file in several
+steps or replace it, so the reload waits until the file has been quiet for
+--debounce. A file that fails to upload, e.g. one caught half written, is
+reported and the next change is waited for. The connection stays open
+between reloads; stop with Ctrl+C.
+
+Example:
+  foenixmgr dev game.pgz
+  foenixmgr dev build/demo.bin --format wdc
+  foenixmgr dev program.hex --debounce 1s`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return devWatch(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devCmd)
+
+	devCmd.Flags().StringVar(&devFormat, "format", "", "File format: pgz, pgx, hex, srec, wdc or elf (default from the extension)")
+	devCmd.Flags().DurationVar(&devDebounce, "debounce", 300*time.Millisecond, "Wait this long after the last change before reloading")
+	devCmd.Flags().BoolVar(&uploadForce, "force", false, "Write blocks that reach I/O, flash or unmapped memory of the target machine")
+}
+
+// devFormatFor returns the loader format for the --format flag, or from the
+// file's extension without one
+func devFormatFor(filename string) (string, error) {
+	switch strings.ToLower(devFormat) {
+	case "":
+		return loader.FormatForFile(filename)
+	case "hex", "ihex", loader.FormatIntelHex:
+		return loader.FormatIntelHex, nil
+	case loader.FormatSREC, loader.FormatWDC, loader.FormatPGX, loader.FormatPGZ, loader.FormatELF:
+		return strings.ToLower(devFormat), nil
+	}
+	return "", fmt.Errorf("invalid --format '%s': expected pgz, pgx, hex, srec, wdc or elf", devFormat)
+}
+
+// devWatch uploads and runs a file each time it changes, until interrupted
+func devWatch(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+	if util.IsStream(filename) {
+		return fmt.Errorf("dev needs a file to watch, not standard input or a URL")
+	}
+
+	format, err := devFormatFor(filename)
+	if err != nil {
+		return err
+	}
+	if devDebounce < 0 {
+		return fmt.Errorf("debounce must not be negative")
+	}
+
+	target, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	// Build tools often replace the file instead of rewriting it, which
+	// ends a watch on the file itself, so its directory is watched
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", filename, err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(target)); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", filepath.Dir(filename), err)
+	}
+
+	ctx := handleInterrupts()
+
+	// Every reload starts the program, like upload --run
+	uploadRun = true
+	reloads := 0
+	reload := func() {
+		reloads++
+		printInfo("[%s] Reload %d\n", time.Now().Format("15:04:05"), reloads)
+		if err := uploadFile(filename, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Reload failed: %v\n", err)
+		}
+		printInfo("Watching %s for changes (Ctrl+C to stop)\n", filename)
+	}
+
+	if _, err := os.Stat(filename); err == nil {
+		reload()
+	} else {
+		printInfo("Waiting for %s to be built (Ctrl+C to stop)\n", filename)
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			name, err := filepath.Abs(event.Name)
+			if err != nil || name != target {
+				continue
+			}
+			// A removed or renamed file is about to be replaced; the new
+			// one arrives as a create
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			pending = time.After(devDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("failed to watch %s: %w", filename, err)
+
+		case <-pending:
+			pending = nil
+			if _, err := os.Stat(filename); err != nil {
+				continue
+			}
+			reload()
+		}
+	}
+}
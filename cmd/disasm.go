@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/disasm"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	disasmAddress string
+	disasmCount   string
+)
+
+// disasmCmd represents the disassemble command
+var disasmCmd = &cobra.Command{
+	Use:   "disasm",
+	Short: "Disassemble memory from specified address",
+	Long: `Read memory from the Foenix hardware and disassemble it for the configured
+CPU (65C02, 65816 or 680x0).
+
+The address may be a hex address or a label from the label file. When a label
+file is configured (--label-file or the labels setting in foenixmgr.ini),
+labelled addresses are shown by name in operands and listed before the
+instructions they mark.
+
+65816 code is assumed to start with 8-bit registers; REP and SEP instructions
+in the listing change the size of later immediates.
+
+Example:
+  foenixmgr disasm --address E000 --count 20
+  foenixmgr disasm --address main --label-file program.lbl`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return disassemble()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(disasmCmd)
+
+	disasmCmd.Flags().StringVar(&disasmAddress, "address", "", "Starting address (hex) or label")
+	disasmCmd.Flags().StringVar(&disasmCount, "count", "10", "Number of instructions to disassemble (hex)")
+}
+
+// disassemble reads memory and prints the disassembly
+func disassemble() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if disasmAddress == "" {
+		disasmAddress = cfg.Address
+	}
+
+	address, err := resolveAddress(disasmAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	count, err := util.ParseHexSize(disasmCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+
+	labels, err := loadLabels()
+	if err != nil {
+		return err
+	}
+	var symbols disasm.Symbols
+	if labels != nil {
+		symbols = labels.Addresses()
+	}
+
+	d, err := disasm.New(cfg.CPU, symbols)
+	if err != nil {
+		return err
+	}
+
+	// Read enough memory for count instructions of the longest length
+	length := int(count) * d.MaxLength()
+	if length > 0xFFFF {
+		length = 0xFFFF
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	data, err := dp.ReadBlock(address, uint16(length))
+	if err != nil {
+		return fmt.Errorf("failed to read memory: %w", err)
+	}
+
+	listing := disasm.Disassemble(d, data, address, int(count))
+	if jsonFlag {
+		return printDisasmJSON(listing)
+	}
+
+	// Show where a listing that doesn't start at a label is
+	if labels != nil && len(listing) > 0 && listing[0].Label == "" {
+		if name, ok := labels.ReverseLookup(address); ok {
+			fmt.Printf("<%s>:\n", name)
+		}
+	}
+	for _, inst := range listing {
+		if inst.Label != "" {
+			fmt.Printf("%s:\n", inst.Label)
+		}
+		fmt.Println(inst)
+	}
+
+	return nil
+}
+
+// printDisasmJSON prints a listing as JSON
+func printDisasmJSON(listing []disasm.Instruction) error {
+	type instruction struct {
+		Address  uint32 `json:"address"`
+		Label    string `json:"label,omitempty"`
+		Bytes    string `json:"bytes"` // Hex encoded
+		Mnemonic string `json:"mnemonic"`
+		Operand  string `json:"operand,omitempty"`
+	}
+
+	instructions := []instruction{}
+	for _, inst := range listing {
+		instructions = append(instructions, instruction{
+			Address:  inst.Address,
+			Label:    inst.Label,
+			Bytes:    hexData(inst.Bytes),
+			Mnemonic: inst.Mnemonic,
+			Operand:  inst.Operand,
+		})
+	}
+
+	return printJSON(struct {
+		Instructions []instruction `json:"instructions"`
+	}{instructions})
+}
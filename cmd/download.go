@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	downloadAddress string
+	downloadCount   string
+	downloadOutput  string
+	downloadFormat  string
+)
+
+// downloadCmd represents the memory download command
+var downloadCmd = &cobra.Command{
+	Use:   "download",
+	Short: "Save memory to a file",
+	Long: `Read a block of memory from the Foenix hardware and save it to a file.
+
+Memory is read in chunks of the configured chunk size, so the count may be
+larger than a single transfer.
+
+Output formats:
+  bin   - Raw binary (default)
+  ihex  - Intel HEX
+  srec  - Motorola SREC
+
+Example:
+  foenixmgr download --address 380000 --count 10000 --output dump.bin
+  foenixmgr download --address 380000 --count 100 --output dump.hex --format ihex`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return downloadMemory()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(downloadCmd)
+
+	downloadCmd.Flags().StringVar(&downloadAddress, "address", "", "Starting address (hex, e.g., 380000)")
+	downloadCmd.Flags().StringVar(&downloadCount, "count", "", "Number of bytes to read (hex, e.g., 10000)")
+	downloadCmd.Flags().StringVar(&downloadOutput, "output", "", "Output file")
+	downloadCmd.Flags().StringVar(&downloadFormat, "format", "bin", "Output format (bin, ihex, srec)")
+	downloadCmd.MarkFlagRequired("address")
+	downloadCmd.MarkFlagRequired("count")
+	downloadCmd.MarkFlagRequired("output")
+}
+
+// downloadMemory reads a memory range and writes it to the output file
+func downloadMemory() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	addr, err := resolveAddress(downloadAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	count, err := util.ParseHexCount(downloadCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+
+	format := strings.ToLower(downloadFormat)
+	if format != "bin" && format != "ihex" && format != "srec" {
+		return fmt.Errorf("invalid format '%s' (must be bin, ihex or srec)", downloadFormat)
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	// Read memory
+	printInfo("Reading %d bytes from 0x%X...\n", count, addr)
+	data, err := dp.ReadRange(addr, count)
+	if err != nil {
+		return fmt.Errorf("failed to read memory: %w", err)
+	}
+
+	// Write output file
+	f, err := os.Create(downloadOutput)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	switch format {
+	case "ihex":
+		err = loader.WriteIntelHex(w, addr, data)
+	case "srec":
+		err = loader.WriteSRec(w, addr, data)
+	default:
+		_, err = w.Write(data)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", downloadOutput, err)
+	}
+
+	printInfo("Saved %d bytes to %s.\n", len(data), downloadOutput)
+	return nil
+}
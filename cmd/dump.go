@@ -3,8 +3,7 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
-	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/config"
 	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -12,6 +11,7 @@ import (
 var (
 	dumpAddress string
 	dumpCount   string
+	dumpRegion  string
 )
 
 var dumpCmd = &cobra.Command{
@@ -19,8 +19,17 @@ var dumpCmd = &cobra.Command{
 	Short: "Read and display memory from specified address",
 	Long: `Read a block of memory from the Foenix hardware and display it in hex dump format.
 
+Memory is read in chunks of the configured chunk size, so the count may be
+larger than a single transfer. When a label file is configured, each line
+ends with the nearest label at or before its address, e.g. <buffer+0x10>.
+
+The address may also name a memory region of the target machine (see 'map'),
+and --region dumps a whole region, or --count bytes of it.
+
 Example:
-  foenixmgr dump --address 380000 --count 100`,
+  foenixmgr dump --address 380000 --count 100
+  foenixmgr --target f256k dump --address io.vicky.border
+  foenixmgr --target f256k dump --region video.text --count 50`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate flags
 		if err := validateConnectionFlags(); err != nil {
@@ -37,43 +46,53 @@ Example:
 		}
 
 		// Parse address and count
-		addr, err := util.ParseHexAddress(dumpAddress)
+		var region config.Region
+		var addr uint32
+		var err error
+		if dumpRegion != "" {
+			region, err = cfg.MachineRegion(dumpRegion)
+			addr = region.Address
+		} else {
+			addr, err = resolveAddress(dumpAddress)
+		}
 		if err != nil {
 			return fmt.Errorf("invalid address: %w", err)
 		}
 
-		count, err := util.ParseHexSize(dumpCount)
+		count, err := util.ParseHexCount(dumpCount)
 		if err != nil {
 			return fmt.Errorf("invalid count: %w", err)
 		}
+		if region.Size > 0 && !cmd.Flags().Changed("count") {
+			count = region.Size
+		}
 
-		// Create connection
-		conn := connection.NewConnection(cfg.Port)
-		if err := conn.Open(cfg.Port); err != nil {
-			return fmt.Errorf("failed to open connection: %w", err)
+		labels, err := loadLabels()
+		if err != nil {
+			return err
 		}
-		defer conn.Close()
-
-		// Create protocol handler
-		dp := protocol.NewDebugPort(conn, cfg)
-
-		// Enter debug mode
-		isStopped := util.IsStopped()
-		if !isStopped {
-			if err := dp.EnterDebug(); err != nil {
-				return fmt.Errorf("failed to enter debug mode: %w", err)
-			}
-			defer dp.ExitDebug()
+
+		// Open the shared connection and enter debug mode
+		dp, err := enterDebug()
+		if err != nil {
+			return err
 		}
 
 		// Read memory
-		data, err := dp.ReadBlock(addr, count)
+		data, err := dp.ReadRange(addr, count)
 		if err != nil {
 			return fmt.Errorf("failed to read memory: %w", err)
 		}
 
 		// Display hex dump
-		util.HexDump(data, addr)
+		if jsonFlag {
+			return printJSON(newMemoryJSON(addr, data))
+		}
+		if labels != nil {
+			util.HexDumpSymbols(data, addr, labels.ReverseLookup)
+		} else {
+			util.HexDump(data, addr)
+		}
 
 		return nil
 	},
@@ -84,4 +103,6 @@ func init() {
 
 	dumpCmd.Flags().StringVar(&dumpAddress, "address", "", "Starting address (hex, e.g., 380000)")
 	dumpCmd.Flags().StringVar(&dumpCount, "count", "10", "Number of bytes to read (hex, e.g., 100)")
+	dumpCmd.Flags().StringVar(&dumpRegion, "region", "", "Dump a memory region of the target machine (see 'map')")
+	dumpCmd.MarkFlagsMutuallyExclusive("address", "region")
 }
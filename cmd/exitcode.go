@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// Exit codes, so Makefiles and CI scripts can tell what kind of failure
+// happened
+const (
+	ExitOK         = 0
+	ExitError      = 1 // Any other failure, e.g. invalid arguments
+	ExitConnection = 3 // The port couldn't be opened or the machine didn't answer
+	ExitProtocol   = 4 // A bad response from the debug port, e.g. an LRC error
+	ExitFormat     = 5 // The file isn't valid in its format
+	ExitCancelled  = 6 // Declined at a prompt or interrupted with Ctrl+C
+	ExitVerify     = 7 // Memory or flash didn't read back as written
+	ExitBusy       = 8 // The port, bridge or session is in use by another process or client
+
+	// Quit at once by a second Ctrl+C, as for a process killed by SIGINT
+	exitInterrupted = 130
+)
+
+// errCancelled is returned when the user declines a confirmation prompt
+var errCancelled = errors.New("operation cancelled")
+
+// ExitCode returns the exit code for an error returned by Execute
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errCancelled), errors.Is(err, context.Canceled):
+		return ExitCancelled
+	case errors.Is(err, protocol.ErrVerify):
+		return ExitVerify
+	case errors.Is(err, loader.ErrFormat):
+		return ExitFormat
+	case errors.Is(err, connection.ErrBusy):
+		return ExitBusy
+	case errors.Is(err, protocol.ErrProtocol):
+		return ExitProtocol
+	case errors.Is(err, protocol.ErrConnection):
+		return ExitConnection
+	}
+	return ExitError
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fillAddress string
+	fillCount   string
+	fillValue   string
+)
+
+// fillCmd represents the memory fill command
+var fillCmd = &cobra.Command{
+	Use:   "fill",
+	Short: "Fill a memory range with a byte or pattern",
+	Long: `Fill a range of memory on the Foenix hardware with a repeated byte, or a
+repeating multi-byte pattern.
+
+Useful for clearing screen RAM or zeroing buffers before uploads.
+
+Example:
+  foenixmgr fill --address 10000 --count 8000 --value 00
+  foenixmgr fill --address 10000 --count 100 --value "DE AD BE EF"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fillCommand()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fillCmd)
+
+	fillCmd.Flags().StringVar(&fillAddress, "address", "", "Starting address (hex or label)")
+	fillCmd.Flags().StringVar(&fillCount, "count", "", "Number of bytes to fill (hex, e.g., 8000)")
+	fillCmd.Flags().StringVar(&fillValue, "value", "00", "Byte or byte pattern to fill with (hex)")
+	fillCmd.MarkFlagRequired("address")
+	fillCmd.MarkFlagRequired("count")
+}
+
+// fillCommand parses the fill flags and fills the memory range
+func fillCommand() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	addr, err := resolveAddress(fillAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	count, err := util.ParseHexCount(fillCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+
+	pattern, err := util.ParseHexBytes(fillValue)
+	if err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Filling %d bytes at 0x%X with %s...\n", count, addr, util.FormatHex(pattern))
+	if err := fillMemory(dp, addr, count, pattern); err != nil {
+		return err
+	}
+
+	printInfo("Fill complete.\n")
+	return nil
+}
+
+// fillMemory fills count bytes starting at address with a repeating pattern,
+// writing in chunks of the configured chunk size
+func fillMemory(dp *protocol.DebugPort, address uint32, count uint32, pattern []byte) error {
+	if len(pattern) == 0 {
+		return fmt.Errorf("fill pattern is empty")
+	}
+
+	chunkSize := uint32(cfg.ChunkSize)
+	chunk := make([]byte, chunkSize)
+	for i := range chunk {
+		chunk[i] = pattern[i%len(pattern)]
+	}
+
+	for offset := uint32(0); offset < count; {
+		size := chunkSize
+		if count-offset < size {
+			size = count - offset
+		}
+
+		// Keep the pattern phase continuous across chunk boundaries
+		phase := int(offset) % len(pattern)
+		block := chunk[:size]
+		if phase != 0 {
+			block = make([]byte, size)
+			for i := range block {
+				block[i] = pattern[(phase+i)%len(pattern)]
+			}
+		}
+
+		if err := dp.WriteBlock(address+offset, block); err != nil {
+			return fmt.Errorf("failed to fill memory at 0x%X: %w", address+offset, err)
+		}
+		offset += size
+	}
+
+	return nil
+}
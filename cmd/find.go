@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	findAddress string
+	findCount   string
+	findPattern string
+	findText    string
+)
+
+// findCmd represents the memory search command
+var findCmd = &cobra.Command{
+	Use:   "find",
+	Short: "Search memory for a byte pattern or text",
+	Long: `Scan a range of memory on the Foenix hardware for a byte pattern or a text
+string and list the address of every match.
+
+Memory is read in chunks of the configured chunk size; matches that span two
+chunks are found too. When a label file is configured, each match is shown
+with the nearest label at or before it.
+
+Example:
+  foenixmgr find --address 0 --count 10000 --pattern "DE AD"
+  foenixmgr find --address 380000 --count 80000 --text "READY"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return findCommand()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(findCmd)
+
+	findCmd.Flags().StringVar(&findAddress, "address", "", "Starting address (hex or label)")
+	findCmd.Flags().StringVar(&findCount, "count", "", "Number of bytes to search (hex, e.g., 10000)")
+	findCmd.Flags().StringVar(&findPattern, "pattern", "", "Byte pattern to search for (hex, e.g., \"DE AD\")")
+	findCmd.Flags().StringVar(&findText, "text", "", "Text to search for")
+	findCmd.MarkFlagRequired("address")
+	findCmd.MarkFlagRequired("count")
+	findCmd.MarkFlagsMutuallyExclusive("pattern", "text")
+	findCmd.MarkFlagsOneRequired("pattern", "text")
+}
+
+// findCommand parses the find flags and searches the memory range
+func findCommand() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	addr, err := resolveAddress(findAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	count, err := util.ParseHexCount(findCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+
+	needle := []byte(findText)
+	if findPattern != "" {
+		if needle, err = util.ParseHexBytes(findPattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if len(needle) == 0 {
+		return fmt.Errorf("search pattern is empty")
+	}
+
+	labels, err := loadLabels()
+	if err != nil {
+		return err
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Searching %d bytes at 0x%X for %s...\n", count, addr, util.FormatHex(needle))
+
+	// Keep the last len(needle)-1 bytes of each chunk so matches that cross a
+	// chunk boundary are found
+	var window []byte
+	windowStart := addr
+	matches := []uint32{}
+
+	for offset := uint32(0); offset < count; {
+		size := uint32(cfg.ChunkSize)
+		if count-offset < size {
+			size = count - offset
+		}
+
+		chunk, err := dp.ReadBlock(addr+offset, uint16(size))
+		if err != nil {
+			return fmt.Errorf("failed to read memory at 0x%X: %w", addr+offset, err)
+		}
+		window = append(window, chunk...)
+		offset += size
+
+		for i := 0; ; i++ {
+			n := bytes.Index(window[i:], needle)
+			if n < 0 {
+				break
+			}
+			i += n
+			if !jsonFlag {
+				fmt.Printf("0x%06X%s\n", windowStart+uint32(i), symbolSuffix(labels, windowStart+uint32(i)))
+			}
+			matches = append(matches, windowStart+uint32(i))
+		}
+
+		if keep := len(needle) - 1; len(window) > keep {
+			windowStart += uint32(len(window) - keep)
+			window = append([]byte(nil), window[len(window)-keep:]...)
+		}
+	}
+
+	if jsonFlag {
+		return printJSON(struct {
+			Pattern string   `json:"pattern"` // Hex encoded
+			Matches []uint32 `json:"matches"`
+		}{hexData(needle), matches})
+	}
+
+	printInfo("%d matches found.\n", len(matches))
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	flashBackupOutput  string
+	flashBackupSectors string
+	flashBackupFile    string // --backup of erase and the flash commands
+)
+
+// flashBackupCmd represents the flash-backup command
+var flashBackupCmd = &cobra.Command{
+	Use:   "flash-backup",
+	Short: "Save the contents of flash memory to a file",
+	Long: `Read the flash memory and save it to a binary file, so it can be restored
+with 'flash' after a destructive operation. The whole flash (flash_size bytes at
+flash_address) is read unless --sectors selects 8KB sectors, which are saved
+one after the other.
+
+erase, erase-sector, flash, flash-bulk and flash-update can take a backup
+automatically with --backup FILE.
+
+Example:
+  foenixmgr flash-backup --output backup.bin
+  foenixmgr flash-backup --output kernel.bin --sectors 38-3F`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runFlashBackup()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(flashBackupCmd)
+
+	flashBackupCmd.Flags().StringVar(&flashBackupOutput, "output", "", "Output file")
+	flashBackupCmd.Flags().StringVar(&flashBackupSectors, "sectors", "", "8KB sectors to save (hex list or ranges, e.g., 00-07,10)")
+	flashBackupCmd.MarkFlagRequired("output")
+
+	for _, c := range []*cobra.Command{eraseCmd, eraseSectorCmd, flashCmd, flashBulkCmd} {
+		c.Flags().StringVar(&flashBackupFile, "backup", "", "Save the current flash contents to this file first")
+	}
+}
+
+// runFlashBackup saves the flash, or a range of its sectors, to the output file
+func runFlashBackup() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	var sectors []uint8
+	if flashBackupSectors != "" {
+		var err error
+		if sectors, err = parseSectorList(flashBackupSectors); err != nil {
+			return err
+		}
+		for _, sector := range sectors {
+			if (int(sector)+1)*flashSectorBytes > cfg.FlashSize {
+				return fmt.Errorf("sector 0x%02X is beyond the end of the %d byte flash", sector, cfg.FlashSize)
+			}
+		}
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	if sectors == nil {
+		return backupFlash(dp, flashBackupOutput, 0, uint32(cfg.FlashSize))
+	}
+	return backupFlashSectors(dp, flashBackupOutput, sectors)
+}
+
+// backupFlash reads length bytes of flash from the given offset into flash
+// and writes them to filename
+func backupFlash(dp *protocol.DebugPort, filename string, offset, length uint32) error {
+	base, err := util.ParseHexAddress(cfg.FlashAddress)
+	if err != nil {
+		return fmt.Errorf("invalid flash_address: %w", err)
+	}
+
+	printInfo("Backing up %d bytes of flash to %s...\n", length, filename)
+	data, err := dp.ReadRange(base+offset, length)
+	if err != nil {
+		return fmt.Errorf("failed to read flash: %w", err)
+	}
+
+	return saveBackup(filename, data)
+}
+
+// backupFlashSectors reads 8KB flash sectors and writes them one after the
+// other to filename
+func backupFlashSectors(dp *protocol.DebugPort, filename string, sectors []uint8) error {
+	base, err := util.ParseHexAddress(cfg.FlashAddress)
+	if err != nil {
+		return fmt.Errorf("invalid flash_address: %w", err)
+	}
+
+	printInfo("Backing up sectors %s to %s...\n", formatSectorList(sectors), filename)
+	var data []byte
+	for _, sector := range sectors {
+		sectorData, err := dp.ReadRange(base+uint32(sector)*flashSectorBytes, flashSectorBytes)
+		if err != nil {
+			return fmt.Errorf("failed to read sector 0x%02X: %w", sector, err)
+		}
+		data = append(data, sectorData...)
+	}
+
+	return saveBackup(filename, data)
+}
+
+// saveBackup writes flash contents to a backup file. A dry run has only read
+// a mock device, so nothing is written.
+func saveBackup(filename string, data []byte) error {
+	if dryRunFlag {
+		printInfo("Dry run: backup not written to %s.\n", filename)
+		return nil
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	printInfo("Flash backup saved.\n")
+	return nil
+}
+
+// backupBeforeFlashing saves the whole flash to the --backup file, if one was
+// given
+func backupBeforeFlashing(dp *protocol.DebugPort) error {
+	if flashBackupFile == "" {
+		return nil
+	}
+	return backupFlash(dp, flashBackupFile, 0, uint32(cfg.FlashSize))
+}
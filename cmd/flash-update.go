@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// flashUpdateCmd represents the flash-update command
+var flashUpdateCmd = &cobra.Command{
+	Use:   "flash-update <binfile>",
+	Short: "Program only the flash sectors that differ from an image",
+	Long: `Read the current flash, compare it with a flash image 8KB sector by sector,
+and erase and program only the sectors that changed. Updating firmware this way
+takes seconds instead of minutes when little has changed.
+
+The image is compared from the start of flash; it may be shorter than the
+flash, in which case the rest is left alone. Sector programming must be
+supported by the target machine.
+
+⚠️  WARNING: This will overwrite flash memory.
+
+Example:
+  foenixmgr flash-update firmware.bin --target f256k
+  foenixmgr flash-update firmware.bin --verify --backup before.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return flashUpdate(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(flashUpdateCmd)
+
+	flashUpdateCmd.Flags().BoolVar(&flashVerify, "verify", false, "Read back the flash after programming and compare with the file")
+	flashUpdateCmd.Flags().StringVar(&flashBackupFile, "backup", "", "Save the current flash contents to this file first")
+}
+
+// flashUpdate programs the sectors of flash that differ from an image
+func flashUpdate(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if err := checkCapability(protocol.CapSectorProgramming); err != nil {
+		return err
+	}
+
+	data, err := util.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(data) > cfg.FlashSize {
+		return fmt.Errorf("file size (%d bytes) is larger than the flash (%d bytes)", len(data), cfg.FlashSize)
+	}
+
+	base, err := util.ParseHexAddress(cfg.FlashAddress)
+	if err != nil {
+		return fmt.Errorf("invalid flash_address: %w", err)
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	if err := backupBeforeFlashing(dp); err != nil {
+		return err
+	}
+
+	// Compare whole sectors, as that is what gets programmed
+	sectors := (len(data) + flashSectorBytes - 1) / flashSectorBytes
+	printInfo("Reading %d sectors of flash...\n", sectors)
+	current, err := dp.ReadRange(base, uint32(sectors*flashSectorBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read flash: %w", err)
+	}
+
+	var changed []int
+	for sector := 0; sector < sectors; sector++ {
+		if !bytes.Equal(sectorData(current, sector), sectorData(data, sector)) {
+			changed = append(changed, sector)
+		}
+	}
+
+	if len(changed) == 0 {
+		printOutcome("Flash already matches %s, nothing to program.\n", filename)
+		return nil
+	}
+
+	printOutcome("%d of %d sectors differ:", len(changed), sectors)
+	for _, sector := range changed {
+		printInfo(" %02X", sector)
+	}
+	printInfo("\n")
+
+	ok, err := confirm("Are you sure you want to reprogram these flash sectors? (y/n): ")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
+	}
+
+	for _, sector := range changed {
+		printInfo("Updating sector 0x%02X...\n", sector)
+		if err := dp.EraseSector(uint8(sector)); err != nil {
+			return fmt.Errorf("failed to erase sector 0x%02X: %w", sector, err)
+		}
+		if err := dp.WriteRange(0, sectorData(data, sector)); err != nil {
+			return fmt.Errorf("failed to upload sector 0x%02X: %w", sector, err)
+		}
+		if err := dp.ProgramSector(uint8(sector)); err != nil {
+			return fmt.Errorf("failed to program sector 0x%02X: %w", sector, err)
+		}
+	}
+	if err := dp.WaitReady(); err != nil {
+		return fmt.Errorf("failed to program sector: %w", err)
+	}
+
+	if flashVerify {
+		if err := verifyFlash(dp, 0, data); err != nil {
+			return err
+		}
+	}
+
+	printOutcome("Flash update complete: %d sectors written, %d unchanged.\n", len(changed), sectors-len(changed))
+	return nil
+}
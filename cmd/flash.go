@@ -4,9 +4,11 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/config"
 	"github.com/daschewie/foenixmgr/pkg/protocol"
 	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
@@ -16,8 +18,15 @@ var (
 	flashAddress    string
 	flashSector     string
 	flashEraseFirst bool
+	flashVerify     bool
+	flashSkipEmpty  bool
+	flashForce      bool
 )
 
+// flashSectorBytes is the size of the flash sectors programmed from the RAM
+// buffer at address 0
+const flashSectorBytes = 8192
+
 // eraseCmd represents the flash erase command
 var eraseCmd = &cobra.Command{
 	Use:   "erase",
@@ -27,13 +36,33 @@ var eraseCmd = &cobra.Command{
 ⚠️  WARNING: This is a destructive operation that cannot be undone.
 All data in flash will be permanently erased.
 
+Save the current flash contents to a file first with --backup.
+
 Example:
-  foenixmgr erase`,
+  foenixmgr erase
+  foenixmgr erase --backup backup.bin`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return eraseFlash()
 	},
 }
 
+// eraseSectorCmd represents the flash sector erase command
+var eraseSectorCmd = &cobra.Command{
+	Use:   "erase-sector",
+	Short: "Erase flash sectors",
+	Long: `Erase a list of flash sectors, given as hex sector numbers and ranges. Sectors
+are the size of the target machine's flash sectors (8KB on the F256).
+
+⚠️  WARNING: This is a destructive operation that cannot be undone.
+
+Example:
+  foenixmgr erase-sector --flash-sector 01
+  foenixmgr erase-sector --flash-sector 00-0F,20 --backup backup.bin`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return eraseFlashSectors()
+	},
+}
+
 // flashCmd represents the flash programming command
 var flashCmd = &cobra.Command{
 	Use:   "flash <binfile>",
@@ -44,14 +73,29 @@ The binary file must be exactly the size configured in foenixmgr.ini
 (default: 524288 bytes = 512KB).
 
 Data is uploaded to RAM at the specified address, then programmed to flash.
+With a target machine, an address whose data would reach I/O, flash or
+unmapped memory is refused unless --force is given.
 
 ⚠️  WARNING: This will overwrite flash memory.
 
 Example:
   foenixmgr flash firmware.bin --address 380000
 
-Program a specific 8KB sector:
-  foenixmgr flash sector.bin --flash-sector 01 --address 380000`,
+Program a specific sector, or a list of sectors and ranges from consecutive
+parts of the file:
+  foenixmgr flash sector.bin --flash-sector 01 --address 380000
+  foenixmgr flash sectors.bin --flash-sector 00-0F,20 --address 380000
+
+Program firmware straight from a build server, checking its digest first:
+  foenixmgr flash https://ci.example.com/build/firmware.bin --address 380000 --sha256 <digest>
+
+Read the flash back afterwards and compare it with the file:
+  foenixmgr flash firmware.bin --address 380000 --verify
+
+Only upload and program the 8KB sectors that hold data, skipping sectors that
+are entirely $FF (the flash is erased first, so they end up erased). This
+needs a target with sector programming and doesn't use --address:
+  foenixmgr flash firmware.bin --skip-empty --target f256k`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if flashSector != "" {
@@ -73,10 +117,16 @@ CSV Format:
   02,sector02.bin
   ...
 
-Each binary file should be 8KB (8192 bytes) for the sector.
+Lines starting with # are comments and a header row is skipped. Filenames are
+relative to the CSV file's directory. Each binary file should be 8KB (8192
+bytes) for the sector; shorter files are padded with $FF. All files are read
+and checked before the hardware is touched.
 
 Options:
   --erase: Erase entire flash before programming (faster for multiple sectors)
+  --verify: Read back each sector after programming and compare with its file
+  --dry-run: Check the files and show the plan and the debug port operations
+             without programming
 
 ⚠️  WARNING: This will overwrite flash memory.
 
@@ -91,18 +141,24 @@ Example:
 
 func init() {
 	rootCmd.AddCommand(eraseCmd)
+	rootCmd.AddCommand(eraseSectorCmd)
 	rootCmd.AddCommand(flashCmd)
 	rootCmd.AddCommand(flashBulkCmd)
 
 	// Flags for flash command
 	flashCmd.Flags().StringVar(&flashAddress, "address", "", "RAM address for flash data (hex, e.g., 380000)")
-	flashCmd.Flags().StringVar(&flashSector, "flash-sector", "", "Program specific 8KB sector (hex, e.g., 01)")
+	flashCmd.Flags().StringVar(&flashSector, "flash-sector", "", "Program specific sectors (hex list or ranges, e.g., 01 or 00-0F,20)")
+	flashCmd.Flags().BoolVar(&flashVerify, "verify", false, "Read back flash after programming and compare with the file")
+	flashCmd.Flags().BoolVar(&flashSkipEmpty, "skip-empty", false, "Only program the 8KB sectors that aren't entirely $FF")
+	flashCmd.Flags().BoolVar(&flashForce, "force", false, "Stage the data at an --address outside the target machine's RAM")
+	addInputFlags(flashCmd)
 
-	// Mark address as required for full flash
-	flashCmd.MarkFlagRequired("address")
+	eraseSectorCmd.Flags().StringVar(&flashSector, "flash-sector", "", "Sectors to erase (hex list or ranges, e.g., 01 or 00-0F,20)")
+	eraseSectorCmd.MarkFlagRequired("flash-sector")
 
 	// Flags for flash-bulk command
 	flashBulkCmd.Flags().BoolVar(&flashEraseFirst, "erase", false, "Erase entire flash before programming")
+	flashBulkCmd.Flags().BoolVar(&flashVerify, "verify", false, "Read back each sector after programming and compare with its file")
 }
 
 // eraseFlash erases the entire flash memory with user confirmation
@@ -112,28 +168,22 @@ func eraseFlash() error {
 	}
 
 	// Get confirmation
-	if !util.ConfirmDanger("You are about to ERASE the entire flash memory") {
-		printInfo("Operation cancelled.\n")
-		return nil
+	ok, err := confirmDanger("You are about to ERASE the entire flash memory")
+	if err != nil {
+		return err
 	}
-
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	if !ok {
+		return errCancelled
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	if err := backupBeforeFlashing(dp); err != nil {
+		return err
 	}
 
 	// Erase flash
@@ -142,7 +192,65 @@ func eraseFlash() error {
 		return fmt.Errorf("flash erase failed: %w", err)
 	}
 
-	printInfo("Flash memory erased successfully.\n")
+	printOutcome("Flash memory erased successfully.\n")
+	return nil
+}
+
+// eraseFlashSectors erases the sectors selected by --flash-sector
+func eraseFlashSectors() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if err := checkCapability(protocol.CapSectorProgramming); err != nil {
+		return err
+	}
+
+	sectors, err := parseSectorList(flashSector)
+	if err != nil {
+		return err
+	}
+	if err := checkSectors(sectors); err != nil {
+		return err
+	}
+
+	ok, err := confirm(fmt.Sprintf("Are you sure you want to erase flash sectors %s? (y/n): ", formatSectorList(sectors)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	if err := backupBeforeFlashing(dp); err != nil {
+		return err
+	}
+
+	// Sectors are erased one page at a time
+	pagesPerSector := uint32(cfg.FlashSectorSize() / cfg.FlashPageSize())
+	for _, sector := range sectors {
+		printInfo("Erasing sector 0x%02X...\n", sector)
+		for page := uint32(0); page < pagesPerSector; page++ {
+			flashPage, err := sectorPage(sector, page)
+			if err != nil {
+				return err
+			}
+			if err := dp.EraseSector(flashPage); err != nil {
+				return fmt.Errorf("failed to erase sector 0x%02X: %w", sector, err)
+			}
+		}
+	}
+	if err := dp.WaitReady(); err != nil {
+		return fmt.Errorf("failed to erase sector: %w", err)
+	}
+
+	printOutcome("Erased %d sectors.\n", len(sectors))
 	return nil
 }
 
@@ -152,16 +260,27 @@ func flashProgramFull(filename string) error {
 		return err
 	}
 
-	// Parse address
-	addr, err := util.ParseHexAddress(flashAddress)
-	if err != nil {
-		return fmt.Errorf("invalid address: %w", err)
+	// The address is required unless sectors are programmed from the RAM
+	// buffer at 0
+	var addr uint32
+	if flashSkipEmpty {
+		if err := checkCapability(protocol.CapSectorProgramming); err != nil {
+			return fmt.Errorf("--skip-empty: %w", err)
+		}
+	} else {
+		if flashAddress == "" {
+			return fmt.Errorf("required flag \"address\" not set")
+		}
+		var err error
+		if addr, err = resolveAddress(flashAddress); err != nil {
+			return fmt.Errorf("invalid address: %w", err)
+		}
 	}
 
 	// Read and validate binary file
-	data, err := util.ReadFile(filename)
+	data, err := readInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
 
 	// Validate file size (should match configured flash size)
@@ -172,36 +291,44 @@ func flashProgramFull(filename string) error {
 		// We'll allow it but warn the user
 	}
 
-	printInfo("About to upload %d bytes to address 0x%X and program flash\n", len(data), addr)
+	if !flashSkipEmpty {
+		if err := checkWrite(addr, len(data), flashForce, config.MemoryRAM); err != nil {
+			return err
+		}
+	}
+
+	if flashSkipEmpty {
+		printInfo("About to program the sectors of %d bytes that hold data\n", len(data))
+	} else {
+		printInfo("About to upload %d bytes to address 0x%X and program flash\n", len(data), addr)
+	}
 
 	// Get confirmation
-	if !util.Confirm("Are you sure you want to reprogram the flash memory? (y/n): ") {
-		printInfo("Operation cancelled.\n")
-		return nil
+	ok, err := confirm("Are you sure you want to reprogram the flash memory? (y/n): ")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	if err := backupBeforeFlashing(dp); err != nil {
+		return err
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	if flashSkipEmpty {
+		return flashProgramUsedSectors(dp, data)
 	}
 
 	// Upload data to RAM
 	printInfo("Uploading flash image to RAM...\n")
-	if err := uploadChunked(dp, addr, data); err != nil {
+	if err := dp.WriteRange(addr, data); err != nil {
 		return fmt.Errorf("upload failed: %w", err)
 	}
 
@@ -217,77 +344,172 @@ func flashProgramFull(filename string) error {
 		return fmt.Errorf("flash programming failed: %w", err)
 	}
 
-	printInfo("Flash programming complete.\n")
+	if flashVerify {
+		if err := verifyFlash(dp, 0, data); err != nil {
+			return err
+		}
+	}
+
+	printOutcome("Flash programming complete.\n")
 	return nil
 }
 
-// flashProgramSector programs a specific 8KB flash sector
+// flashProgramUsedSectors erases the flash, then uploads and programs only the
+// sectors of data that aren't entirely $FF
+func flashProgramUsedSectors(dp *protocol.DebugPort, data []byte) error {
+	sectors := (len(data) + flashSectorBytes - 1) / flashSectorBytes
+	if sectors > protocol.MaxFlashPage+1 {
+		return fmt.Errorf("image of %d bytes has more than the %d sectors the debug port can address", len(data), protocol.MaxFlashPage+1)
+	}
+
+	var used []int
+	for sector := 0; sector < sectors; sector++ {
+		if !isErased(sectorData(data, sector)) {
+			used = append(used, sector)
+		}
+	}
+	printInfo("%d of %d sectors hold data, skipping %d empty sectors\n", len(used), sectors, sectors-len(used))
+
+	printInfo("Erasing flash memory...\n")
+	if err := dp.EraseFlash(); err != nil {
+		return fmt.Errorf("flash erase failed: %w", err)
+	}
+
+	for _, sector := range used {
+		printInfo("Programming sector 0x%02X...\n", sector)
+		if err := dp.WriteRange(0, sectorData(data, sector)); err != nil {
+			return fmt.Errorf("failed to upload sector 0x%02X: %w", sector, err)
+		}
+		if err := dp.ProgramSector(uint8(sector)); err != nil {
+			return fmt.Errorf("failed to program sector 0x%02X: %w", sector, err)
+		}
+	}
+	if err := dp.WaitReady(); err != nil {
+		return fmt.Errorf("failed to program sector: %w", err)
+	}
+
+	if flashVerify {
+		if err := verifyFlash(dp, 0, data); err != nil {
+			return err
+		}
+	}
+
+	printOutcome("Flash programming complete: %d sectors written, %d skipped.\n", len(used), sectors-len(used))
+	return nil
+}
+
+// sectorData returns one flash sector of an image, padding a short last
+// sector with $FF
+func sectorData(data []byte, sector int) []byte {
+	start := sector * flashSectorBytes
+	end := start + flashSectorBytes
+	if end <= len(data) {
+		return data[start:end]
+	}
+	padded := make([]byte, flashSectorBytes)
+	for i := range padded {
+		padded[i] = 0xFF
+	}
+	copy(padded, data[start:])
+	return padded
+}
+
+// isErased returns true if data is entirely $FF, as erased flash reads
+func isErased(data []byte) bool {
+	for _, b := range data {
+		if b != 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+// flashProgramSector programs the flash sectors selected by --flash-sector
+// from consecutive parts of a file
 func flashProgramSector(filename string) error {
 	if err := validateConnectionFlags(); err != nil {
 		return err
 	}
 
 	// Check if target machine supports sector programming
-	if cfg.FlashPageSize() == 0 || cfg.FlashSectorSize() == 0 {
-		return fmt.Errorf("target machine does not support flash sector programming\nUse --target option to specify machine (f256jr, f256k, fnx1591)")
+	if err := checkCapability(protocol.CapSectorProgramming); err != nil {
+		return err
 	}
 
-	// Parse sector number
-	sectorNum, err := strconv.ParseUint(flashSector, 16, 8)
+	// Parse sector numbers
+	sectors, err := parseSectorList(flashSector)
 	if err != nil {
-		return fmt.Errorf("invalid sector number: %w", err)
+		return err
+	}
+	if err := checkSectors(sectors); err != nil {
+		return err
 	}
 
 	// Read and validate binary file
-	data, err := util.ReadFile(filename)
+	data, err := readInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
 
-	// Validate file size (should be sector size in KB * 1024)
-	expectedSize := cfg.FlashSectorSize() * 1024
+	// Validate file size (should be sector size in KB * 1024 for each sector)
+	sectorSize := cfg.FlashSectorSize() * 1024
+	expectedSize := sectorSize * len(sectors)
 	if len(data) != expectedSize {
-		return fmt.Errorf("file size (%d bytes) does not match sector size (%d bytes)",
-			len(data), expectedSize)
+		return fmt.Errorf("file size (%d bytes) does not match %d sectors of %d bytes (%d bytes)",
+			len(data), len(sectors), sectorSize, expectedSize)
 	}
 
-	printInfo("About to upload image to sector 0x%02X\n", sectorNum)
+	printInfo("About to upload image to sectors %s\n", formatSectorList(sectors))
 
 	// Get confirmation
-	if !util.Confirm("Are you sure you want to reprogram the flash sector? (y/n): ") {
-		printInfo("Operation cancelled.\n")
-		return nil
+	ok, err := confirm("Are you sure you want to reprogram the flash sectors? (y/n): ")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	if err := backupBeforeFlashing(dp); err != nil {
+		return err
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
+	for i, sector := range sectors {
+		sectorData := data[i*sectorSize : (i+1)*sectorSize]
+		printInfo("Programming sector 0x%02X...\n", sector)
+		if err := programFlashSector(dp, sector, sectorData); err != nil {
+			return err
+		}
+
+		if flashVerify {
+			if err := verifyFlash(dp, uint32(sector)*uint32(sectorSize), sectorData); err != nil {
+				return err
+			}
 		}
-		defer dp.ExitDebug()
 	}
 
-	// Calculate page information
-	pageSize := cfg.FlashPageSize()
-	sectorSize := cfg.FlashSectorSize()
-	pagesPerSector := sectorSize / pageSize
-	startPage := uint8(sectorNum) * uint8(pagesPerSector)
+	// Wait for the last page to finish programming
+	if err := dp.WaitReady(); err != nil {
+		return fmt.Errorf("failed to program sector: %w", err)
+	}
+
+	printOutcome("Flash sector programming complete.\n")
+	return nil
+}
 
+// programFlashSector erases and programs one sector of the target machine,
+// one page at a time through the RAM buffer at address 0
+func programFlashSector(dp *protocol.DebugPort, sectorNum uint8, data []byte) error {
 	// Upload and program sector in pages
 	ramAddress := uint32(0)
 	written := 0
-	currentPage := startPage
+	page := uint32(0)
 
 	for written < len(data) {
 		// Calculate how much to write in this chunk
@@ -307,93 +529,125 @@ func flashProgramSector(filename string) error {
 
 		// If we've filled the RAM buffer, program the flash page
 		if ramAddress >= uint32(cfg.RAMSize()*1024) {
-			printInfo("Erasing flash page %d...\n", currentPage)
-			if err := dp.EraseSector(currentPage); err != nil {
-				return fmt.Errorf("failed to erase sector: %w", err)
-			}
-
-			printInfo("Programming flash page %d...\n", currentPage)
-			if err := dp.ProgramSector(currentPage); err != nil {
-				return fmt.Errorf("failed to program sector: %w", err)
+			if err := programFlashPage(dp, sectorNum, page); err != nil {
+				return err
 			}
-
-			currentPage++
+			page++
 			ramAddress = 0
 		}
 	}
 
 	// Program any remaining data
 	if ramAddress > 0 {
-		printInfo("Erasing flash page %d...\n", currentPage)
-		if err := dp.EraseSector(currentPage); err != nil {
-			return fmt.Errorf("failed to erase sector: %w", err)
-		}
+		return programFlashPage(dp, sectorNum, page)
+	}
 
-		printInfo("Programming flash page %d...\n", currentPage)
-		if err := dp.ProgramSector(currentPage); err != nil {
-			return fmt.Errorf("failed to program sector: %w", err)
-		}
+	return nil
+}
+
+// programFlashPage erases and programs a page of a sector from the RAM buffer
+func programFlashPage(dp *protocol.DebugPort, sector uint8, page uint32) error {
+	flashPage, err := sectorPage(sector, page)
+	if err != nil {
+		return err
+	}
+
+	printInfo("Erasing flash page %d...\n", flashPage)
+	if err := dp.EraseSector(flashPage); err != nil {
+		return fmt.Errorf("failed to erase sector: %w", err)
 	}
 
-	printInfo("Flash sector programming complete.\n")
+	printInfo("Programming flash page %d...\n", flashPage)
+	if err := dp.ProgramSector(flashPage); err != nil {
+		return fmt.Errorf("failed to program sector: %w", err)
+	}
 	return nil
 }
 
+// sectorPage returns the flash page holding page of a sector of the target
+// machine's flash_sector_size. The page is worked out in 32 bits and checked,
+// so sectors of several pages can't wrap around to page 0.
+func sectorPage(sector uint8, page uint32) (uint8, error) {
+	pagesPerSector := uint32(cfg.FlashSectorSize() / cfg.FlashPageSize())
+	if page >= pagesPerSector {
+		return 0, fmt.Errorf("page %d is beyond the %d pages of sector 0x%02X", page, pagesPerSector, sector)
+	}
+	flashPage := uint32(sector)*pagesPerSector + page
+	if flashPage > protocol.MaxFlashPage {
+		return 0, fmt.Errorf("sector 0x%02X is beyond the flash pages the debug port can address (0x00-0x%02X)", sector, protocol.MaxFlashPage)
+	}
+	return uint8(flashPage), nil
+}
+
+// checkSectors returns an error if a sector of the target machine's
+// flash_sector_size lies beyond its flash_size
+func checkSectors(sectors []uint8) error {
+	sectorSize := cfg.FlashSectorSize() * 1024
+	if sectorSize == 0 {
+		return fmt.Errorf("the target machine has no flash sector size")
+	}
+	count := cfg.FlashSize / sectorSize
+	if count == 0 {
+		return fmt.Errorf("flash_size (%d bytes) is smaller than a %d KB sector", cfg.FlashSize, cfg.FlashSectorSize())
+	}
+	for _, sector := range sectors {
+		if int(sector) >= count {
+			return fmt.Errorf("sector 0x%02X is beyond the flash: %d bytes (flash_size) hold sectors 00-%02X of %d KB", sector, cfg.FlashSize, count-1, cfg.FlashSectorSize())
+		}
+	}
+	return nil
+}
+
+// bulkSector is one sector of a flash-bulk plan
+type bulkSector struct {
+	sector   uint8
+	filename string
+	data     []byte // Contents of the file, padded to a full sector
+	size     int    // Size of the file
+}
+
 // flashBulkProgram programs multiple sectors from a CSV mapping file
 func flashBulkProgram(csvFile string) error {
 	if err := validateConnectionFlags(); err != nil {
 		return err
 	}
 
-	// Open and parse CSV file
-	f, err := os.Open(csvFile)
-	if err != nil {
-		return fmt.Errorf("failed to open CSV file: %w", err)
-	}
-	defer f.Close()
-
-	reader := csv.NewReader(f)
-	records, err := reader.ReadAll()
+	// Read the plan and every file before touching the hardware
+	plan, err := readBulkPlan(csvFile)
 	if err != nil {
-		return fmt.Errorf("failed to read CSV file: %w", err)
-	}
-
-	if len(records) == 0 {
-		return fmt.Errorf("CSV file is empty")
+		return err
 	}
 
 	// Display what will be programmed
 	printInfo("Flash bulk programming plan:\n")
-	for _, record := range records {
-		if len(record) < 2 {
-			return fmt.Errorf("invalid CSV format: expected sector,filename")
+	if flashEraseFirst {
+		printInfo("  Erase entire flash\n")
+	}
+	for _, entry := range plan {
+		padding := ""
+		if entry.size < flashSectorBytes {
+			padding = fmt.Sprintf(", padded with $FF to %d bytes", flashSectorBytes)
 		}
-		printInfo("  Sector 0x%s: %s\n", record[0], record[1])
+		printInfo("  Sector 0x%02X: %s (%d bytes%s)\n", entry.sector, entry.filename, entry.size, padding)
 	}
 
 	// Get confirmation
-	if !util.Confirm("\nProceed with flash bulk programming? (y/n): ") {
-		printInfo("Operation cancelled.\n")
-		return nil
+	ok, err := confirm("\nProceed with flash bulk programming? (y/n): ")
+	if err != nil {
+		return err
 	}
-
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	if !ok {
+		return errCancelled
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	if err := backupBeforeFlashing(dp); err != nil {
+		return err
 	}
 
 	// Erase entire flash if requested
@@ -402,31 +656,17 @@ func flashBulkProgram(csvFile string) error {
 		if err := dp.EraseFlash(); err != nil {
 			return fmt.Errorf("flash erase failed: %w", err)
 		}
-		printInfo("Flash erased.\n")
+		printOutcome("Flash erased.\n")
 	}
 
 	// Program each sector
-	for _, record := range records {
-		sectorID := record[0]
-		sectorFile := record[1]
-
-		sectorNum, err := strconv.ParseUint(sectorID, 16, 8)
-		if err != nil {
-			return fmt.Errorf("invalid sector number '%s': %w", sectorID, err)
-		}
-
-		printInfo("\nProgramming sector 0x%02X from %s...\n", sectorNum, sectorFile)
-
-		// Read sector data
-		data, err := util.ReadFile(sectorFile)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", sectorFile, err)
-		}
+	for _, entry := range plan {
+		printInfo("\nProgramming sector 0x%02X from %s...\n", entry.sector, entry.filename)
 
 		// Upload to RAM at address 0
 		ramAddress := uint32(0)
-		if err := uploadChunked(dp, ramAddress, data); err != nil {
-			return fmt.Errorf("failed to upload %s: %w", sectorFile, err)
+		if err := dp.WriteRange(ramAddress, entry.data); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", entry.filename, err)
 		}
 
 		printInfo("Binary uploaded to RAM.\n")
@@ -434,43 +674,189 @@ func flashBulkProgram(csvFile string) error {
 		// Erase sector (if not pre-erased)
 		if !flashEraseFirst {
 			printInfo("Erasing flash sector...\n")
-			if err := dp.EraseSector(uint8(sectorNum)); err != nil {
+			if err := dp.EraseSector(entry.sector); err != nil {
 				return fmt.Errorf("failed to erase sector: %w", err)
 			}
 		}
 
 		// Program sector
 		printInfo("Programming flash sector...\n")
-		if err := dp.ProgramSector(uint8(sectorNum)); err != nil {
+		if err := dp.ProgramSector(entry.sector); err != nil {
 			return fmt.Errorf("failed to program sector: %w", err)
 		}
 
-		printInfo("Sector 0x%02X programmed successfully.\n", sectorNum)
+		if flashVerify {
+			if err := verifyFlash(dp, uint32(entry.sector)*flashSectorBytes, entry.data); err != nil {
+				return err
+			}
+		}
+
+		printOutcome("Sector 0x%02X programmed successfully.\n", entry.sector)
+	}
+
+	// Wait for the last sector to finish programming
+	if err := dp.WaitReady(); err != nil {
+		return fmt.Errorf("failed to program sector: %w", err)
 	}
 
-	printInfo("\nFlash bulk programming complete.\n")
+	printInfo("\n")
+	printOutcome("Flash bulk programming complete.\n")
 	return nil
 }
 
-// uploadChunked uploads data in chunks to avoid overwhelming the debug port
-func uploadChunked(dp *protocol.DebugPort, startAddress uint32, data []byte) error {
-	address := startAddress
-	offset := 0
+// readBulkPlan reads a flash-bulk CSV file and the files it lists. Lines
+// starting with # are comments, a first row that doesn't start with a sector
+// number is a header, and relative filenames are relative to the CSV file.
+func readBulkPlan(csvFile string) ([]bulkSector, error) {
+	f, err := os.Open(csvFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
 
-	for offset < len(data) {
-		chunkSize := cfg.ChunkSize
-		if offset+chunkSize > len(data) {
-			chunkSize = len(data) - offset
+	if len(records) > 0 && len(records[0]) > 0 {
+		if _, err := strconv.ParseUint(strings.TrimSpace(records[0][0]), 16, 8); err != nil {
+			records = records[1:]
 		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
 
-		chunk := data[offset : offset+chunkSize]
-		if err := dp.WriteBlock(address, chunk); err != nil {
-			return fmt.Errorf("failed to write chunk at 0x%X: %w", address, err)
+	dir := filepath.Dir(csvFile)
+	seen := make(map[uint8]int)
+	var plan []bulkSector
+	for _, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("invalid CSV format: expected sector,filename")
+		}
+
+		sectorID := strings.TrimSpace(record[0])
+		sectorNum, err := strconv.ParseUint(sectorID, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sector number '%s': %w", sectorID, err)
+		}
+		sector := uint8(sectorNum)
+		if int(sector) >= cfg.FlashSize/flashSectorBytes || sector > protocol.MaxFlashPage {
+			return nil, fmt.Errorf("sector 0x%02X is beyond the %d bytes of flash (flash_size)", sector, cfg.FlashSize)
+		}
+		if previous, ok := seen[sector]; ok {
+			return nil, fmt.Errorf("sector 0x%02X is listed twice (%s and %s)", sector, plan[previous].filename, record[1])
 		}
+		seen[sector] = len(plan)
 
-		address += uint32(chunkSize)
-		offset += chunkSize
+		filename := strings.TrimSpace(record[1])
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(dir, filename)
+		}
+
+		data, err := util.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		if len(data) == 0 || len(data) > flashSectorBytes {
+			return nil, fmt.Errorf("%s is %d bytes, a sector holds 1 to %d bytes", filename, len(data), flashSectorBytes)
+		}
+
+		plan = append(plan, bulkSector{
+			sector:   sector,
+			filename: filename,
+			data:     sectorData(data, 0),
+			size:     len(data),
+		})
+	}
+	return plan, nil
+}
+
+// verifyMemory reads back memory at startAddress and compares it with expected,
+// returning an error that names the first mismatching address
+func verifyMemory(dp *protocol.DebugPort, startAddress uint32, expected []byte) error {
+	actual, err := dp.ReadRange(startAddress, uint32(len(expected)))
+	if err != nil {
+		return fmt.Errorf("verification read failed: %w", err)
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			return fmt.Errorf("%w at 0x%06X: expected %02X, read %02X",
+				protocol.ErrVerify, startAddress+uint32(i), expected[i], actual[i])
+		}
 	}
 
 	return nil
 }
+
+// verifyFlash compares flash contents at the given offset into flash with data
+func verifyFlash(dp *protocol.DebugPort, flashOffset uint32, data []byte) error {
+	base, err := util.ParseHexAddress(cfg.FlashAddress)
+	if err != nil {
+		return fmt.Errorf("invalid flash_address: %w", err)
+	}
+
+	printInfo("Verifying flash...\n")
+	if err := verifyMemory(dp, base+flashOffset, data); err != nil {
+		return err
+	}
+	printOutcome("Flash verified: %d bytes match.\n", len(data))
+	return nil
+}
+
+// parseSectorList parses a comma separated list of hex sector numbers and
+// ranges, e.g. "01" or "00-0F,20". Sectors are returned in the order given;
+// listing a sector twice is an error.
+func parseSectorList(s string) ([]uint8, error) {
+	var sectors []uint8
+	seen := make(map[uint8]bool)
+	for _, item := range strings.Split(s, ",") {
+		firstText, lastText, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		first, err := strconv.ParseUint(strings.TrimSpace(firstText), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sector '%s'", firstText)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.ParseUint(strings.TrimSpace(lastText), 16, 8); err != nil {
+				return nil, fmt.Errorf("invalid sector '%s'", lastText)
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid sector range '%s': end is before start", item)
+		}
+
+		for sector := first; sector <= last; sector++ {
+			if seen[uint8(sector)] {
+				return nil, fmt.Errorf("sector 0x%02X is listed more than once", sector)
+			}
+			seen[uint8(sector)] = true
+			sectors = append(sectors, uint8(sector))
+		}
+	}
+	return sectors, nil
+}
+
+// formatSectorList formats sectors as hex numbers and ranges, e.g. "00-0F,20"
+func formatSectorList(sectors []uint8) string {
+	var parts []string
+	for i := 0; i < len(sectors); i++ {
+		j := i
+		for j+1 < len(sectors) && sectors[j+1] == sectors[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%02X-%02X", sectors[i], sectors[j]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%02X", sectors[i]))
+		}
+		i = j
+	}
+	return strings.Join(parts, ",")
+}
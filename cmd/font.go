@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/daschewie/foenixmgr/pkg/video"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fontAddress string
+	fontFirst   int
+)
+
+// fontCmd represents the font command
+var fontCmd = &cobra.Command{
+	Use:   "font <file>",
+	Short: "Upload a text mode font",
+	Long: `Write an 8x8 font to the font memory of the target machine.
+
+The file is either raw font data, 8 bytes per character with the leftmost
+pixel in bit 7, or an image (PNG, BMP, GIF) of a grid of 8x8 characters read
+left to right, top to bottom, such as 16x16 characters in a 128x128 image.
+Pixels brighter than half intensity are set.
+
+The font is written to the video.font region of the target machine, or to
+--address. --first replaces characters starting at another code than 0, so
+a few characters can be changed without touching the rest.
+
+Example:
+  foenixmgr font myfont.bin --target f256k
+  foenixmgr font sheet.png --target f256k
+  foenixmgr font arrows.png --first 128 --target f256k`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return uploadFont(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fontCmd)
+
+	fontCmd.Flags().StringVar(&fontAddress, "address", "", "Font memory address (hex, default: video.font region)")
+	fontCmd.Flags().IntVar(&fontFirst, "first", 0, "First character code to replace")
+}
+
+// uploadFont converts a font file and writes it to font memory
+func uploadFont(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	data, err := util.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	font := data
+	if img, format, err := image.Decode(bytes.NewReader(data)); err == nil {
+		if font, err = video.FontFromImage(img); err != nil {
+			return err
+		}
+		printInfo("Converted %s font sheet with %d characters.\n", format, len(font)/video.CharHeight)
+	} else if len(data)%video.CharHeight != 0 {
+		return fmt.Errorf("%s is neither an image nor raw font data (%d bytes is not a multiple of %d)", filename, len(data), video.CharHeight)
+	}
+
+	count := len(font) / video.CharHeight
+	if fontFirst < 0 || fontFirst+count > video.FontSize/video.CharHeight {
+		return fmt.Errorf("%d characters from code %d don't fit in a %d-character font", count, fontFirst, video.FontSize/video.CharHeight)
+	}
+
+	address, err := regionAddress(fontAddress, video.RegionFont)
+	if err != nil {
+		return err
+	}
+	address += uint32(fontFirst * video.CharHeight)
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Writing %d characters to 0x%06X...\n", count, address)
+	if err := dp.WriteRange(address, font); err != nil {
+		return fmt.Errorf("failed to write font: %w", err)
+	}
+
+	printInfo("Font uploaded.\n")
+	return nil
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/daschewie/foenixmgr/pkg/gdbserver"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var gdbListen string
+
+// gdbServerCmd represents the GDB remote protocol server command
+var gdbServerCmd = &cobra.Command{
+	Use:   "gdb-server",
+	Short: "Serve the GDB remote protocol over the debug port",
+	Long: `Listen for GDB connections and translate GDB remote protocol requests into
+debug port operations, so a debugger such as m68k-elf-gdb can attach to the
+Foenix hardware.
+
+Supported: reading and writing memory, reading registers, halting (Ctrl+C in
+GDB), continuing and stepping. The CPU is halted when GDB connects and left
+running when GDB detaches or the server is stopped.
+
+Limitations of the debug port:
+  - Halting and continuing use the stop/start commands, so the target must
+    support them (F256 machines). Other machines stay halted in debug mode.
+  - Registers come from the register snapshot that code of your own on the
+    machine writes to register_address (see 'registers --help'), and are
+    read-only.
+  - The CPU can't report reaching a breakpoint. GDB's memory breakpoints are
+    written, but execution only stops when interrupted.
+  - Stepping releases the CPU briefly and may run more than one instruction.
+
+Register layout ('g' packet): D0-D7, A0-A7, SR, PC as 32-bit big-endian
+values for 680x0; the snapshot registers at their own widths, little-endian,
+for 65xx CPUs.
+
+Example:
+  foenixmgr gdb-server --listen :3333 --target f256k
+  m68k-elf-gdb program.elf -ex "target remote localhost:3333"`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGDBServer()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gdbServerCmd)
+
+	gdbServerCmd.Flags().StringVar(&gdbListen, "listen", ":3333", "Address to listen on for GDB connections")
+}
+
+// runGDBServer serves GDB connections until interrupted
+func runGDBServer() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	target := &debugTarget{
+		dp:      dp,
+		canStop: checkCapability(protocol.CapStopCPU) == nil,
+		stopped: util.IsStopped(cfg.Port),
+	}
+	if address, err := registerAddress(); err == nil {
+		target.registers = &address
+	} else {
+		printInfo("Registers unavailable: %v\n", err)
+	}
+
+	listener, err := net.Listen("tcp", gdbListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", gdbListen, err)
+	}
+
+	server := gdbserver.NewServer(target)
+	server.Logf = func(format string, args ...interface{}) {
+		printInfo(format+"\n", args...)
+	}
+
+	interrupted := handleInterrupts()
+	go func() {
+		<-interrupted.Done()
+		server.Close()
+	}()
+
+	printInfo("Waiting for GDB on %s (Ctrl+C to stop)\n", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		return err
+	}
+
+	// Leave the CPU running
+	if !target.canStop {
+		return nil
+	}
+	return target.Continue()
+}
+
+// debugTarget adapts the debug port to the GDB server
+type debugTarget struct {
+	dp        *protocol.DebugPort
+	canStop   bool    // The machine supports the stop/start commands
+	registers *uint32 // Register snapshot address, if known
+	stopped   bool
+}
+
+// ReadMemory reads memory in chunks
+func (t *debugTarget) ReadMemory(address uint32, length int) ([]byte, error) {
+	return t.dp.ReadRange(address, uint32(length))
+}
+
+// WriteMemory writes memory in chunks
+func (t *debugTarget) WriteMemory(address uint32, data []byte) error {
+	return t.dp.WriteRange(address, data)
+}
+
+// Registers reads the register snapshot in GDB's layout
+func (t *debugTarget) Registers() ([]byte, error) {
+	if t.registers == nil {
+		return nil, fmt.Errorf("no register_address set for the target")
+	}
+
+	regs, err := t.dp.ReadRegisters(*t.registers, cfg.CPU)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if !cfg.CPUIsMotorolatype680X0() {
+		for _, r := range regs.Registers {
+			for i := 0; i < r.Width; i++ {
+				data = append(data, byte(r.Value>>(8*i)))
+			}
+		}
+		return data, nil
+	}
+
+	// GDB's m68k order is D0-D7, A0-A7, SR, PC
+	for _, name := range []string{"D0", "D1", "D2", "D3", "D4", "D5", "D6", "D7",
+		"A0", "A1", "A2", "A3", "A4", "A5", "A6", "A7", "SR", "PC"} {
+		r, _ := regs.Get(name)
+		data = binary.BigEndian.AppendUint32(data, r.Value)
+	}
+	return data, nil
+}
+
+// Halt stops the CPU. Without stop/start support the CPU is already held in
+// debug mode.
+func (t *debugTarget) Halt() error {
+	if !t.canStop || t.stopped {
+		return nil
+	}
+	if err := t.dp.StopCPU(); err != nil {
+		return err
+	}
+	t.stopped = true
+	return util.SetStopIndicator(cfg.Port)
+}
+
+// Continue starts the CPU
+func (t *debugTarget) Continue() error {
+	if !t.canStop {
+		return fmt.Errorf("the target can't be continued without stop/start support")
+	}
+	if !t.stopped {
+		return nil
+	}
+	if err := t.dp.StartCPU(); err != nil {
+		return err
+	}
+	t.stopped = false
+	return util.ClearStopIndicator(cfg.Port)
+}
+
+// Step starts the CPU and stops it again
+func (t *debugTarget) Step() error {
+	if !t.canStop {
+		return fmt.Errorf("the target can't be stepped without stop/start support")
+	}
+	if err := t.dp.StartCPU(); err != nil {
+		return err
+	}
+	return t.dp.StopCPU()
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/daschewie/foenixmgr/pkg/video"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imageAddress string
+	imageLUT     string
+	imageWidth   int
+	imageHeight  int
+	imageEnable  bool
+)
+
+// imageCmd represents the image command group
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Transfer images to bitmap memory",
+	Long: `Convert host images for the target machine's 8-bit indexed bitmap and write
+them to video memory.
+
+Example:
+  foenixmgr image put picture.png --target f256k --enable`,
+}
+
+// imagePutCmd represents the image put command
+var imagePutCmd = &cobra.Command{
+	Use:   "put <file>",
+	Short: "Convert an image and write it to bitmap memory",
+	Long: `Convert a PNG, BMP, GIF or JPEG image to an 8-bit indexed bitmap and write
+its colour look-up table and pixels to video memory.
+
+Images with more than 256 colours are reduced to 256 with a median cut
+palette; indexed images that fit keep their palette. The image is placed at
+the top left of a bitmap --width pixels wide, and may not be larger than the
+bitmap.
+
+The pixels go to --address, or the video.bitmap region of the target machine,
+and the palette to --lut, or the video.lut region. --enable also shows the
+bitmap: it sets the graphics and bitmap bits of the video.master register and
+points the bitmap layer at video.bitmap_ctrl to the pixels with LUT 0.
+
+Example:
+  foenixmgr image put picture.png --target f256k --enable
+  foenixmgr image put logo.bmp --address 010000 --lut D000 --port mock:`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return putImage(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(imageCmd)
+	imageCmd.AddCommand(imagePutCmd)
+
+	imagePutCmd.Flags().StringVar(&imageAddress, "address", "", "Bitmap address (hex, default: video.bitmap region)")
+	imagePutCmd.Flags().StringVar(&imageLUT, "lut", "", "Colour look-up table address (hex, default: video.lut region)")
+	imagePutCmd.Flags().IntVar(&imageWidth, "width", 320, "Bitmap width in pixels")
+	imagePutCmd.Flags().IntVar(&imageHeight, "height", 240, "Bitmap height in pixels")
+	imagePutCmd.Flags().BoolVar(&imageEnable, "enable", false, "Show the bitmap layer (needs video.master and video.bitmap_ctrl regions)")
+}
+
+// putImage converts an image file and writes it to bitmap memory
+func putImage(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	data, err := util.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", filename, err)
+	}
+
+	size := img.Bounds().Size()
+	if size.X > imageWidth || size.Y > imageHeight {
+		return fmt.Errorf("%s is %dx%d, larger than the %dx%d bitmap", filename, size.X, size.Y, imageWidth, imageHeight)
+	}
+
+	address, err := regionAddress(imageAddress, video.RegionBitmap)
+	if err != nil {
+		return err
+	}
+	lutAddress, err := regionAddress(imageLUT, video.RegionBitmapLUT)
+	if err != nil {
+		return err
+	}
+	var master, control uint32
+	if imageEnable {
+		if master, err = regionAddress("", video.RegionMasterControl); err != nil {
+			return err
+		}
+		if control, err = regionAddress("", video.RegionBitmapControl); err != nil {
+			return err
+		}
+	}
+
+	indexed := video.Quantize(img, 256)
+	printInfo("Converted %dx%d %s image to %d colours.\n", size.X, size.Y, format, len(indexed.Palette))
+
+	// Unused LUT entries are black
+	lut := make([]byte, video.BitmapLUTSize)
+	copy(lut, video.EncodeLUT(indexed.Palette))
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Writing colour look-up table to 0x%06X...\n", lutAddress)
+	if err := dp.WriteRange(lutAddress, lut); err != nil {
+		return fmt.Errorf("failed to write colour look-up table: %w", err)
+	}
+
+	printInfo("Writing pixels to 0x%06X...\n", address)
+	if size.X == imageWidth {
+		err = dp.WriteRange(address, indexed.Pix)
+	} else {
+		for y := 0; y < size.Y && err == nil; y++ {
+			err = dp.WriteRange(address+uint32(y*imageWidth), indexed.Pix[y*indexed.Stride:][:size.X])
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write pixels: %w", err)
+	}
+
+	if imageEnable {
+		value, err := dp.ReadBlock(master, 1)
+		if err != nil {
+			return fmt.Errorf("failed to read master control register: %w", err)
+		}
+		if err := dp.WriteBlock(control, video.BitmapControl(address, 0)); err != nil {
+			return fmt.Errorf("failed to write bitmap control registers: %w", err)
+		}
+		if err := dp.WriteBlock(master, []byte{value[0] | video.MasterGraphics | video.MasterBitmap}); err != nil {
+			return fmt.Errorf("failed to write master control register: %w", err)
+		}
+		printInfo("Bitmap layer enabled.\n")
+	}
+
+	printInfo("Image written.\n")
+	return nil
+}
+
+// regionAddress returns a hex address flag, or the address of a machine
+// region if the flag wasn't given
+func regionAddress(flag, region string) (uint32, error) {
+	if flag != "" {
+		address, err := resolveAddress(flag)
+		if err != nil {
+			return 0, fmt.Errorf("invalid address: %w", err)
+		}
+		return address, nil
+	}
+	r, err := cfg.MachineRegion(region)
+	if err != nil {
+		return 0, err
+	}
+	return r.Address, nil
+}
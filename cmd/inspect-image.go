@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/spf13/cobra"
+)
+
+// newInspectImageCmd returns the inspect command for an executable format
+func newInspectImageCmd(format, name string) *cobra.Command {
+	return &cobra.Command{
+		Use:   fmt.Sprintf("inspect-%s <file>", format),
+		Short: fmt.Sprintf("List the blocks of a %s file and check them", name),
+		Long: fmt.Sprintf(`List the blocks of a %[1]s file with their addresses and sizes, and the
+start address, without touching the hardware. Use it as a lint step for build
+outputs.
+
+Blocks that overlap each other and a start address outside every block are
+reported as warnings. With a target machine, so are blocks beyond its address
+space or outside the RAM of its memory map, and for PGX files a CPU type that
+doesn't match the configured CPU. The command fails if there are warnings.
+
+Example:
+  foenixmgr inspect-%[2]s program.%[2]s
+  foenixmgr --target f256k inspect-%[2]s program.%[2]s --json`, name, format),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return inspectImage(args[0], format)
+		},
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newInspectImageCmd(loader.FormatPGZ, "PGZ"))
+	rootCmd.AddCommand(newInspectImageCmd(loader.FormatPGX, "PGX"))
+	rootCmd.AddCommand(newInspectImageCmd(loader.FormatWDC, "WDC"))
+}
+
+// inspectImage lists the blocks of an executable and the problems found in it
+func inspectImage(filename, format string) error {
+	img, err := loader.DecodeImage(format, filename)
+	if err != nil {
+		return err
+	}
+	warnings := img.Lint(cfg)
+
+	if jsonFlag {
+		if err := printImageJSON(filename, img, warnings); err != nil {
+			return err
+		}
+		if len(warnings) > 0 {
+			return reportedError{fmt.Errorf("%s: %d warning(s)", filename, len(warnings))}
+		}
+		return nil
+	}
+
+	fmt.Printf("File:    %s (%s, %d-bit addresses)\n", filename, strings.ToUpper(img.Format), img.AddressSize*8)
+	if img.HasStart {
+		fmt.Printf("Start:   %06X\n", img.Start)
+	} else {
+		fmt.Printf("Start:   none\n")
+	}
+	if m := cfg.Machine(); m != nil {
+		fmt.Printf("Target:  %s\n", m.Name)
+	}
+	fmt.Printf("Blocks:  %d (%d bytes)\n\n", len(img.Segments), img.Size())
+
+	fmt.Printf("  %-3s %-8s %-8s %s\n", "#", "ADDRESS", "END", "SIZE")
+	for i, seg := range img.Segments {
+		fmt.Printf("  %-3d %06X   %06X   %d\n", i+1, seg.Address, seg.Address+uint32(len(seg.Data))-1, len(seg.Data))
+	}
+
+	if len(warnings) == 0 {
+		return nil
+	}
+	fmt.Println("\nWarnings:")
+	for _, w := range warnings {
+		fmt.Printf("  %s\n", w)
+	}
+	return fmt.Errorf("%s: %d warning(s)", filename, len(warnings))
+}
+
+// printImageJSON prints the blocks of an executable and its warnings as JSON
+func printImageJSON(filename string, img *loader.Image, warnings []string) error {
+	type blockJSON struct {
+		Address uint32 `json:"address"`
+		Size    int    `json:"size"`
+	}
+	blocks := make([]blockJSON, len(img.Segments))
+	for i, seg := range img.Segments {
+		blocks[i] = blockJSON{seg.Address, len(seg.Data)}
+	}
+
+	var start *uint32
+	if img.HasStart {
+		start = &img.Start
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+	return printJSON(struct {
+		File     string      `json:"file"`
+		Format   string      `json:"format"`
+		Start    *uint32     `json:"start"`
+		Blocks   []blockJSON `json:"blocks"`
+		Warnings []string    `json:"warnings"`
+	}{filename, img.Format, start, blocks, warnings})
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/inspect"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inspectType    string
+	inspectStructs string
+	inspectDepth   int
+)
+
+// inspectCmd represents the inspect command
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <address>",
+	Short: "Read and format a typed value at a label",
+	Long: `Read memory at a label or address expression and format it as a typed
+value, following pointers to what they point to.
+
+Types:
+  u8 i8 u16le u16be i16le i16be u24le u32le u32be i32le i32be
+  ptr16 ptr24 ptr32 ptr32be   a pointer, shown as an address
+  ptr24:TYPE                  a pointer followed to a value of TYPE, e.g.
+                              ptr24:cstring or ptr24:ptr24:u16le
+  cstring                     a NUL terminated string (up to 256 bytes)
+  TYPE[N]                     an array; u8[N] is also shown as text
+  struct:NAME                 a struct from the --structs file
+
+The structs file declares struct layouts, with fields in order and no
+padding; a struct may point to itself, such as a linked list node:
+
+  # game.structs
+  struct player {
+      x     i16le
+      y     i16le
+      name  ptr24:cstring
+      next  ptr24:struct:player
+  }
+
+Pointer chains are followed up to --depth pointers deep.
+
+Example:
+  foenixmgr inspect score --type u16le --label-file game.lbl
+  foenixmgr inspect msg_ptr --type ptr24:cstring --label-file game.lbl
+  foenixmgr inspect players --type struct:player[4] --structs game.structs`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return inspectValue(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().StringVar(&inspectType, "type", "u8", "Type of the value (see above)")
+	inspectCmd.Flags().StringVar(&inspectStructs, "structs", "", "File of struct definitions")
+	inspectCmd.Flags().IntVar(&inspectDepth, "depth", 8, "Maximum number of pointers to follow in a chain")
+}
+
+// inspectValue reads and prints a typed value
+func inspectValue(addressText string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	address, err := resolveAddress(addressText)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	var structs inspect.Structs
+	if inspectStructs != "" {
+		f, err := os.Open(inspectStructs)
+		if err != nil {
+			return fmt.Errorf("failed to open structs file: %w", err)
+		}
+		structs, err = inspect.ParseStructs(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", inspectStructs, err)
+		}
+	}
+
+	typ, err := inspect.ParseType(inspectType, structs)
+	if err != nil {
+		return err
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	in := &inspect.Inspector{Read: dp.ReadRange, MaxDepth: inspectDepth}
+	value, err := in.Inspect(typ, address)
+	if err != nil {
+		return fmt.Errorf("failed to read memory: %w", err)
+	}
+	value.Name = addressText
+
+	if jsonFlag {
+		return printJSON(value)
+	}
+	fmt.Print(value)
+	return nil
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// interruptContext is done when the command is interrupted with Ctrl+C. It is
+// set up by Execute.
+var interruptContext = context.Background()
+
+// interruptsHandled is set by commands that stop normally on Ctrl+C. It is
+// read by the signal handler.
+var interruptsHandled atomic.Bool
+
+// handleInterrupts returns a context that is done on Ctrl+C, for commands
+// such as watch that run until interrupted. The shared debug port is then
+// not cancelled by the interrupt, so the command can still clean up.
+func handleInterrupts() context.Context {
+	interruptsHandled.Store(true)
+	if session != nil {
+		session.DebugPort().SetContext(nil)
+	}
+	return interruptContext
+}
+
+// portContext returns the context that cancels transfers on the shared debug
+// port: Ctrl+C stops an upload or flash operation after the transfer in
+// progress, and the session is then closed cleanly.
+func portContext() context.Context {
+	if interruptsHandled.Load() {
+		return nil
+	}
+	return interruptContext
+}
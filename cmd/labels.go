@@ -2,9 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
-	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/cpu"
 	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
 )
@@ -17,11 +17,18 @@ var lookupCmd = &cobra.Command{
 	Short: "Display memory at label's address",
 	Long: `Look up a label in the label file and display memory at that address.
 
-The label file is a 64TASS format file with entries like:
-  LABEL = $ADDRESS
+The label file format is detected from its content:
+  64TASS        LABEL = $ADDRESS
+  VICE          al C:ADDRESS .LABEL (also written by ld65 -Ln)
+  ld65 map      the exports list of a cc65/ld65 map file
+  GNU nm        ADDRESS TYPE LABEL, e.g. from m68k-elf-nm
+
+The label may also be an address expression such as my_buffer+0x20 or
+label1-label2. Numbers in expressions are hex.
 
 Example:
-  foenixmgr lookup my_variable --label-file program.lbl --count 10`,
+  foenixmgr lookup my_variable --label-file program.lbl --count 10
+  foenixmgr lookup my_buffer+0x20 --label-file program.lbl`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return lookupLabel(args[0])
@@ -32,12 +39,14 @@ Example:
 var derefCmd = &cobra.Command{
 	Use:   "deref <label>",
 	Short: "Dereference pointer at label and display target memory",
-	Long: `Look up a label in the label file, read the 24-bit pointer stored there,
-and display memory at the dereferenced address.
+	Long: `Look up a label in the label file, read the pointer stored there, and
+display memory at the dereferenced address.
 
 This is useful for following pointers in assembly code.
 
-The pointer is read as 3 bytes in little-endian format (6502/65816 style).
+The pointer is read in the format of the configured CPU: 2 bytes little-endian
+for the 65C02, 3 bytes little-endian for the 65816, and 4 bytes big-endian for
+the 680x0.
 
 Example:
   foenixmgr deref ptr_variable --label-file program.lbl --count 10`,
@@ -51,11 +60,8 @@ func init() {
 	rootCmd.AddCommand(lookupCmd)
 	rootCmd.AddCommand(derefCmd)
 
-	// Add label-file flag (defaults from config)
-	lookupCmd.Flags().StringVar(&labelFile, "label-file", "", "64TASS label file")
 	lookupCmd.Flags().StringVar(&dumpCount, "count", "10", "Number of bytes to display (hex)")
 
-	derefCmd.Flags().StringVar(&labelFile, "label-file", "", "64TASS label file")
 	derefCmd.Flags().StringVar(&dumpCount, "count", "10", "Number of bytes to display (hex)")
 }
 
@@ -65,30 +71,12 @@ func lookupLabel(label string) error {
 		return err
 	}
 
-	// Determine label file path
-	lblFile := labelFile
-	if lblFile == "" {
-		lblFile = cfg.LabelFile
-	}
-
-	// Load label file
-	labels := util.NewLabelFile()
-	if err := labels.Load(lblFile); err != nil {
-		return fmt.Errorf("failed to load label file: %w", err)
-	}
-
-	// Look up label
-	addressHex, err := labels.Lookup(label)
+	// Look up the label, or evaluate an expression of labels
+	address, err := resolveAddress(label)
 	if err != nil {
 		return err
 	}
 
-	// Parse address
-	address, err := util.ParseHexAddress(addressHex)
-	if err != nil {
-		return fmt.Errorf("invalid address for label '%s': %w", label, err)
-	}
-
 	// Parse count
 	count, err := util.ParseHexSize(dumpCount)
 	if err != nil {
@@ -97,21 +85,10 @@ func lookupLabel(label string) error {
 
 	printInfo("Label '%s' -> Address 0x%X\n", label, address)
 
-	// Create connection and read memory
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
-	}
-	defer conn.Close()
-
-	dp := protocol.NewDebugPort(conn, cfg)
-
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
 
 	// Read memory
@@ -121,6 +98,12 @@ func lookupLabel(label string) error {
 	}
 
 	// Display hex dump
+	if jsonFlag {
+		return printJSON(struct {
+			Label string `json:"label"`
+			memoryJSON
+		}{label, newMemoryJSON(address, data)})
+	}
 	util.HexDump(data, address)
 
 	return nil
@@ -132,65 +115,38 @@ func derefLabel(label string) error {
 		return err
 	}
 
-	// Determine label file path
-	lblFile := labelFile
-	if lblFile == "" {
-		lblFile = cfg.LabelFile
-	}
-
-	// Load label file
-	labels := util.NewLabelFile()
-	if err := labels.Load(lblFile); err != nil {
-		return fmt.Errorf("failed to load label file: %w", err)
-	}
-
-	// Look up label
-	addressHex, err := labels.Lookup(label)
+	// Look up the label, or evaluate an expression of labels
+	address, err := resolveAddress(label)
 	if err != nil {
 		return err
 	}
 
-	// Parse address
-	address, err := util.ParseHexAddress(addressHex)
-	if err != nil {
-		return fmt.Errorf("invalid address for label '%s': %w", label, err)
-	}
-
 	// Parse count
 	count, err := util.ParseHexSize(dumpCount)
 	if err != nil {
 		return fmt.Errorf("invalid count: %w", err)
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	cpuType, err := cfg.CPUType()
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	dp := protocol.NewDebugPort(conn, cfg)
-
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
 
-	// Read 3 bytes at label's address (24-bit pointer, little-endian)
+	// Read the CPU's pointer at label's address
 	printInfo("Label '%s' -> Pointer at 0x%X\n", label, address)
 
-	pointerBytes, err := dp.ReadBlock(address, 3)
+	pointerBytes, err := dp.ReadBlock(address, uint16(cpuType.PointerSize()))
 	if err != nil {
 		return fmt.Errorf("failed to read pointer: %w", err)
 	}
 
-	// Decode 24-bit little-endian pointer
-	targetAddress := uint32(pointerBytes[0]) |
-		uint32(pointerBytes[1])<<8 |
-		uint32(pointerBytes[2])<<16
+	targetAddress := cpu.Pointer(cpuType, pointerBytes)
 
 	printInfo("Pointer value: 0x%06X\n", targetAddress)
 
@@ -201,7 +157,87 @@ func derefLabel(label string) error {
 	}
 
 	// Display hex dump
+	if jsonFlag {
+		return printJSON(struct {
+			Label   string `json:"label"`
+			Pointer uint32 `json:"pointer"`
+			memoryJSON
+		}{label, address, newMemoryJSON(targetAddress, data)})
+	}
 	util.HexDump(data, targetAddress)
 
 	return nil
 }
+
+// resolveAddress converts an address argument to a number. The argument is
+// an address expression of hex numbers and labels, such as my_buffer+0x20 or
+// label1-label2 (see util.EvalAddress). Names of the target machine's memory
+// regions, such as io.vicky.border, stand for their address. Other names are
+// labels, looked up in the label file given by --label-file (or the labels
+// setting in foenixmgr.ini), which is only loaded when a label is used.
+func resolveAddress(s string) (uint32, error) {
+	var labels *util.LabelFile
+	return util.EvalAddress(s, func(name string) (uint32, error) {
+		if m := cfg.Machine(); m != nil {
+			if region, ok := m.Region(name); ok {
+				return region.Address, nil
+			}
+		}
+
+		if labels == nil {
+			lblFile := labelFile
+			if lblFile == "" {
+				lblFile = cfg.LabelFile
+			}
+
+			labels = util.NewLabelFile()
+			if err := labels.Load(lblFile); err != nil {
+				labels = nil
+				return 0, fmt.Errorf("'%s' is not a hex address and the label file could not be loaded: %w", name, err)
+			}
+		}
+
+		addressHex, err := labels.Lookup(name)
+		if err != nil {
+			return 0, err
+		}
+
+		address, err := util.ParseHexAddress(addressHex)
+		if err != nil {
+			return 0, fmt.Errorf("invalid address for label '%s': %w", name, err)
+		}
+		return address, nil
+	})
+}
+
+// loadLabels loads the label file for annotating output. The label file is
+// optional: a missing file from the labels setting (which defaults to
+// "basic8") is ignored and nil is returned, but one given with --label-file
+// must load.
+func loadLabels() (*util.LabelFile, error) {
+	lblFile := labelFile
+	if lblFile == "" {
+		lblFile = cfg.LabelFile
+		if _, err := os.Stat(lblFile); err != nil {
+			return nil, nil
+		}
+	}
+
+	labels := util.NewLabelFile()
+	if err := labels.Load(lblFile); err != nil {
+		return nil, fmt.Errorf("failed to load label file: %w", err)
+	}
+	return labels, nil
+}
+
+// symbolSuffix returns " <label+offset>" for an address, or "" if there are
+// no labels or none precedes it
+func symbolSuffix(labels *util.LabelFile, address uint32) string {
+	if labels == nil {
+		return ""
+	}
+	if name, ok := labels.ReverseLookup(address); ok {
+		return " <" + name + ">"
+	}
+	return ""
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/macro"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var macroForce bool
+
+// unrecordedCommands are the commands left out of macros: those that run
+// other commands, and interactive ones and servers that don't finish
+var unrecordedCommands = map[string]bool{
+	"macro":      true,
+	"script":     true,
+	"monitor":    true,
+	"console":    true,
+	"serve":      true,
+	"gdb-server": true,
+	"dap":        true,
+}
+
+// macroCmd groups the macro commands
+var macroCmd = &cobra.Command{
+	Use:   "macro",
+	Short: "Record and play sequences of commands",
+	Long: `Record the foenixmgr commands you run into a macro, and play it back later
+over one connection.
+
+While a macro is being recorded, every command that talks to the machine and
+succeeds is added to it, with its flags as they were parsed and relative
+paths of existing files made absolute, so the macro plays from any
+directory. Global flags such as --port aren't recorded; give them to
+'macro play' instead.
+
+Macros are kept as batch scripts (see 'script --help') in the foenixmgr
+directory of your config directory, so they can be edited to add variables
+and conditions.
+
+Example:
+  foenixmgr macro record reload
+  foenixmgr binary assets.bin --address 10000
+  foenixmgr run-pgz game.pgz
+  foenixmgr macro stop
+  foenixmgr macro play reload`,
+}
+
+// macroRecordCmd represents the macro record command
+var macroRecordCmd = &cobra.Command{
+	Use:   "record <name>",
+	Short: "Start recording a macro",
+	Long: `Start recording the commands that follow into a macro, until 'macro stop'.
+A recording already in progress is stopped.
+
+Example:
+  foenixmgr macro record reload
+  foenixmgr macro record reload --force`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if previous, ok := macro.Recording(); ok && previous != args[0] {
+			printInfo("Stopped recording macro '%s'\n", previous)
+		}
+		if err := macro.Start(args[0], macroForce); err != nil {
+			return err
+		}
+		printInfo("Recording macro '%s'; run 'foenixmgr macro stop' when done\n", args[0])
+		return nil
+	},
+}
+
+// macroStopCmd represents the macro stop command
+var macroStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop recording a macro",
+	Long: `Stop recording the macro started with 'macro record'.
+
+Example:
+  foenixmgr macro stop`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, commands, err := macro.Stop()
+		if err != nil {
+			return err
+		}
+		if jsonFlag {
+			return printJSON(map[string]interface{}{"name": name, "commands": commands})
+		}
+		printInfo("Recorded %d command(s) in macro '%s'\n", commands, name)
+		return nil
+	},
+}
+
+// macroPlayCmd represents the macro play command
+var macroPlayCmd = &cobra.Command{
+	Use:   "play <name>",
+	Short: "Play a macro",
+	Long: `Run the commands of a macro over a single open connection, like 'script'.
+Global flags given to 'macro play' (such as --port) apply to every command.
+The macro stops at the first command that fails.
+
+Example:
+  foenixmgr macro play reload
+  foenixmgr macro play reload --port 192.168.1.114:2560`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := macro.Path(args[0])
+		if err != nil {
+			return err
+		}
+		if !macro.Exists(args[0]) {
+			return fmt.Errorf("no macro named '%s' (see 'macro list')", args[0])
+		}
+		if name, ok := macro.Recording(); ok && name == args[0] {
+			return fmt.Errorf("macro '%s' is being recorded; run 'macro stop' first", name)
+		}
+		return runScript(path)
+	},
+}
+
+// macroListCmd represents the macro list command
+var macroListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recorded macros",
+	Long: `List the recorded macros with the number of commands in each.
+
+Example:
+  foenixmgr macro list`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, err := macro.List()
+		if err != nil {
+			return err
+		}
+		recording, _ := macro.Recording()
+
+		type macroInfo struct {
+			Name      string `json:"name"`
+			Commands  int    `json:"commands"`
+			Recording bool   `json:"recording"`
+		}
+		macros := []macroInfo{}
+		for _, name := range names {
+			commands, err := macro.Count(name)
+			if err != nil {
+				return err
+			}
+			macros = append(macros, macroInfo{name, commands, name == recording})
+		}
+		if jsonFlag {
+			return printJSON(macros)
+		}
+
+		if len(macros) == 0 {
+			fmt.Println("No macros recorded")
+			return nil
+		}
+		for _, m := range macros {
+			note := ""
+			if m.Recording {
+				note = "  (recording)"
+			}
+			fmt.Printf("%-20s %3d command(s)%s\n", m.Name, m.Commands, note)
+		}
+		return nil
+	},
+}
+
+// macroDeleteCmd represents the macro delete command
+var macroDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a macro",
+	Long: `Delete a macro, stopping its recording if it is being recorded.
+
+Example:
+  foenixmgr macro delete reload`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := macro.Delete(args[0]); err != nil {
+			return err
+		}
+		printInfo("Deleted macro '%s'\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(macroCmd)
+	macroCmd.AddCommand(macroRecordCmd)
+	macroCmd.AddCommand(macroStopCmd)
+	macroCmd.AddCommand(macroPlayCmd)
+	macroCmd.AddCommand(macroListCmd)
+	macroCmd.AddCommand(macroDeleteCmd)
+
+	macroRecordCmd.Flags().BoolVar(&macroForce, "force", false, "Replace a macro of the same name")
+}
+
+// recordMacroCommand adds a command that succeeded to the macro being
+// recorded, if any. Only commands that talked to the machine are recorded.
+func recordMacroCommand(cmd *cobra.Command) error {
+	if session == nil || unrecordedCommands[strings.Fields(cmd.CommandPath())[1]] {
+		return nil
+	}
+	if _, ok := macro.Recording(); !ok {
+		return nil
+	}
+	if err := macro.Append(macroWords(cmd)); err != nil {
+		return fmt.Errorf("failed to record macro: %w", err)
+	}
+	return nil
+}
+
+// macroWords returns a command as it was run, without the program name and
+// global flags
+func macroWords(cmd *cobra.Command) []string {
+	words := strings.Fields(cmd.CommandPath())[1:]
+	cmd.NonInheritedFlags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		name := "--" + f.Name
+		switch value := f.Value.(type) {
+		case pflag.SliceValue:
+			for _, item := range value.GetSlice() {
+				words = append(words, name, absoluteFile(item))
+			}
+		default:
+			if f.Value.Type() == "bool" {
+				if f.Value.String() == "true" {
+					words = append(words, name)
+				} else {
+					words = append(words, name+"=false")
+				}
+				return
+			}
+			words = append(words, name, absoluteFile(f.Value.String()))
+		}
+	})
+	for _, arg := range cmd.Flags().Args() {
+		words = append(words, absoluteFile(arg))
+	}
+	return words
+}
+
+// absoluteFile returns the absolute path of a word that names an existing
+// file relative to the working directory, or the word unchanged
+func absoluteFile(word string) string {
+	if word == "" || filepath.IsAbs(word) {
+		return word
+	}
+	if info, err := os.Stat(word); err != nil || info.IsDir() {
+		return word
+	}
+	if path, err := filepath.Abs(word); err == nil {
+		return path
+	}
+	return word
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// mapCmd represents the memory map listing command
+var mapCmd = &cobra.Command{
+	Use:   "map",
+	Short: "Show the memory map of the target machine",
+	Long: `Show the memory map of the target machine: its RAM, I/O and flash ranges,
+and the named regions that --address and --region accept in place of a hex
+address, e.g. 'dump --region video.text' or 'poke --address io.vicky.border'.
+The hardware isn't contacted.
+
+Ranges are set with memory.ram, memory.io and memory.flash, and regions with
+region.NAME, in the [machine.NAME] section of foenixmgr.ini.
+
+Example:
+  foenixmgr --target f256k map
+  foenixmgr --target f256k map --json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showMemoryMap()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mapCmd)
+}
+
+// showMemoryMap prints the memory ranges and regions of the target machine
+func showMemoryMap() error {
+	m := cfg.Machine()
+	if m == nil {
+		return fmt.Errorf("no target machine selected (use --target)")
+	}
+
+	ranges := append([]config.MemoryRange(nil), m.MemoryMap...)
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+
+	names := make([]string, 0, len(m.Regions))
+	for name := range m.Regions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := m.Regions[names[i]], m.Regions[names[j]]
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return names[i] < names[j]
+	})
+
+	if jsonFlag {
+		return printMemoryMapJSON(m, ranges, names)
+	}
+
+	fmt.Printf("Memory map of %s", m.Name)
+	if m.Description != "" {
+		fmt.Printf(" (%s)", m.Description)
+	}
+	fmt.Printf(":\n\n")
+
+	if len(ranges) == 0 {
+		fmt.Printf("  No memory ranges defined (set memory.ram, memory.io and memory.flash in [machine.%s] of foenixmgr.ini).\n", m.Name)
+	} else {
+		fmt.Printf("  %-8s %-8s %-6s %s\n", "START", "END", "KIND", "SIZE")
+		for _, r := range ranges {
+			fmt.Printf("  %06X   %06X   %-6s %s\n", r.Start, r.End, config.MemoryKindName(r.Kind), formatByteSize(uint64(r.End)-uint64(r.Start)+1))
+		}
+	}
+
+	fmt.Printf("\nRegions:\n")
+	if len(names) == 0 {
+		fmt.Printf("  No regions defined (set region.NAME in [machine.%s] of foenixmgr.ini).\n", m.Name)
+		return nil
+	}
+	fmt.Printf("  %-24s %-8s %-6s %s\n", "NAME", "ADDRESS", "SIZE", "IN")
+	for _, name := range names {
+		r := m.Regions[name]
+		size := "-"
+		if r.Size > 0 {
+			size = formatByteSize(uint64(r.Size))
+		}
+		in := "-"
+		if mr, ok := m.MemoryAt(r.Address); ok {
+			in = config.MemoryKindName(mr.Kind)
+		}
+		fmt.Printf("  %-24s %06X   %-6s %s\n", name, r.Address, size, in)
+	}
+	return nil
+}
+
+// printMemoryMapJSON prints the memory ranges and regions as JSON
+func printMemoryMapJSON(m *config.Machine, ranges []config.MemoryRange, names []string) error {
+	type rangeJSON struct {
+		Kind  string `json:"kind"`
+		Start uint32 `json:"start"`
+		End   uint32 `json:"end"`
+	}
+	type regionJSON struct {
+		Name    string `json:"name"`
+		Address uint32 `json:"address"`
+		Size    uint32 `json:"size,omitempty"`
+	}
+
+	memory := []rangeJSON{}
+	for _, r := range ranges {
+		memory = append(memory, rangeJSON{r.Kind, r.Start, r.End})
+	}
+	regions := []regionJSON{}
+	for _, name := range names {
+		regions = append(regions, regionJSON{name, m.Regions[name].Address, m.Regions[name].Size})
+	}
+	return printJSON(struct {
+		Machine string       `json:"machine"`
+		Memory  []rangeJSON  `json:"memory"`
+		Regions []regionJSON `json:"regions"`
+	}{m.Name, memory, regions})
+}
+
+// formatByteSize formats a size in bytes, in KB or MB when it is a whole
+// number of them
+func formatByteSize(size uint64) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dM", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dK", size>>10)
+	}
+	return fmt.Sprintf("%d", size)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	memcpySource string
+	memcpyDest   string
+	memcpyCount  string
+)
+
+// memcpyCmd represents the device memory copy command
+var memcpyCmd = &cobra.Command{
+	Use:   "memcpy",
+	Short: "Copy a block of memory on the device",
+	Long: `Copy a range of memory on the Foenix hardware to another address, reading
+and writing in chunks of the configured chunk size.
+
+Overlapping ranges are handled: when the destination lies above the source
+the copy runs from the end of the range backwards.
+
+Example:
+  foenixmgr memcpy --src 10000 --dst 20000 --count 4000
+  foenixmgr memcpy --src lut_default --dst D000 --count 400`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return memcpyCommand()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(memcpyCmd)
+
+	memcpyCmd.Flags().StringVar(&memcpySource, "src", "", "Source address (hex or label)")
+	memcpyCmd.Flags().StringVar(&memcpyDest, "dst", "", "Destination address (hex or label)")
+	memcpyCmd.Flags().StringVar(&memcpyCount, "count", "", "Number of bytes to copy (hex, e.g., 400)")
+	memcpyCmd.MarkFlagRequired("src")
+	memcpyCmd.MarkFlagRequired("dst")
+	memcpyCmd.MarkFlagRequired("count")
+}
+
+// memcpyCommand parses the memcpy flags and copies the memory range
+func memcpyCommand() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	src, err := resolveAddress(memcpySource)
+	if err != nil {
+		return fmt.Errorf("invalid source address: %w", err)
+	}
+
+	dst, err := resolveAddress(memcpyDest)
+	if err != nil {
+		return fmt.Errorf("invalid destination address: %w", err)
+	}
+
+	count, err := util.ParseHexCount(memcpyCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+
+	if count == 0 || src == dst {
+		printInfo("Nothing to copy.\n")
+		return nil
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Copying %d bytes from 0x%X to 0x%X...\n", count, src, dst)
+	if err := copyMemory(dp, src, dst, count); err != nil {
+		return err
+	}
+
+	printInfo("Copy complete.\n")
+	return nil
+}
+
+// copyMemory copies count bytes from src to dst on the device, one chunk at a
+// time. Chunks are copied last to first when the destination overlaps the end
+// of the source, so no byte is overwritten before it has been read.
+func copyMemory(dp *protocol.DebugPort, src, dst, count uint32) error {
+	chunkSize := uint32(cfg.ChunkSize)
+	backwards := dst > src && dst < src+count
+
+	for done := uint32(0); done < count; {
+		size := chunkSize
+		if count-done < size {
+			size = count - done
+		}
+
+		offset := done
+		if backwards {
+			offset = count - done - size
+		}
+
+		data, err := dp.ReadBlock(src+offset, uint16(size))
+		if err != nil {
+			return fmt.Errorf("failed to read memory at 0x%X: %w", src+offset, err)
+		}
+
+		if err := dp.WriteBlock(dst+offset, data); err != nil {
+			return fmt.Errorf("failed to write memory at 0x%X: %w", dst+offset, err)
+		}
+		done += size
+	}
+
+	return nil
+}
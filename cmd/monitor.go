@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// monitorCmd represents the interactive memory monitor
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Interactive memory monitor",
+	Long: `Open a persistent connection to the Foenix hardware and start an
+interactive prompt for inspecting and modifying memory.
+
+The connection stays open and the machine stays in debug mode between
+commands, so there is no need to reopen the port for every operation.
+
+Monitor commands (addresses, counts and values are hex):
+  dump <address> [count]         Display memory (default count 10)
+  write <address> <byte> ...     Write bytes to memory
+  poke <address> <byte>          Write a single byte to memory
+  fill <address> <count> <byte>  Fill memory with a byte (or byte pattern)
+  go [address]                   Leave debug mode and run the CPU, optionally
+                                 setting the reset vectors to address first
+  regs                           Show CPU registers from the register snapshot
+                                 (see 'registers --help')
+  status                         Show debug port revision and status bytes
+  help                           Show this list
+  quit                           Leave the monitor
+
+Example:
+  foenixmgr monitor`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMonitor()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+}
+
+// runMonitor opens a session and runs the read-eval-print loop until EOF or quit
+func runMonitor() error {
+	if _, err := openDebugPort(); err != nil {
+		return err
+	}
+	sess := session
+
+	if err := monitorEnsureDebug(sess); err != nil {
+		return err
+	}
+
+	printInfo("FoenixMgr monitor on %s. Type 'help' for commands.\n", cfg.Port)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("foenix> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			break
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "quit" || fields[0] == "exit" {
+			break
+		}
+
+		if err := monitorExecute(sess, fields[0], fields[1:]); err != nil {
+			printError("%v", err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// monitorEnsureDebug enters debug mode unless the session is already in it
+// or the CPU has been stopped with the 'stop' command
+func monitorEnsureDebug(sess *protocol.Session) error {
+	if sess.InDebug() || util.IsStopped(cfg.Port) {
+		return nil
+	}
+	if err := sess.EnterDebug(); err != nil {
+		return fmt.Errorf("failed to enter debug mode: %w", err)
+	}
+	return nil
+}
+
+// monitorExecute runs a single monitor command
+func monitorExecute(sess *protocol.Session, command string, args []string) error {
+	switch command {
+	case "help", "?":
+		fmt.Print(monitorHelp)
+		return nil
+	case "go", "g":
+		return monitorGo(sess, args)
+	}
+
+	if err := monitorEnsureDebug(sess); err != nil {
+		return err
+	}
+	dp := sess.DebugPort()
+
+	switch command {
+	case "dump", "d":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: dump <address> [count]")
+		}
+		addr, err := resolveAddress(args[0])
+		if err != nil {
+			return err
+		}
+		count := uint16(0x10)
+		if len(args) == 2 {
+			if count, err = util.ParseHexSize(args[1]); err != nil {
+				return err
+			}
+		}
+		data, err := dp.ReadBlock(addr, count)
+		if err != nil {
+			return fmt.Errorf("failed to read memory: %w", err)
+		}
+		util.HexDump(data, addr)
+
+	case "write", "w", "poke":
+		if command == "poke" && len(args) != 2 {
+			return fmt.Errorf("usage: poke <address> <byte>")
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("usage: write <address> <byte> ...")
+		}
+		addr, err := resolveAddress(args[0])
+		if err != nil {
+			return err
+		}
+		data, err := util.ParseHexBytes(strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		if command == "poke" && len(data) != 1 {
+			return fmt.Errorf("poke writes a single byte, use write for more")
+		}
+		if err := dp.WriteBlock(addr, data); err != nil {
+			return fmt.Errorf("failed to write memory: %w", err)
+		}
+
+	case "fill", "f":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: fill <address> <count> <byte> ...")
+		}
+		addr, err := resolveAddress(args[0])
+		if err != nil {
+			return err
+		}
+		count, err := util.ParseHexCount(args[1])
+		if err != nil {
+			return err
+		}
+		pattern, err := util.ParseHexBytes(strings.Join(args[2:], " "))
+		if err != nil {
+			return err
+		}
+		if err := fillMemory(dp, addr, count, pattern); err != nil {
+			return err
+		}
+
+	case "regs", "r":
+		// The snapshot is only there if code on the machine writes it
+		address, err := registerAddress()
+		if err != nil {
+			fmt.Printf("Registers unavailable: %v\n", err)
+			return nil
+		}
+		regs, err := dp.ReadRegisters(address, cfg.CPU)
+		if err != nil {
+			return fmt.Errorf("failed to read registers: %w", err)
+		}
+		printRegisters(regs)
+
+	case "status", "s":
+		rev, err := dp.GetRevision()
+		if err != nil {
+			return fmt.Errorf("failed to get revision: %w", err)
+		}
+		fmt.Printf("Revision: %X  Status0: %02X  Status1: %02X\n", rev, dp.GetStatus0(), dp.GetStatus1())
+
+	default:
+		return fmt.Errorf("unknown command '%s' (type 'help' for commands)", command)
+	}
+
+	return nil
+}
+
+// monitorGo optionally points the reset vectors at a start address, then
+// leaves debug mode so the CPU resets and runs
+func monitorGo(sess *protocol.Session, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: go [address]")
+	}
+
+	if len(args) == 1 {
+		addr, err := resolveAddress(args[0])
+		if err != nil {
+			return err
+		}
+		if err := monitorEnsureDebug(sess); err != nil {
+			return err
+		}
+		if err := loader.SetupResetVectors(cfg.CPU, addr, sess.DebugPort().WriteBlock); err != nil {
+			return err
+		}
+	}
+
+	if err := sess.ExitDebug(); err != nil {
+		return fmt.Errorf("failed to exit debug mode: %w", err)
+	}
+	printInfo("CPU running.\n")
+	return nil
+}
+
+const monitorHelp = `Commands (addresses, counts and values are hex):
+  dump <address> [count]         Display memory (default count 10)
+  write <address> <byte> ...     Write bytes to memory
+  poke <address> <byte>          Write a single byte to memory
+  fill <address> <count> <byte>  Fill memory with a byte (or byte pattern)
+  go [address]                   Run the CPU, optionally from a new start address
+  regs                           Show CPU registers from the register snapshot
+                                 (see 'registers --help')
+  status                         Show debug port revision and status bytes
+  help                           Show this list
+  quit                           Leave the monitor
+`
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// jsonFlag selects machine-readable JSON output
+var jsonFlag bool
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	return nil
+}
+
+// printJSONLine writes v to stdout as a single line of JSON, for commands
+// that stream results (JSON Lines)
+func printJSONLine(v interface{}) error {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	return nil
+}
+
+// hexData formats memory contents for JSON output
+func hexData(data []byte) string {
+	return hex.EncodeToString(data)
+}
+
+// memoryJSON is the JSON form of a block of memory
+type memoryJSON struct {
+	Address uint32 `json:"address"`
+	Length  int    `json:"length"`
+	Data    string `json:"data"` // Hex encoded
+}
+
+// newMemoryJSON returns the JSON form of data read from address
+func newMemoryJSON(address uint32, data []byte) memoryJSON {
+	return memoryJSON{Address: address, Length: len(data), Data: hexData(data)}
+}
+
+// reportedError wraps an error whose details a command has already printed
+// as JSON, so Execute doesn't print a second JSON document for it
+type reportedError struct {
+	err error
+}
+
+func (e reportedError) Error() string {
+	return e.err.Error()
+}
+
+func (e reportedError) Unwrap() error {
+	return e.err
+}
+
+// printJSONError reports a failed command on stdout when JSON output is
+// selected, so scripts reading stdout always get a JSON document
+func printJSONError(err error) {
+	var reported reportedError
+	if !jsonFlag || errors.As(err, &reported) {
+		return
+	}
+	printJSON(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
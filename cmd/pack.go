@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	packOutput string
+	packStart  string
+	packCPU    string
+)
+
+// packPGZCmd represents the PGZ packing command
+var packPGZCmd = &cobra.Command{
+	Use:   "pack-pgz FILE@ADDRESS [FILE@ADDRESS...]",
+	Short: "Pack binary files into a PGZ executable",
+	Long: `Build a PGZ executable from one or more raw binary files, each loaded at
+the given hex address.
+
+The start address defaults to the address of the first file. The compact
+24-bit PGZ format is used unless an address or size needs 32 bits.
+
+Example:
+  foenixmgr pack-pgz code.bin@2000 data.bin@10000 --output game.pgz
+  foenixmgr pack-pgz code.bin@2000 --start 2010 --output game.pgz`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return packPGZ(args)
+	},
+}
+
+// packPGXCmd represents the PGX packing command
+var packPGXCmd = &cobra.Command{
+	Use:   "pack-pgx FILE@ADDRESS",
+	Short: "Pack a binary file into a PGX executable",
+	Long: `Build a PGX executable from a raw binary file loaded at the given hex
+address. PGX programs start at their load address.
+
+The CPU type in the header is taken from the configured CPU unless --cpu is
+given (65816, 65C02 or a 680x0 variant).
+
+Example:
+  foenixmgr pack-pgx code.bin@0800 --output hello.pgx
+  foenixmgr pack-pgx code.bin@010000 --cpu 65816 --output hello.pgx`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return packPGX(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(packPGZCmd)
+	rootCmd.AddCommand(packPGXCmd)
+
+	packPGZCmd.Flags().StringVar(&packOutput, "output", "", "Output file")
+	packPGZCmd.Flags().StringVar(&packStart, "start", "", "Start address (hex, default: address of the first file)")
+	packPGZCmd.MarkFlagRequired("output")
+
+	packPGXCmd.Flags().StringVar(&packOutput, "output", "", "Output file")
+	packPGXCmd.Flags().StringVar(&packCPU, "cpu", "", "CPU type for the header (default: configured CPU)")
+	packPGXCmd.MarkFlagRequired("output")
+}
+
+// packPGZ reads the segments and writes them as a PGZ file
+func packPGZ(args []string) error {
+	segments := make([]loader.Segment, 0, len(args))
+	for _, arg := range args {
+		seg, err := readSegment(arg)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, seg)
+	}
+
+	start := segments[0].Address
+	if packStart != "" {
+		var err error
+		if start, err = util.ParseHexAddress(packStart); err != nil {
+			return fmt.Errorf("invalid start address: %w", err)
+		}
+	}
+
+	err := writePackedFile(func(w *bufio.Writer) error {
+		return loader.WritePGZ(w, segments, start)
+	})
+	if err != nil {
+		return err
+	}
+
+	printInfo("Packed %d segment(s) into %s, start address 0x%X.\n", len(segments), packOutput, start)
+	return nil
+}
+
+// packPGX reads a single segment and writes it as a PGX file
+func packPGX(arg string) error {
+	cpu := cfg.CPU
+	if packCPU != "" {
+		cpu = packCPU
+	}
+
+	cpuType, err := loader.PGXCPUType(cpu)
+	if err != nil {
+		return err
+	}
+
+	seg, err := readSegment(arg)
+	if err != nil {
+		return err
+	}
+
+	err = writePackedFile(func(w *bufio.Writer) error {
+		return loader.WritePGX(w, cpuType, seg.Address, seg.Data)
+	})
+	if err != nil {
+		return err
+	}
+
+	printInfo("Packed %d bytes for %s into %s, start address 0x%X.\n", len(seg.Data), cpu, packOutput, seg.Address)
+	return nil
+}
+
+// readSegment reads a FILE@ADDRESS argument
+func readSegment(arg string) (loader.Segment, error) {
+	at := strings.LastIndex(arg, "@")
+	if at <= 0 {
+		return loader.Segment{}, fmt.Errorf("invalid segment '%s' (expected FILE@ADDRESS)", arg)
+	}
+
+	filename := arg[:at]
+	address, err := util.ParseHexAddress(arg[at+1:])
+	if err != nil {
+		return loader.Segment{}, fmt.Errorf("invalid address for %s: %w", filename, err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return loader.Segment{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(data) == 0 {
+		return loader.Segment{}, fmt.Errorf("%s is empty", filename)
+	}
+
+	return loader.Segment{Address: address, Data: data}, nil
+}
+
+// writePackedFile creates the output file and fills it using write
+func writePackedFile(write func(w *bufio.Writer) error) error {
+	f, err := os.Create(packOutput)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", packOutput, err)
+	}
+	return nil
+}
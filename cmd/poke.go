@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pokeAddress string
+	pokeData    string
+	pokeFile    string
+	pokeForce   bool
+	pokeRegion  string
+)
+
+// pokeCmd represents the command for writing arbitrary bytes to memory
+var pokeCmd = &cobra.Command{
+	Use:   "poke",
+	Short: "Write bytes to memory",
+	Long: `Write arbitrary bytes to memory on the Foenix hardware, either given on the
+command line as hex bytes or read from a small file.
+
+The address may be a hex address, a label from the label file or the name of a
+memory region of the target machine (see 'map'). --region writes to the start
+of a region, refusing data larger than the region. With a
+target machine, writes that reach flash or memory outside its memory map are
+refused unless --force is given.
+
+Example:
+  foenixmgr poke --address 1234 --data "DE AD BE EF"
+  foenixmgr poke --address my_buffer --label-file program.lbl --data 00
+  foenixmgr poke --address 380000 --file patch.bin
+  foenixmgr --target f256k poke --address io.vicky.border --data 00
+  foenixmgr --target f256k poke --region video.font --file font.bin`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pokeMemory()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pokeCmd)
+
+	pokeCmd.Flags().StringVar(&pokeAddress, "address", "", "Target address (hex or label)")
+	pokeCmd.Flags().StringVar(&pokeData, "data", "", "Bytes to write (hex, e.g., \"DE AD BE EF\")")
+	pokeCmd.Flags().StringVar(&pokeFile, "file", "", "File containing the bytes to write")
+	pokeCmd.Flags().BoolVar(&pokeForce, "force", false, "Write to flash or unmapped memory of the target machine")
+	pokeCmd.Flags().StringVar(&pokeRegion, "region", "", "Write to the start of a memory region of the target machine (see 'map')")
+	pokeCmd.MarkFlagsOneRequired("address", "region")
+	pokeCmd.MarkFlagsMutuallyExclusive("address", "region")
+}
+
+// pokeMemory writes the bytes given by --data or --file to the target address
+func pokeMemory() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if (pokeData == "") == (pokeFile == "") {
+		return fmt.Errorf("specify exactly one of --data or --file")
+	}
+
+	var region config.Region
+	var addr uint32
+	var err error
+	if pokeRegion != "" {
+		region, err = cfg.MachineRegion(pokeRegion)
+		addr = region.Address
+	} else {
+		addr, err = resolveAddress(pokeAddress)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	var data []byte
+	if pokeData != "" {
+		data, err = util.ParseHexBytes(pokeData)
+		if err != nil {
+			return fmt.Errorf("invalid data: %w", err)
+		}
+	} else {
+		data, err = util.ReadFile(pokeFile)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("file %s is empty", pokeFile)
+		}
+	}
+
+	if region.Size > 0 && len(data) > int(region.Size) {
+		return fmt.Errorf("%d bytes don't fit in the %s region of %d bytes", len(data), pokeRegion, region.Size)
+	}
+	if err := checkWrite(addr, len(data), pokeForce, config.MemoryRAM, config.MemoryIO); err != nil {
+		return err
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	printInfo("Writing %d bytes to 0x%X...\n", len(data), addr)
+	if err := dp.WriteRange(addr, data); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+
+	printInfo("Write complete.\n")
+	return nil
+}
@@ -2,21 +2,39 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/daschewie/foenixmgr/pkg/connection"
 	"github.com/spf13/cobra"
-	"go.bug.st/serial"
 )
 
+var listPortsFoenixOnly bool
+
 // listPortsCmd represents the list-ports command
 var listPortsCmd = &cobra.Command{
 	Use:   "list-ports",
 	Short: "List available serial ports",
-	Long: `List all available serial ports on the system.
+	Long: `List all available serial ports on the system, with the USB vendor and
+product IDs, product name and serial number of USB adapters where the OS
+reports them.
 
 This helps identify which port to use for connecting to your Foenix hardware.
+Adapters known to be used for Foenix debug ports (the Exar USB bridges on the
+boards and FTDI cables) are marked; --foenix-only lists just those.
+
+A port can also be selected by any part of its description, the friendly
+name shown on Windows or the USB product name elsewhere, e.g.
+--port "Foenix Debug"; it must match just one port. COM ports above COM9 can
+be given as COM15 or \\.\COM15.
+
+To always use the same adapter whatever device path it gets, set its serial
+number as port_serial in foenixmgr.ini.
 
 Example:
-  foenixmgr list-ports`,
+  foenixmgr list-ports
+  foenixmgr list-ports --foenix-only
+  foenixmgr --port "XR21B1411" revision
+  foenixmgr config set port_serial A10KZP4N`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return listPorts()
 	},
@@ -24,24 +42,92 @@ Example:
 
 func init() {
 	rootCmd.AddCommand(listPortsCmd)
+
+	listPortsCmd.Flags().BoolVar(&listPortsFoenixOnly, "foenix-only", false, "Only list adapters known to be used for Foenix debug ports")
 }
 
 // listPorts lists all available serial ports
 func listPorts() error {
-	ports, err := serial.GetPortsList()
+	all, err := connection.ListPorts()
 	if err != nil {
 		return fmt.Errorf("failed to get port list: %w", err)
 	}
 
+	ports := []connection.PortInfo{}
+	for _, p := range all {
+		if !listPortsFoenixOnly || p.Foenix {
+			ports = append(ports, p)
+		}
+	}
+
+	if jsonFlag {
+		names := make([]string, len(ports))
+		for i, p := range ports {
+			names[i] = p.Name
+		}
+		return printJSON(struct {
+			Ports   []string              `json:"ports"`
+			Details []connection.PortInfo `json:"details"`
+		}{names, ports})
+	}
+
 	if len(ports) == 0 {
 		fmt.Println("No serial ports found")
 		return nil
 	}
 
 	fmt.Println("Available serial ports:")
-	for _, port := range ports {
-		fmt.Printf("  %s\n", port)
+	for _, p := range ports {
+		fmt.Printf("  %s\n", formatPort(p))
+	}
+
+	return nil
+}
+
+// formatPort describes a port on one line
+func formatPort(p connection.PortInfo) string {
+	if !p.IsUSB {
+		if p.Product != "" {
+			return fmt.Sprintf("%-16s %s", p.Name, p.Product)
+		}
+		return p.Name
 	}
 
+	fields := []string{fmt.Sprintf("%-16s USB %s:%s", p.Name, p.VID, p.PID)}
+	if p.SerialNumber != "" {
+		fields = append(fields, "SN "+p.SerialNumber)
+	}
+	if p.Product != "" {
+		fields = append(fields, p.Product)
+	}
+	if p.Foenix {
+		fields = append(fields, "[Foenix adapter]")
+	}
+	return strings.Join(fields, "  ")
+}
+
+// resolvePort looks up the port of the adapter set with port_serial, unless
+// the port was given with --port, or the port described by a name such as
+// "Foenix Debug". The port found replaces cfg.Port.
+func resolvePort() error {
+	if cfg.PortSerial != "" && portFlag == "" {
+		port, err := connection.FindPortBySerial(cfg.PortSerial)
+		if err != nil {
+			return err
+		}
+		cfg.Port = port
+		cfg.PortSerial = ""
+		return nil
+	}
+
+	if name, ok := connection.COMPortName(cfg.Port); ok {
+		cfg.Port = name
+	} else if connection.IsPortDescription(cfg.Port) {
+		port, err := connection.FindPortByName(cfg.Port)
+		if err != nil {
+			return err
+		}
+		cfg.Port = port
+	}
 	return nil
 }
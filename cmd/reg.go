@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// regMaxSize is the largest register that is read or written as one number
+const regMaxSize = 8
+
+// regCmd represents the reg command group
+var regCmd = &cobra.Command{
+	Use:   "reg",
+	Short: "Read and write hardware registers by name",
+	Long: `Read and write hardware registers by the names in the target machine's
+register map, instead of raw addresses with dump and poke.
+
+Registers are the regions of the target machine, defined in its
+[machine.NAME] section of foenixmgr.ini as region.NAME=ADDRESS[,SIZE], with
+the address as seen by the debug port. A register without a size is one
+byte. Multi-byte registers are little-endian.
+
+Example:
+  foenixmgr reg list --target f256k
+  foenixmgr reg get rtc.seconds --target f256k
+  foenixmgr reg set vicky.border_color 0000FF --target f256k`,
+}
+
+// regListCmd represents the reg list command
+var regListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the registers of the target machine",
+	Long: `List the registers (regions) defined for the target machine.
+
+Example:
+  foenixmgr reg list --target f256k`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listRegisters()
+	},
+}
+
+// regGetCmd represents the reg get command
+var regGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Read a register",
+	Long: `Read a register of the target machine by name and print its value.
+
+Example:
+  foenixmgr reg get rtc.seconds --target f256k
+  foenixmgr reg get vicky.border_color --target f256k --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return getRegister(args[0])
+	},
+}
+
+// regSetCmd represents the reg set command
+var regSetCmd = &cobra.Command{
+	Use:   "set <name> <value>",
+	Short: "Write a register",
+	Long: `Write a hex value to a register of the target machine by name. The value
+must fit in the register's size and is written little-endian.
+
+Example:
+  foenixmgr reg set vicky.border_color 0000FF --target f256k
+  foenixmgr reg set psg.volume 9F --target f256k`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setRegister(args[0], args[1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(regCmd)
+	regCmd.AddCommand(regListCmd)
+	regCmd.AddCommand(regGetCmd)
+	regCmd.AddCommand(regSetCmd)
+}
+
+// listRegisters prints the regions of the target machine
+func listRegisters() error {
+	m := cfg.Machine()
+	if m == nil {
+		return fmt.Errorf("no target machine selected (use --target)")
+	}
+
+	names := make([]string, 0, len(m.Regions))
+	for name := range m.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if jsonFlag {
+		type register struct {
+			Name    string `json:"name"`
+			Address uint32 `json:"address"`
+			Size    uint32 `json:"size"`
+		}
+		registers := []register{}
+		for _, name := range names {
+			registers = append(registers, register{name, m.Regions[name].Address, registerSize(m.Regions[name])})
+		}
+		return printJSON(struct {
+			Machine   string     `json:"machine"`
+			Registers []register `json:"registers"`
+		}{m.Name, registers})
+	}
+
+	if len(names) == 0 {
+		printInfo("No registers defined for %s (set region.NAME in [machine.%s] of foenixmgr.ini).\n", m.Name, m.Name)
+		return nil
+	}
+	fmt.Printf("%-24s %-8s %s\n", "NAME", "ADDRESS", "SIZE")
+	for _, name := range names {
+		r := m.Regions[name]
+		fmt.Printf("%-24s %06X   %X\n", name, r.Address, registerSize(r))
+	}
+	return nil
+}
+
+// getRegister reads a register and prints its value
+func getRegister(name string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	r, err := cfg.MachineRegion(name)
+	if err != nil {
+		return err
+	}
+	size := registerSize(r)
+	if size > regMaxSize {
+		return fmt.Errorf("%s is 0x%X bytes, use dump to read registers larger than %d bytes", name, size, regMaxSize)
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	data, err := dp.ReadBlock(r.Address, uint16(size))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	value := uint64(0)
+	for i := len(data) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(data[i])
+	}
+
+	if jsonFlag {
+		return printJSON(struct {
+			Name    string `json:"name"`
+			Address uint32 `json:"address"`
+			Size    uint32 `json:"size"`
+			Value   uint64 `json:"value"`
+			Bytes   string `json:"bytes"`
+		}{name, r.Address, size, value, util.FormatHex(data)})
+	}
+
+	fmt.Printf("%s (0x%06X) = 0x%0*X\n", name, r.Address, size*2, value)
+	return nil
+}
+
+// setRegister writes a hex value to a register
+func setRegister(name, valueText string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	r, err := cfg.MachineRegion(name)
+	if err != nil {
+		return err
+	}
+	size := registerSize(r)
+	if size > regMaxSize {
+		return fmt.Errorf("%s is 0x%X bytes, use poke to write registers larger than %d bytes", name, size, regMaxSize)
+	}
+
+	value, err := strconv.ParseUint(valueText, 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value '%s': must be hex", valueText)
+	}
+	if size < regMaxSize && value>>(size*8) != 0 {
+		return fmt.Errorf("value 0x%X doesn't fit in the %d-byte register %s", value, size, name)
+	}
+
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(value >> (8 * i))
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	if err := dp.WriteBlock(r.Address, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	printInfo("%s (0x%06X) set to 0x%0*X\n", name, r.Address, size*2, value)
+	return nil
+}
+
+// registerSize returns the size of a register region, one byte if it has
+// no size
+func registerSize(r config.Region) uint32 {
+	if r.Size == 0 {
+		return 1
+	}
+	return r.Size
+}
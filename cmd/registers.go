@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// registersCmd represents the CPU register inspection command
+var registersCmd = &cobra.Command{
+	Use:   "registers",
+	Short: "Show CPU registers",
+	Long: `Read the CPU register snapshot from the Foenix hardware and display the
+registers and status flags.
+
+The debug port can't read CPU registers and no machine firmware saves them,
+so the snapshot is a convention: code of your own on the machine (a BRK or
+NMI handler, or a monitor) has to write the registers to the register_address
+of the target machine, which you set in its [machine.NAME] section of
+foenixmgr.ini. No built-in machine sets it. The layouts are:
+
+  65C02:  PC(2) A X Y SP P                              (little-endian)
+  65816:  PC(2) PBR A(2) X(2) Y(2) SP(2) DP(2) DBR P E   (little-endian)
+  680x0:  D0-D7(4 each) A0-A7(4 each) PC(4) SR(2)        (big-endian)
+
+Registers are decoded for the configured CPU: PC, A, X, Y, SP and P for 65xx
+CPUs, D0-D7, A0-A7, PC and SR for 680x0 CPUs. Flags are shown in upper case
+when set.
+
+The snapshot is only as current as the last time your code wrote it.
+
+Example:
+  foenixmgr registers --target f256k`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showRegisters()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(registersCmd)
+}
+
+// showRegisters reads and prints the register snapshot
+func showRegisters() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	address, err := registerAddress()
+	if err != nil {
+		return err
+	}
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	regs, err := dp.ReadRegisters(address, cfg.CPU)
+	if err != nil {
+		return err
+	}
+
+	if jsonFlag {
+		return printJSON(registersJSON(regs))
+	}
+
+	printRegisters(regs)
+	return nil
+}
+
+// registerAddress returns the register snapshot address of the target machine
+func registerAddress() (uint32, error) {
+	m := cfg.Machine()
+	if m == nil {
+		return 0, fmt.Errorf("no target machine set (use --target to select one with a register_address)")
+	}
+	if m.RegisterAddress == "" {
+		return 0, fmt.Errorf("no register_address set for %s (add the address your code on the machine writes the snapshot to in [machine.%s] of foenixmgr.ini; see 'registers --help')", m.Name, m.Name)
+	}
+
+	address, err := util.ParseHexAddress(m.RegisterAddress)
+	if err != nil {
+		return 0, fmt.Errorf("invalid register_address for %s: %w", m.Name, err)
+	}
+	return address, nil
+}
+
+// registerJSON is the JSON form of a register
+type registerJSON struct {
+	Name  string `json:"name"`
+	Value uint32 `json:"value"`
+	Width int    `json:"width"`
+}
+
+// registersJSON returns the JSON form of a register snapshot
+func registersJSON(regs *protocol.RegisterSet) interface{} {
+	registers := []registerJSON{}
+	for _, r := range regs.Registers {
+		registers = append(registers, registerJSON{r.Name, r.Value, r.Width})
+	}
+	return struct {
+		Registers []registerJSON `json:"registers"`
+		Flags     string         `json:"flags"`
+	}{registers, regs.Flags}
+}
+
+// printRegisters prints registers eight to a line, followed by the flags
+func printRegisters(regs *protocol.RegisterSet) {
+	var fields []string
+	for i, r := range regs.Registers {
+		fields = append(fields, fmt.Sprintf("%s=%s", r.Name, r))
+		if len(fields) == 8 || i == len(regs.Registers)-1 {
+			fmt.Println(strings.Join(fields, " "))
+			fields = nil
+		}
+	}
+	fmt.Printf("Flags: %s\n", regs.Flags)
+}
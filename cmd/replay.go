@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/recording"
+	"github.com/spf13/cobra"
+)
+
+// replayShowBytes is how many bytes of a differing response are shown
+const replayShowBytes = 32
+
+var replayList bool
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay <file>",
+	Short: "Replay a recorded session against the mock device",
+	Long: `Replay a session recorded with --record against the mock device, and show
+the requests the mock answers differently than the recorded machine did.
+
+--record captures every byte sent to and received from the debug port, with
+the command line and settings of the session. Attach the recording to a bug
+report so the problem can be looked at without the hardware. A session
+recorded on the mock device replays exactly, so a recording kept with the
+tests checks that a protocol change still gets the same answers to the
+recorded requests.
+
+The requests are sent in the recorded order, without the recorded timing, to
+a mock device set up with the recording's flash size and address. Memory a
+session read without writing it first reads differently from real hardware,
+so a session recorded on a machine is expected to differ there. The command
+fails with exit code 7 if any response differs.
+
+Example:
+  foenixmgr --record session.fxr upload game.pgz
+  foenixmgr replay session.fxr
+  foenixmgr replay session.fxr --list`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return replaySession(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().BoolVar(&replayList, "list", false, "List every exchange, not just the differing ones")
+}
+
+// replaySession replays a recording against a fresh mock device
+func replaySession(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer f.Close()
+
+	rec, err := recording.Read(f)
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	mockConfig := *cfg
+	if rec.Header.FlashSize > 0 {
+		mockConfig.FlashSize = rec.Header.FlashSize
+	}
+	if rec.Header.FlashAddress != "" {
+		mockConfig.FlashAddress = rec.Header.FlashAddress
+	}
+	mock := connection.NewMockConnection(&mockConfig)
+	if err := mock.Open(connection.MockPrefix); err != nil {
+		return err
+	}
+	defer mock.Close()
+
+	h := rec.Header
+	printInfo("Session recorded %s on port %s\n", h.Started.Local().Format("2006-01-02 15:04:05"), h.Port)
+	printInfo("Command: foenixmgr %s\n", strings.Join(h.Command, " "))
+	exchanges := rec.Replay(mock)
+
+	var differing []recording.Exchange
+	for _, x := range exchanges {
+		if !x.Matches() {
+			differing = append(differing, x)
+		}
+	}
+	if jsonFlag {
+		return printReplayJSON(filename, exchanges, differing)
+	}
+
+	for _, x := range exchanges {
+		switch {
+		case !x.Matches():
+			fmt.Printf("%5d  %-28s  DIFFERS\n", x.Number, x)
+			fmt.Printf("       recorded: %s\n", replayResponse(x.Recorded, x.RecordedError))
+			fmt.Printf("       replayed: %s\n", replayResponse(x.Replayed, x.ReplayedError))
+		case replayList:
+			fmt.Printf("%5d  %-28s  ok\n", x.Number, x)
+		}
+	}
+
+	if len(differing) > 0 {
+		return &protocol.Error{Kind: protocol.ErrVerify, Err: fmt.Errorf("%d of %d exchanges differ from the recording", len(differing), len(exchanges))}
+	}
+	printInfo("All %d exchanges matched the recording.\n", len(exchanges))
+	return nil
+}
+
+// replayResponse formats a response for the differences listing, shortened to
+// replayShowBytes bytes
+func replayResponse(data []byte, errText string) string {
+	s := "nothing"
+	if len(data) > 0 {
+		s = fmt.Sprintf("% X", data[:min(len(data), replayShowBytes)])
+		if len(data) > replayShowBytes {
+			s += fmt.Sprintf(" ... (%d bytes)", len(data))
+		}
+	}
+	if errText != "" {
+		s += " (error: " + errText + ")"
+	}
+	return s
+}
+
+// printReplayJSON prints the replay result as JSON. Differences still fail
+// the command.
+func printReplayJSON(filename string, exchanges, differing []recording.Exchange) error {
+	type difference struct {
+		Number        int    `json:"number"`
+		Request       string `json:"request"` // Hex encoded
+		Recorded      string `json:"recorded"`
+		Replayed      string `json:"replayed"`
+		RecordedError string `json:"recorded_error,omitempty"`
+		ReplayedError string `json:"replayed_error,omitempty"`
+	}
+
+	differences := []difference{}
+	for _, x := range differing {
+		differences = append(differences, difference{
+			Number:        x.Number,
+			Request:       hexData(x.Request),
+			Recorded:      hexData(x.Recorded),
+			Replayed:      hexData(x.Replayed),
+			RecordedError: x.RecordedError,
+			ReplayedError: x.ReplayedError,
+		})
+	}
+
+	if err := printJSON(struct {
+		File        string       `json:"file"`
+		Exchanges   int          `json:"exchanges"`
+		Match       bool         `json:"match"`
+		Differences []difference `json:"differences"`
+	}{filename, len(exchanges), len(differing) == 0, differences}); err != nil {
+		return err
+	}
+
+	if len(differing) > 0 {
+		return reportedError{&protocol.Error{Kind: protocol.ErrVerify, Err: fmt.Errorf("%d of %d exchanges differ from the recording", len(differing), len(exchanges))}}
+	}
+	return nil
+}
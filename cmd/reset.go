@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var resetIntoDebug bool
+
+// resetCmd represents the reset command
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the machine",
+	Long: `Reset the machine from the command line by entering and leaving debug
+mode, which reboots the CPU. A CPU stopped with the 'stop' command is started
+and reset as well.
+
+With --into-debug the machine is reset and then left in debug mode with the
+CPU stopped (F256 only), as after 'stop', so commands can inspect and load it
+from a clean state before 'start' runs it.
+
+Example:
+  foenixmgr reset
+  foenixmgr reset --into-debug`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resetMachine()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resetCmd)
+
+	resetCmd.Flags().BoolVar(&resetIntoDebug, "into-debug", false, "Leave the machine in debug mode with the CPU stopped after the reset")
+}
+
+// resetMachine resets the CPU by leaving debug mode, optionally stopping it
+// again right after
+func resetMachine() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+	if resetIntoDebug {
+		if err := checkCapability(protocol.CapStopCPU); err != nil {
+			return err
+		}
+	}
+
+	dp, err := openDebugPort()
+	if err != nil {
+		return err
+	}
+
+	// A stopped CPU is already in debug mode
+	if util.IsStopped(cfg.Port) {
+		if err := dp.StartCPU(); err != nil {
+			return fmt.Errorf("failed to start CPU: %w", err)
+		}
+	} else if err := session.EnterDebug(); err != nil {
+		return fmt.Errorf("failed to enter debug mode: %w", err)
+	}
+
+	printInfo("Resetting machine...\n")
+	if err := session.ExitDebug(); err != nil {
+		return fmt.Errorf("failed to exit debug mode: %w", err)
+	}
+	if err := util.ClearStopIndicator(cfg.Port); err != nil {
+		return fmt.Errorf("failed to clear stop indicator: %w", err)
+	}
+
+	if !resetIntoDebug {
+		printInfo("Machine reset.\n")
+		return nil
+	}
+
+	if err := session.EnterDebug(); err != nil {
+		return fmt.Errorf("failed to enter debug mode: %w", err)
+	}
+	if err := dp.StopCPU(); err != nil {
+		return fmt.Errorf("failed to stop CPU: %w", err)
+	}
+
+	// Leave the machine in debug mode when the session closes
+	session.ReleaseDebug()
+	if err := util.SetStopIndicator(cfg.Port); err != nil {
+		return fmt.Errorf("failed to set stop indicator: %w", err)
+	}
+
+	printInfo("Machine reset and stopped. Use 'start' command to run it.\n")
+	return nil
+}
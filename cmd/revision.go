@@ -3,9 +3,6 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
-	"github.com/daschewie/foenixmgr/pkg/protocol"
-	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
 )
 
@@ -20,23 +17,10 @@ RevB2 returns 0, RevC4A returns 1.`,
 			return err
 		}
 
-		// Create connection
-		conn := connection.NewConnection(cfg.Port)
-		if err := conn.Open(cfg.Port); err != nil {
-			return fmt.Errorf("failed to open connection: %w", err)
-		}
-		defer conn.Close()
-
-		// Create protocol handler
-		dp := protocol.NewDebugPort(conn, cfg)
-
-		// Enter debug mode
-		isStopped := util.IsStopped()
-		if !isStopped {
-			if err := dp.EnterDebug(); err != nil {
-				return fmt.Errorf("failed to enter debug mode: %w", err)
-			}
-			defer dp.ExitDebug()
+		// Open the shared connection and enter debug mode
+		dp, err := enterDebug()
+		if err != nil {
+			return err
 		}
 
 		// Get revision
@@ -46,6 +30,11 @@ RevB2 returns 0, RevC4A returns 1.`,
 		}
 
 		// Print revision
+		if jsonFlag {
+			return printJSON(struct {
+				Revision byte `json:"revision"`
+			}{rev})
+		}
 		fmt.Printf("%X\n", rev)
 
 		return nil
@@ -2,10 +2,16 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
 	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
 )
 
@@ -14,9 +20,17 @@ var (
 	cfg *config.Config
 
 	// Global flags
-	portFlag   string
-	targetFlag string
-	quietFlag  bool
+	portFlag    string
+	targetFlag  string
+	profileFlag string
+	quietFlag   bool
+
+	noVerifyLRCFlag bool
+	keepOpenFlag    bool
+	traceFlag       string
+	recordFlag      string
+	dryRunFlag      bool
+	yesFlag         bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -29,52 +43,254 @@ var rootCmd = &cobra.Command{
 It enables uploading binaries, programming flash memory, reading/writing memory,
 and controlling the CPU state over a serial or TCP connection.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		// Load configuration
-		var err error
-		cfg, err = config.Load()
-		if err != nil {
-			return fmt.Errorf("failed to load configuration: %w", err)
+		return loadConfig(cmd)
+	},
+}
+
+// configFlags maps the persistent flags that override settings to their
+// foenixmgr.ini keys
+var configFlags = []struct {
+	flag string
+	key  string
+}{
+	{"port", "port"},
+	{"data-rate", "data_rate"},
+	{"parity", "parity"},
+	{"stop-bits", "stop_bits"},
+	{"flow-control", "flow_control"},
+	{"dtr", "dtr"},
+	{"rts", "rts"},
+	{"timeout", "timeout"},
+	{"lock-wait", "lock_wait"},
+	{"retries", "retries"},
+	{"verify-writes", "verify_writes"},
+	{"cpu", "cpu"},
+	{"chunk-size", "chunk_size"},
+	{"flash-size", "flash_size"},
+	{"label-file", "labels"},
+}
+
+// loadConfig loads the configuration and applies overrides. From lowest to
+// highest precedence, settings come from:
+//  1. Built-in defaults
+//  2. The [DEFAULT] section of foenixmgr.ini
+//  3. The target machine set with target= in the ini
+//  4. The profile (--profile, else FOENIX_PROFILE): its target machine, then
+//     its other settings
+//  5. The target machine set with --target, else FOENIX_TARGET
+//  6. FOENIX_* environment variables (e.g. FOENIX_DATA_RATE)
+//  7. Command line flags
+//
+// A cpu set in the profile is kept over the target machine's CPU.
+func loadConfig(cmd *cobra.Command) error {
+	// Load configuration
+	var err error
+	cfg, err = config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	profile := os.Getenv(config.EnvName("profile"))
+	if profileFlag != "" {
+		profile = profileFlag
+	}
+	if profile != "" {
+		if err := cfg.ApplyProfile(profile); err != nil {
+			return err
+		}
+	}
+
+	// Select the target machine before anything that may override its settings
+	target := os.Getenv(config.EnvName("target"))
+	if targetFlag != "" {
+		target = targetFlag
+	}
+	if target != "" {
+		if err := cfg.Set("target", target); err != nil {
+			return err
 		}
+	}
+
+	// Apply environment variable overrides
+	if err := cfg.ApplyEnv(); err != nil {
+		return err
+	}
 
-		// Override port from flag if specified
-		if portFlag != "" {
-			cfg.Port = portFlag
+	// Apply flag overrides
+	for _, f := range configFlags {
+		if flag := cmd.Flags().Lookup(f.flag); flag != nil && flag.Changed {
+			if err := cfg.Set(f.key, flag.Value.String()); err != nil {
+				return fmt.Errorf("--%s: %w", f.flag, err)
+			}
 		}
+	}
+
+	// Disable response checksum verification if requested
+	if noVerifyLRCFlag {
+		cfg.VerifyLRC = false
+	}
+
+	// Quiet mode is handled by printInfo() helper function throughout the codebase
+	// (suppresses informational output when quietFlag is true). JSON output
+	// must not be mixed with informational messages.
+	if jsonFlag {
+		quietFlag = true
+	}
 
-		// Set target machine if specified
-		if targetFlag != "" {
-			cfg.SetTarget(targetFlag)
+	// FOENIX_ASSUME_YES answers confirmations like --yes
+	if value := os.Getenv("FOENIX_ASSUME_YES"); value != "" && !yesFlag {
+		assumeYes, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid FOENIX_ASSUME_YES value '%s'", value)
 		}
+		yesFlag = assumeYes
+	}
 
-		// Quiet mode is handled by printInfo() helper function throughout the codebase
-		// (suppresses informational output when quietFlag is true)
+	if dryRunFlag && keepOpenFlag {
+		return fmt.Errorf("--dry-run cannot be combined with --keep-open")
+	}
 
-		return nil
-	},
+	return nil
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The shared connection is closed here rather than in a post-run hook so that
+// it is also closed when a command fails or is interrupted with Ctrl+C.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := installInterruptHandler()
+	defer stop()
+	interruptContext = ctx
+
+	executed, err := rootCmd.ExecuteContextC(ctx)
+	if err == nil {
+		err = recordMacroCommand(executed)
+	}
+	if closeErr := closeSession(err == nil); err == nil {
+		err = closeErr
+	}
+	if closeErr := closeTrace(); err == nil {
+		err = closeErr
+	}
+	if closeErr := closeRecording(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		printJSONError(err)
+	}
+	return err
+}
+
+// installInterruptHandler returns a context that is done when the process is
+// interrupted with Ctrl+C or terminated. The command then stops after the
+// transfer in progress and Execute leaves debug mode and closes the port as
+// usual. A second Ctrl+C quits at once; a machine left in debug mode is then
+// recorded with the stop indicator, so 'foenixmgr start' resumes it.
+func installInterruptHandler() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		if _, ok := <-signals; !ok {
+			return
+		}
+		if !interruptsHandled.Load() {
+			fmt.Fprintln(os.Stderr, "Interrupted: finishing the current transfer and leaving debug mode (Ctrl+C again to quit at once)")
+		}
+		cancel()
+
+		if _, ok := <-signals; !ok {
+			return
+		}
+		if session != nil && session.InDebug() {
+			if err := util.SetStopIndicator(cfg.Port); err == nil {
+				fmt.Fprintln(os.Stderr, "The machine was left in debug mode with the CPU stopped; run 'foenixmgr start' to resume it.")
+			}
+		}
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(signals)
+		cancel()
+	}
 }
 
 func init() {
 	// Persistent flags available to all commands
-	rootCmd.PersistentFlags().StringVar(&portFlag, "port", "", "Serial port or TCP address (e.g., COM3, /dev/ttyUSB0, 192.168.1.114:2560)")
-	rootCmd.PersistentFlags().StringVar(&targetFlag, "target", "", "Target machine (f256jr, f256k, fnx1591, a2560)")
+	rootCmd.PersistentFlags().StringVar(&portFlag, "port", "", "Serial port, TCP address or mock: (e.g., COM3, /dev/ttyUSB0, 192.168.1.114:2560)")
+	rootCmd.PersistentFlags().StringVar(&targetFlag, "target", "", "Target machine (f256jr, f256k, fnx1591, a2560, or see 'targets')")
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Settings profile from a [profile.NAME] section of foenixmgr.ini (or set FOENIX_PROFILE)")
+	rootCmd.PersistentFlags().Int("data-rate", 0, "Serial data rate (overrides data_rate)")
+	rootCmd.PersistentFlags().String("parity", "", "Serial parity: none, odd, even, mark or space (overrides parity)")
+	rootCmd.PersistentFlags().String("stop-bits", "", "Serial stop bits: 1, 1.5 or 2 (overrides stop_bits)")
+	rootCmd.PersistentFlags().String("flow-control", "", "Serial flow control: none or rtscts (overrides flow_control)")
+	rootCmd.PersistentFlags().String("dtr", "", "Set DTR on or off after opening the serial port (overrides dtr)")
+	rootCmd.PersistentFlags().String("rts", "", "Set RTS on or off after opening the serial port (overrides rts)")
+	rootCmd.PersistentFlags().Int("timeout", 0, "Read timeout in seconds for each response (overrides timeout)")
+	rootCmd.PersistentFlags().Int("lock-wait", 0, "Seconds to wait for a port another process or client is using (overrides lock_wait)")
+	rootCmd.PersistentFlags().Int("retries", 0, "Times a failed memory transfer is repeated (overrides retries)")
+	rootCmd.PersistentFlags().String("cpu", "", "CPU type (overrides cpu)")
+	rootCmd.PersistentFlags().Int("chunk-size", 0, "Upload chunk size in bytes (overrides chunk_size)")
+	rootCmd.PersistentFlags().Int("flash-size", 0, "Flash memory size in bytes (overrides flash_size)")
+	rootCmd.PersistentFlags().StringVar(&labelFile, "label-file", "", "Label file (overrides labels)")
 	rootCmd.PersistentFlags().BoolVar(&quietFlag, "quiet", false, "Suppress informational output")
+	rootCmd.PersistentFlags().BoolVar(&jsonFlag, "json", false, "Print results as JSON (implies --quiet)")
+	rootCmd.PersistentFlags().BoolVar(&keepOpenFlag, "keep-open", false, "Keep the connection open after the command and share it with other invocations")
+	rootCmd.PersistentFlags().BoolVar(&noVerifyLRCFlag, "no-verify-lrc", false, "Don't verify the LRC checksum of debug port responses")
+	rootCmd.PersistentFlags().Bool("verify-writes", false, "Read back every memory write and rewrite blocks that don't match (overrides verify_writes)")
+	rootCmd.PersistentFlags().StringVar(&traceFlag, "trace", "", "Append a trace of every debug port exchange to a file (see 'trace decode')")
+	rootCmd.PersistentFlags().StringVar(&recordFlag, "record", "", "Record all debug port traffic of the session to a file (see 'replay')")
+	rootCmd.PersistentFlags().BoolVarP(&yesFlag, "yes", "y", false, "Answer yes to confirmation prompts (or set FOENIX_ASSUME_YES=1)")
+	rootCmd.PersistentFlags().BoolVar(&dryRunFlag, "dry-run", false, "Show the debug port operations without connecting to the hardware")
 
 	// Disable default completion command
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 }
 
-// Helper function to check if connection flags are valid
+// Helper function to check if connection flags are valid, looking up the port
+// when it is given by serial number or description
 func validateConnectionFlags() error {
+	if dryRunFlag {
+		return nil
+	}
 	if cfg.Port == "" && portFlag == "" {
 		return fmt.Errorf("no port specified (use --port flag or set in foenixmgr.ini)")
 	}
-	return nil
+	// The port is resolved here, as the stop state is kept per port
+	return resolvePort()
+}
+
+// checkCapability returns an error if the target machine is known not to
+// support a capability, before anything is sent to it. Without a target,
+// capabilities that need one ask for --target.
+func checkCapability(capability protocol.Capability) error {
+	err := protocol.MachineCapabilities(cfg).Check(capability)
+	if err != nil && cfg.Machine() == nil {
+		return fmt.Errorf("%w\nUse --target option to specify machine (f256jr, f256k, fnx1591)", err)
+	}
+	return err
+}
+
+// checkWrite refuses a write of length bytes at address that reaches memory
+// of another kind than allowed, or no memory at all, in the target machine's
+// memory map. With force it only warns.
+func checkWrite(address uint32, length int, force bool, allowed ...string) error {
+	m := cfg.Machine()
+	if m == nil {
+		return nil
+	}
+	err := m.CheckWrite(address, length, allowed...)
+	if err == nil {
+		return nil
+	}
+	if force {
+		printInfo("Warning: %v\n", err)
+		return nil
+	}
+	return fmt.Errorf("%w (use --force to write anyway)", err)
 }
 
 // Helper function for printing output (respects quiet mode)
@@ -84,6 +300,35 @@ func printInfo(format string, args ...interface{}) {
 	}
 }
 
+// printOutcome prints the outcome of an operation, like printInfo. A dry run
+// only performed the operation on the simulated device, and read back that
+// device's memory, so the message says so.
+func printOutcome(format string, args ...interface{}) {
+	if dryRunFlag {
+		format = "Dry run, simulated device: " + format
+	}
+	printInfo(format, args...)
+}
+
+// confirm asks the user to confirm an operation with y/n. With --yes, or in a
+// dry run that changes nothing, it doesn't ask. Without a terminal to ask on
+// it fails.
+func confirm(prompt string) (bool, error) {
+	if yesFlag || dryRunFlag {
+		return true, nil
+	}
+	return util.Confirm(prompt)
+}
+
+// confirmDanger asks the user to type "yes" to confirm a destructive
+// operation. With --yes or in a dry run it doesn't ask.
+func confirmDanger(operation string) (bool, error) {
+	if yesFlag || dryRunFlag {
+		return true, nil
+	}
+	return util.ConfirmDanger(operation)
+}
+
 // Helper function for printing errors (always shown)
 func printError(format string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
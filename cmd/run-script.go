@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/luascript"
+	"github.com/spf13/cobra"
+)
+
+var runScriptForce bool
+
+// runScriptCmd represents the Lua script command
+var runScriptCmd = &cobra.Command{
+	Use:   "run-script <file.lua> [args...]",
+	Short: "Run a Lua script against the machine",
+	Long: `Run a Lua 5.1 script with functions that work on the machine, for hardware
+test sequences and automated checks: poke registers, read the results and
+assert their values. Debug mode is entered on the first access and left when
+the script finishes.
+
+Functions:
+  read(addr)              Byte at addr
+  read(addr, count)       Table of count bytes
+  write(addr, ...)        Write bytes given as numbers, tables or strings
+  dump(addr [, count])    Print a hex dump (16 bytes by default)
+  upload(file)            Upload a program (format from the extension)
+  stop()  start()         Stop the CPU and let it run again, like the commands
+  sleep(seconds)          Wait, e.g. sleep(0.5)
+  address(name)           Address of a label or region
+
+Addresses are numbers, or strings with a label, region name or hex address,
+e.g. "vicky.border" or "D000". Extra arguments are in the table arg. A
+failed access raises a Lua error, which pcall can catch; an uncaught error or
+a failed assert stops the script with exit code 1. Writes that reach flash or
+unmapped memory of the target machine are refused unless --force is given.
+
+Example script:
+  write("io.vicky.border", 0x01)
+  local v = read("io.vicky.border")
+  assert(v == 0x01, string.format("border control reads %02X", v))
+  dump(0x2000, 32)
+
+Example:
+  foenixmgr run-script test.lua
+  foenixmgr run-script check-ram.lua 10000 20000`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runLuaScript(args[0], args[1:])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runScriptCmd)
+
+	runScriptCmd.Flags().BoolVar(&runScriptForce, "force", false, "Allow writes that reach flash or unmapped memory of the target machine")
+}
+
+// runLuaScript runs a Lua script file with the machine functions
+func runLuaScript(filename string, args []string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	r := &luascript.Runner{
+		Target:  luaTarget{},
+		Output:  os.Stdout,
+		Args:    args,
+		Context: interruptContext,
+	}
+	if err := r.RunFile(filename); err != nil {
+		return fmt.Errorf("script failed: %w", err)
+	}
+	return nil
+}
+
+// luaTarget gives Lua scripts the shared debug port. Each access enters
+// debug mode again if the script has let the CPU run.
+type luaTarget struct{}
+
+func (luaTarget) ReadMemory(address uint32, length int) ([]byte, error) {
+	dp, err := enterDebug()
+	if err != nil {
+		return nil, err
+	}
+	return dp.ReadRange(address, uint32(length))
+}
+
+func (luaTarget) WriteMemory(address uint32, data []byte) error {
+	if err := checkWrite(address, len(data), runScriptForce, config.MemoryRAM, config.MemoryIO); err != nil {
+		return err
+	}
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+	return dp.WriteRange(address, data)
+}
+
+func (luaTarget) Resolve(name string) (uint32, error) {
+	return resolveAddress(name)
+}
+
+func (luaTarget) Upload(filename string) error {
+	format, err := loader.FormatForFile(filename)
+	if err != nil {
+		return err
+	}
+	return uploadFile(filename, format)
+}
+
+func (luaTarget) StopCPU() error {
+	return stopCPU()
+}
+
+func (luaTarget) StartCPU() error {
+	return startCPU()
+}
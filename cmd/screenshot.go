@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/video"
+	"github.com/spf13/cobra"
+)
+
+var (
+	screenshotOutput  string
+	screenshotMode    string
+	screenshotColumns int
+	screenshotRows    int
+	screenshotWidth   int
+	screenshotHeight  int
+)
+
+// screenshotCmd represents the screenshot command
+var screenshotCmd = &cobra.Command{
+	Use:   "screenshot",
+	Short: "Save the screen as a PNG image",
+	Long: `Read the video memory and colour look-up tables of the target machine and
+render the screen as a PNG image on the host.
+
+Text mode renders the text screen with the machine's font and text colours.
+Bitmap mode renders an 8-bit indexed bitmap with its colour look-up table.
+
+Video memory is found through regions of the target machine, defined in its
+[machine.NAME] section of foenixmgr.ini as seen by the debug port:
+  region.video.text      Text screen characters
+  region.video.color     Text colours (foreground high nibble, background low)
+  region.video.font      8x8 font, 256 characters
+  region.video.text_fg   Text foreground LUT (16 entries of B,G,R,unused)
+  region.video.text_bg   Text background LUT
+  region.video.bitmap    Bitmap pixels
+  region.video.lut       Bitmap LUT (256 entries)
+
+Example:
+  foenixmgr screenshot --output shot.png --target f256k
+  foenixmgr screenshot --output title.png --mode bitmap --target f256k
+  foenixmgr screenshot --output shot.png --columns 40 --rows 30 --target f256k`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return takeScreenshot()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(screenshotCmd)
+
+	screenshotCmd.Flags().StringVar(&screenshotOutput, "output", "", "PNG file to write")
+	screenshotCmd.Flags().StringVar(&screenshotMode, "mode", "text", "Screen to capture (text, bitmap)")
+	screenshotCmd.Flags().IntVar(&screenshotColumns, "columns", 80, "Text screen width in characters")
+	screenshotCmd.Flags().IntVar(&screenshotRows, "rows", 60, "Text screen height in characters")
+	screenshotCmd.Flags().IntVar(&screenshotWidth, "width", 320, "Bitmap width in pixels")
+	screenshotCmd.Flags().IntVar(&screenshotHeight, "height", 240, "Bitmap height in pixels")
+	screenshotCmd.MarkFlagRequired("output")
+}
+
+// takeScreenshot renders the screen and writes it to the output file
+func takeScreenshot() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	mode := strings.ToLower(screenshotMode)
+	if mode != "text" && mode != "bitmap" {
+		return fmt.Errorf("invalid mode '%s' (must be text or bitmap)", screenshotMode)
+	}
+	if screenshotColumns <= 0 || screenshotRows <= 0 || screenshotWidth <= 0 || screenshotHeight <= 0 {
+		return fmt.Errorf("the screen size must be positive")
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	var img image.Image
+	if mode == "text" {
+		img, err = captureText(dp)
+	} else {
+		img, err = captureBitmap(dp)
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(screenshotOutput)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return fmt.Errorf("failed to write %s: %w", screenshotOutput, err)
+	}
+
+	b := img.Bounds()
+	printInfo("Saved %dx%d screenshot to %s.\n", b.Dx(), b.Dy(), screenshotOutput)
+	return nil
+}
+
+// captureText reads and renders the text screen
+func captureText(dp *protocol.DebugPort) (image.Image, error) {
+	cells := uint32(screenshotColumns * screenshotRows)
+	screen := &video.TextScreen{Columns: screenshotColumns, Rows: screenshotRows}
+
+	var err error
+	if screen.Chars, err = readVideoRegion(dp, video.RegionText, cells); err != nil {
+		return nil, err
+	}
+	if screen.Colors, err = readVideoRegion(dp, video.RegionColor, cells); err != nil {
+		return nil, err
+	}
+	if screen.Font, err = readVideoRegion(dp, video.RegionFont, video.FontSize); err != nil {
+		return nil, err
+	}
+	lut, err := readVideoRegion(dp, video.RegionTextFGLUT, video.TextLUTSize)
+	if err != nil {
+		return nil, err
+	}
+	screen.Foreground = video.DecodeLUT(lut)
+	if lut, err = readVideoRegion(dp, video.RegionTextBGLUT, video.TextLUTSize); err != nil {
+		return nil, err
+	}
+	screen.Background = video.DecodeLUT(lut)
+
+	return screen.Render()
+}
+
+// captureBitmap reads and renders the bitmap
+func captureBitmap(dp *protocol.DebugPort) (image.Image, error) {
+	bitmap := &video.Bitmap{Width: screenshotWidth, Height: screenshotHeight}
+
+	var err error
+	if bitmap.Pixels, err = readVideoRegion(dp, video.RegionBitmap, uint32(screenshotWidth*screenshotHeight)); err != nil {
+		return nil, err
+	}
+	lut, err := readVideoRegion(dp, video.RegionBitmapLUT, video.BitmapLUTSize)
+	if err != nil {
+		return nil, err
+	}
+	bitmap.Palette = video.DecodeLUT(lut)
+
+	return bitmap.Render()
+}
+
+// readVideoRegion reads length bytes from the start of a machine region. A
+// region with a size must be large enough.
+func readVideoRegion(dp *protocol.DebugPort, name string, length uint32) ([]byte, error) {
+	region, err := cfg.MachineRegion(name)
+	if err != nil {
+		return nil, err
+	}
+	if region.Size != 0 && region.Size < length {
+		return nil, fmt.Errorf("the %s region is 0x%X bytes, 0x%X are needed", name, region.Size, length)
+	}
+
+	data, err := dp.ReadRange(region.Address, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
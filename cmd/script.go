@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/script"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// scriptCmd represents the batch script command
+var scriptCmd = &cobra.Command{
+	Use:   "script <file>",
+	Short: "Run a script of foenixmgr commands",
+	Long: `Run foenixmgr commands from a text file, one per line, over a single open
+connection. Debug mode is entered once and left when the script finishes.
+
+Each line is a foenixmgr command without the program name. Words containing
+spaces can be quoted. Lines starting with # are comments. Global flags given
+to 'script' (such as --port) apply to every command.
+
+Script statements:
+  set NAME VALUE       Set a variable, used as ${NAME}
+  echo TEXT            Print text
+  if A [OP B]          Run the following lines only if the condition holds;
+  else                 OP is one of == != < <= > >= or & (any bits in
+  endif                common). Numbers are hex.
+  sleep DURATION       Wait, e.g. 500ms or 2s
+  exit                 Stop the script successfully
+  fail [MESSAGE]       Stop the script with an error
+
+Built-in variables:
+  ${status0} ${status1}  Status bytes of the last debug port response (hex)
+  ${stopped}             1 if the CPU is stopped with 'stop', else 0
+
+The script stops at the first command that fails.
+
+Example script:
+  set ADDR 380000
+  upload-srec firmware.srec
+  compare firmware.bin --address ${ADDR}
+  if ${status1} & 80
+    fail "debug port reports an error"
+  endif
+  echo done
+
+Example:
+  foenixmgr script deploy.fnx --port /dev/ttyUSB0`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runScript(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scriptCmd)
+}
+
+// runScript parses and runs a script file
+func runScript(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open script: %w", err)
+	}
+	defer f.Close()
+
+	s, err := script.Parse(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	// Every command starts from the global flags given to 'script'
+	globals := saveFlags(rootCmd.PersistentFlags())
+
+	rn := &script.Runner{
+		Run: func(args []string) error {
+			return runScriptCommand(args, globals)
+		},
+		Lookup: scriptVariable,
+		Output: os.Stdout,
+	}
+
+	if err := rn.Execute(s); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// runScriptCommand runs one foenixmgr command in this process, so it uses the
+// shared session
+func runScriptCommand(args []string, globals map[string]savedFlag) error {
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		return err
+	}
+	if cmd.Name() == "script" || cmd.Name() == "monitor" || cmd.Parent() == macroCmd {
+		return fmt.Errorf("'%s' can't be used in a script", strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" "))
+	}
+
+	// Flag values would otherwise carry over from the previous command
+	resetFlags(cmd.NonInheritedFlags())
+	restoreFlags(rootCmd.PersistentFlags(), globals)
+
+	rootCmd.SetArgs(args)
+	return rootCmd.Execute()
+}
+
+// scriptVariable returns the value of a built-in script variable
+func scriptVariable(name string) (string, bool) {
+	switch name {
+	case "status0", "status1":
+		if session == nil {
+			return "00", true
+		}
+		dp := session.DebugPort()
+		if name == "status0" {
+			return fmt.Sprintf("%02X", dp.GetStatus0()), true
+		}
+		return fmt.Sprintf("%02X", dp.GetStatus1()), true
+	case "stopped":
+		if util.IsStopped(cfg.Port) {
+			return "1", true
+		}
+		return "0", true
+	}
+	return "", false
+}
+
+// savedFlag is the value of a flag saved by saveFlags
+type savedFlag struct {
+	value   string
+	changed bool
+}
+
+// saveFlags records the current values of a flag set
+func saveFlags(flags *pflag.FlagSet) map[string]savedFlag {
+	saved := make(map[string]savedFlag)
+	flags.VisitAll(func(f *pflag.Flag) {
+		saved[f.Name] = savedFlag{f.Value.String(), f.Changed}
+	})
+	return saved
+}
+
+// restoreFlags sets a flag set back to values recorded by saveFlags
+func restoreFlags(flags *pflag.FlagSet, saved map[string]savedFlag) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if s, ok := saved[f.Name]; ok {
+			f.Value.Set(s.value)
+			f.Changed = s.changed
+		}
+	})
+}
+
+// resetFlags sets every flag in a flag set back to its default value
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/daschewie/foenixmgr/pkg/webui"
+	"github.com/spf13/cobra"
+)
+
+// flashStageChunk is how much of a flash image is staged in RAM between
+// progress reports
+const flashStageChunk = 4096
+
+var serveListen string
+
+// serveCmd represents the web dashboard command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a web dashboard for the machine",
+	Long: `Serve a web dashboard for the machine on the debug port, so it can be
+managed from a browser. The dashboard has:
+  - A memory viewer with a hex dump, up to 4KB at a time
+  - An upload form for program files (PGX, PGZ, Intel HEX, S-record, ELF and
+    WDC, told by the file's extension)
+  - CPU stop and start buttons, on machines that support them
+  - Flash programming from a binary image staged in RAM, with its progress
+
+The page and its script are built into foenixmgr. The dashboard talks to a
+JSON API under /api/ that scripts can also use:
+  GET  /api/status                          Machine, CPU and job status
+  GET  /api/memory?address=HEX&length=N     Read memory
+  POST /api/cpu/stop, /api/cpu/start        Stop or start the CPU
+  POST /api/upload   (form: file)           Upload a program
+  POST /api/flash    (form: file, address)  Program the flash
+  GET  /metrics                             Prometheus metrics
+
+Uploads and flash programming run in the background; their progress is in
+the status. The machine does one thing at a time, and requests made while it
+is busy are refused.
+
+The dashboard has no authentication: anyone who can reach it can reprogram
+the flash. Listen on localhost (the default) or a trusted network only.
+
+The connection is held open, in debug mode, until the server is stopped with
+Ctrl+C. The CPU is then left stopped if it was stopped from the dashboard.
+
+Example:
+  foenixmgr serve --target f256k
+  foenixmgr serve --listen 0.0.0.0:8080 --port /dev/ttyUSB0`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWebServer()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListen, "listen", "localhost:8080", "Address to serve the dashboard on")
+}
+
+// runWebServer serves the dashboard until interrupted
+func runWebServer() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	target := &webTarget{&debugTarget{
+		dp:      dp,
+		canStop: checkCapability(protocol.CapStopCPU) == nil,
+		stopped: util.IsStopped(cfg.Port),
+	}}
+	info := webui.Info{Port: cfg.Port, CPU: cfg.CPU, CanStop: target.canStop}
+	if m := cfg.Machine(); m != nil {
+		info.Target = m.Name
+	}
+
+	listener, err := net.Listen("tcp", serveListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", serveListen, err)
+	}
+
+	dashboard := webui.NewServer(target, info, target.stopped)
+	dashboard.Logf = func(format string, args ...interface{}) {
+		printInfo(format+"\n", args...)
+	}
+	server := &http.Server{Handler: dashboard.Handler()}
+
+	interrupted := handleInterrupts()
+	go func() {
+		<-interrupted.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	printInfo("Serving the dashboard on http://%s/ (Ctrl+C to stop)\n", listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Let an upload or flash job finish, and leave a stopped CPU stopped
+	dashboard.Wait()
+	if target.stopped {
+		session.ReleaseDebug()
+	}
+	return nil
+}
+
+// webTarget adapts the debug port to the dashboard
+type webTarget struct {
+	*debugTarget
+}
+
+// Load uploads a program file, refusing it if it writes outside the target's
+// RAM, and points the reset vectors at its start address, when it has one
+func (t *webTarget) Load(filename string, report webui.ReportFunc) error {
+	format, err := loader.FormatForFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := checkFileWrites(filename, format); err != nil {
+		return err
+	}
+	ldr, err := loader.New(format, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := ldr.Open(filename); err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer ldr.Close()
+
+	written := 0
+	batch := t.dp.NewWriteBatch()
+	ldr.SetHandler(func(address uint32, data []byte) error {
+		if err := batch.Write(address, data); err != nil {
+			return err
+		}
+		written += len(data)
+		report("uploading", written, 0)
+		return nil
+	})
+	if err := ldr.Process(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	return setVectorsFromFile(ldr, t.dp.WriteBlock, false)
+}
+
+// Revision reads the debug port revision
+func (t *webTarget) Revision() (byte, error) {
+	return t.dp.GetRevision()
+}
+
+// LinkStats returns the debug port's exchange and error counts
+func (t *webTarget) LinkStats() protocol.LinkStats {
+	return t.dp.Stats()
+}
+
+// Flash stages an image in RAM, then erases and programs the flash from it
+func (t *webTarget) Flash(image []byte, ramAddress uint32, report webui.ReportFunc) error {
+	if len(image) > cfg.FlashSize {
+		return fmt.Errorf("image of %d bytes is larger than the %d byte flash", len(image), cfg.FlashSize)
+	}
+	if err := checkWrite(ramAddress, len(image), false, config.MemoryRAM); err != nil {
+		return err
+	}
+
+	for offset := 0; offset < len(image); offset += flashStageChunk {
+		report("uploading to RAM", offset, len(image))
+		chunk := image[offset:min(offset+flashStageChunk, len(image))]
+		if err := t.dp.WriteRange(ramAddress+uint32(offset), chunk); err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+	}
+
+	report("erasing", len(image), len(image))
+	if err := t.dp.EraseFlash(); err != nil {
+		return fmt.Errorf("flash erase failed: %w", err)
+	}
+	report("programming", len(image), len(image))
+	if err := t.dp.ProgramFlash(ramAddress); err != nil {
+		return fmt.Errorf("flash programming failed: %w", err)
+	}
+	return nil
+}
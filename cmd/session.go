@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/recording"
+	"github.com/daschewie/foenixmgr/pkg/util"
+)
+
+// session is the connection shared by every command run in this process.
+// It is opened on first use and closed once when the process finishes.
+var session *protocol.Session
+
+// openDebugPort returns the DebugPort of the shared session, opening the
+// connection the first time it is needed. If another foenixmgr process is
+// holding the port open with --keep-open, its session socket is used instead
+// of opening the port again.
+func openDebugPort() (*protocol.DebugPort, error) {
+	if session != nil {
+		return session.DebugPort(), nil
+	}
+
+	if err := validateConnectionFlags(); err != nil {
+		return nil, err
+	}
+	if dryRunFlag {
+		return openDryRun()
+	}
+
+	port := cfg.Port
+	if !keepOpenFlag {
+		if addr, ok := findSessionSocket(cfg.Port); ok {
+			port = addr
+		}
+	}
+
+	conn, err := startRecording(connection.NewConnection(port, cfg))
+	if err != nil {
+		return nil, err
+	}
+	if err := connection.OpenContext(interruptContext, conn, port); err != nil {
+		return nil, &protocol.Error{Kind: protocol.ErrConnection, Err: fmt.Errorf("failed to open connection: %w", err)}
+	}
+
+	session = protocol.NewSession(conn, cfg)
+	session.DebugPort().SetContext(portContext())
+	if err := startTrace(session.DebugPort()); err != nil {
+		return nil, err
+	}
+	return session.DebugPort(), nil
+}
+
+// openDryRun opens the shared session on a mock device and lists every
+// exchange instead of sending it to the hardware
+func openDryRun() (*protocol.DebugPort, error) {
+	conn := connection.NewMockConnection(cfg)
+	if err := conn.Open(connection.MockPrefix); err != nil {
+		return nil, err
+	}
+
+	session = protocol.NewSession(conn, cfg)
+	dp := session.DebugPort()
+	dp.SetContext(portContext())
+	dp.SetInstantFlash(true)
+	dp.SetTracer(protocol.NewTracerFunc(func(r protocol.TraceRecord) {
+		fmt.Printf("[dry run] %-14s  address %06X  length %04X\n", r.Name, r.Address, r.Length)
+	}))
+	printInfo("[dry run] Nothing is sent to the hardware; reads return the simulated device's memory, not the machine's.\n")
+	return dp, nil
+}
+
+// traceFile receives the protocol trace when --trace is given
+var traceFile *os.File
+
+// startTrace records the exchanges on dp in the --trace file, if one was
+// given. Records are appended, so a trace can span several invocations.
+func startTrace(dp *protocol.DebugPort) error {
+	if traceFlag == "" {
+		return nil
+	}
+	if traceFile == nil {
+		f, err := os.OpenFile(traceFlag, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open trace file: %w", err)
+		}
+		traceFile = f
+	}
+	dp.SetTracer(protocol.NewTracer(traceFile))
+	return nil
+}
+
+// closeTrace closes the --trace file
+func closeTrace() error {
+	if traceFile == nil {
+		return nil
+	}
+	err := traceFile.Close()
+	traceFile = nil
+	return err
+}
+
+// recordFile receives the session recording when --record is given
+var recordFile *os.File
+
+// startRecording wraps conn so that its traffic is recorded in the --record
+// file, if one was given. The file is replaced.
+func startRecording(conn connection.Connection) (connection.Connection, error) {
+	if recordFlag == "" {
+		return conn, nil
+	}
+	f, err := os.Create(recordFlag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	header := recording.Header{
+		Command:      os.Args[1:],
+		Port:         cfg.Port,
+		CPU:          cfg.CPU,
+		FlashSize:    cfg.FlashSize,
+		FlashAddress: cfg.FlashAddress,
+	}
+	if m := cfg.Machine(); m != nil {
+		header.Target = m.Name
+	}
+	recorder, err := recording.NewRecorder(conn, f, header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	recordFile = f
+	return recorder, nil
+}
+
+// closeRecording closes the --record file
+func closeRecording() error {
+	if recordFile == nil {
+		return nil
+	}
+	err := recordFile.Close()
+	recordFile = nil
+	return err
+}
+
+// enterDebug opens the shared session and puts the machine into debug mode,
+// unless the CPU has been stopped with the 'stop' command. Debug mode is left
+// again when the session is closed.
+func enterDebug() (*protocol.DebugPort, error) {
+	dp, err := openDebugPort()
+	if err != nil {
+		return nil, err
+	}
+
+	if !util.IsStopped(cfg.Port) {
+		if err := session.EnterDebug(); err != nil {
+			return nil, fmt.Errorf("failed to enter debug mode: %w", err)
+		}
+	}
+
+	return dp, nil
+}
+
+// closeSession leaves debug mode and closes the shared connection. With
+// --keep-open, and if the command succeeded after opening the connection, the
+// connection is instead served on a local session socket until the process
+// is interrupted.
+func closeSession(succeeded bool) error {
+	if keepOpenFlag && succeeded && session != nil {
+		return serveSession()
+	}
+
+	if session == nil {
+		return nil
+	}
+	// Leave debug mode even if the command was interrupted
+	session.DebugPort().SetContext(nil)
+	err := session.Close()
+	session = nil
+	return err
+}
+
+// serveSession relays the open connection to other foenixmgr invocations
+func serveSession() error {
+	if session.InDebug() {
+		if err := session.ExitDebug(); err != nil {
+			return fmt.Errorf("failed to exit debug mode: %w", err)
+		}
+	}
+
+	// The relay doesn't authenticate its clients, so it listens on a local
+	// socket in a directory only the user can open, not on a TCP port
+	socket, err := sessionSocketPath(cfg.Port)
+	if err == nil {
+		err = privateDir(filepath.Dir(socket))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open session socket: %w", err)
+	}
+	os.Remove(socket) // Left behind by a session that was killed
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to open session socket: %w", err)
+	}
+
+	// Clean up when interrupted
+	interrupted := handleInterrupts()
+	go func() {
+		<-interrupted.Done()
+		listener.Close()
+	}()
+
+	printInfo("Keeping %s open on %s (Ctrl+C to close)\n", cfg.Port, socket)
+	relay := connection.NewRelay(session.Connection())
+	relay.SetBusyWait(time.Duration(cfg.LockWait) * time.Second)
+	relay.Serve(listener)
+
+	os.Remove(socket)
+	err = session.Close()
+	session = nil
+	printInfo("Session closed.\n")
+	return err
+}
+
+// findSessionSocket returns the port string of a --keep-open session for
+// port, if one is running. Stale sockets are removed.
+func findSessionSocket(port string) (string, bool) {
+	socket, err := sessionSocketPath(port)
+	if err != nil {
+		return "", false
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return "", false
+	}
+
+	probe, err := net.Dial("unix", socket)
+	if err != nil {
+		os.Remove(socket)
+		return "", false
+	}
+	probe.Close()
+
+	return connection.SocketPrefix + socket, true
+}
+
+// sessionSocketPath returns the socket a --keep-open session for a port
+// listens on. It is in the user's cache directory rather than the shared
+// temporary directory, so only the user's own processes can connect to it.
+func sessionSocketPath(port string) (string, error) {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, port)
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "foenixmgr", "sessions", name+".sock"), nil
+}
+
+// privateDir creates a directory only the user can open, and takes away
+// other users' access to it if it already exists
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0700)
+}
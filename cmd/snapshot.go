@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/snapshot"
+	"github.com/spf13/cobra"
+)
+
+// snapshotRAMRegion is the machine region saved when no --region is given
+const snapshotRAMRegion = "ram"
+
+var (
+	snapshotRegions []string
+	snapshotForce   bool
+)
+
+// snapshotCmd represents the snapshot command group
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save and restore memory snapshots",
+	Long: `Save regions of target memory with the machine, CPU and time into a
+single archive, and write them back later.
+
+By default the target machine's ram region is saved, defined in its
+[machine.NAME] section of foenixmgr.ini, e.g. region.ram=000000,80000.
+
+Example:
+  foenixmgr snapshot save before.snap --target f256k
+  foenixmgr snapshot restore before.snap --target f256k`,
+}
+
+// snapshotSaveCmd represents the snapshot save command
+var snapshotSaveCmd = &cobra.Command{
+	Use:   "save <file>",
+	Short: "Save memory regions to a snapshot file",
+	Long: `Read memory regions and save them with metadata (machine, CPU and time)
+to a snapshot file. The file is a zip archive with a manifest.json and one
+binary file per region.
+
+Regions are given as ADDRESS,SIZE in hex with --region, which may be
+repeated. Without --region the target machine's ram region is saved.
+
+Example:
+  foenixmgr snapshot save before.snap --target f256k
+  foenixmgr snapshot save level.snap --region 010000,8000 --region 020000,4000`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return saveSnapshot(args[0])
+	},
+}
+
+// snapshotRestoreCmd represents the snapshot restore command
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Write a snapshot file back to memory",
+	Long: `Write the regions of a snapshot file back to memory. A snapshot taken on
+a different machine than the target is refused unless --force is given.
+
+Example:
+  foenixmgr snapshot restore before.snap --target f256k
+  foenixmgr snapshot restore before.snap --yes`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return restoreSnapshot(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+
+	snapshotSaveCmd.Flags().StringArrayVar(&snapshotRegions, "region", nil, "Region to save as ADDRESS,SIZE in hex (repeatable)")
+	snapshotRestoreCmd.Flags().BoolVar(&snapshotForce, "force", false, "Restore a snapshot taken on a different machine")
+}
+
+// snapshotTargetRegions returns the regions to save: the --region flags, or
+// the target machine's ram region
+func snapshotTargetRegions() ([]config.Region, error) {
+	if len(snapshotRegions) == 0 {
+		region, err := cfg.MachineRegion(snapshotRAMRegion)
+		if err != nil {
+			return nil, fmt.Errorf("%w, or use --region ADDRESS,SIZE", err)
+		}
+		if region.Size == 0 {
+			return nil, fmt.Errorf("the %s region has no size (set region.%s=ADDRESS,SIZE)", snapshotRAMRegion, snapshotRAMRegion)
+		}
+		return []config.Region{region}, nil
+	}
+
+	var regions []config.Region
+	for _, text := range snapshotRegions {
+		region, err := config.ParseRegion(text)
+		if err != nil {
+			return nil, err
+		}
+		if region.Size == 0 {
+			return nil, fmt.Errorf("region %s has no size (use ADDRESS,SIZE)", text)
+		}
+		regions = append(regions, region)
+	}
+	return regions, nil
+}
+
+// saveSnapshot reads the regions and writes them to a snapshot file
+func saveSnapshot(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	regions, err := snapshotTargetRegions()
+	if err != nil {
+		return err
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	snap := &snapshot.Snapshot{CPU: cfg.CPU, Created: time.Now().UTC()}
+	if m := cfg.Machine(); m != nil {
+		snap.Machine = m.Name
+	}
+
+	total := 0
+	for _, r := range regions {
+		total += int(r.Size)
+	}
+	done := 0
+	for _, r := range regions {
+		data, err := readWithProgress(dp, r.Address, r.Size, &done, total)
+		if err != nil {
+			return fmt.Errorf("failed to read %06X: %w", r.Address, err)
+		}
+		snap.Regions = append(snap.Regions, snapshot.Region{Address: r.Address, Data: data})
+	}
+
+	if dryRunFlag {
+		printInfo("Dry run: snapshot not written to %s.\n", filename)
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := snap.Write(&buf); err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	printInfo("Saved %d bytes in %d region(s) to %s.\n", total, len(regions), filename)
+	return nil
+}
+
+// readWithProgress reads a region a chunk at a time, updating the progress
+// of the whole snapshot
+func readWithProgress(dp *protocol.DebugPort, address, size uint32, done *int, total int) ([]byte, error) {
+	chunkSize := uint32(dp.ChunkSize())
+	data := make([]byte, 0, size)
+	for offset := uint32(0); offset < size; offset += chunkSize {
+		length := min(chunkSize, size-offset)
+		chunk, err := dp.ReadRange(address+offset, length)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+		*done += int(length)
+		printProgress("Reading", *done, total)
+	}
+	return data, nil
+}
+
+// restoreSnapshot writes the regions of a snapshot file back to memory
+func restoreSnapshot(filename string) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	snap, err := snapshot.Read(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if m := cfg.Machine(); m != nil && snap.Machine != "" && snap.Machine != m.Name && !snapshotForce {
+		return fmt.Errorf("snapshot was taken on %s, the target is %s (use --force to restore anyway)", snap.Machine, m.Name)
+	}
+
+	printInfo("Snapshot of %s (%s) taken %s: %d bytes in %d region(s).\n",
+		machineOrUnknown(snap.Machine), snap.CPU, snap.Created.Local().Format(time.DateTime), snap.Size(), len(snap.Regions))
+	ok, err := confirm("Overwrite target memory with the snapshot?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
+	}
+
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	total := snap.Size()
+	done := 0
+	chunkSize := dp.ChunkSize()
+	for _, r := range snap.Regions {
+		for offset := 0; offset < len(r.Data); offset += chunkSize {
+			end := min(offset+chunkSize, len(r.Data))
+			if err := dp.WriteRange(r.Address+uint32(offset), r.Data[offset:end]); err != nil {
+				return fmt.Errorf("failed to write %06X: %w", r.Address+uint32(offset), err)
+			}
+			done += end - offset
+			printProgress("Restoring", done, total)
+		}
+	}
+
+	printInfo("Snapshot restored.\n")
+	return nil
+}
+
+// machineOrUnknown names the machine a snapshot was taken on
+func machineOrUnknown(name string) string {
+	if name == "" {
+		return "unknown machine"
+	}
+	return name
+}
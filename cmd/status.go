@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// statusTimeout caps the read timeout while checking the connection, unless
+// --timeout is given, so a machine that doesn't answer is reported quickly
+const statusTimeout = 2
+
+var statusOffline bool
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the connection, target and stop state",
+	Long: `Show in one shot what is needed when something doesn't work: the
+foenixmgr.ini file in use, the port, target machine and CPU, whether the
+machine answers on the debug port, its revision and the optional commands the
+machine and revision support, and whether its CPU was left stopped in debug
+mode, e.g. with 'stop' or 'reset --into-debug'. Machines left stopped on other
+ports are listed too.
+
+The machine is asked for its revision without entering debug mode, so a
+running program isn't reset, and the answer is only waited for 2 seconds
+unless --timeout is given. With --offline the machine isn't contacted. The
+command fails if the machine doesn't answer.
+
+The stop state is kept per port in the user's config directory, so it is the
+same from every working directory.
+
+Example:
+  foenixmgr status
+  foenixmgr --port /dev/ttyUSB1 status --json
+  foenixmgr status --offline`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("timeout") && cfg.Timeout > statusTimeout {
+			cfg.Timeout = statusTimeout
+		}
+		return showStatus()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&statusOffline, "offline", false, "Don't contact the machine")
+}
+
+// deviceStatus is the result of checking the connection to the machine
+type deviceStatus struct {
+	Checked      bool
+	Err          error
+	Revision     byte
+	Capabilities protocol.Capabilities
+	Latency      time.Duration
+}
+
+// checkDevice asks the machine for its debug port revision, which tells its
+// capabilities, timing the round trip
+func checkDevice() deviceStatus {
+	dp, err := openDebugPort()
+	if err != nil {
+		return deviceStatus{Checked: true, Err: err}
+	}
+	start := time.Now()
+	caps, err := dp.Capabilities()
+	if err != nil {
+		return deviceStatus{Checked: true, Err: fmt.Errorf("no answer from the debug port: %w", err)}
+	}
+	rev, _ := caps.Revision()
+	return deviceStatus{Checked: true, Revision: rev, Capabilities: caps, Latency: time.Since(start)}
+}
+
+// showStatus prints the configuration, connection and stop states
+func showStatus() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	configPath, err := config.ConfigPath()
+	if err != nil {
+		configPath = ""
+	}
+
+	states, err := util.StoppedPorts()
+	if err != nil {
+		return fmt.Errorf("failed to read the stop state: %w", err)
+	}
+	var current *util.StopState
+	others := []util.StopState{}
+	for i := range states {
+		if states[i].Port == cfg.Port {
+			current = &states[i]
+		} else {
+			others = append(others, states[i])
+		}
+	}
+
+	target := ""
+	if m := cfg.Machine(); m != nil {
+		target = m.Name
+	}
+
+	var device deviceStatus
+	if !statusOffline {
+		device = checkDevice()
+	}
+
+	if jsonFlag {
+		if err := printStatusJSON(configPath, target, device, current, others); err != nil {
+			return err
+		}
+		if device.Err != nil {
+			return reportedError{device.Err}
+		}
+		return nil
+	}
+
+	if configPath == "" {
+		configPath = "none (built-in defaults)"
+	}
+	fmt.Printf("Config:     %s\n", configPath)
+	if p := cfg.Profile(); p != nil {
+		fmt.Printf("Profile:    %s\n", p.Name)
+	}
+	fmt.Printf("Port:       %s\n", cfg.Port)
+	if target != "" {
+		fmt.Printf("Target:     %s\n", target)
+	}
+	fmt.Printf("CPU:        %s\n", cfg.CPU)
+	switch {
+	case !device.Checked:
+		fmt.Printf("Connection: not checked\n")
+	case device.Err != nil:
+		fmt.Printf("Connection: FAILED (%v)\n", device.Err)
+	default:
+		fmt.Printf("Connection: OK (answered in %v)\n", device.Latency.Round(10*time.Microsecond))
+		fmt.Printf("Revision:   %X (%s)\n", device.Revision, protocol.RevisionName(device.Revision))
+		fmt.Printf("Supports:   %s\n", capabilityList(device.Capabilities.Supported()))
+	}
+	if current != nil {
+		fmt.Printf("State:      stopped since %s (use 'start' to resume)\n", formatStopTime(current.Since))
+	} else {
+		fmt.Printf("State:      running\n")
+	}
+
+	if len(others) > 0 {
+		fmt.Println("\nStopped on other ports:")
+		for _, s := range others {
+			fmt.Printf("  %-20s since %s\n", s.Port, formatStopTime(s.Since))
+		}
+	}
+	return device.Err
+}
+
+// printStatusJSON prints the status as a JSON document
+func printStatusJSON(configPath, target string, device deviceStatus, current *util.StopState, others []util.StopState) error {
+	type connectionJSON struct {
+		OK           bool                  `json:"ok"`
+		Error        string                `json:"error,omitempty"`
+		Revision     *byte                 `json:"revision,omitempty"`
+		Capabilities []protocol.Capability `json:"capabilities,omitempty"`
+		LatencyMS    float64               `json:"latency_ms,omitempty"`
+	}
+	var conn *connectionJSON
+	if device.Checked {
+		conn = &connectionJSON{OK: device.Err == nil}
+		if device.Err != nil {
+			conn.Error = device.Err.Error()
+		} else {
+			conn.Revision = &device.Revision
+			conn.Capabilities = device.Capabilities.Supported()
+			conn.LatencyMS = float64(device.Latency.Microseconds()) / 1000
+		}
+	}
+
+	profile := ""
+	if p := cfg.Profile(); p != nil {
+		profile = p.Name
+	}
+	var since *time.Time
+	if current != nil {
+		since = &current.Since
+	}
+	return printJSON(struct {
+		Config       string           `json:"config,omitempty"`
+		Profile      string           `json:"profile,omitempty"`
+		Port         string           `json:"port"`
+		Target       string           `json:"target,omitempty"`
+		CPU          string           `json:"cpu"`
+		Connection   *connectionJSON  `json:"connection,omitempty"`
+		Stopped      bool             `json:"stopped"`
+		StoppedSince *time.Time       `json:"stopped_since,omitempty"`
+		OtherStopped []util.StopState `json:"other_stopped"`
+	}{configPath, profile, cfg.Port, target, cfg.CPU, conn, current != nil, since, others})
+}
+
+// formatStopTime formats the time a CPU was stopped, which is unknown for
+// stop files not written by this version
+func formatStopTime(t time.Time) string {
+	if t.IsZero() {
+		return "an unknown time"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// capabilityList joins capabilities for display
+func capabilityList(capabilities []protocol.Capability) string {
+	if len(capabilities) == 0 {
+		return "no optional commands"
+	}
+	names := make([]string, len(capabilities))
+	for i, c := range capabilities {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// stepCmd represents the CPU single-step command
+var stepCmd = &cobra.Command{
+	Use:   "step [COUNT]",
+	Short: "Step a stopped CPU and show the PC (F256 only)",
+	Long: `Step a CPU stopped with the 'stop' command and report the new program
+counter after each step.
+
+The debug interface has no single-step command, so each step releases the CPU
+with a start command and immediately stops it again. Depending on the speed
+of the connection the CPU may execute more than one instruction per step.
+
+The PC is read from the register snapshot (see 'registers --help'), so the
+target must have a register_address set in its [machine.NAME] section and
+code of your own on the machine must write the snapshot there.
+
+Use 'continue' to let the CPU run freely again.
+
+Example:
+  foenixmgr stop
+  foenixmgr step
+  foenixmgr step 10
+  foenixmgr continue`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count := 1
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid step count: %s", args[0])
+			}
+			count = n
+		}
+		return stepCPU(count)
+	},
+}
+
+// continueCmd represents the CPU continue command
+var continueCmd = &cobra.Command{
+	Use:   "continue",
+	Short: "Continue execution of a stopped CPU (F256 only)",
+	Long: `Let a CPU stopped with the 'stop' command run freely again.
+
+This is the same as 'start' and ends a 'step' session.
+
+Example:
+  foenixmgr continue`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return startCPU()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stepCmd)
+	rootCmd.AddCommand(continueCmd)
+}
+
+// stepCPU pulses the CPU count times, printing the PC after each step
+func stepCPU(count int) error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if err := checkCapability(protocol.CapStopCPU); err != nil {
+		return err
+	}
+
+	if !util.IsStopped(cfg.Port) {
+		return fmt.Errorf("CPU is not stopped (use 'stop' first)")
+	}
+
+	address, err := registerAddress()
+	if err != nil {
+		return err
+	}
+
+	// Open the shared connection, already in debug mode while stopped
+	dp, err := openDebugPort()
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= count; i++ {
+		if err := dp.StartCPU(); err != nil {
+			return fmt.Errorf("failed to start CPU: %w", err)
+		}
+		if err := dp.StopCPU(); err != nil {
+			return fmt.Errorf("failed to stop CPU: %w", err)
+		}
+
+		regs, err := dp.ReadRegisters(address, cfg.CPU)
+		if err != nil {
+			return err
+		}
+
+		if jsonFlag {
+			if err := printJSONLine(struct {
+				Step  int    `json:"step"`
+				PC    uint32 `json:"pc"`
+				Flags string `json:"flags"`
+			}{i, regs.PC(), regs.Flags}); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Printf("Step %d: PC=%06X  %s\n", i, regs.PC(), regs.Flags)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// symbolsCmd represents the symbols command group
+var symbolsCmd = &cobra.Command{
+	Use:   "symbols",
+	Short: "List and search the labels of the label file",
+	Long: `List, search and reverse-look-up the labels of the label file given by
+--label-file or the labels setting in foenixmgr.ini. No connection to the
+hardware is needed.
+
+Example:
+  foenixmgr symbols list --label-file program.lbl
+  foenixmgr symbols grep '^player_' --label-file program.lbl
+  foenixmgr symbols at 01F2A3 --label-file program.lbl`,
+}
+
+// symbolsListCmd represents the symbols list command
+var symbolsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all labels by address",
+	Long: `List all labels of the label file sorted by address.
+
+Example:
+  foenixmgr symbols list --label-file program.lbl`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listSymbols(nil)
+	},
+}
+
+// symbolsGrepCmd represents the symbols grep command
+var symbolsGrepCmd = &cobra.Command{
+	Use:   "grep <pattern>",
+	Short: "List labels matching a regular expression",
+	Long: `List the labels whose names match a regular expression, sorted by address.
+The match is case-insensitive.
+
+Example:
+  foenixmgr symbols grep '^player_' --label-file program.lbl
+  foenixmgr symbols grep irq --label-file program.lbl`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern, err := regexp.Compile("(?i)" + args[0])
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		return listSymbols(pattern)
+	},
+}
+
+// symbolsAtCmd represents the symbols at command
+var symbolsAtCmd = &cobra.Command{
+	Use:   "at <address>",
+	Short: "Show the nearest label at or before an address",
+	Long: `Show the nearest label at or before a hex address, with the offset from it,
+e.g. player_update+0x13.
+
+Example:
+  foenixmgr symbols at 01F2A3 --label-file program.lbl`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return symbolAt(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(symbolsCmd)
+	symbolsCmd.AddCommand(symbolsListCmd)
+	symbolsCmd.AddCommand(symbolsGrepCmd)
+	symbolsCmd.AddCommand(symbolsAtCmd)
+}
+
+// requireLabels loads the label file, failing if there is none
+func requireLabels() (*util.LabelFile, error) {
+	labels, err := loadLabels()
+	if err != nil {
+		return nil, err
+	}
+	if labels == nil {
+		return nil, fmt.Errorf("no label file found (use --label-file or the labels setting)")
+	}
+	return labels, nil
+}
+
+// listSymbols prints the labels matching pattern, or all labels if it is nil
+func listSymbols(pattern *regexp.Regexp) error {
+	labels, err := requireLabels()
+	if err != nil {
+		return err
+	}
+
+	type symbol struct {
+		Name    string `json:"name"`
+		Address uint32 `json:"address"`
+	}
+	symbols := []symbol{}
+	for _, label := range labels.Labels() {
+		if pattern == nil || pattern.MatchString(label.Name) {
+			symbols = append(symbols, symbol{label.Name, label.Address})
+		}
+	}
+
+	if jsonFlag {
+		return printJSON(struct {
+			Format  string   `json:"format"`
+			Symbols []symbol `json:"symbols"`
+		}{labels.Format(), symbols})
+	}
+
+	for _, s := range symbols {
+		fmt.Printf("%06X  %s\n", s.Address, s.Name)
+	}
+	printInfo("%d of %d labels (%s format).\n", len(symbols), labels.Count(), labels.Format())
+	return nil
+}
+
+// symbolAt prints the nearest label at or before an address
+func symbolAt(addressText string) error {
+	address, err := resolveAddress(addressText)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	labels, err := requireLabels()
+	if err != nil {
+		return err
+	}
+
+	name, ok := labels.ReverseLookup(address)
+	if !ok {
+		return fmt.Errorf("no label at or before 0x%06X", address)
+	}
+
+	if jsonFlag {
+		return printJSON(struct {
+			Address uint32 `json:"address"`
+			Symbol  string `json:"symbol"`
+		}{address, name})
+	}
+	fmt.Printf("%06X <%s>\n", address, name)
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// targetsCmd represents the target machine listing command
+var targetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "List known target machines",
+	Long: `List the target machines that can be selected with --target or the
+target setting in foenixmgr.ini.
+
+Built-in machines can be adjusted, and new machines added, with [machine.NAME]
+sections in foenixmgr.ini.
+
+Example:
+  foenixmgr targets`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listTargets()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(targetsCmd)
+}
+
+// listTargets prints the parameters of every known machine
+func listTargets() error {
+	current := ""
+	if m := cfg.Machine(); m != nil {
+		current = m.Name
+	}
+
+	if jsonFlag {
+		return printTargetsJSON(current)
+	}
+
+	fmt.Printf("  %-10s %-6s %-8s %-8s %-8s %-5s %s\n", "NAME", "CPU", "FLASH", "SECTOR", "PAGE", "RAM", "COMMANDS")
+	for _, m := range cfg.Machines() {
+		marker := " "
+		if m.Name == current {
+			marker = "*"
+		}
+
+		fmt.Printf("%s %-10s %-6s %-8s %-8s %-8s %-5s %s\n",
+			marker,
+			m.Name,
+			orDash(m.CPU),
+			sizeOrDash(m.FlashSize/1024),
+			sizeOrDash(m.FlashSectorSize),
+			sizeOrDash(m.FlashPageSize),
+			sizeOrDash(m.RAMSize),
+			orDash(strings.Join(m.Commands, ",")))
+
+		if m.Description != "" {
+			fmt.Printf("  %-10s %s\n", "", m.Description)
+		}
+	}
+
+	return nil
+}
+
+// printTargetsJSON prints the known machines as JSON
+func printTargetsJSON(current string) error {
+	type machine struct {
+		Name            string   `json:"name"`
+		Description     string   `json:"description,omitempty"`
+		CPU             string   `json:"cpu,omitempty"`
+		FlashSize       int      `json:"flash_size,omitempty"`
+		FlashSectorSize int      `json:"flash_sector_size,omitempty"`
+		FlashPageSize   int      `json:"flash_page_size,omitempty"`
+		RAMSize         int      `json:"ram_size,omitempty"`
+		RegisterAddress string   `json:"register_address,omitempty"`
+		Commands        []string `json:"commands"`
+		Selected        bool     `json:"selected"`
+	}
+
+	machines := []machine{}
+	for _, m := range cfg.Machines() {
+		commands := m.Commands
+		if commands == nil {
+			commands = []string{}
+		}
+		machines = append(machines, machine{
+			Name:            m.Name,
+			Description:     m.Description,
+			CPU:             m.CPU,
+			FlashSize:       m.FlashSize,
+			FlashSectorSize: m.FlashSectorSize,
+			FlashPageSize:   m.FlashPageSize,
+			RAMSize:         m.RAMSize,
+			RegisterAddress: m.RegisterAddress,
+			Commands:        commands,
+			Selected:        m.Name == current,
+		})
+	}
+
+	return printJSON(struct {
+		Targets []machine `json:"targets"`
+	}{machines})
+}
+
+// orDash returns s, or "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sizeOrDash formats a size in KB, or "-" if it is zero
+func sizeOrDash(kb int) string {
+	if kb == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%dK", kb)
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/daschewie/foenixmgr/pkg/connection"
 	"github.com/spf13/cobra"
@@ -22,19 +24,37 @@ This is useful for:
 - Network-based tooling
 
 The TCP server will accept connections on the specified host:port and relay
-all debug port protocol messages to the configured serial port.
+all debug port protocol messages to the configured serial port. The serial
+port is opened once and kept open; requests from several clients are handled
+one at a time. If the port fails (e.g. the adapter is unplugged) it is
+reopened for the next request.
+
+So that two sessions don't interleave, one client at a time can be in a
+debug session, from entering debug mode until it exits debug mode or
+disconnects. Other clients' requests wait up to --lock-wait seconds for the
+session to end, then are refused with a "device busy" error.
+
+With --status-port, the bridge also serves its statistics (connected
+clients, packets relayed, serial errors and throughput) as JSON over HTTP at
+/status on that port, and as Prometheus metrics at /metrics. Use
+'bridge-status' to show them.
 
 Example:
   foenixmgr tcp-bridge localhost:2560
-  foenixmgr tcp-bridge 0.0.0.0:2560  # Listen on all interfaces`,
+  foenixmgr tcp-bridge 0.0.0.0:2560  # Listen on all interfaces
+  foenixmgr tcp-bridge 0.0.0.0:2560 --status-port 2561`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return startTcpBridge(args[0])
 	},
 }
 
+var bridgeStatusPort int
+
 func init() {
 	rootCmd.AddCommand(tcpBridgeCmd)
+
+	tcpBridgeCmd.Flags().IntVar(&bridgeStatusPort, "status-port", 0, "Serve bridge statistics over HTTP on this port (0 to disable)")
 }
 
 // startTcpBridge starts the TCP bridge server
@@ -42,6 +62,9 @@ func startTcpBridge(hostPort string) error {
 	if err := validateConnectionFlags(); err != nil {
 		return err
 	}
+	if err := resolvePort(); err != nil {
+		return err
+	}
 
 	// Parse host:port
 	parts := strings.Split(hostPort, ":")
@@ -60,5 +83,17 @@ func startTcpBridge(hostPort string) error {
 
 	// Create and start bridge
 	bridge := connection.NewBridge(host, port, cfg.Port, cfg.DataRate, cfg.Timeout)
+	bridge.SetBusyWait(time.Duration(cfg.LockWait) * time.Second)
+
+	if bridgeStatusPort != 0 {
+		statusAddr := net.JoinHostPort(host, strconv.Itoa(bridgeStatusPort))
+		printInfo("Serving bridge status on http://%s/status\n", statusAddr)
+		go func() {
+			if err := bridge.ServeStatus(statusAddr); err != nil {
+				printError("status endpoint: %v", err)
+			}
+		}()
+	}
+
 	return bridge.Listen()
 }
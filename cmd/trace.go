@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/spf13/cobra"
+)
+
+var traceErrorsOnly bool
+
+// traceCmd represents the protocol trace command group
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Work with protocol traces",
+	Long: `Work with protocol traces recorded with --trace.
+
+Any command run with --trace FILE appends a record of every request/response
+exchange with the debug port to FILE, one JSON object per line: the time,
+command, address, length, status bytes, whether the response LRC was valid,
+how long the exchange took and any error. Retried and failed exchanges are
+recorded too, which helps diagnose flaky boards and bridges.
+
+Example:
+  foenixmgr --trace session.trace upload program.hex
+  foenixmgr trace decode session.trace
+  foenixmgr trace decode session.trace --errors`,
+}
+
+// traceDecodeCmd pretty-prints a trace file
+var traceDecodeCmd = &cobra.Command{
+	Use:   "decode <file>",
+	Short: "Print a protocol trace as a readable listing",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return decodeTrace(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+	traceCmd.AddCommand(traceDecodeCmd)
+
+	traceDecodeCmd.Flags().BoolVar(&traceErrorsOnly, "errors", false, "Only show failed exchanges and bad checksums")
+}
+
+// decodeTrace prints the records of a trace file and a summary
+func decodeTrace(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %w", err)
+	}
+	defer f.Close()
+
+	records, err := protocol.ReadTrace(f)
+	if err != nil {
+		return fmt.Errorf("failed to read trace: %w", err)
+	}
+
+	var shown []protocol.TraceRecord
+	failed, badLRC := 0, 0
+	for _, r := range records {
+		bad := r.LRCValid != nil && !*r.LRCValid
+		if r.Error != "" {
+			failed++
+		}
+		if bad {
+			badLRC++
+		}
+		if !traceErrorsOnly || r.Error != "" || bad {
+			shown = append(shown, r)
+		}
+	}
+
+	if jsonFlag {
+		return printJSON(shown)
+	}
+
+	for _, r := range shown {
+		fmt.Println(r)
+	}
+	printInfo("%d exchanges, %d failed, %d with a bad LRC\n", len(records), failed, badLRC)
+	return nil
+}
@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"encoding/hex"
 	"fmt"
 
-	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/config"
 	"github.com/daschewie/foenixmgr/pkg/loader"
-	"github.com/daschewie/foenixmgr/pkg/protocol"
 	"github.com/daschewie/foenixmgr/pkg/util"
 	"github.com/spf13/cobra"
 )
 
-var uploadAddress string
+var (
+	uploadAddress    string
+	uploadSetVectors bool
+	uploadRun        bool
+	uploadSparse     string
+	uploadForce      bool
+
+	inputMaxSize string
+	inputSHA256  string
+)
 
 // uploadCmd represents the Intel HEX upload command
 var uploadCmd = &cobra.Command{
@@ -18,11 +27,15 @@ var uploadCmd = &cobra.Command{
 	Short: "Upload Intel HEX format file",
 	Long: `Upload a program in Intel HEX format to the Foenix hardware.
 
+With --set-vectors, the start address from a type 03 or 05 record is used
+to set up the CPU reset vectors, so the program runs when the CPU is reset.
+
 Example:
-  foenixmgr upload program.hex`,
+  foenixmgr upload program.hex
+  foenixmgr upload program.hex --set-vectors`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return uploadFile(args[0], "intelhex")
+		return uploadFile(args[0], loader.FormatIntelHex)
 	},
 }
 
@@ -32,11 +45,15 @@ var uploadSrecCmd = &cobra.Command{
 	Short: "Upload Motorola SREC format file",
 	Long: `Upload a program in Motorola SREC format to the Foenix hardware.
 
+With --set-vectors, the start address from the S7/S8/S9 record is used to
+set up the CPU reset vectors, so the program runs when the CPU is reset.
+
 Example:
-  foenixmgr upload-srec program.srec`,
+  foenixmgr upload-srec program.srec
+  foenixmgr upload-srec program.srec --set-vectors`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return uploadFile(args[0], "srec")
+		return uploadFile(args[0], loader.FormatSREC)
 	},
 }
 
@@ -50,7 +67,7 @@ Example:
   foenixmgr upload-wdc program.bin`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return uploadFile(args[0], "wdc")
+		return uploadFile(args[0], loader.FormatWDC)
 	},
 }
 
@@ -60,8 +77,17 @@ var binaryCmd = &cobra.Command{
 	Short: "Upload raw binary file to RAM",
 	Long: `Upload a raw binary file to the Foenix hardware at the specified address.
 
+With --sparse, long runs of the given byte are not sent. Use it when the
+target memory already holds that value, e.g. after 'fill'.
+
+The file can also be '-' for standard input or an http(s) URL, which is
+downloaded first. --max-size and --sha256 check it before anything is
+written.
+
 Example:
-  foenixmgr binary program.bin --address 380000`,
+  foenixmgr binary program.bin --address 380000
+  foenixmgr binary image.bin --address 10000 --sparse 00
+  foenixmgr binary https://ci.example.com/build/program.bin --address 380000 --sha256 <digest>`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return uploadBinary(args[0])
@@ -81,7 +107,7 @@ Example:
   foenixmgr run-pgx program.pgx`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return uploadFile(args[0], "pgx")
+		return uploadFile(args[0], loader.FormatPGX)
 	},
 }
 
@@ -92,12 +118,34 @@ var runPgzCmd = &cobra.Command{
 	Long: `Upload a PGZ format (compressed) executable and configure reset vectors.
 
 PGZ files can contain multiple data blocks and start address information.
+The file is read as a stream, so large images can come from a pipe with '-'
+as the file name, or from an http(s) URL.
+
+Example:
+  foenixmgr run-pgz program.pgz
+  cat image.pgz | foenixmgr run-pgz -
+  foenixmgr run-pgz https://ci.example.com/build/program.pgz --max-size 2M`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return uploadFile(args[0], loader.FormatPGZ)
+	},
+}
+
+// runElfCmd represents the ELF upload and run command
+var runElfCmd = &cobra.Command{
+	Use:   "run-elf <elffile>",
+	Short: "Upload and run ELF executable",
+	Long: `Upload a 32-bit ELF executable (such as GCC m68k output) and configure
+reset vectors to run it from its entry point.
+
+Every loadable segment is written at its physical address, with any
+uninitialized data (.bss) cleared to zero.
 
 Example:
-  foenixmgr run-pgz program.pgz`,
+  foenixmgr run-elf program.elf`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return uploadFile(args[0], "pgz")
+		return uploadFile(args[0], loader.FormatELF)
 	},
 }
 
@@ -126,6 +174,7 @@ func init() {
 	rootCmd.AddCommand(binaryCmd)
 	rootCmd.AddCommand(runPgxCmd)
 	rootCmd.AddCommand(runPgzCmd)
+	rootCmd.AddCommand(runElfCmd)
 	rootCmd.AddCommand(runM68kBinCmd)
 
 	// Add --address flag to commands that need it
@@ -134,6 +183,17 @@ func init() {
 
 	runM68kBinCmd.Flags().StringVar(&uploadAddress, "address", "", "Target address (hex, e.g., 380000)")
 	runM68kBinCmd.MarkFlagRequired("address")
+
+	// Add --run flag to every upload command
+	for _, c := range []*cobra.Command{uploadCmd, uploadSrecCmd, uploadWdcCmd, binaryCmd, runPgxCmd, runPgzCmd, runElfCmd, runM68kBinCmd} {
+		c.Flags().BoolVar(&uploadRun, "run", false, "Start the program immediately after uploading")
+		c.Flags().StringVar(&uploadSparse, "sparse", "", "Skip long runs of this byte (hex), which the target memory already holds")
+		c.Flags().BoolVar(&uploadForce, "force", false, "Write blocks that reach I/O, flash or unmapped memory of the target machine")
+		addInputFlags(c)
+	}
+
+	uploadCmd.Flags().BoolVar(&uploadSetVectors, "set-vectors", false, "Set reset vectors from the file's start address record")
+	uploadSrecCmd.Flags().BoolVar(&uploadSetVectors, "set-vectors", false, "Set reset vectors from the file's start address record")
 }
 
 // uploadFile is the common upload handler for all file formats
@@ -142,60 +202,136 @@ func uploadFile(filename string, format string) error {
 		return err
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	sparse, err := newSparseWriter()
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	opts, err := inputOptions()
+	if err != nil {
+		return err
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	if err := checkFileWrites(filename, format); err != nil {
+		return err
 	}
 
 	// Create appropriate loader
-	var ldr loader.Loader
-	switch format {
-	case "intelhex":
-		ldr = loader.NewIntelHexLoader()
-	case "srec":
-		ldr = loader.NewSRecLoader()
-	case "wdc":
-		ldr = loader.NewWDCLoader()
-	case "pgx":
-		ldr = loader.NewPGXLoader(cfg)
-	case "pgz":
-		ldr = loader.NewPGZLoader(cfg)
-	default:
-		return fmt.Errorf("unsupported format: %s", format)
-	}
-
-	// Open file
-	if err := ldr.Open(filename); err != nil {
+	ldr, err := loader.New(format, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Open the file, download it or start reading standard input before
+	// the CPU is stopped, so a missing file or a bad checksum leaves it
+	// running
+	input, err := util.OpenInput(filename, opts)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer input.Close()
+	if err := ldr.OpenReader(input); err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer ldr.Close()
 
-	// Set handler to write to debug port
-	ldr.SetHandler(func(address uint32, data []byte) error {
-		return dp.WriteBlock(address, data)
-	})
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	// Set handler to write to debug port, in whole chunks however the
+	// file splits its data into records
+	batch := dp.NewWriteBatch()
+	handler := sparse.wrap(batch.Write)
+	if util.IsStream(filename) {
+		// Standard input and URLs can only be read once, so their blocks are
+		// checked against the memory map as they are written
+		handler = checkedWrites(handler)
+	}
+	ldr.SetHandler(handler)
 
 	// Process file
 	printInfo("Uploading %s...\n", filename)
 	if err := ldr.Process(); err != nil {
 		return fmt.Errorf("upload failed: %w", err)
 	}
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	sparse.report()
+
+	// Point the reset vectors at the start address recorded in the file.
+	// --run uses it when there is one, --set-vectors requires it.
+	if uploadSetVectors || uploadRun {
+		if err := setVectorsFromFile(ldr, dp.WriteBlock, uploadSetVectors); err != nil {
+			return err
+		}
+	}
 
 	printInfo("Upload complete.\n")
+
+	if uploadRun {
+		return runUploadedProgram()
+	}
+	return nil
+}
+
+// checkFileWrites reads a file and checks every block it would write against
+// the target machine's memory map, so nothing is written if a block is refused
+func checkFileWrites(filename string, format string) error {
+	if m := cfg.Machine(); m == nil || len(m.MemoryMap) == 0 || util.IsStream(filename) {
+		return nil
+	}
+
+	ldr, err := loader.New(format, cfg)
+	if err != nil {
+		return err
+	}
+	if err := ldr.Open(filename); err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer ldr.Close()
+
+	ldr.SetHandler(func(address uint32, data []byte) error {
+		return checkWrite(address, len(data), uploadForce, config.MemoryRAM)
+	})
+	return ldr.Process()
+}
+
+// checkedWrites returns a handler that checks each block against the target
+// machine's memory map before passing it to handler
+func checkedWrites(handler loader.WriteHandler) loader.WriteHandler {
+	return func(address uint32, data []byte) error {
+		if err := checkWrite(address, len(data), uploadForce, config.MemoryRAM); err != nil {
+			return err
+		}
+		return handler(address, data)
+	}
+}
+
+// setVectorsFromFile sets up the reset vectors from the start address of a
+// loaded file. If the file has no start address this is an error when
+// required, and does nothing otherwise.
+func setVectorsFromFile(ldr loader.Loader, handler loader.WriteHandler, required bool) error {
+	var start uint32
+	found := false
+	if sa, ok := ldr.(loader.StartAddresser); ok {
+		start, found = sa.StartAddress()
+	}
+
+	if !found {
+		if required {
+			return fmt.Errorf("file has no start address record")
+		}
+		return nil
+	}
+
+	printInfo("Setting reset vectors to start address 0x%X\n", start)
+	if err := loader.SetupResetVectors(cfg.CPU, start, handler); err != nil {
+		return fmt.Errorf("failed to set up reset vectors: %w", err)
+	}
 	return nil
 }
 
@@ -206,51 +342,49 @@ func uploadBinary(filename string) error {
 	}
 
 	// Parse address
-	addr, err := util.ParseHexAddress(uploadAddress)
+	addr, err := resolveAddress(uploadAddress)
 	if err != nil {
 		return fmt.Errorf("invalid address: %w", err)
 	}
 
 	// Read binary file
-	data, err := util.ReadFile(filename)
+	data, err := readInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	sparse, err := newSparseWriter()
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	if err := checkWrite(addr, len(data), uploadForce, config.MemoryRAM); err != nil {
+		return err
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
 
 	// Upload binary in chunks (matching Python behavior)
 	printInfo("Uploading %d bytes to 0x%X...\n", len(data), addr)
-	chunkSize := cfg.ChunkSize
-	for offset := 0; offset < len(data); offset += chunkSize {
-		end := offset + chunkSize
-		if end > len(data) {
-			end = len(data)
-		}
-		chunk := data[offset:end]
-		if err := dp.WriteBlock(addr+uint32(offset), chunk); err != nil {
-			return fmt.Errorf("upload failed at offset 0x%X: %w", offset, err)
-		}
+	if err := sparse.wrap(dp.WriteRange)(addr, data); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
 	}
+	sparse.report()
 
 	printInfo("Upload complete.\n")
+
+	// The program starts at the address it was loaded to
+	if uploadRun {
+		printInfo("Setting reset vectors to start address 0x%X\n", addr)
+		if err := loader.SetupResetVectors(cfg.CPU, addr, dp.WriteBlock); err != nil {
+			return fmt.Errorf("failed to set up reset vectors: %w", err)
+		}
+		return runUploadedProgram()
+	}
 	return nil
 }
 
@@ -261,54 +395,43 @@ func uploadM68kBinary(filename string) error {
 	}
 
 	// Parse address
-	addr, err := util.ParseHexAddress(uploadAddress)
+	addr, err := resolveAddress(uploadAddress)
 	if err != nil {
 		return fmt.Errorf("invalid address: %w", err)
 	}
 
 	// Read binary file
-	data, err := util.ReadFile(filename)
+	data, err := readInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
 
-	// Verify file has at least 8 bytes (for stack pointer + reset vector)
-	if len(data) < 8 {
-		return fmt.Errorf("binary file too small (need at least 8 bytes for vectors)")
+	sparse, err := newSparseWriter()
+	if err != nil {
+		return err
 	}
 
-	// Create connection
-	conn := connection.NewConnection(cfg.Port)
-	if err := conn.Open(cfg.Port); err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+	if err := checkWrite(addr, len(data), uploadForce, config.MemoryRAM); err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	// Create protocol handler
-	dp := protocol.NewDebugPort(conn, cfg)
+	// Verify file has at least 8 bytes (for stack pointer + reset vector)
+	if len(data) < 8 {
+		return fmt.Errorf("binary file too small (need at least 8 bytes for vectors)")
+	}
 
-	// Enter debug mode
-	isStopped := util.IsStopped()
-	if !isStopped {
-		if err := dp.EnterDebug(); err != nil {
-			return fmt.Errorf("failed to enter debug mode: %w", err)
-		}
-		defer dp.ExitDebug()
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
 	}
 
 	// Upload binary to target address in chunks
 	printInfo("Uploading %d bytes to 0x%X...\n", len(data), addr)
-	chunkSize := cfg.ChunkSize
-	for offset := 0; offset < len(data); offset += chunkSize {
-		end := offset + chunkSize
-		if end > len(data) {
-			end = len(data)
-		}
-		chunk := data[offset:end]
-		if err := dp.WriteBlock(addr+uint32(offset), chunk); err != nil {
-			return fmt.Errorf("upload failed at offset 0x%X: %w", offset, err)
-		}
+	if err := sparse.wrap(dp.WriteRange)(addr, data); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
 	}
+	sparse.report()
 
 	// Copy first 8 bytes (initial SP and reset vector) to address 0
 	printInfo("Setting up reset vectors at address 0...\n")
@@ -317,5 +440,100 @@ func uploadM68kBinary(filename string) error {
 	}
 
 	printInfo("Upload complete. Binary will start at 0x%X on CPU reset.\n", addr)
+
+	if uploadRun {
+		return runUploadedProgram()
+	}
+	return nil
+}
+
+// addInputFlags adds the flags that limit and check a file read from
+// standard input or a URL
+func addInputFlags(c *cobra.Command) {
+	c.Flags().StringVar(&inputMaxSize, "max-size", "", "Refuse a file larger than this many bytes (K, M or G suffix; default 64M for - and URLs)")
+	c.Flags().StringVar(&inputSHA256, "sha256", "", "Refuse a file whose SHA-256 digest (hex) doesn't match")
+}
+
+// inputOptions returns the options for reading a file from the --max-size
+// and --sha256 flags
+func inputOptions() (util.InputOptions, error) {
+	var opts util.InputOptions
+	if inputMaxSize != "" {
+		size, err := util.ParseByteSize(inputMaxSize)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --max-size: %w", err)
+		}
+		opts.MaxSize = size
+	}
+	if inputSHA256 != "" {
+		if len(inputSHA256) != 64 {
+			return opts, fmt.Errorf("invalid --sha256 '%s': expected 64 hex digits", inputSHA256)
+		}
+		if _, err := hex.DecodeString(inputSHA256); err != nil {
+			return opts, fmt.Errorf("invalid --sha256 '%s': expected 64 hex digits", inputSHA256)
+		}
+		opts.SHA256 = inputSHA256
+	}
+	return opts, nil
+}
+
+// readInput reads a whole file, standard input or URL with the --max-size
+// and --sha256 options
+func readInput(filename string) ([]byte, error) {
+	opts, err := inputOptions()
+	if err != nil {
+		return nil, err
+	}
+	return util.ReadInput(filename, opts)
+}
+
+// uploadSparseWriter leaves runs of the --sparse byte out of an upload. A nil
+// writer passes everything through.
+type uploadSparseWriter struct {
+	*loader.SparseWriter
+}
+
+// newSparseWriter returns the writer for the --sparse flag
+func newSparseWriter() (*uploadSparseWriter, error) {
+	if uploadSparse == "" {
+		return nil, nil
+	}
+	value, err := util.ParseHexBytes(uploadSparse)
+	if err != nil || len(value) != 1 {
+		return nil, fmt.Errorf("invalid --sparse value '%s': expected one hex byte, e.g. 00 or FF", uploadSparse)
+	}
+	return &uploadSparseWriter{&loader.SparseWriter{Skip: value[0]}}, nil
+}
+
+// wrap returns a handler that writes through handler, skipping runs when
+// --sparse is set
+func (s *uploadSparseWriter) wrap(handler loader.WriteHandler) loader.WriteHandler {
+	if s == nil {
+		return handler
+	}
+	s.Handler = handler
+	return s.Write
+}
+
+// report prints how much of the upload was skipped
+func (s *uploadSparseWriter) report() {
+	if s == nil {
+		return
+	}
+	printInfo("Sent %d bytes, skipped %d bytes of $%02X\n", s.Written, s.Skipped, s.Skip)
+}
+
+// runUploadedProgram leaves debug mode so the CPU resets into the uploaded
+// program. A CPU stopped with the 'stop' command is started again.
+func runUploadedProgram() error {
+	if util.IsStopped(cfg.Port) {
+		return startCPU()
+	}
+
+	if err := session.ExitDebug(); err != nil {
+		return fmt.Errorf("failed to exit debug mode: %w", err)
+	}
+
+	printInfo("Program running.\n")
 	return nil
 }
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchAddress  string
+	watchCount    string
+	watchInterval time.Duration
+)
+
+// watchCmd represents the memory watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Poll a memory region and show changes",
+	Long: `Read a block of memory repeatedly and print the bytes that changed since
+the previous read, until interrupted with Ctrl+C.
+
+The whole region is dumped once, then only lines with changes are printed.
+On a terminal changed bytes are highlighted; otherwise unchanged bytes are
+shown as "..".
+
+The machine is in debug mode while watching, which holds the CPU, so only
+changes made by hardware are seen. To watch a running program on machines
+with stop/start support, stop the CPU first: watch then lets the CPU run for
+each interval and stops it again to read the region.
+
+Example:
+  foenixmgr watch --address 380000 --count 20
+  foenixmgr stop && foenixmgr watch --address 0 --count 100 --interval 1s`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return watchMemory()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVar(&watchAddress, "address", "", "Starting address (hex) or label")
+	watchCmd.Flags().StringVar(&watchCount, "count", "10", "Number of bytes to watch (hex)")
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 500*time.Millisecond, "Time between reads")
+}
+
+// watchMemory polls memory and prints changes until interrupted
+func watchMemory() error {
+	if err := validateConnectionFlags(); err != nil {
+		return err
+	}
+
+	if watchAddress == "" {
+		watchAddress = cfg.Address
+	}
+
+	addr, err := resolveAddress(watchAddress)
+	if err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+
+	count, err := util.ParseHexCount(watchCount)
+	if err != nil {
+		return fmt.Errorf("invalid count: %w", err)
+	}
+
+	if watchInterval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	// A stopped CPU is released for each interval, so a running program can
+	// be observed
+	pulse := util.IsStopped(cfg.Port)
+
+	// Open the shared connection and enter debug mode
+	dp, err := enterDebug()
+	if err != nil {
+		return err
+	}
+
+	previous, err := dp.ReadRange(addr, count)
+	if err != nil {
+		return fmt.Errorf("failed to read memory: %w", err)
+	}
+	if jsonFlag {
+		if err := printJSONLine(struct {
+			Time string `json:"time"`
+			memoryJSON
+		}{time.Now().Format(time.RFC3339Nano), newMemoryJSON(addr, previous)}); err != nil {
+			return err
+		}
+	} else {
+		util.HexDump(previous, addr)
+	}
+
+	ctx := handleInterrupts()
+
+	highlight := util.IsTerminal(os.Stdout)
+	for {
+		if pulse {
+			if err := dp.StartCPU(); err != nil {
+				return fmt.Errorf("failed to start CPU: %w", err)
+			}
+		}
+
+		interrupted := false
+		select {
+		case <-ctx.Done():
+			interrupted = true
+		case <-time.After(watchInterval):
+		}
+
+		if pulse {
+			if err := dp.StopCPU(); err != nil {
+				return fmt.Errorf("failed to stop CPU: %w", err)
+			}
+		}
+		if interrupted {
+			return nil
+		}
+
+		current, err := dp.ReadRange(addr, count)
+		if err != nil {
+			return fmt.Errorf("failed to read memory: %w", err)
+		}
+
+		if jsonFlag {
+			if err := printWatchChanges(previous, current, addr); err != nil {
+				return err
+			}
+		} else {
+			timestamp := time.Now().Format("15:04:05.000")
+			for _, line := range util.DiffLines(previous, current, addr, highlight) {
+				fmt.Printf("%s %s\n", timestamp, line)
+			}
+		}
+		previous = current
+	}
+}
+
+// printWatchChanges prints the bytes that changed between two reads as a JSON
+// line. Nothing is printed if nothing changed.
+func printWatchChanges(previous, current []byte, addr uint32) error {
+	type change struct {
+		Address uint32 `json:"address"`
+		Old     byte   `json:"old"`
+		New     byte   `json:"new"`
+	}
+
+	var changes []change
+	for i := range current {
+		if previous[i] != current[i] {
+			changes = append(changes, change{addr + uint32(i), previous[i], current[i]})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return printJSONLine(struct {
+		Time    string   `json:"time"`
+		Changes []change `json:"changes"`
+	}{time.Now().Format(time.RFC3339Nano), changes})
+}
@@ -0,0 +1,174 @@
+// Package audio decodes sound files (VGM register logs and WAV samples) into
+// the register writes and PCM data played on Foenix audio hardware
+package audio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// VGMSampleRate is the rate of the wait times in a VGM file
+const VGMSampleRate = 44100
+
+// Chip identifies the sound chip a register write is for
+type Chip int
+
+const (
+	ChipPSG  Chip = iota // SN76489
+	ChipOPL3             // YMF262 (YM3812 writes are played on it too)
+)
+
+// Write is one register write of a VGM file
+type Write struct {
+	At       uint64 // Time of the write in samples at VGMSampleRate
+	Chip     Chip
+	Port     byte // OPL3 register bank (0 or 1)
+	Register byte // OPL3 register; unused for the PSG
+	Value    byte
+}
+
+// Song is the register writes of a VGM file
+type Song struct {
+	Writes  []Write
+	Length  uint64 // Samples to the end of the song
+	Skipped int    // Writes for chips that can't be played
+}
+
+// vgmMagic starts every VGM file
+var vgmMagic = []byte("Vgm ")
+
+// IsVGM returns true if data is a VGM file, or a gzip compressed VGZ file
+func IsVGM(data []byte) bool {
+	return bytes.HasPrefix(data, vgmMagic) || bytes.HasPrefix(data, []byte{0x1F, 0x8B})
+}
+
+// ParseVGM decodes a VGM or VGZ file. Writes to the SN76489, YMF262 and
+// YM3812 are kept; writes to other chips are counted in Skipped.
+func ParseVGM(data []byte) (*Song, error) {
+	if bytes.HasPrefix(data, []byte{0x1F, 0x8B}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid VGZ file: %w", err)
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("invalid VGZ file: %w", err)
+		}
+	}
+
+	if len(data) < 0x40 || !bytes.HasPrefix(data, vgmMagic) {
+		return nil, fmt.Errorf("not a VGM file")
+	}
+
+	// Before version 1.50 the data always starts at 0x40
+	start := 0x40
+	if version := binary.LittleEndian.Uint32(data[0x08:]); version >= 0x150 {
+		if offset := binary.LittleEndian.Uint32(data[0x34:]); offset != 0 {
+			start = 0x34 + int(offset)
+		}
+	}
+	if start > len(data) {
+		return nil, fmt.Errorf("VGM data offset 0x%X is beyond the end of the file", start)
+	}
+
+	song := &Song{}
+	var at uint64
+	pos := start
+
+	// operands returns the n bytes after the command, failing at the end of
+	// the data
+	operands := func(n int) ([]byte, error) {
+		if pos+1+n > len(data) {
+			return nil, fmt.Errorf("VGM command 0x%02X at 0x%X is truncated", data[pos], pos)
+		}
+		return data[pos+1 : pos+1+n], nil
+	}
+
+	for pos < len(data) {
+		command := data[pos]
+		size := 1 // Bytes in the command, including operands
+
+		switch {
+		case command == 0x66: // End of sound data
+			song.Length = at
+			return song, nil
+
+		case command == 0x50: // SN76489 write
+			op, err := operands(1)
+			if err != nil {
+				return nil, err
+			}
+			song.Writes = append(song.Writes, Write{At: at, Chip: ChipPSG, Value: op[0]})
+			size = 2
+
+		case command == 0x5A || command == 0x5E || command == 0x5F: // YM3812, YMF262 port 0 and 1
+			op, err := operands(2)
+			if err != nil {
+				return nil, err
+			}
+			var port byte
+			if command == 0x5F {
+				port = 1
+			}
+			song.Writes = append(song.Writes, Write{At: at, Chip: ChipOPL3, Port: port, Register: op[0], Value: op[1]})
+			size = 3
+
+		case command == 0x61: // Wait n samples
+			op, err := operands(2)
+			if err != nil {
+				return nil, err
+			}
+			at += uint64(binary.LittleEndian.Uint16(op))
+			size = 3
+
+		case command == 0x62: // Wait one 60Hz frame
+			at += 735
+
+		case command == 0x63: // Wait one 50Hz frame
+			at += 882
+
+		case command >= 0x70 && command <= 0x7F: // Short wait
+			at += uint64(command&0x0F) + 1
+
+		case command >= 0x80 && command <= 0x8F: // YM2612 DAC write and wait
+			song.Skipped++
+			at += uint64(command & 0x0F)
+
+		case command == 0x67: // Data block: 0x67 0x66 type size32 data
+			op, err := operands(6)
+			if err != nil {
+				return nil, err
+			}
+			size = 7 + int(binary.LittleEndian.Uint32(op[2:]))
+
+		case command == 0x4F || (command >= 0x30 && command <= 0x3F): // One operand
+			song.Skipped++
+			size = 2
+
+		case command >= 0x40 && command <= 0x5F, command >= 0xA0 && command <= 0xBF: // Two operands
+			song.Skipped++
+			size = 3
+
+		case command >= 0xC0 && command <= 0xDF: // Three operands
+			song.Skipped++
+			size = 4
+
+		case command >= 0xE0: // Four operands
+			if command != 0xE0 {
+				song.Skipped++
+			}
+			size = 5
+
+		default:
+			return nil, fmt.Errorf("unknown VGM command 0x%02X at 0x%X", command, pos)
+		}
+
+		pos += size
+	}
+
+	// Files without an end command stop at the end of the data
+	song.Length = at
+	return song, nil
+}
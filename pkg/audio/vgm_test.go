@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+)
+
+// vgmFile builds a version 1.50 VGM file around the command data
+func vgmFile(commands ...byte) []byte {
+	header := make([]byte, 0x40)
+	copy(header, vgmMagic)
+	binary.LittleEndian.PutUint32(header[0x08:], 0x150)
+	binary.LittleEndian.PutUint32(header[0x34:], 0x0C) // Data at 0x40
+	return append(header, commands...)
+}
+
+func TestParseVGM(t *testing.T) {
+	data := vgmFile(
+		0x50, 0x9F, // PSG write
+		0x62,             // Wait 735
+		0x5E, 0x20, 0x01, // OPL3 port 0
+		0x71,             // Wait 2
+		0x5F, 0x05, 0x01, // OPL3 port 1
+		0x52, 0x28, 0x00, // YM2612, skipped
+		0x61, 0x10, 0x00, // Wait 16
+		0x66,
+	)
+
+	song, err := ParseVGM(data)
+	if err != nil {
+		t.Fatalf("ParseVGM() error: %v", err)
+	}
+
+	want := []Write{
+		{At: 0, Chip: ChipPSG, Value: 0x9F},
+		{At: 735, Chip: ChipOPL3, Port: 0, Register: 0x20, Value: 0x01},
+		{At: 737, Chip: ChipOPL3, Port: 1, Register: 0x05, Value: 0x01},
+	}
+	if len(song.Writes) != len(want) {
+		t.Fatalf("got %d writes, want %d: %+v", len(song.Writes), len(want), song.Writes)
+	}
+	for i := range want {
+		if song.Writes[i] != want[i] {
+			t.Errorf("write %d = %+v, want %+v", i, song.Writes[i], want[i])
+		}
+	}
+	if song.Length != 753 || song.Skipped != 1 {
+		t.Errorf("length %d, skipped %d; want 753, 1", song.Length, song.Skipped)
+	}
+}
+
+func TestParseVGZ(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(vgmFile(0x50, 0x80, 0x66))
+	w.Close()
+
+	if !IsVGM(buf.Bytes()) {
+		t.Error("IsVGM() = false for a VGZ file")
+	}
+	song, err := ParseVGM(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseVGM() error: %v", err)
+	}
+	if len(song.Writes) != 1 || song.Writes[0].Value != 0x80 {
+		t.Errorf("writes = %+v", song.Writes)
+	}
+}
+
+func TestParseVGMErrors(t *testing.T) {
+	if _, err := ParseVGM([]byte("RIFF")); err == nil {
+		t.Error("expected error for non-VGM data")
+	}
+	if _, err := ParseVGM(vgmFile(0x61, 0x10)); err == nil {
+		t.Error("expected error for truncated wait")
+	}
+}
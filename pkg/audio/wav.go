@@ -0,0 +1,84 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// PCM is mono 8-bit unsigned sample data
+type PCM struct {
+	Rate    int // Samples per second
+	Samples []byte
+}
+
+// IsWAV returns true if data is a RIFF WAVE file
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+}
+
+// DecodeWAV decodes an uncompressed 8 or 16-bit PCM WAV file, mixing stereo
+// down to mono and converting samples to 8-bit unsigned
+func DecodeWAV(data []byte) (*PCM, error) {
+	if !IsWAV(data) {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+
+	var format, channels, bits uint16
+	var rate uint32
+	var samples []byte
+	haveFormat := false
+
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		body := data[pos+8:]
+		if size > len(body) {
+			size = len(body) // Truncated file, use what there is
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("invalid WAV format chunk")
+			}
+			format = binary.LittleEndian.Uint16(body[0:])
+			channels = binary.LittleEndian.Uint16(body[2:])
+			rate = binary.LittleEndian.Uint32(body[4:])
+			bits = binary.LittleEndian.Uint16(body[14:])
+			haveFormat = true
+		case "data":
+			samples = body
+		}
+
+		// Chunks are padded to an even size
+		pos += 8 + size + size&1
+	}
+
+	if !haveFormat {
+		return nil, fmt.Errorf("WAV file has no format chunk")
+	}
+	if format != 1 {
+		return nil, fmt.Errorf("unsupported WAV encoding %d (only PCM is supported)", format)
+	}
+	if channels < 1 || channels > 2 || (bits != 8 && bits != 16) {
+		return nil, fmt.Errorf("unsupported WAV format: %d channels of %d bits (mono or stereo 8 or 16-bit is supported)", channels, bits)
+	}
+
+	frameSize := int(channels) * int(bits) / 8
+	pcm := &PCM{Rate: int(rate), Samples: make([]byte, len(samples)/frameSize)}
+	for i := range pcm.Samples {
+		frame := samples[i*frameSize:]
+		sum := 0
+		for c := 0; c < int(channels); c++ {
+			if bits == 8 {
+				sum += int(frame[c]) - 128
+			} else {
+				sum += int(int16(binary.LittleEndian.Uint16(frame[c*2:]))) >> 8
+			}
+		}
+		pcm.Samples[i] = byte(sum/int(channels) + 128)
+	}
+	return pcm, nil
+}
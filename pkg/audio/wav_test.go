@@ -0,0 +1,55 @@
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// wavFile builds a PCM WAV file
+func wavFile(channels, bits uint16, rate uint32, samples []byte) []byte {
+	var data []byte
+	data = append(data, "RIFF"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(36+len(samples)))
+	data = append(data, "WAVEfmt "...)
+	data = binary.LittleEndian.AppendUint32(data, 16)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, channels)
+	data = binary.LittleEndian.AppendUint32(data, rate)
+	data = binary.LittleEndian.AppendUint32(data, rate*uint32(channels*bits/8))
+	data = binary.LittleEndian.AppendUint16(data, channels*bits/8)
+	data = binary.LittleEndian.AppendUint16(data, bits)
+	data = append(data, "data"...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(samples)))
+	return append(data, samples...)
+}
+
+func TestDecodeWAV8BitMono(t *testing.T) {
+	pcm, err := DecodeWAV(wavFile(1, 8, 8000, []byte{0x00, 0x80, 0xFF}))
+	if err != nil {
+		t.Fatalf("DecodeWAV() error: %v", err)
+	}
+	if pcm.Rate != 8000 || string(pcm.Samples) != "\x00\x80\xFF" {
+		t.Errorf("pcm = %d Hz % X", pcm.Rate, pcm.Samples)
+	}
+}
+
+func TestDecodeWAV16BitStereo(t *testing.T) {
+	// Two frames: full positive on both channels, then silence and negative
+	samples := []byte{0xFF, 0x7F, 0xFF, 0x7F, 0x00, 0x00, 0x00, 0x80}
+	pcm, err := DecodeWAV(wavFile(2, 16, 22050, samples))
+	if err != nil {
+		t.Fatalf("DecodeWAV() error: %v", err)
+	}
+	if len(pcm.Samples) != 2 || pcm.Samples[0] != 0xFF || pcm.Samples[1] != 0x40 {
+		t.Errorf("samples = % X, want FF 40", pcm.Samples)
+	}
+}
+
+func TestDecodeWAVErrors(t *testing.T) {
+	if _, err := DecodeWAV([]byte("Vgm ")); err == nil {
+		t.Error("expected error for non-WAV data")
+	}
+	if _, err := DecodeWAV(wavFile(1, 24, 8000, nil)); err == nil {
+		t.Error("expected error for 24-bit samples")
+	}
+}
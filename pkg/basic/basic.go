@@ -0,0 +1,51 @@
+// Package basic prepares BASIC programs to be loaded by the machine's own
+// BASIC, which tokenizes the program text itself, such as SuperBASIC's XLOAD
+// and XGO commands on the F256
+package basic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Terminator ends the program text in memory
+const Terminator = 0x00
+
+// utf8BOM is the byte order mark some editors start UTF-8 files with
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Prepare returns the program text as it is written to the machine: without a
+// byte order mark, ending with a line break and the Terminator. The line
+// breaks are kept as they are. Text with a NUL byte, such as a program saved
+// tokenized, is refused.
+func Prepare(source []byte) ([]byte, error) {
+	text := bytes.TrimPrefix(source, utf8BOM)
+	if i := bytes.IndexByte(text, 0); i >= 0 {
+		return nil, fmt.Errorf("NUL byte at offset %d: not a BASIC program in text form", i+len(source)-len(text))
+	}
+	if len(bytes.TrimSpace(text)) == 0 {
+		return nil, errors.New("the program is empty")
+	}
+
+	prepared := append([]byte(nil), text...)
+	if last := prepared[len(prepared)-1]; last != '\n' && last != '\r' {
+		if bytes.Contains(prepared, []byte("\r\n")) {
+			prepared = append(prepared, '\r', '\n')
+		} else {
+			prepared = append(prepared, '\n')
+		}
+	}
+	return append(prepared, Terminator), nil
+}
+
+// Lines counts the program lines that aren't blank
+func Lines(text []byte) int {
+	count := 0
+	for _, line := range bytes.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if len(bytes.TrimSpace(line)) > 0 && !bytes.Equal(line, []byte{Terminator}) {
+			count++
+		}
+	}
+	return count
+}
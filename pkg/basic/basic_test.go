@@ -0,0 +1,47 @@
+package basic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepare(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"unix lines", "10 print \"hi\"\n20 goto 10\n", "10 print \"hi\"\n20 goto 10\n\x00"},
+		{"no final line break", "10 print \"hi\"\n20 goto 10", "10 print \"hi\"\n20 goto 10\n\x00"},
+		{"dos lines", "10 print 1\r\n20 end", "10 print 1\r\n20 end\r\n\x00"},
+		{"byte order mark", "\xEF\xBB\xBF10 end\n", "10 end\n\x00"},
+	}
+	for _, tt := range tests {
+		got, err := Prepare([]byte(tt.source))
+		if err != nil {
+			t.Errorf("%s: Prepare() error: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Prepare() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareRefuses(t *testing.T) {
+	for source, want := range map[string]string{
+		"":                 "empty",
+		" \n\n":            "empty",
+		"10 end\n\x00\x81": "NUL byte at offset 7",
+	} {
+		if _, err := Prepare([]byte(source)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Prepare(%q) error = %v, want %q", source, err, want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	if got := Lines([]byte("10 print 1\r\n\r\n20 end\r\n\x00")); got != 2 {
+		t.Errorf("Lines() = %d, want 2", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Package bridgeconf reads the configuration of 'bridge serve': the serial
+// ports a long-running bridge relays, each on its own TCP port, so one host
+// such as a Raspberry Pi can serve several machines
+package bridgeconf
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"go.yaml.in/yaml/v3"
+)
+
+// Log formats
+const (
+	LogText    = "text"    // Lines with a timestamp
+	LogJournal = "journal" // Lines without a timestamp, which journald adds
+)
+
+// Config is a bridge configuration file
+type Config struct {
+	Log     string `yaml:"log"` // text or journal; default from the environment
+	Bridges []Port `yaml:"bridges"`
+}
+
+// Port is one serial port and the TCP address it is served on. Settings that
+// aren't given come from foenixmgr.ini.
+type Port struct {
+	Name   string `yaml:"name"`   // Name in log lines; default the serial port
+	Serial string `yaml:"serial"` // Serial port, e.g. /dev/ttyUSB0
+	Listen string `yaml:"listen"` // TCP address, e.g. 0.0.0.0:2560
+	Status string `yaml:"status"` // HTTP address for /status, if any
+
+	DataRate         int    `yaml:"data_rate"`
+	Timeout          int    `yaml:"timeout"`
+	ReconnectTimeout *int   `yaml:"reconnect_timeout"`
+	LockWait         *int   `yaml:"lock_wait"` // Seconds a client waits while another owns the bridge
+	Parity           string `yaml:"parity"`
+	StopBits         string `yaml:"stop_bits"`
+	FlowControl      string `yaml:"flow_control"`
+	DTR              string `yaml:"dtr"`
+	RTS              string `yaml:"rts"`
+}
+
+// Load reads a bridge configuration file
+func Load(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bridge configuration: %w", err)
+	}
+	defer f.Close()
+
+	c, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return c, nil
+}
+
+// Parse reads and checks a bridge configuration. Unknown keys are errors, so
+// a misspelt setting isn't silently ignored.
+func Parse(r io.Reader) (*Config, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	var c Config
+	if err := decoder.Decode(&c); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("no bridges configured")
+		}
+		return nil, err
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// check validates the configuration and fills in the bridge names
+func (c *Config) check() error {
+	switch c.Log {
+	case "", LogText, LogJournal:
+	default:
+		return fmt.Errorf("invalid log format '%s' (use %s or %s)", c.Log, LogText, LogJournal)
+	}
+	if len(c.Bridges) == 0 {
+		return fmt.Errorf("no bridges configured")
+	}
+
+	names := make(map[string]bool)
+	serials := make(map[string]bool)
+	addresses := make(map[string]string)
+	for i := range c.Bridges {
+		p := &c.Bridges[i]
+		if p.Serial == "" {
+			return fmt.Errorf("bridge %d: serial is required", i+1)
+		}
+		if p.Name == "" {
+			p.Name = p.Serial
+		}
+		if names[p.Name] {
+			return fmt.Errorf("bridge name '%s' is used twice", p.Name)
+		}
+		names[p.Name] = true
+		if p.Listen == "" {
+			return fmt.Errorf("%s: listen is required", p.Name)
+		}
+		if serials[p.Serial] {
+			return fmt.Errorf("%s: serial port %s is served twice", p.Name, p.Serial)
+		}
+		serials[p.Serial] = true
+
+		for _, addr := range []string{p.Listen, p.Status} {
+			if addr == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return fmt.Errorf("%s: invalid address '%s' (expected HOST:PORT)", p.Name, addr)
+			}
+			if other, ok := addresses[addr]; ok {
+				return fmt.Errorf("%s: address %s is also used by %s", p.Name, addr, other)
+			}
+			addresses[addr] = p.Name
+		}
+	}
+	return nil
+}
+
+// LogFormat returns the log format: the configured one, else journal when
+// running under systemd (JOURNAL_STREAM is set), else text
+func (c *Config) LogFormat() string {
+	if c.Log != "" {
+		return c.Log
+	}
+	if os.Getenv("JOURNAL_STREAM") != "" {
+		return LogJournal
+	}
+	return LogText
+}
+
+// SerialConfig returns the settings for a port's serial connection: base,
+// with the settings the port gives
+func (p *Port) SerialConfig(base *config.Config) *config.Config {
+	cfg := *base
+	cfg.Port = p.Serial
+	if p.DataRate != 0 {
+		cfg.DataRate = p.DataRate
+	}
+	if p.Timeout != 0 {
+		cfg.Timeout = p.Timeout
+	}
+	if p.ReconnectTimeout != nil {
+		cfg.ReconnectTimeout = *p.ReconnectTimeout
+	}
+	if p.LockWait != nil {
+		cfg.LockWait = *p.LockWait
+	}
+	for _, s := range []struct {
+		value string
+		field *string
+	}{
+		{p.Parity, &cfg.Parity},
+		{p.StopBits, &cfg.StopBits},
+		{p.FlowControl, &cfg.FlowControl},
+		{p.DTR, &cfg.DTR},
+		{p.RTS, &cfg.RTS},
+	} {
+		if s.value != "" {
+			*s.field = s.value
+		}
+	}
+	return &cfg
+}
@@ -0,0 +1,93 @@
+package bridgeconf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(`
+log: journal
+bridges:
+  - name: jr
+    serial: /dev/ttyUSB0
+    listen: 0.0.0.0:2560
+    status: 0.0.0.0:2561
+  - serial: /dev/ttyUSB1
+    listen: 0.0.0.0:2570
+    data_rate: 2000000
+    reconnect_timeout: 0
+    parity: even
+    stop_bits: 2
+    dtr: off
+`))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if len(c.Bridges) != 2 || c.LogFormat() != LogJournal {
+		t.Fatalf("Parse() = %+v", c)
+	}
+	if c.Bridges[0].Name != "jr" || c.Bridges[1].Name != "/dev/ttyUSB1" {
+		t.Errorf("names = %s, %s, want jr, /dev/ttyUSB1", c.Bridges[0].Name, c.Bridges[1].Name)
+	}
+
+	base := &config.Config{Port: "/dev/ttyS0", DataRate: 6000000, Timeout: 60, ReconnectTimeout: 10, Parity: "none", StopBits: "1"}
+	jr := c.Bridges[0].SerialConfig(base)
+	if jr.Port != "/dev/ttyUSB0" || jr.DataRate != 6000000 || jr.ReconnectTimeout != 10 || jr.Parity != "none" {
+		t.Errorf("SerialConfig() = %+v, want the base settings", jr)
+	}
+	other := c.Bridges[1].SerialConfig(base)
+	if other.DataRate != 2000000 || other.Timeout != 60 || other.ReconnectTimeout != 0 ||
+		other.Parity != "even" || other.StopBits != "2" || other.DTR != "off" {
+		t.Errorf("SerialConfig() = %+v, want the port's settings", other)
+	}
+	if base.Port != "/dev/ttyS0" || base.DataRate != 6000000 {
+		t.Errorf("SerialConfig() changed the base configuration: %+v", base)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{"empty", ``, "no bridges"},
+		{"no bridges", "log: text\n", "no bridges"},
+		{"unknown key", "bridges:\n  - serial: a\n    listen: :1\n    baud: 9600\n", "baud"},
+		{"log format", "log: syslog\nbridges:\n  - serial: a\n    listen: :1\n", "invalid log format"},
+		{"no serial", "bridges:\n  - listen: :1\n", "serial is required"},
+		{"no listen", "bridges:\n  - serial: a\n", "listen is required"},
+		{"bad address", "bridges:\n  - serial: a\n    listen: 2560\n", "expected HOST:PORT"},
+		{"same serial", "bridges:\n  - {name: a, serial: s, listen: ':1'}\n  - {name: b, serial: s, listen: ':2'}\n", "served twice"},
+		{"same name", "bridges:\n  - {name: a, serial: s, listen: ':1'}\n  - {name: a, serial: t, listen: ':2'}\n", "used twice"},
+		{"same address", "bridges:\n  - {serial: s, listen: ':1'}\n  - {serial: t, listen: ':2', status: ':1'}\n", "also used by s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Parse() error = %v, want one containing %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	c := &Config{}
+	t.Setenv("JOURNAL_STREAM", "")
+	if got := c.LogFormat(); got != LogText {
+		t.Errorf("LogFormat() = %s, want %s", got, LogText)
+	}
+	t.Setenv("JOURNAL_STREAM", "8:12345")
+	if got := c.LogFormat(); got != LogJournal {
+		t.Errorf("LogFormat() under systemd = %s, want %s", got, LogJournal)
+	}
+	c.Log = LogText
+	if got := c.LogFormat(); got != LogText {
+		t.Errorf("LogFormat() = %s, want the configured %s", got, LogText)
+	}
+}
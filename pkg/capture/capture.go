@@ -0,0 +1,129 @@
+// Package capture records timestamped samples of a memory window, such as a
+// hardware register read at a fixed rate, as CSV or JSON lines for graphing
+package capture
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Sample is one read of the memory window
+type Sample struct {
+	Time    time.Time
+	Elapsed time.Duration // Since the first sample
+	Data    []byte
+}
+
+// Writer writes samples in an output format
+type Writer interface {
+	Write(s Sample) error
+	Flush() error
+}
+
+// FormatForFile returns the output format for a file name: JSON lines for
+// .jsonl, .ndjson and .json files, otherwise CSV
+func FormatForFile(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL
+	}
+	return FormatCSV
+}
+
+// NewWriter returns a writer of samples of count bytes at address in format
+func NewWriter(w io.Writer, format string, address uint32, count int) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, address, count), nil
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w), address: address}, nil
+	}
+	return nil, fmt.Errorf("unknown capture format '%s' (use csv or jsonl)", format)
+}
+
+// csvWriter writes a header row, then one row per sample with the time, the
+// milliseconds since the first sample and one column per byte, in decimal
+type csvWriter struct {
+	w         *csv.Writer
+	header    []string
+	wroteHead bool
+}
+
+func newCSVWriter(w io.Writer, address uint32, count int) *csvWriter {
+	header := []string{"time", "elapsed_ms"}
+	for i := 0; i < count; i++ {
+		header = append(header, fmt.Sprintf("%06X", address+uint32(i)))
+	}
+	return &csvWriter{w: csv.NewWriter(w), header: header}
+}
+
+func (c *csvWriter) Write(s Sample) error {
+	if !c.wroteHead {
+		if err := c.w.Write(c.header); err != nil {
+			return err
+		}
+		c.wroteHead = true
+	}
+	row := []string{
+		s.Time.Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(s.Elapsed)/float64(time.Millisecond), 'f', 3, 64),
+	}
+	for _, b := range s.Data {
+		row = append(row, strconv.Itoa(int(b)))
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes one JSON object per sample
+type jsonlWriter struct {
+	enc     *json.Encoder
+	address uint32
+}
+
+func (j *jsonlWriter) Write(s Sample) error {
+	return j.enc.Encode(struct {
+		Time      string  `json:"time"`
+		ElapsedMS float64 `json:"elapsed_ms"`
+		Address   uint32  `json:"address"`
+		Data      string  `json:"data"`
+		Bytes     []int   `json:"bytes"`
+	}{
+		Time:      s.Time.Format(time.RFC3339Nano),
+		ElapsedMS: float64(s.Elapsed) / float64(time.Millisecond),
+		Address:   j.address,
+		Data:      hex.EncodeToString(s.Data),
+		Bytes:     byteValues(s.Data),
+	})
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
+
+// byteValues returns data as integers, so JSON shows numbers rather than
+// base64
+func byteValues(data []byte) []int {
+	values := make([]int, len(data))
+	for i, b := range data {
+		values[i] = int(b)
+	}
+	return values
+}
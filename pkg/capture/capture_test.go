@@ -0,0 +1,74 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatForFile(t *testing.T) {
+	tests := map[string]string{
+		"trace.csv":    FormatCSV,
+		"trace.JSONL":  FormatJSONL,
+		"trace.ndjson": FormatJSONL,
+		"trace.json":   FormatJSONL,
+		"trace":        FormatCSV,
+	}
+	for name, want := range tests {
+		if got := FormatForFile(name); got != want {
+			t.Errorf("FormatForFile(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatCSV, 0xD01A, 2)
+	if err != nil {
+		t.Fatalf("NewWriter() error: %v", err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w.Write(Sample{Time: start, Data: []byte{0x10, 0x00}})
+	w.Write(Sample{Time: start.Add(20 * time.Millisecond), Elapsed: 20 * time.Millisecond, Data: []byte{0xFF, 0x01}})
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	want := "time,elapsed_ms,00D01A,00D01B\n" +
+		"2024-05-01T12:00:00Z,0.000,16,0\n" +
+		"2024-05-01T12:00:00.02Z,20.000,255,1\n"
+	if buf.String() != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatJSONL, 0x10, 2)
+	w.Write(Sample{Time: time.Unix(0, 0), Elapsed: 1500 * time.Microsecond, Data: []byte{0xAB, 0x02}})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	var got struct {
+		ElapsedMS float64 `json:"elapsed_ms"`
+		Address   uint32  `json:"address"`
+		Data      string  `json:"data"`
+		Bytes     []int   `json:"bytes"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.ElapsedMS != 1.5 || got.Address != 0x10 || got.Data != "ab02" || len(got.Bytes) != 2 || got.Bytes[0] != 0xAB {
+		t.Errorf("sample = %+v", got)
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter(&bytes.Buffer{}, "xml", 0, 1); err == nil {
+		t.Error("NewWriter() with an unknown format should fail")
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
+	"github.com/daschewie/foenixmgr/pkg/cpu"
 	"gopkg.in/ini.v1"
 )
 
@@ -18,15 +18,73 @@ type Config struct {
 	DataRate int
 	Timeout  int
 
+	// Seconds to keep reopening a serial port that disappeared mid-session,
+	// e.g. a USB adapter re-enumerating, or 0 to fail at once
+	ReconnectTimeout int
+
+	// Seconds to wait for a serial port, bridge or --keep-open session that
+	// another process or client is using, or 0 to fail at once with "device
+	// busy"
+	LockWait int
+
+	// Serial line settings: parity (none, odd, even, mark or space), stop
+	// bits (1, 1.5 or 2) and flow control (none or rtscts)
+	Parity      string
+	StopBits    string
+	FlowControl string
+
+	// DTR and RTS after the port is opened: on, off, or empty to leave them
+	// to the driver, which asserts both. Some adapters reset the machine
+	// when DTR changes.
+	DTR string
+	RTS string
+
+	// USB serial number of the adapter to use. When set, the port is looked
+	// up by serial number instead of using Port.
+	PortSerial string
+
+	// Protocol settings
+	VerifyLRC bool // Check the LRC checksum of every response
+	Retries   int  // Times a transfer is repeated after a corrupted response
+
+	// Read back every written block and write it again if it doesn't match
+	VerifyWrites bool
+
 	// Hardware settings
-	CPU       string
-	ChunkSize int
-	FlashSize int
+	CPU            string
+	ChunkSize      int
+	AdaptiveChunks bool // Tune the chunk size to the measured throughput
+	BatchRequests  int  // Chunks in flight at once to a bridge that pipelines
+	FlashSize      int
+
+	// Flash operation timing
+	FlashPoll    bool // After the fixed delays, poll until the debug port answers
+	FlashTimeout int  // Seconds to wait for a flash operation when polling
+
+	// Address where flash memory is visible in the debug port's address space
+	// (hex string), used to read flash back for verification
+	FlashAddress string
 
 	// Development settings
 	LabelFile string
 	Address   string
 
+	// Target machine name from the ini file (the --target flag overrides it)
+	Target string
+
+	// Known machines, and the one selected with SetTarget
+	machines map[string]*Machine
+	machine  *Machine
+
+	// Profiles from the ini file, and the one selected with ApplyProfile
+	profiles map[string]*Profile
+	profile  *Profile
+
+	// The CPU was set explicitly (in a profile, the environment or a flag),
+	// so the target machine's CPU doesn't replace it. A cpu in [DEFAULT] is
+	// only a default, which the target machine's CPU replaces.
+	cpuConfigured bool
+
 	// Machine-specific settings (set via SetTarget)
 	flashPageSize   int
 	flashSectorSize int
@@ -73,59 +131,75 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("no foenixmgr.ini file found in current directory, $FOENIXMGR, or home directory")
 	}
 
-	// Get DEFAULT section
-	section := iniFile.Section("DEFAULT")
+	cfg := fromINI(iniFile)
+	_ = configPath // Used for debugging if needed
 
-	// Create config with defaults
-	cfg := &Config{
-		Port:      section.Key("port").MustString("COM3"),
-		DataRate:  section.Key("data_rate").MustInt(6000000),
-		Timeout:   section.Key("timeout").MustInt(60),
-		CPU:       section.Key("cpu").MustString("65c02"),
-		ChunkSize: section.Key("chunk_size").MustInt(4096),
-		FlashSize: section.Key("flash_size").MustInt(524288),
-		LabelFile: section.Key("labels").MustString("basic8"),
-		Address:   section.Key("address").MustString("380000"),
+	// Apply the default target machine
+	if cfg.Target != "" {
+		if err := cfg.SetTarget(cfg.Target); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
 	}
 
-	_ = configPath // Used for debugging if needed
-
 	return cfg, nil
 }
 
-// SetTarget configures machine-specific flash and RAM settings
-func (c *Config) SetTarget(machineName string) {
-	machineName = strings.ToLower(machineName)
-
-	// Reset to defaults
-	c.flashPageSize = 0
-	c.flashSectorSize = 0
-	c.ramSize = 8
-
-	switch machineName {
-	case "fnx1591":
-		c.flashPageSize = 8
-		c.ramSize = 8
-		c.flashSectorSize = 32
-
-	case "f256k", "f256jr":
-		c.flashPageSize = 8
-		c.ramSize = 8
-		c.flashSectorSize = 8
+// Default returns the settings used when foenixmgr.ini sets nothing, with the
+// built-in machines. It is meant for programs that embed FoenixMgr and don't
+// read an ini file.
+func Default() *Config {
+	return fromINI(ini.Empty())
+}
+
+// fromINI creates a config from the DEFAULT and machine sections of an ini file
+func fromINI(iniFile *ini.File) *Config {
+	section := iniFile.Section("DEFAULT")
+	return &Config{
+		Port:             section.Key("port").MustString("COM3"),
+		PortSerial:       section.Key("port_serial").MustString(""),
+		DataRate:         section.Key("data_rate").MustInt(6000000),
+		Timeout:          section.Key("timeout").MustInt(60),
+		Parity:           section.Key("parity").MustString("none"),
+		StopBits:         section.Key("stop_bits").MustString("1"),
+		FlowControl:      section.Key("flow_control").MustString("none"),
+		DTR:              section.Key("dtr").MustString(""),
+		RTS:              section.Key("rts").MustString(""),
+		ReconnectTimeout: section.Key("reconnect_timeout").MustInt(10),
+		LockWait:         section.Key("lock_wait").MustInt(0),
+		VerifyLRC:        section.Key("verify_lrc").MustBool(true),
+		Retries:          section.Key("retries").MustInt(3),
+		VerifyWrites:     section.Key("verify_writes").MustBool(false),
+		CPU:              section.Key("cpu").MustString("65c02"),
+		ChunkSize:        section.Key("chunk_size").MustInt(4096),
+		AdaptiveChunks:   section.Key("adaptive_chunks").MustBool(false),
+		BatchRequests:    section.Key("batch_requests").MustInt(16),
+		FlashSize:        section.Key("flash_size").MustInt(524288),
+		FlashPoll:        section.Key("flash_poll").MustBool(false),
+		FlashTimeout:     section.Key("flash_timeout").MustInt(10),
+		FlashAddress:     section.Key("flash_address").MustString("080000"),
+		LabelFile:        section.Key("labels").MustString("basic8"),
+		Address:          section.Key("address").MustString("380000"),
+		Target:           section.Key("target").MustString(""),
+		machines:         loadMachines(iniFile),
+		profiles:         loadProfiles(iniFile),
 	}
 }
 
+// CPUType returns the description of the configured CPU
+func (c *Config) CPUType() (cpu.CPU, error) {
+	return cpu.Lookup(c.CPU)
+}
+
 // CPUIsMotorolatype680X0 returns true if the CPU is any Motorola 680x0 variant
 func (c *Config) CPUIsMotorolatype680X0() bool {
-	cpu := c.CPU
-	return cpu == "m68k" || cpu == "68000" || cpu == "68040" || cpu == "68060"
+	return cpu.IsFamily(c.CPU, cpu.Family680X0)
 }
 
 // CPUIsM68k32 returns true if the CPU is a 32-bit Motorola 680x0 (68040 or 68060)
 // These CPUs require 4-byte aligned memory operations
 func (c *Config) CPUIsM68k32() bool {
-	cpu := c.CPU
-	return cpu == "68040" || cpu == "68060"
+	t, err := c.CPUType()
+	return err == nil && t.Family() == cpu.Family680X0 && t.Alignment() == 4
 }
 
 // FlashPageSize returns the size of the largest block of memory that can be
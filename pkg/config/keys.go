@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// setting maps a [DEFAULT] ini key to its Config field
+type setting struct {
+	name    string
+	field   func(c *Config) interface{} // Returns a *string, *int or *bool
+	comment string
+}
+
+// settings lists every [DEFAULT] key, in the order they are listed
+var settings = []setting{
+	{"port", func(c *Config) interface{} { return &c.Port }, "Serial port or TCP address"},
+	{"port_serial", func(c *Config) interface{} { return &c.PortSerial }, "USB serial number of the adapter (overrides port)"},
+	{"data_rate", func(c *Config) interface{} { return &c.DataRate }, "Serial data rate (baud rate)"},
+	{"parity", func(c *Config) interface{} { return &c.Parity }, "Serial parity: none, odd, even, mark or space"},
+	{"stop_bits", func(c *Config) interface{} { return &c.StopBits }, "Serial stop bits: 1, 1.5 or 2"},
+	{"flow_control", func(c *Config) interface{} { return &c.FlowControl }, "Serial flow control: none or rtscts"},
+	{"dtr", func(c *Config) interface{} { return &c.DTR }, "DTR line after opening: on or off (default: driver)"},
+	{"rts", func(c *Config) interface{} { return &c.RTS }, "RTS line after opening: on or off (default: driver)"},
+	{"timeout", func(c *Config) interface{} { return &c.Timeout }, "Seconds to wait for each debug port response"},
+	{"reconnect_timeout", func(c *Config) interface{} { return &c.ReconnectTimeout }, "Seconds to reopen a serial port that disappeared"},
+	{"lock_wait", func(c *Config) interface{} { return &c.LockWait }, "Seconds to wait for a port another process or client is using"},
+	{"verify_lrc", func(c *Config) interface{} { return &c.VerifyLRC }, "Verify response LRC checksums"},
+	{"retries", func(c *Config) interface{} { return &c.Retries }, "Retries after a failed memory transfer"},
+	{"verify_writes", func(c *Config) interface{} { return &c.VerifyWrites }, "Read back and rewrite mismatched memory writes"},
+	{"cpu", func(c *Config) interface{} { return &c.CPU }, "CPU type"},
+	{"chunk_size", func(c *Config) interface{} { return &c.ChunkSize }, "Upload chunk size in bytes"},
+	{"adaptive_chunks", func(c *Config) interface{} { return &c.AdaptiveChunks }, "Tune the chunk size to the measured throughput"},
+	{"batch_requests", func(c *Config) interface{} { return &c.BatchRequests }, "Chunks in flight at once to a TCP bridge (1 disables)"},
+	{"flash_size", func(c *Config) interface{} { return &c.FlashSize }, "Flash memory size in bytes"},
+	{"flash_poll", func(c *Config) interface{} { return &c.FlashPoll }, "After the fixed flash delays, poll until the debug port answers"},
+	{"flash_timeout", func(c *Config) interface{} { return &c.FlashTimeout }, "Flash operation timeout in seconds when polling"},
+	{"flash_address", func(c *Config) interface{} { return &c.FlashAddress }, "Address where flash is visible (hex)"},
+	{"labels", func(c *Config) interface{} { return &c.LabelFile }, "Label file for lookup and deref"},
+	{"address", func(c *Config) interface{} { return &c.Address }, "Default RAM address for uploads (hex)"},
+	{"target", func(c *Config) interface{} { return &c.Target }, "Default target machine"},
+}
+
+// findSetting returns the setting for an ini key
+func findSetting(key string) (*setting, error) {
+	for i := range settings {
+		if settings[i].name == key {
+			return &settings[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown configuration key '%s'", key)
+}
+
+// Keys returns the names of all [DEFAULT] settings
+func Keys() []string {
+	keys := make([]string, len(settings))
+	for i, s := range settings {
+		keys[i] = s.name
+	}
+	return keys
+}
+
+// KeyDescription returns a short description of a setting
+func KeyDescription(key string) string {
+	s, err := findSetting(key)
+	if err != nil {
+		return ""
+	}
+	return s.comment
+}
+
+// EnvName returns the environment variable that overrides a setting
+func EnvName(key string) string {
+	return "FOENIX_" + strings.ToUpper(key)
+}
+
+// Get returns the effective value of a setting as a string
+func (c *Config) Get(key string) (string, error) {
+	s, err := findSetting(key)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := s.field(c).(type) {
+	case *string:
+		return *v, nil
+	case *int:
+		return strconv.Itoa(*v), nil
+	case *bool:
+		return strconv.FormatBool(*v), nil
+	}
+	return "", fmt.Errorf("unsupported type for %s", key)
+}
+
+// Set parses and applies the value of a setting. Setting the target also
+// applies the machine's settings.
+func (c *Config) Set(key, value string) error {
+	s, err := findSetting(key)
+	if err != nil {
+		return err
+	}
+
+	if key == "target" && value != "" {
+		if err := c.SetTarget(value); err != nil {
+			return err
+		}
+	}
+
+	switch v := s.field(c).(type) {
+	case *string:
+		*v = value
+		if key == "cpu" {
+			c.cpuConfigured = true
+		}
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number: %w", key, err)
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %w", key, err)
+		}
+		*v = b
+	}
+	return nil
+}
+
+// ApplyEnv applies the FOENIX_* environment variable overrides. FOENIX_TARGET
+// is not applied here: the target has to be selected before any other
+// override, so the caller resolves it together with the --target flag.
+func (c *Config) ApplyEnv() error {
+	for _, s := range settings {
+		if s.name == "target" {
+			continue
+		}
+		if value, ok := os.LookupEnv(EnvName(s.name)); ok {
+			if err := c.Set(s.name, value); err != nil {
+				return fmt.Errorf("%s: %w", EnvName(s.name), err)
+			}
+		}
+	}
+	return nil
+}
+
+// Save validates a setting and writes it to the [DEFAULT] section of the
+// ini file at path. The loaded configuration is not changed.
+func (c *Config) Save(path, key, value string) error {
+	// Validate against a copy so the effective configuration is untouched
+	check := *c
+	if err := check.Set(key, value); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	updated := setDefaultKey(string(data), key, value)
+	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// setDefaultKey sets key=value in the [DEFAULT] section of ini file text.
+// The text is edited line by line so comments and layout are kept. A key that
+// isn't set yet is added after the last setting of the section.
+func setDefaultKey(text, key, value string) string {
+	lines := strings.Split(text, "\n")
+	entry := key + "=" + value
+
+	inDefault := true // Keys before any section header belong to DEFAULT
+	header := -1
+	lastKey := -1
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			inDefault = strings.EqualFold(strings.Trim(trimmed, "[] "), "DEFAULT")
+			if inDefault && header < 0 {
+				header = i
+			}
+			continue
+		}
+		if !inDefault || trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		name, _, found := strings.Cut(trimmed, "=")
+		if !found {
+			continue
+		}
+		if strings.TrimSpace(name) == key {
+			lines[i] = entry
+			return strings.Join(lines, "\n")
+		}
+		lastKey = i
+	}
+
+	insertAt := 0
+	if lastKey >= 0 {
+		insertAt = lastKey + 1
+	} else if header >= 0 {
+		insertAt = header + 1
+	}
+
+	lines = append(lines[:insertAt], append([]string{entry}, lines[insertAt:]...)...)
+	return strings.Join(lines, "\n")
+}
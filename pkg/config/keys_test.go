@@ -0,0 +1,66 @@
+package config
+
+import "testing"
+
+func TestSetDefaultKey(t *testing.T) {
+	const text = `# Comment
+[DEFAULT]
+# Serial port
+port=/dev/ttyUSB0
+
+cpu = 65c02
+
+[machine.f256k]
+chunk_size=2048
+`
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  string
+	}{
+		{
+			"Replace existing key",
+			"cpu", "65816",
+			"# Comment\n[DEFAULT]\n# Serial port\nport=/dev/ttyUSB0\n\ncpu=65816\n\n[machine.f256k]\nchunk_size=2048\n",
+		},
+		{
+			"Add new key to DEFAULT",
+			"target", "f256k",
+			"# Comment\n[DEFAULT]\n# Serial port\nport=/dev/ttyUSB0\n\ncpu = 65c02\ntarget=f256k\n\n[machine.f256k]\nchunk_size=2048\n",
+		},
+		{
+			"Machine section keys are left alone",
+			"chunk_size", "1024",
+			"# Comment\n[DEFAULT]\n# Serial port\nport=/dev/ttyUSB0\n\ncpu = 65c02\nchunk_size=1024\n\n[machine.f256k]\nchunk_size=2048\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setDefaultKey(text, tt.key, tt.value); got != tt.want {
+				t.Errorf("setDefaultKey() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("FOENIX_DATA_RATE", "115200")
+	t.Setenv("FOENIX_CPU", "65816")
+	t.Setenv("FOENIX_VERIFY_LRC", "false")
+
+	cfg := &Config{DataRate: 6000000, CPU: "65c02", VerifyLRC: true}
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatalf("ApplyEnv() error: %v", err)
+	}
+	if cfg.DataRate != 115200 || cfg.CPU != "65816" || cfg.VerifyLRC {
+		t.Errorf("after ApplyEnv: data rate %d, CPU %s, verify %v", cfg.DataRate, cfg.CPU, cfg.VerifyLRC)
+	}
+
+	t.Setenv("FOENIX_CHUNK_SIZE", "big")
+	if err := cfg.ApplyEnv(); err == nil {
+		t.Error("ApplyEnv() expected error for non-numeric chunk size")
+	}
+}
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// machineSectionPrefix starts the name of ini sections that define machines,
+// e.g. [machine.f256k]
+const machineSectionPrefix = "machine."
+
+// regionKeyPrefix starts the keys of a machine section that define memory
+// regions, e.g. region.audio.psg=D600
+const regionKeyPrefix = "region."
+
+// Region is a named area of a machine's memory, as the debug port addresses it
+type Region struct {
+	Address uint32
+	Size    uint32 // Bytes, 0 if not given
+}
+
+// ParseRegion parses a region definition: a hex address optionally followed
+// by a comma and a hex size, e.g. "D600" or "010000,8000"
+func ParseRegion(s string) (Region, error) {
+	addressText, sizeText, hasSize := strings.Cut(s, ",")
+	address, err := strconv.ParseUint(strings.TrimSpace(addressText), 16, 32)
+	if err != nil {
+		return Region{}, fmt.Errorf("invalid region address '%s'", strings.TrimSpace(addressText))
+	}
+	region := Region{Address: uint32(address)}
+	if hasSize {
+		size, err := strconv.ParseUint(strings.TrimSpace(sizeText), 16, 32)
+		if err != nil {
+			return Region{}, fmt.Errorf("invalid region size '%s'", strings.TrimSpace(sizeText))
+		}
+		region.Size = uint32(size)
+	}
+	return region, nil
+}
+
+// Machine describes the hardware parameters of a target machine
+type Machine struct {
+	Name        string
+	Description string
+
+	// CPU and transfer settings. Empty or zero values leave the
+	// corresponding [DEFAULT] setting unchanged.
+	CPU       string
+	ChunkSize int
+	FlashSize int // Bytes
+
+	// Flash programming layout (in KB). A zero page or sector size means the
+	// machine doesn't support sector programming.
+	FlashPageSize   int
+	FlashSectorSize int
+	RAMSize         int // RAM window used to stage data for flash programming
+
+	// Address where the user's own code on the machine writes the CPU register
+	// snapshot (hex string, empty if none). No firmware writes one, and no
+	// built-in machine sets it; see the layouts in the protocol package.
+	RegisterAddress string
+
+	// Commands lists the machine-specific commands (stop, start, boot, ...)
+	// the machine supports. Commands that work on every machine are not listed.
+	Commands []string
+
+	// Regions are named areas of memory used by the hardware helpers, such
+	// as audio.psg or video.text
+	Regions map[string]Region
+
+	// MemoryMap lists the RAM, I/O and flash ranges of the machine, which
+	// writes are checked against. It is empty if the map isn't known.
+	MemoryMap []MemoryRange
+}
+
+// Region returns the named memory region of the machine
+func (m *Machine) Region(name string) (Region, bool) {
+	region, ok := m.Regions[strings.ToLower(name)]
+	return region, ok
+}
+
+// Supports returns true if the machine supports a machine-specific command
+func (m *Machine) Supports(command string) bool {
+	for _, c := range m.Commands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinMachines are the machines known without any ini configuration
+var builtinMachines = []Machine{
+	{
+		Name:            "f256jr",
+		Description:     "Foenix F256 Jr.",
+		CPU:             "65c02",
+		FlashSize:       524288,
+		FlashPageSize:   8,
+		FlashSectorSize: 8,
+		RAMSize:         8,
+		Commands:        []string{"stop", "start", "boot"},
+		MemoryMap: []MemoryRange{
+			{Kind: MemoryRAM, Start: 0x000000, End: 0x07FFFF},
+			{Kind: MemoryIO, Start: 0x00C000, End: 0x00DFFF},
+			{Kind: MemoryFlash, Start: 0x080000, End: 0x0FFFFF},
+			{Kind: MemoryRAM, Start: 0x100000, End: 0x13FFFF}, // Expansion memory
+		},
+	},
+	{
+		Name:            "f256k",
+		Description:     "Foenix F256K",
+		CPU:             "65c02",
+		FlashSize:       524288,
+		FlashPageSize:   8,
+		FlashSectorSize: 8,
+		RAMSize:         8,
+		Commands:        []string{"stop", "start", "boot"},
+		MemoryMap: []MemoryRange{
+			{Kind: MemoryRAM, Start: 0x000000, End: 0x07FFFF},
+			{Kind: MemoryIO, Start: 0x00C000, End: 0x00DFFF},
+			{Kind: MemoryFlash, Start: 0x080000, End: 0x0FFFFF},
+			{Kind: MemoryRAM, Start: 0x100000, End: 0x13FFFF}, // Expansion memory
+		},
+	},
+	// The FNX1591's configuration EEPROM and its board-specific debug port
+	// commands aren't documented, so no Commands enable device-specific
+	// operations on it yet
+	{
+		Name:            "fnx1591",
+		Description:     "Foenix FNX1591",
+		FlashPageSize:   8,
+		FlashSectorSize: 32,
+		RAMSize:         8,
+	},
+	{
+		Name:        "a2560",
+		Description: "Foenix A2560",
+		RAMSize:     8,
+	},
+}
+
+// loadMachines returns the built-in machines merged with the [machine.NAME]
+// sections of the ini file. A section for a built-in machine overrides only
+// the keys it sets.
+func loadMachines(iniFile *ini.File) map[string]*Machine {
+	machines := make(map[string]*Machine)
+	for _, m := range builtinMachines {
+		m := m
+		m.Regions = make(map[string]Region)
+		m.MemoryMap = append([]MemoryRange(nil), m.MemoryMap...)
+		machines[m.Name] = &m
+	}
+
+	if iniFile == nil {
+		return machines
+	}
+
+	for _, section := range iniFile.Sections() {
+		if !strings.HasPrefix(strings.ToLower(section.Name()), machineSectionPrefix) {
+			continue
+		}
+
+		name := strings.ToLower(section.Name()[len(machineSectionPrefix):])
+		m, ok := machines[name]
+		if !ok {
+			m = &Machine{Name: name, RAMSize: 8, Regions: make(map[string]Region)}
+			machines[name] = m
+		}
+
+		m.Description = section.Key("description").MustString(m.Description)
+		m.CPU = section.Key("cpu").MustString(m.CPU)
+		m.ChunkSize = section.Key("chunk_size").MustInt(m.ChunkSize)
+		m.FlashSize = section.Key("flash_size").MustInt(m.FlashSize)
+		m.FlashPageSize = section.Key("flash_page_size").MustInt(m.FlashPageSize)
+		m.FlashSectorSize = section.Key("flash_sector_size").MustInt(m.FlashSectorSize)
+		m.RAMSize = section.Key("ram_size").MustInt(m.RAMSize)
+		m.RegisterAddress = section.Key("register_address").MustString(m.RegisterAddress)
+		if section.HasKey("commands") {
+			m.Commands = nil
+			for _, c := range section.Key("commands").Strings(",") {
+				m.Commands = append(m.Commands, strings.ToLower(c))
+			}
+		}
+
+		for _, key := range section.Keys() {
+			name := strings.ToLower(key.Name())
+			if !strings.HasPrefix(name, regionKeyPrefix) {
+				continue
+			}
+			region, err := ParseRegion(key.Value())
+			if err != nil {
+				// Like other invalid machine keys, a bad region is ignored
+				continue
+			}
+			m.Regions[name[len(regionKeyPrefix):]] = region
+		}
+
+		// A memory.KIND key replaces the ranges of that kind
+		for _, key := range section.Keys() {
+			name := strings.ToLower(key.Name())
+			kind := strings.TrimPrefix(name, memoryKeyPrefix)
+			if kind == name || !containsKind(MemoryKinds, kind) {
+				continue
+			}
+			ranges, err := ParseMemoryRanges(kind, key.Value())
+			if err != nil {
+				// Like a bad region, a bad memory map is ignored
+				continue
+			}
+			memoryMap := []MemoryRange{}
+			for _, r := range m.MemoryMap {
+				if r.Kind != kind {
+					memoryMap = append(memoryMap, r)
+				}
+			}
+			m.MemoryMap = append(memoryMap, ranges...)
+		}
+	}
+
+	return machines
+}
+
+// Machines returns every known machine, sorted by name
+func (c *Config) Machines() []*Machine {
+	machines := make([]*Machine, 0, len(c.machines))
+	for _, m := range c.machines {
+		machines = append(machines, m)
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+	return machines
+}
+
+// Machine returns the selected target machine, or nil if no target is set
+func (c *Config) Machine() *Machine {
+	return c.machine
+}
+
+// MachineRegion returns a named memory region of the target machine, with an
+// error explaining how to define it if there is none
+func (c *Config) MachineRegion(name string) (Region, error) {
+	if c.machine == nil {
+		return Region{}, fmt.Errorf("no target machine selected, so the %s region is unknown (use --target)", name)
+	}
+	region, ok := c.machine.Region(name)
+	if !ok {
+		return Region{}, fmt.Errorf("the %s region is not defined for %s (set %s%s in [%s%s] of foenixmgr.ini)",
+			name, c.machine.Name, regionKeyPrefix, name, machineSectionPrefix, c.machine.Name)
+	}
+	return region, nil
+}
+
+// machineNames returns the names of all known machines, for error messages
+func (c *Config) machineNames() string {
+	var names []string
+	for _, m := range c.Machines() {
+		names = append(names, m.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// SetTarget selects the target machine and applies its settings. The
+// machine's CPU replaces the [DEFAULT] one, but a CPU set explicitly by a
+// profile, the environment or a flag, e.g. cpu=6809 for an F256 with the 6809
+// processor card, is kept.
+func (c *Config) SetTarget(machineName string) error {
+	if c.machines == nil {
+		c.machines = loadMachines(nil)
+	}
+
+	m, ok := c.machines[strings.ToLower(machineName)]
+	if !ok {
+		return fmt.Errorf("unknown target machine '%s' (known machines: %s)", machineName, c.machineNames())
+	}
+
+	c.machine = m
+	c.flashPageSize = m.FlashPageSize
+	c.flashSectorSize = m.FlashSectorSize
+	c.ramSize = m.RAMSize
+
+	if m.CPU != "" && !c.cpuConfigured {
+		c.CPU = m.CPU
+	}
+	if m.ChunkSize > 0 {
+		c.ChunkSize = m.ChunkSize
+	}
+	if m.FlashSize > 0 {
+		c.FlashSize = m.FlashSize
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestLoadMachines(t *testing.T) {
+	iniFile, err := ini.Load([]byte(`
+[machine.f256k]
+chunk_size=2048
+
+[machine.C256U]
+cpu=65816
+flash_sector_size=32
+commands=stop, Start
+region.audio.PSG=AF1900
+region.video.text=AFA000,1000
+region.bad=xyz
+`))
+	if err != nil {
+		t.Fatalf("ini.Load() error: %v", err)
+	}
+
+	machines := loadMachines(iniFile)
+
+	// Overriding one key of a built-in machine keeps the others
+	f256k := machines["f256k"]
+	if f256k.ChunkSize != 2048 || f256k.FlashSectorSize != 8 || !f256k.Supports("boot") {
+		t.Errorf("f256k = %+v, want chunk size 2048 with built-in flash layout", f256k)
+	}
+
+	c256u, ok := machines["c256u"]
+	if !ok {
+		t.Fatal("machine c256u not loaded")
+	}
+	if c256u.CPU != "65816" || c256u.FlashSectorSize != 32 || c256u.RAMSize != 8 {
+		t.Errorf("c256u = %+v", c256u)
+	}
+	if !c256u.Supports("start") || c256u.Supports("boot") {
+		t.Errorf("c256u commands = %v, want stop and start", c256u.Commands)
+	}
+
+	if region, ok := c256u.Region("audio.psg"); !ok || region != (Region{Address: 0xAF1900}) {
+		t.Errorf("audio.psg region = %+v, %v", region, ok)
+	}
+	if region, ok := c256u.Region("video.text"); !ok || region != (Region{Address: 0xAFA000, Size: 0x1000}) {
+		t.Errorf("video.text region = %+v, %v", region, ok)
+	}
+	if _, ok := c256u.Region("bad"); ok {
+		t.Error("invalid region was loaded")
+	}
+}
+
+func TestMachineRegion(t *testing.T) {
+	cfg := &Config{}
+	if _, err := cfg.MachineRegion("audio.psg"); err == nil {
+		t.Error("MachineRegion() without a target expected error")
+	}
+
+	if err := cfg.SetTarget("f256k"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Machine().Regions["audio.psg"] = Region{Address: 0xD600}
+	if region, err := cfg.MachineRegion("audio.psg"); err != nil || region.Address != 0xD600 {
+		t.Errorf("MachineRegion() = %+v, %v", region, err)
+	}
+	if _, err := cfg.MachineRegion("video.text"); err == nil {
+		t.Error("MachineRegion() expected error for undefined region")
+	}
+}
+
+func TestSetTarget(t *testing.T) {
+	cfg := &Config{CPU: "68040", ChunkSize: 4096}
+
+	if err := cfg.SetTarget("F256JR"); err != nil {
+		t.Fatalf("SetTarget() error: %v", err)
+	}
+	if cfg.CPU != "65c02" || cfg.FlashSectorSize() != 8 || cfg.ChunkSize != 4096 {
+		t.Errorf("after SetTarget: CPU %s, sector %d, chunk %d", cfg.CPU, cfg.FlashSectorSize(), cfg.ChunkSize)
+	}
+
+	if err := cfg.SetTarget("unknown"); err == nil {
+		t.Error("SetTarget() expected error for unknown machine")
+	}
+}
+
+func TestConfiguredCPU(t *testing.T) {
+	load := func(text string) *Config {
+		t.Helper()
+		iniFile, err := ini.Load([]byte(text))
+		if err != nil {
+			t.Fatalf("ini.Load() error: %v", err)
+		}
+		cfg := fromINI(iniFile)
+		if cfg.Target != "" {
+			if err := cfg.SetTarget(cfg.Target); err != nil {
+				t.Fatalf("SetTarget() error: %v", err)
+			}
+		}
+		return cfg
+	}
+
+	// Without a cpu setting the machine's CPU is used
+	if cfg := load("[DEFAULT]\ntarget=c256u\n[machine.c256u]\ncpu=65816\n"); cfg.CPU != "65816" {
+		t.Errorf("CPU = %s, want the c256u's 65816", cfg.CPU)
+	}
+
+	// A cpu in [DEFAULT] is only a default, replaced by the machine's
+	cfg := load("[DEFAULT]\ncpu=68040\ntarget=c256u\n[machine.c256u]\ncpu=65816\n")
+	if cfg.CPU != "65816" {
+		t.Errorf("CPU with target= = %s, want the c256u's 65816", cfg.CPU)
+	}
+
+	// A cpu from the environment or a flag is kept over a later target
+	if err := cfg.Set("cpu", "6809"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("target", "c256u"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CPU != "6809" {
+		t.Errorf("CPU after selecting c256u = %s, want 6809", cfg.CPU)
+	}
+
+	// So does the cpu of a profile, whatever its target
+	cfg = load("[profile.card]\ncpu=6809\ntarget=f256k\n")
+	if err := cfg.ApplyProfile("card"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CPU != "6809" {
+		t.Errorf("CPU after ApplyProfile(card) = %s, want 6809", cfg.CPU)
+	}
+	if err := cfg.SetTarget("a2560"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CPU != "6809" {
+		t.Errorf("CPU after selecting a2560 = %s, want the profile's 6809", cfg.CPU)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := Default()
+	if cfg.CPU != "65c02" || cfg.ChunkSize != 4096 || cfg.FlashSize != 524288 || !cfg.VerifyLRC {
+		t.Errorf("Default() = CPU %s, chunk %d, flash %d, verify LRC %v", cfg.CPU, cfg.ChunkSize, cfg.FlashSize, cfg.VerifyLRC)
+	}
+	if err := cfg.SetTarget("f256k"); err != nil {
+		t.Errorf("Default() has no built-in f256k: %v", err)
+	}
+}
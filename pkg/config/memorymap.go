@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kinds of memory in a machine's memory map
+const (
+	MemoryRAM   = "ram"
+	MemoryIO    = "io"
+	MemoryFlash = "flash"
+)
+
+// MemoryKinds lists the kinds of memory, in the order they are set in the ini
+// file and listed
+var MemoryKinds = []string{MemoryRAM, MemoryIO, MemoryFlash}
+
+// memoryKeyPrefix starts the keys of a machine section that define its memory
+// map, e.g. memory.io=00C000-00DFFF
+const memoryKeyPrefix = "memory."
+
+// MemoryRange is an area of a machine's memory map, as the debug port
+// addresses it
+type MemoryRange struct {
+	Kind  string
+	Start uint32
+	End   uint32 // Last address in the range
+}
+
+// Contains returns true if address is inside the range
+func (r MemoryRange) Contains(address uint32) bool {
+	return address >= r.Start && address <= r.End
+}
+
+// String formats the range as its start and end address
+func (r MemoryRange) String() string {
+	return fmt.Sprintf("%06X-%06X", r.Start, r.End)
+}
+
+// MemoryKindName names a kind of memory for messages
+func MemoryKindName(kind string) string {
+	switch kind {
+	case MemoryRAM:
+		return "RAM"
+	case MemoryIO:
+		return "I/O"
+	}
+	return kind
+}
+
+// ParseMemoryRanges parses a comma-separated list of hex address ranges of
+// one kind of memory, e.g. "000000-07FFFF,100000-13FFFF"
+func ParseMemoryRanges(kind, s string) ([]MemoryRange, error) {
+	var ranges []MemoryRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startText, endText, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid memory range '%s': expected START-END", part)
+		}
+		start, err := strconv.ParseUint(strings.TrimSpace(startText), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory range start '%s'", strings.TrimSpace(startText))
+		}
+		end, err := strconv.ParseUint(strings.TrimSpace(endText), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory range end '%s'", strings.TrimSpace(endText))
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid memory range '%s': end is before start", part)
+		}
+		ranges = append(ranges, MemoryRange{Kind: kind, Start: uint32(start), End: uint32(end)})
+	}
+	return ranges, nil
+}
+
+// MemoryAt returns the range of the memory map that holds address. I/O and
+// flash ranges take precedence over the RAM ranges they overlap, as the
+// hardware maps them over RAM.
+func (m *Machine) MemoryAt(address uint32) (MemoryRange, bool) {
+	var found MemoryRange
+	ok := false
+	for _, r := range m.MemoryMap {
+		if !r.Contains(address) {
+			continue
+		}
+		if r.Kind != MemoryRAM {
+			return r, true
+		}
+		found, ok = r, true
+	}
+	return found, ok
+}
+
+// CheckWrite returns an error if writing length bytes at address reaches
+// memory that isn't one of the allowed kinds, or that isn't in the memory
+// map at all. Every write is allowed on machines without a memory map.
+func (m *Machine) CheckWrite(address uint32, length int, allowed ...string) error {
+	if len(m.MemoryMap) == 0 || length <= 0 {
+		return nil
+	}
+
+	end := uint64(address) + uint64(length)
+	for a := uint64(address); a < end; {
+		if a > 0xFFFFFFFF {
+			return fmt.Errorf("write to %06X-%06X reaches past the end of the address space of %s", address, end-1, m.Name)
+		}
+		r, ok := m.MemoryAt(uint32(a))
+		if !ok {
+			return fmt.Errorf("write to %06X-%06X reaches %06X, which is not memory on %s", address, end-1, a, m.Name)
+		}
+		if !containsKind(allowed, r.Kind) {
+			return fmt.Errorf("write to %06X-%06X reaches %s at %s on %s", address, end-1, MemoryKindName(r.Kind), r, m.Name)
+		}
+		next := uint64(r.End) + 1
+		if r.Kind == MemoryRAM {
+			// I/O or flash mapped over the RAM ends the range early
+			for _, other := range m.MemoryMap {
+				if other.Kind != MemoryRAM && uint64(other.Start) > a && uint64(other.Start) < next {
+					next = uint64(other.Start)
+				}
+			}
+		}
+		a = next
+	}
+	return nil
+}
+
+// containsKind returns true if kinds holds kind
+func containsKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
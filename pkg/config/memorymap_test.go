@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestParseMemoryRanges(t *testing.T) {
+	ranges, err := ParseMemoryRanges(MemoryRAM, "000000-07FFFF, 100000-13ffff")
+	if err != nil {
+		t.Fatalf("ParseMemoryRanges() error: %v", err)
+	}
+	want := []MemoryRange{
+		{Kind: MemoryRAM, Start: 0x000000, End: 0x07FFFF},
+		{Kind: MemoryRAM, Start: 0x100000, End: 0x13FFFF},
+	}
+	if len(ranges) != len(want) || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("ParseMemoryRanges() = %+v, want %+v", ranges, want)
+	}
+
+	for _, s := range []string{"000000", "xyz-0100", "0100-xyz", "0200-0100"} {
+		if _, err := ParseMemoryRanges(MemoryIO, s); err == nil {
+			t.Errorf("ParseMemoryRanges(%q) expected error", s)
+		}
+	}
+}
+
+func TestLoadMemoryMap(t *testing.T) {
+	iniFile, err := ini.Load([]byte(`
+[machine.f256k]
+memory.IO=00D000-00DFFF
+
+[machine.c256u]
+memory.ram=000000-3FFFFF
+memory.flash=bad
+`))
+	if err != nil {
+		t.Fatalf("ini.Load() error: %v", err)
+	}
+	machines := loadMachines(iniFile)
+
+	// memory.io replaces the I/O ranges and keeps the others
+	f256k := machines["f256k"]
+	if r, ok := f256k.MemoryAt(0x00C800); !ok || r.Kind != MemoryRAM {
+		t.Errorf("f256k MemoryAt(C800) = %+v, %v, want RAM", r, ok)
+	}
+	if r, ok := f256k.MemoryAt(0x00D600); !ok || r.Kind != MemoryIO {
+		t.Errorf("f256k MemoryAt(D600) = %+v, %v, want I/O", r, ok)
+	}
+	if r, ok := f256k.MemoryAt(0x080000); !ok || r.Kind != MemoryFlash {
+		t.Errorf("f256k MemoryAt(080000) = %+v, %v, want flash", r, ok)
+	}
+
+	// The built-in map isn't changed for other configurations
+	if r, _ := loadMachines(nil)["f256k"].MemoryAt(0x00C800); r.Kind != MemoryIO {
+		t.Errorf("built-in f256k MemoryAt(C800) = %+v, want I/O", r)
+	}
+
+	c256u := machines["c256u"]
+	if len(c256u.MemoryMap) != 1 {
+		t.Errorf("c256u memory map = %+v, want the RAM range only", c256u.MemoryMap)
+	}
+	if len(machines["a2560"].MemoryMap) != 0 {
+		t.Errorf("a2560 memory map = %+v, want none", machines["a2560"].MemoryMap)
+	}
+}
+
+func TestCheckWrite(t *testing.T) {
+	m := loadMachines(nil)["f256k"]
+
+	tests := []struct {
+		address uint32
+		length  int
+		allowed []string
+		want    string
+	}{
+		{0x002000, 0x1000, []string{MemoryRAM}, ""},
+		{0x00BFF0, 0x20, []string{MemoryRAM}, "reaches I/O at 00C000-00DFFF"},
+		{0x00BFF0, 0x20, []string{MemoryRAM, MemoryIO}, ""},
+		{0x00DFF0, 0x20, []string{MemoryRAM}, "reaches I/O"},
+		{0x07FFF0, 0x20, []string{MemoryRAM}, "reaches flash at 080000-0FFFFF"},
+		{0x13FFF0, 0x20, []string{MemoryRAM}, "reaches 140000, which is not memory"},
+		{0x380000, 1, []string{MemoryRAM}, "reaches 380000"},
+	}
+	for _, tt := range tests {
+		err := m.CheckWrite(tt.address, tt.length, tt.allowed...)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("CheckWrite(%06X, %X) error: %v", tt.address, tt.length, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("CheckWrite(%06X, %X) = %v, want error with %q", tt.address, tt.length, err, tt.want)
+		}
+	}
+
+	// Machines without a memory map allow every write
+	if err := loadMachines(nil)["a2560"].CheckWrite(0xFFFFFF00, 0x100); err != nil {
+		t.Errorf("CheckWrite() without a memory map error: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// profileSectionPrefix starts the ini sections that define profiles
+const profileSectionPrefix = "profile."
+
+// Profile is a named set of settings from a [profile.NAME] section of
+// foenixmgr.ini, for one of several machines on one desk. Its keys are the
+// [DEFAULT] keys, e.g. port, target, cpu and labels.
+type Profile struct {
+	Name     string
+	Settings map[string]string
+}
+
+// loadProfiles reads the [profile.NAME] sections of an ini file
+func loadProfiles(iniFile *ini.File) map[string]*Profile {
+	profiles := make(map[string]*Profile)
+	for _, section := range iniFile.Sections() {
+		if !strings.HasPrefix(strings.ToLower(section.Name()), profileSectionPrefix) {
+			continue
+		}
+
+		name := strings.ToLower(section.Name()[len(profileSectionPrefix):])
+		p := &Profile{Name: name, Settings: make(map[string]string)}
+		for _, key := range section.Keys() {
+			p.Settings[strings.ToLower(key.Name())] = key.Value()
+		}
+		profiles[name] = p
+	}
+	return profiles
+}
+
+// Profiles returns every profile, sorted by name
+func (c *Config) Profiles() []*Profile {
+	profiles := make([]*Profile, 0, len(c.profiles))
+	for _, p := range c.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// Profile returns the profile selected with ApplyProfile, or nil
+func (c *Config) Profile() *Profile {
+	return c.profile
+}
+
+// ApplyProfile applies the settings of a profile: first its target machine,
+// if it has one, so that its other settings override the machine's
+func (c *Config) ApplyProfile(name string) error {
+	p, ok := c.profiles[strings.ToLower(name)]
+	if !ok {
+		var names []string
+		for _, p := range c.Profiles() {
+			names = append(names, p.Name)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile '%s' (define it in a [%s%s] section of foenixmgr.ini)", name, profileSectionPrefix, name)
+		}
+		return fmt.Errorf("unknown profile '%s' (known profiles: %s)", name, strings.Join(names, ", "))
+	}
+
+	keys := make([]string, 0, len(p.Settings))
+	for key := range p.Settings {
+		if key != "target" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := p.Settings["target"]; ok {
+		keys = append([]string{"target"}, keys...)
+	}
+
+	for _, key := range keys {
+		if err := c.Set(key, p.Settings[key]); err != nil {
+			return fmt.Errorf("[%s%s]: %w", profileSectionPrefix, p.Name, err)
+		}
+	}
+	c.profile = p
+	return nil
+}
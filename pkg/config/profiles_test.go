@@ -0,0 +1,66 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestApplyProfile(t *testing.T) {
+	iniFile, err := ini.Load([]byte(`
+[DEFAULT]
+port=/dev/ttyUSB0
+cpu=68040
+
+[profile.jr]
+port=/dev/ttyUSB1
+target=f256jr
+labels=jr.lbl
+
+[profile.A2560K]
+port=192.168.1.114:2560
+target=a2560
+chunk_size=1024
+
+[profile.broken]
+colour=blue
+`))
+	if err != nil {
+		t.Fatalf("ini.Load() error: %v", err)
+	}
+	cfg := fromINI(iniFile)
+
+	if got := len(cfg.Profiles()); got != 3 {
+		t.Fatalf("Profiles() returned %d profiles, want 3", got)
+	}
+
+	if err := cfg.ApplyProfile("jr"); err != nil {
+		t.Fatalf("ApplyProfile(jr) error: %v", err)
+	}
+	if cfg.Port != "/dev/ttyUSB1" || cfg.LabelFile != "jr.lbl" || cfg.Machine() == nil || cfg.Machine().Name != "f256jr" {
+		t.Errorf("after ApplyProfile(jr): port %s, labels %s, machine %v", cfg.Port, cfg.LabelFile, cfg.Machine())
+	}
+	if cfg.CPU != cfg.Machine().CPU {
+		t.Errorf("CPU = %s, want the machine's %s", cfg.CPU, cfg.Machine().CPU)
+	}
+	if cfg.Profile() == nil || cfg.Profile().Name != "jr" {
+		t.Errorf("Profile() = %v, want jr", cfg.Profile())
+	}
+
+	// Settings override the profile's target machine, whatever their order
+	cfg = fromINI(iniFile)
+	if err := cfg.ApplyProfile("a2560k"); err != nil {
+		t.Fatalf("ApplyProfile(a2560k) error: %v", err)
+	}
+	if cfg.ChunkSize != 1024 {
+		t.Errorf("ChunkSize = %d, want the profile's 1024", cfg.ChunkSize)
+	}
+
+	if err := cfg.ApplyProfile("broken"); err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("ApplyProfile(broken) error = %v, want an unknown key error", err)
+	}
+	if err := cfg.ApplyProfile("c256"); err == nil || !strings.Contains(err.Error(), "a2560k, broken, jr") {
+		t.Errorf("ApplyProfile(c256) error = %v, want the known profiles", err)
+	}
+}
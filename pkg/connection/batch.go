@@ -0,0 +1,200 @@
+package connection
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A batch carries several debug port requests to a bridge in one round trip,
+// so chunked transfers over a high-latency link don't wait a network round
+// trip for every chunk. It is framed as
+//
+//	[0xBA][COUNT_HI][COUNT_LO][request]...[request]
+//
+// and answered with the responses to the requests that completed, in order:
+//
+//	[0xBA][DONE_HI][DONE_LO][response]...[response]
+//
+// DONE is less than COUNT if a request failed; the rest weren't sent.
+const BatchMarker = 0xBA
+
+// MaxBatchRequests is the most requests a bridge accepts in one batch
+const MaxBatchRequests = 256
+
+// BridgeProtocolVersion is the newest bridge protocol: version 1 added
+// batches, version 2 frames (see FrameMarker)
+const BridgeProtocolVersion = 2
+
+// A client asks which bridge protocol a bridge speaks with a hello: a
+// revision request whose address field spells "BAT" and whose length field
+// holds the newest version the client knows (0 for version 1). Bridges
+// answer it themselves with status bytes BatchMarker and the newest version
+// both know; older bridges pass it on, and the machine answers it as a
+// revision request.
+func batchHello(version int) []byte {
+	if version == 1 {
+		version = 0
+	}
+	hello := []byte{0x55, 0xFE, 'B', 'A', 'T', byte(version >> 8), byte(version)}
+	return append(hello, lrcOf(hello))
+}
+
+// helloResponse is a bridge's answer to a hello
+func helloResponse(version int) []byte {
+	response := []byte{0xAA, BatchMarker, byte(version)}
+	return append(response, lrcOf(response))
+}
+
+// parseHello returns the version a hello asks for, or false if the request
+// isn't a hello
+func parseHello(request []byte) (int, bool) {
+	if len(request) != 8 || string(request[:5]) != "\x55\xFEBAT" || request[7] != lrcOf(request[:7]) {
+		return 0, false
+	}
+	version := int(request[5])<<8 | int(request[6])
+	if version == 0 {
+		version = 1
+	}
+	return version, true
+}
+
+// lrcOf returns the XOR of bytes, the LRC of a debug port packet
+func lrcOf(data []byte) byte {
+	lrc := byte(0)
+	for _, b := range data {
+		lrc ^= b
+	}
+	return lrc
+}
+
+// Batcher is implemented by connections that can send several requests in
+// one round trip
+type Batcher interface {
+	// CanBatch reports whether batches can be sent, asking the other end the
+	// first time
+	CanBatch() bool
+
+	// Exchange sends complete request packets together and returns their
+	// raw responses, of responseLengths bytes each. If a request failed, the
+	// responses to the requests before it are returned with the error.
+	Exchange(requests [][]byte, responseLengths []int) ([][]byte, error)
+}
+
+// readBatch reads a batch of requests from a client after its marker byte.
+// It returns the requests and the length of each response.
+func readBatch(r *bufio.Reader) ([][]byte, []int, error) {
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	count := int(binary.BigEndian.Uint16(header[1:]))
+	if count == 0 || count > MaxBatchRequests {
+		return nil, nil, fmt.Errorf("invalid batch of %d requests", count)
+	}
+
+	requests := make([][]byte, count)
+	lengths := make([]int, count)
+	for i := range requests {
+		request, length, err := readRequest(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		requests[i] = request
+		lengths[i] = length
+	}
+	return requests, lengths, nil
+}
+
+// batchResponse frames the responses to a batch
+func batchResponse(responses [][]byte) []byte {
+	framed := []byte{BatchMarker, 0, 0}
+	binary.BigEndian.PutUint16(framed[1:], uint16(len(responses)))
+	for _, response := range responses {
+		framed = append(framed, response...)
+	}
+	return framed
+}
+
+// exchanger sends one request and returns its raw response
+type exchanger func(request []byte, responseLength int) ([]byte, error)
+
+// exchangeError is returned by serveClient when a single request failed
+type exchangeError struct {
+	err error
+}
+
+func (e *exchangeError) Error() string { return e.err.Error() }
+func (e *exchangeError) Unwrap() error { return e.err }
+
+// serveHooks are told about the traffic of serveClient, if set
+type serveHooks struct {
+	batch func() // A batch was received
+	frame func() // A request frame was received
+}
+
+// serveClient answers the requests, batches and frames of one client with
+// exchange until the client disconnects or reading fails. A failed request
+// ends the connection with an *exchangeError; a failed request in a batch or
+// a frame is reported to the client instead.
+func serveClient(client io.ReadWriter, exchange exchanger, hooks serveHooks) error {
+	reader := bufio.NewReader(client)
+	for {
+		next, err := reader.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		var response []byte
+		switch next[0] {
+		case FrameMarker:
+			f, err := readFrame(reader)
+			if err != nil {
+				return err
+			}
+			if hooks.frame != nil {
+				hooks.frame()
+			}
+			response = answerFrame(f, exchange)
+
+		case BatchMarker:
+			requests, lengths, err := readBatch(reader)
+			if err != nil {
+				return err
+			}
+			if hooks.batch != nil {
+				hooks.batch()
+			}
+			var responses [][]byte
+			for i, request := range requests {
+				response, err := exchange(request, lengths[i])
+				if err != nil {
+					break
+				}
+				responses = append(responses, response)
+			}
+			response = batchResponse(responses)
+
+		default:
+			request, responseLength, err := readRequest(reader)
+			if err != nil {
+				return err
+			}
+			if version, ok := parseHello(request); ok {
+				response = helloResponse(min(version, BridgeProtocolVersion))
+			} else if response, err = exchange(request, responseLength); err != nil {
+				if errors.Is(err, ErrBusy) {
+					// Tell the client why the connection ends
+					client.Write(errorFrame(0, err))
+				}
+				return &exchangeError{err}
+			}
+		}
+
+		if _, err := client.Write(response); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package connection
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
 
-	"go.bug.st/serial"
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/metrics"
 )
 
 const (
@@ -14,13 +23,35 @@ const (
 	cmdWriteMem = 0x01
 )
 
-// Bridge represents a TCP-to-serial relay server
+// Bridge represents a TCP-to-serial relay server. The serial port is opened
+// on the first transaction and kept open; if it fails it is reopened for the
+// next transaction. Transactions from concurrent clients are serialized, and
+// one client at a time can be in a debug session (see SetBusyWait).
 type Bridge struct {
 	tcpHost    string
 	tcpPort    int
 	serialPort string
 	baudRate   int
 	timeout    int
+
+	mu     sync.Mutex // Serializes transactions on the serial port
+	serial Connection // Open serial connection, nil until needed
+
+	// Settings the serial port is opened with, if set with SetSerialConfig
+	serialConfig *config.Config
+
+	logger *log.Logger
+	owner  *ownership
+
+	statsMu sync.Mutex
+	stats   BridgeStats
+	clients map[string]time.Time // Connected clients and when they connected
+
+	// Listeners and client connections, closed by Shutdown
+	connsMu   sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	closing   bool
 }
 
 // NewBridge creates a new TCP bridge
@@ -31,9 +62,40 @@ func NewBridge(tcpHost string, tcpPort int, serialPort string, baudRate int, tim
 		serialPort: serialPort,
 		baudRate:   baudRate,
 		timeout:    timeout,
+		logger:     log.New(os.Stdout, "", 0),
+		owner:      newOwnership(serialPort),
+		stats:      BridgeStats{SerialPort: serialPort, Started: time.Now(), Revision: -1},
+		clients:    make(map[string]time.Time),
+		conns:      make(map[net.Conn]bool),
 	}
 }
 
+// SetLogger sets the logger for connections and errors, standard output by
+// default
+func (b *Bridge) SetLogger(logger *log.Logger) {
+	b.logger = logger
+}
+
+// SetSerialConfig sets the settings the serial port is opened with, such as
+// its parity and reconnect timeout. The data rate and timeout given to
+// NewBridge are used otherwise.
+func (b *Bridge) SetSerialConfig(cfg *config.Config) {
+	b.serialConfig = cfg
+}
+
+// SetBusyWait sets how long a client's requests wait while another client
+// owns the bridge. A client owns the bridge from entering debug mode until it
+// exits debug mode or disconnects. Requests that wait longer are refused as
+// busy; by default they are refused at once.
+func (b *Bridge) SetBusyWait(wait time.Duration) {
+	b.owner.setWait(wait)
+}
+
+// logf logs a message
+func (b *Bridge) logf(format string, args ...interface{}) {
+	b.logger.Printf(format, args...)
+}
+
 // Listen starts the TCP server and relays messages to the serial port
 func (b *Bridge) Listen() error {
 	addr := fmt.Sprintf("%s:%d", b.tcpHost, b.tcpPort)
@@ -43,142 +105,360 @@ func (b *Bridge) Listen() error {
 	}
 	defer listener.Close()
 
-	fmt.Printf("Listening for connections to %s on port %d\n", b.tcpHost, b.tcpPort)
+	b.logf("Listening for connections to %s on port %d", b.tcpHost, b.tcpPort)
+	return b.Serve(listener)
+}
+
+// Serve accepts clients on the listener until it is closed, then closes the
+// serial port. After Shutdown it returns nil.
+func (b *Bridge) Serve(listener net.Listener) error {
+	defer b.Close()
+	if !b.track(listener, nil) {
+		listener.Close()
+		return nil
+	}
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			fmt.Printf("Error accepting connection: %v\n", err)
-			continue
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				b.logf("Error accepting connection: %v", err)
+				continue
+			}
+			if b.isClosing() {
+				return nil
+			}
+			return err
+		}
+		if !b.track(nil, conn) {
+			conn.Close()
+			return nil
 		}
 
-		fmt.Printf("Received connection from %s\n", conn.RemoteAddr().String())
+		b.logf("Received connection from %s", conn.RemoteAddr().String())
 
 		// Handle connection in a goroutine to support multiple clients
 		go b.handleConnection(conn)
 	}
 }
 
-// handleConnection processes a single TCP connection
-func (b *Bridge) handleConnection(tcpConn net.Conn) {
-	defer tcpConn.Close()
+// Shutdown stops the bridge: it stops accepting clients, disconnects the
+// connected ones and closes the serial port once the transaction in progress,
+// if any, has finished
+func (b *Bridge) Shutdown() error {
+	b.connsMu.Lock()
+	b.closing = true
+	for _, listener := range b.listeners {
+		listener.Close()
+	}
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.connsMu.Unlock()
 
-	for {
-		// Read 7-byte request header
-		header := make([]byte, 7)
-		if _, err := io.ReadFull(tcpConn, header); err != nil {
-			if err != io.EOF {
-				fmt.Printf("Error reading header: %v\n", err)
-			} else {
-				fmt.Printf("Connection from %s closed\n", tcpConn.RemoteAddr().String())
-			}
-			return
-		}
+	return b.Close()
+}
 
-		command := header[1]
+// track records a listener or client connection for Shutdown. It returns
+// false if the bridge is shutting down.
+func (b *Bridge) track(listener net.Listener, conn net.Conn) bool {
+	b.connsMu.Lock()
+	defer b.connsMu.Unlock()
+	if b.closing {
+		return false
+	}
+	if listener != nil {
+		b.listeners = append(b.listeners, listener)
+	}
+	if conn != nil {
+		b.conns[conn] = true
+	}
+	return true
+}
 
-		// Extract data length from header bytes 5-6 (big-endian)
-		dataLength := uint16(header[5])<<8 | uint16(header[6])
+// isClosing reports whether Shutdown was called
+func (b *Bridge) isClosing() bool {
+	b.connsMu.Lock()
+	defer b.connsMu.Unlock()
+	return b.closing
+}
 
-		// Read data payload if this is a write command
-		var data []byte
-		if command == cmdWriteMem {
-			data = make([]byte, dataLength)
-			if _, err := io.ReadFull(tcpConn, data); err != nil {
-				fmt.Printf("Error reading data: %v\n", err)
-				return
-			}
-		}
+// Close closes the serial port
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-		// Read LRC byte
-		lrcByte := make([]byte, 1)
-		if _, err := io.ReadFull(tcpConn, lrcByte); err != nil {
-			fmt.Printf("Error reading LRC: %v\n", err)
-			return
-		}
+	if b.serial == nil {
+		return nil
+	}
+	err := b.serial.Close()
+	b.serial = nil
+	b.markClosed()
+	return err
+}
 
-		// Construct complete request to send to serial port
-		request := make([]byte, 0, len(header)+len(data)+1)
-		request = append(request, header...)
-		if data != nil {
-			request = append(request, data...)
-		}
-		request = append(request, lrcByte...)
+// handleConnection processes a single TCP connection
+func (b *Bridge) handleConnection(tcpConn net.Conn) {
+	defer func() {
+		tcpConn.Close()
+		b.connsMu.Lock()
+		delete(b.conns, tcpConn)
+		b.connsMu.Unlock()
+	}()
+	setNoDelay(tcpConn)
+
+	client := tcpConn.RemoteAddr().String()
+	b.clientConnected(client)
+	defer b.clientDisconnected(client)
+	defer b.owner.release(client)
+
+	var exchangeErr *exchangeError
+	err := serveClient(tcpConn, b.session(client), serveHooks{batch: b.countBatch, frame: b.countFrame})
+	switch {
+	case err == io.EOF:
+		b.logf("Connection from %s closed", client)
+	case errors.As(err, &exchangeErr):
+		// Already reported by relay
+	case b.isClosing():
+		b.logf("Disconnected %s", client)
+	default:
+		b.logf("Error on connection from %s: %v", client, err)
+	}
+}
 
-		// Open serial port for this transaction
-		mode := &serial.Mode{
-			BaudRate: b.baudRate,
+// session returns the exchanger for client's requests, which wait while
+// another client is in a debug session
+func (b *Bridge) session(client string) exchanger {
+	return func(request []byte, responseLength int) ([]byte, error) {
+		if err := b.owner.acquire(client); err != nil {
+			b.countRefusal()
+			b.logf("Refused request from %s: %v", client, err)
+			return nil, err
 		}
-		serialConn, err := serial.Open(b.serialPort, mode)
-		if err != nil {
-			fmt.Printf("Error opening serial port: %v\n", err)
-			return
+		response, err := b.relay(request, responseLength)
+		if err == nil {
+			b.owner.exchanged(client, request)
 		}
+		return response, err
+	}
+}
 
-		// Send request to serial port
-		numWritten, err := serialConn.Write(request)
-		if err != nil {
-			serialConn.Close()
-			fmt.Printf("Error writing to serial port: %v\n", err)
-			return
+// relay exchanges one request from a client with the serial port, counting
+// the traffic
+func (b *Bridge) relay(request []byte, responseLength int) ([]byte, error) {
+	response, err := b.exchange(request, responseLength)
+	if err != nil {
+		b.countSerialError()
+		b.logf("Serial error: %v", err)
+		return nil, err
+	}
+	b.countPacket(request, response)
+	return response, nil
+}
+
+// exchange sends one request to the serial port and returns the raw response.
+// After a failed exchange the input is flushed; if even that fails the port is
+// closed so the next exchange reopens it.
+func (b *Bridge) exchange(request []byte, responseLength int) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.serial == nil {
+		cfg := b.serialConfig
+		if cfg == nil {
+			cfg = &config.Config{DataRate: b.baudRate, Timeout: b.timeout}
 		}
-		if numWritten != len(request) {
-			serialConn.Close()
-			fmt.Printf("Serial write error: wrote %d bytes, expected %d\n", numWritten, len(request))
-			return
+		conn := NewConnection(b.serialPort, cfg)
+		if err := conn.Open(b.serialPort); err != nil {
+			return nil, err
 		}
+		b.serial = conn
+		b.countOpen()
+	}
 
-		// Read response from serial port
-		// 1. Sync byte
-		responseSyncByte := make([]byte, 1)
-		if _, err := io.ReadFull(serialConn, responseSyncByte); err != nil {
-			serialConn.Close()
-			fmt.Printf("Error reading response sync: %v\n", err)
-			return
-		}
+	if _, err := b.serial.Write(request); err != nil {
+		b.dropSerial()
+		return nil, err
+	}
 
-		// 2. Two status bytes
-		responseStatusBytes := make([]byte, 2)
-		if _, err := io.ReadFull(serialConn, responseStatusBytes); err != nil {
-			serialConn.Close()
-			fmt.Printf("Error reading status bytes: %v\n", err)
-			return
+	response, err := b.serial.Read(responseLength)
+	if err != nil {
+		if flushErr := b.serial.Flush(); flushErr != nil {
+			b.dropSerial()
 		}
+		return nil, err
+	}
+	return response, nil
+}
 
-		// 3. Data payload (only for read commands)
-		var responseData []byte
-		if command == cmdReadMem && dataLength > 0 {
-			responseData = make([]byte, dataLength)
-			if _, err := io.ReadFull(serialConn, responseData); err != nil {
-				serialConn.Close()
-				fmt.Printf("Error reading response data: %v\n", err)
-				return
-			}
-		}
+// dropSerial closes a failed serial port so the next exchange reopens it
+func (b *Bridge) dropSerial() {
+	b.logf("Closing serial port %s, it will be reopened for the next request", b.serialPort)
+	b.serial.Close()
+	b.serial = nil
+	b.markClosed()
+}
 
-		// 4. Response LRC byte
-		responseLrcByte := make([]byte, 1)
-		if _, err := io.ReadFull(serialConn, responseLrcByte); err != nil {
-			serialConn.Close()
-			fmt.Printf("Error reading response LRC: %v\n", err)
-			return
-		}
+// BridgeStats describes the state and traffic of a bridge
+type BridgeStats struct {
+	SerialPort   string    `json:"serial_port"`
+	SerialOpen   bool      `json:"serial_open"`
+	Started      time.Time `json:"started"`
+	Uptime       float64   `json:"uptime_seconds"`
+	Clients      []string  `json:"clients"` // Connected client addresses
+	TotalClients int       `json:"total_clients"`
+	Packets      int64     `json:"packets"`    // Requests relayed successfully
+	Batches      int64     `json:"batches"`    // Batches of requests received
+	Frames       int64     `json:"frames"`     // Request frames received
+	BytesSent    int64     `json:"bytes_sent"` // Bytes written to the serial port
+	BytesRecv    int64     `json:"bytes_received"`
+	SerialErrors int64     `json:"serial_errors"`
+	SerialOpens  int64     `json:"serial_opens"` // Times the serial port was (re)opened
+	Throughput   float64   `json:"throughput_bytes_per_second"`
+	LastResponse time.Time `json:"last_response"` // When the machine last answered
+	Revision     int       `json:"revision"`      // Last debug port revision relayed, -1 if none
+	Owner        string    `json:"owner"`         // Client in a debug session, "" if none
+	Refusals     int64     `json:"busy_refusals"` // Requests refused during another client's session
+}
 
-		serialConn.Close()
+// revisionCommand is the debug port command that reads the revision, which
+// the bridge notes as it relays the response
+const revisionCommand = 0xFE
 
-		// Construct complete response
-		response := make([]byte, 0, 1+2+len(responseData)+1)
-		response = append(response, responseSyncByte...)
-		response = append(response, responseStatusBytes...)
-		if responseData != nil {
-			response = append(response, responseData...)
-		}
-		response = append(response, responseLrcByte...)
+// Stats returns a snapshot of the bridge's statistics. Throughput is the
+// average of both directions since the bridge started.
+func (b *Bridge) Stats() BridgeStats {
+	b.statsMu.Lock()
+	stats := b.stats
+	stats.Clients = make([]string, 0, len(b.clients))
+	for client := range b.clients {
+		stats.Clients = append(stats.Clients, client)
+	}
+	b.statsMu.Unlock()
 
-		// Send response back to TCP client
-		if _, err := tcpConn.Write(response); err != nil {
-			fmt.Printf("Error writing response to TCP: %v\n", err)
-			return
-		}
+	sort.Strings(stats.Clients)
+	stats.Owner = b.owner.current()
+	stats.Uptime = time.Since(stats.Started).Seconds()
+	if stats.Uptime > 0 {
+		stats.Throughput = float64(stats.BytesSent+stats.BytesRecv) / stats.Uptime
+	}
+	return stats
+}
+
+// StatusHandler serves the bridge statistics as JSON at /status, and as
+// Prometheus metrics at /metrics
+func (b *Bridge) StatusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(b.Stats())
+	})
+	mux.HandleFunc("/metrics", metrics.Handler(b.writeMetrics))
+	return mux
+}
+
+// writeMetrics writes the bridge statistics as Prometheus metrics, labelled
+// with the serial port
+func (b *Bridge) writeMetrics(m *metrics.Writer) {
+	stats := b.Stats()
+	port := metrics.Label{Name: "serial_port", Value: stats.SerialPort}
+	open := 0.0
+	if stats.SerialOpen {
+		open = 1
 	}
+
+	m.Gauge("foenixmgr_bridge_uptime_seconds", "Seconds since the bridge started", stats.Uptime, port)
+	m.Gauge("foenixmgr_bridge_clients", "Clients connected to the bridge", float64(len(stats.Clients)), port)
+	m.Counter("foenixmgr_bridge_clients_total", "Client connections accepted", float64(stats.TotalClients), port)
+	m.Counter("foenixmgr_bridge_requests_total", "Requests relayed successfully", float64(stats.Packets), port)
+	m.Counter("foenixmgr_bridge_batches_total", "Batches of requests received", float64(stats.Batches), port)
+	m.Counter("foenixmgr_bridge_frames_total", "Request frames received", float64(stats.Frames), port)
+	m.Counter("foenixmgr_bridge_sent_bytes_total", "Bytes written to the serial port", float64(stats.BytesSent), port)
+	m.Counter("foenixmgr_bridge_received_bytes_total", "Bytes read from the serial port", float64(stats.BytesRecv), port)
+	m.Counter("foenixmgr_bridge_serial_errors_total", "Failed serial exchanges", float64(stats.SerialErrors), port)
+	m.Counter("foenixmgr_bridge_serial_opens_total", "Times the serial port was opened", float64(stats.SerialOpens), port)
+	m.Counter("foenixmgr_bridge_busy_refusals_total", "Requests refused during another client's debug session", float64(stats.Refusals), port)
+	m.Gauge("foenixmgr_bridge_serial_open", "1 if the serial port is open", open, port)
+	m.Timestamp("foenixmgr_bridge_last_response_timestamp_seconds", "When the machine last answered a request, 0 if never", stats.LastResponse, port)
+	if stats.Revision >= 0 {
+		m.Gauge("foenixmgr_bridge_revision", "Debug port revision last relayed", float64(stats.Revision), port)
+	}
+}
+
+// ServeStatus serves the status endpoint on addr until the listener fails
+func (b *Bridge) ServeStatus(addr string) error {
+	return http.ListenAndServe(addr, b.StatusHandler())
+}
+
+// clientConnected records a new client connection
+func (b *Bridge) clientConnected(client string) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.clients[client] = time.Now()
+	b.stats.TotalClients++
+}
+
+// clientDisconnected records that a client has gone
+func (b *Bridge) clientDisconnected(client string) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	delete(b.clients, client)
+}
+
+// countPacket records a relayed request and its response, and the revision
+// in the response to a revision request
+func (b *Bridge) countPacket(request, response []byte) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.Packets++
+	b.stats.BytesSent += int64(len(request))
+	b.stats.BytesRecv += int64(len(response))
+	b.stats.LastResponse = time.Now()
+	if len(request) > 1 && request[1] == revisionCommand && len(response) > 2 {
+		b.stats.Revision = int(response[2])
+	}
+}
+
+// countBatch records a batch of requests
+func (b *Bridge) countBatch() {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.Batches++
+}
+
+// countFrame records a request frame
+func (b *Bridge) countFrame() {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.Frames++
+}
+
+// countRefusal records a request refused during another client's debug
+// session
+func (b *Bridge) countRefusal() {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.Refusals++
+}
+
+// countSerialError records a failed serial exchange
+func (b *Bridge) countSerialError() {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.SerialErrors++
+}
+
+// countOpen records that the serial port was opened. Called with b.mu held.
+func (b *Bridge) countOpen() {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.SerialOpens++
+	b.stats.SerialOpen = true
+}
+
+// markClosed records that the serial port was closed
+func (b *Bridge) markClosed() {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	b.stats.SerialOpen = false
 }
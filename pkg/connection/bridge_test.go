@@ -0,0 +1,450 @@
+package connection_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// startBridge serves a bridge to a mock device on a local port
+func startBridge(t *testing.T) string {
+	addr, _ := startBridgeWithStats(t)
+	return addr
+}
+
+// startBridgeWithStats is startBridge that also returns the bridge
+func startBridgeWithStats(t *testing.T) (string, *connection.Bridge) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := connection.NewBridge("127.0.0.1", 0, "mock:", 115200, 1)
+	go bridge.Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+
+	return listener.Addr().String(), bridge
+}
+
+// dialBridge returns a debug port talking to the bridge at addr
+func dialBridge(t *testing.T, addr string) *protocol.DebugPort {
+	t.Helper()
+
+	conn := &connection.TCPConnection{}
+	if err := conn.Open(addr); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return protocol.NewDebugPort(conn, testConfig())
+}
+
+func TestBridgeKeepsSerialPortOpen(t *testing.T) {
+	addr := startBridge(t)
+
+	// The mock device only keeps its memory while the bridge holds it open,
+	// so a second client sees what the first one wrote
+	writer := dialBridge(t, addr)
+	if err := writer.WriteBlock(0x2000, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("WriteBlock() error: %v", err)
+	}
+
+	reader := dialBridge(t, addr)
+	data, err := reader.ReadBlock(0x2000, 3)
+	if err != nil {
+		t.Fatalf("ReadBlock() error: %v", err)
+	}
+	if !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Errorf("ReadBlock() = % X, want 01 02 03", data)
+	}
+}
+
+func TestBridgeSerializesClients(t *testing.T) {
+	addr := startBridge(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		dp := dialBridge(t, addr)
+		address := uint32(0x1000 * (i + 1))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			want := bytes.Repeat([]byte{byte(address >> 12)}, 0x100)
+			for n := 0; n < 20; n++ {
+				if err := dp.WriteBlock(address, want); err != nil {
+					errs <- err
+					return
+				}
+				got, err := dp.ReadBlock(address, 0x100)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(got, want) {
+					errs <- fmt.Errorf("client at %X read back wrong data", address)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestBridgeStatus(t *testing.T) {
+	addr, bridge := startBridgeWithStats(t)
+
+	dp := dialBridge(t, addr)
+	if err := dp.WriteBlock(0x2000, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dp.ReadBlock(0x2000, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(bridge.StatusHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var stats connection.BridgeStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+
+	// Write: 11 bytes out, 4 back. Read: 8 bytes out, 7 back.
+	if stats.Packets != 2 || stats.BytesSent != 19 || stats.BytesRecv != 11 {
+		t.Errorf("traffic = %d packets, %d sent, %d received; want 2, 19, 11",
+			stats.Packets, stats.BytesSent, stats.BytesRecv)
+	}
+	if len(stats.Clients) != 1 || stats.TotalClients != 1 {
+		t.Errorf("clients = %v (total %d), want 1", stats.Clients, stats.TotalClients)
+	}
+	if !stats.SerialOpen || stats.SerialOpens != 1 || stats.SerialErrors != 0 {
+		t.Errorf("serial = open %v, opens %d, errors %d", stats.SerialOpen, stats.SerialOpens, stats.SerialErrors)
+	}
+}
+
+func TestBridgeMetrics(t *testing.T) {
+	addr, bridge := startBridgeWithStats(t)
+
+	server := httptest.NewServer(bridge.StatusHandler())
+	defer server.Close()
+	get := func() string {
+		resp, err := http.Get(server.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// Nothing has been relayed, so no revision is known
+	before := get()
+	if !strings.Contains(before, `foenixmgr_bridge_last_response_timestamp_seconds{serial_port="mock:"} 0`) ||
+		strings.Contains(before, "foenixmgr_bridge_revision") {
+		t.Errorf("metrics before any request:\n%s", before)
+	}
+
+	revision, err := dialBridge(t, addr).GetRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := get()
+	for _, want := range []string{
+		`foenixmgr_bridge_requests_total{serial_port="mock:"} 1`,
+		`foenixmgr_bridge_clients{serial_port="mock:"} 1`,
+		`foenixmgr_bridge_serial_open{serial_port="mock:"} 1`,
+		fmt.Sprintf(`foenixmgr_bridge_revision{serial_port="mock:"} %d`, revision),
+		"# TYPE foenixmgr_bridge_serial_errors_total counter",
+	} {
+		if !strings.Contains(after, want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, after)
+		}
+	}
+	if bridge.Stats().LastResponse.IsZero() {
+		t.Error("LastResponse wasn't set")
+	}
+}
+
+func TestBridgePipelining(t *testing.T) {
+	addr, bridge := startBridgeWithStats(t)
+
+	conn := &connection.TCPConnection{}
+	if err := conn.Open(addr); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if !conn.CanBatch() {
+		t.Fatal("CanBatch() = false for a bridge that takes request frames")
+	}
+
+	cfg := testConfig()
+	cfg.ChunkSize = 64
+	cfg.BatchRequests = 4
+	dp := protocol.NewDebugPort(conn, cfg)
+
+	// 1000 bytes are 16 chunks each way
+	want := make([]byte, 1000)
+	for i := range want {
+		want[i] = byte(i * 7)
+	}
+	if err := dp.WriteRange(0x3000, want); err != nil {
+		t.Fatalf("WriteRange() error: %v", err)
+	}
+	got, err := dp.ReadRange(0x3000, uint32(len(want)))
+	if err != nil {
+		t.Fatalf("ReadRange() error: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("ReadRange() returned different data than was written")
+	}
+
+	stats := bridge.Stats()
+	if stats.Frames != 32 || stats.Packets != 32 {
+		t.Errorf("bridge relayed %d frames, %d packets; want 32, 32", stats.Frames, stats.Packets)
+	}
+}
+
+func TestBridgeErrorFrames(t *testing.T) {
+	addr := startBridge(t)
+	conn := &connection.TCPConnection{}
+	if err := conn.Open(addr); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if !conn.CanBatch() {
+		t.Fatal("CanBatch() = false")
+	}
+
+	revision := []byte{0x55, 0xFE, 0, 0, 0, 0, 0, 0x55 ^ 0xFE}
+	responses, err := conn.Exchange([][]byte{revision, []byte("garbage"), revision}, []int{4, 4, 4})
+	if err == nil || len(responses) != 1 {
+		t.Fatalf("Exchange() with a bad request = %d responses, %v; want 1 and an error", len(responses), err)
+	}
+
+	// The requests after the failed one were answered, so the next exchange
+	// is in step
+	responses, err = conn.Exchange([][]byte{revision, revision}, []int{4, 4})
+	if err != nil || len(responses) != 2 || responses[1][0] != 0xAA {
+		t.Errorf("Exchange() after an error frame = % X, %v", responses, err)
+	}
+}
+
+func TestBridgeVersion1Batches(t *testing.T) {
+	addr := startBridge(t)
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A version 1 hello is answered with version 1
+	hello := []byte{0x55, 0xFE, 'B', 'A', 'T', 0, 0, 0x55 ^ 0xFE ^ 'B' ^ 'A' ^ 'T'}
+	if _, err := client.Write(hello); err != nil {
+		t.Fatal(err)
+	}
+	response := make([]byte, 4)
+	if _, err := io.ReadFull(client, response); err != nil || !bytes.Equal(response, []byte{0xAA, 0xBA, 1, 0xAA ^ 0xBA ^ 1}) {
+		t.Fatalf("hello response = % X, %v", response, err)
+	}
+
+	revision := []byte{0x55, 0xFE, 0, 0, 0, 0, 0, 0x55 ^ 0xFE}
+	batch := append([]byte{0xBA, 0, 2}, append(revision, revision...)...)
+	if _, err := client.Write(batch); err != nil {
+		t.Fatal(err)
+	}
+	response = make([]byte, 3+2*4)
+	if _, err := io.ReadFull(client, response); err != nil || !bytes.Equal(response[:3], []byte{0xBA, 0, 2}) {
+		t.Errorf("batch response = % X, %v", response, err)
+	}
+}
+
+func TestBatchHelloToOldBridge(t *testing.T) {
+	// An old bridge passes the hello on, and the machine answers it as a
+	// revision request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		client, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(client, request); err == nil {
+			client.Write([]byte{0xAA, 0x00, 0x01, 0xAB})
+		}
+		io.Copy(io.Discard, client)
+	}()
+
+	conn := &connection.TCPConnection{}
+	if err := conn.Open(listener.Addr().String()); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	defer conn.Close()
+	if conn.CanBatch() {
+		t.Error("CanBatch() = true for a bridge that doesn't take batches")
+	}
+}
+
+func TestBridgeShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := connection.NewBridge("127.0.0.1", 0, "mock:", 115200, 1)
+	bridge.SetLogger(log.New(io.Discard, "", 0))
+	served := make(chan error, 1)
+	go func() { served <- bridge.Serve(listener) }()
+
+	client := dialBridge(t, listener.Addr().String())
+	if _, err := client.ReadBlock(0x2000, 4); err != nil {
+		t.Fatalf("ReadBlock() error: %v", err)
+	}
+
+	if err := bridge.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve() = %v after Shutdown, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve() didn't return after Shutdown")
+	}
+
+	// The client was disconnected, and no new clients are accepted
+	if _, err := client.ReadBlock(0x2000, 4); err == nil {
+		t.Error("ReadBlock() after Shutdown succeeded")
+	}
+	if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("bridge accepted a connection after Shutdown")
+	}
+}
+
+func TestBridgeDebugSession(t *testing.T) {
+	addr, bridge := startBridgeWithStats(t)
+	owner := dialBridge(t, addr)
+	other := dialBridge(t, addr)
+
+	// Outside a debug session both clients are served
+	if _, err := other.ReadBlock(0x2000, 4); err != nil {
+		t.Fatalf("ReadBlock() outside a session: %v", err)
+	}
+
+	if err := owner.EnterDebug(); err != nil {
+		t.Fatalf("EnterDebug() error: %v", err)
+	}
+	_, err := other.ReadBlock(0x2000, 4)
+	if !errors.Is(err, connection.ErrBusy) {
+		t.Fatalf("ReadBlock() during another client's session = %v, want ErrBusy", err)
+	}
+	if stats := bridge.Stats(); stats.Owner == "" || stats.Refusals != 1 {
+		t.Errorf("stats owner %q, %d refusals; want an owner and 1", stats.Owner, stats.Refusals)
+	}
+
+	// A request frame is refused without ending the connection
+	conn := &connection.TCPConnection{}
+	if err := conn.Open(addr); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	revision := []byte{0x55, 0xFE, 0, 0, 0, 0, 0, 0x55 ^ 0xFE}
+	if !conn.CanBatch() {
+		t.Fatal("CanBatch() = false")
+	}
+	if _, err := conn.Exchange([][]byte{revision}, []int{4}); !errors.Is(err, connection.ErrBusy) {
+		t.Errorf("Exchange() during another client's session = %v, want ErrBusy", err)
+	}
+
+	if err := owner.ExitDebug(); err != nil {
+		t.Fatalf("ExitDebug() error: %v", err)
+	}
+	if _, err := conn.Exchange([][]byte{revision}, []int{4}); err != nil {
+		t.Errorf("Exchange() after the session ended: %v", err)
+	}
+}
+
+func TestBridgeQueuesForSession(t *testing.T) {
+	addr, bridge := startBridgeWithStats(t)
+	bridge.SetBusyWait(5 * time.Second)
+
+	owner := &connection.TCPConnection{}
+	if err := owner.Open(addr); err != nil {
+		t.Fatal(err)
+	}
+	ownerPort := protocol.NewDebugPort(owner, testConfig())
+	if err := ownerPort.EnterDebug(); err != nil {
+		t.Fatalf("EnterDebug() error: %v", err)
+	}
+
+	// The session ends when its client disconnects
+	time.AfterFunc(100*time.Millisecond, func() { owner.Close() })
+	start := time.Now()
+	if _, err := dialBridge(t, addr).ReadBlock(0x2000, 4); err != nil {
+		t.Fatalf("ReadBlock() waiting for the session: %v", err)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("ReadBlock() returned after %v, before the session ended", waited)
+	}
+}
+
+func TestRelayLocalSocket(t *testing.T) {
+	device := connection.NewMockConnection(testConfig())
+	if err := device.Open(connection.MockPrefix); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "session.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("local sockets not available: %v", err)
+	}
+	go connection.NewRelay(device).Serve(listener)
+	t.Cleanup(func() { listener.Close() })
+
+	port := connection.SocketPrefix + socket
+	if !connection.IsTCPPort(port) {
+		t.Errorf("IsTCPPort(%s) = false, want a socket to be connected to like a bridge", port)
+	}
+	writer := dialBridge(t, port)
+	if err := writer.WriteBlock(0x2000, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("WriteBlock() error: %v", err)
+	}
+	data, err := dialBridge(t, port).ReadBlock(0x2000, 3)
+	if err != nil {
+		t.Fatalf("ReadBlock() error: %v", err)
+	}
+	if !bytes.Equal(data, []byte{1, 2, 3}) {
+		t.Errorf("ReadBlock() = % X, want 01 02 03", data)
+	}
+}
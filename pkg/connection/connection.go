@@ -2,8 +2,10 @@
 package connection
 
 import (
+	"context"
 	"fmt"
-	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
 )
 
 // Connection defines the interface for communicating with Foenix debug port
@@ -25,18 +27,45 @@ type Connection interface {
 	// Write writes all data to the connection
 	// Returns number of bytes written and error
 	Write(data []byte) (int, error)
+
+	// Flush discards any received data that hasn't been read yet
+	// Used to resynchronize after a failed or partial transfer
+	Flush() error
+}
+
+// ContextOpener is implemented by connections whose Open can be abandoned
+// when a context is done, such as TCP connections that are still dialing
+type ContextOpener interface {
+	OpenContext(ctx context.Context, port string) error
+}
+
+// OpenContext opens conn, giving up when ctx is done if the connection
+// supports it
+func OpenContext(ctx context.Context, conn Connection, port string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if opener, ok := conn.(ContextOpener); ok {
+		return opener.OpenContext(ctx, port)
+	}
+	return conn.Open(port)
 }
 
 // NewConnection creates the appropriate connection type based on the port string
+// If port starts with "mock:", creates a simulated device (see MockConnection)
 // If port contains ':', creates a TCP connection (e.g., "192.168.1.114:2560")
 // Otherwise, creates a serial port connection (e.g., "COM3", "/dev/ttyUSB0")
-func NewConnection(port string) Connection {
-	if strings.Contains(port, ":") {
+// using the data rate and timeout from cfg
+func NewConnection(port string, cfg *config.Config) Connection {
+	if IsMockPort(port) {
+		return NewMockConnection(cfg)
+	}
+	if IsTCPPort(port) {
 		// TCP connection detected
-		return &TCPConnection{}
+		return NewTCPConnection(cfg)
 	}
 	// Serial connection
-	return &SerialConnection{}
+	return NewSerialConnection(cfg)
 }
 
 // ValidatePort performs basic validation on a port string
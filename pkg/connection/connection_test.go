@@ -0,0 +1,63 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestOpenContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn := &TCPConnection{}
+	if err := OpenContext(context.Background(), conn, listener.Addr().String()); err != nil {
+		t.Fatalf("OpenContext() error: %v", err)
+	}
+	conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := OpenContext(ctx, &TCPConnection{}, listener.Addr().String()); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenContext() with a cancelled context = %v, want context.Canceled", err)
+	}
+
+	// Connections without OpenContext are opened normally
+	mock := NewMockConnection(nil)
+	if err := OpenContext(context.Background(), mock, MockPrefix); err != nil || !mock.IsOpen() {
+		t.Errorf("OpenContext() of a mock = %v", err)
+	}
+}
+
+func TestTCPReadTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn := &TCPConnection{timeout: 50 * time.Millisecond}
+	if err := conn.Open(listener.Addr().String()); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := conn.Read(1); err == nil {
+		t.Fatal("Read() from a silent server should time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Read() gave up after %v", elapsed)
+	}
+
+	if got := NewTCPConnection(&config.Config{Timeout: 5}).timeout; got != 5*time.Second {
+		t.Errorf("NewTCPConnection() timeout = %v, want 5s", got)
+	}
+}
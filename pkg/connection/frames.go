@@ -0,0 +1,129 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version 2 of the bridge protocol carries requests in length-prefixed
+// frames:
+//
+//	[0xB2][TYPE][SEQ_HI][SEQ_LO][LENGTH (4 bytes)][payload]
+//
+// A request frame holds one debug port request packet. The bridge answers
+// every request frame, in the order they arrive, with a response frame
+// holding the raw response or an error frame holding a message, under the
+// request's sequence number. A client doesn't have to wait for an answer
+// before sending the next request, and a failed request doesn't end the
+// connection. Raw requests, batches and frames can be mixed on a connection.
+//
+// A request refused because another client is using the device is answered
+// with a busy frame. A raw request refused that way is answered with a busy
+// frame in place of the response, and the connection is closed.
+const FrameMarker = 0xB2
+
+// Frame types
+const (
+	frameRequest  = 0x01
+	frameResponse = 0x02
+	frameError    = 0x03
+	frameBusy     = 0x04 // An error frame: another client is using the device
+)
+
+// frameHeaderSize is the size of a frame header
+const frameHeaderSize = 8
+
+// maxFramePayload is the largest frame payload, enough for a request that
+// carries MaxTransferSize bytes
+const maxFramePayload = 0x10000 + 16
+
+// frame is a bridge protocol version 2 frame
+type frame struct {
+	kind    byte
+	seq     uint16
+	payload []byte
+}
+
+// encodeFrame returns a frame as bytes, written in one go
+func encodeFrame(f frame) []byte {
+	encoded := make([]byte, frameHeaderSize, frameHeaderSize+len(f.payload))
+	encoded[0] = FrameMarker
+	encoded[1] = f.kind
+	binary.BigEndian.PutUint16(encoded[2:], f.seq)
+	binary.BigEndian.PutUint32(encoded[4:], uint32(len(f.payload)))
+	return append(encoded, f.payload...)
+}
+
+// readFrame reads one frame
+func readFrame(r io.Reader) (frame, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return frame{}, err
+	}
+	if header[0] != FrameMarker {
+		return frame{}, fmt.Errorf("invalid frame marker 0x%02X", header[0])
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if length > maxFramePayload {
+		return frame{}, fmt.Errorf("frame of %d bytes is too large", length)
+	}
+
+	f := frame{kind: header[1], seq: binary.BigEndian.Uint16(header[2:]), payload: make([]byte, length)}
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// errorFrame returns the error or busy frame reporting err
+func errorFrame(seq uint16, err error) []byte {
+	kind := byte(frameError)
+	if errors.Is(err, ErrBusy) {
+		kind = frameBusy
+	}
+	return encodeFrame(frame{kind: kind, seq: seq, payload: []byte(err.Error())})
+}
+
+// bridgeError is an error reported by a bridge in an error or busy frame
+type bridgeError struct {
+	message string
+	busy    bool
+}
+
+func (e *bridgeError) Error() string { return "bridge: " + e.message }
+
+// Is makes errors.Is(err, ErrBusy) true for a busy frame
+func (e *bridgeError) Is(target error) bool { return e.busy && target == ErrBusy }
+
+// frameErr returns the error an error or busy frame carries
+func frameErr(f frame) error {
+	return &bridgeError{message: string(f.payload), busy: f.kind == frameBusy}
+}
+
+// answerFrame exchanges the request in a frame and returns the response or
+// error frame that answers it
+func answerFrame(f frame, exchange exchanger) []byte {
+	fail := func(err error) []byte {
+		return errorFrame(f.seq, err)
+	}
+	if f.kind != frameRequest {
+		return fail(fmt.Errorf("unexpected frame type 0x%02X", f.kind))
+	}
+
+	payload := bytes.NewReader(f.payload)
+	reader := bufio.NewReader(payload)
+	request, responseLength, err := readRequest(reader)
+	if err != nil || reader.Buffered() > 0 || payload.Len() > 0 {
+		return fail(fmt.Errorf("frame doesn't hold one request packet"))
+	}
+
+	response, err := exchange(request, responseLength)
+	if err != nil {
+		return fail(err)
+	}
+	return encodeFrame(frame{kind: frameResponse, seq: f.seq, payload: response})
+}
@@ -0,0 +1,312 @@
+package connection
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// MockPrefix selects the mock connection in a port string, e.g. "mock:"
+const MockPrefix = "mock:"
+
+// Debug port protocol values used by the mock. They mirror the constants of
+// the protocol package, which imports this one.
+const (
+	mockRequestSync  = 0x55
+	mockResponseSync = 0xAA
+
+	mockReadMem       = 0x00
+	mockWriteMem      = 0x01
+	mockProgramFlash  = 0x10
+	mockEraseFlash    = 0x11
+	mockEraseSector   = 0x12
+	mockProgramSector = 0x13
+	mockStopCPU       = 0x20
+	mockStartCPU      = 0x21
+	mockEnterDebug    = 0x80
+	mockExitDebug     = 0x81
+	mockBootRAM       = 0x90
+	mockBootFlash     = 0x91
+	mockRevision      = 0xFE
+)
+
+// MockMemorySize is the size of the mock's address space (24-bit addresses)
+const MockMemorySize = 1 << 24
+
+// mockSectorBuffer is the RAM buffer a flash page is programmed from
+const mockSectorBuffer = 0x2000
+
+// MockRevision is the debug interface revision the mock reports (RevC4A)
+const MockRevision = 0x01
+
+// MockConnection simulates a Foenix debug port in memory, so commands can be
+// run without hardware. It models 16MB of RAM and a flash chip mapped into
+// the address space at the configured flash address. Flash can only be
+// changed by the erase and program commands; programming clears bits like
+// real flash does, so unerased flash doesn't take new data.
+type MockConnection struct {
+	isOpen bool
+
+	memory     []byte
+	flash      []byte
+	flashBase  uint32
+	inDebug    bool
+	stopped    bool
+	bootSource byte
+
+	input  []byte // Request bytes not yet processed
+	output []byte // Response bytes not yet read
+}
+
+// NewMockConnection creates a mock device with the flash size and address
+// from cfg
+func NewMockConnection(cfg *config.Config) *MockConnection {
+	flashSize := 524288
+	flashBase := uint64(0x080000)
+	if cfg != nil {
+		if cfg.FlashSize > 0 {
+			flashSize = cfg.FlashSize
+		}
+		if base, err := strconv.ParseUint(cfg.FlashAddress, 16, 32); err == nil {
+			flashBase = base
+		}
+	}
+
+	m := &MockConnection{
+		memory:    make([]byte, MockMemorySize),
+		flash:     make([]byte, flashSize),
+		flashBase: uint32(flashBase),
+	}
+	for i := range m.flash {
+		m.flash[i] = 0xFF
+	}
+	return m
+}
+
+// IsMockPort returns true if a port string selects the mock connection
+func IsMockPort(port string) bool {
+	return strings.HasPrefix(strings.ToLower(port), MockPrefix)
+}
+
+// Open opens the mock device. The port string is not used.
+func (m *MockConnection) Open(port string) error {
+	m.isOpen = true
+	return nil
+}
+
+// Close closes the mock device. Its memory is kept.
+func (m *MockConnection) Close() error {
+	m.isOpen = false
+	m.input = nil
+	m.output = nil
+	return nil
+}
+
+// IsOpen returns true if the connection is currently open
+func (m *MockConnection) IsOpen() bool {
+	return m.isOpen
+}
+
+// Read returns n bytes of the responses to earlier requests. Asking for more
+// than has been sent fails like a read timeout.
+func (m *MockConnection) Read(n int) ([]byte, error) {
+	if !m.isOpen {
+		return nil, fmt.Errorf("mock connection not open")
+	}
+	if len(m.output) < n {
+		return nil, fmt.Errorf("mock read timeout: %d bytes available, %d requested", len(m.output), n)
+	}
+	buf := m.output[:n]
+	m.output = m.output[n:]
+	return buf, nil
+}
+
+// Write sends request bytes to the mock device, which answers every complete
+// request packet
+func (m *MockConnection) Write(data []byte) (int, error) {
+	if !m.isOpen {
+		return 0, fmt.Errorf("mock connection not open")
+	}
+	m.input = append(m.input, data...)
+	m.process()
+	return len(data), nil
+}
+
+// Flush discards unread responses and any partial request
+func (m *MockConnection) Flush() error {
+	m.input = nil
+	m.output = nil
+	return nil
+}
+
+// Memory returns the mock's RAM, for inspection in tests
+func (m *MockConnection) Memory() []byte {
+	return m.memory
+}
+
+// Flash returns the contents of the mock's flash, for inspection in tests
+func (m *MockConnection) Flash() []byte {
+	return m.flash
+}
+
+// InDebug returns true if the mock is in debug mode
+func (m *MockConnection) InDebug() bool {
+	return m.inDebug
+}
+
+// Stopped returns true if the mock's CPU has been stopped
+func (m *MockConnection) Stopped() bool {
+	return m.stopped
+}
+
+// BootSource returns the last boot source selected (0 RAM, 1 flash)
+func (m *MockConnection) BootSource() byte {
+	return m.bootSource
+}
+
+// process handles every complete request packet in the input buffer.
+// Request: [0x55][CMD][ADDR(3)][LEN(2)][DATA...][LRC]
+func (m *MockConnection) process() {
+	for {
+		// Skip noise up to the next sync byte
+		for len(m.input) > 0 && m.input[0] != mockRequestSync {
+			m.input = m.input[1:]
+		}
+		if len(m.input) < 7 {
+			return
+		}
+
+		command := m.input[1]
+		address := uint32(m.input[2])<<16 | uint32(m.input[3])<<8 | uint32(m.input[4])
+		length := int(binary.BigEndian.Uint16(m.input[5:7]))
+
+		dataLength := 0
+		if command == mockWriteMem {
+			dataLength = length
+		}
+		packetLength := 7 + dataLength + 1
+		if len(m.input) < packetLength {
+			return
+		}
+
+		packet := m.input[:packetLength]
+		m.input = m.input[packetLength:]
+
+		// A packet with a bad LRC is ignored, so the host times out. The LRC
+		// covers the first six header bytes and the data, as the host
+		// computes it.
+		lrc := byte(0)
+		for _, b := range packet[:6] {
+			lrc ^= b
+		}
+		for _, b := range packet[7 : packetLength-1] {
+			lrc ^= b
+		}
+		if lrc != packet[packetLength-1] {
+			continue
+		}
+
+		m.respond(m.execute(command, address, length, packet[7:7+dataLength]))
+	}
+}
+
+// execute runs one command and returns the response status bytes and data
+func (m *MockConnection) execute(command byte, address uint32, length int, data []byte) (byte, byte, []byte) {
+	switch command {
+	case mockReadMem:
+		return 0, 0, m.read(address, length)
+	case mockWriteMem:
+		m.write(address, data)
+	case mockEraseFlash:
+		m.erase(0, len(m.flash))
+	case mockEraseSector:
+		// The address selects a 4KB block in bits 16-23
+		m.erase(int(address>>16)*0x1000, 0x1000)
+	case mockProgramFlash:
+		m.program(0, m.read(address, len(m.flash)))
+	case mockProgramSector:
+		// The address selects the 8KB page as two 4KB blocks
+		m.program(int(address>>16)*0x1000, m.memory[:mockSectorBuffer])
+	case mockStopCPU:
+		m.stopped = true
+	case mockStartCPU:
+		m.stopped = false
+	case mockEnterDebug:
+		m.inDebug = true
+	case mockExitDebug:
+		// Leaving debug mode resets the CPU
+		m.inDebug = false
+		m.stopped = false
+	case mockBootRAM:
+		m.bootSource = 0
+	case mockBootFlash:
+		m.bootSource = 1
+	case mockRevision:
+		return 0, MockRevision, nil
+	}
+	return 0, 0, nil
+}
+
+// respond queues a response packet: [0xAA][STATUS0][STATUS1][DATA...][LRC]
+func (m *MockConnection) respond(status0, status1 byte, data []byte) {
+	packet := append([]byte{mockResponseSync, status0, status1}, data...)
+	lrc := byte(0)
+	for _, b := range packet {
+		lrc ^= b
+	}
+	m.output = append(m.output, packet...)
+	m.output = append(m.output, lrc)
+}
+
+// read returns memory as the CPU sees it, with flash mapped in
+func (m *MockConnection) read(address uint32, length int) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		a := (address + uint32(i)) % MockMemorySize
+		if offset, ok := m.flashOffset(a); ok {
+			data[i] = m.flash[offset]
+		} else {
+			data[i] = m.memory[a]
+		}
+	}
+	return data
+}
+
+// write stores data in RAM. Writes to the flash window are ignored.
+func (m *MockConnection) write(address uint32, data []byte) {
+	for i, b := range data {
+		a := (address + uint32(i)) % MockMemorySize
+		if _, ok := m.flashOffset(a); !ok {
+			m.memory[a] = b
+		}
+	}
+}
+
+// erase sets a range of flash to 0xFF
+func (m *MockConnection) erase(offset, length int) {
+	for i := offset; i < offset+length && i < len(m.flash); i++ {
+		m.flash[i] = 0xFF
+	}
+}
+
+// program writes data into flash starting at offset. Programming can only
+// clear bits.
+func (m *MockConnection) program(offset int, data []byte) {
+	for i, b := range data {
+		if offset+i >= len(m.flash) {
+			return
+		}
+		m.flash[offset+i] &= b
+	}
+}
+
+// flashOffset returns the offset into flash of an address in the flash window
+func (m *MockConnection) flashOffset(address uint32) (int, bool) {
+	if address < m.flashBase || address >= m.flashBase+uint32(len(m.flash)) {
+		return 0, false
+	}
+	return int(address - m.flashBase), true
+}
@@ -0,0 +1,169 @@
+package connection_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// newMockPort returns a debug port talking to a fresh mock device
+func newMockPort(t *testing.T, cfg *config.Config) (*protocol.DebugPort, *connection.MockConnection) {
+	t.Helper()
+
+	conn, ok := connection.NewConnection("mock:", cfg).(*connection.MockConnection)
+	if !ok {
+		t.Fatal("NewConnection(\"mock:\") did not return a MockConnection")
+	}
+	if err := conn.Open("mock:"); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	return protocol.NewDebugPort(conn, cfg), conn
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		CPU:          "65c02",
+		VerifyLRC:    true,
+		FlashSize:    0x10000,
+		FlashAddress: "080000",
+		FlashPoll:    true,
+		FlashTimeout: 1,
+	}
+}
+
+func TestMockMemory(t *testing.T) {
+	dp, conn := newMockPort(t, testConfig())
+
+	if err := dp.EnterDebug(); err != nil || !conn.InDebug() {
+		t.Fatalf("EnterDebug() error = %v, in debug %v", err, conn.InDebug())
+	}
+
+	data := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	if err := dp.WriteBlock(0x1234, data); err != nil {
+		t.Fatalf("WriteBlock() error: %v", err)
+	}
+	got, err := dp.ReadBlock(0x1232, 8)
+	if err != nil {
+		t.Fatalf("ReadBlock() error: %v", err)
+	}
+	if want := []byte{0, 0, 0xDE, 0xAD, 0xBE, 0xEF, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("ReadBlock() = % X, want % X", got, want)
+	}
+
+	revision, err := dp.GetRevision()
+	if err != nil || revision != connection.MockRevision {
+		t.Errorf("GetRevision() = %d, %v", revision, err)
+	}
+
+	if err := dp.StopCPU(); err != nil || !conn.Stopped() {
+		t.Errorf("StopCPU() error = %v, stopped %v", err, conn.Stopped())
+	}
+	if err := dp.ExitDebug(); err != nil || conn.InDebug() || conn.Stopped() {
+		t.Errorf("ExitDebug() error = %v, in debug %v, stopped %v", err, conn.InDebug(), conn.Stopped())
+	}
+}
+
+func TestMockFlash(t *testing.T) {
+	dp, conn := newMockPort(t, testConfig())
+
+	// Flash reads as erased and ignores plain writes
+	if err := dp.WriteBlock(0x080000, []byte{0x00}); err != nil {
+		t.Fatalf("WriteBlock() error: %v", err)
+	}
+	if got, _ := dp.ReadBlock(0x080000, 1); got[0] != 0xFF {
+		t.Errorf("flash after write = %02X, want FF", got[0])
+	}
+
+	// Program page 1 from the sector buffer
+	page := bytes.Repeat([]byte{0x5A}, 0x2000)
+	if err := dp.WriteBlock(0, page[:0x1000]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.WriteBlock(0x1000, page[0x1000:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.EraseSector(1); err != nil {
+		t.Fatalf("EraseSector() error: %v", err)
+	}
+	if err := dp.ProgramSector(1); err != nil {
+		t.Fatalf("ProgramSector() error: %v", err)
+	}
+	if err := dp.WaitReady(); err != nil {
+		t.Fatalf("WaitReady() error: %v", err)
+	}
+
+	flash := conn.Flash()
+	if !bytes.Equal(flash[0x2000:0x4000], page) {
+		t.Error("page 1 not programmed")
+	}
+	if flash[0x1FFF] != 0xFF || flash[0x4000] != 0xFF {
+		t.Error("programming page 1 changed neighbouring pages")
+	}
+	if got, _ := dp.ReadBlock(0x082000, 1); got[0] != 0x5A {
+		t.Errorf("flash window read = %02X, want 5A", got[0])
+	}
+
+	// Programming over unerased flash only clears bits
+	dp.WriteBlock(0, bytes.Repeat([]byte{0xA5}, 0x1000))
+	dp.ProgramSector(1)
+	dp.WaitReady()
+	if flash[0x2000] != 0x5A&0xA5 {
+		t.Errorf("reprogrammed byte = %02X, want %02X", flash[0x2000], 0x5A&0xA5)
+	}
+
+	if err := dp.EraseFlash(); err != nil {
+		t.Fatalf("EraseFlash() error: %v", err)
+	}
+	if flash[0x2000] != 0xFF {
+		t.Error("EraseFlash() did not erase flash")
+	}
+}
+
+func TestMockIgnoresBadLRC(t *testing.T) {
+	conn := connection.NewMockConnection(testConfig())
+	conn.Open("mock:")
+
+	conn.Write([]byte{0x55, 0xFE, 0, 0, 0, 0, 0, 0x00})
+	if _, err := conn.Read(1); err == nil {
+		t.Error("mock answered a request with a bad LRC")
+	}
+}
+
+func TestMockUploadPGX(t *testing.T) {
+	cfg := testConfig()
+	dp, conn := newMockPort(t, cfg)
+
+	code := []byte{0xA9, 0x42, 0x8D, 0x00, 0x40, 0x60}
+	var buf bytes.Buffer
+	if err := loader.WritePGX(&buf, protocol.PGXcpu65C02, 0x0800, code); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "test.pgx")
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ldr := loader.NewPGXLoader(cfg)
+	if err := ldr.Open(filename); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	defer ldr.Close()
+	ldr.SetHandler(dp.WriteBlock)
+	if err := ldr.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+
+	memory := conn.Memory()
+	if !bytes.Equal(memory[0x0800:0x0806], code) {
+		t.Errorf("program = % X, want % X", memory[0x0800:0x0806], code)
+	}
+	if memory[0xFFFC] != 0x00 || memory[0xFFFD] != 0x08 {
+		t.Errorf("reset vector = %02X%02X, want 0800", memory[0xFFFD], memory[0xFFFC])
+	}
+}
@@ -0,0 +1,134 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBusy is returned when a serial port, bridge or session is in use by
+// another process or client
+var ErrBusy = errors.New("device busy")
+
+// BusyError tells who is using a device
+type BusyError struct {
+	Device string // Serial port or bridge
+	Owner  string // The process or client using it
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("device busy: %s is in use by %s", e.Device, e.Owner)
+}
+
+// Is makes errors.Is(err, ErrBusy) true
+func (e *BusyError) Is(target error) bool {
+	return target == ErrBusy
+}
+
+// Debug port commands that start and end a client's session
+const (
+	cmdEnterDebug = 0x80
+	cmdExitDebug  = 0x81
+)
+
+// ownership gives one client at a time a debug session on a shared device:
+// a client that enters debug mode owns the device until it exits debug mode
+// or disconnects, so another client can't take the machine out of debug mode
+// or interleave its requests with an upload. Other clients' requests wait for
+// up to wait, then get a *BusyError. Outside a session, requests from any
+// client are taken.
+type ownership struct {
+	device string
+
+	mu      sync.Mutex
+	wait    time.Duration
+	owner   string // Client in a debug session, "" if none
+	changed chan struct{}
+}
+
+// newOwnership returns the ownership of a device, free
+func newOwnership(device string) *ownership {
+	return &ownership{device: device, changed: make(chan struct{})}
+}
+
+// setWait sets how long clients wait for the device
+func (o *ownership) setWait(wait time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.wait = wait
+}
+
+// acquire waits until client may use the device
+func (o *ownership) acquire(client string) error {
+	o.mu.Lock()
+	deadline := time.Now().Add(o.wait)
+	for o.owner != "" && o.owner != client {
+		owner, changed := o.owner, o.changed
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			o.mu.Unlock()
+			return &BusyError{Device: o.device, Owner: owner}
+		}
+		o.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+		o.mu.Lock()
+	}
+	o.mu.Unlock()
+	return nil
+}
+
+// exchanged notes a request client exchanged successfully: entering debug
+// mode starts its session and exiting debug mode ends it
+func (o *ownership) exchanged(client string, request []byte) {
+	if len(request) < 2 {
+		return
+	}
+	switch request[1] {
+	case cmdEnterDebug:
+		o.mu.Lock()
+		o.owner = client
+		o.mu.Unlock()
+	case cmdExitDebug:
+		o.release(client)
+	}
+}
+
+// release ends client's session, if it has one, as when it disconnects
+func (o *ownership) release(client string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.owner == client {
+		o.owner = ""
+		close(o.changed)
+		o.changed = make(chan struct{})
+	}
+}
+
+// current returns the client in a debug session, or "" if none
+func (o *ownership) current() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.owner
+}
+
+// guard wraps exchange so client's requests wait while another client is in
+// a debug session
+func (o *ownership) guard(client string, exchange exchanger) exchanger {
+	return func(request []byte, responseLength int) ([]byte, error) {
+		if err := o.acquire(client); err != nil {
+			return nil, err
+		}
+		response, err := exchange(request, responseLength)
+		if err == nil {
+			o.exchanged(client, request)
+		}
+		return response, err
+	}
+}
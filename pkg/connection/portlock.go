@@ -0,0 +1,92 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockPollInterval is how often a busy port's lock is tried again
+const lockPollInterval = 100 * time.Millisecond
+
+// portLock is an advisory lock on a serial port, held by the process that has
+// the port open so that a second foenixmgr process doesn't interleave its
+// packets with the first one's. The lock file records who holds it.
+type portLock struct {
+	file *os.File
+}
+
+// lockFilePath returns the lock file of a port
+func lockFilePath(port string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, port)
+	return filepath.Join(os.TempDir(), "foenixmgr-"+name+".lock")
+}
+
+// lockPort locks a serial port, waiting up to wait for another process to
+// release it, and returns a *BusyError if it doesn't. If the lock file can't
+// be used at all, the port is opened unlocked and lockPort returns nil.
+func lockPort(ctx context.Context, port string, wait time.Duration) (*portLock, error) {
+	path := lockFilePath(port)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		// Another user's lock file can still be locked, if not written
+		if file, err = os.Open(path); err != nil {
+			return nil, nil
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, nil
+		}
+		if locked {
+			if file.Truncate(0) == nil {
+				file.WriteAt([]byte(lockOwner()), 0)
+			}
+			return &portLock{file: file}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			owner, _ := os.ReadFile(path)
+			file.Close()
+			if len(owner) == 0 {
+				owner = []byte("another process")
+			}
+			return nil, &BusyError{Device: port, Owner: string(owner)}
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockOwner describes this process for the lock file
+func lockOwner() string {
+	command := filepath.Base(os.Args[0])
+	if len(os.Args) > 1 {
+		command += " " + os.Args[1]
+	}
+	return fmt.Sprintf("%s (pid %d) since %s", command, os.Getpid(), time.Now().Format("15:04:05"))
+}
+
+// release unlocks the port. The lock file is left in place, as removing it
+// would race with a process about to lock it.
+func (l *portLock) release() {
+	if l != nil {
+		l.file.Close()
+	}
+}
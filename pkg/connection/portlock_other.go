@@ -0,0 +1,11 @@
+//go:build !unix
+
+package connection
+
+import "os"
+
+// tryLock takes no lock: Windows already opens a COM port for one process
+// only, and the port's own error reports it busy
+func tryLock(file *os.File) (bool, error) {
+	return true, nil
+}
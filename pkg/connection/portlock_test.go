@@ -0,0 +1,54 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPortLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("COM ports are locked by Windows")
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+
+	first, err := lockPort(context.Background(), "/dev/ttyUSB0", 0)
+	if err != nil || first == nil {
+		t.Fatalf("lockPort() = %v, %v", first, err)
+	}
+
+	// A second lock is refused, naming the holder
+	_, err = lockPort(context.Background(), "/dev/ttyUSB0", 0)
+	var busy *BusyError
+	if !errors.As(err, &busy) || !errors.Is(err, ErrBusy) {
+		t.Fatalf("second lockPort() = %v, want a *BusyError", err)
+	}
+	if busy.Device != "/dev/ttyUSB0" || !strings.Contains(busy.Owner, "pid") {
+		t.Errorf("busy error = %+v", busy)
+	}
+
+	// Another port isn't affected
+	other, err := lockPort(context.Background(), "/dev/ttyUSB1", 0)
+	if err != nil {
+		t.Fatalf("lockPort() of another port: %v", err)
+	}
+	other.release()
+
+	// A waiting lock is taken once the port is released
+	time.AfterFunc(150*time.Millisecond, first.release)
+	second, err := lockPort(context.Background(), "/dev/ttyUSB0", 5*time.Second)
+	if err != nil {
+		t.Fatalf("lockPort() waiting for the port: %v", err)
+	}
+	defer second.release()
+
+	// Waiting gives up when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if _, err := lockPort(ctx, "/dev/ttyUSB0", 5*time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lockPort() with a done context = %v, want DeadlineExceeded", err)
+	}
+}
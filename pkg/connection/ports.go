@@ -0,0 +1,180 @@
+package connection
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// PortInfo describes a serial port, with USB details when it is a USB adapter
+type PortInfo struct {
+	Name         string `json:"name"`
+	IsUSB        bool   `json:"usb"`
+	VID          string `json:"vid,omitempty"`
+	PID          string `json:"pid,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Foenix       bool   `json:"foenix"` // A USB adapter used for Foenix debug ports
+}
+
+// usbID identifies a USB device by vendor and product ID
+type usbID struct {
+	vid, pid string
+}
+
+// foenixAdapters are the USB serial adapters used for Foenix debug ports:
+// the Exar bridges on the C256 and F256 boards and FTDI USB cables
+var foenixAdapters = map[usbID]string{
+	{"04E2", "1410"}: "Exar XR21V1410",
+	{"04E2", "1411"}: "Exar XR21B1411",
+	{"04E2", "1412"}: "Exar XR21V1412",
+	{"04E2", "1414"}: "Exar XR21V1414",
+	{"0403", "6001"}: "FTDI FT232R",
+	{"0403", "6010"}: "FTDI FT2232",
+	{"0403", "6014"}: "FTDI FT232H",
+	{"0403", "6015"}: "FTDI FT231X",
+}
+
+// IsFoenixAdapter returns true if a USB vendor and product ID belong to an
+// adapter known to be used for Foenix debug ports
+func IsFoenixAdapter(vid, pid string) bool {
+	_, ok := foenixAdapters[usbID{strings.ToUpper(vid), strings.ToUpper(pid)}]
+	return ok
+}
+
+// ListPorts returns the serial ports with their USB details. Where the OS
+// can't report USB details only the port names are returned.
+func ListPorts() ([]PortInfo, error) {
+	details, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		names, err := serial.GetPortsList()
+		if err != nil {
+			return nil, err
+		}
+		ports := make([]PortInfo, len(names))
+		for i, name := range names {
+			ports[i] = PortInfo{Name: name}
+		}
+		return ports, nil
+	}
+
+	ports := make([]PortInfo, 0, len(details))
+	for _, d := range details {
+		ports = append(ports, PortInfo{
+			Name:         d.Name,
+			IsUSB:        d.IsUSB,
+			VID:          strings.ToUpper(d.VID),
+			PID:          strings.ToUpper(d.PID),
+			SerialNumber: d.SerialNumber,
+			Product:      d.Product,
+			Foenix:       d.IsUSB && IsFoenixAdapter(d.VID, d.PID),
+		})
+	}
+	return ports, nil
+}
+
+// FindPortBySerial returns the port of the USB adapter with a serial number
+func FindPortBySerial(serialNumber string) (string, error) {
+	ports, err := ListPorts()
+	if err != nil {
+		return "", fmt.Errorf("failed to list serial ports: %w", err)
+	}
+
+	for _, p := range ports {
+		if p.IsUSB && strings.EqualFold(p.SerialNumber, serialNumber) {
+			return p.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no USB serial adapter with serial number %s is connected", serialNumber)
+}
+
+// comPortPattern matches a Windows COM port in the forms Windows accepts:
+// COM15, com15, COM15: and \\.\COM15
+var comPortPattern = regexp.MustCompile(`(?i)^(?:\\\\\.\\)?(COM\d+):?$`)
+
+// COMPortName returns the plain name of a Windows COM port (e.g. COM15) and
+// true, or false if port isn't a COM port name
+func COMPortName(port string) (string, bool) {
+	m := comPortPattern.FindStringSubmatch(port)
+	if m == nil {
+		return "", false
+	}
+	return strings.ToUpper(m[1]), true
+}
+
+// serialDevicePath returns the path to open a serial port with on an OS.
+// Windows only finds COM10 and above in the \\.\ device namespace, which
+// works for the lower numbers too, so COM ports are always opened there.
+func serialDevicePath(port, goos string) string {
+	if goos != "windows" {
+		return port
+	}
+	if name, ok := COMPortName(port); ok {
+		return `\\.\` + name
+	}
+	return port
+}
+
+// SocketPrefix selects a local socket in a port string, e.g.
+// "unix:/home/me/.cache/foenixmgr/sessions/COM3.sock". It is connected to like
+// a TCP bridge.
+const SocketPrefix = "unix:"
+
+// IsSocketPort returns true if a port string is a local socket path
+func IsSocketPort(port string) bool {
+	return strings.HasPrefix(port, SocketPrefix)
+}
+
+// IsTCPPort returns true if a port string is a TCP address (host:port)
+// or a local socket rather than a serial port
+func IsTCPPort(port string) bool {
+	if _, ok := COMPortName(port); ok {
+		return false
+	}
+	return IsSocketPort(port) || strings.Contains(port, ":")
+}
+
+// IsPortDescription returns true if a port string isn't a device name, path
+// or address, and so is looked up with FindPortByName, e.g. "Foenix Debug"
+func IsPortDescription(port string) bool {
+	if port == "" || IsMockPort(port) || IsTCPPort(port) || strings.ContainsAny(port, `/\`) {
+		return false
+	}
+	_, ok := COMPortName(port)
+	return !ok
+}
+
+// FindPortByName returns the port with a name, or else the one port whose
+// description (the friendly name on Windows, the product name of USB
+// adapters elsewhere) contains it, ignoring case
+func FindPortByName(name string) (string, error) {
+	ports, err := ListPorts()
+	if err != nil {
+		return "", fmt.Errorf("failed to list serial ports: %w", err)
+	}
+	return matchPortName(ports, name)
+}
+
+// matchPortName finds the port for FindPortByName among ports
+func matchPortName(ports []PortInfo, name string) (string, error) {
+	var matches []string
+	for _, p := range ports {
+		if strings.EqualFold(p.Name, name) {
+			return p.Name, nil
+		}
+		if p.Product != "" && strings.Contains(strings.ToLower(p.Product), strings.ToLower(name)) {
+			matches = append(matches, p.Name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no serial port is named or described as %q (see 'list-ports')", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%q matches several serial ports: %s", name, strings.Join(matches, ", "))
+}
@@ -0,0 +1,112 @@
+package connection
+
+import "testing"
+
+func TestIsFoenixAdapter(t *testing.T) {
+	tests := []struct {
+		vid, pid string
+		want     bool
+	}{
+		{"04E2", "1411", true},
+		{"04e2", "1410", true},
+		{"0403", "6001", true},
+		{"0403", "6015", true},
+		{"2341", "0043", false}, // Arduino Uno
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsFoenixAdapter(tt.vid, tt.pid); got != tt.want {
+			t.Errorf("IsFoenixAdapter(%q, %q) = %v, want %v", tt.vid, tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestCOMPortName(t *testing.T) {
+	tests := []struct {
+		port   string
+		want   string
+		wantOK bool
+	}{
+		{"COM3", "COM3", true},
+		{"com15", "COM15", true},
+		{"COM15:", "COM15", true},
+		{`\\.\COM128`, "COM128", true},
+		{"/dev/ttyUSB0", "", false},
+		{"192.168.1.114:2560", "", false},
+		{"COMX", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := COMPortName(tt.port)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("COMPortName(%q) = %q, %v, want %q, %v", tt.port, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSerialDevicePath(t *testing.T) {
+	tests := []struct {
+		port, goos, want string
+	}{
+		{"COM15", "windows", `\\.\COM15`},
+		{"com3", "windows", `\\.\COM3`},
+		{`\\.\COM15`, "windows", `\\.\COM15`},
+		{"CNCA0", "windows", "CNCA0"},
+		{"/dev/ttyUSB0", "linux", "/dev/ttyUSB0"},
+	}
+
+	for _, tt := range tests {
+		if got := serialDevicePath(tt.port, tt.goos); got != tt.want {
+			t.Errorf("serialDevicePath(%q, %q) = %q, want %q", tt.port, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestIsPortDescription(t *testing.T) {
+	tests := []struct {
+		port string
+		want bool
+	}{
+		{"Foenix Debug", true},
+		{"XR21B1411", true},
+		{"COM15", false},
+		{"COM15:", false},
+		{"/dev/ttyUSB0", false},
+		{"192.168.1.114:2560", false},
+		{"mock:", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPortDescription(tt.port); got != tt.want {
+			t.Errorf("IsPortDescription(%q) = %v, want %v", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPortName(t *testing.T) {
+	ports := []PortInfo{
+		{Name: "COM1", Product: "Communications Port (COM1)"},
+		{Name: "COM15", IsUSB: true, Product: "Foenix Debug Port (COM15)"},
+		{Name: "COM16", IsUSB: true, Product: "USB Serial Port (COM16)"},
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"foenix debug", "COM15", false},
+		{"com16", "COM16", false},
+		{"Port", "", true}, // Ambiguous
+		{"Arduino", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := matchPortName(ports, tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("matchPortName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
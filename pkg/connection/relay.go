@@ -0,0 +1,148 @@
+package connection
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Relay forwards debug port packets from TCP or local socket clients to a
+// Connection that is already open, so several processes can share one serial
+// port. Transactions
+// from concurrent clients are serialized, and one client at a time can be in
+// a debug session, as with a Bridge.
+type Relay struct {
+	conn    Connection
+	mu      sync.Mutex
+	owner   *ownership
+	clients int64 // Clients accepted so far, to name them
+}
+
+// NewRelay creates a relay for an open connection
+func NewRelay(conn Connection) *Relay {
+	return &Relay{conn: conn, owner: newOwnership("the session")}
+}
+
+// SetBusyWait sets how long a client's requests wait while another client is
+// in a debug session, as Bridge.SetBusyWait does
+func (r *Relay) SetBusyWait(wait time.Duration) {
+	r.owner.setWait(wait)
+}
+
+// Serve accepts clients on the listener until it is closed
+func (r *Relay) Serve(listener net.Listener) error {
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go r.handleClient(client)
+	}
+}
+
+// handleClient relays packets and batches for a single TCP client until it
+// disconnects
+func (r *Relay) handleClient(client net.Conn) {
+	defer client.Close()
+	// Clients of a local socket have no address of their own
+	name := fmt.Sprintf("client %d", atomic.AddInt64(&r.clients, 1))
+	if addr, ok := client.RemoteAddr().(*net.TCPAddr); ok {
+		name = addr.String()
+	}
+	defer r.owner.release(name)
+
+	var exchangeErr *exchangeError
+	if err := serveClient(client, r.owner.guard(name, r.exchange), serveHooks{}); errors.As(err, &exchangeErr) {
+		fmt.Printf("Relay error: %v\n", exchangeErr.err)
+	}
+}
+
+// exchange sends one request over the shared connection and returns the raw response
+func (r *Relay) exchange(request []byte, responseLength int) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response, err := r.conn.Read(responseLength)
+	if err != nil {
+		r.conn.Flush()
+		return nil, err
+	}
+	return response, nil
+}
+
+// Direction of the data a command's length field refers to
+const (
+	payloadNone     = iota // No data in either direction
+	payloadRequest         // The request carries length bytes
+	payloadResponse        // The response returns length bytes
+)
+
+// commandPayloads gives the data direction of the known debug port commands
+// (see the protocol package). The commands without data ignore the length
+// field: a bridge hello is a revision request that carries its version there.
+var commandPayloads = map[byte]int{
+	cmdReadMem:  payloadResponse,
+	cmdWriteMem: payloadRequest,
+	0x10:        payloadNone, // Program flash
+	0x11:        payloadNone, // Erase flash
+	0x12:        payloadNone, // Erase sector
+	0x13:        payloadNone, // Program sector
+	0x20:        payloadNone, // Stop CPU
+	0x21:        payloadNone, // Start CPU
+	0x80:        payloadNone, // Enter debug
+	0x81:        payloadNone, // Exit debug
+	0x90:        payloadNone, // Boot from RAM
+	0x91:        payloadNone, // Boot from flash
+	0xFE:        payloadNone, // Revision
+}
+
+// payloadOf returns the data direction of a request from its command alone.
+// A command that isn't known carries length bytes of data in the request, so
+// every request is framed as the 7-byte header, any data and the LRC without
+// looking at the bytes that follow.
+func payloadOf(command byte) int {
+	if direction, ok := commandPayloads[command]; ok {
+		return direction
+	}
+	return payloadRequest
+}
+
+// readRequest reads one request packet from a client: the 7-byte header, any
+// payload and the LRC. It returns the whole packet and the number of bytes in
+// the response to expect.
+func readRequest(r *bufio.Reader) ([]byte, int, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+
+	direction := payloadOf(header[1])
+	dataLength := int(header[5])<<8 | int(header[6])
+
+	// Payload and LRC
+	payloadLength := 1
+	if direction == payloadRequest {
+		payloadLength += dataLength
+	}
+	payload := make([]byte, payloadLength)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+
+	// Sync byte, two status bytes, data and LRC
+	responseLength := 4
+	if direction == payloadResponse {
+		responseLength += dataLength
+	}
+
+	return append(header, payload...), responseLength, nil
+}
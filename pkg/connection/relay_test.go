@@ -0,0 +1,64 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+// packet builds a request packet with the LRC the host computes
+func packet(command byte, length uint16, data ...byte) []byte {
+	p := []byte{0x55, command, 0x01, 0x20, 0x00, byte(length >> 8), byte(length)}
+	lrc := byte(0)
+	for _, b := range p[:6] {
+		lrc ^= b
+	}
+	for _, b := range data {
+		lrc ^= b
+	}
+	p = append(p, data...)
+	return append(p, lrc)
+}
+
+func TestReadRequestFraming(t *testing.T) {
+	tests := []struct {
+		name         string
+		packet       []byte
+		wantResponse int
+	}{
+		{"Read memory", packet(cmdReadMem, 4), 8},
+		{"Write memory", packet(cmdWriteMem, 3, 1, 2, 3), 4},
+		{"Revision", packet(0xFE, 0), 4},
+		{"Boot from flash", packet(0x91, 0), 4},
+		{"Erase sector", packet(0x12, 0), 4},
+		{"Unknown without data", packet(0x42, 0), 4},
+		{"Unknown with request data", packet(0x42, 2, 0xAB, 0xCD), 4},
+		// A first data byte equal to the header's LRC is still data
+		{"Write starting with the header LRC", packet(cmdWriteMem, 2, 0x75, 0x01), 4},
+		{"Unknown starting with the header LRC", packet(0x42, 2, 0x36, 0x00), 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A second packet follows to check that exactly one is consumed
+			next := packet(0xFE, 0)
+			r := bufio.NewReader(bytes.NewReader(append(append([]byte(nil), tt.packet...), next...)))
+
+			request, responseLength, err := readRequest(r)
+			if err != nil {
+				t.Fatalf("readRequest() error: %v", err)
+			}
+			if !bytes.Equal(request, tt.packet) {
+				t.Errorf("request = % X, want % X", request, tt.packet)
+			}
+			if responseLength != tt.wantResponse {
+				t.Errorf("response length = %d, want %d", responseLength, tt.wantResponse)
+			}
+
+			request, _, err = readRequest(r)
+			if err != nil || !bytes.Equal(request, next) {
+				t.Errorf("next request = % X, %v, want % X", request, err, next)
+			}
+		})
+	}
+}
@@ -1,28 +1,56 @@
 package connection
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"runtime"
 	"time"
 
 	"github.com/daschewie/foenixmgr/pkg/config"
 	"go.bug.st/serial"
 )
 
+// ErrReconnected is returned by a read or write that failed because the
+// serial port disappeared, after the port was reopened. The request in
+// progress is lost and has to be sent again.
+var ErrReconnected = errors.New("serial port reconnected")
+
+// Delays between attempts to reopen a serial port that disappeared
+const (
+	reconnectDelay    = 100 * time.Millisecond
+	reconnectMaxDelay = 2 * time.Second
+)
+
 // SerialConnection implements Connection interface for serial port communication
 type SerialConnection struct {
 	port   serial.Port
 	config *config.Config
+	name   string // Port name given to Open, reopened by reconnect
+	rtscts bool   // Wait for CTS before writing
+	lock   *portLock
+
+	// openPort opens the port device; tests replace it
+	openPort func(path string, mode *serial.Mode) (serial.Port, error)
 }
 
 // NewSerialConnection creates a new serial connection with the given configuration
 func NewSerialConnection(cfg *config.Config) *SerialConnection {
 	return &SerialConnection{
-		config: cfg,
+		config:   cfg,
+		openPort: serial.Open,
 	}
 }
 
 // Open establishes a serial connection to the specified port
 func (s *SerialConnection) Open(portName string) error {
+	return s.OpenContext(context.Background(), portName)
+}
+
+// OpenContext establishes a serial connection to the specified port. If
+// another process has the port open, it waits up to lock_wait seconds for the
+// port, giving up when ctx is done, then fails with a *BusyError.
+func (s *SerialConnection) OpenContext(ctx context.Context, portName string) error {
 	if s.config == nil {
 		// Load default config if not provided
 		cfg, err := config.Load()
@@ -32,23 +60,40 @@ func (s *SerialConnection) Open(portName string) error {
 		s.config = cfg
 	}
 
-	mode := &serial.Mode{
-		BaudRate: s.config.DataRate,
-		DataBits: 8,
-		Parity:   serial.NoParity,
-		StopBits: serial.OneStopBit,
+	lock, err := lockPort(ctx, portName, time.Duration(s.config.LockWait)*time.Second)
+	if err != nil {
+		return err
+	}
+	port, err := s.open(portName)
+	if err != nil {
+		lock.release()
+		return err
+	}
+	s.port = port
+	s.name = portName
+	s.lock = lock
+	return nil
+}
+
+// open opens and sets up the port device
+func (s *SerialConnection) open(portName string) (serial.Port, error) {
+	mode, err := serialMode(s.config)
+	if err != nil {
+		return nil, err
 	}
+	s.rtscts, _ = hardwareFlowControl(s.config)
 
 	// Attempt to open the port
-	port, err := serial.Open(portName, mode)
+	path := serialDevicePath(portName, runtime.GOOS)
+	port, err := s.openPort(path, mode)
 	if err != nil {
 		// Try to close and reopen (matching Python behavior)
 		if port != nil {
 			port.Close()
 		}
-		port, err = serial.Open(portName, mode)
+		port, err = s.openPort(path, mode)
 		if err != nil {
-			return fmt.Errorf("failed to open serial port %s: %w", portName, err)
+			return nil, fmt.Errorf("failed to open serial port %s: %w", portName, err)
 		}
 	}
 
@@ -56,15 +101,43 @@ func (s *SerialConnection) Open(portName string) error {
 	timeout := time.Duration(s.config.Timeout) * time.Second
 	if err := port.SetReadTimeout(timeout); err != nil {
 		port.Close()
-		return fmt.Errorf("failed to set read timeout: %w", err)
+		return nil, fmt.Errorf("failed to set read timeout: %w", err)
 	}
+	return port, nil
+}
 
-	s.port = port
-	return nil
+// reconnect reopens the port after a read or write failed with err, as when
+// a USB adapter drops off the bus and re-enumerates. It retries with
+// exponential backoff for up to reconnect_timeout seconds and returns
+// ErrReconnected if the port came back, so the debug port protocol re-sends
+// the request, or else err.
+func (s *SerialConnection) reconnect(err error) error {
+	if s.config.ReconnectTimeout <= 0 || s.name == "" {
+		return err
+	}
+
+	s.port.Close()
+	deadline := time.Now().Add(time.Duration(s.config.ReconnectTimeout) * time.Second)
+	delay := reconnectDelay
+	for {
+		time.Sleep(delay)
+		port, openErr := s.open(s.name)
+		if openErr == nil {
+			s.port = port
+			return fmt.Errorf("%w after: %v", ErrReconnected, err)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			s.port = nil
+			return fmt.Errorf("%w (reconnect failed: %v)", err, openErr)
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
 }
 
 // Close closes the serial connection
 func (s *SerialConnection) Close() error {
+	s.lock.release()
+	s.lock = nil
 	if s.port == nil {
 		return nil
 	}
@@ -88,7 +161,7 @@ func (s *SerialConnection) Read(n int) ([]byte, error) {
 	for totalRead < n {
 		bytesRead, err := s.port.Read(buf[totalRead:])
 		if err != nil {
-			return nil, fmt.Errorf("serial read error: %w", err)
+			return nil, s.reconnect(fmt.Errorf("serial read error: %w", err))
 		}
 		if bytesRead == 0 {
 			return nil, fmt.Errorf("serial read timeout (expected %d bytes, got %d)", n, totalRead)
@@ -107,9 +180,18 @@ func (s *SerialConnection) Write(data []byte) (int, error) {
 
 	totalWritten := 0
 	for totalWritten < len(data) {
-		n, err := s.port.Write(data[totalWritten:])
+		block := data[totalWritten:]
+		if s.rtscts {
+			// The driver has no hardware flow control, so CTS is checked
+			// here before each block
+			if err := s.waitCTS(); err != nil {
+				return totalWritten, err
+			}
+			block = block[:min(len(block), ctsBlockSize)]
+		}
+		n, err := s.port.Write(block)
 		if err != nil {
-			return totalWritten, fmt.Errorf("serial write error: %w", err)
+			return totalWritten, s.reconnect(fmt.Errorf("serial write error: %w", err))
 		}
 		totalWritten += n
 	}
@@ -117,6 +199,14 @@ func (s *SerialConnection) Write(data []byte) (int, error) {
 	return totalWritten, nil
 }
 
+// Flush discards any data waiting in the serial input buffer
+func (s *SerialConnection) Flush() error {
+	if s.port == nil {
+		return fmt.Errorf("serial port not open")
+	}
+	return s.port.ResetInputBuffer()
+}
+
 // SetConfig updates the configuration for this connection
 func (s *SerialConnection) SetConfig(cfg *config.Config) {
 	s.config = cfg
@@ -0,0 +1,194 @@
+package connection
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"go.bug.st/serial"
+)
+
+// fakePort is a serial port that echoes writes back, until it is unplugged
+type fakePort struct {
+	unplugged bool
+	pending   []byte
+	mode      *serial.Mode // Mode the port was opened with
+	ctsOff    bool         // The device doesn't assert CTS
+	writes    []int        // Size of every write
+}
+
+func (p *fakePort) SetMode(mode *serial.Mode) error { return nil }
+func (p *fakePort) Drain() error                    { return nil }
+func (p *fakePort) ResetInputBuffer() error         { p.pending = nil; return nil }
+func (p *fakePort) ResetOutputBuffer() error        { return nil }
+func (p *fakePort) SetDTR(dtr bool) error           { return nil }
+func (p *fakePort) SetRTS(rts bool) error           { return nil }
+func (p *fakePort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{CTS: !p.ctsOff}, nil
+}
+func (p *fakePort) SetReadTimeout(t time.Duration) error { return nil }
+func (p *fakePort) Close() error                         { return nil }
+func (p *fakePort) Break(time.Duration) error            { return nil }
+
+func (p *fakePort) Read(buf []byte) (int, error) {
+	if p.unplugged {
+		return 0, errors.New("device not configured")
+	}
+	n := copy(buf, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *fakePort) Write(buf []byte) (int, error) {
+	if p.unplugged {
+		return 0, errors.New("device not configured")
+	}
+	p.pending = append(p.pending, buf...)
+	p.writes = append(p.writes, len(buf))
+	return len(buf), nil
+}
+
+// fakeSerialConnection returns a connection that opens fake ports, failing
+// the first failOpens times after the first port was opened. Its port lock is
+// in a temporary directory of the test.
+func fakeSerialConnection(t *testing.T, cfg *config.Config, failOpens int) (*SerialConnection, *[]*fakePort) {
+	t.Setenv("TMPDIR", t.TempDir())
+	var ports []*fakePort
+	s := NewSerialConnection(cfg)
+	s.openPort = func(path string, mode *serial.Mode) (serial.Port, error) {
+		if len(ports) > 0 && failOpens > 0 {
+			failOpens--
+			return nil, errors.New("no such file or directory")
+		}
+		p := &fakePort{mode: mode}
+		ports = append(ports, p)
+		return p, nil
+	}
+	return s, &ports
+}
+
+func TestSerialReconnect(t *testing.T) {
+	s, ports := fakeSerialConnection(t, &config.Config{ReconnectTimeout: 5}, 2)
+	if err := s.Open("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	(*ports)[0].unplugged = true
+	if _, err := s.Write([]byte{1, 2}); !errors.Is(err, ErrReconnected) {
+		t.Fatalf("Write() to an unplugged port = %v, want ErrReconnected", err)
+	}
+	if len(*ports) != 2 {
+		t.Fatalf("opened %d ports, want 2", len(*ports))
+	}
+
+	// The reopened port is used from then on
+	if _, err := s.Write([]byte{3}); err != nil {
+		t.Fatalf("Write() after reconnecting: %v", err)
+	}
+	if got, err := s.Read(1); err != nil || got[0] != 3 {
+		t.Errorf("Read() after reconnecting = %v, %v", got, err)
+	}
+}
+
+func TestSerialReconnectDisabled(t *testing.T) {
+	s, ports := fakeSerialConnection(t, &config.Config{ReconnectTimeout: 0}, 0)
+	if err := s.Open("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	(*ports)[0].unplugged = true
+	if _, err := s.Read(1); err == nil || errors.Is(err, ErrReconnected) {
+		t.Errorf("Read() = %v, want the read error", err)
+	}
+	if len(*ports) != 1 {
+		t.Errorf("opened %d ports, want 1", len(*ports))
+	}
+}
+
+func TestSerialReconnectGivesUp(t *testing.T) {
+	s, ports := fakeSerialConnection(t, &config.Config{ReconnectTimeout: 1}, 1000)
+	if err := s.Open("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	(*ports)[0].unplugged = true
+	if _, err := s.Read(1); err == nil || errors.Is(err, ErrReconnected) {
+		t.Errorf("Read() = %v, want the read error", err)
+	}
+	if s.IsOpen() {
+		t.Error("connection is still open after reconnecting failed")
+	}
+}
+
+func TestSerialMode(t *testing.T) {
+	s, ports := fakeSerialConnection(t, &config.Config{DataRate: 115200, Parity: "Even", StopBits: "2", DTR: "off"}, 0)
+	if err := s.Open("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	mode := (*ports)[0].mode
+	if mode.BaudRate != 115200 || mode.Parity != serial.EvenParity || mode.StopBits != serial.TwoStopBits {
+		t.Errorf("mode = %+v", mode)
+	}
+	if bits := mode.InitialStatusBits; bits == nil || bits.DTR || !bits.RTS {
+		t.Errorf("InitialStatusBits = %+v, want DTR off and RTS on", bits)
+	}
+}
+
+func TestSerialModeDefaults(t *testing.T) {
+	mode, err := serialMode(&config.Config{DataRate: 6000000})
+	if err != nil {
+		t.Fatalf("serialMode() error: %v", err)
+	}
+	if mode.Parity != serial.NoParity || mode.StopBits != serial.OneStopBit || mode.InitialStatusBits != nil {
+		t.Errorf("serialMode() = %+v", mode)
+	}
+}
+
+func TestSerialModeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{"parity", config.Config{Parity: "high"}, "invalid parity"},
+		{"stop bits", config.Config{StopBits: "3"}, "invalid stop_bits"},
+		{"flow control", config.Config{FlowControl: "xonxoff"}, "invalid flow_control"},
+		{"dtr", config.Config{DTR: "maybe"}, "invalid dtr"},
+		{"rts off with rtscts", config.Config{FlowControl: "rtscts", RTS: "off"}, "rts=off"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := serialMode(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("serialMode() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialFlowControl(t *testing.T) {
+	s, ports := fakeSerialConnection(t, &config.Config{FlowControl: "rtscts", Timeout: 1}, 0)
+	if err := s.Open("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	port := (*ports)[0]
+	if bits := port.mode.InitialStatusBits; bits == nil || !bits.RTS {
+		t.Errorf("InitialStatusBits = %+v, want RTS on", bits)
+	}
+
+	// Data is written in blocks while CTS is asserted
+	if n, err := s.Write(make([]byte, 150)); err != nil || n != 150 {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if want := []int{64, 64, 22}; !reflect.DeepEqual(port.writes, want) {
+		t.Errorf("writes = %v, want %v", port.writes, want)
+	}
+
+	port.ctsOff = true
+	if _, err := s.Write([]byte{1}); err == nil || !strings.Contains(err.Error(), "CTS") {
+		t.Errorf("Write() without CTS error = %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package connection
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"go.bug.st/serial"
+)
+
+// Flow control settings
+const (
+	FlowControlNone   = "none"
+	FlowControlRTSCTS = "rtscts"
+)
+
+// With RTS/CTS flow control, data is written in blocks of ctsBlockSize bytes
+// and CTS is polled every ctsPollInterval before each block
+const (
+	ctsBlockSize    = 64
+	ctsPollInterval = time.Millisecond
+)
+
+// serialParity maps the parity setting to the driver's parity
+var serialParity = map[string]serial.Parity{
+	"none":  serial.NoParity,
+	"odd":   serial.OddParity,
+	"even":  serial.EvenParity,
+	"mark":  serial.MarkParity,
+	"space": serial.SpaceParity,
+}
+
+// serialStopBits maps the stop_bits setting to the driver's stop bits
+var serialStopBits = map[string]serial.StopBits{
+	"1":   serial.OneStopBit,
+	"1.5": serial.OnePointFiveStopBits,
+	"2":   serial.TwoStopBits,
+}
+
+// serialMode returns the port settings for a configuration: the data rate,
+// 8 data bits, parity and stop bits, and the DTR and RTS lines when they are
+// set, which are otherwise left to the driver (asserted on open)
+func serialMode(cfg *config.Config) (*serial.Mode, error) {
+	mode := &serial.Mode{
+		BaudRate: cfg.DataRate,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+
+	if cfg.Parity != "" {
+		parity, ok := serialParity[strings.ToLower(cfg.Parity)]
+		if !ok {
+			return nil, fmt.Errorf("invalid parity '%s' (use none, odd, even, mark or space)", cfg.Parity)
+		}
+		mode.Parity = parity
+	}
+
+	if cfg.StopBits != "" {
+		stopBits, ok := serialStopBits[cfg.StopBits]
+		if !ok {
+			return nil, fmt.Errorf("invalid stop_bits '%s' (use 1, 1.5 or 2)", cfg.StopBits)
+		}
+		mode.StopBits = stopBits
+	}
+
+	rtscts, err := hardwareFlowControl(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dtr, dtrSet, err := modemLine("dtr", cfg.DTR)
+	if err != nil {
+		return nil, err
+	}
+	rts, rtsSet, err := modemLine("rts", cfg.RTS)
+	if err != nil {
+		return nil, err
+	}
+	if rtscts {
+		if rtsSet && !rts {
+			return nil, fmt.Errorf("rts=off can't be combined with flow_control=%s, which asserts RTS", FlowControlRTSCTS)
+		}
+		rts, rtsSet = true, true
+	}
+	if dtrSet || rtsSet {
+		// A line that isn't set keeps the driver's default: asserted
+		if !dtrSet {
+			dtr = true
+		}
+		if !rtsSet {
+			rts = true
+		}
+		mode.InitialStatusBits = &serial.ModemOutputBits{DTR: dtr, RTS: rts}
+	}
+	return mode, nil
+}
+
+// CheckSerialSettings checks the parity, stop bits, flow control and DTR/RTS
+// settings of a configuration, which are otherwise checked when a serial port
+// is opened
+func CheckSerialSettings(cfg *config.Config) error {
+	_, err := serialMode(cfg)
+	return err
+}
+
+// hardwareFlowControl reports whether flow_control selects RTS/CTS
+func hardwareFlowControl(cfg *config.Config) (bool, error) {
+	switch strings.ToLower(cfg.FlowControl) {
+	case "", FlowControlNone:
+		return false, nil
+	case FlowControlRTSCTS:
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid flow_control '%s' (use %s or %s)", cfg.FlowControl, FlowControlNone, FlowControlRTSCTS)
+}
+
+// modemLine parses a dtr or rts setting: on or off, or empty to keep the
+// driver's default
+func modemLine(key, value string) (on bool, set bool, err error) {
+	switch strings.ToLower(value) {
+	case "":
+		return false, false, nil
+	case "on", "true", "1":
+		return true, true, nil
+	case "off", "false", "0":
+		return false, true, nil
+	}
+	return false, false, fmt.Errorf("invalid %s '%s' (use on or off)", key, value)
+}
+
+// waitCTS waits until the device asserts CTS, for up to the response timeout
+func (s *SerialConnection) waitCTS() error {
+	deadline := time.Now().Add(time.Duration(s.config.Timeout) * time.Second)
+	for {
+		bits, err := s.port.GetModemStatusBits()
+		if err != nil {
+			return fmt.Errorf("failed to read CTS: %w", err)
+		}
+		if bits.CTS {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device didn't assert CTS within %d seconds", s.config.Timeout)
+		}
+		time.Sleep(ctsPollInterval)
+	}
+}
@@ -1,21 +1,62 @@
 package connection
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
 )
 
 // TCPConnection implements Connection interface for TCP socket communication
 // Used for connecting to a TCP-to-serial bridge
 type TCPConnection struct {
-	conn   net.Conn
-	isOpen bool
+	conn    net.Conn
+	isOpen  bool
+	timeout time.Duration // Time to wait for each Read, or 0 to wait forever
+
+	// Bridge protocol version, once asked by CanBatch, and the sequence
+	// number of the next request frame
+	version int
+	asked   bool
+	seq     uint16
+
+	// A request was written and its response not read yet
+	awaiting bool
+}
+
+// NewTCPConnection creates a TCP connection whose reads give up after the
+// configured timeout
+func NewTCPConnection(cfg *config.Config) *TCPConnection {
+	return &TCPConnection{timeout: time.Duration(cfg.Timeout) * time.Second}
 }
 
 // Open establishes a TCP connection to the specified host:port
 func (t *TCPConnection) Open(port string) error {
+	return t.OpenContext(context.Background(), port)
+}
+
+// OpenContext establishes a TCP connection to the specified host:port, or to
+// a local socket given as "unix:PATH", giving up when ctx is done
+func (t *TCPConnection) OpenContext(ctx context.Context, port string) error {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	if IsSocketPort(port) {
+		path := strings.TrimPrefix(port, SocketPrefix)
+		conn, err := dialer.DialContext(ctx, "unix", path)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", path, err)
+		}
+		t.conn = conn
+		t.isOpen = true
+		t.asked = false
+		return nil
+	}
+
 	parts := strings.Split(port, ":")
 	if len(parts) < 2 {
 		return fmt.Errorf("invalid TCP address format (expected host:port): %s", port)
@@ -26,16 +67,28 @@ func (t *TCPConnection) Open(port string) error {
 
 	address := net.JoinHostPort(host, tcpPort)
 
-	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return fmt.Errorf("failed to connect to %s: %w", address, err)
 	}
 
+	setNoDelay(conn)
 	t.conn = conn
 	t.isOpen = true
+	t.asked = false
 	return nil
 }
 
+// setNoDelay turns off Nagle's algorithm on a TCP connection. Every request
+// waits for its response, so holding back small packets only adds latency.
+// Go already does this for new connections; it is set here so the bridge
+// protocol doesn't depend on that default.
+func setNoDelay(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(true)
+	}
+}
+
 // Close closes the TCP connection
 func (t *TCPConnection) Close() error {
 	if t.conn == nil {
@@ -56,9 +109,29 @@ func (t *TCPConnection) Read(n int) ([]byte, error) {
 		return nil, fmt.Errorf("TCP connection not open")
 	}
 
+	if t.timeout > 0 {
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+			return nil, fmt.Errorf("TCP read error: %w", err)
+		}
+		defer t.conn.SetReadDeadline(time.Time{})
+	}
+
 	buf := make([]byte, n)
 	totalRead := 0
 
+	// A bridge that refuses a request answers with an error or busy frame
+	// in place of the response
+	if t.awaiting && n > 0 {
+		t.awaiting = false
+		if _, err := io.ReadFull(t.conn, buf[:1]); err != nil {
+			return nil, fmt.Errorf("TCP read error: %w", err)
+		}
+		if buf[0] == FrameMarker {
+			return nil, t.refusal()
+		}
+		totalRead = 1
+	}
+
 	for totalRead < n {
 		bytesRead, err := t.conn.Read(buf[totalRead:])
 		if err != nil {
@@ -73,6 +146,19 @@ func (t *TCPConnection) Read(n int) ([]byte, error) {
 	return buf, nil
 }
 
+// refusal reads the rest of the frame a bridge refused a request with, after
+// its marker
+func (t *TCPConnection) refusal() error {
+	f, err := readFrame(io.MultiReader(bytes.NewReader([]byte{FrameMarker}), t.conn))
+	if err != nil {
+		return fmt.Errorf("TCP read error: %w", err)
+	}
+	if f.kind != frameError && f.kind != frameBusy {
+		return fmt.Errorf("unexpected frame type 0x%02X in place of a response", f.kind)
+	}
+	return frameErr(f)
+}
+
 // Write writes all data to the TCP connection
 func (t *TCPConnection) Write(data []byte) (int, error) {
 	if t.conn == nil {
@@ -88,5 +174,145 @@ func (t *TCPConnection) Write(data []byte) (int, error) {
 		totalWritten += n
 	}
 
+	t.awaiting = true
 	return totalWritten, nil
 }
+
+// Flush discards any data already received on the TCP connection
+// It reads until no more data arrives within a short grace period
+func (t *TCPConnection) Flush() error {
+	if t.conn == nil {
+		return fmt.Errorf("TCP connection not open")
+	}
+	t.awaiting = false
+	defer t.conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, 1024)
+	for {
+		if err := t.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+			return err
+		}
+		n, err := t.conn.Read(buf)
+		if n == 0 || err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// maxInFlightBytes is the most request and response bytes Exchange has
+// outstanding, so that neither end can block writing while the other is
+// blocked writing too
+const maxInFlightBytes = 64 << 10
+
+// CanBatch reports whether the bridge takes request frames (bridge protocol
+// version 2), sending it a hello the first time. A bridge that doesn't know
+// the hello passes it on to the machine as a revision request.
+func (t *TCPConnection) CanBatch() bool {
+	if t.asked || t.conn == nil {
+		return t.version >= 2
+	}
+	t.asked = true
+
+	if _, err := t.Write(batchHello(BridgeProtocolVersion)); err != nil {
+		return false
+	}
+	response, err := t.Read(len(helloResponse(0)))
+	if err != nil {
+		t.Flush()
+		return false
+	}
+	for version := BridgeProtocolVersion; version >= 1; version-- {
+		if string(response) == string(helloResponse(version)) {
+			t.version = version
+		}
+	}
+	return t.version >= 2
+}
+
+// Exchange sends requests to the bridge in frames without waiting for each
+// answer, keeping up to maxInFlightBytes outstanding, and returns the raw
+// responses. If a request failed on the bridge, the responses to the requests
+// before it are returned with the error; the requests after it were still
+// answered, so the connection stays in step.
+func (t *TCPConnection) Exchange(requests [][]byte, responseLengths []int) ([][]byte, error) {
+	if t.conn == nil {
+		return nil, fmt.Errorf("TCP connection not open")
+	}
+	if t.version < 2 {
+		return nil, errors.New("the bridge doesn't take request frames")
+	}
+
+	first := t.seq
+	responses := make([][]byte, len(requests))
+	failed := len(requests)
+	var failure error
+	sent, answered, inFlight := 0, 0, 0
+	defer func() { t.seq = first + uint16(sent) }()
+
+	for answered < len(requests) {
+		for sent < len(requests) {
+			size := len(requests[sent]) + responseLengths[sent]
+			if sent > answered && inFlight+size > maxInFlightBytes {
+				break
+			}
+			f := frame{kind: frameRequest, seq: first + uint16(sent), payload: requests[sent]}
+			if _, err := t.Write(encodeFrame(f)); err != nil {
+				return responses[:min(answered, failed)], err
+			}
+			inFlight += size
+			sent++
+		}
+
+		f, err := t.readFrame()
+		if err != nil {
+			return responses[:min(answered, failed)], err
+		}
+		index := int(f.seq - first)
+		if index >= sent {
+			continue // Answer to a request from an exchange that failed
+		}
+		if index != answered {
+			return responses[:min(answered, failed)], fmt.Errorf("bridge answered request %d out of order", index+1)
+		}
+
+		switch {
+		case f.kind == frameResponse && len(f.payload) == responseLengths[index]:
+			responses[index] = f.payload
+		case f.kind == frameError || f.kind == frameBusy:
+			if index < failed {
+				failed, failure = index, frameErr(f)
+			}
+		default:
+			if index < failed {
+				failed, failure = index, fmt.Errorf("invalid answer to request %d: frame type 0x%02X, %d bytes", index+1, f.kind, len(f.payload))
+			}
+		}
+		inFlight -= len(requests[index]) + responseLengths[index]
+		answered++
+	}
+
+	if failed < len(requests) {
+		return responses[:failed], failure
+	}
+	return responses, nil
+}
+
+// readFrame reads a frame, waiting up to the timeout
+func (t *TCPConnection) readFrame() (frame, error) {
+	t.awaiting = false
+	if t.timeout > 0 {
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+			return frame{}, fmt.Errorf("TCP read error: %w", err)
+		}
+		defer t.conn.SetReadDeadline(time.Time{})
+	}
+	f, err := readFrame(t.conn)
+	if err != nil {
+		return frame{}, fmt.Errorf("TCP read error: %w", err)
+	}
+	return f, nil
+}
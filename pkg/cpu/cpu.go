@@ -0,0 +1,104 @@
+// Package cpu describes the CPUs of Foenix machines: how a program is started
+// on reset, the memory alignment the debug port needs, and the size and byte
+// order of pointers. Each CPU is registered under the names used in the cpu
+// setting, so adding a CPU (a 65832 or RISC core, say) is a matter of
+// registering one more implementation.
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Family groups CPUs that share an instruction set and register layout
+type Family string
+
+const (
+	Family65C02 Family = "65c02"
+	Family65816 Family = "65816"
+	Family680X0 Family = "680x0"
+	Family6809  Family = "6809"
+)
+
+// WriteFunc writes data to memory at address, e.g. through the debug port
+type WriteFunc func(address uint32, data []byte) error
+
+// CPU describes one CPU type
+type CPU interface {
+	// Name returns the CPU's canonical name, as used in the cpu setting
+	Name() string
+
+	// Family returns the CPU's family
+	Family() Family
+
+	// Alignment returns the alignment in bytes the debug port needs for
+	// memory writes: 1, or 4 for 32-bit buses
+	Alignment() int
+
+	// PointerSize returns the size of a pointer in memory in bytes
+	PointerSize() int
+
+	// ByteOrder returns the byte order of values in memory
+	ByteOrder() binary.ByteOrder
+
+	// VectorSetup writes the reset vectors, and any startup stub, that make
+	// the CPU start the program at start when it is reset
+	VectorSetup(start uint32, write WriteFunc) error
+
+	// DisasmBackend names the instruction decoder for the CPU in package
+	// disasm, or returns "" if there is none
+	DisasmBackend() string
+}
+
+// cpus are the registered CPUs by name
+var cpus = map[string]CPU{}
+
+// Register makes a CPU known under its name and any aliases. Names are not
+// case sensitive.
+func Register(c CPU, aliases ...string) {
+	for _, name := range append([]string{c.Name()}, aliases...) {
+		cpus[strings.ToLower(name)] = c
+	}
+}
+
+// Lookup returns the CPU registered under a name
+func Lookup(name string) (CPU, error) {
+	c, ok := cpus[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported CPU type: %s (known CPUs: %s)", name, strings.Join(Names(), ", "))
+	}
+	return c, nil
+}
+
+// Names returns every registered CPU name and alias, sorted
+func Names() []string {
+	names := make([]string, 0, len(cpus))
+	for name := range cpus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsFamily returns true if name is a registered CPU of a family
+func IsFamily(name string, family Family) bool {
+	c, err := Lookup(name)
+	return err == nil && c.Family() == family
+}
+
+// Pointer decodes a pointer of the CPU's size and byte order from the start
+// of data, which must hold at least PointerSize bytes
+func Pointer(c CPU, data []byte) uint32 {
+	var value uint32
+	size := c.PointerSize()
+	for i := 0; i < size; i++ {
+		if c.ByteOrder() == binary.BigEndian {
+			value = value<<8 | uint32(data[i])
+		} else {
+			value |= uint32(data[i]) << (8 * i)
+		}
+	}
+	return value
+}
@@ -0,0 +1,111 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		canonical string
+		family    Family
+		alignment int
+	}{
+		{"65C02", "65c02", Family65C02, 1},
+		{"6502", "65c02", Family65C02, 1},
+		{"65816", "65816", Family65816, 1},
+		{"m68k", "68000", Family680X0, 1},
+		{"68040", "68040", Family680X0, 4},
+		{"68060", "68060", Family680X0, 4},
+		{"6809", "6809", Family6809, 1},
+	}
+	for _, tt := range tests {
+		c, err := Lookup(tt.name)
+		if err != nil {
+			t.Errorf("Lookup(%q) error: %v", tt.name, err)
+			continue
+		}
+		if c.Name() != tt.canonical || c.Family() != tt.family || c.Alignment() != tt.alignment {
+			t.Errorf("Lookup(%q) = %s %s align %d, want %s %s align %d", tt.name,
+				c.Name(), c.Family(), c.Alignment(), tt.canonical, tt.family, tt.alignment)
+		}
+	}
+
+	if _, err := Lookup("z80"); err == nil {
+		t.Error("Lookup(\"z80\") succeeded, want an error")
+	}
+}
+
+// recorder collects the writes of a vector setup by address
+type recorder map[uint32][]byte
+
+func (r recorder) write(address uint32, data []byte) error {
+	r[address] = append([]byte(nil), data...)
+	return nil
+}
+
+func TestVectorSetup(t *testing.T) {
+	tests := []struct {
+		cpu   string
+		start uint32
+		want  map[uint32][]byte
+	}{
+		{"65c02", 0x2000, map[uint32][]byte{
+			0xFFFC: {0x00, 0x20},
+			0x0080: []byte("CROSSDEV"),
+			0x0088: {0x00, 0x20},
+			0x00FA: {0x00, 0x00},
+		}},
+		{"65816", 0x1234, map[uint32][]byte{
+			0xFFFC: {0x34, 0x12},
+		}},
+		{"65816", 0x381000, map[uint32][]byte{
+			0xFF80: {0x18, 0xFB, 0x5C, 0x00, 0x10, 0x38},
+			0xFFFC: {0x80, 0xFF},
+		}},
+		{"68040", 0x00100000, map[uint32][]byte{
+			0x0004: {0x00, 0x10, 0x00, 0x00},
+		}},
+		{"6809", 0x2000, map[uint32][]byte{
+			0xFFFE: {0x20, 0x00},
+		}},
+	}
+	for _, tt := range tests {
+		c, err := Lookup(tt.cpu)
+		if err != nil {
+			t.Fatalf("Lookup(%q) error: %v", tt.cpu, err)
+		}
+		got := recorder{}
+		if err := c.VectorSetup(tt.start, got.write); err != nil {
+			t.Fatalf("%s VectorSetup() error: %v", tt.cpu, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s VectorSetup(%X) wrote %d blocks, want %d", tt.cpu, tt.start, len(got), len(tt.want))
+		}
+		for address, data := range tt.want {
+			if !bytes.Equal(got[address], data) {
+				t.Errorf("%s VectorSetup(%X) at %04X = % X, want % X", tt.cpu, tt.start, address, got[address], data)
+			}
+		}
+	}
+}
+
+func TestPointer(t *testing.T) {
+	data := []byte{0x12, 0x34, 0x56, 0x78}
+	tests := []struct {
+		cpu  string
+		want uint32
+	}{
+		{"65c02", 0x3412},
+		{"65816", 0x563412},
+		{"68000", 0x12345678},
+		{"6809", 0x1234},
+	}
+	for _, tt := range tests {
+		c, _ := Lookup(tt.cpu)
+		if got := Pointer(c, data); got != tt.want {
+			t.Errorf("%s Pointer() = %X, want %X", tt.cpu, got, tt.want)
+		}
+	}
+}
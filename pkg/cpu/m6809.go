@@ -0,0 +1,33 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+func init() {
+	Register(m6809{})
+}
+
+// m6809 is the Motorola 6809, which F256 boards run with the 6809 processor
+// card in place of the 65C02
+type m6809 struct{}
+
+func (m6809) Name() string                { return "6809" }
+func (m6809) Family() Family              { return Family6809 }
+func (m6809) Alignment() int              { return 1 }
+func (m6809) PointerSize() int            { return 2 }
+func (m6809) ByteOrder() binary.ByteOrder { return binary.BigEndian }
+func (m6809) DisasmBackend() string       { return "" }
+
+// VectorSetup points the reset vector at $FFFE (big-endian) at start
+func (m6809) VectorSetup(start uint32, write WriteFunc) error {
+	resetVector := []byte{
+		byte(start >> 8),
+		byte(start),
+	}
+	if err := write(0xFFFE, resetVector); err != nil {
+		return fmt.Errorf("failed to write 6809 reset vector: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+func init() {
+	Register(m680x0{name: "68000", alignment: 1}, "m68k")
+	Register(m680x0{name: "68040", alignment: 4})
+	Register(m680x0{name: "68060", alignment: 4})
+}
+
+// m680x0 is a Motorola 680x0 of the A2560 machines. The 32-bit 68040 and
+// 68060 need 4-byte aligned memory writes.
+type m680x0 struct {
+	name      string
+	alignment int
+}
+
+func (c m680x0) Name() string              { return c.name }
+func (m680x0) Family() Family              { return Family680X0 }
+func (c m680x0) Alignment() int            { return c.alignment }
+func (m680x0) PointerSize() int            { return 4 }
+func (m680x0) ByteOrder() binary.ByteOrder { return binary.BigEndian }
+func (m680x0) DisasmBackend() string       { return "m68k" }
+
+// VectorSetup points the reset vector at start
+func (m680x0) VectorSetup(start uint32, write WriteFunc) error {
+	// Reset vector at address 0x00000004 (32-bit, big-endian)
+	resetVector := []byte{
+		byte(start >> 24),
+		byte(start >> 16),
+		byte(start >> 8),
+		byte(start),
+	}
+
+	if err := write(0x00000004, resetVector); err != nil {
+		return fmt.Errorf("failed to write 680x0 reset vector: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package cpu
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+func init() {
+	Register(w65c02{}, "6502")
+	Register(w65816{})
+}
+
+// w65c02 is the 8-bit 65C02 of the F256 machines
+type w65c02 struct{}
+
+func (w65c02) Name() string                { return "65c02" }
+func (w65c02) Family() Family              { return Family65C02 }
+func (w65c02) Alignment() int              { return 1 }
+func (w65c02) PointerSize() int            { return 2 }
+func (w65c02) ByteOrder() binary.ByteOrder { return binary.LittleEndian }
+func (w65c02) DisasmBackend() string       { return "65c02" }
+
+// VectorSetup points the reset vector at start and sets up the CROSSDEV
+// springboard the F256 microkernel starts programs through
+func (w65c02) VectorSetup(start uint32, write WriteFunc) error {
+	// Point reset vector to start address
+	resetVector := []byte{
+		byte(start),
+		byte(start >> 8),
+	}
+	if err := write(0xFFFC, resetVector); err != nil {
+		return fmt.Errorf("failed to write 65C02 reset vector: %w", err)
+	}
+
+	// "CROSSDEV" springboard for microkernel support
+	crossdev := []byte{0x43, 0x52, 0x4F, 0x53, 0x53, 0x44, 0x45, 0x56}
+	if err := write(0x0080, crossdev); err != nil {
+		return fmt.Errorf("failed to write CROSSDEV signature: %w", err)
+	}
+
+	// Microkernel start address
+	startAddr := []byte{
+		byte(start),
+		byte(start >> 8),
+	}
+	if err := write(0x0088, startAddr); err != nil {
+		return fmt.Errorf("failed to write microkernel start address: %w", err)
+	}
+
+	// Kernel args extlen (0 until argument passing is implemented)
+	kernelArgs := []byte{0x00, 0x00}
+	if err := write(0x00FA, kernelArgs); err != nil {
+		return fmt.Errorf("failed to write kernel args: %w", err)
+	}
+
+	return nil
+}
+
+// w65816 is the 16-bit 65816 of the C256 machines
+type w65816 struct{}
+
+func (w65816) Name() string                { return "65816" }
+func (w65816) Family() Family              { return Family65816 }
+func (w65816) Alignment() int              { return 1 }
+func (w65816) PointerSize() int            { return 3 }
+func (w65816) ByteOrder() binary.ByteOrder { return binary.LittleEndian }
+func (w65816) DisasmBackend() string       { return "65816" }
+
+// VectorSetup points the reset vector at start. The vector only reaches bank
+// 0, so a program in another bank is started through a stub at 0xFF80.
+func (w65816) VectorSetup(start uint32, write WriteFunc) error {
+	if start&0xFF0000 != 0 {
+		// Startup code is not in bank 0, need a stub at 0xFF80:
+		//   CLC       ; 0x18
+		//   XCE       ; 0xFB
+		//   JML addr  ; 0x5C <low> <mid> <high>
+		stub := []byte{
+			0x18, // CLC
+			0xFB, // XCE
+			0x5C, // JML
+			byte(start),
+			byte(start >> 8),
+			byte(start >> 16),
+		}
+		if err := write(0xFF80, stub); err != nil {
+			return fmt.Errorf("failed to write 65816 stub: %w", err)
+		}
+
+		// Point reset vector to stub
+		resetVector := []byte{0x80, 0xFF}
+		if err := write(0xFFFC, resetVector); err != nil {
+			return fmt.Errorf("failed to write 65816 reset vector: %w", err)
+		}
+	} else {
+		// Startup code is in bank 0, point reset vector directly to it
+		resetVector := []byte{
+			byte(start),
+			byte(start >> 8),
+		}
+		if err := write(0xFFFC, resetVector); err != nil {
+			return fmt.Errorf("failed to write 65816 reset vector: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,390 @@
+// Package dap implements a Debug Adapter Protocol server, so editors such as
+// VS Code can debug programs on Foenix hardware through the debug port
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Register is a named register value shown in the Registers scope
+type Register struct {
+	Name  string
+	Value string
+}
+
+// Target is the machine being debugged
+type Target interface {
+	// Load uploads a program file to the machine
+	Load(program string) error
+
+	// ReadMemory reads length bytes from address
+	ReadMemory(address uint32, length int) ([]byte, error)
+
+	// WriteMemory writes data to address
+	WriteMemory(address uint32, data []byte) error
+
+	// Registers returns the CPU registers and the program counter
+	Registers() ([]Register, uint32, error)
+
+	// Halt stops the CPU
+	Halt() error
+
+	// Continue lets the CPU run
+	Continue() error
+
+	// Step lets the CPU run briefly and stops it again
+	Step() error
+}
+
+// threadID is the single thread reported to the client
+const threadID = 1
+
+// registersReference is the variablesReference of the Registers scope
+const registersReference = 1
+
+// message is the envelope of every DAP message
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       interface{}     `json:"body,omitempty"`
+}
+
+// Session serves one DAP client
+type Session struct {
+	target Target
+	r      *bufio.Reader
+	w      io.Writer
+
+	mu  sync.Mutex // Serializes writes
+	seq int
+
+	stopReason string // Stopped event to send after the current response
+}
+
+// NewSession returns a session reading requests from r and writing responses
+// and events to w
+func NewSession(target Target, r io.Reader, w io.Writer) *Session {
+	return &Session{target: target, r: bufio.NewReader(r), w: w}
+}
+
+// Serve handles requests until the client disconnects or the input ends
+func (s *Session) Serve() error {
+	for {
+		req, err := s.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		s.stopReason = ""
+		body, err := s.handle(req)
+		if err := s.respond(req, body, err); err != nil {
+			return err
+		}
+		if s.stopReason != "" {
+			if err := s.event("stopped", map[string]interface{}{
+				"reason":            s.stopReason,
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			}); err != nil {
+				return err
+			}
+		}
+
+		switch req.Command {
+		case "initialize":
+			if err := s.event("initialized", nil); err != nil {
+				return err
+			}
+		case "disconnect":
+			return s.event("terminated", nil)
+		}
+	}
+}
+
+// handle runs a request and returns the response body
+func (s *Session) handle(req *message) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsReadMemoryRequest":        true,
+			"supportsWriteMemoryRequest":       true,
+		}, nil
+
+	case "launch":
+		var args struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid launch arguments: %w", err)
+		}
+		if args.Program == "" {
+			return nil, fmt.Errorf("launch needs a program")
+		}
+		if err := s.target.Halt(); err != nil {
+			return nil, err
+		}
+		if err := s.target.Load(args.Program); err != nil {
+			return nil, err
+		}
+		if args.StopOnEntry {
+			return nil, s.stopped("entry")
+		}
+		return nil, s.target.Continue()
+
+	case "attach":
+		if err := s.target.Halt(); err != nil {
+			return nil, err
+		}
+		return nil, s.stopped("pause")
+
+	case "configurationDone", "setExceptionBreakpoints":
+		return nil, nil
+
+	case "setBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+
+		// The debug port can't report reaching a breakpoint
+		breakpoints := []map[string]interface{}{}
+		for _, bp := range args.Breakpoints {
+			breakpoints = append(breakpoints, map[string]interface{}{
+				"verified": false,
+				"line":     bp.Line,
+				"message":  "Breakpoints are not supported by the debug port",
+			})
+		}
+		return map[string]interface{}{"breakpoints": breakpoints}, nil
+
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "CPU"}},
+		}, nil
+
+	case "stackTrace":
+		_, pc, err := s.target.Registers()
+		if err != nil {
+			return map[string]interface{}{"stackFrames": []interface{}{}, "totalFrames": 0}, nil
+		}
+		return map[string]interface{}{
+			"stackFrames": []map[string]interface{}{{
+				"id":                          1,
+				"name":                        fmt.Sprintf("$%06X", pc),
+				"line":                        0,
+				"column":                      0,
+				"instructionPointerReference": fmt.Sprintf("0x%X", pc),
+			}},
+			"totalFrames": 1,
+		}, nil
+
+	case "scopes":
+		return map[string]interface{}{
+			"scopes": []map[string]interface{}{{
+				"name":               "Registers",
+				"presentationHint":   "registers",
+				"variablesReference": registersReference,
+			}},
+		}, nil
+
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		variables := []map[string]interface{}{}
+		if args.VariablesReference == registersReference {
+			regs, _, err := s.target.Registers()
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range regs {
+				variables = append(variables, map[string]interface{}{
+					"name":               r.Name,
+					"value":              r.Value,
+					"variablesReference": 0,
+				})
+			}
+		}
+		return map[string]interface{}{"variables": variables}, nil
+
+	case "readMemory":
+		var args struct {
+			MemoryReference string `json:"memoryReference"`
+			Offset          int    `json:"offset"`
+			Count           int    `json:"count"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid readMemory arguments: %w", err)
+		}
+		address, err := memoryAddress(args.MemoryReference, args.Offset)
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.target.ReadMemory(address, args.Count)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"address": fmt.Sprintf("0x%X", address),
+			"data":    base64.StdEncoding.EncodeToString(data),
+		}, nil
+
+	case "writeMemory":
+		var args struct {
+			MemoryReference string `json:"memoryReference"`
+			Offset          int    `json:"offset"`
+			Data            string `json:"data"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, fmt.Errorf("invalid writeMemory arguments: %w", err)
+		}
+		address, err := memoryAddress(args.MemoryReference, args.Offset)
+		if err != nil {
+			return nil, err
+		}
+		data, err := base64.StdEncoding.DecodeString(args.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory data: %w", err)
+		}
+		if err := s.target.WriteMemory(address, data); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bytesWritten": len(data)}, nil
+
+	case "pause":
+		if err := s.target.Halt(); err != nil {
+			return nil, err
+		}
+		return nil, s.stopped("pause")
+
+	case "continue":
+		if err := s.target.Continue(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+
+	case "next", "stepIn", "stepOut":
+		if err := s.target.Step(); err != nil {
+			return nil, err
+		}
+		return nil, s.stopped("step")
+
+	case "disconnect":
+		var args struct {
+			TerminateDebuggee bool `json:"terminateDebuggee"`
+		}
+		json.Unmarshal(req.Arguments, &args)
+		if args.TerminateDebuggee {
+			return nil, nil
+		}
+		return nil, s.target.Continue()
+	}
+
+	return nil, fmt.Errorf("unsupported request '%s'", req.Command)
+}
+
+// stopped queues a stopped event, sent after the response to the request
+func (s *Session) stopped(reason string) error {
+	s.stopReason = reason
+	return nil
+}
+
+// respond sends the response to a request
+func (s *Session) respond(req *message, body interface{}, err error) error {
+	success := err == nil
+	resp := &message{
+		Type:       "response",
+		Command:    req.Command,
+		RequestSeq: req.Seq,
+		Success:    &success,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	return s.write(resp)
+}
+
+// event sends an event
+func (s *Session) event(name string, body interface{}) error {
+	return s.write(&message{Type: "event", Event: name, Body: body})
+}
+
+// write sends a message with its Content-Length header
+func (s *Session) write(m *message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	m.Seq = s.seq
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// read reads the next message
+func (s *Session) read() (*message, error) {
+	header, err := textproto.NewReader(s.r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length <= 0 {
+		return nil, fmt.Errorf("invalid Content-Length header")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.r, data); err != nil {
+		return nil, err
+	}
+
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &m, nil
+}
+
+// memoryAddress resolves a memory reference (a hex address) plus offset
+func memoryAddress(reference string, offset int) (uint32, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(reference, "0x"), "0X")
+	s = strings.TrimPrefix(s, "$")
+	address, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory reference '%s'", reference)
+	}
+	return uint32(int64(address) + int64(offset)), nil
+}
@@ -0,0 +1,226 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+// fakeTarget is a target with 64K of memory
+type fakeTarget struct {
+	memory  [0x10000]byte
+	loaded  string
+	running bool
+	steps   int
+}
+
+func (t *fakeTarget) Load(program string) error {
+	t.loaded = program
+	return nil
+}
+
+func (t *fakeTarget) ReadMemory(address uint32, length int) ([]byte, error) {
+	return append([]byte(nil), t.memory[address:int(address)+length]...), nil
+}
+
+func (t *fakeTarget) WriteMemory(address uint32, data []byte) error {
+	copy(t.memory[address:], data)
+	return nil
+}
+
+func (t *fakeTarget) Registers() ([]Register, uint32, error) {
+	return []Register{{"PC", "E000"}, {"A", "12"}}, 0xE000, nil
+}
+
+func (t *fakeTarget) Halt() error {
+	t.running = false
+	return nil
+}
+
+func (t *fakeTarget) Continue() error {
+	t.running = true
+	return nil
+}
+
+func (t *fakeTarget) Step() error {
+	t.steps++
+	return nil
+}
+
+// client is the editor side of a test session
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func startSession(t *testing.T) (*client, *fakeTarget, chan error) {
+	target := &fakeTarget{}
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewSession(target, reqR, respW).Serve()
+		respW.Close()
+	}()
+	t.Cleanup(func() { reqW.Close() })
+
+	return &client{t: t, w: reqW, r: bufio.NewReader(respR)}, target, done
+}
+
+// request sends a request and returns its response, collecting the events
+// sent with it
+func (c *client) request(command string, args interface{}) (map[string]interface{}, []string) {
+	c.t.Helper()
+
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{
+		"seq": c.seq, "type": "request", "command": command, "arguments": args,
+	})
+	go fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+
+	var response map[string]interface{}
+	var events []string
+	for response == nil {
+		m := c.read()
+		switch m["type"] {
+		case "response":
+			response = m
+		case "event":
+			events = append(events, m["event"].(string))
+		}
+	}
+
+	if response["command"] != command || response["request_seq"] != float64(c.seq) {
+		c.t.Fatalf("response %v doesn't match request %s", response, command)
+	}
+	return response, events
+}
+
+// events reads the events that follow a response
+func (c *client) events(n int) []string {
+	var events []string
+	for len(events) < n {
+		m := c.read()
+		events = append(events, m["event"].(string))
+	}
+	return events
+}
+
+func (c *client) read() map[string]interface{} {
+	c.t.Helper()
+
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("read header: %v", err)
+	}
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		c.t.Fatalf("read body: %v", err)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		c.t.Fatalf("unmarshal: %v", err)
+	}
+	return m
+}
+
+func body(m map[string]interface{}) map[string]interface{} {
+	b, _ := m["body"].(map[string]interface{})
+	return b
+}
+
+func TestSession(t *testing.T) {
+	c, target, done := startSession(t)
+
+	resp, _ := c.request("initialize", map[string]string{"adapterID": "foenix"})
+	if resp["success"] != true || body(resp)["supportsReadMemoryRequest"] != true {
+		t.Fatalf("initialize = %v", resp)
+	}
+	if events := c.events(1); events[0] != "initialized" {
+		t.Errorf("event = %v, want initialized", events)
+	}
+
+	resp, _ = c.request("attach", nil)
+	if events := c.events(1); resp["success"] != true || events[0] != "stopped" {
+		t.Errorf("attach = %v, events %v", resp, events)
+	}
+
+	resp, _ = c.request("writeMemory", map[string]interface{}{
+		"memoryReference": "0x2000", "offset": 1, "data": base64.StdEncoding.EncodeToString([]byte{0xA9, 0x00}),
+	})
+	if resp["success"] != true || target.memory[0x2001] != 0xA9 {
+		t.Errorf("writeMemory = %v", resp)
+	}
+
+	resp, _ = c.request("readMemory", map[string]interface{}{"memoryReference": "0x2000", "count": 3})
+	if got := body(resp)["data"]; got != base64.StdEncoding.EncodeToString([]byte{0x00, 0xA9, 0x00}) {
+		t.Errorf("readMemory data = %v", got)
+	}
+
+	resp, _ = c.request("stackTrace", map[string]int{"threadId": 1})
+	frames := body(resp)["stackFrames"].([]interface{})
+	if len(frames) != 1 || frames[0].(map[string]interface{})["instructionPointerReference"] != "0xE000" {
+		t.Errorf("stackTrace = %v", resp)
+	}
+
+	resp, _ = c.request("variables", map[string]int{"variablesReference": registersReference})
+	if vars := body(resp)["variables"].([]interface{}); len(vars) != 2 {
+		t.Errorf("variables = %v", resp)
+	}
+
+	resp, _ = c.request("setBreakpoints", map[string]interface{}{"breakpoints": []map[string]int{{"line": 10}}})
+	bps := body(resp)["breakpoints"].([]interface{})
+	if len(bps) != 1 || bps[0].(map[string]interface{})["verified"] != false {
+		t.Errorf("setBreakpoints = %v", resp)
+	}
+
+	c.request("continue", map[string]int{"threadId": 1})
+	if !target.running {
+		t.Error("target not running after continue")
+	}
+
+	c.request("pause", map[string]int{"threadId": 1})
+	if events := c.events(1); target.running || events[0] != "stopped" {
+		t.Errorf("pause: running = %v, events %v", target.running, events)
+	}
+
+	resp, _ = c.request("bogus", nil)
+	if resp["success"] != false {
+		t.Errorf("unknown request should fail: %v", resp)
+	}
+
+	c.request("disconnect", nil)
+	if events := c.events(1); events[0] != "terminated" || !target.running {
+		t.Errorf("disconnect: events %v, running %v", events, target.running)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve() error: %v", err)
+	}
+}
+
+func TestLaunch(t *testing.T) {
+	c, target, _ := startSession(t)
+
+	resp, _ := c.request("launch", map[string]interface{}{"program": "hello.pgz", "stopOnEntry": true})
+	if resp["success"] != true || target.loaded != "hello.pgz" || target.running {
+		t.Errorf("launch = %v, loaded %q, running %v", resp, target.loaded, target.running)
+	}
+	if events := c.events(1); events[0] != "stopped" {
+		t.Errorf("events = %v, want stopped", events)
+	}
+
+	resp, _ = c.request("launch", map[string]interface{}{})
+	if resp["success"] != false {
+		t.Errorf("launch without program should fail: %v", resp)
+	}
+}
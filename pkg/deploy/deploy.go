@@ -0,0 +1,283 @@
+// Package deploy reads deployment manifests: the files to upload, the flash
+// to program, the boot source and the actions that finish a deployment,
+// which the deploy command runs as foenixmgr commands over one connection
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+	"github.com/daschewie/foenixmgr/pkg/util"
+	"go.yaml.in/yaml/v3"
+)
+
+// Upload formats that aren't loader formats: raw binaries, loaded at an
+// address, and 68k binaries that start with their reset vectors
+const (
+	FormatBinary     = "bin"
+	FormatM68kBinary = "m68k-bin"
+)
+
+// Actions that finish a deployment
+const (
+	ActionReset = "reset" // Reset the machine
+	ActionStart = "start" // Resume a CPU stopped with 'stop'
+	ActionRun   = "run"   // Start the last uploaded program, like upload --run
+)
+
+// Manifest describes a deployment. Its parts run in a fixed order: flash,
+// boot source, uploads, then the actions in After.
+type Manifest struct {
+	Target  string   `yaml:"target"` // Target machine, unless --target is given
+	Port    string   `yaml:"port"`   // Port, unless --port is given
+	Flash   []Flash  `yaml:"flash"`
+	Boot    string   `yaml:"boot"` // ram or flash, or empty to leave it
+	Uploads []Upload `yaml:"uploads"`
+	After   []string `yaml:"after"`
+}
+
+// Upload is a file uploaded to memory
+type Upload struct {
+	File    string `yaml:"file"`
+	Format  string `yaml:"format"`  // Loader format, bin or m68k-bin; default from the extension
+	Address string `yaml:"address"` // Load address of bin and m68k-bin files
+	SHA256  string `yaml:"sha256"`
+}
+
+// Flash is a file programmed into flash, whole or into a list of sectors
+type Flash struct {
+	File      string `yaml:"file"`
+	Address   string `yaml:"address"` // RAM address the data is staged at
+	Sectors   string `yaml:"sectors"` // e.g. 01 or 00-0F,20; empty for the whole flash
+	Verify    bool   `yaml:"verify"`
+	SkipEmpty bool   `yaml:"skip_empty"`
+	SHA256    string `yaml:"sha256"`
+}
+
+// Step is one foenixmgr command of a deployment
+type Step struct {
+	Name string   // Short description for progress and error messages
+	Args []string // Command line without the program name
+}
+
+// uploadCommands maps upload formats to the commands that upload them
+var uploadCommands = map[string]string{
+	loader.FormatIntelHex: "upload",
+	loader.FormatSREC:     "upload-srec",
+	loader.FormatWDC:      "upload-wdc",
+	loader.FormatPGX:      "run-pgx",
+	loader.FormatPGZ:      "run-pgz",
+	loader.FormatELF:      "run-elf",
+	FormatBinary:          "binary",
+	FormatM68kBinary:      "run-m68k-bin",
+}
+
+// Load reads a manifest file. Relative file names in it are relative to the
+// manifest's directory, so a build can be deployed from anywhere.
+func Load(filename string) (*Manifest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	m, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	m.resolvePaths(filepath.Dir(filename))
+	return m, nil
+}
+
+// Parse reads a manifest. Unknown keys are errors, so a misspelt key isn't
+// silently ignored.
+func Parse(r io.Reader) (*Manifest, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	var m Manifest
+	if err := decoder.Decode(&m); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("manifest is empty")
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// resolvePaths makes the relative file names in the manifest relative to dir
+func (m *Manifest) resolvePaths(dir string) {
+	resolve := func(name string) string {
+		if name == "" || util.IsStream(name) || filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(dir, name)
+	}
+	for i := range m.Flash {
+		m.Flash[i].File = resolve(m.Flash[i].File)
+	}
+	for i := range m.Uploads {
+		m.Uploads[i].File = resolve(m.Uploads[i].File)
+	}
+}
+
+// Steps checks the whole manifest, including that its local files exist, and
+// returns the commands that carry it out. Nothing is returned if any part is
+// wrong, so a deployment doesn't stop half way over a typo.
+func (m *Manifest) Steps() ([]Step, error) {
+	var steps []Step
+
+	for i, f := range m.Flash {
+		step, err := f.step()
+		if err != nil {
+			return nil, fmt.Errorf("flash[%d]: %w", i, err)
+		}
+		steps = append(steps, step)
+	}
+
+	switch boot := strings.ToLower(m.Boot); boot {
+	case "":
+	case "ram", "flash":
+		steps = append(steps, Step{Name: "boot from " + boot, Args: []string{"boot", boot}})
+	default:
+		return nil, fmt.Errorf("boot: invalid boot source '%s' (must be 'ram' or 'flash')", m.Boot)
+	}
+
+	lastUpload := -1
+	for i, u := range m.Uploads {
+		step, err := u.step()
+		if err != nil {
+			return nil, fmt.Errorf("uploads[%d]: %w", i, err)
+		}
+		steps = append(steps, step)
+		lastUpload = len(steps) - 1
+	}
+
+	for i, action := range m.After {
+		switch strings.ToLower(action) {
+		case ActionReset:
+			steps = append(steps, Step{Name: "reset", Args: []string{"reset"}})
+		case ActionStart:
+			steps = append(steps, Step{Name: "start CPU", Args: []string{"start"}})
+		case ActionRun:
+			// The program is started by its upload, which knows its start
+			// address
+			if lastUpload < 0 {
+				return nil, fmt.Errorf("after[%d]: run needs an upload to start", i)
+			}
+			if i != len(m.After)-1 {
+				return nil, fmt.Errorf("after[%d]: run must be the last action", i)
+			}
+			if lastUpload != len(steps)-1 {
+				return nil, fmt.Errorf("after[%d]: run can't follow other actions", i)
+			}
+			steps[lastUpload].Name += " and run"
+			steps[lastUpload].Args = append(steps[lastUpload].Args, "--run")
+		default:
+			return nil, fmt.Errorf("after[%d]: unknown action '%s' (expected reset, start or run)", i, action)
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("manifest has nothing to deploy")
+	}
+	return steps, nil
+}
+
+// HasFlash returns true if the manifest programs flash
+func (m *Manifest) HasFlash() bool {
+	return len(m.Flash) > 0
+}
+
+// step returns the command that uploads the file
+func (u Upload) step() (Step, error) {
+	if err := checkFile(u.File); err != nil {
+		return Step{}, err
+	}
+
+	format := strings.ToLower(u.Format)
+	switch format {
+	case "":
+		var err error
+		if format, err = loader.FormatForFile(u.File); err != nil {
+			return Step{}, fmt.Errorf("%w (set format)", err)
+		}
+	case "hex", "ihex":
+		format = loader.FormatIntelHex
+	}
+	command, ok := uploadCommands[format]
+	if !ok {
+		return Step{}, fmt.Errorf("unknown format '%s' (expected pgz, pgx, hex, srec, wdc, elf, bin or m68k-bin)", u.Format)
+	}
+
+	args := []string{command, u.File}
+	needsAddress := format == FormatBinary || format == FormatM68kBinary
+	switch {
+	case needsAddress && u.Address == "":
+		return Step{}, fmt.Errorf("%s needs an address", filepath.Base(u.File))
+	case needsAddress:
+		args = append(args, "--address", u.Address)
+	case u.Address != "":
+		return Step{}, fmt.Errorf("%s files are loaded at the addresses they record, so address can't be set", format)
+	}
+	if u.SHA256 != "" {
+		args = append(args, "--sha256", u.SHA256)
+	}
+	return Step{Name: "upload " + filepath.Base(u.File), Args: args}, nil
+}
+
+// step returns the command that programs the flash
+func (f Flash) step() (Step, error) {
+	if err := checkFile(f.File); err != nil {
+		return Step{}, err
+	}
+
+	args := []string{"flash", f.File}
+	name := "flash " + filepath.Base(f.File)
+	if f.Sectors != "" {
+		args = append(args, "--flash-sector", f.Sectors)
+		name += " to sectors " + f.Sectors
+	}
+	switch {
+	case f.SkipEmpty && (f.Sectors != "" || f.Address != ""):
+		return Step{}, fmt.Errorf("skip_empty can't be combined with sectors or address")
+	case f.SkipEmpty:
+		args = append(args, "--skip-empty")
+	case f.Address == "":
+		return Step{}, fmt.Errorf("%s needs the RAM address to stage the data at", filepath.Base(f.File))
+	default:
+		args = append(args, "--address", f.Address)
+	}
+	if f.Verify {
+		args = append(args, "--verify")
+	}
+	if f.SHA256 != "" {
+		args = append(args, "--sha256", f.SHA256)
+	}
+	return Step{Name: name, Args: args}, nil
+}
+
+// checkFile checks that a local file to deploy exists. URLs are only
+// checked when they are downloaded.
+func checkFile(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("file is required")
+	case name == util.Stdin:
+		return fmt.Errorf("standard input can't be deployed from a manifest")
+	case util.IsURL(name):
+		return nil
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", name)
+	}
+	return nil
+}
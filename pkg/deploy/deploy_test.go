@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeManifest writes a manifest and empty files for the names given, and
+// returns the manifest's file name
+func writeManifest(t *testing.T, manifest string, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := filepath.Join(dir, "deploy.yaml")
+	if err := os.WriteFile(filename, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestSteps(t *testing.T) {
+	filename := writeManifest(t, `
+target: f256k
+flash:
+  - file: kernel.bin
+    sectors: 3F
+    address: 10000
+    verify: true
+  - file: full.bin
+    skip_empty: true
+boot: RAM
+uploads:
+  - file: game.pgz
+  - file: data.bin
+    format: bin
+    address: 20000
+    sha256: abc
+after:
+  - run
+`, "kernel.bin", "full.bin", "game.pgz", "data.bin")
+
+	m, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if m.Target != "f256k" || !m.HasFlash() {
+		t.Errorf("Load() = %+v", m)
+	}
+
+	steps, err := m.Steps()
+	if err != nil {
+		t.Fatalf("Steps() error: %v", err)
+	}
+
+	dir := filepath.Dir(filename)
+	want := []Step{
+		{"flash kernel.bin to sectors 3F", []string{"flash", filepath.Join(dir, "kernel.bin"), "--flash-sector", "3F", "--address", "10000", "--verify"}},
+		{"flash full.bin", []string{"flash", filepath.Join(dir, "full.bin"), "--skip-empty"}},
+		{"boot from ram", []string{"boot", "ram"}},
+		{"upload game.pgz", []string{"run-pgz", filepath.Join(dir, "game.pgz")}},
+		{"upload data.bin and run", []string{"binary", filepath.Join(dir, "data.bin"), "--address", "20000", "--sha256", "abc", "--run"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("Steps() =\n%v\nwant\n%v", steps, want)
+	}
+}
+
+func TestStepsActions(t *testing.T) {
+	m := &Manifest{After: []string{"reset", "start"}}
+	steps, err := m.Steps()
+	if err != nil {
+		t.Fatalf("Steps() error: %v", err)
+	}
+	if len(steps) != 2 || steps[0].Args[0] != "reset" || steps[1].Args[0] != "start" {
+		t.Errorf("Steps() = %v", steps)
+	}
+}
+
+func TestStepsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"empty", "target: f256k\n", "nothing to deploy"},
+		{"missing file", "uploads:\n  - file: missing.pgz\n", "missing.pgz"},
+		{"no file", "uploads:\n  - format: pgz\n", "file is required"},
+		{"stdin", "uploads:\n  - file: \"-\"\n", "standard input"},
+		{"unknown extension", "uploads:\n  - file: data.bin\n", "set format"},
+		{"unknown format", "uploads:\n  - file: data.bin\n    format: zip\n", "unknown format"},
+		{"binary without address", "uploads:\n  - file: data.bin\n    format: bin\n", "needs an address"},
+		{"address for pgz", "uploads:\n  - file: game.pgz\n    address: 2000\n", "can't be set"},
+		{"flash without address", "flash:\n  - file: data.bin\n", "RAM address"},
+		{"skip empty with sectors", "flash:\n  - file: data.bin\n    sectors: 01\n    skip_empty: true\n", "skip_empty"},
+		{"boot", "boot: rom\nafter: [reset]\n", "invalid boot source"},
+		{"action", "after: [reboot]\n", "unknown action"},
+		{"run without upload", "after: [run]\n", "needs an upload"},
+		{"run not last", "uploads:\n  - file: game.pgz\nafter: [run, reset]\n", "last action"},
+		{"run after reset", "uploads:\n  - file: game.pgz\nafter: [reset, run]\n", "can't follow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Load(writeManifest(t, tt.manifest, "data.bin", "game.pgz"))
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+			steps, err := m.Steps()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Steps() = %v, %v; want error containing %q", steps, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse(strings.NewReader("")); err == nil {
+		t.Error("Parse() of an empty manifest succeeded")
+	}
+	if _, err := Parse(strings.NewReader("uploads:\n  - file: a.pgz\n    adress: 2000\n")); err == nil || !strings.Contains(err.Error(), "adress") {
+		t.Errorf("Parse() of a misspelt key error = %v", err)
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	m := &Manifest{
+		Uploads: []Upload{{File: "game.pgz"}, {File: "https://ci.example.com/game.pgz"}, {File: "/abs/game.pgz"}},
+	}
+	m.resolvePaths("build")
+	want := []string{filepath.Join("build", "game.pgz"), "https://ci.example.com/game.pgz", "/abs/game.pgz"}
+	for i, u := range m.Uploads {
+		if u.File != want[i] {
+			t.Errorf("Uploads[%d].File = %q, want %q", i, u.File, want[i])
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package disasm provides disassemblers for the CPUs used by Foenix retro
+// computers (65C02, 65816, 680x0)
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/cpu"
+)
+
+// Symbols maps addresses to label names. Operands that refer to a labelled
+// address are shown with the label instead of the number.
+type Symbols map[uint32]string
+
+// Instruction is a single decoded instruction
+type Instruction struct {
+	Address  uint32
+	Bytes    []byte
+	Mnemonic string
+	Operand  string
+	Label    string // Label at Address, if any
+}
+
+// Size returns the length of the instruction in bytes
+func (i Instruction) Size() int {
+	return len(i.Bytes)
+}
+
+// Text returns the instruction without address or bytes, e.g. "LDA #$00"
+func (i Instruction) Text() string {
+	if i.Operand == "" {
+		return i.Mnemonic
+	}
+	return i.Mnemonic + " " + i.Operand
+}
+
+// String formats the instruction as a listing line with the address and
+// instruction bytes, e.g. "00E000  A9 00           LDA #$00"
+func (i Instruction) String() string {
+	var hex strings.Builder
+	for n, b := range i.Bytes {
+		if n > 0 {
+			hex.WriteByte(' ')
+		}
+		fmt.Fprintf(&hex, "%02X", b)
+	}
+	return fmt.Sprintf("%06X  %-*s  %s", i.Address, bytesColumn, hex.String(), i.Text())
+}
+
+// bytesColumn is the width of the instruction bytes column in listings, wide
+// enough for the longest 65xx instruction and most 680x0 instructions
+const bytesColumn = 14
+
+// Disassembler decodes machine code for one CPU family
+type Disassembler interface {
+	// Decode decodes the instruction at the start of data, which is located
+	// at address. Data that doesn't hold a complete instruction is returned
+	// as a data directive.
+	Decode(data []byte, address uint32) Instruction
+
+	// MaxLength returns the length in bytes of the longest instruction
+	MaxLength() int
+}
+
+// New returns a disassembler for a CPU type as used in the cpu setting, using
+// the decoder its cpu.CPU names
+func New(cpuName string, symbols Symbols) (Disassembler, error) {
+	c, err := cpu.Lookup(cpuName)
+	if err != nil {
+		return nil, fmt.Errorf("no disassembler for CPU %s", cpuName)
+	}
+	switch c.DisasmBackend() {
+	case "65c02":
+		return new65xx(opcodes65C02(), false, symbols), nil
+	case "65816":
+		return new65xx(opcodes65816(), true, symbols), nil
+	case "m68k":
+		return &m68k{symbols: symbols}, nil
+	}
+	return nil, fmt.Errorf("no disassembler for CPU %s", cpuName)
+}
+
+// Disassemble decodes up to count instructions from data, which is located at
+// address. It stops early when data runs out.
+func Disassemble(d Disassembler, data []byte, address uint32, count int) []Instruction {
+	var listing []Instruction
+	offset := 0
+	for len(listing) < count && offset < len(data) {
+		inst := d.Decode(data[offset:], address+uint32(offset))
+		listing = append(listing, inst)
+		offset += inst.Size()
+	}
+	return listing
+}
+
+// name returns the label for an address, or the address formatted as hex with
+// at least digits digits
+func (s Symbols) name(address uint32, digits int) string {
+	if label, ok := s[address]; ok {
+		return label
+	}
+	return fmt.Sprintf("$%0*X", digits, address)
+}
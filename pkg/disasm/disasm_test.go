@@ -0,0 +1,173 @@
+package disasm
+
+import (
+	"testing"
+)
+
+func TestDecode65C02(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint32
+		data    []byte
+		want    string
+	}{
+		{"Immediate", 0xE000, []byte{0xA9, 0x12}, "LDA #$12"},
+		{"Absolute", 0xE000, []byte{0x8D, 0x34, 0x12}, "STA $1234"},
+		{"Zero page indirect", 0xE000, []byte{0xB2, 0x80}, "LDA ($80)"},
+		{"Indexed indirect", 0xE000, []byte{0x7C, 0x00, 0x20}, "JMP ($2000,X)"},
+		{"Indirect indexed", 0xE000, []byte{0xB1, 0xFE}, "LDA ($FE),Y"},
+		{"Branch forward", 0xE000, []byte{0xD0, 0x04}, "BNE $E006"},
+		{"Branch backward", 0xE010, []byte{0x80, 0xFE}, "BRA $E010"},
+		{"Accumulator", 0xE000, []byte{0x0A}, "ASL A"},
+		{"RMB", 0xE000, []byte{0x37, 0x10}, "RMB3 $10"},
+		{"BBS", 0xE000, []byte{0xFF, 0x10, 0xFD}, "BBS7 $10,$E000"},
+		{"No 16-bit immediates", 0xE000, []byte{0xA2, 0xFF, 0x00}, "LDX #$FF"},
+		{"Undefined opcode", 0xE000, []byte{0x03}, "NOP"},
+		{"Truncated", 0xE000, []byte{0xAD, 0x34}, ".byte $AD"},
+	}
+
+	d, err := New("65c02", nil)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := d.Decode(tt.data, tt.address)
+			if got := inst.Text(); got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode65816RegisterWidths(t *testing.T) {
+	code := []byte{
+		0xA9, 0x12, // LDA #$12
+		0xC2, 0x30, // REP #$30
+		0xA9, 0x34, 0x12, // LDA #$1234
+		0xA2, 0x00, 0x10, // LDX #$1000
+		0xE2, 0x20, // SEP #$20
+		0xA9, 0x56, // LDA #$56
+		0xA0, 0x00, 0x20, // LDY #$2000
+		0x22, 0x56, 0x34, 0x12, // JSL $123456
+		0x54, 0x01, 0x02, // MVN $02,$01
+	}
+	want := []string{
+		"LDA #$12",
+		"REP #$30",
+		"LDA #$1234",
+		"LDX #$1000",
+		"SEP #$20",
+		"LDA #$56",
+		"LDY #$2000",
+		"JSL $123456",
+		"MVN $02,$01",
+	}
+
+	d, err := New("65816", nil)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	listing := Disassemble(d, code, 0x010000, 100)
+	if len(listing) != len(want) {
+		t.Fatalf("Disassemble() returned %d instructions, want %d", len(listing), len(want))
+	}
+	for i, inst := range listing {
+		if got := inst.Text(); got != want[i] {
+			t.Errorf("instruction %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestDecode65816BranchStaysInBank(t *testing.T) {
+	d, _ := New("65816", nil)
+	inst := d.Decode([]byte{0x80, 0x10}, 0x02FFF8)
+	if got := inst.Text(); got != "BRA $02000A" {
+		t.Errorf("Decode() = %q, want %q", got, "BRA $02000A")
+	}
+}
+
+func TestDecode68000(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"NOP", []byte{0x4E, 0x71}, "NOP"},
+		{"RTS", []byte{0x4E, 0x75}, "RTS"},
+		{"MOVEQ", []byte{0x70, 0xFF}, "MOVEQ #-$1,D0"},
+		{"MOVE.L immediate", []byte{0x20, 0x3C, 0x12, 0x34, 0x56, 0x78}, "MOVE.L #$12345678,D0"},
+		{"MOVE.W postincrement", []byte{0x32, 0xD8}, "MOVE.W (A0)+,(A1)+"},
+		{"MOVEA.L", []byte{0x20, 0x48}, "MOVEA.L A0,A0"},
+		{"MOVE.B displacement", []byte{0x11, 0x68, 0xFF, 0xFE, 0x00, 0x04}, "MOVE.B (-$2,A0),($4,A0)"},
+		{"LEA absolute", []byte{0x41, 0xF9, 0x00, 0xFE, 0x00, 0x00}, "LEA $00FE0000,A0"},
+		{"LEA PC relative", []byte{0x43, 0xFA, 0x00, 0x10}, "LEA ($001012,PC),A1"},
+		{"JSR absolute word", []byte{0x4E, 0xB8, 0x10, 0x00}, "JSR $1000.W"},
+		{"BRA.S", []byte{0x60, 0xFE}, "BRA.S $001000"},
+		{"BNE word", []byte{0x66, 0x00, 0x00, 0x10}, "BNE $001012"},
+		{"DBF", []byte{0x51, 0xC9, 0xFF, 0xFC}, "DBF D1,$000FFE"},
+		{"ADDQ", []byte{0x50, 0x88}, "ADDQ.L #8,A0"},
+		{"SUB.W", []byte{0x90, 0x41}, "SUB.W D1,D0"},
+		{"ADDA.L", []byte{0xD1, 0xC1}, "ADDA.L D1,A0"},
+		{"CMPI.B", []byte{0x0C, 0x00, 0x00, 0x41}, "CMPI.B #$41,D0"},
+		{"ANDI to SR", []byte{0x02, 0x7C, 0xF8, 0xFF}, "ANDI #$F8FF,SR"},
+		{"BTST static", []byte{0x08, 0x10, 0x00, 0x07}, "BTST #7,(A0)"},
+		{"MOVEM push", []byte{0x48, 0xE7, 0xC0, 0xC0}, "MOVEM.L D0-D1/A0-A1,-(A7)"},
+		{"MOVEM pop", []byte{0x4C, 0xDF, 0x03, 0x03}, "MOVEM.L (A7)+,D0-D1/A0-A1"},
+		{"LSL.W", []byte{0xE3, 0x48}, "LSL.W #1,D0"},
+		{"ROR.L register", []byte{0xE2, 0xB8}, "ROR.L D1,D0"},
+		{"MULU", []byte{0xC0, 0xC1}, "MULU.W D1,D0"},
+		{"EXG", []byte{0xC1, 0x41}, "EXG D0,D1"},
+		{"TRAP", []byte{0x4E, 0x4F}, "TRAP #15"},
+		{"LINK", []byte{0x4E, 0x56, 0xFF, 0xF8}, "LINK A6,#-$8"},
+		{"Line A", []byte{0xA0, 0x00}, "DC.W $A000"},
+		{"Truncated", []byte{0x4E, 0xB9, 0x00}, "DC.W $4EB9"},
+	}
+
+	d, err := New("68000", nil)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inst := d.Decode(tt.data, 0x1000)
+			if got := inst.Text(); got != tt.want {
+				t.Errorf("Decode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	symbols := Symbols{0xE000: "start", 0xE100: "print"}
+
+	d, _ := New("65c02", symbols)
+	listing := Disassemble(d, []byte{0x20, 0x00, 0xE1, 0x80, 0xFB}, 0xE000, 2)
+
+	if listing[0].Label != "start" {
+		t.Errorf("Label = %q, want start", listing[0].Label)
+	}
+	if got := listing[0].Text(); got != "JSR print" {
+		t.Errorf("instruction 0 = %q, want %q", got, "JSR print")
+	}
+	if got := listing[1].Text(); got != "BRA start" {
+		t.Errorf("instruction 1 = %q, want %q", got, "BRA start")
+	}
+}
+
+func TestInstructionString(t *testing.T) {
+	inst := Instruction{Address: 0xE000, Bytes: []byte{0xA9, 0x00}, Mnemonic: "LDA", Operand: "#$00"}
+	want := "00E000  A9 00           LDA #$00"
+	if got := inst.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestNewUnknownCPU(t *testing.T) {
+	if _, err := New("z80", nil); err == nil {
+		t.Error("New() expected error for unknown CPU")
+	}
+}
@@ -0,0 +1,321 @@
+package disasm
+
+import "fmt"
+
+// Addressing modes of the 65xx family
+type mode int
+
+const (
+	modeImplied    mode = iota // CLC
+	modeAccum                  // ASL A
+	modeImm8                   // LDA #$12 (always 8-bit)
+	modeImmM                   // LDA #$12 / #$1234 depending on the M flag
+	modeImmX                   // LDX #$12 / #$1234 depending on the X flag
+	modeDP                     // LDA $12
+	modeDPX                    // LDA $12,X
+	modeDPY                    // LDX $12,Y
+	modeDPInd                  // LDA ($12)
+	modeDPIndX                 // LDA ($12,X)
+	modeDPIndY                 // LDA ($12),Y
+	modeDPIndLong              // LDA [$12]
+	modeDPIndLongY             // LDA [$12],Y
+	modeAbs                    // LDA $1234
+	modeAbsX                   // LDA $1234,X
+	modeAbsY                   // LDA $1234,Y
+	modeAbsInd                 // JMP ($1234)
+	modeAbsIndX                // JMP ($1234,X)
+	modeAbsIndLong             // JML [$1234]
+	modeLong                   // LDA $123456
+	modeLongX                  // LDA $123456,X
+	modeStack                  // LDA $12,S
+	modeStackIndY              // LDA ($12,S),Y
+	modeRel                    // BNE label (8-bit offset)
+	modeRelLong                // BRL label (16-bit offset)
+	modeDPRel                  // BBR0 $12,label
+	modeMove                   // MVN $12,$34
+)
+
+// length returns the size of an operand, not counting 16-bit immediates
+func (m mode) length() int {
+	switch m {
+	case modeImplied, modeAccum:
+		return 0
+	case modeAbs, modeAbsX, modeAbsY, modeAbsInd, modeAbsIndX, modeAbsIndLong,
+		modeRelLong, modeDPRel, modeMove:
+		return 2
+	case modeLong, modeLongX:
+		return 3
+	}
+	return 1
+}
+
+// opcode is one entry of a 65xx opcode table
+type opcode struct {
+	mnemonic string
+	mode     mode
+}
+
+// m65xx disassembles 65C02 and 65816 code
+type m65xx struct {
+	opcodes [256]opcode
+	native  bool // 65816: track REP/SEP to size immediates
+	symbols Symbols
+
+	// Register widths of the 65816, updated by REP and SEP. Code is assumed
+	// to start with 8-bit registers.
+	longA bool
+	longX bool
+}
+
+func new65xx(opcodes [256]opcode, native bool, symbols Symbols) *m65xx {
+	return &m65xx{opcodes: opcodes, native: native, symbols: symbols}
+}
+
+// MaxLength returns the length of the longest instruction
+func (d *m65xx) MaxLength() int {
+	return 4
+}
+
+// Decode decodes one instruction
+func (d *m65xx) Decode(data []byte, address uint32) Instruction {
+	op := d.opcodes[data[0]]
+
+	size := 1 + op.mode.length()
+	if (op.mode == modeImmM && d.longA) || (op.mode == modeImmX && d.longX) {
+		size++
+	}
+	if len(data) < size {
+		return Instruction{
+			Address:  address,
+			Bytes:    data[:1],
+			Mnemonic: ".byte",
+			Operand:  fmt.Sprintf("$%02X", data[0]),
+			Label:    d.symbols[address],
+		}
+	}
+
+	bytes := data[:size]
+	operand := d.operand(op.mode, bytes, address)
+
+	// REP and SEP change the width of later immediates
+	if d.native && op.mode == modeImm8 {
+		switch op.mnemonic {
+		case "REP":
+			d.longA = d.longA || bytes[1]&0x20 != 0
+			d.longX = d.longX || bytes[1]&0x10 != 0
+		case "SEP":
+			d.longA = d.longA && bytes[1]&0x20 == 0
+			d.longX = d.longX && bytes[1]&0x10 == 0
+		}
+	}
+
+	return Instruction{
+		Address:  address,
+		Bytes:    bytes,
+		Mnemonic: op.mnemonic,
+		Operand:  operand,
+		Label:    d.symbols[address],
+	}
+}
+
+// operand formats the operand of an instruction
+func (d *m65xx) operand(m mode, bytes []byte, address uint32) string {
+	var value uint32
+	for i := len(bytes) - 1; i > 0; i-- {
+		value = value<<8 | uint32(bytes[i])
+	}
+
+	switch m {
+	case modeImplied:
+		return ""
+	case modeAccum:
+		return "A"
+	case modeImm8, modeImmM, modeImmX:
+		return fmt.Sprintf("#$%0*X", (len(bytes)-1)*2, value)
+	case modeDP:
+		return d.symbols.name(value, 2)
+	case modeDPX:
+		return d.symbols.name(value, 2) + ",X"
+	case modeDPY:
+		return d.symbols.name(value, 2) + ",Y"
+	case modeDPInd:
+		return "(" + d.symbols.name(value, 2) + ")"
+	case modeDPIndX:
+		return "(" + d.symbols.name(value, 2) + ",X)"
+	case modeDPIndY:
+		return "(" + d.symbols.name(value, 2) + "),Y"
+	case modeDPIndLong:
+		return "[" + d.symbols.name(value, 2) + "]"
+	case modeDPIndLongY:
+		return "[" + d.symbols.name(value, 2) + "],Y"
+	case modeAbs:
+		return d.symbols.name(value, 4)
+	case modeAbsX:
+		return d.symbols.name(value, 4) + ",X"
+	case modeAbsY:
+		return d.symbols.name(value, 4) + ",Y"
+	case modeAbsInd:
+		return "(" + d.symbols.name(value, 4) + ")"
+	case modeAbsIndX:
+		return "(" + d.symbols.name(value, 4) + ",X)"
+	case modeAbsIndLong:
+		return "[" + d.symbols.name(value, 4) + "]"
+	case modeLong:
+		return d.symbols.name(value, 6)
+	case modeLongX:
+		return d.symbols.name(value, 6) + ",X"
+	case modeStack:
+		return fmt.Sprintf("$%02X,S", value)
+	case modeStackIndY:
+		return fmt.Sprintf("($%02X,S),Y", value)
+	case modeRel:
+		return d.branchTarget(address, 2, int32(int8(bytes[1])))
+	case modeRelLong:
+		return d.branchTarget(address, 3, int32(int16(value)))
+	case modeDPRel:
+		return d.symbols.name(uint32(bytes[1]), 2) + "," + d.branchTarget(address, 3, int32(int8(bytes[2])))
+	case modeMove:
+		// Source bank is the second operand byte, destination the first
+		return fmt.Sprintf("$%02X,$%02X", bytes[2], bytes[1])
+	}
+	return ""
+}
+
+// branchTarget formats the target of a relative branch. Branches wrap within
+// the 64K bank of the instruction.
+func (d *m65xx) branchTarget(address uint32, size int, offset int32) string {
+	target := uint32(int32(address&0xFFFF)+int32(size)+offset) & 0xFFFF
+	target |= address & 0xFF0000
+	if target > 0xFFFF {
+		return d.symbols.name(target, 6)
+	}
+	return d.symbols.name(target, 4)
+}
+
+// opcodes65816 returns the opcode table of the 65816
+func opcodes65816() [256]opcode {
+	return [256]opcode{
+		{"BRK", modeImm8}, {"ORA", modeDPIndX}, {"COP", modeImm8}, {"ORA", modeStack},
+		{"TSB", modeDP}, {"ORA", modeDP}, {"ASL", modeDP}, {"ORA", modeDPIndLong},
+		{"PHP", modeImplied}, {"ORA", modeImmM}, {"ASL", modeAccum}, {"PHD", modeImplied},
+		{"TSB", modeAbs}, {"ORA", modeAbs}, {"ASL", modeAbs}, {"ORA", modeLong},
+
+		{"BPL", modeRel}, {"ORA", modeDPIndY}, {"ORA", modeDPInd}, {"ORA", modeStackIndY},
+		{"TRB", modeDP}, {"ORA", modeDPX}, {"ASL", modeDPX}, {"ORA", modeDPIndLongY},
+		{"CLC", modeImplied}, {"ORA", modeAbsY}, {"INC", modeAccum}, {"TCS", modeImplied},
+		{"TRB", modeAbs}, {"ORA", modeAbsX}, {"ASL", modeAbsX}, {"ORA", modeLongX},
+
+		{"JSR", modeAbs}, {"AND", modeDPIndX}, {"JSL", modeLong}, {"AND", modeStack},
+		{"BIT", modeDP}, {"AND", modeDP}, {"ROL", modeDP}, {"AND", modeDPIndLong},
+		{"PLP", modeImplied}, {"AND", modeImmM}, {"ROL", modeAccum}, {"PLD", modeImplied},
+		{"BIT", modeAbs}, {"AND", modeAbs}, {"ROL", modeAbs}, {"AND", modeLong},
+
+		{"BMI", modeRel}, {"AND", modeDPIndY}, {"AND", modeDPInd}, {"AND", modeStackIndY},
+		{"BIT", modeDPX}, {"AND", modeDPX}, {"ROL", modeDPX}, {"AND", modeDPIndLongY},
+		{"SEC", modeImplied}, {"AND", modeAbsY}, {"DEC", modeAccum}, {"TSC", modeImplied},
+		{"BIT", modeAbsX}, {"AND", modeAbsX}, {"ROL", modeAbsX}, {"AND", modeLongX},
+
+		{"RTI", modeImplied}, {"EOR", modeDPIndX}, {"WDM", modeImm8}, {"EOR", modeStack},
+		{"MVP", modeMove}, {"EOR", modeDP}, {"LSR", modeDP}, {"EOR", modeDPIndLong},
+		{"PHA", modeImplied}, {"EOR", modeImmM}, {"LSR", modeAccum}, {"PHK", modeImplied},
+		{"JMP", modeAbs}, {"EOR", modeAbs}, {"LSR", modeAbs}, {"EOR", modeLong},
+
+		{"BVC", modeRel}, {"EOR", modeDPIndY}, {"EOR", modeDPInd}, {"EOR", modeStackIndY},
+		{"MVN", modeMove}, {"EOR", modeDPX}, {"LSR", modeDPX}, {"EOR", modeDPIndLongY},
+		{"CLI", modeImplied}, {"EOR", modeAbsY}, {"PHY", modeImplied}, {"TCD", modeImplied},
+		{"JML", modeLong}, {"EOR", modeAbsX}, {"LSR", modeAbsX}, {"EOR", modeLongX},
+
+		{"RTS", modeImplied}, {"ADC", modeDPIndX}, {"PER", modeRelLong}, {"ADC", modeStack},
+		{"STZ", modeDP}, {"ADC", modeDP}, {"ROR", modeDP}, {"ADC", modeDPIndLong},
+		{"PLA", modeImplied}, {"ADC", modeImmM}, {"ROR", modeAccum}, {"RTL", modeImplied},
+		{"JMP", modeAbsInd}, {"ADC", modeAbs}, {"ROR", modeAbs}, {"ADC", modeLong},
+
+		{"BVS", modeRel}, {"ADC", modeDPIndY}, {"ADC", modeDPInd}, {"ADC", modeStackIndY},
+		{"STZ", modeDPX}, {"ADC", modeDPX}, {"ROR", modeDPX}, {"ADC", modeDPIndLongY},
+		{"SEI", modeImplied}, {"ADC", modeAbsY}, {"PLY", modeImplied}, {"TDC", modeImplied},
+		{"JMP", modeAbsIndX}, {"ADC", modeAbsX}, {"ROR", modeAbsX}, {"ADC", modeLongX},
+
+		{"BRA", modeRel}, {"STA", modeDPIndX}, {"BRL", modeRelLong}, {"STA", modeStack},
+		{"STY", modeDP}, {"STA", modeDP}, {"STX", modeDP}, {"STA", modeDPIndLong},
+		{"DEY", modeImplied}, {"BIT", modeImmM}, {"TXA", modeImplied}, {"PHB", modeImplied},
+		{"STY", modeAbs}, {"STA", modeAbs}, {"STX", modeAbs}, {"STA", modeLong},
+
+		{"BCC", modeRel}, {"STA", modeDPIndY}, {"STA", modeDPInd}, {"STA", modeStackIndY},
+		{"STY", modeDPX}, {"STA", modeDPX}, {"STX", modeDPY}, {"STA", modeDPIndLongY},
+		{"TYA", modeImplied}, {"STA", modeAbsY}, {"TXS", modeImplied}, {"TXY", modeImplied},
+		{"STZ", modeAbs}, {"STA", modeAbsX}, {"STZ", modeAbsX}, {"STA", modeLongX},
+
+		{"LDY", modeImmX}, {"LDA", modeDPIndX}, {"LDX", modeImmX}, {"LDA", modeStack},
+		{"LDY", modeDP}, {"LDA", modeDP}, {"LDX", modeDP}, {"LDA", modeDPIndLong},
+		{"TAY", modeImplied}, {"LDA", modeImmM}, {"TAX", modeImplied}, {"PLB", modeImplied},
+		{"LDY", modeAbs}, {"LDA", modeAbs}, {"LDX", modeAbs}, {"LDA", modeLong},
+
+		{"BCS", modeRel}, {"LDA", modeDPIndY}, {"LDA", modeDPInd}, {"LDA", modeStackIndY},
+		{"LDY", modeDPX}, {"LDA", modeDPX}, {"LDX", modeDPY}, {"LDA", modeDPIndLongY},
+		{"CLV", modeImplied}, {"LDA", modeAbsY}, {"TSX", modeImplied}, {"TYX", modeImplied},
+		{"LDY", modeAbsX}, {"LDA", modeAbsX}, {"LDX", modeAbsY}, {"LDA", modeLongX},
+
+		{"CPY", modeImmX}, {"CMP", modeDPIndX}, {"REP", modeImm8}, {"CMP", modeStack},
+		{"CPY", modeDP}, {"CMP", modeDP}, {"DEC", modeDP}, {"CMP", modeDPIndLong},
+		{"INY", modeImplied}, {"CMP", modeImmM}, {"DEX", modeImplied}, {"WAI", modeImplied},
+		{"CPY", modeAbs}, {"CMP", modeAbs}, {"DEC", modeAbs}, {"CMP", modeLong},
+
+		{"BNE", modeRel}, {"CMP", modeDPIndY}, {"CMP", modeDPInd}, {"CMP", modeStackIndY},
+		{"PEI", modeDPInd}, {"CMP", modeDPX}, {"DEC", modeDPX}, {"CMP", modeDPIndLongY},
+		{"CLD", modeImplied}, {"CMP", modeAbsY}, {"PHX", modeImplied}, {"STP", modeImplied},
+		{"JML", modeAbsIndLong}, {"CMP", modeAbsX}, {"DEC", modeAbsX}, {"CMP", modeLongX},
+
+		{"CPX", modeImmX}, {"SBC", modeDPIndX}, {"SEP", modeImm8}, {"SBC", modeStack},
+		{"CPX", modeDP}, {"SBC", modeDP}, {"INC", modeDP}, {"SBC", modeDPIndLong},
+		{"INX", modeImplied}, {"SBC", modeImmM}, {"NOP", modeImplied}, {"XBA", modeImplied},
+		{"CPX", modeAbs}, {"SBC", modeAbs}, {"INC", modeAbs}, {"SBC", modeLong},
+
+		{"BEQ", modeRel}, {"SBC", modeDPIndY}, {"SBC", modeDPInd}, {"SBC", modeStackIndY},
+		{"PEA", modeAbs}, {"SBC", modeDPX}, {"INC", modeDPX}, {"SBC", modeDPIndLongY},
+		{"SED", modeImplied}, {"SBC", modeAbsY}, {"PLX", modeImplied}, {"XCE", modeImplied},
+		{"JSR", modeAbsIndX}, {"SBC", modeAbsX}, {"INC", modeAbsX}, {"SBC", modeLongX},
+	}
+}
+
+// opcodes65C02 returns the opcode table of the WDC 65C02, which shares most
+// opcodes with the 65816. Immediates are always 8-bit.
+func opcodes65C02() [256]opcode {
+	ops := opcodes65816()
+
+	for i := range ops {
+		switch ops[i].mode {
+		case modeImmM, modeImmX:
+			ops[i].mode = modeImm8
+		}
+
+		// Columns 3 and B are one byte NOPs, except WAI and STP
+		if i&0x0F == 0x03 || (i&0x0F == 0x0B && i != 0xCB && i != 0xDB) {
+			ops[i] = opcode{"NOP", modeImplied}
+		}
+	}
+
+	// Column 2 is a two byte NOP, except (zp) addressing in odd rows
+	for _, i := range []int{0x02, 0x22, 0x42, 0x62, 0x82, 0xC2, 0xE2} {
+		ops[i] = opcode{"NOP", modeImm8}
+	}
+
+	// Column 7 is RMB/SMB, column F is BBR/BBS
+	for bit := 0; bit < 8; bit++ {
+		ops[bit<<4|0x07] = opcode{fmt.Sprintf("RMB%d", bit), modeDP}
+		ops[0x80|bit<<4|0x07] = opcode{fmt.Sprintf("SMB%d", bit), modeDP}
+		ops[bit<<4|0x0F] = opcode{fmt.Sprintf("BBR%d", bit), modeDPRel}
+		ops[0x80|bit<<4|0x0F] = opcode{fmt.Sprintf("BBS%d", bit), modeDPRel}
+	}
+
+	ops[0x00] = opcode{"BRK", modeImplied}
+	ops[0x20] = opcode{"JSR", modeAbs}
+	ops[0x44] = opcode{"NOP", modeDP}
+	ops[0x54] = opcode{"NOP", modeDPX}
+	ops[0xD4] = opcode{"NOP", modeDPX}
+	ops[0xF4] = opcode{"NOP", modeDPX}
+	ops[0x5C] = opcode{"NOP", modeAbs}
+	ops[0xDC] = opcode{"NOP", modeAbs}
+	ops[0xFC] = opcode{"NOP", modeAbs}
+
+	return ops
+}
@@ -0,0 +1,523 @@
+package disasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// m68k disassembles the 68000 instruction set. Later 680x0 CPUs run the same
+// code; their additional instructions are shown as data.
+type m68k struct {
+	symbols Symbols
+}
+
+// MaxLength returns the length of the longest 68000 instruction
+func (d *m68k) MaxLength() int {
+	return 10
+}
+
+// Size suffixes by the usual two bit size field (00 byte, 01 word, 10 long)
+var sizeSuffix = []string{".B", ".W", ".L"}
+
+// Condition codes of Bcc, DBcc and Scc
+var conditions = []string{"T", "F", "HI", "LS", "CC", "CS", "NE", "EQ", "VC", "VS", "PL", "MI", "GE", "LT", "GT", "LE"}
+
+// errNotCode is raised (via panic) when an instruction runs past the end of
+// the data or uses an invalid addressing mode. The word is shown as data.
+type errNotCode struct{}
+
+// m68kDecoder holds the state of decoding one instruction
+type m68kDecoder struct {
+	*m68k
+	data    []byte
+	address uint32
+	pos     int
+}
+
+// word reads the next 16-bit word of the instruction
+func (s *m68kDecoder) word() uint16 {
+	if s.pos+2 > len(s.data) {
+		panic(errNotCode{})
+	}
+	w := binary.BigEndian.Uint16(s.data[s.pos:])
+	s.pos += 2
+	return w
+}
+
+// long reads the next 32-bit long word of the instruction
+func (s *m68kDecoder) long() uint32 {
+	return uint32(s.word())<<16 | uint32(s.word())
+}
+
+// Decode decodes one instruction
+func (d *m68k) Decode(data []byte, address uint32) (inst Instruction) {
+	inst = Instruction{Address: address, Label: d.symbols[address]}
+
+	// Odd trailing bytes and undecodable instructions are shown as data
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(errNotCode); !ok {
+				panic(r)
+			}
+			if len(data) >= 2 {
+				inst.Bytes = data[:2]
+				inst.Mnemonic = "DC.W"
+				inst.Operand = fmt.Sprintf("$%04X", binary.BigEndian.Uint16(data))
+			} else {
+				inst.Bytes = data[:1]
+				inst.Mnemonic = "DC.B"
+				inst.Operand = fmt.Sprintf("$%02X", data[0])
+			}
+		}
+	}()
+
+	s := &m68kDecoder{m68k: d, data: data, address: address}
+	op := s.word()
+	inst.Mnemonic, inst.Operand = s.decode(op)
+	if inst.Mnemonic == "" {
+		inst.Mnemonic = "DC.W"
+		inst.Operand = fmt.Sprintf("$%04X", op)
+		s.pos = 2
+	}
+	inst.Bytes = data[:s.pos]
+	return inst
+}
+
+// decode decodes an instruction from its first word. An empty mnemonic means
+// the word isn't a valid 68000 instruction.
+func (s *m68kDecoder) decode(op uint16) (string, string) {
+	size := int(op>>6) & 3
+	eaMode := int(op>>3) & 7
+	eaReg := int(op) & 7
+	reg := int(op>>9) & 7
+
+	switch op >> 12 {
+	case 0x0:
+		return s.decodeImmediate(op, size, eaMode, eaReg, reg)
+
+	case 0x1, 0x2, 0x3:
+		moveSize := map[uint16]int{1: 0, 3: 1, 2: 2}[op>>12]
+		src := s.ea(eaMode, eaReg, moveSize)
+		destMode := int(op>>6) & 7
+		if destMode == 1 {
+			if moveSize == 0 {
+				return "", ""
+			}
+			return "MOVEA" + sizeSuffix[moveSize], src + "," + s.ea(1, reg, moveSize)
+		}
+		return "MOVE" + sizeSuffix[moveSize], src + "," + s.ea(destMode, reg, moveSize)
+
+	case 0x4:
+		return s.decodeMisc(op, size, eaMode, eaReg, reg)
+
+	case 0x5:
+		cond := conditions[(op>>8)&0x0F]
+		if size == 3 {
+			if eaMode == 1 {
+				return "DB" + cond, fmt.Sprintf("D%d,%s", eaReg, s.branch(int32(int16(s.word()))))
+			}
+			return "S" + cond, s.ea(eaMode, eaReg, 0)
+		}
+		data := reg
+		if data == 0 {
+			data = 8
+		}
+		mnemonic := "ADDQ"
+		if op&0x0100 != 0 {
+			mnemonic = "SUBQ"
+		}
+		return mnemonic + sizeSuffix[size], fmt.Sprintf("#%d,%s", data, s.ea(eaMode, eaReg, size))
+
+	case 0x6:
+		mnemonic := "B" + conditions[(op>>8)&0x0F]
+		switch (op >> 8) & 0x0F {
+		case 0:
+			mnemonic = "BRA"
+		case 1:
+			mnemonic = "BSR"
+		}
+		if disp := int8(op); disp != 0 {
+			return mnemonic + ".S", s.branch(int32(disp))
+		}
+		return mnemonic, s.branch(int32(int16(s.word())))
+
+	case 0x7:
+		if op&0x0100 != 0 {
+			return "", ""
+		}
+		return "MOVEQ", fmt.Sprintf("#%s,D%d", signedHex(int32(int8(op))), reg)
+
+	case 0x8:
+		switch {
+		case size == 3 && op&0x0100 == 0:
+			return "DIVU.W", s.ea(eaMode, eaReg, 1) + fmt.Sprintf(",D%d", reg)
+		case size == 3:
+			return "DIVS.W", s.ea(eaMode, eaReg, 1) + fmt.Sprintf(",D%d", reg)
+		case op&0x01F0 == 0x0100:
+			return "SBCD", s.extended(op, eaReg, reg)
+		}
+		return s.arithmetic("OR", op, size, eaMode, eaReg, reg)
+
+	case 0x9, 0xD:
+		name := "SUB"
+		if op>>12 == 0xD {
+			name = "ADD"
+		}
+		switch {
+		case size == 3:
+			aSize := 1
+			if op&0x0100 != 0 {
+				aSize = 2
+			}
+			return name + "A" + sizeSuffix[aSize], s.ea(eaMode, eaReg, aSize) + fmt.Sprintf(",A%d", reg)
+		case op&0x0130 == 0x0100:
+			return name + "X" + sizeSuffix[size], s.extended(op, eaReg, reg)
+		}
+		return s.arithmetic(name, op, size, eaMode, eaReg, reg)
+
+	case 0xB:
+		switch {
+		case size == 3:
+			aSize := 1
+			if op&0x0100 != 0 {
+				aSize = 2
+			}
+			return "CMPA" + sizeSuffix[aSize], s.ea(eaMode, eaReg, aSize) + fmt.Sprintf(",A%d", reg)
+		case op&0x0100 == 0:
+			return "CMP" + sizeSuffix[size], s.ea(eaMode, eaReg, size) + fmt.Sprintf(",D%d", reg)
+		case eaMode == 1:
+			return "CMPM" + sizeSuffix[size], fmt.Sprintf("(A%d)+,(A%d)+", eaReg, reg)
+		}
+		return "EOR" + sizeSuffix[size], fmt.Sprintf("D%d,", reg) + s.ea(eaMode, eaReg, size)
+
+	case 0xC:
+		switch {
+		case size == 3 && op&0x0100 == 0:
+			return "MULU.W", s.ea(eaMode, eaReg, 1) + fmt.Sprintf(",D%d", reg)
+		case size == 3:
+			return "MULS.W", s.ea(eaMode, eaReg, 1) + fmt.Sprintf(",D%d", reg)
+		case op&0x01F0 == 0x0100:
+			return "ABCD", s.extended(op, eaReg, reg)
+		case op&0x01F8 == 0x0140:
+			return "EXG", fmt.Sprintf("D%d,D%d", reg, eaReg)
+		case op&0x01F8 == 0x0148:
+			return "EXG", fmt.Sprintf("A%d,A%d", reg, eaReg)
+		case op&0x01F8 == 0x0188:
+			return "EXG", fmt.Sprintf("D%d,A%d", reg, eaReg)
+		}
+		return s.arithmetic("AND", op, size, eaMode, eaReg, reg)
+
+	case 0xE:
+		return s.decodeShift(op, size, eaMode, eaReg, reg)
+	}
+
+	// Line A and line F emulator traps
+	return "", ""
+}
+
+// decodeImmediate decodes line 0: immediate arithmetic, bit operations and
+// MOVEP
+func (s *m68kDecoder) decodeImmediate(op uint16, size, eaMode, eaReg, reg int) (string, string) {
+	bitOps := []string{"BTST", "BCHG", "BCLR", "BSET"}
+
+	if op&0x0100 != 0 {
+		if eaMode == 1 {
+			disp := signedHex(int32(int16(s.word())))
+			opSize := sizeSuffix[1+size&1]
+			if size < 2 {
+				return "MOVEP" + opSize, fmt.Sprintf("(%s,A%d),D%d", disp, eaReg, reg)
+			}
+			return "MOVEP" + opSize, fmt.Sprintf("D%d,(%s,A%d)", reg, disp, eaReg)
+		}
+		return bitOps[size], fmt.Sprintf("D%d,", reg) + s.ea(eaMode, eaReg, 0)
+	}
+
+	if reg == 4 {
+		bit := s.word() & 0xFF
+		return bitOps[size], fmt.Sprintf("#%d,", bit) + s.ea(eaMode, eaReg, 0)
+	}
+
+	names := []string{"ORI", "ANDI", "SUBI", "ADDI", "", "EORI", "CMPI", ""}
+	name := names[reg]
+	if name == "" || size == 3 {
+		return "", ""
+	}
+
+	// ORI, ANDI and EORI to CCR and SR
+	if eaMode == 7 && eaReg == 4 && (reg == 0 || reg == 1 || reg == 5) {
+		switch size {
+		case 0:
+			return name, s.immediate(0) + ",CCR"
+		case 1:
+			return name, s.immediate(1) + ",SR"
+		}
+		return "", ""
+	}
+
+	imm := s.immediate(size)
+	return name + sizeSuffix[size], imm + "," + s.ea(eaMode, eaReg, size)
+}
+
+// decodeMisc decodes line 4: miscellaneous instructions
+func (s *m68kDecoder) decodeMisc(op uint16, size, eaMode, eaReg, reg int) (string, string) {
+	switch op {
+	case 0x4AFC:
+		return "ILLEGAL", ""
+	case 0x4E70:
+		return "RESET", ""
+	case 0x4E71:
+		return "NOP", ""
+	case 0x4E72:
+		return "STOP", s.immediate(1)
+	case 0x4E73:
+		return "RTE", ""
+	case 0x4E75:
+		return "RTS", ""
+	case 0x4E76:
+		return "TRAPV", ""
+	case 0x4E77:
+		return "RTR", ""
+	}
+
+	switch op & 0xFFF8 {
+	case 0x4840:
+		return "SWAP", fmt.Sprintf("D%d", eaReg)
+	case 0x4880:
+		return "EXT.W", fmt.Sprintf("D%d", eaReg)
+	case 0x48C0:
+		return "EXT.L", fmt.Sprintf("D%d", eaReg)
+	case 0x4E50:
+		return "LINK", fmt.Sprintf("A%d,#%s", eaReg, signedHex(int32(int16(s.word()))))
+	case 0x4E58:
+		return "UNLK", fmt.Sprintf("A%d", eaReg)
+	case 0x4E60:
+		return "MOVE", fmt.Sprintf("A%d,USP", eaReg)
+	case 0x4E68:
+		return "MOVE", fmt.Sprintf("USP,A%d", eaReg)
+	}
+
+	if op&0xFFF0 == 0x4E40 {
+		return "TRAP", fmt.Sprintf("#%d", op&0x0F)
+	}
+
+	switch op & 0xFFC0 {
+	case 0x40C0:
+		return "MOVE", "SR," + s.ea(eaMode, eaReg, 1)
+	case 0x44C0:
+		return "MOVE", s.ea(eaMode, eaReg, 1) + ",CCR"
+	case 0x46C0:
+		return "MOVE", s.ea(eaMode, eaReg, 1) + ",SR"
+	case 0x4800:
+		return "NBCD", s.ea(eaMode, eaReg, 0)
+	case 0x4840:
+		return "PEA", s.ea(eaMode, eaReg, 2)
+	case 0x4AC0:
+		return "TAS", s.ea(eaMode, eaReg, 0)
+	case 0x4E80:
+		return "JSR", s.ea(eaMode, eaReg, 2)
+	case 0x4EC0:
+		return "JMP", s.ea(eaMode, eaReg, 2)
+	case 0x4880, 0x48C0, 0x4C80, 0x4CC0:
+		return s.movem(op, eaMode, eaReg)
+	}
+
+	switch op & 0xF1C0 {
+	case 0x41C0:
+		return "LEA", s.ea(eaMode, eaReg, 2) + fmt.Sprintf(",A%d", reg)
+	case 0x4180:
+		return "CHK.W", s.ea(eaMode, eaReg, 1) + fmt.Sprintf(",D%d", reg)
+	}
+
+	if size != 3 {
+		switch op & 0xFF00 {
+		case 0x4000:
+			return "NEGX" + sizeSuffix[size], s.ea(eaMode, eaReg, size)
+		case 0x4200:
+			return "CLR" + sizeSuffix[size], s.ea(eaMode, eaReg, size)
+		case 0x4400:
+			return "NEG" + sizeSuffix[size], s.ea(eaMode, eaReg, size)
+		case 0x4600:
+			return "NOT" + sizeSuffix[size], s.ea(eaMode, eaReg, size)
+		case 0x4A00:
+			return "TST" + sizeSuffix[size], s.ea(eaMode, eaReg, size)
+		}
+	}
+
+	return "", ""
+}
+
+// decodeShift decodes line E: shifts and rotates
+func (s *m68kDecoder) decodeShift(op uint16, size, eaMode, eaReg, reg int) (string, string) {
+	names := []string{"AS", "LS", "ROX", "RO"}
+	dir := "R"
+	if op&0x0100 != 0 {
+		dir = "L"
+	}
+
+	// Memory shifts by one bit
+	if size == 3 {
+		if op&0x0800 != 0 {
+			return "", ""
+		}
+		return names[reg&3] + dir + ".W", s.ea(eaMode, eaReg, 1)
+	}
+
+	name := names[(op>>3)&3] + dir + sizeSuffix[size]
+	if op&0x0020 != 0 {
+		return name, fmt.Sprintf("D%d,D%d", reg, eaReg)
+	}
+	count := reg
+	if count == 0 {
+		count = 8
+	}
+	return name, fmt.Sprintf("#%d,D%d", count, eaReg)
+}
+
+// arithmetic decodes the <ea>,Dn and Dn,<ea> forms of ADD, SUB, AND and OR
+func (s *m68kDecoder) arithmetic(name string, op uint16, size, eaMode, eaReg, reg int) (string, string) {
+	if op&0x0100 == 0 {
+		return name + sizeSuffix[size], s.ea(eaMode, eaReg, size) + fmt.Sprintf(",D%d", reg)
+	}
+	return name + sizeSuffix[size], fmt.Sprintf("D%d,", reg) + s.ea(eaMode, eaReg, size)
+}
+
+// extended formats the operands of ABCD, SBCD, ADDX and SUBX
+func (s *m68kDecoder) extended(op uint16, src, dst int) string {
+	if op&0x0008 != 0 {
+		return fmt.Sprintf("-(A%d),-(A%d)", src, dst)
+	}
+	return fmt.Sprintf("D%d,D%d", src, dst)
+}
+
+// movem decodes MOVEM and its register list
+func (s *m68kDecoder) movem(op uint16, eaMode, eaReg int) (string, string) {
+	size := sizeSuffix[1]
+	if op&0x0040 != 0 {
+		size = sizeSuffix[2]
+	}
+
+	mask := s.word()
+	if eaMode == 4 {
+		// Predecrement lists are stored in reverse order
+		var reversed uint16
+		for i := 0; i < 16; i++ {
+			if mask&(1<<uint(i)) != 0 {
+				reversed |= 1 << uint(15-i)
+			}
+		}
+		mask = reversed
+	}
+
+	regs := registerList(mask)
+	if op&0x0400 != 0 {
+		return "MOVEM" + size, s.ea(eaMode, eaReg, 1) + "," + regs
+	}
+	return "MOVEM" + size, regs + "," + s.ea(eaMode, eaReg, 1)
+}
+
+// registerList formats a MOVEM register mask (bit 0 = D0, bit 15 = A7) as
+// ranges, e.g. D0-D3/A0/A6
+func registerList(mask uint16) string {
+	var parts []string
+	for _, bank := range []struct {
+		prefix string
+		bits   uint16
+	}{{"D", mask & 0xFF}, {"A", mask >> 8}} {
+		for i := 0; i < 8; i++ {
+			if bank.bits&(1<<uint(i)) == 0 {
+				continue
+			}
+			j := i
+			for j < 7 && bank.bits&(1<<uint(j+1)) != 0 {
+				j++
+			}
+			if j > i {
+				parts = append(parts, fmt.Sprintf("%s%d-%s%d", bank.prefix, i, bank.prefix, j))
+			} else {
+				parts = append(parts, fmt.Sprintf("%s%d", bank.prefix, i))
+			}
+			i = j
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// ea formats an effective address, reading any extension words
+func (s *m68kDecoder) ea(mode, reg, size int) string {
+	switch mode {
+	case 0:
+		return fmt.Sprintf("D%d", reg)
+	case 1:
+		return fmt.Sprintf("A%d", reg)
+	case 2:
+		return fmt.Sprintf("(A%d)", reg)
+	case 3:
+		return fmt.Sprintf("(A%d)+", reg)
+	case 4:
+		return fmt.Sprintf("-(A%d)", reg)
+	case 5:
+		return fmt.Sprintf("(%s,A%d)", signedHex(int32(int16(s.word()))), reg)
+	case 6:
+		ext := s.word()
+		return fmt.Sprintf("(%s,A%d,%s)", signedHex(int32(int8(ext))), reg, indexRegister(ext))
+	}
+
+	switch reg {
+	case 0:
+		w := s.word()
+		if label, ok := s.symbols[uint32(int32(int16(w)))]; ok {
+			return label + ".W"
+		}
+		return fmt.Sprintf("$%04X.W", w)
+	case 1:
+		return s.symbols.name(s.long(), 8)
+	case 2:
+		base := s.address + uint32(s.pos)
+		return "(" + s.symbols.name(base+uint32(int32(int16(s.word()))), 6) + ",PC)"
+	case 3:
+		base := s.address + uint32(s.pos)
+		ext := s.word()
+		return fmt.Sprintf("(%s,PC,%s)", s.symbols.name(base+uint32(int32(int8(ext))), 6), indexRegister(ext))
+	case 4:
+		return s.immediate(size)
+	}
+	panic(errNotCode{})
+}
+
+// immediate reads and formats an immediate operand
+func (s *m68kDecoder) immediate(size int) string {
+	switch size {
+	case 0:
+		return fmt.Sprintf("#$%02X", s.word()&0xFF)
+	case 1:
+		return fmt.Sprintf("#$%04X", s.word())
+	}
+	return fmt.Sprintf("#$%08X", s.long())
+}
+
+// branch formats the target of a branch relative to the end of the opcode
+func (s *m68kDecoder) branch(disp int32) string {
+	return s.symbols.name(s.address+2+uint32(disp), 6)
+}
+
+// indexRegister formats the index register of a brief extension word
+func indexRegister(ext uint16) string {
+	kind := "D"
+	if ext&0x8000 != 0 {
+		kind = "A"
+	}
+	size := ".W"
+	if ext&0x0800 != 0 {
+		size = ".L"
+	}
+	return fmt.Sprintf("%s%d%s", kind, (ext>>12)&7, size)
+}
+
+// signedHex formats a displacement as signed hex, e.g. $10 or -$10
+func signedHex(value int32) string {
+	if value < 0 {
+		return fmt.Sprintf("-$%X", -int64(value))
+	}
+	return fmt.Sprintf("$%X", value)
+}
@@ -0,0 +1,215 @@
+// Package foenix is a client API for embedding FoenixMgr in other Go
+// programs, such as IDE plugins and test harnesses, without running the
+// foenixmgr command. It ties together the connection, the debug port
+// protocol and the file loaders:
+//
+//	c := foenix.NewClient(foenix.WithTarget("f256k"))
+//	if err := c.Connect(ctx, "/dev/ttyUSB0"); err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	if _, err := c.Upload(ctx, "game.pgz", ""); err != nil {
+//		return err
+//	}
+//	return c.Run(ctx)
+//
+// Operations stop when their context is done, after the debug port transfer
+// in progress, so the machine can still be taken out of debug mode by Close.
+package foenix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// ErrNotConnected is returned by operations on a client that isn't connected
+var ErrNotConnected = errors.New("not connected")
+
+// ProgressFunc is called as a transfer proceeds with the operation ("upload",
+// "dump", "verify" or "flash") and the bytes done out of total. The total of
+// a file upload isn't known in advance and is 0.
+type ProgressFunc func(operation string, done, total int)
+
+// Client talks to one Foenix machine through its debug port
+type Client struct {
+	cfg      *config.Config
+	target   string
+	progress ProgressFunc
+	verify   bool
+	conn     connection.Connection // Set with WithConnection, otherwise opened by Connect
+
+	session *protocol.Session
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithConfig uses cfg for the connection, CPU and flash settings instead of
+// the defaults, e.g. one read with config.Load
+func WithConfig(cfg *config.Config) Option {
+	return func(c *Client) {
+		c.cfg = cfg
+	}
+}
+
+// WithTarget selects a target machine, which sets its CPU, chunk size and
+// flash layout
+func WithTarget(machine string) Option {
+	return func(c *Client) {
+		c.target = machine
+	}
+}
+
+// WithProgress reports the progress of uploads, dumps and flashing
+func WithProgress(fn ProgressFunc) Option {
+	return func(c *Client) {
+		c.progress = fn
+	}
+}
+
+// WithVerify reads back written memory and flash and compares it
+func WithVerify(verify bool) Option {
+	return func(c *Client) {
+		c.verify = verify
+	}
+}
+
+// WithConnection makes Connect use an already created connection instead of
+// opening the port, e.g. a connection.MockConnection in tests
+func WithConnection(conn connection.Connection) Option {
+	return func(c *Client) {
+		c.conn = conn
+	}
+}
+
+// NewClient creates a client. Without WithConfig the default settings are
+// used.
+func NewClient(opts ...Option) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cfg == nil {
+		c.cfg = config.Default()
+	}
+	return c
+}
+
+// Config returns the settings the client uses
+func (c *Client) Config() *config.Config {
+	return c.cfg
+}
+
+// Connect opens the connection to port (a serial port, a TCP address or
+// "mock:" for a simulated machine) and puts the machine into debug mode
+func (c *Client) Connect(ctx context.Context, port string) error {
+	if c.session != nil {
+		return fmt.Errorf("already connected")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.target != "" {
+		if err := c.cfg.SetTarget(c.target); err != nil {
+			return err
+		}
+	}
+	if port != "" {
+		c.cfg.Port = port
+	}
+
+	conn := c.conn
+	if conn == nil {
+		conn = connection.NewConnection(c.cfg.Port, c.cfg)
+	}
+	if !conn.IsOpen() {
+		if err := connection.OpenContext(ctx, conn, c.cfg.Port); err != nil {
+			return &protocol.Error{Kind: protocol.ErrConnection, Err: fmt.Errorf("failed to open connection: %w", err)}
+		}
+	}
+
+	session := protocol.NewSession(conn, c.cfg)
+	session.DebugPort().SetContext(ctx)
+	if _, ok := conn.(*connection.MockConnection); ok {
+		// A simulated machine flashes at once
+		session.DebugPort().SetInstantFlash(true)
+	}
+	if err := session.EnterDebug(); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enter debug mode: %w", err)
+	}
+	c.session = session
+	return nil
+}
+
+// Close leaves debug mode, which resets the machine, and closes the
+// connection
+func (c *Client) Close() error {
+	if c.session == nil {
+		return nil
+	}
+	// Leave debug mode even after a cancelled operation
+	c.session.DebugPort().SetContext(nil)
+	err := c.session.Close()
+	c.session = nil
+	return err
+}
+
+// DebugPort returns the debug port of a connected client, for operations this
+// package doesn't wrap
+func (c *Client) DebugPort() (*protocol.DebugPort, error) {
+	if c.session == nil {
+		return nil, ErrNotConnected
+	}
+	return c.session.DebugPort(), nil
+}
+
+// Revision returns the debug port revision
+func (c *Client) Revision(ctx context.Context) (byte, error) {
+	dp, err := c.ready(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return dp.GetRevision()
+}
+
+// Run leaves debug mode so the CPU resets and runs from its reset vectors,
+// e.g. into a program uploaded with Upload. The connection stays open and
+// the next operation enters debug mode again.
+func (c *Client) Run(ctx context.Context) error {
+	if _, err := c.ready(ctx); err != nil {
+		return err
+	}
+	if err := c.session.ExitDebug(); err != nil {
+		return fmt.Errorf("failed to exit debug mode: %w", err)
+	}
+	return nil
+}
+
+// ready returns the debug port for an operation, with its transfers
+// cancelled by ctx, entering debug mode again after Run
+func (c *Client) ready(ctx context.Context) (*protocol.DebugPort, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.session == nil {
+		return nil, ErrNotConnected
+	}
+	c.session.DebugPort().SetContext(ctx)
+	if err := c.session.EnterDebug(); err != nil {
+		return nil, fmt.Errorf("failed to enter debug mode: %w", err)
+	}
+	return c.session.DebugPort(), nil
+}
+
+// report calls the progress function, if one was given
+func (c *Client) report(operation string, done, total int) {
+	if c.progress != nil {
+		c.progress(operation, done, total)
+	}
+}
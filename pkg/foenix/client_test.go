@@ -0,0 +1,123 @@
+package foenix
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/loader"
+)
+
+// connectMock returns a client connected to a simulated machine
+func connectMock(t *testing.T, opts ...Option) (*Client, *connection.MockConnection) {
+	t.Helper()
+	c := NewClient(opts...)
+	mock := connection.NewMockConnection(c.Config())
+	c.conn = mock
+	if err := c.Connect(context.Background(), connection.MockPrefix); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, mock
+}
+
+func TestWriteMemoryDump(t *testing.T) {
+	var reports []string
+	c, mock := connectMock(t, WithVerify(true), WithProgress(func(op string, done, total int) {
+		reports = append(reports, op)
+	}))
+	if !mock.InDebug() {
+		t.Error("Connect() did not enter debug mode")
+	}
+
+	data := bytes.Repeat([]byte{1, 2, 3, 4, 5}, 2000)
+	ctx := context.Background()
+	if err := c.WriteMemory(ctx, 0x10000, data); err != nil {
+		t.Fatalf("WriteMemory() error: %v", err)
+	}
+	got, err := c.Dump(ctx, 0x10000, uint32(len(data)))
+	if err != nil {
+		t.Fatalf("Dump() error: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("Dump() doesn't match what was written")
+	}
+	if len(reports) == 0 || reports[0] != "upload" || reports[len(reports)-1] != "dump" {
+		t.Errorf("progress reports = %v", reports)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	if mock.InDebug() {
+		t.Error("Close() did not leave debug mode")
+	}
+	if _, err := c.Dump(ctx, 0, 1); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Dump() after Close() = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	c, mock := connectMock(t, WithVerify(true))
+
+	var hex bytes.Buffer
+	if err := loader.WriteIntelHex(&hex, 0x2000, []byte("HELLO")); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "hello.hex")
+	if err := os.WriteFile(filename, hex.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.Upload(context.Background(), filename, "")
+	if err != nil {
+		t.Fatalf("Upload() error: %v", err)
+	}
+	if result.Bytes != 5 {
+		t.Errorf("Upload() wrote %d bytes, want 5", result.Bytes)
+	}
+	if got := mock.Memory()[0x2000:0x2005]; string(got) != "HELLO" {
+		t.Errorf("memory = %q, want HELLO", got)
+	}
+
+	if _, err := c.Upload(context.Background(), "game.bin", ""); err == nil {
+		t.Error("Upload() of a file with an unknown extension should fail")
+	}
+}
+
+func TestFlash(t *testing.T) {
+	c, mock := connectMock(t, WithTarget("f256k"), WithVerify(true))
+
+	image := bytes.Repeat([]byte{0xA5}, 0x4000)
+	if err := c.Flash(context.Background(), image, 0x10000); err != nil {
+		t.Fatalf("Flash() error: %v", err)
+	}
+	if !bytes.Equal(mock.Flash()[:len(image)], image) {
+		t.Error("flash doesn't hold the image")
+	}
+
+	if err := c.FlashSector(context.Background(), 3, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("FlashSector() error: %v", err)
+	}
+	sector := mock.Flash()[3*FlashSectorSize : 4*FlashSectorSize]
+	if sector[0] != 1 || sector[2] != 3 || sector[3] != 0xFF {
+		t.Errorf("sector 3 starts % X", sector[:4])
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	c, _ := connectMock(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Dump(ctx, 0, 0x100); !errors.Is(err, context.Canceled) {
+		t.Errorf("Dump() with a cancelled context = %v, want context.Canceled", err)
+	}
+	if err := c.WriteMemory(ctx, 0, []byte{1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteMemory() with a cancelled context = %v, want context.Canceled", err)
+	}
+}
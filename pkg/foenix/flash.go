@@ -0,0 +1,94 @@
+package foenix
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+)
+
+// FlashSectorSize is the size of the flash sectors FlashSector programs,
+// staged in the RAM buffer at address 0
+const FlashSectorSize = 8192
+
+// Flash replaces the whole flash with image. The image is staged in RAM at
+// ramAddress, then the flash is erased and programmed from it.
+func (c *Client) Flash(ctx context.Context, image []byte, ramAddress uint32) error {
+	if len(image) > c.cfg.FlashSize {
+		return fmt.Errorf("image of %d bytes is larger than the %d byte flash", len(image), c.cfg.FlashSize)
+	}
+
+	dp, err := c.ready(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.writeMemory(ctx, ramAddress, image); err != nil {
+		return err
+	}
+	c.report("flash", 0, len(image))
+	if err := dp.EraseFlash(); err != nil {
+		return fmt.Errorf("flash erase failed: %w", err)
+	}
+	if err := dp.ProgramFlash(ramAddress); err != nil {
+		return fmt.Errorf("flash programming failed: %w", err)
+	}
+	c.report("flash", len(image), len(image))
+
+	if c.verify {
+		return c.verifyFlash(ctx, 0, image)
+	}
+	return nil
+}
+
+// FlashSector erases and programs one 8KB sector of flash, on machines that
+// support sector programming. Data shorter than a sector is padded with $FF.
+func (c *Client) FlashSector(ctx context.Context, sector uint8, data []byte) error {
+	if err := protocol.MachineCapabilities(c.cfg).Check(protocol.CapSectorProgramming); err != nil {
+		if c.cfg.Machine() == nil {
+			return fmt.Errorf("%w (use WithTarget)", err)
+		}
+		return err
+	}
+	if len(data) > FlashSectorSize {
+		return fmt.Errorf("sector data of %d bytes is larger than a %d byte sector", len(data), FlashSectorSize)
+	}
+	padded := make([]byte, FlashSectorSize)
+	for i := range padded {
+		padded[i] = 0xFF
+	}
+	copy(padded, data)
+
+	dp, err := c.ready(ctx)
+	if err != nil {
+		return err
+	}
+	if err := dp.EraseSector(sector); err != nil {
+		return fmt.Errorf("failed to erase sector 0x%02X: %w", sector, err)
+	}
+
+	if err := c.writeMemory(ctx, 0, padded); err != nil {
+		return err
+	}
+
+	if err := dp.ProgramSector(sector); err != nil {
+		return fmt.Errorf("failed to program sector 0x%02X: %w", sector, err)
+	}
+	if err := dp.WaitReady(); err != nil {
+		return fmt.Errorf("failed to program sector 0x%02X: %w", sector, err)
+	}
+
+	if c.verify {
+		return c.verifyFlash(ctx, uint32(sector)*FlashSectorSize, padded)
+	}
+	return nil
+}
+
+// verifyFlash compares flash at an offset into flash with data
+func (c *Client) verifyFlash(ctx context.Context, offset uint32, data []byte) error {
+	base, err := util.ParseHexAddress(c.cfg.FlashAddress)
+	if err != nil {
+		return fmt.Errorf("invalid flash_address: %w", err)
+	}
+	return c.verifyMemory(ctx, base+offset, data)
+}
@@ -0,0 +1,87 @@
+package foenix
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// Dump reads length bytes of memory at address
+func (c *Client) Dump(ctx context.Context, address, length uint32) ([]byte, error) {
+	if _, err := c.ready(ctx); err != nil {
+		return nil, err
+	}
+	return c.readMemory(ctx, address, length, "dump")
+}
+
+// readMemory reads memory a chunk at a time, reporting progress as operation
+func (c *Client) readMemory(ctx context.Context, address, length uint32, operation string) ([]byte, error) {
+	dp := c.session.DebugPort()
+	data := make([]byte, 0, length)
+	chunkSize := uint32(dp.ChunkSize())
+	for offset := uint32(0); offset < length; offset += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		chunk, err := dp.ReadRange(address+offset, min(chunkSize, length-offset))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read memory: %w", err)
+		}
+		data = append(data, chunk...)
+		c.report(operation, len(data), int(length))
+	}
+	return data, nil
+}
+
+// WriteMemory writes data to memory at address, reading it back to compare
+// when the client verifies writes
+func (c *Client) WriteMemory(ctx context.Context, address uint32, data []byte) error {
+	if _, err := c.ready(ctx); err != nil {
+		return err
+	}
+	if err := c.writeMemory(ctx, address, data); err != nil {
+		return err
+	}
+	if c.verify {
+		return c.verifyMemory(ctx, address, data)
+	}
+	return nil
+}
+
+// writeMemory writes memory a chunk at a time, reporting progress
+func (c *Client) writeMemory(ctx context.Context, address uint32, data []byte) error {
+	dp := c.session.DebugPort()
+	chunkSize := dp.ChunkSize()
+	for offset := 0; offset < len(data); offset += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(offset+chunkSize, len(data))
+		if err := dp.WriteRange(address+uint32(offset), data[offset:end]); err != nil {
+			return fmt.Errorf("failed to write memory: %w", err)
+		}
+		c.report("upload", end, len(data))
+	}
+	return nil
+}
+
+// verifyMemory reads memory back and compares it with expected, naming the
+// first address that differs
+func (c *Client) verifyMemory(ctx context.Context, address uint32, expected []byte) error {
+	actual, err := c.readMemory(ctx, address, uint32(len(expected)), "verify")
+	if err != nil {
+		return fmt.Errorf("verification read failed: %w", err)
+	}
+	if bytes.Equal(actual, expected) {
+		return nil
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			return fmt.Errorf("%w at 0x%06X: expected %02X, read %02X",
+				protocol.ErrVerify, address+uint32(i), expected[i], actual[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package foenix
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/loader"
+)
+
+// UploadResult describes an uploaded file
+type UploadResult struct {
+	Bytes int // Bytes written to memory
+
+	// Start address recorded in the file, if it had one
+	Start    uint32
+	HasStart bool
+}
+
+// Upload writes a program file to memory. The format is one of the loader
+// formats (loader.FormatIntelHex, loader.FormatPGZ, ...), or "" to tell it
+// from the file's extension. PGX, PGZ and ELF files set up the reset vectors
+// themselves; for other formats use SetResetVectors with the result's start
+// address.
+func (c *Client) Upload(ctx context.Context, filename string, format string) (*UploadResult, error) {
+	dp, err := c.ready(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		if format, err = loader.FormatForFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	ldr, err := loader.New(format, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := ldr.Open(filename); err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer ldr.Close()
+
+	result := &UploadResult{}
+	type block struct {
+		address uint32
+		data    []byte
+	}
+	var written []block
+	batch := dp.NewWriteBatch()
+	ldr.SetHandler(loader.ContextHandler(ctx, func(address uint32, data []byte) error {
+		if err := batch.Write(address, data); err != nil {
+			return err
+		}
+		result.Bytes += len(data)
+		c.report("upload", result.Bytes, 0)
+		if c.verify {
+			written = append(written, block{address, append([]byte(nil), data...)})
+		}
+		return nil
+	}))
+	if err := ldr.Process(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	if err := batch.Flush(); err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+
+	if sa, ok := ldr.(loader.StartAddresser); ok {
+		result.Start, result.HasStart = sa.StartAddress()
+	}
+
+	for _, b := range written {
+		if err := c.verifyMemory(ctx, b.address, b.data); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// SetResetVectors points the CPU's reset vectors at start, so the program
+// there runs when the CPU is reset, e.g. by Run
+func (c *Client) SetResetVectors(ctx context.Context, start uint32) error {
+	dp, err := c.ready(ctx)
+	if err != nil {
+		return err
+	}
+	if err := loader.SetupResetVectors(c.cfg.CPU, start, dp.WriteBlock); err != nil {
+		return fmt.Errorf("failed to set up reset vectors: %w", err)
+	}
+	return nil
+}
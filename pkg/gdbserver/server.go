@@ -0,0 +1,416 @@
+// Package gdbserver implements a GDB remote serial protocol server, so GDB can
+// debug programs on Foenix hardware through the debug port
+package gdbserver
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Target is the machine being debugged
+type Target interface {
+	// ReadMemory reads length bytes from address
+	ReadMemory(address uint32, length int) ([]byte, error)
+
+	// WriteMemory writes data to address
+	WriteMemory(address uint32, data []byte) error
+
+	// Registers returns the registers in GDB's 'g' packet layout for the CPU.
+	// A nil result means the registers can't be read.
+	Registers() ([]byte, error)
+
+	// Halt stops the CPU
+	Halt() error
+
+	// Continue lets the CPU run
+	Continue() error
+
+	// Step lets the CPU run briefly and stops it again
+	Step() error
+}
+
+// Signal numbers reported in stop replies
+const (
+	sigInt  = 2
+	sigTrap = 5
+)
+
+// maxPacketSize is the largest packet GDB may send, advertised in qSupported
+const maxPacketSize = 0x4000
+
+// Server serves GDB remote protocol connections for a target
+type Server struct {
+	target Target
+
+	// Logf, if set, receives a line for each connection and failed command
+	Logf func(format string, args ...interface{})
+
+	mu       sync.Mutex
+	listener net.Listener
+	conn     net.Conn
+	closed   bool
+}
+
+// NewServer returns a server for a target
+func NewServer(target Target) *Server {
+	return &Server{target: target}
+}
+
+// Serve accepts GDB connections one at a time until the listener is closed
+// or Close is called
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conn = conn
+		s.mu.Unlock()
+
+		s.logf("GDB connected from %s", conn.RemoteAddr())
+		err = s.ServeConn(conn)
+		conn.Close()
+
+		s.mu.Lock()
+		s.conn = nil
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return nil
+		}
+
+		if err != nil {
+			s.logf("GDB connection ended: %v", err)
+		} else {
+			s.logf("GDB disconnected")
+		}
+	}
+}
+
+// Close stops Serve, closing the listener and any connected GDB
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// ServeConn handles a single GDB connection until it is closed or GDB
+// detaches. The target is halted when GDB connects.
+func (s *Server) ServeConn(conn io.ReadWriter) error {
+	c := &session{
+		server: s,
+		r:      bufio.NewReader(conn),
+		w:      conn,
+		ack:    true,
+	}
+
+	if err := s.target.Halt(); err != nil {
+		return fmt.Errorf("failed to halt target: %w", err)
+	}
+
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		reply, done, err := c.handle(packet)
+		if err != nil {
+			return err
+		}
+		if err := c.writePacket(reply); err != nil {
+			return err
+		}
+		if c.noAckPending {
+			c.ack = false
+			c.noAckPending = false
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// session is the state of one GDB connection
+type session struct {
+	server *Server
+	r      *bufio.Reader
+	w      io.Writer
+	ack    bool // Acknowledge packets ('+'); off after QStartNoAckMode
+
+	noAckPending bool // QStartNoAckMode received, its reply not yet sent
+}
+
+// readPacket reads the next $packet#checksum, acknowledging it. Interrupt
+// bytes received while the target is already halted are ignored.
+func (c *session) readPacket() (string, error) {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b != '$' {
+			continue // Acks and stray interrupts
+		}
+
+		data, err := c.r.ReadString('#')
+		if err != nil {
+			return "", err
+		}
+		data = data[:len(data)-1]
+
+		sum := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, sum); err != nil {
+			return "", err
+		}
+
+		if want, err := strconv.ParseUint(string(sum), 16, 8); err != nil || byte(want) != checksum(data) {
+			if c.ack {
+				if _, err := c.w.Write([]byte{'-'}); err != nil {
+					return "", err
+				}
+			}
+			continue
+		}
+
+		if c.ack {
+			if _, err := c.w.Write([]byte{'+'}); err != nil {
+				return "", err
+			}
+		}
+		if data == "QStartNoAckMode" {
+			// Acknowledgements stop after the reply to this packet
+			c.noAckPending = true
+		}
+		return unescape(data), nil
+	}
+}
+
+// writePacket sends a reply packet
+func (c *session) writePacket(data string) error {
+	_, err := fmt.Fprintf(c.w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+// handle processes one packet and returns the reply. done is true when the
+// connection should be closed after the reply.
+func (c *session) handle(packet string) (reply string, done bool, err error) {
+	target := c.server.target
+	if packet == "" {
+		return "", false, nil
+	}
+
+	switch packet[0] {
+	case '?':
+		return stopReply(sigTrap), false, nil
+
+	case 'g':
+		regs, err := target.Registers()
+		if err != nil {
+			c.server.logf("read registers: %v", err)
+			return "E01", false, nil
+		}
+		return hex.EncodeToString(regs), false, nil
+
+	case 'm':
+		address, length, err := parseAddressLength(packet[1:])
+		if err != nil {
+			return "E01", false, nil
+		}
+		data, err := target.ReadMemory(address, length)
+		if err != nil {
+			c.server.logf("read memory at 0x%X: %v", address, err)
+			return "E03", false, nil
+		}
+		return hex.EncodeToString(data), false, nil
+
+	case 'M':
+		head, body, found := strings.Cut(packet[1:], ":")
+		if !found {
+			return "E01", false, nil
+		}
+		address, length, err := parseAddressLength(head)
+		if err != nil {
+			return "E01", false, nil
+		}
+		data, err := hex.DecodeString(body)
+		if err != nil || len(data) != length {
+			return "E01", false, nil
+		}
+		if err := target.WriteMemory(address, data); err != nil {
+			c.server.logf("write memory at 0x%X: %v", address, err)
+			return "E03", false, nil
+		}
+		return "OK", false, nil
+
+	case 'c':
+		if len(packet) > 1 {
+			return "E01", false, nil // Resuming at another address isn't supported
+		}
+		reply, err := c.run()
+		return reply, false, err
+
+	case 's':
+		if len(packet) > 1 {
+			return "E01", false, nil
+		}
+		if err := target.Step(); err != nil {
+			c.server.logf("step: %v", err)
+			return "E03", false, nil
+		}
+		return stopReply(sigTrap), false, nil
+
+	case 'H', 'T':
+		return "OK", false, nil // There is only one thread
+
+	case 'D':
+		if err := target.Continue(); err != nil {
+			c.server.logf("continue: %v", err)
+		}
+		return "OK", true, nil
+
+	case 'k':
+		return "", true, nil
+
+	case 'q':
+		return c.query(packet), false, nil
+
+	case 'Q':
+		if packet == "QStartNoAckMode" {
+			return "OK", false, nil
+		}
+	}
+
+	// Empty reply: not supported, including G/P register writes, X binary
+	// writes and Z breakpoints (GDB falls back to M and memory breakpoints)
+	return "", false, nil
+}
+
+// query answers q packets
+func (c *session) query(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;QStartNoAckMode+", maxPacketSize)
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// run continues the target until GDB sends an interrupt (Ctrl+C), then halts
+// it. The debug port can't report breakpoint hits, so the target only stops
+// when interrupted.
+func (c *session) run() (string, error) {
+	target := c.server.target
+	if err := target.Continue(); err != nil {
+		c.server.logf("continue: %v", err)
+		return "E03", nil
+	}
+
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == 0x03 {
+			break
+		}
+	}
+
+	if err := target.Halt(); err != nil {
+		c.server.logf("halt: %v", err)
+		return "E03", nil
+	}
+	return stopReply(sigInt), nil
+}
+
+// stopReply formats a stop reply for a signal
+func stopReply(signal int) string {
+	return fmt.Sprintf("S%02x", signal)
+}
+
+// parseAddressLength parses "ADDR,LENGTH" (both hex)
+func parseAddressLength(s string) (uint32, int, error) {
+	a, l, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, fmt.Errorf("missing length")
+	}
+	address, err := strconv.ParseUint(a, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(l, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(address), int(length), nil
+}
+
+// checksum returns the modulo 256 sum of a packet's data
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// unescape removes the '}' escapes GDB applies to '#', '$', '}' and '*'
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			sb.WriteByte(data[i] ^ 0x20)
+			continue
+		}
+		sb.WriteByte(data[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,203 @@
+package gdbserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeTarget is a target with 64K of memory
+type fakeTarget struct {
+	memory  [0x10000]byte
+	running bool
+	halts   int
+	steps   int
+}
+
+func (t *fakeTarget) ReadMemory(address uint32, length int) ([]byte, error) {
+	if int(address)+length > len(t.memory) {
+		return nil, fmt.Errorf("out of range")
+	}
+	return append([]byte(nil), t.memory[address:int(address)+length]...), nil
+}
+
+func (t *fakeTarget) WriteMemory(address uint32, data []byte) error {
+	copy(t.memory[address:], data)
+	return nil
+}
+
+func (t *fakeTarget) Registers() ([]byte, error) {
+	return []byte{0x00, 0xE0, 0x01, 0x02, 0x03, 0xFF, 0x30}, nil
+}
+
+func (t *fakeTarget) Halt() error {
+	t.running = false
+	t.halts++
+	return nil
+}
+
+func (t *fakeTarget) Continue() error {
+	t.running = true
+	return nil
+}
+
+func (t *fakeTarget) Step() error {
+	t.steps++
+	return nil
+}
+
+// client is the GDB side of a test connection
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	ack  bool
+}
+
+// startServer serves a fake target over an in-memory connection
+func startServer(t *testing.T) (*client, *fakeTarget, chan error) {
+	target := &fakeTarget{}
+	serverConn, clientConn := net.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(target).ServeConn(serverConn)
+		serverConn.Close()
+	}()
+
+	t.Cleanup(func() { clientConn.Close() })
+	return &client{t: t, conn: clientConn, r: bufio.NewReader(clientConn), ack: true}, target, done
+}
+
+// send sends a packet and returns the reply
+func (c *client) send(data string) string {
+	c.t.Helper()
+
+	if _, err := fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data)); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+	if c.ack {
+		if b, err := c.r.ReadByte(); err != nil || b != '+' {
+			c.t.Fatalf("expected ack, got %q (%v)", b, err)
+		}
+	}
+	return c.reply()
+}
+
+// reply reads a reply packet
+func (c *client) reply() string {
+	c.t.Helper()
+
+	if b, err := c.r.ReadByte(); err != nil || b != '$' {
+		c.t.Fatalf("expected packet start, got %q (%v)", b, err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	data = data[:len(data)-1]
+
+	sum := make([]byte, 2)
+	if _, err := c.r.Read(sum); err != nil {
+		c.t.Fatalf("read checksum: %v", err)
+	}
+	if want := fmt.Sprintf("%02x", checksum(data)); string(sum) != want {
+		c.t.Fatalf("checksum = %s, want %s", sum, want)
+	}
+	return data
+}
+
+func TestMemoryAndRegisters(t *testing.T) {
+	c, target, _ := startServer(t)
+
+	if got := c.send("qSupported:multiprocess+"); !strings.HasPrefix(got, "PacketSize=") {
+		t.Errorf("qSupported = %q", got)
+	}
+	if got := c.send("?"); got != "S05" {
+		t.Errorf("? = %q, want S05", got)
+	}
+	if got := c.send("M2000,3:a90060"); got != "OK" {
+		t.Errorf("M = %q, want OK", got)
+	}
+	if target.memory[0x2001] != 0x00 || target.memory[0x2002] != 0x60 {
+		t.Errorf("memory not written: % X", target.memory[0x2000:0x2003])
+	}
+	if got := c.send("m2000,3"); got != "a90060" {
+		t.Errorf("m = %q, want a90060", got)
+	}
+	if got := c.send("mFFFF,2"); got != "E03" {
+		t.Errorf("m out of range = %q, want E03", got)
+	}
+	if got := c.send("g"); got != "00e0010203ff30" {
+		t.Errorf("g = %q", got)
+	}
+	if got := c.send("Z0,2000,1"); got != "" {
+		t.Errorf("Z0 = %q, want unsupported", got)
+	}
+	if got := c.send("s"); got != "S05" || target.steps != 1 {
+		t.Errorf("s = %q, steps = %d", got, target.steps)
+	}
+}
+
+func TestContinueAndInterrupt(t *testing.T) {
+	c, target, _ := startServer(t)
+
+	if _, err := fmt.Fprintf(c.conn, "$c#%02x", checksum("c")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if b, _ := c.r.ReadByte(); b != '+' {
+		t.Fatalf("expected ack, got %q", b)
+	}
+
+	// The reply only comes after the interrupt
+	if _, err := c.conn.Write([]byte{0x03}); err != nil {
+		t.Fatalf("write interrupt: %v", err)
+	}
+	if got := c.reply(); got != "S02" {
+		t.Errorf("stop reply = %q, want S02", got)
+	}
+	if target.running || target.halts != 2 {
+		t.Errorf("running = %v, halts = %d; want halted twice (connect and interrupt)", target.running, target.halts)
+	}
+}
+
+func TestNoAckModeAndDetach(t *testing.T) {
+	c, target, done := startServer(t)
+
+	if got := c.send("QStartNoAckMode"); got != "OK" {
+		t.Fatalf("QStartNoAckMode = %q", got)
+	}
+	c.ack = false
+
+	if got := c.send("m0,1"); got != "00" {
+		t.Errorf("m = %q", got)
+	}
+	if got := c.send("D"); got != "OK" {
+		t.Errorf("D = %q", got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeConn() error: %v", err)
+	}
+	if !target.running {
+		t.Error("target should be running after detach")
+	}
+}
+
+func TestBadChecksumIsNacked(t *testing.T) {
+	c, _, _ := startServer(t)
+
+	if _, err := c.conn.Write([]byte("$m0,1#00")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if b, _ := c.r.ReadByte(); b != '-' {
+		t.Errorf("expected nack, got %q", b)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	if got := unescape("a}\x03b"); got != "a#b" {
+		t.Errorf("unescape() = %q, want a#b", got)
+	}
+}
@@ -0,0 +1,192 @@
+package inspect
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ReadFunc reads length bytes of target memory at address
+type ReadFunc func(address uint32, length uint32) ([]byte, error)
+
+// Value is a value read from memory
+type Value struct {
+	Name    string      `json:"name,omitempty"`
+	Type    string      `json:"type"`
+	Address uint32      `json:"address"`
+	Value   interface{} `json:"value,omitempty"`  // Integer, pointer address or string
+	Target  *Value      `json:"target,omitempty"` // What a pointer points to
+	Fields  []*Value    `json:"fields,omitempty"` // Struct fields or array elements
+	Error   string      `json:"error,omitempty"`  // Why a pointer target couldn't be read
+}
+
+// Inspector reads typed values
+type Inspector struct {
+	Read ReadFunc
+
+	// MaxDepth limits how many pointers are followed in a chain, so cyclic
+	// structures such as linked lists end
+	MaxDepth int
+}
+
+// Inspect reads a value of type t at address
+func (in *Inspector) Inspect(t *Type, address uint32) (*Value, error) {
+	if t.Kind == CString {
+		return in.readCString(t, address)
+	}
+
+	data, err := in.Read(address, uint32(t.ByteSize()))
+	if err != nil {
+		return nil, err
+	}
+	return in.decode(t, address, data, 0), nil
+}
+
+// decode builds the value of type t from its bytes, following pointers up to
+// MaxDepth
+func (in *Inspector) decode(t *Type, address uint32, data []byte, depth int) *Value {
+	v := &Value{Type: t.Name, Address: address}
+	switch t.Kind {
+	case Int:
+		v.Value = decodeInt(t, data)
+	case Pointer:
+		target := uint32(decodeInt(t, data))
+		v.Value = target
+		if t.Elem == nil || depth >= in.MaxDepth {
+			break
+		}
+		if target == 0 {
+			v.Error = "null pointer"
+			break
+		}
+		if t.Elem.Kind == CString {
+			s, err := in.readCString(t.Elem, target)
+			if err != nil {
+				v.Error = err.Error()
+				break
+			}
+			v.Target = s
+			break
+		}
+		targetData, err := in.Read(target, uint32(t.Elem.ByteSize()))
+		if err != nil {
+			v.Error = err.Error()
+			break
+		}
+		v.Target = in.decode(t.Elem, target, targetData, depth+1)
+	case Array:
+		size := t.Elem.ByteSize()
+		for i := 0; i < t.Count; i++ {
+			elem := in.decode(t.Elem, address+uint32(i*size), data[i*size:(i+1)*size], depth)
+			elem.Name = fmt.Sprintf("[%d]", i)
+			v.Fields = append(v.Fields, elem)
+		}
+		// Byte arrays are usually text, so show them as a string too
+		if t.Elem.Kind == Int && t.Elem.Size == 1 && !t.Elem.Signed {
+			if end := bytes.IndexByte(data, 0); end >= 0 {
+				v.Value = string(data[:end])
+			} else {
+				v.Value = string(data)
+			}
+		}
+	case Struct:
+		for _, f := range t.Fields {
+			size := f.Type.ByteSize()
+			field := in.decode(f.Type, address+uint32(f.Offset), data[f.Offset:f.Offset+size], depth)
+			field.Name = f.Name
+			v.Fields = append(v.Fields, field)
+		}
+	}
+	return v
+}
+
+// readCString reads a NUL terminated string of up to MaxCStringLength bytes
+func (in *Inspector) readCString(t *Type, address uint32) (*Value, error) {
+	data, err := in.Read(address, MaxCStringLength)
+	if err != nil {
+		return nil, err
+	}
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+	return &Value{Type: t.Name, Address: address, Value: string(data)}, nil
+}
+
+// decodeInt decodes an integer type, sign extending signed types
+func decodeInt(t *Type, data []byte) int64 {
+	var value uint64
+	for i := range data[:t.Size] {
+		b := data[i]
+		if !t.BigEndian {
+			b = data[t.Size-1-i]
+		}
+		value = value<<8 | uint64(b)
+	}
+	if t.Signed {
+		shift := 64 - 8*t.Size
+		return int64(value<<shift) >> shift
+	}
+	return int64(value)
+}
+
+// String formats the value as indented lines, e.g.
+//
+//	player @ 002000 struct:player
+//	  x     @ 002000 u16le = 0x0010 (16)
+//	  name  @ 002002 ptr24:cstring = 0x003000 -> "Bob"
+func (v *Value) String() string {
+	var sb strings.Builder
+	v.format(&sb, "")
+	return sb.String()
+}
+
+// format writes the value and its fields with an indent. Pointer chains to
+// scalars are shown on one line.
+func (v *Value) format(sb *strings.Builder, indent string) {
+	name := v.Name
+	if name == "" {
+		name = v.Type
+	}
+	fmt.Fprintf(sb, "%s%s @ %06X %s", indent, name, v.Address, v.Type)
+	if v.Value != nil {
+		sb.WriteString(" = " + formatScalar(v))
+	}
+	last := v
+	for last.Target != nil && last.Target.Value != nil {
+		last = last.Target
+		sb.WriteString(" -> " + formatScalar(last))
+	}
+	if last.Error != "" {
+		sb.WriteString(" (" + last.Error + ")")
+	}
+	sb.WriteString("\n")
+
+	// The fields of a struct a pointer points to are shown under the
+	// pointer. Byte arrays are shown as their text only.
+	fields := last.Fields
+	if last.Target != nil {
+		fields = last.Target.Fields
+	} else if _, ok := last.Value.(string); ok {
+		fields = nil
+	}
+	for _, f := range fields {
+		f.format(sb, indent+"  ")
+	}
+}
+
+// formatScalar formats an integer as hex and decimal, a pointer as an
+// address and a string quoted
+func formatScalar(v *Value) string {
+	switch value := v.Value.(type) {
+	case string:
+		return fmt.Sprintf("%q", value)
+	case uint32:
+		return fmt.Sprintf("0x%06X", value)
+	case int64:
+		if value < 0 {
+			return fmt.Sprintf("%d", value)
+		}
+		return fmt.Sprintf("0x%X (%d)", value, value)
+	}
+	return fmt.Sprint(v.Value)
+}
@@ -0,0 +1,203 @@
+package inspect
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// memory is a small address space for tests
+type memory []byte
+
+func (m memory) read(address uint32, length uint32) ([]byte, error) {
+	if int(address)+int(length) > len(m) {
+		if int(address) >= len(m) {
+			return nil, fmt.Errorf("address %X out of range", address)
+		}
+		// Like the hardware, reads past the end return zeros
+		data := make([]byte, length)
+		copy(data, m[address:])
+		return data, nil
+	}
+	return m[address : address+length], nil
+}
+
+const testStructs = `
+# Test structs
+struct point {
+    x  i16le
+    y  i16le
+}
+
+struct player {
+    pos   point            ; nested by value
+    name  ptr24:cstring
+    tag   u8[4]
+    next  ptr24:struct:player
+}
+`
+
+func TestParseType(t *testing.T) {
+	structs, err := ParseStructs(strings.NewReader(testStructs))
+	if err != nil {
+		t.Fatalf("ParseStructs() error: %v", err)
+	}
+
+	tests := []struct {
+		spec    string
+		kind    Kind
+		size    int
+		wantErr bool
+	}{
+		{"u8", Int, 1, false},
+		{"u32be", Int, 4, false},
+		{"ptr24", Pointer, 3, false},
+		{"ptr24:u16le", Pointer, 3, false},
+		{"ptr16:ptr24:cstring", Pointer, 2, false},
+		{"u16le[8]", Array, 16, false},
+		{"struct:point", Struct, 4, false},
+		{"struct:player", Struct, 14, false},
+		{"struct:player[2]", Array, 28, false},
+		{"cstring", CString, 0, false},
+		{"u12", 0, 0, true},
+		{"struct:missing", 0, 0, true},
+		{"u8[0]", 0, 0, true},
+		{"u8:u16le", 0, 0, true},
+		{"cstring[2]", 0, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseType(tt.spec, structs)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseType(%q) should fail", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseType(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got.Kind != tt.kind || got.ByteSize() != tt.size {
+			t.Errorf("ParseType(%q) = kind %d size %d, want kind %d size %d", tt.spec, got.Kind, got.ByteSize(), tt.kind, tt.size)
+		}
+	}
+
+	player := structs["player"]
+	if off := player.Fields[3].Offset; off != 11 {
+		t.Errorf("player.next offset = %d, want 11", off)
+	}
+}
+
+func TestParseStructsErrors(t *testing.T) {
+	tests := []string{
+		"struct a {\n x u8\n",                   // Not closed
+		"struct a {\n x cstring\n}\n",           // No fixed size
+		"struct a {\n x a\n}\n",                 // Contains itself
+		"struct a {\n x u8\n}\nstruct a {\n}\n", // Defined twice
+		"x u8\n",                                // Field outside struct
+	}
+	for _, def := range tests {
+		if _, err := ParseStructs(strings.NewReader(def)); err == nil {
+			t.Errorf("ParseStructs(%q) should fail", def)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	structs, err := ParseStructs(strings.NewReader(testStructs))
+	if err != nil {
+		t.Fatalf("ParseStructs() error: %v", err)
+	}
+
+	mem := make(memory, 0x100)
+	// player at 0x10: pos (-2, 300), name at 0x40, tag "AB", next at 0x20
+	copy(mem[0x10:], []byte{0xFE, 0xFF, 0x2C, 0x01, 0x40, 0x00, 0x00, 'A', 'B', 0, 0, 0x20, 0x00, 0x00})
+	// player at 0x20 with a null next pointer
+	copy(mem[0x20:], []byte{0x01, 0x00, 0x02, 0x00, 0x48, 0x00, 0x00, 'C', 'D', 'E', 'F', 0, 0, 0})
+	copy(mem[0x40:], "Bob\x00")
+	copy(mem[0x48:], "Eve\x00")
+
+	in := &Inspector{Read: mem.read, MaxDepth: 4}
+	typ, _ := ParseType("struct:player", structs)
+	v, err := in.Inspect(typ, 0x10)
+	if err != nil {
+		t.Fatalf("Inspect() error: %v", err)
+	}
+
+	pos := v.Fields[0]
+	if pos.Fields[0].Value != int64(-2) || pos.Fields[1].Value != int64(300) {
+		t.Errorf("pos = %v, %v, want -2, 300", pos.Fields[0].Value, pos.Fields[1].Value)
+	}
+	if name := v.Fields[1]; name.Value != uint32(0x40) || name.Target == nil || name.Target.Value != "Bob" {
+		t.Errorf("name = %+v", name)
+	}
+	if tag := v.Fields[2]; tag.Value != "AB" {
+		t.Errorf("tag = %v, want AB", tag.Value)
+	}
+	next := v.Fields[3]
+	if next.Target == nil || next.Target.Fields[1].Target.Value != "Eve" {
+		t.Fatalf("next not followed: %+v", next)
+	}
+	if last := next.Target.Fields[3]; last.Error != "null pointer" {
+		t.Errorf("last next = %+v, want null pointer", last)
+	}
+
+	text := v.String()
+	for _, want := range []string{
+		"struct:player @ 000010 struct:player\n",
+		"    x @ 000010 i16le = -2\n",
+		`name @ 000014 ptr24:cstring = 0x000040 -> "Bob"`,
+		`tag @ 000017 u8[4] = "AB"`,
+		"next @ 00001B ptr24:struct:player = 0x000020\n",
+		"    tag @ 000027 u8[4] = \"CDEF\"\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("String() missing %q in:\n%s", want, text)
+		}
+	}
+}
+
+func TestInspectDepth(t *testing.T) {
+	structs, err := ParseStructs(strings.NewReader("struct node {\n next ptr24:struct:node\n}\n"))
+	if err != nil {
+		t.Fatalf("ParseStructs() error: %v", err)
+	}
+
+	// A node at 0x10 that points to itself
+	mem := make(memory, 0x20)
+	mem[0x10] = 0x10
+	in := &Inspector{Read: mem.read, MaxDepth: 3}
+	v, err := in.Inspect(structs["node"], 0x10)
+	if err != nil {
+		t.Fatalf("Inspect() error: %v", err)
+	}
+
+	depth := 0
+	for p := v.Fields[0]; p.Target != nil; p = p.Target.Fields[0] {
+		depth++
+	}
+	if depth != 3 {
+		t.Errorf("followed %d pointers, want 3", depth)
+	}
+}
+
+func TestDecodeInt(t *testing.T) {
+	tests := []struct {
+		spec string
+		data []byte
+		want int64
+	}{
+		{"u16le", []byte{0x34, 0x12}, 0x1234},
+		{"u16be", []byte{0x12, 0x34}, 0x1234},
+		{"i8", []byte{0x80}, -128},
+		{"u24le", []byte{0x56, 0x34, 0x12}, 0x123456},
+		{"i32be", []byte{0xFF, 0xFF, 0xFF, 0xFE}, -2},
+		{"u32le", []byte{0xFF, 0xFF, 0xFF, 0xFF}, 0xFFFFFFFF},
+	}
+	for _, tt := range tests {
+		typ, _ := ParseType(tt.spec, nil)
+		if got := decodeInt(typ, tt.data); got != tt.want {
+			t.Errorf("decodeInt(%s, % X) = %d, want %d", tt.spec, tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Package inspect reads typed values from target memory: integers, pointers
+// (followed to their targets), strings, arrays and structs declared in a
+// definition file
+package inspect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of a type
+type Kind int
+
+// Kinds of types
+const (
+	Int     Kind = iota // Integer of 1 to 4 bytes
+	Pointer             // Address of 2, 3 or 4 bytes, optionally with a target type
+	CString             // NUL terminated string, read where it is; has no fixed size
+	Array               // Count elements of Elem
+	Struct              // Named fields at offsets
+)
+
+// Type describes how a value is laid out in memory
+type Type struct {
+	Name      string // As written, e.g. "u16le" or "struct:player"
+	Kind      Kind
+	Size      int // Bytes in memory of ints, pointers and structs
+	Signed    bool
+	BigEndian bool
+	Elem      *Type // Pointer target (nil if not followed) or array element
+	Count     int   // Array length
+	Fields    []Field
+}
+
+// ByteSize returns the number of bytes a value of the type occupies; 0 for
+// a cstring, whose length depends on its content
+func (t *Type) ByteSize() int {
+	if t.Kind == Array {
+		return t.Elem.ByteSize() * t.Count
+	}
+	return t.Size
+}
+
+// Field is a member of a struct
+type Field struct {
+	Name   string
+	Offset int
+	Type   *Type
+}
+
+// Structs holds struct types by name
+type Structs map[string]*Type
+
+// MaxCStringLength is the longest string read for a cstring
+const MaxCStringLength = 256
+
+// intTypes are the integer type names with their size, sign and byte order
+var intTypes = map[string]Type{
+	"u8":      {Kind: Int, Size: 1},
+	"i8":      {Kind: Int, Size: 1, Signed: true},
+	"u16le":   {Kind: Int, Size: 2},
+	"u16be":   {Kind: Int, Size: 2, BigEndian: true},
+	"i16le":   {Kind: Int, Size: 2, Signed: true},
+	"i16be":   {Kind: Int, Size: 2, Signed: true, BigEndian: true},
+	"u24le":   {Kind: Int, Size: 3},
+	"u32le":   {Kind: Int, Size: 4},
+	"u32be":   {Kind: Int, Size: 4, BigEndian: true},
+	"i32le":   {Kind: Int, Size: 4, Signed: true},
+	"i32be":   {Kind: Int, Size: 4, Signed: true, BigEndian: true},
+	"ptr16":   {Kind: Pointer, Size: 2},
+	"ptr24":   {Kind: Pointer, Size: 3},
+	"ptr32":   {Kind: Pointer, Size: 4},
+	"ptr32be": {Kind: Pointer, Size: 4, BigEndian: true},
+}
+
+// ParseType parses a type specification:
+//
+//	u8 i8 u16le u16be i16le i16be u24le u32le u32be i32le i32be
+//	ptr16 ptr24 ptr32 ptr32be     a pointer, shown as an address
+//	ptr24:TYPE                    a pointer followed to a TYPE
+//	cstring                       a NUL terminated string
+//	TYPE[N]                       an array of N elements
+//	struct:NAME                   a struct from structs
+func ParseType(spec string, structs Structs) (*Type, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty type")
+	}
+
+	// A pointer with a target: the target may itself be anything
+	if before, after, ok := strings.Cut(spec, ":"); ok && strings.HasPrefix(before, "ptr") {
+		ptr, err := ParseType(before, structs)
+		if err != nil {
+			return nil, err
+		}
+		if ptr.Kind != Pointer {
+			return nil, fmt.Errorf("'%s' is not a pointer type", before)
+		}
+		if ptr.Elem, err = ParseType(after, structs); err != nil {
+			return nil, err
+		}
+		ptr.Name = spec
+		return ptr, nil
+	}
+
+	if strings.HasSuffix(spec, "]") {
+		open := strings.LastIndex(spec, "[")
+		if open < 0 {
+			return nil, fmt.Errorf("invalid type '%s'", spec)
+		}
+		count, err := strconv.Atoi(spec[open+1 : len(spec)-1])
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid array length in '%s'", spec)
+		}
+		elem, err := ParseType(spec[:open], structs)
+		if err != nil {
+			return nil, err
+		}
+		if elem.Kind == CString {
+			return nil, fmt.Errorf("arrays of cstring are not supported (use u8[N] for fixed-length text)")
+		}
+		return &Type{Name: spec, Kind: Array, Elem: elem, Count: count}, nil
+	}
+
+	if spec == "cstring" {
+		return &Type{Name: spec, Kind: CString}, nil
+	}
+
+	if name, ok := strings.CutPrefix(spec, "struct:"); ok {
+		s, ok := structs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown struct '%s'", name)
+		}
+		return s, nil
+	}
+
+	t, ok := intTypes[strings.ToLower(spec)]
+	if !ok {
+		if s, ok := structs[spec]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type '%s'", spec)
+	}
+	t.Name = spec
+	return &t, nil
+}
+
+// ParseStructs reads struct definitions:
+//
+//	# Comment
+//	struct player {
+//	    x     u16le
+//	    name  ptr24:cstring
+//	    next  ptr24:struct:player
+//	}
+//
+// Fields are laid out in order without padding. Structs may contain structs
+// defined anywhere in the file, and point to any struct including their own.
+func ParseStructs(r io.Reader) (Structs, error) {
+	type fieldLine struct {
+		line       int
+		name, spec string
+	}
+	type structDef struct {
+		name   string
+		fields []fieldLine
+	}
+
+	var defs []*structDef
+	var current *structDef
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+
+		words := strings.Fields(line)
+		switch {
+		case current == nil && words[0] == "struct" && len(words) == 3 && words[2] == "{":
+			current = &structDef{name: words[1]}
+		case current != nil && line == "}":
+			defs = append(defs, current)
+			current = nil
+		case current != nil && len(words) == 2:
+			current.fields = append(current.fields, fieldLine{n, words[0], words[1]})
+		default:
+			return nil, fmt.Errorf("line %d: expected 'struct NAME {', 'FIELD TYPE' or '}'", n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("struct %s is not closed with '}'", current.name)
+	}
+
+	// Declare every struct first so fields can refer to any of them
+	structs := make(Structs)
+	for _, def := range defs {
+		if _, ok := structs[def.name]; ok {
+			return nil, fmt.Errorf("struct %s is defined twice", def.name)
+		}
+		structs[def.name] = &Type{Name: "struct:" + def.name, Kind: Struct}
+	}
+	for _, def := range defs {
+		s := structs[def.name]
+		for _, f := range def.fields {
+			t, err := ParseType(f.spec, structs)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", f.line, err)
+			}
+			if t.Kind == CString {
+				return nil, fmt.Errorf("line %d: a cstring has no fixed size (use ptr24:cstring or u8[N])", f.line)
+			}
+			s.Fields = append(s.Fields, Field{Name: f.name, Type: t})
+		}
+	}
+
+	// Lay out the fields now that nested structs are known
+	for name := range structs {
+		if err := layout(structs[name], map[*Type]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return structs, nil
+}
+
+// layout sets the size of a struct and the offsets of its fields. A struct
+// that contains itself, other than through a pointer, is an error.
+func layout(t *Type, visiting map[*Type]bool) error {
+	switch t.Kind {
+	case Array:
+		return layout(t.Elem, visiting)
+	case Struct:
+	default:
+		return nil
+	}
+
+	if t.Size > 0 || len(t.Fields) == 0 {
+		return nil
+	}
+	if visiting[t] {
+		return fmt.Errorf("%s contains itself", t.Name)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	offset := 0
+	for i := range t.Fields {
+		if err := layout(t.Fields[i].Type, visiting); err != nil {
+			return err
+		}
+		t.Fields[i].Offset = offset
+		offset += t.Fields[i].Type.ByteSize()
+	}
+	t.Size = offset
+	return nil
+}
@@ -0,0 +1,143 @@
+package loader
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// ELFLoader loads 32-bit ELF executables (big-endian m68k or little-endian)
+// Every PT_LOAD segment is written at its physical address, and the reset
+// vectors are pointed at the entry point.
+type ELFLoader struct {
+	BaseLoader
+	data   []byte
+	config *config.Config
+}
+
+// NewELFLoader creates a new ELF loader
+func NewELFLoader(cfg *config.Config) *ELFLoader {
+	return &ELFLoader{
+		config: cfg,
+	}
+}
+
+// Open opens an ELF file. Segments can be anywhere in an ELF file, so it is
+// read whole, even from standard input.
+func (l *ELFLoader) Open(filename string) error {
+	input, err := openInput(filename)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	return l.OpenReader(input)
+}
+
+// OpenReader reads an ELF file whole from r
+func (l *ELFLoader) OpenReader(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	l.data = data
+	return nil
+}
+
+// Close closes the ELF file (no-op for memory-loaded file)
+func (l *ELFLoader) Close() error {
+	l.data = nil
+	return nil
+}
+
+// Process parses the ELF file and uploads its loadable segments
+func (l *ELFLoader) Process() error {
+	if l.data == nil {
+		return fmt.Errorf("file not open")
+	}
+
+	if l.handler == nil {
+		return fmt.Errorf("handler not set")
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(l.data))
+	if err != nil {
+		return formatErrorf("invalid ELF file: %w", err)
+	}
+	defer f.Close()
+
+	if f.Class != elf.ELFCLASS32 {
+		return formatErrorf("unsupported ELF class %s (only 32-bit files are supported)", f.Class)
+	}
+
+	if f.Type != elf.ET_EXEC {
+		return formatErrorf("ELF file is not an executable (type %s)", f.Type)
+	}
+
+	if f.Machine == elf.EM_68K && !l.config.CPUIsMotorolatype680X0() {
+		return formatErrorf("ELF is built for 680x0, but CPU is configured as %s", l.config.CPU)
+	}
+
+	l.validator.reset()
+	loaded := 0
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Memsz == 0 {
+			continue
+		}
+
+		if prog.Filesz > prog.Memsz {
+			return formatErrorf("ELF segment at 0x%X has file size larger than memory size", prog.Paddr)
+		}
+
+		where := fmt.Sprintf("in segment %d", loaded)
+		if err := l.validator.checkSize(prog.Memsz, where); err != nil {
+			return err
+		}
+
+		// Zero-fill the part of the segment not stored in the file (.bss)
+		block := make([]byte, prog.Memsz)
+		if _, err := prog.ReadAt(block[:prog.Filesz], 0); err != nil {
+			return fmt.Errorf("failed to read ELF segment at 0x%X: %w", prog.Paddr, err)
+		}
+
+		if err := l.validator.check(uint32(prog.Paddr), len(block), where); err != nil {
+			return err
+		}
+		if err := l.writeSegment(uint32(prog.Paddr), block); err != nil {
+			return err
+		}
+		loaded++
+	}
+
+	if loaded == 0 {
+		return formatErrorf("ELF file has no loadable segments")
+	}
+
+	// Set up CPU-specific reset vectors
+	if err := SetupResetVectors(l.config.CPU, uint32(f.Entry), l.handler); err != nil {
+		return fmt.Errorf("failed to set up reset vectors: %w", err)
+	}
+
+	return nil
+}
+
+// writeSegment sends a segment to the handler in 1KB chunks
+func (l *ELFLoader) writeSegment(address uint32, block []byte) error {
+	const chunkSize = 1024
+
+	for offset := 0; offset < len(block); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(block) {
+			end = len(block)
+		}
+
+		if err := l.handler(address+uint32(offset), block[offset:end]); err != nil {
+			return fmt.Errorf("failed to write chunk at 0x%X: %w", address+uint32(offset), err)
+		}
+	}
+
+	return nil
+}
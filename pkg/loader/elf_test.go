@@ -0,0 +1,113 @@
+package loader
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// buildELF returns a minimal 32-bit executable with a single PT_LOAD segment
+func buildELF(order binary.ByteOrder, machine elf.Machine, entry, paddr uint32, data []byte, memsz uint32) []byte {
+	const headerSize = 52
+	const progSize = 32
+
+	var buf bytes.Buffer
+	ident := [elf.EI_NIDENT]byte{0x7F, 'E', 'L', 'F', byte(elf.ELFCLASS32), 0, byte(elf.EV_CURRENT)}
+	if order == binary.BigEndian {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	} else {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	}
+
+	binary.Write(&buf, order, elf.Header32{
+		Ident:     ident,
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     entry,
+		Phoff:     headerSize,
+		Ehsize:    headerSize,
+		Phentsize: progSize,
+		Phnum:     1,
+	})
+	binary.Write(&buf, order, elf.Prog32{
+		Type:   uint32(elf.PT_LOAD),
+		Off:    headerSize + progSize,
+		Vaddr:  paddr,
+		Paddr:  paddr,
+		Filesz: uint32(len(data)),
+		Memsz:  memsz,
+		Flags:  uint32(elf.PF_R | elf.PF_X),
+	})
+	buf.Write(data)
+
+	return buf.Bytes()
+}
+
+func TestELFLoader(t *testing.T) {
+	code := bytes.Repeat([]byte{0x4E, 0x71}, 700) // Spans more than one chunk
+
+	tests := []struct {
+		name    string
+		order   binary.ByteOrder
+		machine elf.Machine
+		cpu     string
+	}{
+		{"Big-endian m68k", binary.BigEndian, elf.EM_68K, "68040"},
+		{"Little-endian", binary.LittleEndian, elf.EM_NONE, "68000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := buildELF(tt.order, tt.machine, 0x10008, 0x10000, code, uint32(len(code))+16)
+			filename := filepath.Join(t.TempDir(), "test.elf")
+			if err := os.WriteFile(filename, image, 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			memory := collectBlocks(t, NewELFLoader(&config.Config{CPU: tt.cpu}), filename)
+			for i, want := range code {
+				if got := memory[0x10000+uint32(i)]; got != want {
+					t.Fatalf("memory[0x%X] = %02X, want %02X", 0x10000+i, got, want)
+				}
+			}
+
+			// .bss beyond the file data is cleared
+			bss := uint32(0x10000 + len(code))
+			for i := uint32(0); i < 16; i++ {
+				if b, ok := memory[bss+i]; !ok || b != 0 {
+					t.Fatalf("memory[0x%X] not cleared", bss+i)
+				}
+			}
+
+			pc := uint32(memory[4])<<24 | uint32(memory[5])<<16 | uint32(memory[6])<<8 | uint32(memory[7])
+			if pc != 0x10008 {
+				t.Errorf("reset vector = 0x%X, want 0x10008", pc)
+			}
+		})
+	}
+}
+
+func TestELFLoaderRejectsWrongCPU(t *testing.T) {
+	image := buildELF(binary.BigEndian, elf.EM_68K, 0x2000, 0x2000, []byte{0x4E, 0x71}, 2)
+	filename := filepath.Join(t.TempDir(), "test.elf")
+	if err := os.WriteFile(filename, image, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	ldr := NewELFLoader(&config.Config{CPU: "65816"})
+	if err := ldr.Open(filename); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	defer ldr.Close()
+	ldr.SetHandler(func(address uint32, data []byte) error { return nil })
+
+	if err := ldr.Process(); err == nil {
+		t.Error("Process() expected error for 680x0 ELF on a 65816")
+	}
+}
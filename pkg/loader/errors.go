@@ -0,0 +1,28 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFormat is a file that isn't valid in its format, or not for the
+// configured CPU. Loaders' format errors match it with errors.Is.
+var ErrFormat = errors.New("invalid file format")
+
+// FormatError is an error in the contents of a file
+type FormatError struct {
+	Err error
+}
+
+func (e *FormatError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FormatError) Unwrap() []error {
+	return []error{ErrFormat, e.Err}
+}
+
+// formatErrorf returns a FormatError with a formatted message
+func formatErrorf(format string, args ...interface{}) error {
+	return &FormatError{Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		contents string
+	}{
+		{"Intel HEX without a colon", "bad.hex", "0200000012345\n"},
+		{"Intel HEX with a short record", "bad.hex", ":0300000041FF00\n"},
+		{"S-record with a bad type", "bad.s28", "SX030000FC\n"},
+		{"PGX without a signature", "bad.pgx", "NOTPGX"},
+		{"PGZ with a bad signature", "bad.pgz", "Q\x00\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), tt.filename)
+			if err := os.WriteFile(filename, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			format, err := FormatForFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ldr, err := New(format, &config.Config{CPU: "65816"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Some loaders check the file when opening it
+			if err = ldr.Open(filename); err == nil {
+				defer ldr.Close()
+				ldr.SetHandler(func(address uint32, data []byte) error { return nil })
+				err = ldr.Process()
+			}
+			if !errors.Is(err, ErrFormat) {
+				t.Errorf("error = %v, want %v", err, ErrFormat)
+			}
+		})
+	}
+}
+
+func TestHandlerErrorsAreNotFormatErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "ok.hex")
+	if err := os.WriteFile(filename, []byte(":0100000041BE\n:00000001FF\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ldr := NewIntelHexLoader()
+	if err := ldr.Open(filename); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	defer ldr.Close()
+
+	failed := errors.New("write failed")
+	ldr.SetHandler(func(address uint32, data []byte) error { return failed })
+	err := ldr.Process()
+	if !errors.Is(err, failed) || errors.Is(err, ErrFormat) {
+		t.Errorf("Process() error = %v, want only the handler's error", err)
+	}
+}
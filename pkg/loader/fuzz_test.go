@@ -0,0 +1,88 @@
+package loader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// fuzzLimits are small, so fuzzing finds files that reach them
+var fuzzLimits = Limits{MaxBlockSize: 0x1000, MaxTotalSize: 0x4000, AddressLimit: 1 << 24}
+
+// fuzzLoader loads data as a file of the given format and fails if it panics
+// or passes on a write outside fuzzLimits. Errors from malformed files are
+// expected.
+func fuzzLoader(t *testing.T, format string, data []byte) {
+	filename := filepath.Join(t.TempDir(), "fuzz."+format)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	ldr, err := New(format, &config.Config{CPU: "65c02"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	ldr.SetLimits(fuzzLimits)
+	if err := ldr.Open(filename); err != nil {
+		return
+	}
+	defer ldr.Close()
+
+	ldr.SetHandler(func(address uint32, data []byte) error {
+		if uint64(len(data)) > fuzzLimits.MaxBlockSize {
+			t.Fatalf("write of %d bytes at 0x%X is larger than the block limit", len(data), address)
+		}
+		if end := uint64(address) + uint64(len(data)); end > fuzzLimits.AddressLimit {
+			t.Fatalf("write at 0x%X ends at 0x%X, beyond the address limit", address, end-1)
+		}
+		return nil
+	})
+	ldr.Process()
+}
+
+func FuzzPGZ(f *testing.F) {
+	var buf bytes.Buffer
+	WritePGZ(&buf, []Segment{{0x2000, []byte{0xA9, 0x01, 0x60}}, {0x10000, make([]byte, 100)}}, 0x2000)
+	f.Add(buf.Bytes())
+	f.Add([]byte{'z', 0x00, 0x20, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzLoader(t, FormatPGZ, data)
+	})
+}
+
+func FuzzPGX(f *testing.F) {
+	var buf bytes.Buffer
+	WritePGX(&buf, 0x01, 0x2000, []byte{0xA9, 0x01, 0x60})
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzLoader(t, FormatPGX, data)
+	})
+}
+
+func FuzzWDC(f *testing.F) {
+	f.Add([]byte{'Z', 0x00, 0x20, 0x00, 0x02, 0x00, 0x00, 0xAA, 0xBB, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzLoader(t, FormatWDC, data)
+	})
+}
+
+func FuzzIntelHex(f *testing.F) {
+	var buf bytes.Buffer
+	WriteIntelHex(&buf, 0xFFF0, make([]byte, 40))
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzLoader(t, FormatIntelHex, data)
+	})
+}
+
+func FuzzSREC(f *testing.F) {
+	var buf bytes.Buffer
+	WriteSRec(&buf, 0x10000, make([]byte, 40))
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzLoader(t, FormatSREC, data)
+	})
+}
@@ -0,0 +1,215 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// Image is the decoded contents of a PGX, PGZ or WDC executable, for
+// inspecting a file without loading it
+type Image struct {
+	Format      string
+	Segments    []Segment // In file order
+	Start       uint32
+	HasStart    bool
+	CPUType     byte // PGX header CPU type, 0 for other formats
+	AddressSize int  // Bytes in each address field of the file
+}
+
+// DecodeImage reads a PGX, PGZ or WDC file, standard input or a URL
+func DecodeImage(format string, filename string) (*Image, error) {
+	input, err := openInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	switch format {
+	case FormatPGX:
+		return DecodePGX(input)
+	case FormatPGZ:
+		return DecodePGZ(input)
+	case FormatWDC:
+		return DecodeWDC(input)
+	}
+	return nil, fmt.Errorf("can't inspect %s files", format)
+}
+
+// DecodePGX decodes a PGX file, which holds a single block that is started at
+// its load address
+func DecodePGX(r io.Reader) (*Image, error) {
+	header := make([]byte, protocol.PGXOffData)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	cpuType, address, err := parsePGXHeader(header[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	var v validator
+	data, err := io.ReadAll(io.LimitReader(r, int64(v.current().MaxBlockSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := v.checkSize(uint64(len(data)), "after the header"); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Format:      FormatPGX,
+		Segments:    []Segment{{Address: address, Data: data}},
+		Start:       address,
+		HasStart:    true,
+		CPUType:     cpuType,
+		AddressSize: 4,
+	}, nil
+}
+
+// DecodePGZ decodes a PGZ file
+func DecodePGZ(r io.Reader) (*Image, error) {
+	stream, err := openPGZStream(r)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Format: FormatPGZ, AddressSize: stream.addressSize}
+	return img, decodeBlocks(img, stream, true)
+}
+
+// DecodeWDC decodes a WDCTools binary file
+func DecodeWDC(r io.Reader) (*Image, error) {
+	stream, err := openWDCStream(r)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{Format: FormatWDC, AddressSize: 3}
+	return img, decodeBlocks(img, stream, false)
+}
+
+// decodeBlocks reads the blocks of a PGZ or WDC file into an image. For PGZ
+// files, a block without data is the start address.
+func decodeBlocks(img *Image, stream *blockStream, hasStart bool) error {
+	var v validator
+	for {
+		blockOffset := stream.offset
+		address, size, err := stream.header()
+		if err == io.EOF || err == nil && address == 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if size == 0 && hasStart {
+			img.Start, img.HasStart = address, true
+			continue
+		}
+		if err := v.checkSize(uint64(size), fmt.Sprintf("at offset %d", blockOffset)); err != nil {
+			return err
+		}
+		data := make([]byte, size)
+		if err := stream.read(data); err != nil {
+			return err
+		}
+		img.Segments = append(img.Segments, Segment{Address: address, Data: data})
+	}
+}
+
+// Size returns the number of bytes in the image's segments
+func (img *Image) Size() int {
+	size := 0
+	for _, seg := range img.Segments {
+		size += len(seg.Data)
+	}
+	return size
+}
+
+// Lint returns warnings about an image that would load wrongly: segments
+// that overlap each other, a start address outside every segment, and, when
+// cfg has a target machine, segments beyond its address space or outside the
+// RAM of its memory map. For machines without a memory map, segments over the
+// flash window (which memory writes don't change) or outside the ram region,
+// if one is defined, are reported instead. A PGX file for another CPU than
+// the configured one is reported too.
+func (img *Image) Lint(cfg *config.Config) []string {
+	var warnings []string
+
+	// Overlaps, checked in address order
+	sorted := append([]Segment(nil), img.Segments...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Address < sorted[j].Address })
+	for i := 1; i < len(sorted); i++ {
+		prev, seg := sorted[i-1], sorted[i]
+		if end := segmentEnd(prev); uint64(seg.Address) < end {
+			warnings = append(warnings, fmt.Sprintf("blocks at %06X and %06X overlap by %d bytes",
+				prev.Address, seg.Address, min(end, segmentEnd(seg))-uint64(seg.Address)))
+		}
+	}
+
+	if img.HasStart && !img.contains(img.Start) {
+		warnings = append(warnings, fmt.Sprintf("start address %06X is not inside any block", img.Start))
+	}
+
+	if img.Format == FormatPGX && cfg.CPU != "" {
+		if want, err := PGXCPUType(cfg.CPU); err == nil && want != img.CPUType {
+			warnings = append(warnings, fmt.Sprintf("PGX CPU type %d doesn't match the configured CPU %s (type %d)",
+				img.CPUType, cfg.CPU, want))
+		}
+	}
+
+	m := cfg.Machine()
+	if m == nil {
+		return warnings
+	}
+
+	// The debug port's 24-bit addresses reach the first 16MB
+	limit := uint64(1) << 24
+	flashStart, flashErr := strconv.ParseUint(cfg.FlashAddress, 16, 32)
+	flashEnd := flashStart + uint64(cfg.FlashSize)
+	ram, hasRAM := m.Region("ram")
+
+	for _, seg := range img.Segments {
+		start, end := uint64(seg.Address), segmentEnd(seg)
+		if end > limit {
+			warnings = append(warnings, fmt.Sprintf("block at %06X ends at %06X, beyond the 16MB address space of %s",
+				seg.Address, end-1, m.Name))
+			continue
+		}
+		if len(m.MemoryMap) > 0 {
+			if err := m.CheckWrite(seg.Address, len(seg.Data), config.MemoryRAM); err != nil {
+				warnings = append(warnings, err.Error())
+			}
+			continue
+		}
+		if flashErr == nil && cfg.FlashSize > 0 && start < flashEnd && end > flashStart {
+			warnings = append(warnings, fmt.Sprintf("block at %06X overlaps flash at %06X-%06X, which uploads don't change",
+				seg.Address, flashStart, flashEnd-1))
+			continue
+		}
+		if hasRAM && ram.Size > 0 && (start < uint64(ram.Address) || end > uint64(ram.Address)+uint64(ram.Size)) {
+			warnings = append(warnings, fmt.Sprintf("block at %06X is outside the RAM of %s (%06X-%06X)",
+				seg.Address, m.Name, ram.Address, uint64(ram.Address)+uint64(ram.Size)-1))
+		}
+	}
+	return warnings
+}
+
+// contains returns true if address is inside one of the image's segments
+func (img *Image) contains(address uint32) bool {
+	for _, seg := range img.Segments {
+		if address >= seg.Address && uint64(address) < segmentEnd(seg) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentEnd returns the address just past a segment
+func segmentEnd(seg Segment) uint64 {
+	return uint64(seg.Address) + uint64(len(seg.Data))
+}
@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestDecodePGZ(t *testing.T) {
+	segments := []Segment{
+		{Address: 0x2000, Data: []byte{1, 2, 3}},
+		{Address: 0x10000, Data: []byte{4, 5}},
+	}
+	var buf bytes.Buffer
+	if err := WritePGZ(&buf, segments, 0x2001); err != nil {
+		t.Fatalf("WritePGZ() error: %v", err)
+	}
+
+	img, err := DecodePGZ(&buf)
+	if err != nil {
+		t.Fatalf("DecodePGZ() error: %v", err)
+	}
+	if img.AddressSize != 3 || !img.HasStart || img.Start != 0x2001 {
+		t.Errorf("DecodePGZ() = address size %d, start %X (%v)", img.AddressSize, img.Start, img.HasStart)
+	}
+	if len(img.Segments) != 2 || img.Segments[1].Address != 0x10000 || !bytes.Equal(img.Segments[1].Data, []byte{4, 5}) {
+		t.Errorf("DecodePGZ() segments = %+v", img.Segments)
+	}
+	if img.Size() != 5 {
+		t.Errorf("Size() = %d, want 5", img.Size())
+	}
+	if warnings := img.Lint(config.Default()); len(warnings) != 0 {
+		t.Errorf("Lint() = %v, want no warnings", warnings)
+	}
+}
+
+func TestDecodeWDC(t *testing.T) {
+	data := []byte{'Z', 0x00, 0x20, 0x00, 0x02, 0x00, 0x00, 0xAA, 0xBB, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	img, err := DecodeWDC(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeWDC() error: %v", err)
+	}
+	if len(img.Segments) != 1 || img.Segments[0].Address != 0x2000 || img.HasStart {
+		t.Errorf("DecodeWDC() = %+v", img)
+	}
+}
+
+func TestImageLint(t *testing.T) {
+	cfg := config.Default()
+	if err := cfg.SetTarget("f256k"); err != nil {
+		t.Fatalf("SetTarget() error: %v", err)
+	}
+
+	img := &Image{
+		Format: FormatPGZ,
+		Segments: []Segment{
+			{Address: 0x2000, Data: make([]byte, 0x10)},
+			{Address: 0x2008, Data: make([]byte, 0x10)},
+			{Address: 0x07FFF0, Data: make([]byte, 0x20)},
+			{Address: 0xFFFFF0, Data: make([]byte, 0x20)},
+		},
+		Start:    0x9000,
+		HasStart: true,
+	}
+	want := []string{
+		"overlap by 8 bytes",
+		"start address 009000",
+		"reaches flash at 080000-0FFFFF",
+		"beyond the 16MB address space",
+	}
+	warnings := img.Lint(cfg)
+	if len(warnings) != len(want) {
+		t.Fatalf("Lint() = %q, want %d warnings", warnings, len(want))
+	}
+	for i := range want {
+		if !strings.Contains(warnings[i], want[i]) {
+			t.Errorf("warning %d = %q, want it to mention %q", i, warnings[i], want[i])
+		}
+	}
+}
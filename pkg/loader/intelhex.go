@@ -3,7 +3,7 @@ package loader
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 	"strconv"
 )
@@ -11,7 +11,9 @@ import (
 // IntelHexLoader loads Intel HEX format files
 type IntelHexLoader struct {
 	BaseLoader
-	baseAddress uint32
+	baseAddress  uint32
+	startAddress uint32
+	hasStart     bool
 }
 
 // NewIntelHexLoader creates a new Intel HEX loader
@@ -23,12 +25,21 @@ func NewIntelHexLoader() *IntelHexLoader {
 
 // Open opens an Intel HEX file
 func (l *IntelHexLoader) Open(filename string) error {
-	file, err := os.Open(filename)
+	input, err := openInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
-	l.file = file
+	l.input = input
 	l.baseAddress = 0
+	l.hasStart = false
+	return nil
+}
+
+// OpenReader reads an Intel HEX file from r
+func (l *IntelHexLoader) OpenReader(r io.Reader) error {
+	l.input = io.NopCloser(r)
+	l.baseAddress = 0
+	l.hasStart = false
 	return nil
 }
 
@@ -36,7 +47,7 @@ func (l *IntelHexLoader) Open(filename string) error {
 // Intel HEX format: :LLAAAATT[DD...]CC
 // LL = byte count, AAAA = address, TT = record type, DD = data, CC = checksum
 func (l *IntelHexLoader) Process() error {
-	if l.file == nil {
+	if l.input == nil {
 		return fmt.Errorf("file not open")
 	}
 
@@ -48,7 +59,8 @@ func (l *IntelHexLoader) Process() error {
 	// :LLAAAATTDDDDCC where each letter is a hex digit
 	pattern := regexp.MustCompile(`^:([0-9a-fA-F]{2})([0-9a-fA-F]{4})([0-9a-fA-F]{2})([0-9a-fA-F]*)([0-9a-fA-F]{2})`)
 
-	scanner := bufio.NewScanner(l.file)
+	l.validator.reset()
+	scanner := bufio.NewScanner(l.input)
 	lineNum := 0
 
 	for scanner.Scan() {
@@ -63,7 +75,7 @@ func (l *IntelHexLoader) Process() error {
 		// Parse the line
 		matches := pattern.FindStringSubmatch(line)
 		if matches == nil {
-			return fmt.Errorf("invalid Intel HEX format at line %d: %s", lineNum, line)
+			return formatErrorf("invalid Intel HEX format at line %d: %s", lineNum, line)
 		}
 
 		// Extract fields
@@ -78,17 +90,20 @@ func (l *IntelHexLoader) Process() error {
 			// Convert hex string to bytes
 			data, err := hexStringToBytes(dataHex)
 			if err != nil {
-				return fmt.Errorf("invalid data at line %d: %w", lineNum, err)
+				return formatErrorf("invalid data at line %d: %w", lineNum, err)
 			}
 
 			// Verify byte count
 			if uint64(len(data)) != byteCount {
-				return fmt.Errorf("byte count mismatch at line %d: expected %d, got %d",
+				return formatErrorf("byte count mismatch at line %d: expected %d, got %d",
 					lineNum, byteCount, len(data))
 			}
 
 			// Send to handler with base address applied
 			fullAddress := l.baseAddress + uint32(address)
+			if err := l.validator.check(fullAddress, len(data), fmt.Sprintf("at line %d", lineNum)); err != nil {
+				return err
+			}
 			if err := l.handler(fullAddress, data); err != nil {
 				return fmt.Errorf("handler failed at line %d: %w", lineNum, err)
 			}
@@ -108,11 +123,24 @@ func (l *IntelHexLoader) Process() error {
 			extAddr, _ := strconv.ParseUint(dataHex, 16, 32)
 			l.baseAddress = uint32(extAddr) << 16
 
-		case 0x03, 0x05: // Start segment/linear address
-			// Ignored (these specify execution start address, not data)
+		case 0x03: // Start segment address (CS:IP)
+			start, err := strconv.ParseUint(dataHex, 16, 32)
+			if err != nil || len(dataHex) != 8 {
+				return formatErrorf("invalid start segment address at line %d", lineNum)
+			}
+			l.startAddress = uint32(start>>16)<<4 + uint32(start&0xFFFF)
+			l.hasStart = true
+
+		case 0x05: // Start linear address
+			start, err := strconv.ParseUint(dataHex, 16, 32)
+			if err != nil || len(dataHex) != 8 {
+				return formatErrorf("invalid start linear address at line %d", lineNum)
+			}
+			l.startAddress = uint32(start)
+			l.hasStart = true
 
 		default:
-			return fmt.Errorf("unsupported record type 0x%02X at line %d", recordType, lineNum)
+			return formatErrorf("unsupported record type 0x%02X at line %d", recordType, lineNum)
 		}
 	}
 
@@ -122,3 +150,55 @@ func (l *IntelHexLoader) Process() error {
 
 	return nil
 }
+
+// StartAddress returns the start address from a type 03 or 05 record, if the
+// file had one
+func (l *IntelHexLoader) StartAddress() (uint32, bool) {
+	return l.startAddress, l.hasStart
+}
+
+// WriteIntelHex writes data to w as Intel HEX records starting at address
+// Extended linear address records are emitted whenever the upper 16 bits of
+// the address change, and the output is terminated with an end-of-file record.
+func WriteIntelHex(w io.Writer, address uint32, data []byte) error {
+	const recordSize = 16
+	upper := uint32(0)
+
+	for offset := 0; offset < len(data); {
+		current := address + uint32(offset)
+
+		if current>>16 != upper {
+			upper = current >> 16
+			if err := writeIntelHexRecord(w, 0, 0x04, []byte{byte(upper >> 8), byte(upper)}); err != nil {
+				return err
+			}
+		}
+
+		// Don't let a record cross a 64KB boundary
+		size := recordSize
+		if remaining := len(data) - offset; remaining < size {
+			size = remaining
+		}
+		if toBoundary := int(0x10000 - current&0xFFFF); toBoundary < size {
+			size = toBoundary
+		}
+
+		if err := writeIntelHexRecord(w, uint16(current), 0x00, data[offset:offset+size]); err != nil {
+			return err
+		}
+		offset += size
+	}
+
+	return writeIntelHexRecord(w, 0, 0x01, nil)
+}
+
+// writeIntelHexRecord writes a single :LLAAAATT[DD...]CC record
+func writeIntelHexRecord(w io.Writer, address uint16, recordType byte, data []byte) error {
+	sum := byte(len(data)) + byte(address>>8) + byte(address) + recordType
+	for _, b := range data {
+		sum += b
+	}
+
+	_, err := fmt.Fprintf(w, ":%02X%04X%02X%X%02X\n", len(data), address, recordType, data, byte(-int(sum)))
+	return err
+}
@@ -0,0 +1,115 @@
+package loader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// collectBlocks runs a loader over a file and gathers everything passed to the handler
+func collectBlocks(t *testing.T, ldr Loader, filename string) map[uint32]byte {
+	t.Helper()
+
+	if err := ldr.Open(filename); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	defer ldr.Close()
+
+	memory := make(map[uint32]byte)
+	ldr.SetHandler(func(address uint32, data []byte) error {
+		for i, b := range data {
+			memory[address+uint32(i)] = b
+		}
+		return nil
+	})
+
+	if err := ldr.Process(); err != nil {
+		t.Fatalf("Process() error: %v", err)
+	}
+	return memory
+}
+
+func TestWriteIntelHexRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint32
+		size    int
+	}{
+		{"Small block", 0x1000, 5},
+		{"Crosses 64KB boundary", 0x00FFF8, 40},
+		{"High address", 0x380000, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+
+			var buf bytes.Buffer
+			if err := WriteIntelHex(&buf, tt.address, data); err != nil {
+				t.Fatalf("WriteIntelHex() error: %v", err)
+			}
+
+			filename := filepath.Join(t.TempDir(), "test.hex")
+			if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			memory := collectBlocks(t, NewIntelHexLoader(), filename)
+			if len(memory) != len(data) {
+				t.Fatalf("loaded %d bytes, want %d", len(memory), len(data))
+			}
+			for i, b := range data {
+				if got := memory[tt.address+uint32(i)]; got != b {
+					t.Errorf("byte at 0x%X = 0x%02X, want 0x%02X", tt.address+uint32(i), got, b)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteIntelHexChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteIntelHex(&buf, 0x0100, []byte{0x21, 0x46, 0x01}); err != nil {
+		t.Fatalf("WriteIntelHex() error: %v", err)
+	}
+
+	expected := ":0301000021460194\n:00000001FF\n"
+	if buf.String() != expected {
+		t.Errorf("WriteIntelHex() = %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestIntelHexStartAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    string
+		wantAddr  uint32
+		wantStart bool
+	}{
+		{"Start linear address", ":0400000500380000BF", 0x380000, true},
+		{"Start segment address", ":0400000310002000C9", 0x12000, true},
+		{"No start record", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.hex")
+			content := ":02100000EAEA1A\n" + tt.record + "\n:00000001FF\n"
+			if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			ldr := NewIntelHexLoader()
+			collectBlocks(t, ldr, filename)
+
+			addr, ok := ldr.StartAddress()
+			if ok != tt.wantStart || addr != tt.wantAddr {
+				t.Errorf("StartAddress() = 0x%X, %v, want 0x%X, %v", addr, ok, tt.wantAddr, tt.wantStart)
+			}
+		})
+	}
+}
@@ -1,21 +1,52 @@
 // Package loader provides file format loaders for various binary formats
-// used by Foenix retro computers (Intel HEX, SREC, WDC, PGX, PGZ)
+// used by Foenix retro computers (Intel HEX, SREC, WDC, PGX, PGZ, ELF)
 package loader
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// File formats understood by New
+const (
+	FormatIntelHex = "intelhex"
+	FormatSREC     = "srec"
+	FormatWDC      = "wdc"
+	FormatPGX      = "pgx"
+	FormatPGZ      = "pgz"
+	FormatELF      = "elf"
 )
 
 // WriteHandler is a callback function that receives parsed address/data pairs
 // This is typically connected to protocol.DebugPort.WriteBlock()
 type WriteHandler func(address uint32, data []byte) error
 
+// ContextHandler returns a handler that passes blocks to handler until ctx is
+// done, then fails with the context's error, so a loader's Process stops
+// at the next block
+func ContextHandler(ctx context.Context, handler WriteHandler) WriteHandler {
+	return func(address uint32, data []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return handler(address, data)
+	}
+}
+
 // Loader defines the interface for all file format loaders
 type Loader interface {
-	// Open opens the file for reading
+	// Open opens the file for reading, or standard input for util.Stdin
+	// ("-") or an http(s) URL
 	Open(filename string) error
 
+	// OpenReader reads the file from r instead, e.g. a pipe
+	OpenReader(r io.Reader) error
+
 	// Close closes the file
 	Close() error
 
@@ -24,12 +55,66 @@ type Loader interface {
 
 	// Process reads and parses the file, invoking the handler for each block
 	Process() error
+
+	// SetLimits bounds the blocks the file may load (see Limits)
+	SetLimits(limits Limits)
+}
+
+// StartAddresser is implemented by loaders for formats that can record the
+// address execution should start from
+type StartAddresser interface {
+	// StartAddress returns the start address and whether the file had one
+	StartAddress() (uint32, bool)
+}
+
+// New returns the loader for a file format. PGX, PGZ and ELF files are checked
+// against the CPU in cfg, and every file against the address space of its
+// target machine (see LimitsFor).
+func New(format string, cfg *config.Config) (Loader, error) {
+	var l Loader
+	switch format {
+	case FormatIntelHex:
+		l = NewIntelHexLoader()
+	case FormatSREC:
+		l = NewSRecLoader()
+	case FormatWDC:
+		l = NewWDCLoader()
+	case FormatPGX:
+		l = NewPGXLoader(cfg)
+	case FormatPGZ:
+		l = NewPGZLoader(cfg)
+	case FormatELF:
+		l = NewELFLoader(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	l.SetLimits(LimitsFor(cfg))
+	return l, nil
+}
+
+// FormatForFile picks the file format from a file name's extension. WDC
+// binaries have no extension of their own, so they must be named explicitly.
+func FormatForFile(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".hex", ".ihex":
+		return FormatIntelHex, nil
+	case ".srec", ".s19", ".s28", ".s37", ".mot":
+		return FormatSREC, nil
+	case ".pgx":
+		return FormatPGX, nil
+	case ".pgz":
+		return FormatPGZ, nil
+	case ".elf":
+		return FormatELF, nil
+	}
+	return "", fmt.Errorf("can't tell the format of %s from its extension", filename)
 }
 
 // BaseLoader provides common functionality for all loaders
 type BaseLoader struct {
-	file    *os.File
-	handler WriteHandler
+	input     io.ReadCloser
+	handler   WriteHandler
+	validator validator
 }
 
 // SetHandler sets the write handler callback
@@ -39,10 +124,12 @@ func (b *BaseLoader) SetHandler(handler WriteHandler) {
 
 // Close closes the file
 func (b *BaseLoader) Close() error {
-	if b.file != nil {
-		return b.file.Close()
+	if b.input == nil {
+		return nil
 	}
-	return nil
+	err := b.input.Close()
+	b.input = nil
+	return err
 }
 
 // Helper function to convert hex string to bytes
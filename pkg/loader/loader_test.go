@@ -0,0 +1,66 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestFormatForFile(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{"game.hex", FormatIntelHex, false},
+		{"GAME.S19", FormatSREC, false},
+		{"kernel.mot", FormatSREC, false},
+		{"game.pgz", FormatPGZ, false},
+		{"game.pgx", FormatPGX, false},
+		{"a.out.elf", FormatELF, false},
+		{"game.bin", "", true},
+	}
+	for _, tt := range tests {
+		got, err := FormatForFile(tt.filename)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("FormatForFile(%q) should fail", tt.filename)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("FormatForFile(%q) = %q, %v, want %q", tt.filename, got, err, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{CPU: "65c02"}
+	for _, format := range []string{FormatIntelHex, FormatSREC, FormatWDC, FormatPGX, FormatPGZ, FormatELF} {
+		if _, err := New(format, cfg); err != nil {
+			t.Errorf("New(%q) error: %v", format, err)
+		}
+	}
+	if _, err := New("bin", cfg); err == nil {
+		t.Error("New() with an unknown format should fail")
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	handler := ContextHandler(ctx, func(address uint32, data []byte) error {
+		calls++
+		return nil
+	})
+
+	if err := handler(0, []byte{1}); err != nil || calls != 1 {
+		t.Fatalf("handler() = %v after %d calls", err, calls)
+	}
+	cancel()
+	if err := handler(0, []byte{1}); !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("handler() after cancel = %v after %d calls, want context.Canceled", err, calls)
+	}
+}
@@ -1,19 +1,22 @@
 package loader
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/cpu"
 	"github.com/daschewie/foenixmgr/pkg/protocol"
 )
 
 // PGXLoader loads PGX binary format files
 // PGX format: "PGX" signature + version/CPU byte + 32-bit address + data
+// The data is read as a stream, so the file can come from a pipe.
 type PGXLoader struct {
 	BaseLoader
-	data   []byte
+	reader *bufio.Reader
 	config *config.Config
 }
 
@@ -26,24 +29,29 @@ func NewPGXLoader(cfg *config.Config) *PGXLoader {
 
 // Open opens a PGX file
 func (l *PGXLoader) Open(filename string) error {
-	data, err := os.ReadFile(filename)
+	input, err := openInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
+	l.input = input
+	return l.OpenReader(input)
+}
 
-	l.data = data
+// OpenReader reads a PGX file from r
+func (l *PGXLoader) OpenReader(r io.Reader) error {
+	l.reader = bufio.NewReader(r)
 	return nil
 }
 
-// Close closes the PGX file (no-op for memory-loaded file)
+// Close closes the PGX file
 func (l *PGXLoader) Close() error {
-	l.data = nil
-	return nil
+	l.reader = nil
+	return l.BaseLoader.Close()
 }
 
 // Process reads and parses the PGX file
 func (l *PGXLoader) Process() error {
-	if l.data == nil {
+	if l.reader == nil {
 		return fmt.Errorf("file not open")
 	}
 
@@ -51,39 +59,45 @@ func (l *PGXLoader) Process() error {
 		return fmt.Errorf("handler not set")
 	}
 
-	// Check minimum size (signature + version + address = 8 bytes)
-	if len(l.data) < protocol.PGXOffData {
-		return fmt.Errorf("file too small to be valid PGX")
-	}
-
-	// Check signature
-	signature := l.data[protocol.PGXOffSigStart:protocol.PGXOffSigEnd]
-	if string(signature) != "PGX" {
-		return fmt.Errorf("bad PGX signature: %s", signature)
+	header := make([]byte, protocol.PGXOffData)
+	n, err := io.ReadFull(l.reader, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed to read file: %w", err)
 	}
-
-	// Check version
-	versionByte := l.data[protocol.PGXOffVersion]
-	pgxVersion := (versionByte >> 4) & 0x0F
-	if pgxVersion > 0 {
-		return fmt.Errorf("unsupported PGX version: %d", pgxVersion)
+	pgxCPU, address, err := parsePGXHeader(header[:n])
+	if err != nil {
+		return err
 	}
 
 	// Check CPU compatibility
-	pgxCPU := versionByte & 0x0F
 	if err := l.verifyCPUCompatibility(pgxCPU); err != nil {
 		return err
 	}
 
-	// Get target address (32-bit little-endian)
-	address := binary.LittleEndian.Uint32(l.data[protocol.PGXOffAddrStart:protocol.PGXOffAddrEnd])
-
-	// Get data block
-	block := l.data[protocol.PGXOffData:]
-
-	// Send data to handler
-	if err := l.handler(address, block); err != nil {
-		return fmt.Errorf("failed to write data block: %w", err)
+	// Send the data to the handler in chunks as it is read
+	l.validator.reset()
+	chunk := make([]byte, streamChunkSize)
+	for offset := uint32(0); ; {
+		n, err := io.ReadFull(l.reader, chunk)
+		if n > 0 {
+			// The whole data is one block
+			if err := l.validator.checkSize(uint64(offset)+uint64(n), "after the header"); err != nil {
+				return err
+			}
+			if err := l.validator.check(address+offset, n, fmt.Sprintf("at offset %d", protocol.PGXOffData+int(offset))); err != nil {
+				return err
+			}
+			if err := l.handler(address+offset, append([]byte(nil), chunk[:n]...)); err != nil {
+				return fmt.Errorf("failed to write data block: %w", err)
+			}
+			offset += uint32(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
 	}
 
 	// Set up CPU-specific reset vectors
@@ -94,27 +108,94 @@ func (l *PGXLoader) Process() error {
 	return nil
 }
 
+// parsePGXHeader checks the header of a PGX file and returns its CPU type and
+// load address
+func parsePGXHeader(data []byte) (byte, uint32, error) {
+	// Check minimum size (signature + version + address = 8 bytes)
+	if len(data) < protocol.PGXOffData {
+		return 0, 0, formatErrorf("file too small to be valid PGX")
+	}
+
+	// Check signature
+	signature := data[protocol.PGXOffSigStart:protocol.PGXOffSigEnd]
+	if string(signature) != "PGX" {
+		return 0, 0, formatErrorf("bad PGX signature: %s", signature)
+	}
+
+	// Check version
+	versionByte := data[protocol.PGXOffVersion]
+	pgxVersion := (versionByte >> 4) & 0x0F
+	if pgxVersion > 0 {
+		return 0, 0, formatErrorf("unsupported PGX version: %d", pgxVersion)
+	}
+
+	// Get target address (32-bit little-endian)
+	address := binary.LittleEndian.Uint32(data[protocol.PGXOffAddrStart:protocol.PGXOffAddrEnd])
+	return versionByte & 0x0F, address, nil
+}
+
 // verifyCPUCompatibility checks if the PGX file matches the configured CPU
 func (l *PGXLoader) verifyCPUCompatibility(pgxCPU byte) error {
 	switch pgxCPU {
 	case protocol.PGXcpu65816:
-		if l.config.CPU != "65816" {
-			return fmt.Errorf("PGX is built for 65816, but CPU is configured as %s", l.config.CPU)
+		if !cpu.IsFamily(l.config.CPU, cpu.Family65816) {
+			return formatErrorf("PGX is built for 65816, but CPU is configured as %s", l.config.CPU)
 		}
 
 	case protocol.PGXcpu65C02:
-		if l.config.CPU != "65C02" && l.config.CPU != "65c02" {
-			return fmt.Errorf("PGX is built for 65C02, but CPU is configured as %s", l.config.CPU)
+		if !cpu.IsFamily(l.config.CPU, cpu.Family65C02) {
+			return formatErrorf("PGX is built for 65C02, but CPU is configured as %s", l.config.CPU)
 		}
 
 	case protocol.PGXcpu680X0:
 		if !l.config.CPUIsMotorolatype680X0() {
-			return fmt.Errorf("PGX is built for 680x0, but CPU is configured as %s", l.config.CPU)
+			return formatErrorf("PGX is built for 680x0, but CPU is configured as %s", l.config.CPU)
+		}
+
+	case protocol.PGXcpu6809:
+		if !cpu.IsFamily(l.config.CPU, cpu.Family6809) {
+			return formatErrorf("PGX is built for 6809, but CPU is configured as %s", l.config.CPU)
 		}
 
 	default:
-		return fmt.Errorf("unsupported PGX CPU type: 0x%02X", pgxCPU)
+		return formatErrorf("unsupported PGX CPU type: 0x%02X", pgxCPU)
 	}
 
 	return nil
 }
+
+// pgxCPUTypes are the PGX header CPU types of the CPU families. The PGX format
+// has no type for the 6809.
+var pgxCPUTypes = map[cpu.Family]byte{
+	cpu.Family65816: protocol.PGXcpu65816,
+	cpu.Family65C02: protocol.PGXcpu65C02,
+	cpu.Family680X0: protocol.PGXcpu680X0,
+}
+
+// PGXCPUType returns the PGX header CPU type for a configured CPU name
+func PGXCPUType(cpuName string) (byte, error) {
+	c, err := cpu.Lookup(cpuName)
+	if err != nil {
+		return 0, fmt.Errorf("no PGX CPU type for CPU %s", cpuName)
+	}
+	cpuType, ok := pgxCPUTypes[c.Family()]
+	if !ok {
+		return 0, fmt.Errorf("the PGX format has no CPU type for CPU %s", cpuName)
+	}
+	return cpuType, nil
+}
+
+// WritePGX writes data as a PGX file for the given PGX CPU type. A PGX file
+// holds a single block and is started at the address it is loaded to.
+func WritePGX(w io.Writer, cpuType byte, address uint32, data []byte) error {
+	header := make([]byte, protocol.PGXOffData)
+	copy(header[protocol.PGXOffSigStart:protocol.PGXOffSigEnd], "PGX")
+	header[protocol.PGXOffVersion] = cpuType & 0x0F // Version 0
+	binary.LittleEndian.PutUint32(header[protocol.PGXOffAddrStart:protocol.PGXOffAddrEnd], address)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
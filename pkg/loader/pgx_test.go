@@ -0,0 +1,93 @@
+package loader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+func TestWritePGXRoundTrip(t *testing.T) {
+	cpuType, err := PGXCPUType("65C02")
+	if err != nil {
+		t.Fatalf("PGXCPUType() error: %v", err)
+	}
+
+	data := []byte{0xA9, 0x42, 0x8D, 0x00, 0x40, 0x60}
+	var buf bytes.Buffer
+	if err := WritePGX(&buf, cpuType, 0x0800, data); err != nil {
+		t.Fatalf("WritePGX() error: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "test.pgx")
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	memory := collectBlocks(t, NewPGXLoader(&config.Config{CPU: "65C02"}), filename)
+	for i, want := range data {
+		if got := memory[0x0800+uint32(i)]; got != want {
+			t.Fatalf("memory[0x%X] = %02X, want %02X", 0x0800+i, got, want)
+		}
+	}
+	if memory[0xFFFC] != 0x00 || memory[0xFFFD] != 0x08 {
+		t.Errorf("reset vector = %02X%02X, want 0800", memory[0xFFFD], memory[0xFFFC])
+	}
+}
+
+func TestPGX6809ResetVector(t *testing.T) {
+	// Type 4 isn't in the PGX format, but such files are still loaded
+	var buf bytes.Buffer
+	if err := WritePGX(&buf, protocol.PGXcpu6809, 0x2000, []byte{0x12}); err != nil {
+		t.Fatalf("WritePGX() error: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "test.pgx")
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// The 6809 reset vector is big-endian at $FFFE
+	memory := collectBlocks(t, NewPGXLoader(&config.Config{CPU: "6809"}), filename)
+	if memory[0xFFFE] != 0x20 || memory[0xFFFF] != 0x00 {
+		t.Errorf("reset vector = %02X%02X, want 2000", memory[0xFFFE], memory[0xFFFF])
+	}
+
+	// A 65C02 can't run it
+	ldr := NewPGXLoader(&config.Config{CPU: "65c02"})
+	if err := ldr.Open(filename); err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	ldr.SetHandler(func(uint32, []byte) error { return nil })
+	if err := ldr.Process(); err == nil {
+		t.Error("Process() with a 65C02 CPU succeeded, want a CPU mismatch error")
+	}
+}
+
+func TestPGXCPUType(t *testing.T) {
+	tests := []struct {
+		cpu     string
+		want    byte
+		wantErr bool
+	}{
+		{"65816", 0x01, false},
+		{"65c02", 0x03, false},
+		{"68040", 0x02, false},
+		{"6809", 0, true},
+		{"z80", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cpu, func(t *testing.T) {
+			got, err := PGXCPUType(tt.cpu)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PGXCPUType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PGXCPUType() = %02X, want %02X", got, tt.want)
+			}
+		})
+	}
+}
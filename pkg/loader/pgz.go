@@ -1,8 +1,9 @@
 package loader
 
 import (
+	"bufio"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/daschewie/foenixmgr/pkg/config"
 )
@@ -11,11 +12,12 @@ import (
 // PGZ format: header byte ('z'=4-byte addr/size, 'Z'=3-byte) + blocks
 // Each block: address + size + data
 // Special: size=0 with addr>0 indicates start address
+// The file is read as a stream, so it can come from a pipe and only one
+// chunk of a block is held in memory at a time.
 type PGZLoader struct {
 	BaseLoader
-	data        []byte
-	config      *config.Config
-	addressSize int
+	stream *blockStream
+	config *config.Config
 }
 
 // NewPGZLoader creates a new PGZ loader
@@ -27,39 +29,59 @@ func NewPGZLoader(cfg *config.Config) *PGZLoader {
 
 // Open opens a PGZ file
 func (l *PGZLoader) Open(filename string) error {
-	data, err := os.ReadFile(filename)
+	input, err := openInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
+	if err := l.OpenReader(input); err != nil {
+		input.Close()
+		return err
+	}
+	l.input = input
+	return nil
+}
 
-	// Check minimum size
-	if len(data) < 1 {
-		return fmt.Errorf("file too small to be valid PGZ")
+// OpenReader reads a PGZ file from r, checking its header byte
+func (l *PGZLoader) OpenReader(r io.Reader) error {
+	stream, err := openPGZStream(r)
+	if err != nil {
+		return err
+	}
+	l.stream = stream
+	return nil
+}
+
+// openPGZStream reads the header byte of a PGZ file and returns a stream of
+// its blocks
+func openPGZStream(r io.Reader) (*blockStream, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadByte()
+	if err == io.EOF {
+		return nil, formatErrorf("file too small to be valid PGZ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
 	// Determine address size from header byte
-	switch data[0] {
+	switch header {
 	case 0x7A: // 'z' - 4-byte address and size fields
-		l.addressSize = 4
+		return newBlockStream(br, 4, 1), nil
 	case 0x5A: // 'Z' - 3-byte address and size fields
-		l.addressSize = 3
-	default:
-		return fmt.Errorf("invalid PGZ header: 0x%02X (expected 0x7A or 0x5A)", data[0])
+		return newBlockStream(br, 3, 1), nil
 	}
-
-	l.data = data
-	return nil
+	return nil, formatErrorf("invalid PGZ header: 0x%02X (expected 0x7A or 0x5A)", header)
 }
 
-// Close closes the PGZ file (no-op for memory-loaded file)
+// Close closes the PGZ file
 func (l *PGZLoader) Close() error {
-	l.data = nil
-	return nil
+	l.stream = nil
+	return l.BaseLoader.Close()
 }
 
 // Process reads and parses the PGZ file
 func (l *PGZLoader) Process() error {
-	if l.data == nil {
+	if l.stream == nil {
 		return fmt.Errorf("file not open")
 	}
 
@@ -67,23 +89,25 @@ func (l *PGZLoader) Process() error {
 		return fmt.Errorf("handler not set")
 	}
 
-	offset := 1 // Skip header byte
+	l.validator.reset()
 
-	for offset < len(l.data) {
-		address, block, newOffset, err := l.readBlock(offset)
+	for {
+		blockOffset := l.stream.offset
+		address, size, err := l.stream.header()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 
-		offset = newOffset
-
 		// Check for terminator (address == 0)
 		if address == 0 {
-			break
+			return nil
 		}
 
 		// Check for start address block (size == 0, address > 0)
-		if len(block) == 0 && address > 0 {
+		if size == 0 {
 			// Set up CPU-specific reset vectors
 			if err := SetupResetVectors(l.config.CPU, address, l.handler); err != nil {
 				return fmt.Errorf("failed to set up reset vectors: %w", err)
@@ -91,85 +115,74 @@ func (l *PGZLoader) Process() error {
 			continue
 		}
 
-		// Regular data block
-		if address > 0 {
-			// Support for large blocks: chunk into 1KB pieces
-			const chunkSize = 1024
-			if len(block) > chunkSize {
-				totalLength := len(block)
-				chunkOffset := 0
-
-				for totalLength > 0 {
-					currentChunkSize := chunkSize
-					if totalLength < chunkSize {
-						currentChunkSize = totalLength
-					}
-
-					chunk := block[chunkOffset : chunkOffset+currentChunkSize]
-					if err := l.handler(address+uint32(chunkOffset), chunk); err != nil {
-						return fmt.Errorf("failed to write chunk at 0x%X: %w", address+uint32(chunkOffset), err)
-					}
-
-					totalLength -= currentChunkSize
-					chunkOffset += currentChunkSize
-				}
-			} else {
-				// Small block, send directly
-				if err := l.handler(address, block); err != nil {
-					return fmt.Errorf("failed to write block at 0x%X: %w", address, err)
-				}
-			}
+		// Regular data block, passed on in 1KB chunks as it is read
+		if err := l.validator.check(address, int(size), fmt.Sprintf("at offset %d", blockOffset)); err != nil {
+			return err
+		}
+		if err := l.stream.copy(address, size, l.handler); err != nil {
+			return err
 		}
 	}
+}
 
-	return nil
+// Segment is a block of data to be loaded at an address
+type Segment struct {
+	Address uint32
+	Data    []byte
 }
 
-// readBlock reads a single block from the PGZ file
-// Returns: address, data block, new offset, error
-func (l *PGZLoader) readBlock(offset int) (uint32, []byte, int, error) {
-	// Need address + size fields (addressSize bytes each)
-	requiredBytes := l.addressSize * 2
-	if offset+requiredBytes > len(l.data) {
-		return 0, nil, offset, fmt.Errorf("unexpected end of file at offset %d", offset)
+// WritePGZ writes segments and a start address as a PGZ file. The 3-byte
+// ('Z') format is used when every address and size fits in 24 bits, otherwise
+// the 4-byte ('z') format is used.
+func WritePGZ(w io.Writer, segments []Segment, start uint32) error {
+	addressSize := 3
+	if start > 0xFFFFFF {
+		addressSize = 4
 	}
-
-	// Read address (little-endian)
-	address := l.readLittleEndianInt(l.data[offset:], l.addressSize)
-	offset += l.addressSize
-
-	// Read size (little-endian)
-	size := l.readLittleEndianInt(l.data[offset:], l.addressSize)
-	offset += l.addressSize
-
-	// If address is 0, this is the terminator
-	if address == 0 {
-		return 0, nil, offset, nil
+	for _, seg := range segments {
+		if seg.Address == 0 {
+			return formatErrorf("PGZ cannot load a segment at address 0")
+		}
+		if len(seg.Data) == 0 {
+			return formatErrorf("segment at 0x%X is empty", seg.Address)
+		}
+		end := uint64(seg.Address) + uint64(len(seg.Data)) - 1
+		if end > 0xFFFFFFFF {
+			return formatErrorf("segment at 0x%X extends past the 32-bit address space", seg.Address)
+		}
+		if end > 0xFFFFFF {
+			addressSize = 4
+		}
 	}
 
-	// If size is 0, this is a start address block (no data)
-	if size == 0 {
-		return address, nil, offset, nil
+	header := byte(0x5A) // 'Z'
+	if addressSize == 4 {
+		header = 0x7A // 'z'
 	}
-
-	// Read data block
-	if offset+int(size) > len(l.data) {
-		return 0, nil, offset, fmt.Errorf("data block exceeds file size at offset %d", offset)
+	if _, err := w.Write([]byte{header}); err != nil {
+		return err
 	}
 
-	block := make([]byte, size)
-	copy(block, l.data[offset:offset+int(size)])
-
-	offset += int(size)
+	for _, seg := range segments {
+		if err := writePGZBlockHeader(w, addressSize, seg.Address, uint32(len(seg.Data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(seg.Data); err != nil {
+			return err
+		}
+	}
 
-	return address, block, offset, nil
+	// A block with no data marks the start address
+	return writePGZBlockHeader(w, addressSize, start, 0)
 }
 
-// readLittleEndianInt reads a little-endian integer of the specified byte count
-func (l *PGZLoader) readLittleEndianInt(data []byte, byteCount int) uint32 {
-	var value uint32
-	for i := 0; i < byteCount && i < len(data); i++ {
-		value |= uint32(data[i]) << (i * 8)
+// writePGZBlockHeader writes the little-endian address and size fields of a block
+func writePGZBlockHeader(w io.Writer, addressSize int, address uint32, size uint32) error {
+	fields := make([]byte, addressSize*2)
+	for i := 0; i < addressSize; i++ {
+		fields[i] = byte(address >> (i * 8))
+		fields[addressSize+i] = byte(size >> (i * 8))
 	}
-	return value
+	_, err := w.Write(fields)
+	return err
 }
@@ -0,0 +1,77 @@
+package loader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestWritePGZRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		segments   []Segment
+		start      uint32
+		wantHeader byte
+	}{
+		{
+			"Single segment",
+			[]Segment{{0x2000, []byte{0xA9, 0x01, 0x60}}},
+			0x2000,
+			'Z',
+		},
+		{
+			"Multiple segments",
+			[]Segment{{0x2000, []byte{0xEA, 0xEA}}, {0x10000, bytes.Repeat([]byte{0x55}, 3000)}},
+			0x2000,
+			'Z',
+		},
+		{
+			"32-bit addresses",
+			[]Segment{{0x01000000, []byte{0x4E, 0x71}}},
+			0x01000000,
+			'z',
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WritePGZ(&buf, tt.segments, tt.start); err != nil {
+				t.Fatalf("WritePGZ() error: %v", err)
+			}
+			if buf.Bytes()[0] != tt.wantHeader {
+				t.Errorf("header = %c, want %c", buf.Bytes()[0], tt.wantHeader)
+			}
+
+			filename := filepath.Join(t.TempDir(), "test.pgz")
+			if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			memory := collectBlocks(t, NewPGZLoader(&config.Config{CPU: "68040"}), filename)
+			for _, seg := range tt.segments {
+				for i, want := range seg.Data {
+					if got := memory[seg.Address+uint32(i)]; got != want {
+						t.Fatalf("memory[0x%X] = %02X, want %02X", seg.Address+uint32(i), got, want)
+					}
+				}
+			}
+
+			// The 680x0 reset vector holds the big-endian start address
+			pc := uint32(memory[4])<<24 | uint32(memory[5])<<16 | uint32(memory[6])<<8 | uint32(memory[7])
+			if pc != tt.start {
+				t.Errorf("start address = 0x%X, want 0x%X", pc, tt.start)
+			}
+		})
+	}
+}
+
+func TestWritePGZRejectsAddressZero(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePGZ(&buf, []Segment{{0, []byte{0x00}}}, 0x100); err == nil {
+		t.Error("WritePGZ() expected error for segment at address 0")
+	}
+}
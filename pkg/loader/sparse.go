@@ -0,0 +1,62 @@
+package loader
+
+// DefaultMinRun is the shortest run of the skipped value SparseWriter leaves
+// out. Shorter runs cost less to send than the extra request they would need.
+const DefaultMinRun = 32
+
+// SparseWriter passes blocks on to a handler, leaving out runs of one byte
+// value. It is used to upload to memory that already holds that value, e.g.
+// RAM cleared with 'fill', so long runs of it don't need to be sent.
+type SparseWriter struct {
+	Handler WriteHandler
+	Skip    byte // Value whose runs are left out
+	MinRun  int  // Shortest run left out (DefaultMinRun if zero)
+
+	Written int // Bytes passed to the handler
+	Skipped int // Bytes left out
+}
+
+// Write is a WriteHandler that writes data except for long runs of Skip
+func (s *SparseWriter) Write(address uint32, data []byte) error {
+	minRun := s.MinRun
+	if minRun <= 0 {
+		minRun = DefaultMinRun
+	}
+
+	start := 0 // Start of the data not written yet
+	for i := 0; i < len(data); {
+		if data[i] != s.Skip {
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(data) && data[end] == s.Skip {
+			end++
+		}
+		if end-i < minRun {
+			i = end
+			continue
+		}
+
+		if i > start {
+			if err := s.write(address+uint32(start), data[start:i]); err != nil {
+				return err
+			}
+		}
+		s.Skipped += end - i
+		start = end
+		i = end
+	}
+
+	if start < len(data) {
+		return s.write(address+uint32(start), data[start:])
+	}
+	return nil
+}
+
+// write passes one block to the handler
+func (s *SparseWriter) write(address uint32, data []byte) error {
+	s.Written += len(data)
+	return s.Handler(address, data)
+}
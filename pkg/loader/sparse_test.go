@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSparseWriter(t *testing.T) {
+	data := append(append(append(
+		[]byte{1, 2, 3},
+		bytes.Repeat([]byte{0xFF}, 40)...),
+		4, 0xFF, 0xFF, 5),
+		bytes.Repeat([]byte{0xFF}, 32)...)
+
+	type block struct {
+		address uint32
+		data    []byte
+	}
+	var blocks []block
+	s := &SparseWriter{
+		Handler: func(address uint32, data []byte) error {
+			blocks = append(blocks, block{address, append([]byte(nil), data...)})
+			return nil
+		},
+		Skip: 0xFF,
+	}
+
+	if err := s.Write(0x1000, data); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	// The 40 and 32 byte runs are skipped, the short run in the middle is sent
+	want := []block{
+		{0x1000, []byte{1, 2, 3}},
+		{0x1000 + 43, []byte{4, 0xFF, 0xFF, 5}},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %v", len(blocks), len(want), blocks)
+	}
+	for i := range want {
+		if blocks[i].address != want[i].address || !bytes.Equal(blocks[i].data, want[i].data) {
+			t.Errorf("block %d = %X % X, want %X % X", i, blocks[i].address, blocks[i].data, want[i].address, want[i].data)
+		}
+	}
+	if s.Written != 7 || s.Skipped != 72 {
+		t.Errorf("written %d, skipped %d; want 7, 72", s.Written, s.Skipped)
+	}
+}
+
+func TestSparseWriterAllSkipped(t *testing.T) {
+	calls := 0
+	s := &SparseWriter{
+		Handler: func(address uint32, data []byte) error { calls++; return nil },
+		Skip:    0x00,
+		MinRun:  4,
+	}
+	if err := s.Write(0, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 || s.Skipped != 100 {
+		t.Errorf("calls %d, skipped %d; want 0, 100", calls, s.Skipped)
+	}
+}
@@ -3,7 +3,7 @@ package loader
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 	"strconv"
 )
@@ -11,6 +11,8 @@ import (
 // SRecLoader loads Motorola SREC format files
 type SRecLoader struct {
 	BaseLoader
+	startAddress uint32
+	hasStart     bool
 }
 
 // NewSRecLoader creates a new SREC loader
@@ -20,11 +22,21 @@ func NewSRecLoader() *SRecLoader {
 
 // Open opens a Motorola SREC file
 func (l *SRecLoader) Open(filename string) error {
-	file, err := os.Open(filename)
+	input, err := openInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
-	l.file = file
+	l.input = input
+	l.startAddress = 0
+	l.hasStart = false
+	return nil
+}
+
+// OpenReader reads a Motorola SREC file from r
+func (l *SRecLoader) OpenReader(r io.Reader) error {
+	l.input = io.NopCloser(r)
+	l.startAddress = 0
+	l.hasStart = false
 	return nil
 }
 
@@ -33,7 +45,7 @@ func (l *SRecLoader) Open(filename string) error {
 // Types: S0=header, S1=16-bit addr, S2=24-bit addr, S3=32-bit addr,
 //        S7=32-bit start, S8=24-bit start, S9=16-bit start
 func (l *SRecLoader) Process() error {
-	if l.file == nil {
+	if l.input == nil {
 		return fmt.Errorf("file not open")
 	}
 
@@ -44,7 +56,8 @@ func (l *SRecLoader) Process() error {
 	// Regex pattern for SREC records
 	pattern := regexp.MustCompile(`^S([0-9a-fA-F])([0-9a-fA-F]+)`)
 
-	scanner := bufio.NewScanner(l.file)
+	l.validator.reset()
+	scanner := bufio.NewScanner(l.input)
 	lineNum := 0
 
 	for scanner.Scan() {
@@ -59,7 +72,7 @@ func (l *SRecLoader) Process() error {
 		// Parse the record type
 		matches := pattern.FindStringSubmatch(line)
 		if matches == nil {
-			return fmt.Errorf("invalid SREC format at line %d: %s", lineNum, line)
+			return formatErrorf("invalid SREC format at line %d: %s", lineNum, line)
 		}
 
 		recordType, _ := strconv.ParseUint(matches[1], 16, 8)
@@ -90,11 +103,13 @@ func (l *SRecLoader) Process() error {
 		case 5, 6: // Record count - ignore
 			continue
 
-		case 7, 8, 9: // Start address - ignore (not data)
-			continue
+		case 7, 8, 9: // Start address (32, 24 or 16-bit)
+			if err := l.parseStartRecord(hexDigits, int(11-recordType), lineNum); err != nil {
+				return err
+			}
 
 		default:
-			return fmt.Errorf("unsupported SREC type S%d at line %d", recordType, lineNum)
+			return formatErrorf("unsupported SREC type S%d at line %d", recordType, lineNum)
 		}
 	}
 
@@ -114,7 +129,7 @@ func (l *SRecLoader) parseDataRecord(hexDigits string, addressBytes int, lineNum
 	// Data is remainder minus checksum (2 hex digits)
 
 	if len(hexDigits) < 2+addressBytes*2+2 {
-		return fmt.Errorf("SREC record too short at line %d", lineNum)
+		return formatErrorf("SREC record too short at line %d", lineNum)
 	}
 
 	// Parse count (includes address, data, and checksum bytes)
@@ -133,7 +148,11 @@ func (l *SRecLoader) parseDataRecord(hexDigits string, addressBytes int, lineNum
 	// Convert hex data to bytes
 	data, err := hexStringToBytes(dataHex)
 	if err != nil {
-		return fmt.Errorf("invalid data at line %d: %w", lineNum, err)
+		return formatErrorf("invalid data at line %d: %w", lineNum, err)
+	}
+
+	if err := l.validator.check(uint32(address), len(data), fmt.Sprintf("at line %d", lineNum)); err != nil {
+		return err
 	}
 
 	// Send to handler
@@ -143,3 +162,81 @@ func (l *SRecLoader) parseDataRecord(hexDigits string, addressBytes int, lineNum
 
 	return nil
 }
+
+// parseStartRecord parses an SREC start address record
+// addressBytes: 4 for S7, 3 for S8, 2 for S9
+func (l *SRecLoader) parseStartRecord(hexDigits string, addressBytes int, lineNum int) error {
+	if len(hexDigits) < 2+addressBytes*2+2 {
+		return formatErrorf("SREC record too short at line %d", lineNum)
+	}
+
+	address, err := strconv.ParseUint(hexDigits[2:2+addressBytes*2], 16, 32)
+	if err != nil {
+		return formatErrorf("invalid start address at line %d: %w", lineNum, err)
+	}
+
+	// Tools write a zero start address when there is no entry point
+	if address != 0 {
+		l.startAddress = uint32(address)
+		l.hasStart = true
+	}
+	return nil
+}
+
+// StartAddress returns the start address from the S7/S8/S9 record, if the
+// file had a non-zero one
+func (l *SRecLoader) StartAddress() (uint32, bool) {
+	return l.startAddress, l.hasStart
+}
+
+// WriteSRec writes data to w as Motorola SREC records starting at address
+// The narrowest record type that can hold the highest address is used
+// (S1/S9, S2/S8 or S3/S7), preceded by an S0 header record.
+func WriteSRec(w io.Writer, address uint32, data []byte) error {
+	const recordSize = 16
+
+	end := address
+	if len(data) > 0 {
+		end = address + uint32(len(data)) - 1
+	}
+
+	dataType, termType, addressBytes := 1, 9, 2
+	if end > 0xFFFFFF {
+		dataType, termType, addressBytes = 3, 7, 4
+	} else if end > 0xFFFF {
+		dataType, termType, addressBytes = 2, 8, 3
+	}
+
+	if err := writeSRecRecord(w, 0, 0, 2, []byte("foenixmgr")); err != nil {
+		return err
+	}
+
+	for offset := 0; offset < len(data); offset += recordSize {
+		size := recordSize
+		if remaining := len(data) - offset; remaining < size {
+			size = remaining
+		}
+		if err := writeSRecRecord(w, dataType, address+uint32(offset), addressBytes, data[offset:offset+size]); err != nil {
+			return err
+		}
+	}
+
+	return writeSRecRecord(w, termType, 0, addressBytes, nil)
+}
+
+// writeSRecRecord writes a single S<type><count><address><data><checksum> record
+func writeSRecRecord(w io.Writer, recordType int, address uint32, addressBytes int, data []byte) error {
+	record := []byte{byte(addressBytes + len(data) + 1)}
+	for i := addressBytes - 1; i >= 0; i-- {
+		record = append(record, byte(address>>(8*i)))
+	}
+	record = append(record, data...)
+
+	sum := byte(0)
+	for _, b := range record {
+		sum += b
+	}
+
+	_, err := fmt.Fprintf(w, "S%d%X%02X\n", recordType, record, ^sum)
+	return err
+}
@@ -0,0 +1,135 @@
+package loader
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSRecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		address    uint32
+		size       int
+		recordType string
+	}{
+		{"16-bit addresses", 0x1000, 20, "S1"},
+		{"24-bit addresses", 0x380000, 50, "S2"},
+		{"32-bit addresses", 0x01000000, 8, "S3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			for i := range data {
+				data[i] = byte(0xFF - i)
+			}
+
+			var buf bytes.Buffer
+			if err := WriteSRec(&buf, tt.address, data); err != nil {
+				t.Fatalf("WriteSRec() error: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if !strings.HasPrefix(lines[1], tt.recordType) {
+				t.Errorf("first data record = %s, want type %s", lines[1], tt.recordType)
+			}
+
+			filename := filepath.Join(t.TempDir(), "test.srec")
+			if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			memory := collectBlocks(t, NewSRecLoader(), filename)
+			if len(memory) != len(data) {
+				t.Fatalf("loaded %d bytes, want %d", len(memory), len(data))
+			}
+			for i, b := range data {
+				if got := memory[tt.address+uint32(i)]; got != b {
+					t.Errorf("byte at 0x%X = 0x%02X, want 0x%02X", tt.address+uint32(i), got, b)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSRecChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSRec(&buf, 0x0038, []byte{0x48, 0x65, 0x6C, 0x6C, 0x6F}); err != nil {
+		t.Fatalf("WriteSRec() error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// Sum of count, address and data is 0x234, so the checksum is ^0x34 = 0xCB
+	if lines[1] != "S108003848656C6C6FCB" {
+		t.Errorf("data record = %s, want S108003848656C6C6FCB", lines[1])
+	}
+	if lines[2] != "S9030000FC" {
+		t.Errorf("termination record = %s, want S9030000FC", lines[2])
+	}
+}
+
+func TestSRecStartAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    string
+		wantAddr  uint32
+		wantStart bool
+	}{
+		{"S9 16-bit", "S9031000EC", 0x1000, true},
+		{"S8 24-bit", "S804380000C3", 0x380000, true},
+		{"S7 32-bit", "S70501000000F9", 0x01000000, true},
+		{"Zero start", "S9030000FC", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.srec")
+			content := "S1050000EAEA25\n" + tt.record + "\n"
+			if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			ldr := NewSRecLoader()
+			collectBlocks(t, ldr, filename)
+
+			addr, ok := ldr.StartAddress()
+			if ok != tt.wantStart || addr != tt.wantAddr {
+				t.Errorf("StartAddress() = 0x%X, %v, want 0x%X, %v", addr, ok, tt.wantAddr, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestSRecStartAddressReset(t *testing.T) {
+	dir := t.TempDir()
+	withStart := filepath.Join(dir, "start.srec")
+	withoutStart := filepath.Join(dir, "nostart.srec")
+	if err := os.WriteFile(withStart, []byte("S1050000EAEA25\nS9031000EC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(withoutStart, []byte("S1050000EAEA25\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	ldr := NewSRecLoader()
+	collectBlocks(t, ldr, withStart)
+	if _, ok := ldr.StartAddress(); !ok {
+		t.Fatal("StartAddress() not set by the first file")
+	}
+
+	collectBlocks(t, ldr, withoutStart)
+	if addr, ok := ldr.StartAddress(); ok || addr != 0 {
+		t.Errorf("StartAddress() after Open = 0x%X, %v, want 0, false", addr, ok)
+	}
+
+	collectBlocks(t, ldr, withStart)
+	if err := ldr.OpenReader(strings.NewReader("S1050000EAEA25\n")); err != nil {
+		t.Fatalf("OpenReader() error: %v", err)
+	}
+	if addr, ok := ldr.StartAddress(); ok || addr != 0 {
+		t.Errorf("StartAddress() after OpenReader = 0x%X, %v, want 0, false", addr, ok)
+	}
+}
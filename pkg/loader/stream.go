@@ -0,0 +1,92 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+)
+
+// streamChunkSize is the most data read from a stream at once, and the size
+// of the blocks passed to the handler
+const streamChunkSize = 1024
+
+// openInput opens a file, standard input for util.Stdin or an http(s) URL
+func openInput(filename string) (io.ReadCloser, error) {
+	return util.OpenInput(filename, util.InputOptions{})
+}
+
+// blockStream reads the blocks of a PGZ or WDC file as they arrive: a
+// little-endian address and size of addressSize bytes each, followed by the
+// data. Only one chunk of data is held at a time.
+type blockStream struct {
+	r           *bufio.Reader
+	addressSize int
+	offset      int64 // Bytes read so far, for error messages
+}
+
+// newBlockStream returns a block stream on r, which has already been read up
+// to offset
+func newBlockStream(r *bufio.Reader, addressSize int, offset int64) *blockStream {
+	return &blockStream{r: r, addressSize: addressSize, offset: offset}
+}
+
+// header reads the address and size of the next block. It returns io.EOF if
+// the stream ends before the block.
+func (s *blockStream) header() (uint32, uint32, error) {
+	fields := make([]byte, s.addressSize*2)
+	n, err := io.ReadFull(s.r, fields)
+	if err == io.EOF {
+		return 0, 0, io.EOF
+	}
+	if err != nil {
+		return 0, 0, s.readError(err)
+	}
+	s.offset += int64(n)
+	return littleEndian(fields[:s.addressSize]), littleEndian(fields[s.addressSize:]), nil
+}
+
+// copy reads size bytes of block data and passes them to handler in chunks
+// of streamChunkSize bytes, starting at address
+func (s *blockStream) copy(address uint32, size uint32, handler WriteHandler) error {
+	for done := uint32(0); done < size; {
+		chunk := make([]byte, min(size-done, streamChunkSize))
+		if err := s.read(chunk); err != nil {
+			return err
+		}
+		if err := handler(address+done, chunk); err != nil {
+			return fmt.Errorf("failed to write chunk at 0x%X: %w", address+done, err)
+		}
+		done += uint32(len(chunk))
+	}
+	return nil
+}
+
+// read fills data from the stream
+func (s *blockStream) read(data []byte) error {
+	n, err := io.ReadFull(s.r, data)
+	if err != nil {
+		return s.readError(err)
+	}
+	s.offset += int64(n)
+	return nil
+}
+
+// readError explains an error reading the stream at the current offset. A
+// file that ends in the middle of a block is a format error.
+func (s *blockStream) readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return formatErrorf("unexpected end of file at offset %d", s.offset)
+	}
+	return fmt.Errorf("failed to read file at offset %d: %w", s.offset, err)
+}
+
+// littleEndian decodes a little-endian integer of up to 4 bytes
+func littleEndian(data []byte) uint32 {
+	var value uint32
+	for i, b := range data {
+		value |= uint32(b) << (i * 8)
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// streamReader is implemented by the loaders that read a file as a stream
+type streamReader interface {
+	Loader
+	OpenReader(r io.Reader) error
+}
+
+// streamBlocks loads a file from a pipe and returns the bytes passed to the
+// handler, checking that no write is larger than a stream chunk
+func streamBlocks(t *testing.T, ldr streamReader, data []byte) (int, error) {
+	t.Helper()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(data)
+		pw.Close()
+	}()
+	defer pr.Close()
+
+	if err := ldr.OpenReader(pr); err != nil {
+		return 0, err
+	}
+	total := 0
+	ldr.SetHandler(func(address uint32, block []byte) error {
+		if len(block) > streamChunkSize {
+			t.Fatalf("write of %d bytes at 0x%X, want at most %d", len(block), address, streamChunkSize)
+		}
+		total += len(block)
+		return nil
+	})
+	return total, ldr.Process()
+}
+
+func TestStreamingLoaders(t *testing.T) {
+	cfg := &config.Config{CPU: "68040"}
+	large := bytes.Repeat([]byte{0x4E, 0x71}, 1<<20)
+
+	var pgz bytes.Buffer
+	if err := WritePGZ(&pgz, []Segment{{0x100000, large}}, 0x100000); err != nil {
+		t.Fatalf("WritePGZ() error: %v", err)
+	}
+	var pgx bytes.Buffer
+	if err := WritePGX(&pgx, 0x02, 0x100000, large); err != nil {
+		t.Fatalf("WritePGX() error: %v", err)
+	}
+	wdc := append([]byte{'Z', 0x00, 0x00, 0x10, 0x00, 0x10, 0x00}, bytes.Repeat([]byte{0xEA}, 0x1000)...)
+
+	tests := []struct {
+		name string
+		ldr  streamReader
+		data []byte
+		want int
+	}{
+		// The reset vector adds 4 bytes on the 680x0
+		{"PGZ", NewPGZLoader(cfg), pgz.Bytes(), len(large) + 4},
+		{"PGX", NewPGXLoader(cfg), pgx.Bytes(), len(large) + 4},
+		{"WDC", NewWDCLoader(), wdc, 0x1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, err := streamBlocks(t, tt.ldr, tt.data)
+			if err != nil {
+				t.Fatalf("Process() error: %v", err)
+			}
+			if total != tt.want {
+				t.Errorf("loaded %d bytes, want %d", total, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	var pgz bytes.Buffer
+	if err := WritePGZ(&pgz, []Segment{{0x2000, make([]byte, 3000)}}, 0x2000); err != nil {
+		t.Fatalf("WritePGZ() error: %v", err)
+	}
+
+	for _, n := range []int{0, 3, 2000} {
+		_, err := streamBlocks(t, NewPGZLoader(&config.Config{CPU: "65c02"}), pgz.Bytes()[:n])
+		if !errors.Is(err, ErrFormat) {
+			t.Errorf("truncated to %d bytes: error = %v, want a format error", n, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// Limits bound what a single file may load, so a malformed file can't make a
+// loader allocate huge blocks or send writes outside the address space
+type Limits struct {
+	MaxBlockSize uint64 // Bytes in one block of the file
+	MaxTotalSize uint64 // Bytes in all blocks of the file
+	AddressLimit uint64 // Address just past the highest byte a block may reach
+}
+
+// DefaultLimits allow blocks anywhere in the 32-bit address space, up to
+// 16MB each and 64MB in all
+var DefaultLimits = Limits{
+	MaxBlockSize: 16 << 20,
+	MaxTotalSize: 64 << 20,
+	AddressLimit: 1 << 32,
+}
+
+// LimitsFor returns the default limits narrowed, when a target machine is
+// configured, to the 16MB the debug port's 24-bit addresses reach
+func LimitsFor(cfg *config.Config) Limits {
+	limits := DefaultLimits
+	if cfg != nil && cfg.Machine() != nil {
+		limits.AddressLimit = 1 << 24
+	}
+	return limits
+}
+
+// span is a range of loaded addresses, end exclusive
+type span struct {
+	start, end uint64
+}
+
+// validator checks the blocks of a file against its Limits as a loader reads
+// them: the size of each block before it is allocated, and its addresses,
+// the total size and overlaps with earlier blocks before it is written
+type validator struct {
+	limits *Limits
+	total  uint64
+	loaded []span // Merged and sorted
+}
+
+// SetLimits replaces the loader's limits (DefaultLimits unless set)
+func (b *BaseLoader) SetLimits(limits Limits) {
+	b.validator.limits = &limits
+}
+
+// reset forgets the blocks checked so far, for a new pass over a file
+func (v *validator) reset() {
+	v.total = 0
+	v.loaded = nil
+}
+
+// current returns the limits in effect
+func (v *validator) current() Limits {
+	if v.limits == nil {
+		return DefaultLimits
+	}
+	return *v.limits
+}
+
+// checkSize checks the size of a block before it is allocated. where tells
+// the position in the file for the error message.
+func (v *validator) checkSize(size uint64, where string) error {
+	if limit := v.current().MaxBlockSize; size > limit {
+		return formatErrorf("block of %d bytes %s is larger than the limit of %d bytes", size, where, limit)
+	}
+	return nil
+}
+
+// check checks a block about to be written and records it
+func (v *validator) check(address uint32, length int, where string) error {
+	limits := v.current()
+	start := uint64(address)
+	end := start + uint64(length)
+
+	if err := v.checkSize(uint64(length), where); err != nil {
+		return err
+	}
+	if end > limits.AddressLimit {
+		return formatErrorf("block at 0x%X %s ends at 0x%X, beyond the address space", address, where, end-1)
+	}
+	if v.total+uint64(length) > limits.MaxTotalSize {
+		return formatErrorf("file loads more than the limit of %d bytes (%s)", limits.MaxTotalSize, where)
+	}
+	if length == 0 {
+		return nil
+	}
+	if at, overlaps := v.add(span{start, end}); overlaps {
+		return formatErrorf("block at 0x%X %s overlaps data loaded earlier at 0x%X", address, where, at)
+	}
+	v.total += uint64(length)
+	return nil
+}
+
+// add records a span of loaded addresses, merging it with the spans it
+// touches. If it overlaps a loaded span, nothing is recorded and the first
+// overlapping address is returned.
+func (v *validator) add(s span) (uint64, bool) {
+	i := sort.Search(len(v.loaded), func(i int) bool { return v.loaded[i].end > s.start })
+	if i < len(v.loaded) && v.loaded[i].start < s.end {
+		return max(v.loaded[i].start, s.start), true
+	}
+
+	v.loaded = slices.Insert(v.loaded, i, s)
+	if i > 0 && v.loaded[i-1].end == s.start {
+		v.loaded[i-1].end = s.end
+		v.loaded = slices.Delete(v.loaded, i, i+1)
+		i--
+	}
+	if i+1 < len(v.loaded) && v.loaded[i+1].start == v.loaded[i].end {
+		v.loaded[i].end = v.loaded[i+1].end
+		v.loaded = slices.Delete(v.loaded, i+1, i+2)
+	}
+	return 0, false
+}
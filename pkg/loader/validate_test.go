@@ -0,0 +1,107 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// processFile loads data as a file of the given format with limits, and
+// returns the error from Process
+func processFile(t *testing.T, format string, data []byte, limits Limits) error {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "test."+format)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	ldr, err := New(format, &config.Config{CPU: "65c02"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	ldr.SetLimits(limits)
+	if err := ldr.Open(filename); err != nil {
+		return err
+	}
+	defer ldr.Close()
+	ldr.SetHandler(func(address uint32, data []byte) error { return nil })
+	return ldr.Process()
+}
+
+func TestValidatorAdd(t *testing.T) {
+	var v validator
+	for _, s := range []span{{0x100, 0x110}, {0x120, 0x130}, {0x110, 0x120}, {0x200, 0x210}} {
+		if _, overlaps := v.add(s); overlaps {
+			t.Fatalf("add(%X-%X) overlaps", s.start, s.end)
+		}
+	}
+	if len(v.loaded) != 2 || v.loaded[0] != (span{0x100, 0x130}) {
+		t.Errorf("loaded = %X, want touching spans merged", v.loaded)
+	}
+	if at, overlaps := v.add(span{0x1F0, 0x201}); !overlaps || at != 0x200 {
+		t.Errorf("add(1F0-201) = %X, %v, want overlap at 200", at, overlaps)
+	}
+}
+
+func TestLoaderLimits(t *testing.T) {
+	pgz := func(segments ...Segment) []byte {
+		var buf bytes.Buffer
+		if err := WritePGZ(&buf, segments, segments[0].Address); err != nil {
+			t.Fatalf("WritePGZ() error: %v", err)
+		}
+		return buf.Bytes()
+	}
+	small := Limits{MaxBlockSize: 0x100, MaxTotalSize: 0x180, AddressLimit: 1 << 24}
+
+	tests := []struct {
+		name    string
+		format  string
+		data    []byte
+		wantErr string
+	}{
+		{"Within limits", FormatPGZ, pgz(Segment{0x2000, make([]byte, 0x100)}), ""},
+		{"Block too large", FormatPGZ, pgz(Segment{0x2000, make([]byte, 0x101)}), "larger than the limit"},
+		{"Total too large", FormatPGZ, pgz(Segment{0x2000, make([]byte, 0x100)}, Segment{0x3000, make([]byte, 0x100)}), "more than the limit"},
+		{"Beyond address space", FormatPGZ, pgz(Segment{0xFFFFF0, make([]byte, 0x20)}), "beyond the address space"},
+		{"Overlap", FormatPGZ, pgz(Segment{0x2000, make([]byte, 0x10)}, Segment{0x2008, make([]byte, 0x10)}), "overlaps data loaded earlier at 0x2008"},
+		{"WDC block too large", FormatWDC, []byte{'Z', 0x00, 0x20, 0x00, 0xFF, 0xFF, 0xFF}, "larger than the limit"},
+		{"HEX overlap", FormatIntelHex, []byte(":022000000102DB\n:022001000102DA\n:00000001FF\n"), "overlaps data loaded earlier at 0x2001"},
+		{"SREC beyond address space", FormatSREC, []byte("S3070100000001020000\n"), "beyond the address space"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := processFile(t, tt.format, tt.data, small)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Process() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Process() error = %v, want %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, ErrFormat) {
+				t.Errorf("Process() error %v is not a format error", err)
+			}
+		})
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	if got := LimitsFor(config.Default()); got != DefaultLimits {
+		t.Errorf("LimitsFor() without a target = %+v, want the defaults", got)
+	}
+
+	cfg := config.Default()
+	if err := cfg.SetTarget("f256k"); err != nil {
+		t.Fatal(err)
+	}
+	if got := LimitsFor(cfg).AddressLimit; got != 1<<24 {
+		t.Errorf("LimitsFor(f256k).AddressLimit = 0x%X, want 0x1000000", got)
+	}
+}
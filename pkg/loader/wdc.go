@@ -1,8 +1,9 @@
 package loader
 
 import (
+	"bufio"
 	"fmt"
-	"os"
+	"io"
 )
 
 // WDCLoader loads WDCTools binary format files
@@ -11,9 +12,10 @@ import (
 //   3-byte length (little-endian)
 //   length bytes of data
 // Terminates when address == 0
+// Like PGZ files, the file is read as a stream.
 type WDCLoader struct {
 	BaseLoader
-	data []byte
+	stream *blockStream
 }
 
 // NewWDCLoader creates a new WDC binary loader
@@ -23,29 +25,51 @@ func NewWDCLoader() *WDCLoader {
 
 // Open opens a WDC binary file
 func (l *WDCLoader) Open(filename string) error {
-	data, err := os.ReadFile(filename)
+	input, err := openInput(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return err
 	}
-
-	// Verify signature
-	if len(data) < 1 || data[0] != 'Z' {
-		return fmt.Errorf("invalid WDC file: missing 'Z' signature")
+	if err := l.OpenReader(input); err != nil {
+		input.Close()
+		return err
 	}
+	l.input = input
+	return nil
+}
 
-	l.data = data
+// OpenReader reads a WDC binary file from r, checking its signature
+func (l *WDCLoader) OpenReader(r io.Reader) error {
+	stream, err := openWDCStream(r)
+	if err != nil {
+		return err
+	}
+	l.stream = stream
 	return nil
 }
 
-// Close closes the WDC file (no-op for memory-loaded file)
+// openWDCStream reads the signature of a WDC binary file and returns a
+// stream of its blocks
+func openWDCStream(r io.Reader) (*blockStream, error) {
+	br := bufio.NewReader(r)
+	signature, err := br.ReadByte()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err == io.EOF || signature != 'Z' {
+		return nil, formatErrorf("invalid WDC file: missing 'Z' signature")
+	}
+	return newBlockStream(br, 3, 1), nil
+}
+
+// Close closes the WDC file
 func (l *WDCLoader) Close() error {
-	l.data = nil
-	return nil
+	l.stream = nil
+	return l.BaseLoader.Close()
 }
 
 // Process reads and parses the WDC binary file
 func (l *WDCLoader) Process() error {
-	if l.data == nil {
+	if l.stream == nil {
 		return fmt.Errorf("file not open")
 	}
 
@@ -53,63 +77,30 @@ func (l *WDCLoader) Process() error {
 		return fmt.Errorf("handler not set")
 	}
 
-	offset := 1 // Skip 'Z' signature
+	l.validator.reset()
 
-	for offset < len(l.data) {
-		address, block, newOffset, err := l.readBlock(offset)
+	for {
+		blockOffset := l.stream.offset
+		address, length, err := l.stream.header()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 
-		offset = newOffset
-
 		// Terminate if address is 0
 		if address == 0 {
-			break
+			return nil
 		}
 
-		// Send block to handler
-		if err := l.handler(address, block); err != nil {
-			return fmt.Errorf("handler failed: %w", err)
+		if err := l.validator.check(address, int(length), fmt.Sprintf("at offset %d", blockOffset)); err != nil {
+			return err
 		}
-	}
 
-	return nil
-}
-
-// readBlock reads a single block from the WDC file
-func (l *WDCLoader) readBlock(offset int) (uint32, []byte, int, error) {
-	// Need at least 6 bytes for address (3) + length (3)
-	if offset+6 > len(l.data) {
-		return 0, nil, offset, fmt.Errorf("unexpected end of file at offset %d", offset)
-	}
-
-	// Read 3-byte address (little-endian)
-	address := uint32(l.data[offset]) |
-		uint32(l.data[offset+1])<<8 |
-		uint32(l.data[offset+2])<<16
-
-	// Read 3-byte length (little-endian)
-	length := uint32(l.data[offset+3]) |
-		uint32(l.data[offset+4])<<8 |
-		uint32(l.data[offset+5])<<16
-
-	offset += 6
-
-	// If address is 0, this is the terminator block
-	if address == 0 {
-		return 0, nil, offset, nil
-	}
-
-	// Read data block
-	if offset+int(length) > len(l.data) {
-		return 0, nil, offset, fmt.Errorf("data block exceeds file size at offset %d", offset)
+		// Send block to handler as it is read
+		if err := l.stream.copy(address, length, l.handler); err != nil {
+			return err
+		}
 	}
-
-	block := make([]byte, length)
-	copy(block, l.data[offset:offset+int(length)])
-
-	offset += int(length)
-
-	return address, block, offset, nil
 }
@@ -0,0 +1,288 @@
+// Package luascript runs Lua scripts against a machine, so hardware test
+// sequences and automated checks can be written without Go: poke registers,
+// read the results and assert their values
+package luascript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxRead is the most bytes a single read or dump returns, so a mistyped
+// count doesn't tie up the debug port for minutes
+const maxRead = 1 << 20
+
+// Target is the machine a script works on
+type Target interface {
+	// ReadMemory reads length bytes at address
+	ReadMemory(address uint32, length int) ([]byte, error)
+
+	// WriteMemory writes data at address
+	WriteMemory(address uint32, data []byte) error
+
+	// Resolve returns the address of a label or region name, or of a hex
+	// address given as a string
+	Resolve(name string) (uint32, error)
+
+	// Upload uploads a program file, picking the format from its extension
+	Upload(filename string) error
+
+	// StopCPU stops the CPU, StartCPU lets it run again
+	StopCPU() error
+	StartCPU() error
+}
+
+// Runner runs scripts
+type Runner struct {
+	Target Target
+
+	// Output receives print and dump output
+	Output io.Writer
+
+	// Args are the script's arguments, available to it as the table arg
+	Args []string
+
+	// Context stops a running script when it is done, e.g. on Ctrl+C
+	Context context.Context
+}
+
+// RunFile runs a Lua script file
+func (r *Runner) RunFile(filename string) error {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read script: %w", err)
+	}
+	return r.Run(string(source), filename)
+}
+
+// Run runs Lua source code. name is used in error messages.
+func (r *Runner) Run(source, name string) error {
+	L := lua.NewState()
+	defer L.Close()
+	if r.Context != nil {
+		L.SetContext(r.Context)
+	}
+	r.register(L)
+
+	fn, err := L.Load(strings.NewReader(source), name)
+	if err != nil {
+		return scriptError(err)
+	}
+	L.Push(fn)
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		if r.Context != nil && r.Context.Err() != nil {
+			return r.Context.Err()
+		}
+		return scriptError(err)
+	}
+	return nil
+}
+
+// scriptError returns the message of a Lua error without its stack trace,
+// e.g. "test.lua:12: border not set"
+func scriptError(err error) error {
+	if apiErr, ok := err.(*lua.ApiError); ok && apiErr.Object != nil {
+		return errors.New(apiErr.Object.String())
+	}
+	return err
+}
+
+// register adds the machine functions and the arg table to the state
+func (r *Runner) register(L *lua.LState) {
+	for name, fn := range map[string]lua.LGFunction{
+		"read":    r.read,
+		"write":   r.write,
+		"dump":    r.dump,
+		"upload":  r.upload,
+		"stop":    r.stop,
+		"start":   r.start,
+		"sleep":   sleep,
+		"address": r.address,
+		"print":   r.print,
+	} {
+		L.SetGlobal(name, L.NewFunction(fn))
+	}
+
+	args := L.NewTable()
+	for _, a := range r.Args {
+		args.Append(lua.LString(a))
+	}
+	L.SetGlobal("arg", args)
+}
+
+// checkAddress returns argument n as an address: a number, or a string
+// holding a label, region name or hex address
+func (r *Runner) checkAddress(L *lua.LState, n int) uint32 {
+	switch v := L.CheckAny(n).(type) {
+	case lua.LNumber:
+		if v < 0 || v > 0xFFFFFFFF || v != lua.LNumber(int64(v)) {
+			L.ArgError(n, fmt.Sprintf("invalid address %v", v))
+		}
+		return uint32(v)
+	case lua.LString:
+		addr, err := r.Target.Resolve(string(v))
+		if err != nil {
+			L.ArgError(n, err.Error())
+		}
+		return addr
+	}
+	L.ArgError(n, "address must be a number or a name")
+	return 0
+}
+
+// checkCount returns argument n as a byte count, defaulting to def
+func checkCount(L *lua.LState, n int, def int) int {
+	count := L.OptInt(n, def)
+	if count < 1 || count > maxRead {
+		L.ArgError(n, fmt.Sprintf("count must be between 1 and %d", maxRead))
+	}
+	return count
+}
+
+// fail raises err as a Lua error, so pcall can catch it
+func fail(L *lua.LState, err error) {
+	L.RaiseError("%s", err.Error())
+}
+
+// read(address) returns the byte at address; read(address, count) returns a
+// table of count bytes
+func (r *Runner) read(L *lua.LState) int {
+	addr := r.checkAddress(L, 1)
+	single := L.Get(2) == lua.LNil
+	count := checkCount(L, 2, 1)
+
+	data, err := r.Target.ReadMemory(addr, count)
+	if err != nil {
+		fail(L, err)
+	}
+	if single {
+		L.Push(lua.LNumber(data[0]))
+		return 1
+	}
+	t := L.CreateTable(len(data), 0)
+	for _, b := range data {
+		t.Append(lua.LNumber(b))
+	}
+	L.Push(t)
+	return 1
+}
+
+// write(address, ...) writes bytes given as numbers, tables of numbers or
+// strings, e.g. write(0xD000, 0x01) or write("vicky.border", {0, 0xFF, 0})
+func (r *Runner) write(L *lua.LState) int {
+	addr := r.checkAddress(L, 1)
+
+	var data []byte
+	appendByte := func(n int, v lua.LValue) {
+		num, ok := v.(lua.LNumber)
+		if !ok || num < 0 || num > 0xFF || num != lua.LNumber(int64(num)) {
+			L.ArgError(n, fmt.Sprintf("invalid byte %s", v.String()))
+		}
+		data = append(data, byte(num))
+	}
+	for n := 2; n <= L.GetTop(); n++ {
+		switch v := L.Get(n).(type) {
+		case lua.LString:
+			data = append(data, v...)
+		case *lua.LTable:
+			v.ForEach(func(_, value lua.LValue) { appendByte(n, value) })
+		default:
+			appendByte(n, v)
+		}
+	}
+	if len(data) == 0 {
+		L.ArgError(2, "nothing to write")
+	}
+
+	if err := r.Target.WriteMemory(addr, data); err != nil {
+		fail(L, err)
+	}
+	return 0
+}
+
+// dump(address [, count]) prints a hex dump of count bytes (default 16)
+func (r *Runner) dump(L *lua.LState) int {
+	addr := r.checkAddress(L, 1)
+	count := checkCount(L, 2, 16)
+
+	data, err := r.Target.ReadMemory(addr, count)
+	if err != nil {
+		fail(L, err)
+	}
+	util.FprintHexDump(r.output(), data, addr, nil)
+	return 0
+}
+
+// upload(file) uploads a program file
+func (r *Runner) upload(L *lua.LState) int {
+	if err := r.Target.Upload(L.CheckString(1)); err != nil {
+		fail(L, err)
+	}
+	return 0
+}
+
+// stop() stops the CPU
+func (r *Runner) stop(L *lua.LState) int {
+	if err := r.Target.StopCPU(); err != nil {
+		fail(L, err)
+	}
+	return 0
+}
+
+// start() lets the CPU run
+func (r *Runner) start(L *lua.LState) int {
+	if err := r.Target.StartCPU(); err != nil {
+		fail(L, err)
+	}
+	return 0
+}
+
+// address(name) returns the address of a label or region
+func (r *Runner) address(L *lua.LState) int {
+	L.Push(lua.LNumber(r.checkAddress(L, 1)))
+	return 1
+}
+
+// sleep(seconds) waits, e.g. sleep(0.5) for half a second
+func sleep(L *lua.LState) int {
+	d := time.Duration(float64(L.CheckNumber(1)) * float64(time.Second))
+	if d <= 0 {
+		return 0
+	}
+	ctx := L.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		fail(L, ctx.Err())
+	}
+	return 0
+}
+
+// print writes its arguments to Output, like Lua's print
+func (r *Runner) print(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	fmt.Fprintln(r.output(), strings.Join(parts, "\t"))
+	return 0
+}
+
+// output returns the writer for print and dump
+func (r *Runner) output() io.Writer {
+	if r.Output == nil {
+		return os.Stdout
+	}
+	return r.Output
+}
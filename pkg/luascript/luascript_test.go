@@ -0,0 +1,169 @@
+package luascript
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/util"
+)
+
+// fakeTarget is 64KB of memory with a few names
+type fakeTarget struct {
+	memory   [0x10000]byte
+	uploads  []string
+	stopped  bool
+	failRead bool
+}
+
+func (t *fakeTarget) ReadMemory(address uint32, length int) ([]byte, error) {
+	if t.failRead || int(address)+length > len(t.memory) {
+		return nil, fmt.Errorf("read failed at %06X", address)
+	}
+	return append([]byte(nil), t.memory[address:int(address)+length]...), nil
+}
+
+func (t *fakeTarget) WriteMemory(address uint32, data []byte) error {
+	if int(address)+len(data) > len(t.memory) {
+		return fmt.Errorf("write failed at %06X", address)
+	}
+	copy(t.memory[address:], data)
+	return nil
+}
+
+func (t *fakeTarget) Resolve(name string) (uint32, error) {
+	if name == "border" {
+		return 0xD004, nil
+	}
+	return util.ParseHexAddress(name)
+}
+
+func (t *fakeTarget) Upload(filename string) error {
+	t.uploads = append(t.uploads, filename)
+	return nil
+}
+
+func (t *fakeTarget) StopCPU() error {
+	t.stopped = true
+	return nil
+}
+
+func (t *fakeTarget) StartCPU() error {
+	t.stopped = false
+	return nil
+}
+
+// run runs source against target and returns its output
+func run(t *testing.T, target *fakeTarget, source string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	r := &Runner{Target: target, Output: &out, Args: args}
+	err := r.Run(source, "test.lua")
+	return out.String(), err
+}
+
+func TestReadWrite(t *testing.T) {
+	target := &fakeTarget{}
+	out, err := run(t, target, `
+write(0x2000, 1, 2, {3, 4}, "AB")
+write("border", 0x55)
+local d = read(0x2000, 6)
+assert(#d == 6 and d[1] == 1 and d[4] == 4 and d[6] == 0x42)
+assert(read("D004") == 0x55)
+assert(address("border") == 0xD004)
+print("ok", read(0x2001))
+`)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if out != "ok\t2\n" {
+		t.Errorf("output = %q", out)
+	}
+	if got := target.memory[0x2000:0x2006]; !bytes.Equal(got, []byte{1, 2, 3, 4, 'A', 'B'}) {
+		t.Errorf("memory = % X", got)
+	}
+}
+
+func TestDump(t *testing.T) {
+	target := &fakeTarget{}
+	copy(target.memory[0x100:], "Hello")
+	out, err := run(t, target, `dump(0x100, 5)`)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !strings.HasPrefix(out, "000100: 48 65 6C 6C 6F") || !strings.Contains(out, "| Hello") {
+		t.Errorf("dump output = %q", out)
+	}
+}
+
+func TestMachineFunctions(t *testing.T) {
+	target := &fakeTarget{}
+	if _, err := run(t, target, `stop() upload(arg[1])`, "game.pgz"); err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !target.stopped || len(target.uploads) != 1 || target.uploads[0] != "game.pgz" {
+		t.Errorf("target = stopped %v, uploads %v", target.stopped, target.uploads)
+	}
+	if _, err := run(t, target, `start()`); err != nil || target.stopped {
+		t.Errorf("start() = %v, stopped %v", err, target.stopped)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"assert", `assert(read(0) == 1, "expected 1")`, "test.lua:1: expected 1"},
+		{"syntax", `x = = 1`, "syntax error"},
+		{"bad address", `read(-1)`, "invalid address"},
+		{"bad name", `read("nowhere")`, "invalid"},
+		{"bad byte", `write(0, 256)`, "invalid byte"},
+		{"nothing to write", `write(0)`, "nothing to write"},
+		{"bad count", `read(0, 0)`, "count"},
+		{"target error", `read(0xFFFF, 2)`, "read failed at 00FFFF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(t, &fakeTarget{}, tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Run() error = %v, want %q", err, tt.want)
+			}
+			if err != nil && strings.Contains(err.Error(), "stack traceback") {
+				t.Errorf("Run() error has a stack trace: %v", err)
+			}
+		})
+	}
+}
+
+func TestPcallCatchesTargetErrors(t *testing.T) {
+	out, err := run(t, &fakeTarget{failRead: true}, `
+local ok, msg = pcall(read, 0)
+print(ok, msg)
+`)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if !strings.HasPrefix(out, "false\t") || !strings.Contains(out, "read failed") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r := &Runner{Target: &fakeTarget{}, Output: &bytes.Buffer{}, Context: ctx}
+
+	start := time.Now()
+	err := r.Run(`sleep(10)`, "test.lua")
+	if err != context.DeadlineExceeded {
+		t.Errorf("Run() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("sleep wasn't interrupted")
+	}
+}
@@ -0,0 +1,175 @@
+// Package macro stores macros: foenixmgr commands recorded as they are run,
+// kept as batch scripts in the user's config directory so they can be played
+// back over one connection, or edited into full scripts.
+package macro
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/script"
+)
+
+// Extension is the file extension of a macro
+const Extension = ".fnx"
+
+// recordingFile names the file in the macro directory holding the name of the
+// macro being recorded
+const recordingFile = "recording"
+
+// validName matches the names macros may have
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Dir returns the directory holding the macros. It is in the user's config
+// directory, so macros are shared by every working directory.
+func Dir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "foenixmgr", "macros")
+}
+
+// Path returns the file of a macro
+func Path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid macro name '%s' (use letters, digits, '.', '_' and '-')", name)
+	}
+	return filepath.Join(Dir(), name+Extension), nil
+}
+
+// Exists reports whether a macro has been recorded
+func Exists(name string) bool {
+	path, err := Path(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Start starts recording a macro, replacing a macro of the same name if
+// replace is true. A recording in progress is stopped.
+func Start(name string, replace bool) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+	if !replace && Exists(name) {
+		return fmt.Errorf("macro '%s' already exists (use --force to record it again)", name)
+	}
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("# foenixmgr macro '%s', recorded %s\n", name, time.Now().Format("2006-01-02 15:04"))
+	if err := os.WriteFile(path, []byte(header), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(Dir(), recordingFile), []byte(name+"\n"), 0644)
+}
+
+// Recording returns the name of the macro being recorded, if any
+func Recording() (string, bool) {
+	data, err := os.ReadFile(filepath.Join(Dir(), recordingFile))
+	if err != nil {
+		return "", false
+	}
+	name := strings.TrimSpace(string(data))
+	return name, name != ""
+}
+
+// Append adds a command, e.g. ["poke", "--address", "1000"], to the macro
+// being recorded. It does nothing if no macro is being recorded.
+func Append(command []string) error {
+	name, ok := Recording()
+	if !ok {
+		return nil
+	}
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, script.JoinWords(command)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Stop stops recording, returning the name of the macro that was being
+// recorded and the number of commands in it
+func Stop() (string, int, error) {
+	name, ok := Recording()
+	if !ok {
+		return "", 0, errors.New("no macro is being recorded")
+	}
+	if err := os.Remove(filepath.Join(Dir(), recordingFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", 0, err
+	}
+	commands, err := Count(name)
+	return name, commands, err
+}
+
+// Count returns the number of commands in a macro
+func Count(name string) (int, error) {
+	path, err := Path(name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s, err := script.Parse(f)
+	if err != nil {
+		return 0, fmt.Errorf("macro '%s': %w", name, err)
+	}
+	return len(s.Lines), nil
+}
+
+// List returns the names of the macros, sorted
+func List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(Dir(), "*"+Extension))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(file), Extension))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes a macro, stopping its recording if it is being recorded
+func Delete(name string) error {
+	path, err := Path(name)
+	if err != nil {
+		return err
+	}
+	if recording, ok := Recording(); ok && recording == name {
+		if _, _, err := Stop(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no macro named '%s'", name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package macro
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useTempDir puts the macro directory in a temporary directory
+func useTempDir(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+}
+
+func TestRecord(t *testing.T) {
+	useTempDir(t)
+
+	// Nothing is recorded until a macro is started
+	if err := Append([]string{"revision"}); err != nil {
+		t.Fatalf("Append() without a recording error: %v", err)
+	}
+	if _, ok := Recording(); ok {
+		t.Fatal("Recording() before Start")
+	}
+
+	if err := Start("setup", false); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if name, ok := Recording(); !ok || name != "setup" {
+		t.Fatalf("Recording() = %q, %v", name, ok)
+	}
+	Append([]string{"stop"})
+	Append([]string{"poke", "--address", "1000", "--data", "DE AD"})
+
+	name, commands, err := Stop()
+	if err != nil || name != "setup" || commands != 2 {
+		t.Fatalf("Stop() = %q, %d, %v, want setup with 2 commands", name, commands, err)
+	}
+	if _, ok := Recording(); ok {
+		t.Error("Recording() after Stop")
+	}
+	if _, _, err := Stop(); err == nil {
+		t.Error("Stop() without a recording expected error")
+	}
+
+	path, _ := Path("setup")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "stop\npoke --address 1000 --data \"DE AD\"\n") {
+		t.Errorf("macro file:\n%s", data)
+	}
+
+	// A macro isn't replaced by accident
+	if err := Start("setup", false); err == nil {
+		t.Error("Start() of an existing macro expected error")
+	}
+	if err := Start("setup", true); err != nil {
+		t.Errorf("Start() replacing a macro error: %v", err)
+	}
+	if _, commands, _ := Stop(); commands != 0 {
+		t.Errorf("replaced macro has %d commands, want 0", commands)
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	useTempDir(t)
+
+	names, err := List()
+	if err != nil || len(names) != 0 {
+		t.Fatalf("List() = %v, %v, want none", names, err)
+	}
+	for _, name := range []string{"boot-ram", "flash"} {
+		if err := Start(name, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, _ = List()
+	if !reflect.DeepEqual(names, []string{"boot-ram", "flash"}) {
+		t.Errorf("List() = %v", names)
+	}
+
+	// Deleting the macro being recorded stops the recording
+	if err := Delete("flash"); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, ok := Recording(); ok {
+		t.Error("still recording a deleted macro")
+	}
+	if Exists("flash") || !Exists("boot-ram") {
+		t.Error("Delete() removed the wrong macro")
+	}
+	if err := Delete("flash"); err == nil {
+		t.Error("Delete() of a missing macro expected error")
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	for _, name := range []string{"", "../escape", "a/b", ".hidden", "with space"} {
+		if _, err := Path(name); err == nil {
+			t.Errorf("Path(%q) expected error", name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package metrics writes metrics in the Prometheus text exposition format,
+// for the /metrics endpoints of the bridge and the web dashboard
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is a metric label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a metric with several, told apart by their labels
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Writer writes metrics, each with its HELP and TYPE lines. Write errors are
+// kept and returned by Err.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+// NewWriter returns a Writer to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Counter writes a counter, a value that only goes up
+func (m *Writer) Counter(name, help string, value float64, labels ...Label) {
+	m.write(name, "counter", help, []Sample{{labels, value}})
+}
+
+// Counters writes a counter with several samples
+func (m *Writer) Counters(name, help string, samples ...Sample) {
+	m.write(name, "counter", help, samples)
+}
+
+// Gauge writes a gauge, a value that goes up and down
+func (m *Writer) Gauge(name, help string, value float64, labels ...Label) {
+	m.write(name, "gauge", help, []Sample{{labels, value}})
+}
+
+// Timestamp writes a gauge holding a time as Unix seconds, or 0 for the zero
+// time
+func (m *Writer) Timestamp(name, help string, t time.Time, labels ...Label) {
+	value := 0.0
+	if !t.IsZero() {
+		value = float64(t.UnixNano()) / 1e9
+	}
+	m.Gauge(name, help, value, labels...)
+}
+
+// Err returns the first write error
+func (m *Writer) Err() error {
+	return m.err
+}
+
+// write writes one metric and its samples
+func (m *Writer) write(name, kind, help string, samples []Sample) {
+	if m.err != nil {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+	for _, s := range samples {
+		fmt.Fprintf(&b, "%s%s %s\n", name, formatLabels(s.Labels), formatValue(s.Value))
+	}
+	_, m.err = io.WriteString(m.w, b.String())
+}
+
+// formatLabels returns labels as {name="value",...}, or "" without labels
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, l.Name, escapeLabel(l.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// formatValue formats a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeHelp escapes a HELP line's text
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// Handler serves the metrics written by write at /metrics
+func Handler(write func(m *Writer)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		write(NewWriter(w))
+	}
+}
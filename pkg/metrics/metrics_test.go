@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var out strings.Builder
+	m := NewWriter(&out)
+	m.Counter("foenixmgr_bridge_requests_total", "Requests relayed", 42, Label{"serial_port", "/dev/ttyUSB0"})
+	m.Gauge("foenixmgr_bridge_clients", "Connected clients", 2)
+	m.Counters("foenixmgr_jobs_total", "Jobs",
+		Sample{[]Label{{"operation", "upload"}}, 3}, Sample{[]Label{{"operation", "flash"}}, 1})
+	m.Timestamp("foenixmgr_last_response_timestamp_seconds", "Time of the last response", time.Unix(1700000000, 500000000))
+	m.Timestamp("foenixmgr_never_seconds", "Never", time.Time{})
+	m.Gauge("odd", "Back\\slash\nnewline", math.Inf(1), Label{"name", `say "hi"`})
+	if err := m.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	want := `# HELP foenixmgr_bridge_requests_total Requests relayed
+# TYPE foenixmgr_bridge_requests_total counter
+foenixmgr_bridge_requests_total{serial_port="/dev/ttyUSB0"} 42
+# HELP foenixmgr_bridge_clients Connected clients
+# TYPE foenixmgr_bridge_clients gauge
+foenixmgr_bridge_clients 2
+# HELP foenixmgr_jobs_total Jobs
+# TYPE foenixmgr_jobs_total counter
+foenixmgr_jobs_total{operation="upload"} 3
+foenixmgr_jobs_total{operation="flash"} 1
+# HELP foenixmgr_last_response_timestamp_seconds Time of the last response
+# TYPE foenixmgr_last_response_timestamp_seconds gauge
+foenixmgr_last_response_timestamp_seconds 1.7000000005e+09
+# HELP foenixmgr_never_seconds Never
+# TYPE foenixmgr_never_seconds gauge
+foenixmgr_never_seconds 0
+# HELP odd Back\\slash\nnewline
+# TYPE odd gauge
+odd{name="say \"hi\""} +Inf
+`
+	if out.String() != want {
+		t.Errorf("metrics =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(func(m *Writer) { m.Gauge("up", "Up", 1) })(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %s, want %s", got, ContentType)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "\nup 1\n") {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
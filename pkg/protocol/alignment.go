@@ -1,13 +1,22 @@
 package protocol
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/cpu"
+)
 
 // WriteBlock32 writes data to a machine requiring 32-bit alignment (68040/68060)
-// If the address or data size is not 4-byte aligned, it performs a read-modify-write:
-//  1. Align address down to 4-byte boundary
-//  2. Read the aligned block from hardware memory
-//  3. Modify the specific bytes within the aligned buffer
+// If the address or data size is not 4-byte aligned, the partial words at
+// either end are read-modify-written:
+//  1. Widen the block to whole 4-byte words
+//  2. Read the first and last words from hardware memory, if only part of
+//     them is written
+//  3. Copy the new data into the aligned buffer
 //  4. Write the entire aligned block back
+//
+// Only the partial words are read, so a block that starts or ends off a word
+// boundary costs one small read rather than a read of the whole block.
 func (dp *DebugPort) WriteBlock32(address uint32, data []byte) error {
 	size := uint32(len(data))
 	addressAlign := address % 4
@@ -28,25 +37,76 @@ func (dp *DebugPort) WriteBlock32(address uint32, data []byte) error {
 		adjustedSize += (4 - sizeAlign)
 	}
 
-	// Read the current contents from the machine's RAM
-	block, err := dp.ReadBlock(adjustedAddress, uint16(adjustedSize))
-	if err != nil {
-		return fmt.Errorf("failed to read block for alignment: %w", err)
-	}
-
-	// Verify we got the expected amount of data
-	if uint32(len(block)) != adjustedSize {
-		return fmt.Errorf("read returned %d bytes, expected %d", len(block), adjustedSize)
+	block := make([]byte, adjustedSize)
+	if adjustedSize <= 8 {
+		// The first and last words are all there is: read them at once
+		if err := dp.readWord(adjustedAddress, block); err != nil {
+			return err
+		}
+	} else {
+		if addressAlign != 0 {
+			if err := dp.readWord(adjustedAddress, block[:4]); err != nil {
+				return err
+			}
+		}
+		if sizeAlign != 0 {
+			if err := dp.readWord(adjustedAddress+adjustedSize-4, block[adjustedSize-4:]); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Copy the new data to the correct position within the buffer
 	copy(block[addressAlign:], data)
 
 	// Write the modified block back to the machine's RAM
-	_, err = dp.transfer(CMDWriteMem, adjustedAddress, block, 0)
+	_, err := dp.transfer(CMDWriteMem, adjustedAddress, block, 0)
 	if err != nil {
 		return fmt.Errorf("failed to write aligned block: %w", err)
 	}
 
 	return nil
 }
+
+// readWord reads the current contents of memory at address into buf, for a
+// read-modify-write
+func (dp *DebugPort) readWord(address uint32, buf []byte) error {
+	current, err := dp.ReadBlock(address, uint16(len(buf)))
+	if err != nil {
+		return fmt.Errorf("failed to read block for alignment: %w", err)
+	}
+
+	// Verify we got the expected amount of data
+	if len(current) != len(buf) {
+		return fmt.Errorf("read returned %d bytes, expected %d", len(current), len(buf))
+	}
+	copy(buf, current)
+	return nil
+}
+
+// alignment returns the alignment the configured CPU needs for memory writes.
+// Unknown CPUs are written to without alignment.
+func (dp *DebugPort) alignment() int {
+	c, err := cpu.Lookup(dp.config.CPU)
+	if err != nil {
+		return 1
+	}
+	return c.Alignment()
+}
+
+// writeChunkSize returns the size of the next chunk of a write of remaining
+// bytes at address. On CPUs that need aligned writes (68040/68060) chunks
+// other than the last end on an aligned boundary, so only the first and last
+// partial words of a long write need a read-modify-write.
+func (dp *DebugPort) writeChunkSize(address uint32, remaining int) int {
+	size := dp.ChunkSize()
+	if remaining <= size {
+		return remaining
+	}
+	if align := dp.alignment(); align > 1 {
+		if aligned := size - int((address+uint32(size))%uint32(align)); aligned > 0 {
+			size = aligned
+		}
+	}
+	return size
+}
@@ -0,0 +1,65 @@
+package protocol
+
+// WriteBatch collects the writes of an upload and sends contiguous data in
+// chunks of ChunkSize bytes, however the loader split it into records. On
+// 68040/68060 machines the chunks are aligned to 4 bytes, so only the first
+// and last partial words of each contiguous run are read-modify-written.
+//
+// Writes are sent in order: data that doesn't continue the pending run sends
+// the run first. Call Flush when done to send the rest.
+type WriteBatch struct {
+	dp      *DebugPort
+	address uint32
+	pending []byte
+}
+
+// NewWriteBatch returns an empty batch of writes to the debug port
+func (dp *DebugPort) NewWriteBatch() *WriteBatch {
+	return &WriteBatch{dp: dp}
+}
+
+// Write queues data to be written at address, sending every complete chunk.
+// It has the signature of a loader write handler.
+func (b *WriteBatch) Write(address uint32, data []byte) error {
+	if len(b.pending) > 0 && address != b.address+uint32(len(b.pending)) {
+		if err := b.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(b.pending) == 0 {
+		b.address = address
+	}
+	b.pending = append(b.pending, data...)
+
+	// A bridge that takes batches is sent a batch's worth of chunks at once
+	limit := b.dp.ChunkSize()
+	if b.dp.batcher() != nil {
+		limit *= b.dp.batchSize()
+	}
+	if len(b.pending) <= limit {
+		return nil
+	}
+
+	// Keep the last, possibly partial chunk, which later data may continue
+	sent := 0
+	for len(b.pending)-sent > b.dp.ChunkSize() {
+		sent += b.dp.writeChunkSize(b.address+uint32(sent), len(b.pending)-sent)
+	}
+	if err := b.dp.WriteRange(b.address, b.pending[:sent]); err != nil {
+		b.pending = nil
+		return err
+	}
+	b.address += uint32(sent)
+	b.pending = append(b.pending[:0], b.pending[sent:]...)
+	return nil
+}
+
+// Flush sends the pending data
+func (b *WriteBatch) Flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	err := b.dp.WriteRange(b.address, b.pending)
+	b.pending = b.pending[:0]
+	return err
+}
@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// requests describes each request sent as its command, address and length
+func requests(writes [][]byte) []string {
+	var got []string
+	for _, w := range writes {
+		address := uint32(w[2])<<16 | uint32(w[3])<<8 | uint32(w[4])
+		length := uint16(w[5])<<8 | uint16(w[6])
+		got = append(got, fmt.Sprintf("%s %X/%X", CommandName(w[1]), address, length))
+	}
+	return got
+}
+
+func checkRequests(t *testing.T, conn *fakeConn, want []string) {
+	t.Helper()
+	got := requests(conn.writes)
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("requests = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWriteRangeAlignsChunksOn68040(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{
+		response(0, 0, 1, 2, 3, 4), // Head word
+		response(0, 0),
+		response(0, 0),
+		response(0, 0, 5, 6, 7, 8), // Tail word
+		response(0, 0),
+	}}
+	dp := NewDebugPort(conn, &config.Config{CPU: "68040", VerifyLRC: true, ChunkSize: 16})
+
+	if err := dp.WriteRange(0x1002, make([]byte, 40)); err != nil {
+		t.Fatalf("WriteRange() error: %v", err)
+	}
+
+	// Only the first and last chunks need a read-modify-write, of one word
+	checkRequests(t, conn, []string{
+		"READ_MEM 1000/4",
+		"WRITE_MEM 1000/10",
+		"WRITE_MEM 1010/10",
+		"READ_MEM 1028/4",
+		"WRITE_MEM 1020/C",
+	})
+	if last := conn.writes[4]; last[7] != 0 || last[7+10] != 7 || last[7+11] != 8 {
+		t.Errorf("last word not merged with memory: % X", last[7:])
+	}
+}
+
+func TestWriteBatchCoalescesRecords(t *testing.T) {
+	conn := &fakeConn{}
+	for i := 0; i < 3; i++ {
+		conn.responses = append(conn.responses, response(0, 0))
+	}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, ChunkSize: 32})
+	batch := dp.NewWriteBatch()
+
+	// Three 16-byte records make a full chunk and a partial one, then a
+	// record elsewhere sends the rest
+	for i := uint32(0); i < 3; i++ {
+		if err := batch.Write(0x2000+i*16, make([]byte, 16)); err != nil {
+			t.Fatalf("Write() error: %v", err)
+		}
+	}
+	if err := batch.Write(0x3000, []byte{1, 2}); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if err := batch.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	checkRequests(t, conn, []string{
+		"WRITE_MEM 2000/20",
+		"WRITE_MEM 2020/10",
+		"WRITE_MEM 3000/2",
+	})
+}
@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// Debug port revision codes reported by GetRevision
+const (
+	RevB2  = 0x00
+	RevC4A = 0x01
+)
+
+// RevisionName names a debug port revision code
+func RevisionName(revision byte) string {
+	switch revision {
+	case RevB2:
+		return "RevB2"
+	case RevC4A:
+		return "RevC4A"
+	}
+	return fmt.Sprintf("unknown revision %02X", revision)
+}
+
+// ErrUnsupported is returned for a command the machine or its debug port
+// doesn't support
+var ErrUnsupported = errors.New("not supported")
+
+// Capability is an optional debug port feature
+type Capability string
+
+const (
+	CapStopCPU           Capability = "stopping and starting the CPU"
+	CapBootSource        Capability = "boot source selection"
+	CapSectorProgramming Capability = "flash sector programming"
+	CapChecksum          Capability = "on-device checksums"
+)
+
+// AllCapabilities lists every capability, in the order they are reported
+var AllCapabilities = []Capability{CapStopCPU, CapBootSource, CapSectorProgramming, CapChecksum}
+
+// machineCommands are the machine-specific commands (see config.Machine)
+// that enable capabilities
+var machineCommands = map[Capability]string{
+	CapStopCPU:    "stop",
+	CapBootSource: "boot",
+}
+
+// checksumRevisions are the debug port revisions with a checksum command.
+// None is known yet, so checksums are computed from a read-back.
+var checksumRevisions = map[byte]bool{}
+
+// Capabilities tells which optional features a machine's debug port
+// supports, from the target machine and, once known, the debug port revision
+type Capabilities struct {
+	cfg         *config.Config
+	revision    byte
+	hasRevision bool
+}
+
+// MachineCapabilities returns the capabilities known from the configured
+// target machine alone, for checks before connecting. Without a target
+// machine, stopping the CPU and boot source selection are assumed to work.
+func MachineCapabilities(cfg *config.Config) Capabilities {
+	return Capabilities{cfg: cfg}
+}
+
+// Capabilities returns the capabilities of the machine, asking the debug port
+// for its revision the first time
+func (dp *DebugPort) Capabilities() (Capabilities, error) {
+	if !dp.hasRevision {
+		revision, err := dp.GetRevision()
+		if err != nil {
+			return Capabilities{}, fmt.Errorf("failed to get debug port revision: %w", err)
+		}
+		dp.revision = revision
+		dp.hasRevision = true
+	}
+	return Capabilities{cfg: dp.config, revision: dp.revision, hasRevision: true}, nil
+}
+
+// Revision returns the debug port revision, if it is known
+func (c Capabilities) Revision() (byte, bool) {
+	return c.revision, c.hasRevision
+}
+
+// Supported returns the capabilities that are available
+func (c Capabilities) Supported() []Capability {
+	supported := []Capability{}
+	for _, capability := range AllCapabilities {
+		if c.Supports(capability) {
+			supported = append(supported, capability)
+		}
+	}
+	return supported
+}
+
+// Supports returns true if a capability is available
+func (c Capabilities) Supports(capability Capability) bool {
+	return c.Check(capability) == nil
+}
+
+// Check returns an ErrUnsupported error explaining why a capability isn't
+// available, or nil if it is
+func (c Capabilities) Check(capability Capability) error {
+	machine := c.cfg.Machine()
+	switch capability {
+	case CapStopCPU, CapBootSource:
+		if machine != nil && !machine.Supports(machineCommands[capability]) {
+			return unsupportedError("%s is not supported on %s", capability, machine.Name)
+		}
+	case CapSectorProgramming:
+		if c.cfg.FlashPageSize() > 0 && c.cfg.FlashSectorSize() > 0 {
+			return nil
+		}
+		if machine == nil {
+			return unsupportedError("%s needs a target machine that supports it", capability)
+		}
+		return unsupportedError("%s is not supported on %s", capability, machine.Name)
+	case CapChecksum:
+		if !c.hasRevision {
+			return unsupportedError("%s depend on the debug port revision, which isn't known yet", capability)
+		}
+		if !checksumRevisions[c.revision] {
+			return unsupportedError("%s are not supported by debug port %s", capability, RevisionName(c.revision))
+		}
+	}
+	return nil
+}
+
+// unsupportedError returns an ErrUnsupported error with a formatted message
+func unsupportedError(format string, args ...interface{}) error {
+	return &Error{Kind: ErrUnsupported, Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// targetConfig returns the default config with a target machine selected
+func targetConfig(t *testing.T, target string) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	if target != "" {
+		if err := cfg.SetTarget(target); err != nil {
+			t.Fatalf("SetTarget(%q) error: %v", target, err)
+		}
+	}
+	return cfg
+}
+
+func TestMachineCapabilities(t *testing.T) {
+	tests := []struct {
+		target    string
+		supported []Capability
+	}{
+		{"", []Capability{CapStopCPU, CapBootSource}},
+		{"f256k", []Capability{CapStopCPU, CapBootSource, CapSectorProgramming}},
+		{"a2560", []Capability{}},
+	}
+	for _, tt := range tests {
+		caps := MachineCapabilities(targetConfig(t, tt.target))
+		got := caps.Supported()
+		if len(got) != len(tt.supported) {
+			t.Errorf("%q: Supported() = %v, want %v", tt.target, got, tt.supported)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.supported[i] {
+				t.Errorf("%q: Supported() = %v, want %v", tt.target, got, tt.supported)
+				break
+			}
+		}
+	}
+}
+
+func TestCapabilityCheckError(t *testing.T) {
+	err := MachineCapabilities(targetConfig(t, "a2560")).Check(CapStopCPU)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Check(CapStopCPU) = %v, want ErrUnsupported", err)
+	}
+	if !strings.Contains(err.Error(), "a2560") {
+		t.Errorf("error %q doesn't name the machine", err)
+	}
+
+	err = MachineCapabilities(targetConfig(t, "")).Check(CapSectorProgramming)
+	if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), "target machine") {
+		t.Errorf("Check(CapSectorProgramming) without target = %v", err)
+	}
+}
+
+func TestDebugPortCapabilities(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{response(0, RevC4A)}}
+	dp := NewDebugPort(conn, targetConfig(t, "f256k"))
+
+	caps, err := dp.Capabilities()
+	if err != nil {
+		t.Fatalf("Capabilities() error: %v", err)
+	}
+	if rev, ok := caps.Revision(); !ok || rev != RevC4A {
+		t.Errorf("Revision() = %d, %v, want %d, true", rev, ok, RevC4A)
+	}
+	err = caps.Check(CapChecksum)
+	if !errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), "RevC4A") {
+		t.Errorf("Check(CapChecksum) = %v, want an error naming RevC4A", err)
+	}
+
+	// The revision is only asked for once
+	if _, err := dp.Capabilities(); err != nil {
+		t.Fatalf("second Capabilities() error: %v", err)
+	}
+	if len(conn.writes) != 1 {
+		t.Errorf("sent %d commands, want 1", len(conn.writes))
+	}
+}
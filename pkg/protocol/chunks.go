@@ -0,0 +1,122 @@
+package protocol
+
+import "time"
+
+// Limits of the chunk size when it is tuned automatically
+const (
+	MinChunkSize = 256
+	MaxChunkSize = 0x8000
+)
+
+// tunerWindow is the number of full-size transfers measured before the chunk
+// size is changed
+const tunerWindow = 4
+
+// chunkTuner adapts the chunk size of ReadRange and WriteRange. Starting from
+// the configured size it doubles the size while throughput keeps improving,
+// goes back to the previous size once it stops improving, and halves it
+// whenever a transfer had to be retried. After going back or halving it stops
+// growing.
+type chunkTuner struct {
+	size     int
+	previous int     // Size before the last increase, 0 if it wasn't increased
+	prevRate float64 // Throughput at the previous size (bytes/s)
+	settled  bool
+
+	// Measurements at the current size
+	samples int
+	bytes   int
+	elapsed time.Duration
+}
+
+// newChunkTuner returns a tuner starting at size
+func newChunkTuner(size int) *chunkTuner {
+	if size < MinChunkSize {
+		size = MinChunkSize
+	}
+	if size > MaxChunkSize {
+		size = MaxChunkSize
+	}
+	return &chunkTuner{size: size}
+}
+
+// record adjusts the chunk size after a transfer of n bytes
+func (t *chunkTuner) record(n int, elapsed time.Duration, retried bool) {
+	if retried {
+		t.size /= 2
+		if t.size < MinChunkSize {
+			t.size = MinChunkSize
+		}
+		t.previous = 0
+		t.settled = true
+		t.reset()
+		return
+	}
+
+	// Short transfers at the end of a range don't tell much
+	if n < t.size {
+		return
+	}
+
+	t.samples++
+	t.bytes += n
+	t.elapsed += elapsed
+	if t.samples < tunerWindow || t.elapsed <= 0 {
+		return
+	}
+
+	rate := float64(t.bytes) / t.elapsed.Seconds()
+	t.reset()
+
+	switch {
+	case t.previous != 0 && rate < t.prevRate:
+		// Bigger chunks made things slower
+		t.size = t.previous
+		t.previous = 0
+		t.settled = true
+	case !t.settled && t.size*2 <= MaxChunkSize:
+		t.previous = t.size
+		t.prevRate = rate
+		t.size *= 2
+	default:
+		t.previous = 0
+	}
+}
+
+// reset discards the measurements at the current size
+func (t *chunkTuner) reset() {
+	t.samples = 0
+	t.bytes = 0
+	t.elapsed = 0
+}
+
+// ChunkSize returns the size ReadRange and WriteRange split transfers into:
+// the configured chunk size, or the tuned size with adaptive_chunks enabled
+func (dp *DebugPort) ChunkSize() int {
+	if dp.tuner != nil {
+		return dp.tuner.size
+	}
+	size := dp.config.ChunkSize
+	if dp.chunkSize > 0 {
+		size = dp.chunkSize
+	}
+	if size <= 0 || size > MaxTransferSize {
+		size = MaxTransferSize
+	}
+	return size
+}
+
+// SetChunkSize fixes the chunk size of ReadRange and WriteRange, turning
+// adaptive sizing off
+func (dp *DebugPort) SetChunkSize(size int) {
+	dp.tuner = nil
+	dp.chunkSize = size
+}
+
+// recordChunk feeds the outcome of a ReadRange or WriteRange transfer to the
+// chunk size tuner
+func (dp *DebugPort) recordChunk(n int, elapsed time.Duration) {
+	if dp.tuner != nil {
+		dp.tuner.record(n, elapsed, dp.retried)
+	}
+}
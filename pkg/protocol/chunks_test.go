@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+// feed records a window of full-size transfers at the given throughput
+func feed(t *chunkTuner, bytesPerSecond float64) {
+	for i := 0; i < tunerWindow; i++ {
+		elapsed := time.Duration(float64(t.size) / bytesPerSecond * float64(time.Second))
+		t.record(t.size, elapsed, false)
+	}
+}
+
+func TestChunkTunerGrowsWhileFaster(t *testing.T) {
+	tuner := newChunkTuner(1024)
+
+	feed(tuner, 100000)
+	if tuner.size != 2048 {
+		t.Fatalf("size = %d after first window, want 2048", tuner.size)
+	}
+	feed(tuner, 200000)
+	if tuner.size != 4096 {
+		t.Fatalf("size = %d after faster window, want 4096", tuner.size)
+	}
+
+	// Slower at 4096: back to 2048 and stay there
+	feed(tuner, 150000)
+	if tuner.size != 2048 {
+		t.Fatalf("size = %d after slower window, want 2048", tuner.size)
+	}
+	feed(tuner, 300000)
+	if tuner.size != 2048 {
+		t.Errorf("size = %d after settling, want 2048", tuner.size)
+	}
+}
+
+func TestChunkTunerStopsAtMaximum(t *testing.T) {
+	tuner := newChunkTuner(MaxChunkSize / 2)
+
+	feed(tuner, 100000)
+	feed(tuner, 200000)
+	if tuner.size != MaxChunkSize {
+		t.Errorf("size = %d, want %d", tuner.size, MaxChunkSize)
+	}
+}
+
+func TestChunkTunerShrinksOnRetry(t *testing.T) {
+	tuner := newChunkTuner(4096)
+
+	tuner.record(4096, time.Millisecond, true)
+	if tuner.size != 2048 {
+		t.Fatalf("size = %d after retry, want 2048", tuner.size)
+	}
+
+	// No more growth after errors
+	feed(tuner, 100000)
+	feed(tuner, 200000)
+	if tuner.size != 2048 {
+		t.Errorf("size = %d, want 2048", tuner.size)
+	}
+
+	for i := 0; i < 10; i++ {
+		tuner.record(tuner.size, time.Millisecond, true)
+	}
+	if tuner.size != MinChunkSize {
+		t.Errorf("size = %d after many retries, want %d", tuner.size, MinChunkSize)
+	}
+}
+
+func TestChunkTunerIgnoresShortTransfers(t *testing.T) {
+	tuner := newChunkTuner(1024)
+	for i := 0; i < 2*tunerWindow; i++ {
+		tuner.record(100, time.Millisecond, false)
+	}
+	if tuner.size != 1024 {
+		t.Errorf("size = %d, want 1024", tuner.size)
+	}
+}
@@ -1,7 +1,10 @@
 // Package protocol implements the Foenix debug port binary protocol
 package protocol
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Debug port protocol commands
 const (
@@ -31,6 +34,40 @@ const (
 	CMDRevision = 0xFE // Get debug interface revision
 )
 
+// commandNames are the names of the debug port commands, as used in traces
+var commandNames = map[byte]string{
+	CMDReadMem:       "READ_MEM",
+	CMDWriteMem:      "WRITE_MEM",
+	CMDProgramFlash:  "PROGRAM_FLASH",
+	CMDEraseFlash:    "ERASE_FLASH",
+	CMDEraseSector:   "ERASE_SECTOR",
+	CMDProgramSector: "PROGRAM_SECTOR",
+	CMDStopCPU:       "STOP_CPU",
+	CMDStartCPU:      "START_CPU",
+	CMDEnterDebug:    "ENTER_DEBUG",
+	CMDExitDebug:     "EXIT_DEBUG",
+	CMDBootRAM:       "BOOT_RAM",
+	CMDBootFlash:     "BOOT_FLASH",
+	CMDRevision:      "REVISION",
+}
+
+// CommandName returns the name of a debug port command, or its number in hex
+// for unknown commands
+func CommandName(command byte) string {
+	if name, ok := commandNames[command]; ok {
+		return name
+	}
+	return fmt.Sprintf("CMD_%02X", command)
+}
+
+// MaxAddress is the highest address the 24-bit address of a request header
+// can carry. The debug port has no documented way to reach memory above it.
+const MaxAddress = 0xFFFFFF
+
+// MaxFlashPage is the highest 8KB flash page the sector commands can address,
+// as the page number is sent doubled in the top byte of the address
+const MaxFlashPage = 0x7F
+
 // Protocol sync bytes
 const (
 	RequestSyncByte  = 0x55 // Sent at start of each request
@@ -41,6 +78,15 @@ const (
 const (
 	DelayEraseSector   = 1 * time.Second // Delay after ERASE_SECTOR command
 	DelayProgramSector = 2 * time.Second // Delay after PROGRAM_SECTOR command
+
+	// Pause between status polls when flash polling is enabled
+	FlashPollInterval = 20 * time.Millisecond
+)
+
+// Backoff between retries of a failed transfer (doubles after each attempt)
+const (
+	RetryBaseDelay = 50 * time.Millisecond
+	RetryMaxDelay  = 2 * time.Second
 )
 
 // Boot source identifiers (for F256jr Rev A)
@@ -56,6 +102,10 @@ const (
 	PGXcpu680X0 = 0x02 // 680x0 family CPU
 	PGXcpu65C02 = 0x03 // 65C02 CPU
 
+	// PGXcpu6809 isn't in the PGX format, which only documents types 1-3.
+	// Files with it are loaded for a 6809, but it is never written.
+	PGXcpu6809 = 0x04
+
 	// PGX header offsets
 	PGXOffSigStart  = 0 // Start of "PGX" signature
 	PGXOffSigEnd    = 3 // End of signature
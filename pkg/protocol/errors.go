@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"errors"
+)
+
+// Kinds of failure, to tell apart with errors.Is
+var (
+	// ErrConnection is a failure to open the connection or to send or
+	// receive on it, such as a timeout waiting for the machine to answer
+	ErrConnection = errors.New("connection error")
+
+	// ErrProtocol is a response that breaks the debug port protocol, such
+	// as one with a bad LRC checksum
+	ErrProtocol = errors.New("protocol error")
+
+	// ErrVerify is memory or flash that doesn't read back as it was written
+	ErrVerify = errors.New("verification failed")
+)
+
+// Error is an error of one of the kinds above. Its message is that of the
+// underlying error, and errors.Is matches both the kind and the underlying
+// error.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// connectionError marks err as a connection failure
+func connectionError(err error) error {
+	return &Error{Kind: ErrConnection, Err: err}
+}
+
+// protocolError marks err as a protocol failure
+func protocolError(err error) error {
+	return &Error{Kind: ErrProtocol, Err: err}
+}
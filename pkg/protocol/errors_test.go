@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+func TestTransferErrorKinds(t *testing.T) {
+	good := response(0x00, 0x01, 0xDE, 0xAD)
+
+	tests := []struct {
+		name      string
+		responses [][]byte
+		want      error
+		notWant   error
+	}{
+		{"Bad LRC", [][]byte{corrupt(good)}, ErrProtocol, ErrConnection},
+		{"No answer", nil, ErrConnection, ErrProtocol},
+		{"Truncated response", [][]byte{good[:3]}, ErrConnection, ErrProtocol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{responses: tt.responses}
+			dp := NewDebugPort(conn, &config.Config{VerifyLRC: true})
+			dp.retryDelay = 0
+
+			_, err := dp.ReadBlock(0x1000, 2)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ReadBlock() error = %v, want %v", err, tt.want)
+			}
+			if errors.Is(err, tt.notWant) {
+				t.Errorf("ReadBlock() error = %v, should not be %v", err, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Kind: ErrVerify, Err: errors.New("3 bytes differ")}
+	if err.Error() != "3 bytes differ" {
+		t.Errorf("Error() = %q, want the underlying message", err.Error())
+	}
+	if !errors.Is(err, ErrVerify) || errors.Is(err, ErrConnection) {
+		t.Errorf("errors.Is() doesn't match only the error's kind")
+	}
+}
@@ -0,0 +1,177 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+)
+
+// chunkTransfer is one chunk of a memory read or write sent in a batch
+type chunkTransfer struct {
+	address    uint32
+	data       []byte // Data to write, or nil for a read
+	readLength uint16
+}
+
+// verb names the transfer in error messages
+func (c chunkTransfer) verb() string {
+	if c.data != nil {
+		return "write"
+	}
+	return "read"
+}
+
+// batcher returns the connection as a Batcher if chunks can be pipelined:
+// the connection leads to a bridge that takes them, batch_requests allows
+// more than one, and nothing needs each exchange on its own (a trace,
+// or a flash operation to wait for).
+func (dp *DebugPort) batcher() connection.Batcher {
+	b, ok := dp.conn.(connection.Batcher)
+	if !ok || dp.config.BatchRequests <= 1 || dp.tracer != nil || !dp.busyUntil.IsZero() {
+		return nil
+	}
+	if !b.CanBatch() {
+		return nil
+	}
+	return b
+}
+
+// batchSize returns the number of chunks handed to the Batcher at once
+func (dp *DebugPort) batchSize() int {
+	return min(dp.config.BatchRequests, connection.MaxBatchRequests)
+}
+
+// transferChunks sends memory transfers in batches and returns the data read
+// by each. After a batch fails, the transfer that failed is sent again on its
+// own, with the usual retries, and batching carries on with the next one.
+func (dp *DebugPort) transferChunks(b connection.Batcher, chunks []chunkTransfer) ([][]byte, error) {
+	results := make([][]byte, 0, len(chunks))
+	for len(chunks) > 0 {
+		if err := dp.context().Err(); err != nil {
+			return nil, err
+		}
+
+		batch := chunks[:min(len(chunks), dp.batchSize())]
+		commands := make([]byte, len(batch))
+		packets := make([][]byte, len(batch))
+		lengths := make([]int, len(batch))
+		for i, c := range batch {
+			var command byte = CMDReadMem
+			if c.data != nil {
+				command = CMDWriteMem
+			}
+			if err := checkAddressRange(command, c.address, c.data, c.readLength); err != nil {
+				return nil, err
+			}
+			length := c.readLength
+			if c.data != nil {
+				length = uint16(len(c.data))
+			}
+			commands[i] = command
+			packets[i] = buildPacket(command, c.address, c.data, length)
+			lengths[i] = 4 + int(c.readLength) // Sync, status, data and LRC
+		}
+
+		start := time.Now()
+		responses, err := b.Exchange(packets, lengths)
+		elapsed := time.Since(start)
+
+		done := 0
+		for i, response := range responses {
+			data, checkErr := dp.checkResponse(response, batch[i].readLength)
+			if checkErr != nil {
+				err = checkErr
+				break
+			}
+			results = append(results, data)
+			dp.stats.Transfers++
+			dp.recordChunk(len(batch[i].data)+int(batch[i].readLength), elapsed/time.Duration(len(responses)))
+			done++
+		}
+
+		if err != nil && done < len(batch) {
+			dp.stats.Failures++
+			if resyncErr := dp.Resync(); resyncErr != nil {
+				return nil, fmt.Errorf("%w (resync failed: %v)", err, resyncErr)
+			}
+			c := batch[done]
+			data, err := dp.transfer(commands[done], c.address, c.data, c.readLength)
+			if err != nil {
+				return nil, fmt.Errorf("failed to %s chunk at 0x%X: %w", c.verb(), c.address, err)
+			}
+			results = append(results, data)
+			done++
+		}
+		chunks = chunks[done:]
+	}
+	return results, nil
+}
+
+// checkResponse checks a raw response from a batch and returns its data
+func (dp *DebugPort) checkResponse(response []byte, readLength uint16) ([]byte, error) {
+	if len(response) != 4+int(readLength) || response[0] != ResponseSyncByte {
+		return nil, protocolError(fmt.Errorf("invalid response in batch: % X", response[:min(len(response), 4)]))
+	}
+	dp.status0 = response[1]
+	dp.status1 = response[2]
+	data := response[3 : 3+readLength]
+	if _, err := dp.checkLRC(response[len(response)-1], data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readRangeBatched is ReadRange for a connection that takes batches
+func (dp *DebugPort) readRangeBatched(b connection.Batcher, address uint32, length uint32) ([]byte, error) {
+	var chunks []chunkTransfer
+	for offset := uint32(0); offset < length; {
+		size := min(uint32(dp.ChunkSize()), length-offset)
+		chunks = append(chunks, chunkTransfer{address: address + offset, readLength: uint16(size)})
+		offset += size
+	}
+
+	results, err := dp.transferChunks(b, chunks)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, length)
+	for _, result := range results {
+		data = append(data, result...)
+	}
+	return data, nil
+}
+
+// writeRangeBatched is WriteRange for a connection that takes batches. On
+// 68040/68060 machines a chunk that isn't aligned to 4 bytes, the first or
+// the last, is written on its own with a read-modify-write.
+func (dp *DebugPort) writeRangeBatched(b connection.Batcher, address uint32, data []byte) error {
+	var chunks []chunkTransfer
+	send := func() error {
+		if len(chunks) == 0 {
+			return nil
+		}
+		_, err := dp.transferChunks(b, chunks)
+		chunks = nil
+		return err
+	}
+
+	align := uint32(dp.alignment())
+	for offset := 0; offset < len(data); {
+		size := dp.writeChunkSize(address, len(data)-offset)
+		chunk := data[offset : offset+size]
+		if address%align == 0 && uint32(size)%align == 0 {
+			chunks = append(chunks, chunkTransfer{address: address, data: chunk})
+		} else {
+			if err := send(); err != nil {
+				return err
+			}
+			if err := dp.writeRangeChunk(address, chunk); err != nil {
+				return err
+			}
+		}
+		address += uint32(size)
+		offset += size
+	}
+	return send()
+}
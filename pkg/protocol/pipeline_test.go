@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+)
+
+// fakeBatchConn is a fakeConn that also takes batches: each Exchange returns
+// the next queued batch of responses
+type fakeBatchConn struct {
+	fakeConn
+	batches [][][]byte
+	sent    [][][]byte
+}
+
+func (f *fakeBatchConn) CanBatch() bool { return true }
+
+func (f *fakeBatchConn) Exchange(requests [][]byte, responseLengths []int) ([][]byte, error) {
+	f.sent = append(f.sent, requests)
+	responses := f.batches[0]
+	f.batches = f.batches[1:]
+	return responses, nil
+}
+
+func TestReadRangeBatched(t *testing.T) {
+	conn := &fakeBatchConn{
+		fakeConn: fakeConn{responses: [][]byte{response(0, 0, 5, 6)}},
+		batches: [][][]byte{
+			{response(0, 0, 1, 2), response(0, 0, 3, 4), corrupt(response(0, 0, 5, 6)), response(0, 0, 7, 8)},
+			{response(0, 0, 7, 8), response(0, 0, 9, 10)},
+		},
+	}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, Retries: 3, ChunkSize: 2, BatchRequests: 4})
+
+	data, err := dp.ReadRange(0x1000, 10)
+	if err != nil {
+		t.Fatalf("ReadRange() error: %v", err)
+	}
+	if want := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !bytes.Equal(data, want) {
+		t.Errorf("ReadRange() = % X, want % X", data, want)
+	}
+
+	// The corrupted third chunk is read again on its own, and the batch
+	// carries on from the fourth
+	if len(conn.sent) != 2 || len(conn.sent[0]) != 4 || len(conn.sent[1]) != 2 || len(conn.writes) != 1 {
+		t.Errorf("sent batches of %d and single requests %d", len(conn.sent), len(conn.writes))
+	}
+	if want := buildPacket(CMDReadMem, 0x1004, nil, 2); !bytes.Equal(conn.writes[0], want) {
+		t.Errorf("single request = % X, want % X", conn.writes[0], want)
+	}
+	want := LinkStats{Transfers: 5, Failures: 1, LRCErrors: 1}
+	if got := dp.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteRangeBatched(t *testing.T) {
+	conn := &fakeBatchConn{batches: [][][]byte{{response(0, 0), response(0, 0), response(0, 0)}}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, ChunkSize: 4, BatchRequests: 16})
+
+	if err := dp.WriteRange(0x2000, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}); err != nil {
+		t.Fatalf("WriteRange() error: %v", err)
+	}
+	if len(conn.sent) != 1 || len(conn.writes) != 0 {
+		t.Fatalf("sent %d batches and %d single requests, want 1 batch", len(conn.sent), len(conn.writes))
+	}
+	if want := buildPacket(CMDWriteMem, 0x2008, []byte{9, 10}, 2); !bytes.Equal(conn.sent[0][2], want) {
+		t.Errorf("last request = % X, want % X", conn.sent[0][2], want)
+	}
+}
+
+func TestBatchingDisabled(t *testing.T) {
+	conn := &fakeBatchConn{fakeConn: fakeConn{responses: [][]byte{response(0, 0, 1, 2), response(0, 0, 3, 4)}}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, ChunkSize: 2, BatchRequests: 1})
+
+	if _, err := dp.ReadRange(0x1000, 4); err != nil {
+		t.Fatalf("ReadRange() error: %v", err)
+	}
+	if len(conn.sent) != 0 || len(conn.writes) != 2 {
+		t.Errorf("sent %d batches and %d single requests, want 2 single requests", len(conn.sent), len(conn.writes))
+	}
+}
@@ -1,27 +1,80 @@
 package protocol
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/daschewie/foenixmgr/pkg/config"
 	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/util"
 )
 
+// ErrLRCMismatch is returned when a response's LRC checksum doesn't match its contents
+var ErrLRCMismatch = errors.New("response LRC mismatch")
+
 // DebugPort provides the main interface for communicating with Foenix hardware
 type DebugPort struct {
-	conn    connection.Connection
-	config  *config.Config
-	status0 byte
-	status1 byte
+	conn       connection.Connection
+	config     *config.Config
+	status0    byte
+	status1    byte
+	retryDelay time.Duration
+	busyUntil  time.Time // End of the flash operation in progress, if any
+	tracer     *Tracer   // Records every exchange, if set
+	tuner      *chunkTuner
+	chunkSize  int             // Fixed chunk size set with SetChunkSize, 0 for the configured size
+	retried    bool            // The last transfer succeeded only after a retry
+	instant    bool            // Flash operations complete at once (simulated device)
+	stats      LinkStats       // Exchanges and errors, for link quality reports
+	ctx        context.Context // Cancels transfers not yet started, if set
+
+	// Debug port revision, once asked for by Capabilities
+	revision    byte
+	hasRevision bool
 }
 
 // NewDebugPort creates a new DebugPort instance
 func NewDebugPort(conn connection.Connection, cfg *config.Config) *DebugPort {
-	return &DebugPort{
-		conn:   conn,
-		config: cfg,
+	dp := &DebugPort{
+		conn:       conn,
+		config:     cfg,
+		retryDelay: RetryBaseDelay,
+	}
+	if cfg.AdaptiveChunks {
+		dp.tuner = newChunkTuner(cfg.ChunkSize)
+	}
+	return dp
+}
+
+// SetContext makes transfers and flash waits stop once ctx is done, returning
+// its error. A transfer already in progress is completed first, so the
+// connection and the machine stay in step and cleanup such as leaving debug
+// mode still works after SetContext(nil).
+func (dp *DebugPort) SetContext(ctx context.Context) {
+	dp.ctx = ctx
+}
+
+// context returns the context set with SetContext, or a context that is
+// never done
+func (dp *DebugPort) context() context.Context {
+	if dp.ctx == nil {
+		return context.Background()
+	}
+	return dp.ctx
+}
+
+// sleep waits for d, returning early with the context's error if it is done
+func (dp *DebugPort) sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-dp.context().Done():
+		return dp.context().Err()
+	case <-timer.C:
+		return nil
 	}
 }
 
@@ -53,57 +106,210 @@ func (dp *DebugPort) GetStatus1() byte {
 //
 // Response packet format:
 //   [0xAA][STATUS0][STATUS1][...DATA...][LRC]
+//
+// If a transfer fails (I/O error, timeout, or LRC mismatch when verification is
+// enabled) the connection is resynchronized so later commands start from a clean
+// state. Commands that are safe to repeat (memory reads/writes, revision) are
+// then re-sent up to the configured number of retries with exponential backoff.
+//
+// A flash erase or program operation still in progress is waited for first:
+// the debug port isn't known to take any command, memory writes included,
+// while the flash is busy.
 func (dp *DebugPort) transfer(command byte, address uint32, data []byte, readLength uint16) ([]byte, error) {
-	// Reset status bytes
-	dp.status0 = 0
-	dp.status1 = 0
+	if err := dp.context().Err(); err != nil {
+		return nil, err
+	}
+	if err := checkAddressRange(command, address, data, readLength); err != nil {
+		return nil, err
+	}
+	if err := dp.WaitReady(); err != nil {
+		return nil, err
+	}
 
-	// Determine length
-	length := readLength
-	if data != nil && len(data) > 0 {
-		length = uint16(len(data))
+	retries := 0
+	if isRepeatable(command) {
+		retries = dp.config.Retries
 	}
 
-	// Build 7-byte header
-	header := make([]byte, 7)
-	header[0] = RequestSyncByte
-	header[1] = command
+	delay := dp.retryDelay
+	for attempt := 0; ; attempt++ {
+		readBytes, err := dp.transferOnce(command, address, data, readLength)
+		if err == nil {
+			dp.retried = attempt > 0
+			dp.stats.Transfers++
+			return readBytes, nil
+		}
+		dp.stats.Failures++
 
-	// Address is 24-bit (3 bytes), big-endian
-	header[2] = byte(address >> 16)
-	header[3] = byte(address >> 8)
-	header[4] = byte(address)
+		// A bridge in use by another client refused the request; resending
+		// it would only be refused again
+		if errors.Is(err, connection.ErrBusy) {
+			return nil, err
+		}
+		if resyncErr := dp.Resync(); resyncErr != nil {
+			return nil, fmt.Errorf("%w (resync failed: %v)", err, resyncErr)
+		}
+		if attempt >= retries {
+			if attempt > 0 {
+				return nil, fmt.Errorf("%w (after %d retries)", err, attempt)
+			}
+			return nil, err
+		}
 
-	// Length is 16-bit (2 bytes), big-endian
-	binary.BigEndian.PutUint16(header[5:7], length)
+		if err := dp.sleep(delay); err != nil {
+			return nil, err
+		}
+		dp.stats.Retries++
+		delay *= 2
+		if delay > RetryMaxDelay {
+			delay = RetryMaxDelay
+		}
+	}
+}
 
-	// Calculate LRC checksum (XOR of bytes 0-6, excluding sync byte)
-	lrc := byte(0)
-	for i := 0; i < 6; i++ {
-		lrc ^= header[i]
+// WaitReady blocks until any flash erase or program operation started by this
+// DebugPort has completed. It always waits out the fixed delay for the
+// operation: no firmware revision is known to report a busy flash, nor to
+// answer requests while it is busy, so an answer alone can't show the
+// operation has finished. With flash polling enabled it then also polls the
+// debug port until it answers, so a board that is still busy after the delay
+// isn't sent the next command, failing if that takes longer than the flash
+// timeout. If the context set with SetContext is done first, the operation is
+// still recorded as in progress, so the next WaitReady waits for it again.
+func (dp *DebugPort) WaitReady() error {
+	if dp.busyUntil.IsZero() {
+		return nil
 	}
 
-	// Include data in LRC if present
-	if data != nil && len(data) > 0 {
-		for _, b := range data {
-			lrc ^= b
+	var err error
+	if !dp.instant {
+		if wait := time.Until(dp.busyUntil); wait > 0 {
+			err = dp.sleep(wait)
+		}
+		if err == nil && dp.config.FlashPoll {
+			err = dp.pollReady()
 		}
 	}
+	if err != nil && dp.context().Err() != nil {
+		return err
+	}
 
-	// Build and send packet
-	var packet []byte
-	packet = append(packet, header...)
+	dp.busyUntil = time.Time{}
+	return err
+}
+
+// SetInstantFlash makes WaitReady return at once instead of waiting for flash
+// operations, for simulated devices that complete them immediately
+func (dp *DebugPort) SetInstantFlash(instant bool) {
+	dp.instant = instant
+}
+
+// pollReady sends revision requests until the debug port answers one. A
+// request that isn't answered times out and is sent again, until the flash
+// timeout has passed.
+func (dp *DebugPort) pollReady() error {
+	deadline := time.Now().Add(time.Duration(dp.config.FlashTimeout) * time.Second)
+	for {
+		_, err := dp.transferOnce(CMDRevision, 0, nil, 0)
+		if err == nil {
+			return nil
+		}
+
+		if resyncErr := dp.Resync(); resyncErr != nil {
+			return fmt.Errorf("%w (resync failed: %v)", err, resyncErr)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("flash operation did not complete within %d seconds: %w", dp.config.FlashTimeout, err)
+		}
+		if err := dp.sleep(FlashPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// setBusy records that the flash will be busy for the given duration
+func (dp *DebugPort) setBusy(d time.Duration) {
+	dp.busyUntil = time.Now().Add(d)
+}
+
+// Resync discards any partially received response so the next request starts
+// from a clean state. It is called automatically after a failed transfer.
+func (dp *DebugPort) Resync() error {
+	dp.status0 = 0
+	dp.status1 = 0
+	return dp.conn.Flush()
+}
+
+// isRepeatable returns true if sending the command twice has the same effect as
+// sending it once, so it can be retried after a corrupted response
+func isRepeatable(command byte) bool {
+	return command == CMDReadMem || command == CMDWriteMem || command == CMDRevision
+}
+
+// checkAddressRange refuses a memory read or write that reaches above
+// MaxAddress, which the 24-bit address of the request would wrap around to
+// low memory
+func checkAddressRange(command byte, address uint32, data []byte, readLength uint16) error {
+	if command != CMDReadMem && command != CMDWriteMem {
+		return nil
+	}
+	length := uint64(readLength)
+	if len(data) > 0 {
+		length = uint64(len(data))
+	}
+	if length == 0 {
+		length = 1
+	}
+	if uint64(address)+length-1 <= MaxAddress {
+		return nil
+	}
+	return unsupportedError("address 0x%08X is beyond the 16MB the debug port's 24-bit addresses reach", address)
+}
+
+// transferOnce performs a single request/response exchange
+func (dp *DebugPort) transferOnce(command byte, address uint32, data []byte, readLength uint16) (readBytes []byte, err error) {
+	// Reset status bytes
+	dp.status0 = 0
+	dp.status1 = 0
+
+	// Determine length
+	length := readLength
 	if data != nil && len(data) > 0 {
-		packet = append(packet, data...)
+		length = uint16(len(data))
 	}
-	packet = append(packet, lrc)
 
+	var lrcValid *bool
+	received := 0
+	if dp.tracer != nil {
+		start := time.Now()
+		defer func() {
+			record := TraceRecord{
+				Time:     start,
+				Command:  command,
+				Name:     CommandName(command),
+				Address:  address,
+				Length:   length,
+				Sent:     7 + len(data) + 1,
+				Received: received,
+				Status0:  dp.status0,
+				Status1:  dp.status1,
+				LRCValid: lrcValid,
+				Duration: time.Since(start).Microseconds(),
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			dp.tracer.Record(record)
+		}()
+	}
+
+	packet := buildPacket(command, address, data, length)
 	written, err := dp.conn.Write(packet)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write packet: %w", err)
+		return nil, connectionError(fmt.Errorf("failed to write packet: %w", err))
 	}
 	if written != len(packet) {
-		return nil, fmt.Errorf("incomplete write: wrote %d bytes, expected %d", written, len(packet))
+		return nil, connectionError(fmt.Errorf("incomplete write: wrote %d bytes, expected %d", written, len(packet)))
 	}
 
 	// Read response: wait for sync byte
@@ -111,7 +317,7 @@ func (dp *DebugPort) transfer(command byte, address uint32, data []byte, readLen
 	for syncByte != ResponseSyncByte {
 		buf, err := dp.conn.Read(1)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read sync byte: %w", err)
+			return nil, connectionError(fmt.Errorf("failed to read sync byte: %w", err))
 		}
 		syncByte = buf[0]
 	}
@@ -119,29 +325,89 @@ func (dp *DebugPort) transfer(command byte, address uint32, data []byte, readLen
 	// Read status bytes
 	statusBytes, err := dp.conn.Read(2)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read status bytes: %w", err)
+		return nil, connectionError(fmt.Errorf("failed to read status bytes: %w", err))
 	}
 	dp.status0 = statusBytes[0]
 	dp.status1 = statusBytes[1]
 
 	// Read data if requested
-	var readBytes []byte
 	if readLength > 0 {
 		readBytes, err = dp.conn.Read(int(readLength))
 		if err != nil {
-			return nil, fmt.Errorf("failed to read data: %w", err)
+			return nil, connectionError(fmt.Errorf("failed to read data: %w", err))
 		}
+		received = len(readBytes)
 	}
 
-	// Read LRC byte (but don't verify it for now)
-	_, err = dp.conn.Read(1)
+	// Read and verify LRC byte (XOR of the sync, status and data bytes)
+	lrcByte, err := dp.conn.Read(1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read LRC: %w", err)
+		return nil, connectionError(fmt.Errorf("failed to read LRC: %w", err))
 	}
 
+	valid, err := dp.checkLRC(lrcByte[0], readBytes)
+	lrcValid = &valid
+	if err != nil {
+		return nil, err
+	}
 	return readBytes, nil
 }
 
+// buildPacket returns the request packet for a command: the header, any data
+// and the LRC
+func buildPacket(command byte, address uint32, data []byte, length uint16) []byte {
+	// Build 7-byte header
+	header := make([]byte, 7)
+	header[0] = RequestSyncByte
+	header[1] = command
+
+	// Address is 24-bit (3 bytes), big-endian
+	header[2] = byte(address >> 16)
+	header[3] = byte(address >> 8)
+	header[4] = byte(address)
+
+	// Length is 16-bit (2 bytes), big-endian
+	binary.BigEndian.PutUint16(header[5:7], length)
+
+	// Calculate LRC checksum (XOR of bytes 0-6, excluding sync byte)
+	lrc := byte(0)
+	for i := 0; i < 6; i++ {
+		lrc ^= header[i]
+	}
+
+	// Include data in LRC if present
+	if data != nil && len(data) > 0 {
+		for _, b := range data {
+			lrc ^= b
+		}
+	}
+
+	// Build packet
+	var packet []byte
+	packet = append(packet, header...)
+	if data != nil && len(data) > 0 {
+		packet = append(packet, data...)
+	}
+	packet = append(packet, lrc)
+	return packet
+}
+
+// checkLRC checks the LRC byte of a response whose status bytes and data
+// have been read. A mismatch is counted, and is an error if verify_lrc is set.
+func (dp *DebugPort) checkLRC(lrc byte, data []byte) (bool, error) {
+	response := append([]byte{ResponseSyncByte, dp.status0, dp.status1}, data...)
+	expected := calculateLRC(response)
+	valid := lrc == expected
+	if !valid {
+		dp.stats.LRCErrors++
+	}
+
+	if dp.config.VerifyLRC && !valid {
+		return valid, protocolError(fmt.Errorf("%w: received 0x%02X, calculated 0x%02X", ErrLRCMismatch, lrc, expected))
+	}
+	return valid, nil
+}
+
 // EnterDebug sends the command to make the Foenix enter debug mode
 // This stops the CPU and enables debug commands
 func (dp *DebugPort) EnterDebug() error {
@@ -184,10 +450,127 @@ func (dp *DebugPort) ReadBlock(address uint32, length uint16) ([]byte, error) {
 	return dp.transfer(CMDReadMem, address, nil, length)
 }
 
+// MaxTransferSize is the largest number of bytes a single request can carry
+const MaxTransferSize = 0xFFFF
+
+// ReadRange reads length bytes starting at address. Unlike ReadBlock the
+// length isn't limited to one transfer: the read is split into transfers of
+// ChunkSize bytes, sent in batches to a bridge that takes them.
+func (dp *DebugPort) ReadRange(address uint32, length uint32) ([]byte, error) {
+	if length > uint32(dp.ChunkSize()) {
+		if b := dp.batcher(); b != nil {
+			return dp.readRangeBatched(b, address, length)
+		}
+	}
+
+	data := make([]byte, 0, length)
+	for uint32(len(data)) < length {
+		size := uint32(dp.ChunkSize())
+		if remaining := length - uint32(len(data)); remaining < size {
+			size = remaining
+		}
+
+		start := time.Now()
+		chunk, err := dp.ReadBlock(address, uint16(size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk at 0x%X: %w", address, err)
+		}
+		dp.recordChunk(int(size), time.Since(start))
+
+		data = append(data, chunk...)
+		address += size
+	}
+
+	return data, nil
+}
+
+// ChecksumRegion returns the CRC32 of length bytes of memory at address, as
+// computed by util.CalculateCRC32. No debug port revision this tool knows of
+// (RevB2, RevC4A) can compute it on the machine (see CapChecksum), so the
+// region is read back and the CRC computed here. Verify paths that need to
+// name the first difference read the memory back themselves instead, as that
+// costs the same single read.
+func (dp *DebugPort) ChecksumRegion(address uint32, length uint32) (uint32, error) {
+	data, err := dp.ReadRange(address, length)
+	if err != nil {
+		return 0, err
+	}
+	return util.CalculateCRC32(data), nil
+}
+
+// WriteRange writes data starting at address, split into transfers of
+// ChunkSize bytes (aligned to 4 bytes on 68040/68060 machines), sent in
+// batches to a bridge that takes them
+func (dp *DebugPort) WriteRange(address uint32, data []byte) error {
+	if len(data) > dp.ChunkSize() && !dp.config.VerifyWrites {
+		if b := dp.batcher(); b != nil {
+			return dp.writeRangeBatched(b, address, data)
+		}
+	}
+
+	for offset := 0; offset < len(data); {
+		size := dp.writeChunkSize(address, len(data)-offset)
+		if err := dp.writeRangeChunk(address, data[offset:offset+size]); err != nil {
+			return err
+		}
+
+		address += uint32(size)
+		offset += size
+	}
+
+	return nil
+}
+
+// writeRangeChunk writes one chunk of a longer write, timing it for adaptive
+// chunk sizing
+func (dp *DebugPort) writeRangeChunk(address uint32, chunk []byte) error {
+	start := time.Now()
+	if err := dp.WriteBlock(address, chunk); err != nil {
+		return fmt.Errorf("failed to write chunk at 0x%X: %w", address, err)
+	}
+	dp.recordChunk(len(chunk), time.Since(start))
+	return nil
+}
+
 // WriteBlock writes a block of data to the specified address
 // For 32-bit 680x0 CPUs (68040/68060), this automatically uses WriteBlock32 for alignment
+// With verify_writes set, the block is read back and written again up to the
+// configured number of retries if it doesn't match, so a corrupted upload is
+// caught when it happens rather than when the program crashes.
 func (dp *DebugPort) WriteBlock(address uint32, data []byte) error {
-	if dp.config.CPUIsM68k32() {
+	if !dp.config.VerifyWrites {
+		return dp.writeBlock(address, data)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := dp.writeBlock(address, data); err != nil {
+			return err
+		}
+		err := dp.verifyBlock(address, data)
+		if err == nil || !errors.Is(err, ErrVerify) || attempt >= dp.config.Retries {
+			return err
+		}
+	}
+}
+
+// verifyBlock reads back a written block and compares it with data
+func (dp *DebugPort) verifyBlock(address uint32, data []byte) error {
+	actual, err := dp.ReadRange(address, uint32(len(data)))
+	if err != nil {
+		return fmt.Errorf("failed to read back written data: %w", err)
+	}
+	for i := range data {
+		if actual[i] != data[i] {
+			return fmt.Errorf("%w at 0x%06X: wrote %02X, read back %02X",
+				ErrVerify, address+uint32(i), data[i], actual[i])
+		}
+	}
+	return nil
+}
+
+// writeBlock writes a block of data without verifying it
+func (dp *DebugPort) writeBlock(address uint32, data []byte) error {
+	if dp.alignment() == 4 {
 		// For 68040 and 68060, use 32-bit aligned writes
 		return dp.WriteBlock32(address, data)
 	}
@@ -205,24 +588,40 @@ func (dp *DebugPort) EraseFlash() error {
 
 // EraseSector erases an 8KB sector of flash memory
 // Note: Sectors are 8KB blocks, but physically erased as two consecutive 4KB blocks
+// EraseSector returns while the second block is still being erased; the next
+// command waits for it to finish.
 func (dp *DebugPort) EraseSector(sector uint8) error {
+	if err := checkFlashPage(sector); err != nil {
+		return err
+	}
+
 	// Erase first 4KB block
-	address1 := uint32(sector*2) << 16
+	address1 := uint32(sector) * 2 << 16
 	if _, err := dp.transfer(CMDEraseSector, address1, nil, 0); err != nil {
 		return fmt.Errorf("failed to erase first 4KB block: %w", err)
 	}
-	time.Sleep(DelayEraseSector)
+	dp.setBusy(DelayEraseSector)
 
 	// Erase second 4KB block
-	address2 := uint32(sector*2+1) << 16
+	address2 := (uint32(sector)*2 + 1) << 16
 	if _, err := dp.transfer(CMDEraseSector, address2, nil, 0); err != nil {
 		return fmt.Errorf("failed to erase second 4KB block: %w", err)
 	}
-	time.Sleep(DelayEraseSector)
+	dp.setBusy(DelayEraseSector)
 
 	return nil
 }
 
+// checkFlashPage returns an error for an 8KB flash page the sector commands
+// can't address: the page number is sent doubled in the top byte of the
+// 24-bit address, so pages above MaxFlashPage would wrap around
+func checkFlashPage(page uint8) error {
+	if page > MaxFlashPage {
+		return fmt.Errorf("flash page 0x%02X is beyond 0x%02X, the last page the debug port can address", page, MaxFlashPage)
+	}
+	return nil
+}
+
 // ProgramFlash programs the entire flash memory
 // Data should already be loaded in RAM at the specified address
 func (dp *DebugPort) ProgramFlash(address uint32) error {
@@ -232,13 +631,18 @@ func (dp *DebugPort) ProgramFlash(address uint32) error {
 
 // ProgramSector programs an 8KB sector of flash memory
 // Data should already be loaded into RAM at addresses 0x00000 - 0x02000
+// ProgramSector returns while the sector is still being programmed; the next
+// command waits for it to finish.
 func (dp *DebugPort) ProgramSector(sector uint8) error {
-	address := uint32(sector*2) << 16
+	if err := checkFlashPage(sector); err != nil {
+		return err
+	}
+	address := uint32(sector) * 2 << 16
 	_, err := dp.transfer(CMDProgramSector, address, nil, 0)
 	if err != nil {
 		return err
 	}
-	time.Sleep(DelayProgramSector)
+	dp.setBusy(DelayProgramSector)
 	return nil
 }
 
@@ -0,0 +1,470 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/util"
+)
+
+// fakeConn is a scripted connection: each Write consumes the next queued
+// response, which subsequent Reads return byte by byte
+type fakeConn struct {
+	responses [][]byte
+	pending   []byte
+	writes    [][]byte
+	flushes   int
+}
+
+func (f *fakeConn) Open(port string) error { return nil }
+func (f *fakeConn) Close() error           { return nil }
+func (f *fakeConn) IsOpen() bool           { return true }
+
+func (f *fakeConn) Write(data []byte) (int, error) {
+	f.writes = append(f.writes, append([]byte(nil), data...))
+	if len(f.responses) > 0 {
+		f.pending = append(f.pending, f.responses[0]...)
+		f.responses = f.responses[1:]
+	}
+	return len(data), nil
+}
+
+func (f *fakeConn) Flush() error {
+	f.pending = nil
+	f.flushes++
+	return nil
+}
+
+func (f *fakeConn) Read(n int) ([]byte, error) {
+	if len(f.pending) < n {
+		return nil, fmt.Errorf("fake read timeout")
+	}
+	buf := f.pending[:n]
+	f.pending = f.pending[n:]
+	return buf, nil
+}
+
+// response builds a response packet with a correct LRC
+func response(status0, status1 byte, data ...byte) []byte {
+	packet := append([]byte{ResponseSyncByte, status0, status1}, data...)
+	return append(packet, calculateLRC(packet))
+}
+
+// corrupt returns a copy of packet with a broken LRC byte
+func corrupt(packet []byte) []byte {
+	bad := append([]byte(nil), packet...)
+	bad[len(bad)-1] ^= 0xFF
+	return bad
+}
+
+func TestTransferVerifiesLRC(t *testing.T) {
+	good := response(0x00, 0x01, 0xDE, 0xAD)
+
+	tests := []struct {
+		name       string
+		verifyLRC  bool
+		retries    int
+		responses  [][]byte
+		wantErr    error
+		wantWrites int
+	}{
+		{"Valid response", true, 3, [][]byte{good}, nil, 1},
+		{"Corrupted then valid", true, 3, [][]byte{corrupt(good), good}, nil, 2},
+		{"Retries exhausted", true, 1, [][]byte{corrupt(good), corrupt(good)}, ErrLRCMismatch, 2},
+		{"Verification disabled", false, 3, [][]byte{corrupt(good)}, nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{responses: tt.responses}
+			dp := NewDebugPort(conn, &config.Config{VerifyLRC: tt.verifyLRC, Retries: tt.retries})
+			dp.retryDelay = 0
+
+			data, err := dp.ReadBlock(0x1000, 2)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadBlock() error = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("ReadBlock() unexpected error: %v", err)
+				}
+				if len(data) != 2 || data[0] != 0xDE || data[1] != 0xAD {
+					t.Errorf("ReadBlock() = % X, want DE AD", data)
+				}
+			}
+
+			if len(conn.writes) != tt.wantWrites {
+				t.Errorf("sent %d requests, want %d", len(conn.writes), tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestLinkStats(t *testing.T) {
+	good := response(0x00, 0x01, 0xDE, 0xAD)
+
+	conn := &fakeConn{responses: [][]byte{corrupt(good), good, good}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, Retries: 3})
+	dp.retryDelay = 0
+	for i := 0; i < 2; i++ {
+		if _, err := dp.ReadBlock(0x1000, 2); err != nil {
+			t.Fatalf("ReadBlock() error: %v", err)
+		}
+	}
+	want := LinkStats{Transfers: 2, Failures: 1, Retries: 1, LRCErrors: 1}
+	if got := dp.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// Corrupted responses are counted even when they aren't rejected
+	dp.ResetStats()
+	dp.config.VerifyLRC = false
+	conn.responses = [][]byte{corrupt(good)}
+	if _, err := dp.ReadBlock(0x1000, 2); err != nil {
+		t.Fatalf("ReadBlock() error: %v", err)
+	}
+	want = LinkStats{Transfers: 1, LRCErrors: 1}
+	if got := dp.Stats(); got != want {
+		t.Errorf("Stats() without LRC verification = %+v, want %+v", got, want)
+	}
+}
+
+func TestTransferDoesNotRepeatFlashCommands(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{corrupt(response(0, 0)), response(0, 0)}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, Retries: 3})
+	dp.retryDelay = 0
+
+	if err := dp.EraseFlash(); !errors.Is(err, ErrLRCMismatch) {
+		t.Fatalf("EraseFlash() error = %v, want %v", err, ErrLRCMismatch)
+	}
+	if len(conn.writes) != 1 {
+		t.Errorf("sent %d requests, want 1", len(conn.writes))
+	}
+}
+
+func TestTransferResyncsAfterTruncatedResponse(t *testing.T) {
+	good := response(0x00, 0x00, 0x42)
+
+	// The first response is cut short, so the read times out with part of it
+	// still buffered; the leftovers must be discarded and the request re-sent
+	conn := &fakeConn{responses: [][]byte{good[:4], good}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, Retries: 2})
+	dp.retryDelay = 0
+
+	data, err := dp.ReadBlock(0x2000, 1)
+	if err != nil {
+		t.Fatalf("ReadBlock() unexpected error: %v", err)
+	}
+	if len(data) != 1 || data[0] != 0x42 {
+		t.Errorf("ReadBlock() = % X, want 42", data)
+	}
+	if conn.flushes != 1 {
+		t.Errorf("flushed %d times, want 1", conn.flushes)
+	}
+	if len(conn.writes) != 2 {
+		t.Errorf("sent %d requests, want 2", len(conn.writes))
+	}
+}
+
+func TestCommandsWaitForFlashOperations(t *testing.T) {
+	const busy = 100 * time.Millisecond
+
+	conn := &fakeConn{responses: [][]byte{response(0, 0), response(0, 0, 0x00)}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true})
+
+	// Memory writes outside the sector buffer wait too: the debug port isn't
+	// known to take writes while the flash is busy
+	dp.setBusy(busy)
+	start := time.Now()
+	if err := dp.WriteBlock(0x2000, []byte{0x01}); err != nil {
+		t.Fatalf("WriteBlock() unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < busy {
+		t.Errorf("write during a flash operation only waited %v, want at least %v", elapsed, busy)
+	}
+
+	dp.setBusy(busy)
+	start = time.Now()
+	if _, err := dp.ReadBlock(0x0000, 1); err != nil {
+		t.Fatalf("ReadBlock() unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < busy {
+		t.Errorf("read during erase only waited %v, want at least %v", elapsed, busy)
+	}
+}
+
+func TestWaitReadyPollsUntilAnswered(t *testing.T) {
+	const busy = 50 * time.Millisecond
+
+	// The fixed delay is waited out before polling, as an answer alone doesn't
+	// show the flash has finished. The first poll then goes unanswered, as
+	// from a board that is still busy.
+	conn := &fakeConn{responses: [][]byte{nil, response(0, 0)}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, FlashPoll: true, FlashTimeout: 5})
+	dp.setBusy(busy)
+
+	start := time.Now()
+	if err := dp.WaitReady(); err != nil {
+		t.Fatalf("WaitReady() unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < busy {
+		t.Errorf("WaitReady() returned after %v, before the %v delay", elapsed, busy)
+	}
+	if len(conn.writes) != 2 {
+		t.Errorf("sent %d polls, want 2", len(conn.writes))
+	}
+	if conn.writes[0][1] != CMDRevision {
+		t.Errorf("poll command = 0x%02X, want 0x%02X", conn.writes[0][1], CMDRevision)
+	}
+
+	// Nothing is pending any more
+	if err := dp.WaitReady(); err != nil || len(conn.writes) != 2 {
+		t.Errorf("second WaitReady() = %v after %d polls, want no new polls", err, len(conn.writes))
+	}
+}
+
+func TestWaitReadyPollTimeout(t *testing.T) {
+	conn := &fakeConn{}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, FlashPoll: true, FlashTimeout: 0})
+	dp.setBusy(time.Millisecond)
+
+	if err := dp.WaitReady(); err == nil {
+		t.Error("WaitReady() expected timeout error")
+	}
+}
+
+func TestWaitReadyInstantFlash(t *testing.T) {
+	conn := &fakeConn{}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, FlashPoll: true})
+	dp.SetInstantFlash(true)
+	dp.setBusy(time.Hour)
+
+	if err := dp.WaitReady(); err != nil {
+		t.Fatalf("WaitReady() unexpected error: %v", err)
+	}
+	if len(conn.writes) != 0 {
+		t.Errorf("sent %d polls, want none", len(conn.writes))
+	}
+}
+
+func TestTraceRecordsExchanges(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{response(0x00, 0x01, 0xDE, 0xAD), corrupt(response(0, 0))}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true})
+
+	var buf bytes.Buffer
+	dp.SetTracer(NewTracer(&buf))
+
+	if _, err := dp.ReadBlock(0x1234, 2); err != nil {
+		t.Fatalf("ReadBlock() error: %v", err)
+	}
+	if err := dp.StopCPU(); err == nil {
+		t.Fatal("StopCPU() succeeded with a corrupted response")
+	}
+
+	records, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatalf("ReadTrace() error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	read := records[0]
+	if read.Name != "READ_MEM" || read.Address != 0x1234 || read.Length != 2 || read.Received != 2 ||
+		read.Status1 != 0x01 || read.LRCValid == nil || !*read.LRCValid || read.Error != "" {
+		t.Errorf("read record = %+v", read)
+	}
+
+	stop := records[1]
+	if stop.Name != "STOP_CPU" || stop.LRCValid == nil || *stop.LRCValid || stop.Error == "" {
+		t.Errorf("stop record = %+v", stop)
+	}
+	if !strings.Contains(stop.String(), "lrc BAD") || !strings.Contains(stop.String(), "ERROR:") {
+		t.Errorf("String() = %q", stop.String())
+	}
+}
+
+func TestTracerFunc(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{response(0, 0)}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true})
+
+	var names []string
+	dp.SetTracer(NewTracerFunc(func(r TraceRecord) {
+		names = append(names, r.Name)
+	}))
+
+	if err := dp.StartCPU(); err != nil {
+		t.Fatalf("StartCPU() error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "START_CPU" {
+		t.Errorf("traced %v, want [START_CPU]", names)
+	}
+}
+
+func TestReadRangeSplitsIntoChunks(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{
+		response(0, 0, 0, 1, 2, 3),
+		response(0, 0, 4, 5, 6, 7),
+		response(0, 0, 8, 9),
+	}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, ChunkSize: 4})
+
+	data, err := dp.ReadRange(0x1000, 10)
+	if err != nil {
+		t.Fatalf("ReadRange() error: %v", err)
+	}
+	if want := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !bytes.Equal(data, want) {
+		t.Errorf("ReadRange() = % X, want % X", data, want)
+	}
+
+	// Each request asks for the next chunk: address in bytes 2-4, length in 5-6
+	wantRequests := []struct {
+		address uint32
+		length  uint16
+	}{{0x1000, 4}, {0x1004, 4}, {0x1008, 2}}
+	if len(conn.writes) != len(wantRequests) {
+		t.Fatalf("sent %d requests, want %d", len(conn.writes), len(wantRequests))
+	}
+	for i, want := range wantRequests {
+		w := conn.writes[i]
+		address := uint32(w[2])<<16 | uint32(w[3])<<8 | uint32(w[4])
+		length := uint16(w[5])<<8 | uint16(w[6])
+		if address != want.address || length != want.length {
+			t.Errorf("request %d = %06X/%d, want %06X/%d", i, address, length, want.address, want.length)
+		}
+	}
+}
+
+func TestCancelledContextStopsTransfers(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{response(0, 0)}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dp.SetContext(ctx)
+	cancel()
+	if err := dp.WriteBlock(0, []byte{1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteBlock() = %v, want context.Canceled", err)
+	}
+	if len(conn.writes) != 0 {
+		t.Errorf("sent %d requests after cancellation, want none", len(conn.writes))
+	}
+
+	// Cleanup works again once the context is cleared
+	dp.SetContext(nil)
+	if err := dp.WriteBlock(0, []byte{1}); err != nil {
+		t.Errorf("WriteBlock() after SetContext(nil) error: %v", err)
+	}
+}
+
+func TestCancelledWaitKeepsFlashBusy(t *testing.T) {
+	conn := &fakeConn{}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true})
+	dp.setBusy(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	dp.SetContext(ctx)
+	if err := dp.WaitReady(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitReady() = %v, want context.DeadlineExceeded", err)
+	}
+	if dp.busyUntil.IsZero() {
+		t.Error("cancelled WaitReady() forgot the flash operation in progress")
+	}
+}
+
+func TestVerifyWritesRewritesMismatchedBlocks(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{
+		response(0, 0),             // Write
+		response(0, 0, 0xAA, 0x00), // Read back, second byte lost
+		response(0, 0),             // Write again
+		response(0, 0, 0xAA, 0xBB), // Read back
+	}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, VerifyWrites: true, Retries: 1, ChunkSize: 16})
+
+	if err := dp.WriteBlock(0x2000, []byte{0xAA, 0xBB}); err != nil {
+		t.Fatalf("WriteBlock() error: %v", err)
+	}
+	if len(conn.writes) != 4 {
+		t.Errorf("sent %d requests, want 4", len(conn.writes))
+	}
+}
+
+func TestVerifyWritesGivesUp(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{
+		response(0, 0),
+		response(0, 0, 0xAA, 0x00),
+		response(0, 0),
+		response(0, 0, 0xAA, 0x00),
+	}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, VerifyWrites: true, Retries: 1, ChunkSize: 16})
+
+	err := dp.WriteBlock(0x2000, []byte{0xAA, 0xBB})
+	if !errors.Is(err, ErrVerify) {
+		t.Fatalf("WriteBlock() error = %v, want %v", err, ErrVerify)
+	}
+	if !strings.Contains(err.Error(), "0x002001") {
+		t.Errorf("WriteBlock() error = %v, want the mismatching address", err)
+	}
+}
+
+func TestChecksumRegion(t *testing.T) {
+	conn := &fakeConn{responses: [][]byte{response(0, 0, 1, 2, 3, 4), response(0, 0, 5)}}
+	dp := NewDebugPort(conn, &config.Config{VerifyLRC: true, ChunkSize: 4})
+
+	crc, err := dp.ChecksumRegion(0x1000, 5)
+	if err != nil {
+		t.Fatalf("ChecksumRegion() error: %v", err)
+	}
+	if want := util.CalculateCRC32([]byte{1, 2, 3, 4, 5}); crc != want {
+		t.Errorf("ChecksumRegion() = %08X, want %08X", crc, want)
+	}
+}
+
+func TestAddressBeyond16MB(t *testing.T) {
+	// No machine has a documented way to reach memory above 16MB, so a
+	// transfer that goes past it is refused rather than wrapped around
+	for _, target := range []string{"", "f256k", "a2560"} {
+		cfg := config.Default()
+		if target != "" {
+			if err := cfg.SetTarget(target); err != nil {
+				t.Fatalf("SetTarget(%s) error: %v", target, err)
+			}
+		}
+		conn := &fakeConn{}
+		dp := NewDebugPort(conn, cfg)
+
+		if _, err := dp.ReadBlock(0x01000000, 1); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: ReadBlock() above 16MB = %v, want ErrUnsupported", target, err)
+		}
+		if err := dp.WriteBlock(0xFFFFFE, []byte{1, 2, 3}); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: WriteBlock() across 16MB = %v, want ErrUnsupported", target, err)
+		}
+		if len(conn.writes) != 0 {
+			t.Errorf("%s: %d requests sent, want none", target, len(conn.writes))
+		}
+	}
+}
+
+func TestFlashPageBeyondAddress(t *testing.T) {
+	// Page numbers are sent doubled in the top address byte, so page 0x80
+	// would wrap around to page 0 in 8 bits
+	conn := &fakeConn{}
+	dp := NewDebugPort(conn, config.Default())
+
+	if err := dp.EraseSector(MaxFlashPage + 1); err == nil {
+		t.Error("EraseSector(0x80) succeeded, want an error")
+	}
+	if err := dp.ProgramSector(MaxFlashPage + 1); err == nil {
+		t.Error("ProgramSector(0x80) succeeded, want an error")
+	}
+	if len(conn.writes) != 0 {
+		t.Errorf("%d requests sent, want none", len(conn.writes))
+	}
+}
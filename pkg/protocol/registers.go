@@ -0,0 +1,177 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/daschewie/foenixmgr/pkg/cpu"
+)
+
+// Register is a single CPU register read from the register snapshot
+type Register struct {
+	Name  string
+	Value uint32
+	Width int // Size in bytes
+}
+
+// String formats the register value with as many hex digits as its width
+func (r Register) String() string {
+	return fmt.Sprintf("%0*X", r.Width*2, r.Value)
+}
+
+// RegisterSet is a decoded register snapshot
+type RegisterSet struct {
+	Registers []Register
+	Flags     string // Status flags, upper case when set
+}
+
+// Get returns the named register
+func (rs *RegisterSet) Get(name string) (Register, bool) {
+	for _, r := range rs.Registers {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Register{}, false
+}
+
+// PC returns the program counter, including the program bank on a 65816
+func (rs *RegisterSet) PC() uint32 {
+	pc, _ := rs.Get("PC")
+	if pbr, ok := rs.Get("PBR"); ok {
+		return pbr.Value<<16 | pc.Value
+	}
+	return pc.Value
+}
+
+// Register snapshot layouts. The debug port can't read CPU registers, and no
+// machine firmware saves them, so the snapshot is a convention: the user's own
+// code on the machine (a BRK or NMI handler, or a monitor) writes the
+// registers in this layout to the address given as register_address of the
+// target machine. No built-in machine sets register_address.
+//
+//	65C02:  PC(2) A X Y SP P                                   (little-endian)
+//	65816:  PC(2) PBR A(2) X(2) Y(2) SP(2) DP(2) DBR P E        (little-endian)
+//	680x0:  D0-D7(4 each) A0-A7(4 each) PC(4) SR(2)             (big-endian)
+const (
+	RegisterSize65C02 = 7
+	RegisterSize65816 = 16
+	RegisterSize680X0 = 70
+)
+
+// RegisterSnapshotSize returns the number of bytes in the register snapshot
+// for a CPU
+func RegisterSnapshotSize(cpuName string) (int, error) {
+	c, err := cpu.Lookup(cpuName)
+	if err != nil {
+		return 0, fmt.Errorf("no register layout for CPU %s", cpuName)
+	}
+	switch c.Family() {
+	case cpu.Family65C02:
+		return RegisterSize65C02, nil
+	case cpu.Family65816:
+		return RegisterSize65816, nil
+	case cpu.Family680X0:
+		return RegisterSize680X0, nil
+	}
+	return 0, fmt.Errorf("no register layout for CPU %s", cpuName)
+}
+
+// DecodeRegisters decodes a register snapshot for a CPU
+func DecodeRegisters(cpuName string, data []byte) (*RegisterSet, error) {
+	size, err := RegisterSnapshotSize(cpuName)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, fmt.Errorf("register snapshot too short: %d bytes, need %d", len(data), size)
+	}
+
+	c, _ := cpu.Lookup(cpuName)
+	switch c.Family() {
+	case cpu.Family65C02:
+		return &RegisterSet{
+			Registers: []Register{
+				{"PC", uint32(binary.LittleEndian.Uint16(data[0:2])), 2},
+				{"A", uint32(data[2]), 1},
+				{"X", uint32(data[3]), 1},
+				{"Y", uint32(data[4]), 1},
+				{"SP", 0x0100 | uint32(data[5]), 2},
+				{"P", uint32(data[6]), 1},
+			},
+			Flags: formatFlags(uint32(data[6]), "NV-BDIZC"),
+		}, nil
+
+	case cpu.Family65816:
+		emulation := data[15]&0x01 != 0
+		flags := formatFlags(uint32(data[14]), "NVMXDIZC")
+		if emulation {
+			flags += " E"
+		} else {
+			flags += " e"
+		}
+		return &RegisterSet{
+			Registers: []Register{
+				{"PC", uint32(binary.LittleEndian.Uint16(data[0:2])), 2},
+				{"PBR", uint32(data[2]), 1},
+				{"A", uint32(binary.LittleEndian.Uint16(data[3:5])), 2},
+				{"X", uint32(binary.LittleEndian.Uint16(data[5:7])), 2},
+				{"Y", uint32(binary.LittleEndian.Uint16(data[7:9])), 2},
+				{"SP", uint32(binary.LittleEndian.Uint16(data[9:11])), 2},
+				{"DP", uint32(binary.LittleEndian.Uint16(data[11:13])), 2},
+				{"DBR", uint32(data[13]), 1},
+				{"P", uint32(data[14]), 1},
+			},
+			Flags: flags,
+		}, nil
+
+	default: // 680x0
+		rs := &RegisterSet{}
+		for i := 0; i < 8; i++ {
+			rs.Registers = append(rs.Registers, Register{fmt.Sprintf("D%d", i), binary.BigEndian.Uint32(data[i*4:]), 4})
+		}
+		for i := 0; i < 8; i++ {
+			rs.Registers = append(rs.Registers, Register{fmt.Sprintf("A%d", i), binary.BigEndian.Uint32(data[32+i*4:]), 4})
+		}
+		sr := uint32(binary.BigEndian.Uint16(data[68:70]))
+		rs.Registers = append(rs.Registers,
+			Register{"PC", binary.BigEndian.Uint32(data[64:68]), 4},
+			Register{"SR", sr, 2})
+		rs.Flags = fmt.Sprintf("%s I%d %s", formatFlags(sr>>13, "T-S"), (sr>>8)&0x07, formatFlags(sr, "XNZVC"))
+		return rs, nil
+	}
+}
+
+// formatFlags shows each flag letter in upper case when its bit is set and in
+// lower case when clear. The last letter is bit 0; '-' marks unused bits.
+func formatFlags(value uint32, names string) string {
+	var sb strings.Builder
+	for i, name := range names {
+		bit := uint(len(names) - 1 - i)
+		switch {
+		case name == '-':
+			sb.WriteRune('-')
+		case value&(1<<bit) != 0:
+			sb.WriteRune(name)
+		default:
+			sb.WriteString(strings.ToLower(string(name)))
+		}
+	}
+	return sb.String()
+}
+
+// ReadRegisters reads and decodes the register snapshot at address
+func (dp *DebugPort) ReadRegisters(address uint32, cpuName string) (*RegisterSet, error) {
+	size, err := RegisterSnapshotSize(cpuName)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dp.ReadBlock(address, uint16(size))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read register snapshot: %w", err)
+	}
+
+	return DecodeRegisters(cpuName, data)
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import "testing"
+
+func TestDecodeRegisters65C02(t *testing.T) {
+	rs, err := DecodeRegisters("65C02", []byte{0x34, 0x12, 0xAA, 0xBB, 0xCC, 0xFD, 0b10100011})
+	if err != nil {
+		t.Fatalf("DecodeRegisters() error: %v", err)
+	}
+
+	want := map[string]string{"PC": "1234", "A": "AA", "X": "BB", "Y": "CC", "SP": "01FD", "P": "A3"}
+	for name, value := range want {
+		r, ok := rs.Get(name)
+		if !ok || r.String() != value {
+			t.Errorf("%s = %s, want %s", name, r, value)
+		}
+	}
+	if rs.Flags != "Nv-bdiZC" {
+		t.Errorf("Flags = %s, want Nv-bdiZC", rs.Flags)
+	}
+	if rs.PC() != 0x1234 {
+		t.Errorf("PC() = %X, want 1234", rs.PC())
+	}
+}
+
+func TestDecodeRegisters65816(t *testing.T) {
+	data := []byte{
+		0x00, 0x80, // PC
+		0x03,       // PBR
+		0x01, 0x00, // A
+		0x02, 0x00, // X
+		0x03, 0x00, // Y
+		0xFF, 0x01, // SP
+		0x00, 0x00, // DP
+		0x00, // DBR
+		0x30, // P (M and X set)
+		0x00, // Native mode
+	}
+
+	rs, err := DecodeRegisters("65816", data)
+	if err != nil {
+		t.Fatalf("DecodeRegisters() error: %v", err)
+	}
+	if rs.PC() != 0x038000 {
+		t.Errorf("PC() = %X, want 38000", rs.PC())
+	}
+	if rs.Flags != "nvMXdizc e" {
+		t.Errorf("Flags = %s, want nvMXdizc e", rs.Flags)
+	}
+}
+
+func TestDecodeRegisters680X0(t *testing.T) {
+	data := make([]byte, RegisterSize680X0)
+	data[3] = 0x42                                               // D0
+	data[32+7*4+1] = 0x10                                        // A7 = 00100000
+	data[64], data[65], data[66], data[67] = 0, 0x38, 0x00, 0x10 // PC
+	data[68], data[69] = 0x27, 0x04                              // SR: S, I7, Z
+
+	rs, err := DecodeRegisters("68040", data)
+	if err != nil {
+		t.Fatalf("DecodeRegisters() error: %v", err)
+	}
+	if d0, _ := rs.Get("D0"); d0.Value != 0x42 {
+		t.Errorf("D0 = %s, want 00000042", d0)
+	}
+	if a7, _ := rs.Get("A7"); a7.Value != 0x00100000 {
+		t.Errorf("A7 = %s, want 00100000", a7)
+	}
+	if rs.PC() != 0x380010 {
+		t.Errorf("PC() = %X, want 380010", rs.PC())
+	}
+	if rs.Flags != "t-S I7 xnZvc" {
+		t.Errorf("Flags = %s, want t-S I7 xnZvc", rs.Flags)
+	}
+}
+
+func TestDecodeRegistersErrors(t *testing.T) {
+	if _, err := DecodeRegisters("z80", make([]byte, 16)); err == nil {
+		t.Error("DecodeRegisters() expected error for unknown CPU")
+	}
+	if _, err := DecodeRegisters("65c02", make([]byte, 3)); err == nil {
+		t.Error("DecodeRegisters() expected error for short snapshot")
+	}
+}
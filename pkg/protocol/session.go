@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/connection"
+)
+
+// Session keeps a connection and its DebugPort open across several operations,
+// so interactive and batch commands only pay for opening the port and entering
+// debug mode once instead of once per operation.
+type Session struct {
+	conn    connection.Connection
+	dp      *DebugPort
+	inDebug bool
+}
+
+// OpenSession opens the connection configured in cfg and wraps it in a DebugPort
+func OpenSession(cfg *config.Config) (*Session, error) {
+	conn := connection.NewConnection(cfg.Port, cfg)
+	if err := conn.Open(cfg.Port); err != nil {
+		return nil, &Error{Kind: ErrConnection, Err: fmt.Errorf("failed to open connection: %w", err)}
+	}
+
+	return NewSession(conn, cfg), nil
+}
+
+// NewSession wraps an already open connection in a Session
+func NewSession(conn connection.Connection, cfg *config.Config) *Session {
+	return &Session{
+		conn: conn,
+		dp:   NewDebugPort(conn, cfg),
+	}
+}
+
+// Connection returns the underlying connection for this session
+func (s *Session) Connection() connection.Connection {
+	return s.conn
+}
+
+// DebugPort returns the protocol handler for this session
+func (s *Session) DebugPort() *DebugPort {
+	return s.dp
+}
+
+// InDebug returns true if this session has put the machine into debug mode
+func (s *Session) InDebug() bool {
+	return s.inDebug
+}
+
+// EnterDebug puts the machine into debug mode unless this session already did
+func (s *Session) EnterDebug() error {
+	if s.inDebug {
+		return nil
+	}
+	if err := s.dp.EnterDebug(); err != nil {
+		return err
+	}
+	s.inDebug = true
+	return nil
+}
+
+// ExitDebug takes the machine out of debug mode, which resets the CPU
+// Later operations must call EnterDebug again before talking to the machine.
+// The session counts as in debug mode until the command has been sent.
+func (s *Session) ExitDebug() error {
+	err := s.dp.ExitDebug()
+	s.inDebug = false
+	return err
+}
+
+// ReleaseDebug forgets that this session entered debug mode, so Close leaves
+// the machine in debug mode (used when the CPU is deliberately left stopped)
+func (s *Session) ReleaseDebug() {
+	s.inDebug = false
+}
+
+// Close leaves debug mode if this session entered it and closes the connection
+func (s *Session) Close() error {
+	var exitErr error
+	if s.inDebug {
+		exitErr = s.ExitDebug()
+	}
+	if err := s.conn.Close(); err != nil {
+		return err
+	}
+	return exitErr
+}
@@ -0,0 +1,20 @@
+package protocol
+
+// LinkStats counts the exchanges of a DebugPort and the errors seen on the
+// link, to judge how reliable a connection is at its data rate
+type LinkStats struct {
+	Transfers int // Exchanges that succeeded, possibly after retries
+	Failures  int // Attempts that failed, whether retried or not
+	Retries   int // Attempts repeated after a failure
+	LRCErrors int // Responses whose LRC didn't match, even if not verified
+}
+
+// Stats returns the counts since the DebugPort was created or ResetStats
+func (dp *DebugPort) Stats() LinkStats {
+	return dp.stats
+}
+
+// ResetStats starts the counts from zero
+func (dp *DebugPort) ResetStats() {
+	dp.stats = LinkStats{}
+}
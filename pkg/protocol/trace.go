@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceRecord is one request/response exchange with the debug port
+type TraceRecord struct {
+	Time     time.Time `json:"time"`
+	Command  byte      `json:"command"`
+	Name     string    `json:"name"`
+	Address  uint32    `json:"address"`
+	Length   uint16    `json:"length"`
+	Sent     int       `json:"sent"`     // Request packet size in bytes
+	Received int       `json:"received"` // Response data bytes received
+	Status0  byte      `json:"status0"`
+	Status1  byte      `json:"status1"`
+	LRCValid *bool     `json:"lrc_valid,omitempty"` // Unset if no LRC was received
+	Duration int64     `json:"duration_us"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// String formats the record as one line of a trace listing
+func (r TraceRecord) String() string {
+	lrc := "-"
+	if r.LRCValid != nil {
+		lrc = "ok"
+		if !*r.LRCValid {
+			lrc = "BAD"
+		}
+	}
+
+	line := fmt.Sprintf("%s  %-14s  %06X  len %04X  status %02X %02X  lrc %-3s  %8.3fms",
+		r.Time.Format("15:04:05.000000"), r.Name, r.Address, r.Length,
+		r.Status0, r.Status1, lrc, float64(r.Duration)/1000)
+	if r.Error != "" {
+		line += "  ERROR: " + r.Error
+	}
+	return line
+}
+
+// Tracer writes a TraceRecord as a line of JSON for every exchange, or passes
+// it to a function
+type Tracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	fn  func(TraceRecord)
+}
+
+// NewTracer returns a tracer writing to w
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{enc: json.NewEncoder(w)}
+}
+
+// NewTracerFunc returns a tracer that calls fn for every exchange
+func NewTracerFunc(fn func(TraceRecord)) *Tracer {
+	return &Tracer{fn: fn}
+}
+
+// Record writes one record. Write errors are ignored so tracing never breaks
+// the operation being traced.
+func (t *Tracer) Record(r TraceRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fn != nil {
+		t.fn(r)
+		return
+	}
+	t.enc.Encode(r)
+}
+
+// SetTracer records every exchange on this DebugPort with t; nil stops tracing
+func (dp *DebugPort) SetTracer(t *Tracer) {
+	dp.tracer = t
+}
+
+// ReadTrace reads the records of a trace file. Blank lines are skipped.
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	var records []TraceRecord
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record TraceRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
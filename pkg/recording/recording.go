@@ -0,0 +1,276 @@
+// Package recording records the raw traffic of a debug port session to a
+// file, and replays it against another connection such as the mock device, so
+// a problem can be filed as a reproducible bug report and protocol changes
+// tested without hardware.
+//
+// A recording is a line of JSON with its Header, followed by a line of JSON
+// for every Event on the connection, in order.
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// Format names a recording in its header
+const Format = "foenixmgr-session"
+
+// Version is the version of the recording format
+const Version = 1
+
+// Header describes a recorded session
+type Header struct {
+	Format       string    `json:"format"`
+	Version      int       `json:"version"`
+	Started      time.Time `json:"started"`
+	Command      []string  `json:"command,omitempty"` // Command line of the session
+	Port         string    `json:"port"`
+	CPU          string    `json:"cpu,omitempty"`
+	Target       string    `json:"target,omitempty"`
+	FlashSize    int       `json:"flash_size,omitempty"`
+	FlashAddress string    `json:"flash_address,omitempty"`
+}
+
+// Event operations
+const (
+	OpWrite = "write" // Bytes sent to the device
+	OpRead  = "read"  // Bytes received from it
+	OpFlush = "flush" // Unread input discarded to resynchronize
+)
+
+// Event is one operation on the connection
+type Event struct {
+	Time   int64  `json:"t"` // Microseconds since the recording started
+	Op     string `json:"op"`
+	Data   string `json:"data,omitempty"`   // Bytes written or read, in hex
+	Length int    `json:"length,omitempty"` // Bytes a read asked for
+	Error  string `json:"error,omitempty"`
+}
+
+// Bytes returns the bytes written or read
+func (e Event) Bytes() ([]byte, error) {
+	return hex.DecodeString(e.Data)
+}
+
+// Recording is a recorded session
+type Recording struct {
+	Header Header
+	Events []Event
+}
+
+// Recorder is a connection that records every read, write and flush on the
+// connection it wraps. Write errors on the recording are ignored, so
+// recording never breaks the session being recorded.
+type Recorder struct {
+	conn  connection.Connection
+	start time.Time
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder returns a Recorder for conn writing to w, starting with header.
+// The format, version and start time of the header are filled in.
+func NewRecorder(conn connection.Connection, w io.Writer, header Header) (*Recorder, error) {
+	r := &Recorder{conn: conn, start: time.Now(), enc: json.NewEncoder(w)}
+	header.Format = Format
+	header.Version = Version
+	header.Started = r.start
+	if err := r.enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write recording: %w", err)
+	}
+	return r, nil
+}
+
+// record writes an event
+func (r *Recorder) record(op string, data []byte, length int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := Event{Time: time.Since(r.start).Microseconds(), Op: op, Data: hex.EncodeToString(data), Length: length}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.enc.Encode(e)
+}
+
+// Open opens the wrapped connection
+func (r *Recorder) Open(port string) error {
+	return r.conn.Open(port)
+}
+
+// OpenContext opens the wrapped connection, giving up when ctx is done if it
+// supports that
+func (r *Recorder) OpenContext(ctx context.Context, port string) error {
+	return connection.OpenContext(ctx, r.conn, port)
+}
+
+// Close closes the wrapped connection
+func (r *Recorder) Close() error {
+	return r.conn.Close()
+}
+
+// IsOpen returns true if the wrapped connection is open
+func (r *Recorder) IsOpen() bool {
+	return r.conn.IsOpen()
+}
+
+// Read reads from the wrapped connection and records what was received
+func (r *Recorder) Read(n int) ([]byte, error) {
+	data, err := r.conn.Read(n)
+	r.record(OpRead, data, n, err)
+	return data, err
+}
+
+// Write writes to the wrapped connection and records what was sent
+func (r *Recorder) Write(data []byte) (int, error) {
+	n, err := r.conn.Write(data)
+	r.record(OpWrite, data, 0, err)
+	return n, err
+}
+
+// Flush flushes the wrapped connection and records it
+func (r *Recorder) Flush() error {
+	err := r.conn.Flush()
+	r.record(OpFlush, nil, 0, err)
+	return err
+}
+
+// CanBatch reports whether the wrapped connection can send batches
+func (r *Recorder) CanBatch() bool {
+	b, ok := r.conn.(connection.Batcher)
+	return ok && b.CanBatch()
+}
+
+// Exchange sends a batch on the wrapped connection and records each request
+// and its response, as if they had been sent one at a time
+func (r *Recorder) Exchange(requests [][]byte, responseLengths []int) ([][]byte, error) {
+	b, ok := r.conn.(connection.Batcher)
+	if !ok {
+		return nil, errors.New("the connection can't send batches")
+	}
+	responses, err := b.Exchange(requests, responseLengths)
+	for i, response := range responses {
+		r.record(OpWrite, requests[i], 0, nil)
+		r.record(OpRead, response, responseLengths[i], nil)
+	}
+	if err != nil && len(responses) < len(requests) {
+		failed := len(responses)
+		r.record(OpWrite, requests[failed], 0, nil)
+		r.record(OpRead, nil, responseLengths[failed], err)
+	}
+	return responses, err
+}
+
+// Read reads a recording
+func Read(r io.Reader) (*Recording, error) {
+	decoder := json.NewDecoder(r)
+	var rec Recording
+	if err := decoder.Decode(&rec.Header); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty recording")
+		}
+		return nil, fmt.Errorf("invalid recording header: %w", err)
+	}
+	if rec.Header.Format != Format {
+		return nil, errors.New("not a foenixmgr session recording")
+	}
+	if rec.Header.Version > Version {
+		return nil, fmt.Errorf("recording format version %d is newer than this foenixmgr reads (%d)", rec.Header.Version, Version)
+	}
+
+	for {
+		var e Event
+		if err := decoder.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(rec.Events)+1, err)
+		}
+		switch e.Op {
+		case OpWrite, OpRead, OpFlush:
+		default:
+			return nil, fmt.Errorf("event %d: unknown operation '%s'", len(rec.Events)+1, e.Op)
+		}
+		if _, err := e.Bytes(); err != nil {
+			return nil, fmt.Errorf("event %d: invalid data: %w", len(rec.Events)+1, err)
+		}
+		rec.Events = append(rec.Events, e)
+	}
+	return &rec, nil
+}
+
+// Exchange is a recorded request and the responses to it, recorded and
+// replayed
+type Exchange struct {
+	Number        int    `json:"number"`
+	Request       []byte `json:"request"`
+	Recorded      []byte `json:"recorded"`
+	Replayed      []byte `json:"replayed"`
+	RecordedError string `json:"recorded_error,omitempty"`
+	ReplayedError string `json:"replayed_error,omitempty"`
+}
+
+// Matches reports whether the replayed response is the recorded one. Only
+// whether a read failed is compared, not why.
+func (x Exchange) Matches() bool {
+	return bytes.Equal(x.Recorded, x.Replayed) && (x.RecordedError == "") == (x.ReplayedError == "")
+}
+
+// String describes the request, e.g. "READ_MEM 001000 len 0100"
+func (x Exchange) String() string {
+	r := x.Request
+	if len(r) < 7 {
+		return fmt.Sprintf("% X", r)
+	}
+	command := r[1]
+	address := uint32(r[2])<<16 | uint32(r[3])<<8 | uint32(r[4])
+	return fmt.Sprintf("%s %06X len %04X", protocol.CommandName(command), address, uint16(r[5])<<8|uint16(r[6]))
+}
+
+// Replay sends the recorded requests to conn in order and reads as many bytes
+// as were read in the recording, returning every exchange with the recorded
+// and replayed responses. Timing isn't replayed.
+func (rec *Recording) Replay(conn connection.Connection) []Exchange {
+	var exchanges []Exchange
+	var x *Exchange
+	for _, e := range rec.Events {
+		data, _ := e.Bytes()
+		switch e.Op {
+		case OpWrite:
+			exchanges = append(exchanges, Exchange{Number: len(exchanges) + 1, Request: data})
+			x = &exchanges[len(exchanges)-1]
+			if _, err := conn.Write(data); err != nil {
+				x.ReplayedError = err.Error()
+			}
+		case OpRead:
+			if x == nil {
+				// Input read before any request, such as a stale response
+				exchanges = append(exchanges, Exchange{Number: 1})
+				x = &exchanges[0]
+			}
+			x.Recorded = append(x.Recorded, data...)
+			if e.Error != "" && x.RecordedError == "" {
+				x.RecordedError = e.Error
+			}
+			if x.ReplayedError == "" {
+				replayed, err := conn.Read(e.Length)
+				if err != nil {
+					x.ReplayedError = err.Error()
+				}
+				x.Replayed = append(x.Replayed, replayed...)
+			}
+		case OpFlush:
+			conn.Flush()
+		}
+	}
+	return exchanges
+}
@@ -0,0 +1,109 @@
+package recording
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/config"
+	"github.com/daschewie/foenixmgr/pkg/connection"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{CPU: "65c02", VerifyLRC: true, FlashSize: 0x10000, FlashAddress: "080000"}
+}
+
+// recordSession records a session on a mock device: a write, a read back and
+// a revision request
+func recordSession(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var out bytes.Buffer
+	mock := connection.NewMockConnection(testConfig())
+	rec, err := NewRecorder(mock, &out, Header{Command: []string{"upload", "game.pgz"}, Port: "mock:", CPU: "65c02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Open("mock:"); err != nil {
+		t.Fatal(err)
+	}
+	dp := protocol.NewDebugPort(rec, testConfig())
+	if err := dp.WriteBlock(0x1000, []byte("Foenix")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dp.ReadBlock(0x1000, 6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dp.GetRevision(); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	rec, err := Read(recordSession(t))
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if rec.Header.Format != Format || rec.Header.Port != "mock:" || len(rec.Header.Command) != 2 {
+		t.Errorf("header = %+v", rec.Header)
+	}
+
+	// A fresh mock device answers as the recorded one did
+	mock := connection.NewMockConnection(testConfig())
+	mock.Open("mock:")
+	exchanges := rec.Replay(mock)
+	if len(exchanges) != 3 {
+		t.Fatalf("replayed %d exchanges, want 3", len(exchanges))
+	}
+	for _, x := range exchanges {
+		if !x.Matches() {
+			t.Errorf("exchange %d (%s) differs: recorded % X, replayed % X", x.Number, x, x.Recorded, x.Replayed)
+		}
+	}
+	if got := exchanges[1].String(); got != "READ_MEM 001000 len 0006" {
+		t.Errorf("String() = %q", got)
+	}
+	if !bytes.Contains(exchanges[1].Recorded, []byte("Foenix")) {
+		t.Errorf("read back % X, want Foenix", exchanges[1].Recorded)
+	}
+}
+
+func TestReplayDifferences(t *testing.T) {
+	rec, err := Read(recordSession(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The recorded device read back something else than the mock does
+	for i, e := range rec.Events {
+		if e.Op == OpRead && strings.Contains(e.Data, "466f656e6978") {
+			rec.Events[i].Data = strings.Replace(e.Data, "466f656e6978", "466f656e6979", 1)
+		}
+	}
+	mock := connection.NewMockConnection(testConfig())
+	mock.Open("mock:")
+	exchanges := rec.Replay(mock)
+	if !exchanges[0].Matches() || exchanges[1].Matches() || !exchanges[2].Matches() {
+		t.Errorf("matches = %v %v %v, want only the read back to differ",
+			exchanges[0].Matches(), exchanges[1].Matches(), exchanges[2].Matches())
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, input, want string
+	}{
+		{"empty", "", "empty recording"},
+		{"not a recording", `{"format":"other"}`, "not a foenixmgr session recording"},
+		{"newer version", `{"format":"foenixmgr-session","version":99}`, "newer"},
+		{"unknown operation", `{"format":"foenixmgr-session","version":1}` + "\n" + `{"t":0,"op":"jump"}`, "event 1: unknown operation"},
+		{"bad data", `{"format":"foenixmgr-session","version":1}` + "\n" + `{"t":0,"op":"write","data":"zz"}`, "event 1: invalid data"},
+	} {
+		_, err := Read(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Read() error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
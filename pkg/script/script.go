@@ -0,0 +1,352 @@
+// Package script implements the foenixmgr batch script language: a list of
+// foenixmgr commands with variables and simple conditionals
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line is a single script line split into words
+type Line struct {
+	Number int
+	Words  []string
+}
+
+// Script is a parsed script
+type Script struct {
+	Lines []Line
+}
+
+// Runner executes scripts
+type Runner struct {
+	// Run executes a foenixmgr command, e.g. ["dump", "--address", "0"]
+	Run func(args []string) error
+
+	// Lookup returns the value of a built-in variable such as status0. It is
+	// consulted for names that haven't been set with 'set'.
+	Lookup func(name string) (string, bool)
+
+	// Output receives the text of echo statements
+	Output io.Writer
+
+	vars map[string]string
+}
+
+// errExit stops a script early without an error
+type errExit struct{}
+
+func (errExit) Error() string { return "exit" }
+
+// Parse reads a script. Blank lines and lines starting with # are ignored.
+// if/else/endif blocks must be balanced.
+func Parse(r io.Reader) (*Script, error) {
+	s := &Script{}
+	depth := 0
+	elseSeen := []bool{}
+
+	scanner := bufio.NewScanner(r)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		words, err := SplitWords(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+
+		switch words[0] {
+		case "if":
+			depth++
+			elseSeen = append(elseSeen, false)
+		case "else":
+			if depth == 0 || elseSeen[depth-1] {
+				return nil, fmt.Errorf("line %d: else without if", number)
+			}
+			elseSeen[depth-1] = true
+		case "endif":
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: endif without if", number)
+			}
+			depth--
+			elseSeen = elseSeen[:depth]
+		}
+
+		s.Lines = append(s.Lines, Line{Number: number, Words: words})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading script: %w", err)
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("missing endif")
+	}
+
+	return s, nil
+}
+
+// Set sets a script variable
+func (rn *Runner) Set(name, value string) {
+	if rn.vars == nil {
+		rn.vars = make(map[string]string)
+	}
+	rn.vars[name] = value
+}
+
+// Execute runs a script, stopping at the first failing line
+func (rn *Runner) Execute(s *Script) error {
+	// active records, for each open if block, whether its lines run
+	var active []bool
+	running := func() bool {
+		for _, a := range active {
+			if !a {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, line := range s.Lines {
+		switch line.Words[0] {
+		case "if":
+			result := false
+			if running() {
+				words, err := rn.expand(line.Words[1:])
+				if err != nil {
+					return fmt.Errorf("line %d: %w", line.Number, err)
+				}
+				if result, err = evaluate(words); err != nil {
+					return fmt.Errorf("line %d: %w", line.Number, err)
+				}
+			}
+			active = append(active, result)
+			continue
+		case "else":
+			active[len(active)-1] = !active[len(active)-1]
+			continue
+		case "endif":
+			active = active[:len(active)-1]
+			continue
+		}
+
+		if !running() {
+			continue
+		}
+
+		words, err := rn.expand(line.Words)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line.Number, err)
+		}
+
+		if err := rn.statement(words); err != nil {
+			if _, ok := err.(errExit); ok {
+				return nil
+			}
+			return fmt.Errorf("line %d: %w", line.Number, err)
+		}
+	}
+
+	return nil
+}
+
+// statement runs one script statement or foenixmgr command
+func (rn *Runner) statement(words []string) error {
+	switch words[0] {
+	case "set":
+		if len(words) < 2 {
+			return fmt.Errorf("usage: set NAME VALUE")
+		}
+		rn.Set(words[1], strings.Join(words[2:], " "))
+		return nil
+
+	case "echo":
+		if rn.Output != nil {
+			fmt.Fprintln(rn.Output, strings.Join(words[1:], " "))
+		}
+		return nil
+
+	case "sleep":
+		if len(words) != 2 {
+			return fmt.Errorf("usage: sleep DURATION")
+		}
+		d, err := time.ParseDuration(words[1])
+		if err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+		time.Sleep(d)
+		return nil
+
+	case "exit":
+		return errExit{}
+
+	case "fail":
+		message := strings.Join(words[1:], " ")
+		if message == "" {
+			message = "script failed"
+		}
+		return fmt.Errorf("%s", message)
+	}
+
+	return rn.Run(words)
+}
+
+// expand replaces ${NAME} references in words with variable values
+func (rn *Runner) expand(words []string) ([]string, error) {
+	expanded := make([]string, len(words))
+	for i, word := range words {
+		var sb strings.Builder
+		for {
+			start := strings.Index(word, "${")
+			if start < 0 {
+				break
+			}
+			end := strings.Index(word[start:], "}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable reference in '%s'", words[i])
+			}
+			name := word[start+2 : start+end]
+
+			value, ok := rn.vars[name]
+			if !ok && rn.Lookup != nil {
+				value, ok = rn.Lookup(name)
+			}
+			if !ok {
+				return nil, fmt.Errorf("undefined variable '%s'", name)
+			}
+
+			sb.WriteString(word[:start])
+			sb.WriteString(value)
+			word = word[start+end+1:]
+		}
+		sb.WriteString(word)
+		expanded[i] = sb.String()
+	}
+	return expanded, nil
+}
+
+// evaluate evaluates an if condition: VALUE, or VALUE OP VALUE where OP is one
+// of == != < <= > >= or & (true if any bit is set in both). Values that are
+// hex numbers are compared as numbers, anything else as text.
+func evaluate(words []string) (bool, error) {
+	switch len(words) {
+	case 1:
+		n, err := parseNumber(words[0])
+		if err != nil {
+			return words[0] != "", nil
+		}
+		return n != 0, nil
+	case 3:
+	default:
+		return false, fmt.Errorf("usage: if VALUE [OP VALUE]")
+	}
+
+	lhs, op, rhs := words[0], words[1], words[2]
+	a, errA := parseNumber(lhs)
+	b, errB := parseNumber(rhs)
+	numeric := errA == nil && errB == nil
+
+	switch op {
+	case "==":
+		if numeric {
+			return a == b, nil
+		}
+		return lhs == rhs, nil
+	case "!=":
+		if numeric {
+			return a != b, nil
+		}
+		return lhs != rhs, nil
+	}
+
+	if !numeric {
+		return false, fmt.Errorf("'%s' needs hex numbers, got '%s' and '%s'", op, lhs, rhs)
+	}
+
+	switch op {
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "&":
+		return a&b != 0, nil
+	}
+	return false, fmt.Errorf("unknown operator '%s'", op)
+}
+
+// parseNumber parses a hex number with an optional 0x or $ prefix
+func parseNumber(s string) (uint64, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), "$")
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// SplitWords splits a line into words like a shell: words are separated by
+// spaces, and single or double quotes group words containing spaces
+func SplitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// JoinWords joins words into a line that SplitWords splits into the same
+// words, quoting words that are empty or contain spaces or quotes
+func JoinWords(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		switch {
+		case word != "" && !strings.ContainsAny(word, " \t\"'"):
+			quoted[i] = word
+		case !strings.Contains(word, `"`):
+			quoted[i] = `"` + word + `"`
+		case !strings.Contains(word, "'"):
+			quoted[i] = "'" + word + "'"
+		default:
+			// Double quotes are quoted with single quotes, the rest with
+			// double quotes
+			quoted[i] = `"` + strings.ReplaceAll(word, `"`, `"'"'"`) + `"`
+		}
+	}
+	return strings.Join(quoted, " ")
+}
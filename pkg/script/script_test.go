@@ -0,0 +1,195 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"dump --address 0", []string{"dump", "--address", "0"}, false},
+		{`poke --data "DE AD"`, []string{"poke", "--data", "DE AD"}, false},
+		{"echo 'a  b'  c", []string{"echo", "a  b", "c"}, false},
+		{`echo ""`, []string{"echo", ""}, false},
+		{`echo "open`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := SplitWords(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitWords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitWords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinWords(t *testing.T) {
+	for _, words := range [][]string{
+		{"dump", "--address", "0"},
+		{"poke", "--data", "DE AD"},
+		{"echo", ""},
+		{"echo", `say "hi"`},
+		{"echo", `it's "quoted"`},
+	} {
+		line := JoinWords(words)
+		got, err := SplitWords(line)
+		if err != nil || !reflect.DeepEqual(got, words) {
+			t.Errorf("SplitWords(JoinWords(%q)) = %q, %v (line %s)", words, got, err, line)
+		}
+	}
+	if line := JoinWords([]string{"dump", "--address", "0"}); line != "dump --address 0" {
+		t.Errorf("JoinWords() = %s, want words unquoted", line)
+	}
+}
+
+func TestParseUnbalanced(t *testing.T) {
+	for _, text := range []string{"if 1\n", "endif\n", "else\n", "if 1\nelse\nelse\nendif\n"} {
+		if _, err := Parse(strings.NewReader(text)); err == nil {
+			t.Errorf("Parse(%q) expected error", text)
+		}
+	}
+}
+
+// run parses and executes a script, returning the commands it ran and the
+// echo output
+func run(t *testing.T, text string, status map[string]string) ([]string, string, error) {
+	t.Helper()
+
+	s, err := Parse(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	var commands []string
+	var out bytes.Buffer
+	rn := &Runner{
+		Run: func(args []string) error {
+			commands = append(commands, strings.Join(args, " "))
+			if args[0] == "broken" {
+				return fmt.Errorf("broken command")
+			}
+			return nil
+		},
+		Lookup: func(name string) (string, bool) {
+			v, ok := status[name]
+			return v, ok
+		},
+		Output: &out,
+	}
+
+	err = rn.Execute(s)
+	return commands, out.String(), err
+}
+
+func TestExecute(t *testing.T) {
+	script := `
+# Upload and check
+set ADDR 380000
+upload-srec "my program.srec"
+dump --address ${ADDR} --count 10
+if ${status0} & 80
+  echo busy
+else
+  echo ready at ${ADDR}
+endif
+`
+	commands, out, err := run(t, script, map[string]string{"status0": "00"})
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+
+	wantCommands := []string{"upload-srec my program.srec", "dump --address 380000 --count 10"}
+	if !reflect.DeepEqual(commands, wantCommands) {
+		t.Errorf("commands = %q, want %q", commands, wantCommands)
+	}
+	if out != "ready at 380000\n" {
+		t.Errorf("output = %q, want %q", out, "ready at 380000\n")
+	}
+}
+
+func TestExecuteNestedConditions(t *testing.T) {
+	script := `
+if 0
+  if 1
+    echo inner
+  else
+    echo inner-else
+  endif
+else
+  echo outer-else
+endif
+`
+	_, out, err := run(t, script, nil)
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+	if out != "outer-else\n" {
+		t.Errorf("output = %q, want %q", out, "outer-else\n")
+	}
+}
+
+func TestExecuteStops(t *testing.T) {
+	commands, _, err := run(t, "revision\nbroken\nrevision\n", nil)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Execute() error = %v, want line 2 failure", err)
+	}
+	if len(commands) != 2 {
+		t.Errorf("ran %d commands, want 2", len(commands))
+	}
+
+	commands, _, err = run(t, "revision\nexit\nrevision\n", nil)
+	if err != nil || len(commands) != 1 {
+		t.Errorf("exit: err = %v, commands = %q", err, commands)
+	}
+
+	_, _, err = run(t, "fail flash not ready\n", nil)
+	if err == nil || !strings.Contains(err.Error(), "flash not ready") {
+		t.Errorf("fail: err = %v", err)
+	}
+
+	_, _, err = run(t, "dump --address ${NOPE}\n", nil)
+	if err == nil {
+		t.Error("Execute() expected error for undefined variable")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  bool
+	}{
+		{[]string{"1"}, true},
+		{[]string{"0"}, false},
+		{[]string{"10", "==", "$10"}, true},
+		{[]string{"0A", ">", "9"}, true},
+		{[]string{"F0", "&", "0F"}, false},
+		{[]string{"abc", "==", "abc"}, true},
+		{[]string{"xyz", "!=", "abc"}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := evaluate(tt.words)
+		if err != nil {
+			t.Errorf("evaluate(%q) error: %v", tt.words, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("evaluate(%q) = %v, want %v", tt.words, got, tt.want)
+		}
+	}
+
+	if _, err := evaluate([]string{"xyz", "<", "1"}); err == nil {
+		t.Error("evaluate() expected error comparing text with <")
+	}
+}
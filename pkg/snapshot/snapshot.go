@@ -0,0 +1,152 @@
+// Package snapshot stores memory snapshots of a machine: regions of memory
+// with metadata, in a zip archive
+package snapshot
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// manifestName is the archive member holding the metadata
+const manifestName = "manifest.json"
+
+// Version is the snapshot format version written
+const Version = 1
+
+// Region is a block of memory
+type Region struct {
+	Address uint32
+	Data    []byte
+}
+
+// Snapshot is the saved state of a machine's memory
+type Snapshot struct {
+	Machine string // Target machine, if one was selected
+	CPU     string
+	Created time.Time
+	Regions []Region
+}
+
+// manifest is the JSON metadata in the archive
+type manifest struct {
+	Version int              `json:"version"`
+	Machine string           `json:"machine,omitempty"`
+	CPU     string           `json:"cpu"`
+	Created time.Time        `json:"created"`
+	Regions []manifestRegion `json:"regions"`
+}
+
+// manifestRegion describes a region and the archive member with its data
+type manifestRegion struct {
+	Address uint32 `json:"address"`
+	Size    int    `json:"size"`
+	File    string `json:"file"`
+}
+
+// Size returns the total number of bytes in the snapshot's regions
+func (s *Snapshot) Size() int {
+	total := 0
+	for _, r := range s.Regions {
+		total += len(r.Data)
+	}
+	return total
+}
+
+// Write stores the snapshot as a zip archive of a manifest and one binary
+// file per region
+func (s *Snapshot) Write(w io.Writer) error {
+	m := manifest{Version: Version, Machine: s.Machine, CPU: s.CPU, Created: s.Created, Regions: []manifestRegion{}}
+	for _, r := range s.Regions {
+		m.Regions = append(m.Regions, manifestRegion{
+			Address: r.Address,
+			Size:    len(r.Data),
+			File:    fmt.Sprintf("%06X.bin", r.Address),
+		})
+	}
+
+	zw := zip.NewWriter(w)
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: manifestName, Method: zip.Deflate, Modified: s.Created})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+
+	for i, r := range s.Regions {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: m.Regions[i].File, Method: zip.Deflate, Modified: s.Created})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(r.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Read loads a snapshot written by Write
+func Read(data []byte) (*Snapshot, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	mf, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("not a snapshot archive: no %s", manifestName)
+	}
+	manifestData, err := readMember(mf)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(manifestData, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestName, err)
+	}
+	if m.Version > Version {
+		return nil, fmt.Errorf("snapshot format version %d is newer than this foenixmgr supports (%d)", m.Version, Version)
+	}
+
+	s := &Snapshot{Machine: m.Machine, CPU: m.CPU, Created: m.Created}
+	for _, r := range m.Regions {
+		f, ok := files[r.File]
+		if !ok {
+			return nil, fmt.Errorf("snapshot is missing %s", r.File)
+		}
+		regionData, err := readMember(f)
+		if err != nil {
+			return nil, err
+		}
+		if len(regionData) != r.Size {
+			return nil, fmt.Errorf("%s has %d bytes, the manifest says %d", r.File, len(regionData), r.Size)
+		}
+		s.Regions = append(s.Regions, Region{Address: r.Address, Data: regionData})
+	}
+	return s, nil
+}
+
+// readMember returns the contents of an archive member
+func readMember(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := &Snapshot{
+		Machine: "f256k",
+		CPU:     "65c02",
+		Created: created,
+		Regions: []Region{
+			{Address: 0x000000, Data: bytes.Repeat([]byte{0xAA}, 1000)},
+			{Address: 0x010000, Data: []byte{1, 2, 3}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	got, err := Read(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if got.Machine != "f256k" || got.CPU != "65c02" || !got.Created.Equal(created) {
+		t.Errorf("metadata = %s %s %v", got.Machine, got.CPU, got.Created)
+	}
+	if len(got.Regions) != 2 || got.Regions[1].Address != 0x010000 || !bytes.Equal(got.Regions[1].Data, []byte{1, 2, 3}) {
+		t.Errorf("regions = %+v", got.Regions)
+	}
+	if got.Size() != 1003 {
+		t.Errorf("Size() = %d, want 1003", got.Size())
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	if _, err := Read([]byte("not a zip")); err == nil {
+		t.Error("Read() of a non-zip should fail")
+	}
+
+	// A zip without a manifest
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("000000.bin")
+	w.Write([]byte{0})
+	zw.Close()
+	if _, err := Read(buf.Bytes()); err == nil {
+		t.Error("Read() of a zip without a manifest should fail")
+	}
+}
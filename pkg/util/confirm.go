@@ -2,44 +2,54 @@ package util
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
 
+// ErrNotInteractive is returned by Confirm and ConfirmDanger when stdin isn't a
+// terminal, so there is nobody to answer. Waiting for an answer would hang
+// scripts and CI pipelines.
+var ErrNotInteractive = errors.New("confirmation required but stdin is not a terminal (use --yes or FOENIX_ASSUME_YES=1 to confirm)")
+
 // Confirm prompts the user for confirmation (y/n) and returns true if confirmed
 // This is used for destructive operations like flash erase
-func Confirm(prompt string) bool {
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Print(prompt)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return false
+func Confirm(prompt string) (bool, error) {
+	if !IsTerminal(os.Stdin) {
+		return false, ErrNotInteractive
 	}
 
-	// Trim whitespace and convert to lowercase
-	response = strings.TrimSpace(strings.ToLower(response))
+	fmt.Print(prompt)
+	response := readResponse(os.Stdin)
 
 	// Accept 'y' or 'yes'
-	return response == "y" || response == "yes"
+	return response == "y" || response == "yes", nil
 }
 
 // ConfirmDanger prompts for a more serious confirmation with a warning message
 // Returns true only if the user explicitly types "yes"
-func ConfirmDanger(operation string) bool {
+func ConfirmDanger(operation string) (bool, error) {
+	if !IsTerminal(os.Stdin) {
+		return false, ErrNotInteractive
+	}
+
 	fmt.Printf("\n⚠️  WARNING: %s\n", operation)
 	fmt.Println("This operation cannot be undone.")
 	fmt.Print("\nType 'yes' to confirm: ")
 
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return false
+	return readResponse(os.Stdin) == "yes", nil
+}
+
+// readResponse reads one line of input, trimmed and in lowercase. A read
+// error gives an empty response.
+func readResponse(r io.Reader) string {
+	response, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && response == "" {
+		return ""
 	}
 
 	// Trim whitespace and convert to lowercase
-	response = strings.TrimSpace(strings.ToLower(response))
-
-	return response == "yes"
+	return strings.TrimSpace(strings.ToLower(response))
 }
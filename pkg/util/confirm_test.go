@@ -0,0 +1,25 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadResponse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"y\n", "y"},
+		{"  YES \r\n", "yes"},
+		{"yes", "yes"}, // No newline before end of input
+		{"", ""},
+		{"no\nyes\n", "no"},
+	}
+
+	for _, tt := range tests {
+		if got := readResponse(strings.NewReader(tt.input)); got != tt.want {
+			t.Errorf("readResponse(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -2,13 +2,26 @@ package util
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
 // HexDump displays a block of memory in hex dump format
 // Shows address, hex bytes, and ASCII representation
 func HexDump(data []byte, startAddress uint32) {
+	HexDumpSymbols(data, startAddress, nil)
+}
+
+// HexDumpSymbols displays a hex dump like HexDump, ending each line with the
+// symbol for its address, e.g. "<player_update+0x10>", if symbol returns one
+func HexDumpSymbols(data []byte, startAddress uint32, symbol func(uint32) (string, bool)) {
+	FprintHexDump(os.Stdout, data, startAddress, symbol)
+}
+
+// FprintHexDump writes a hex dump like HexDumpSymbols to w
+func FprintHexDump(w io.Writer, data []byte, startAddress uint32, symbol func(uint32) (string, bool)) {
 	const bytesPerLine = 16
 
 	for offset := 0; offset < len(data); offset += bytesPerLine {
@@ -16,7 +29,7 @@ func HexDump(data []byte, startAddress uint32) {
 		address := startAddress + uint32(offset)
 
 		// Print address
-		fmt.Printf("%06X: ", address)
+		fmt.Fprintf(w, "%06X: ", address)
 
 		// Print hex bytes
 		lineEnd := offset + bytesPerLine
@@ -25,26 +38,33 @@ func HexDump(data []byte, startAddress uint32) {
 		}
 
 		for i := offset; i < lineEnd; i++ {
-			fmt.Printf("%02X ", data[i])
+			fmt.Fprintf(w, "%02X ", data[i])
 		}
 
 		// Pad with spaces if this is the last line
 		for i := lineEnd; i < offset+bytesPerLine; i++ {
-			fmt.Print("   ")
+			fmt.Fprint(w, "   ")
 		}
 
 		// Print ASCII representation
-		fmt.Print(" | ")
+		fmt.Fprint(w, " | ")
 		for i := offset; i < lineEnd; i++ {
 			b := data[i]
 			if b >= 32 && b <= 126 {
-				fmt.Printf("%c", b)
+				fmt.Fprintf(w, "%c", b)
 			} else {
-				fmt.Print(".")
+				fmt.Fprint(w, ".")
+			}
+		}
+
+		if symbol != nil {
+			if name, ok := symbol(address); ok {
+				// Pad the ASCII column of a short last line
+				fmt.Fprintf(w, "%*s  <%s>", offset+bytesPerLine-lineEnd, "", name)
 			}
 		}
 
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 }
 
@@ -64,6 +84,64 @@ func FormatHex(data []byte) string {
 	return sb.String()
 }
 
+// Escape sequences used to highlight changed bytes on a terminal
+const (
+	highlightOn  = "\033[7m"
+	highlightOff = "\033[0m"
+)
+
+// DiffLines compares current with previous and returns a hex dump line, in
+// HexDump's format, for every 16 byte line that differs. With highlight the
+// whole line is shown and changed bytes are highlighted for a terminal;
+// without it unchanged bytes are shown as "..".
+func DiffLines(previous, current []byte, startAddress uint32, highlight bool) []string {
+	const bytesPerLine = 16
+
+	var lines []string
+	for offset := 0; offset < len(current); offset += bytesPerLine {
+		lineEnd := offset + bytesPerLine
+		if lineEnd > len(current) {
+			lineEnd = len(current)
+		}
+
+		changed := false
+		for i := offset; i < lineEnd; i++ {
+			if i >= len(previous) || previous[i] != current[i] {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%06X: ", startAddress+uint32(offset))
+		for i := offset; i < lineEnd; i++ {
+			differs := i >= len(previous) || previous[i] != current[i]
+			switch {
+			case differs && highlight:
+				fmt.Fprintf(&sb, "%s%02X%s ", highlightOn, current[i], highlightOff)
+			case differs || highlight:
+				fmt.Fprintf(&sb, "%02X ", current[i])
+			default:
+				sb.WriteString(".. ")
+			}
+		}
+		lines = append(lines, strings.TrimRight(sb.String(), " "))
+	}
+	return lines
+}
+
+// IsTerminal returns true if f is an interactive terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
 // ParseHexAddress parses a hexadecimal address string (with or without 0x/$ prefix)
 func ParseHexAddress(s string) (uint32, error) {
 	// Remove 0x or $ prefix if present
@@ -94,6 +172,58 @@ func ParseHexSize(s string) (uint16, error) {
 	return size, nil
 }
 
+// ParseHexCount parses a hexadecimal byte count (with or without 0x/$ prefix)
+// Unlike ParseHexSize, the count is not limited to a single 16-bit transfer.
+// The whole string must be hex digits, so "1M" is refused rather than read
+// as 1.
+func ParseHexCount(s string) (uint32, error) {
+	s = strings.TrimPrefix(s, "0x")
+	s = strings.TrimPrefix(s, "0X")
+	s = strings.TrimPrefix(s, "$")
+
+	count, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hex count '%s'", s)
+	}
+	return uint32(count), nil
+}
+
+// ParseHexBytes parses a list of hex bytes such as "DE AD BE EF", "DEADBEEF"
+// or "$DE,$AD". Tokens may be separated by spaces or commas, and tokens longer
+// than two digits are split into bytes from left to right.
+func ParseHexBytes(s string) ([]byte, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t'
+	})
+
+	var result []byte
+	for _, field := range fields {
+		token := strings.TrimPrefix(field, "0x")
+		token = strings.TrimPrefix(token, "0X")
+		token = strings.TrimPrefix(token, "$")
+
+		if len(token) == 1 {
+			token = "0" + token
+		}
+		if len(token) == 0 || len(token)%2 != 0 {
+			return nil, fmt.Errorf("invalid hex byte sequence '%s'", field)
+		}
+
+		for i := 0; i < len(token); i += 2 {
+			b, err := strconv.ParseUint(token[i:i+2], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex byte '%s'", token[i:i+2])
+			}
+			result = append(result, byte(b))
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no bytes specified")
+	}
+	return result, nil
+}
+
 // ReadFile reads an entire file and returns its contents
 func ReadFile(filename string) ([]byte, error) {
 	data, err := os.ReadFile(filename)
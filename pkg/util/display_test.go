@@ -1,6 +1,7 @@
 package util
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -89,3 +90,104 @@ func TestHexDump(t *testing.T) {
 	// This is mainly a smoke test - we're just checking it doesn't panic
 	HexDump(data, 0x1000)
 }
+
+func TestDiffLines(t *testing.T) {
+	previous := make([]byte, 40)
+	current := make([]byte, 40)
+	current[0x12] = 0xAB
+	current[0x27] = 0x01
+
+	lines := DiffLines(previous, current, 0x1000, false)
+	want := []string{
+		"001010: .. .. AB .. .. .. .. .. .. .. .. .. .. .. .. ..",
+		"001020: .. .. .. .. .. .. .. 01",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("DiffLines() returned %d lines, want %d: %q", len(lines), len(want), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+
+	lines = DiffLines(previous, current, 0x1000, true)
+	if len(lines) != 2 || !strings.Contains(lines[0], highlightOn+"AB"+highlightOff) {
+		t.Errorf("DiffLines() with highlight = %q", lines)
+	}
+
+	if lines := DiffLines(current, current, 0x1000, false); len(lines) != 0 {
+		t.Errorf("DiffLines() of equal data = %q, want none", lines)
+	}
+}
+
+func TestParseHexCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected uint32
+		wantErr  bool
+	}{
+		{"Simple hex", "100", 0x100, false},
+		{"Larger than 16 bits", "10000", 0x10000, false},
+		{"With $ prefix", "$8000", 0x8000, false},
+		{"Invalid characters", "XYZ", 0, true},
+		{"Size suffix", "1M", 0, true},
+		{"Trailing characters", "10zz", 0, true},
+		{"Empty", "", 0, true},
+		{"Larger than 32 bits", "100000000", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseHexCount(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseHexCount(%s) expected error, got nil", tt.input)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("ParseHexCount(%s) unexpected error: %v", tt.input, err)
+				}
+				if result != tt.expected {
+					t.Errorf("ParseHexCount(%s) = 0x%X, want 0x%X", tt.input, result, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHexBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []byte
+		wantErr  bool
+	}{
+		{"Space separated", "DE AD BE EF", []byte{0xDE, 0xAD, 0xBE, 0xEF}, false},
+		{"Packed", "DEADBEEF", []byte{0xDE, 0xAD, 0xBE, 0xEF}, false},
+		{"Comma separated with prefixes", "$01,0x02, 03", []byte{0x01, 0x02, 0x03}, false},
+		{"Single digit", "7", []byte{0x07}, false},
+		{"Odd length token", "ABC", nil, true},
+		{"Invalid characters", "1G", nil, true},
+		{"Empty string", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseHexBytes(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseHexBytes(%q) expected error, got nil", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseHexBytes(%q) unexpected error: %v", tt.input, err)
+			}
+			if FormatHex(result) != FormatHex(tt.expected) {
+				t.Errorf("ParseHexBytes(%q) = %s, want %s", tt.input, FormatHex(result), FormatHex(tt.expected))
+			}
+		})
+	}
+}
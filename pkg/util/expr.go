@@ -0,0 +1,172 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvalAddress evaluates an address expression such as "my_buffer+0x20",
+// "label1-label2" or "(table+2)*4". Numbers are hex, with or without a "0x"
+// or "$" prefix. Other names are passed to lookup, which returns the
+// label's address or an error; a name that is valid hex is a number, as
+// with plain addresses. The operators are +, -, *, / and parentheses. The
+// result must fit in 32 bits and not be negative.
+func EvalAddress(expr string, lookup func(name string) (uint32, error)) (uint32, error) {
+	p := &exprParser{input: expr, lookup: lookup}
+	value, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected '%c' at position %d of '%s'", p.input[p.pos], p.pos+1, expr)
+	}
+	if value < 0 || value > 0xFFFFFFFF {
+		return 0, fmt.Errorf("'%s' evaluates to %d, outside the address range", expr, value)
+	}
+	return uint32(value), nil
+}
+
+// exprParser is a recursive descent parser for address expressions
+type exprParser struct {
+	input  string
+	pos    int
+	lookup func(name string) (uint32, error)
+}
+
+// skipSpace moves past blanks
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-blank character, or 0 at the end
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// parseSum parses terms joined by + and -
+func (p *exprParser) parseSum() (int64, error) {
+	value, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += rhs
+		} else {
+			value -= rhs
+		}
+	}
+}
+
+// parseProduct parses factors joined by * and /
+func (p *exprParser) parseProduct() (int64, error) {
+	value, err := p.parseFactor()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return value, nil
+		}
+		p.pos++
+		rhs, err := p.parseFactor()
+		if err != nil {
+			return 0, err
+		}
+		if op == '*' {
+			value *= rhs
+		} else {
+			if rhs == 0 {
+				return 0, fmt.Errorf("division by zero in '%s'", p.input)
+			}
+			value /= rhs
+		}
+	}
+}
+
+// parseFactor parses a number, a label, a negation or a parenthesised
+// expression
+func (p *exprParser) parseFactor() (int64, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return 0, fmt.Errorf("incomplete expression '%s'", p.input)
+	case c == '-':
+		p.pos++
+		value, err := p.parseFactor()
+		return -value, err
+	case c == '(':
+		p.pos++
+		value, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing ')' in '%s'", p.input)
+		}
+		p.pos++
+		return value, nil
+	case c == '$':
+		p.pos++
+		return p.parseNumber(p.token())
+	}
+
+	token := p.token()
+	if token == "" {
+		return 0, fmt.Errorf("unexpected '%c' at position %d of '%s'", p.input[p.pos], p.pos+1, p.input)
+	}
+	if strings.HasPrefix(token, "0x") || strings.HasPrefix(token, "0X") {
+		return p.parseNumber(token[2:])
+	}
+	if value, err := strconv.ParseUint(token, 16, 32); err == nil {
+		return int64(value), nil
+	}
+	if p.lookup == nil {
+		return 0, fmt.Errorf("'%s' is not a hex number", token)
+	}
+	address, err := p.lookup(token)
+	if err != nil {
+		return 0, err
+	}
+	return int64(address), nil
+}
+
+// parseNumber parses a hex number without prefix
+func (p *exprParser) parseNumber(digits string) (int64, error) {
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hex number '%s' in '%s'", digits, p.input)
+	}
+	return int64(value), nil
+}
+
+// token returns the next name or number: letters, digits, '_' and '.'
+func (p *exprParser) token() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
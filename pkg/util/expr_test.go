@@ -0,0 +1,66 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvalAddress(t *testing.T) {
+	labels := map[string]uint32{"my_buffer": 0x2000, "label1": 0x3010, "label2": 0x3000, "table": 0x10}
+	lookup := func(name string) (uint32, error) {
+		if address, ok := labels[name]; ok {
+			return address, nil
+		}
+		return 0, fmt.Errorf("label '%s' not found", name)
+	}
+
+	tests := []struct {
+		expr    string
+		want    uint32
+		wantErr bool
+	}{
+		{"380000", 0x380000, false},
+		{"0x20", 0x20, false},
+		{"$ff", 0xFF, false},
+		{"my_buffer", 0x2000, false},
+		{"my_buffer+0x20", 0x2020, false},
+		{"my_buffer + 20", 0x2020, false},
+		{"label1-label2", 0x10, false},
+		{"(table+2)*4", 0x48, false},
+		{"table*2+1", 0x21, false},
+		{"my_buffer/2", 0x1000, false},
+		{"-1+my_buffer", 0x1FFF, false},
+		{"my_buffer-", 0, true},
+		{"label2-label1", 0, true}, // Negative
+		{"missing+1", 0, true},
+		{"(table", 0, true},
+		{"table)", 0, true},
+		{"table/0", 0, true},
+		{"$xyz", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := EvalAddress(tt.expr, lookup)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("EvalAddress(%q) = %X, want error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EvalAddress(%q) error: %v", tt.expr, err)
+		} else if got != tt.want {
+			t.Errorf("EvalAddress(%q) = %X, want %X", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalAddressWithoutLabels(t *testing.T) {
+	if got, err := EvalAddress("1000+10", nil); err != nil || got != 0x1010 {
+		t.Errorf("EvalAddress() = %X, %v, want 1010", got, err)
+	}
+	if _, err := EvalAddress("start", nil); err == nil {
+		t.Error("EvalAddress() with a label and no lookup should fail")
+	}
+}
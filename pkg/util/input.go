@@ -0,0 +1,187 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stdin is the file name that reads standard input
+const Stdin = "-"
+
+// DefaultMaxInputSize bounds what is read from standard input or a URL when
+// no other limit is given
+const DefaultMaxInputSize = 64 << 20
+
+// urlHeaderTimeout is how long to wait for a server to start answering
+const urlHeaderTimeout = 30 * time.Second
+
+// InputOptions control how an input file is read
+type InputOptions struct {
+	// MaxSize is the most bytes read. Zero means DefaultMaxInputSize for
+	// standard input and URLs, and no limit for files.
+	MaxSize int64
+
+	// SHA256 is the expected SHA-256 digest of the content in hex, or empty
+	// to skip the check. The content is then read whole and checked before
+	// any of it is returned.
+	SHA256 string
+}
+
+// IsURL returns true if name is an http or https URL
+func IsURL(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// IsStream returns true if name is standard input or a URL, which can only be
+// read once
+func IsStream(name string) bool {
+	return name == Stdin || IsURL(name)
+}
+
+// OpenInput opens a file, standard input for "-", or an http(s) URL. Reading
+// more than the size limit fails rather than returning a truncated file.
+func OpenInput(name string, opts InputOptions) (io.ReadCloser, error) {
+	maxSize := opts.MaxSize
+	if maxSize == 0 && IsStream(name) {
+		maxSize = DefaultMaxInputSize
+	}
+
+	var input io.ReadCloser
+	switch {
+	case name == Stdin:
+		input = io.NopCloser(os.Stdin)
+	case IsURL(name):
+		body, err := openURL(name, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		input = body
+	default:
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		input = file
+	}
+	if maxSize > 0 {
+		input = &limitedInput{ReadCloser: input, remaining: maxSize, limit: maxSize}
+	}
+
+	if opts.SHA256 == "" {
+		return input, nil
+	}
+
+	// The digest is only known at the end, so nothing is returned before it
+	// is checked
+	defer input.Close()
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := checkSHA256(name, data, opts.SHA256); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// ReadInput reads a whole file, standard input or URL, like OpenInput
+func ReadInput(name string, opts InputOptions) ([]byte, error) {
+	input, err := OpenInput(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// openURL starts downloading a URL
+func openURL(url string, maxSize int64) (io.ReadCloser, error) {
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: urlHeaderTimeout,
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s is %d bytes, larger than the limit of %d bytes", url, resp.ContentLength, maxSize)
+	}
+	return resp.Body, nil
+}
+
+// checkSHA256 compares the SHA-256 digest of data with the expected one
+func checkSHA256(name string, data []byte, want string) error {
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return fmt.Errorf("SHA-256 of %s is %s, expected %s", name, got, want)
+	}
+	return nil
+}
+
+// limitedInput fails a read that goes past the size limit
+type limitedInput struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (l *limitedInput) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, fmt.Errorf("file is larger than the limit of %d bytes", l.limit)
+	}
+	// Read one byte past the limit to tell a file that ends there from one
+	// that goes on
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), fmt.Errorf("file is larger than the limit of %d bytes", l.limit)
+	}
+	return n, err
+}
+
+// ParseByteSize parses a size in bytes, with an optional K, M or G suffix
+// for multiples of 1024, e.g. "512K" or "64M"
+func ParseByteSize(s string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(text, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(text, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(text, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		text = text[:len(text)-1]
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s': expected bytes with an optional K, M or G suffix", s)
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"512K", 512 << 10},
+		{"64m", 64 << 20},
+		{" 1G ", 1 << 30},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.input)
+		if err != nil {
+			t.Errorf("ParseByteSize(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "M", "-1", "12X", "1.5M"} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Errorf("ParseByteSize(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	for name, want := range map[string]bool{
+		"http://host/file.pgz":  true,
+		"HTTPS://host/file.pgz": true,
+		"-":                     false,
+		"file.pgz":              false,
+		"ftp://host/file.pgz":   false,
+	} {
+		if got := IsURL(name); got != want {
+			t.Errorf("IsURL(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if !IsStream(Stdin) {
+		t.Error("IsStream(Stdin) = false")
+	}
+}
+
+func TestReadInputFile(t *testing.T) {
+	data := []byte("program data")
+	name := filepath.Join(t.TempDir(), "program.bin")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadInput(name, InputOptions{})
+	if err != nil {
+		t.Fatalf("ReadInput() error: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("ReadInput() = %q, want %q", got, data)
+	}
+
+	// A file exactly at the limit is read, one byte more is refused
+	if _, err := ReadInput(name, InputOptions{MaxSize: int64(len(data))}); err != nil {
+		t.Errorf("ReadInput() at the limit error: %v", err)
+	}
+	if _, err := ReadInput(name, InputOptions{MaxSize: int64(len(data)) - 1}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("ReadInput() past the limit error = %v, want limit error", err)
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if _, err := ReadInput(name, InputOptions{SHA256: strings.ToUpper(digest)}); err != nil {
+		t.Errorf("ReadInput() with matching SHA-256 error: %v", err)
+	}
+	wrong := strings.Repeat("0", 64)
+	if _, err := ReadInput(name, InputOptions{SHA256: wrong}); err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Errorf("ReadInput() with wrong SHA-256 error = %v, want mismatch", err)
+	}
+
+	if _, err := ReadInput(filepath.Join(t.TempDir(), "missing.bin"), InputOptions{}); err == nil {
+		t.Error("ReadInput() of a missing file succeeded")
+	}
+}
+
+func TestReadInputURL(t *testing.T) {
+	data := bytes.Repeat([]byte{0xEA}, 3000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/program.bin":
+			w.Write(data)
+		case "/chunked.bin":
+			// No Content-Length, so the limit is only found while reading
+			w.(http.Flusher).Flush()
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	got, err := ReadInput(server.URL+"/program.bin", InputOptions{})
+	if err != nil {
+		t.Fatalf("ReadInput() error: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("ReadInput() returned %d bytes, want %d", len(got), len(data))
+	}
+
+	if _, err := ReadInput(server.URL+"/program.bin", InputOptions{MaxSize: 1000}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("ReadInput() past the limit error = %v, want limit error", err)
+	}
+	if _, err := ReadInput(server.URL+"/chunked.bin", InputOptions{MaxSize: 1000}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("ReadInput() of chunked data past the limit error = %v, want limit error", err)
+	}
+	if _, err := ReadInput(server.URL+"/missing.bin", InputOptions{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("ReadInput() of a missing URL error = %v, want 404", err)
+	}
+}
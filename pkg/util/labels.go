@@ -5,12 +5,45 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// LabelFile represents a 64TASS label file parser
+// Label file formats recognised by Load
+const (
+	LabelFormat64TASS = "64tass" // LABEL = $ADDRESS
+	LabelFormatVICE   = "vice"   // al C:ADDRESS .LABEL (also written by ld65 -Ln)
+	LabelFormatLD65   = "ld65"   // ld65 map file exports list
+	LabelFormatNM     = "nm"     // GNU nm output: ADDRESS TYPE LABEL
+	LabelFormatLWASM  = "lwasm"  // LABEL EQU $ADDRESS (lwasm --symbol-dump, 6809)
+)
+
+var (
+	// Example: "my_var = $1234"
+	tassPattern = regexp.MustCompile(`^(\S+)\s*=\s*\$(\S+)`)
+	// Example: "al C:1234 .my_var" or "al 001234 .my_var"
+	vicePattern = regexp.MustCompile(`^al\s+(?:[A-Za-z]+:)?([0-9A-Fa-f]+)\s+\.?(\S+)`)
+	// Example: "my_var                    001234 RLA    other   001240 RLA"
+	ld65Pattern = regexp.MustCompile(`(\S+)\s+([0-9A-Fa-f]{6})\s+[A-Z]{3}\b`)
+	// Example: "00001234 T my_func"
+	nmPattern = regexp.MustCompile(`^([0-9A-Fa-f]+)\s+[A-Za-z?-]\s+(\S+)$`)
+	// Example: "my_var EQU $1234"
+	lwasmPattern = regexp.MustCompile(`^(\S+)\s+(?i:equ)\s+\$([0-9A-Fa-f]+)`)
+)
+
+// LabelFile represents a label file: 64TASS labels, VICE labels, an ld65 map
+// file, GNU nm output or an lwasm symbol dump
 type LabelFile struct {
 	labels map[string]string // label name -> hex address (without $)
+	format string
+	sorted []Label // Labels by address, built by the first reverse lookup
+}
+
+// Label is a label and its address
+type Label struct {
+	Name    string
+	Address uint32
 }
 
 // NewLabelFile creates a new label file parser
@@ -20,8 +53,7 @@ func NewLabelFile() *LabelFile {
 	}
 }
 
-// Load parses a 64TASS label file
-// Format: LABEL = $ADDRESS
+// Load parses a label file, detecting its format from the content
 func (lf *LabelFile) Load(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -29,41 +61,140 @@ func (lf *LabelFile) Load(filename string) error {
 	}
 	defer file.Close()
 
-	// Regex pattern for label lines: LABEL = $ADDRESS
-	// Example: "my_var = $1234"
-	pattern := regexp.MustCompile(`^(\S+)\s*=\s*\$(\S+)`)
-
+	var lines []string
 	scanner := bufio.NewScanner(file)
-	lineNum := 0
-
 	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading label file: %w", err)
+	}
+
+	lf.format = detectLabelFormat(lines)
+	switch lf.format {
+	case LabelFormatVICE:
+		lf.parseVICE(lines)
+	case LabelFormatLD65:
+		lf.parseLD65(lines)
+	case LabelFormatNM:
+		lf.parseNM(lines)
+	case LabelFormatLWASM:
+		lf.parseLWASM(lines)
+	default:
+		lf.parse64TASS(lines)
+	}
+
+	if len(lf.labels) == 0 {
+		return fmt.Errorf("no labels found in file")
+	}
+
+	return nil
+}
+
+// detectLabelFormat guesses the format of a label file from its lines
+func detectLabelFormat(lines []string) string {
+	nmLines := 0
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "Exports list by"):
+			return LabelFormatLD65
+		case vicePattern.MatchString(line):
+			return LabelFormatVICE
+		case tassPattern.MatchString(line):
+			return LabelFormat64TASS
+		case lwasmPattern.MatchString(line):
+			return LabelFormatLWASM
+		case nmPattern.MatchString(line):
+			nmLines++
+		}
+	}
+	if nmLines > 0 {
+		return LabelFormatNM
+	}
+	return LabelFormat64TASS
+}
 
+// parse64TASS reads LABEL = $ADDRESS lines, skipping comments
+func (lf *LabelFile) parse64TASS(lines []string) {
+	for _, line := range lines {
 		// Skip empty lines and comments
-		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
 			continue
 		}
 
-		// Try to match label pattern
-		matches := pattern.FindStringSubmatch(line)
-		if matches != nil {
-			label := matches[1]
-			address := matches[2]
-			lf.labels[label] = address
+		if matches := tassPattern.FindStringSubmatch(line); matches != nil {
+			lf.labels[matches[1]] = matches[2]
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading label file: %w", err)
+// parseVICE reads "al ADDRESS .LABEL" lines
+func (lf *LabelFile) parseVICE(lines []string) {
+	for _, line := range lines {
+		if matches := vicePattern.FindStringSubmatch(line); matches != nil {
+			lf.add(matches[2], matches[1])
+		}
 	}
+}
 
-	if len(lf.labels) == 0 {
-		return fmt.Errorf("no labels found in file")
+// parseLD65 reads the exports lists of an ld65 map file. Each line holds one
+// or two exports of name, address and flags.
+func (lf *LabelFile) parseLD65(lines []string) {
+	inExports := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "Exports list by"):
+			inExports = true
+			continue
+		case strings.HasSuffix(line, ":") && !strings.HasPrefix(line, "-"):
+			// Another section of the map file
+			inExports = false
+		}
+		if !inExports {
+			continue
+		}
+		for _, matches := range ld65Pattern.FindAllStringSubmatch(line, -1) {
+			lf.add(matches[1], matches[2])
+		}
 	}
+}
 
-	return nil
+// parseNM reads "ADDRESS TYPE LABEL" lines of GNU nm output. Undefined
+// symbols have no address and are skipped.
+func (lf *LabelFile) parseNM(lines []string) {
+	for _, line := range lines {
+		if matches := nmPattern.FindStringSubmatch(line); matches != nil {
+			lf.add(matches[2], matches[1])
+		}
+	}
+}
+
+// parseLWASM reads "LABEL EQU $ADDRESS" lines, as written by lwasm's
+// --symbol-dump for 6809 programs, skipping comments
+func (lf *LabelFile) parseLWASM(lines []string) {
+	for _, line := range lines {
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "*") {
+			continue
+		}
+		if matches := lwasmPattern.FindStringSubmatch(line); matches != nil {
+			lf.add(matches[1], matches[2])
+		}
+	}
+}
+
+// add stores a label with its hex address, normalized to upper case without
+// leading zeros
+func (lf *LabelFile) add(label, addressHex string) {
+	address, err := strconv.ParseUint(addressHex, 16, 64)
+	if err != nil {
+		return
+	}
+	lf.labels[label] = strings.ToUpper(strconv.FormatUint(address, 16))
+}
+
+// Format returns the format of the loaded label file
+func (lf *LabelFile) Format() string {
+	return lf.format
 }
 
 // Lookup finds the address for a given label
@@ -79,3 +210,60 @@ func (lf *LabelFile) Lookup(label string) (string, error) {
 func (lf *LabelFile) Count() int {
 	return len(lf.labels)
 }
+
+// Addresses returns the labels indexed by address. When several labels share
+// an address the alphabetically first one is used. Labels with addresses that
+// aren't valid hex are skipped.
+func (lf *LabelFile) Addresses() map[uint32]string {
+	names := make(map[uint32]string, len(lf.labels))
+	for label, addressHex := range lf.labels {
+		address, err := ParseHexAddress(addressHex)
+		if err != nil {
+			continue
+		}
+		if existing, ok := names[address]; !ok || label < existing {
+			names[address] = label
+		}
+	}
+	return names
+}
+
+// Labels returns the labels sorted by address, and by name for labels that
+// share an address. Labels with addresses that aren't valid hex are skipped.
+func (lf *LabelFile) Labels() []Label {
+	if lf.sorted == nil {
+		lf.sorted = make([]Label, 0, len(lf.labels))
+		for label, addressHex := range lf.labels {
+			if address, err := ParseHexAddress(addressHex); err == nil {
+				lf.sorted = append(lf.sorted, Label{label, address})
+			}
+		}
+		sort.Slice(lf.sorted, func(i, j int) bool {
+			a, b := lf.sorted[i], lf.sorted[j]
+			return a.Address < b.Address || a.Address == b.Address && a.Name < b.Name
+		})
+	}
+	return lf.sorted
+}
+
+// ReverseLookup returns the name of the nearest label at or before address,
+// with the offset from it if it isn't exact, e.g. "player_update+0x13". It
+// returns false if no label precedes the address.
+func (lf *LabelFile) ReverseLookup(address uint32) (string, bool) {
+	labels := lf.Labels()
+	// Find the first label after address; the one before it is the nearest.
+	// Of several labels at the nearest address the first by name is used.
+	i := sort.Search(len(labels), func(i int) bool { return labels[i].Address > address })
+	if i == 0 {
+		return "", false
+	}
+	nearest := labels[i-1].Address
+	for i > 1 && labels[i-2].Address == nearest {
+		i--
+	}
+	label := labels[i-1]
+	if label.Address == address {
+		return label.Name, true
+	}
+	return fmt.Sprintf("%s+0x%X", label.Name, address-label.Address), true
+}
@@ -91,3 +91,159 @@ func TestLabelFileNotFound(t *testing.T) {
 		t.Error("Expected error for nonexistent file, got nil")
 	}
 }
+
+func TestLabelFileAddresses(t *testing.T) {
+	tmpDir := t.TempDir()
+	labelFile := filepath.Join(tmpDir, "test.lbl")
+
+	labelContent := `start = $E000
+reset = $E000
+loop = $E010
+bad = $XYZ
+`
+
+	if err := os.WriteFile(labelFile, []byte(labelContent), 0644); err != nil {
+		t.Fatalf("Failed to create test label file: %v", err)
+	}
+
+	lf := NewLabelFile()
+	if err := lf.Load(labelFile); err != nil {
+		t.Fatalf("Failed to load label file: %v", err)
+	}
+
+	names := lf.Addresses()
+	if len(names) != 2 {
+		t.Errorf("Expected 2 addresses, got %d", len(names))
+	}
+	if names[0xE000] != "reset" {
+		t.Errorf("Addresses()[0xE000] = %s, want reset", names[0xE000])
+	}
+	if names[0xE010] != "loop" {
+		t.Errorf("Addresses()[0xE010] = %s, want loop", names[0xE010])
+	}
+}
+
+func TestLabelFileFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		want    map[string]string
+	}{
+		{
+			name: "vice",
+			content: `al C:e000 .reset
+al 00E010 .loop
+al C:0200 .__STACK_START__
+`,
+			format: LabelFormatVICE,
+			want:   map[string]string{"reset": "E000", "loop": "E010", "__STACK_START__": "200"},
+		},
+		{
+			name: "ld65",
+			content: `Modules list:
+-------------
+main.o:
+    CODE              Offs=000000  Size=000010  Align=00001  Fill=0000
+
+Exports list by name:
+---------------------
+__STARTUP__               000001 REA    _main                     00E012 RLA
+reset                     00E000 RLA
+
+Exports list by value:
+----------------------
+__STARTUP__               000001 REA    reset                     00E000 RLA
+
+Imports list:
+-------------
+_main (main.o):
+`,
+			format: LabelFormatLD65,
+			want:   map[string]string{"__STARTUP__": "1", "_main": "E012", "reset": "E000"},
+		},
+		{
+			name: "nm",
+			content: `00001000 T _start
+00002400 D buffer
+         U external_func
+0000000000003000 b counter
+`,
+			format: LabelFormatNM,
+			want:   map[string]string{"_start": "1000", "buffer": "2400", "counter": "3000"},
+		},
+		{
+			name:    "64tass",
+			content: "reset = $E000\nloop = $E010\n",
+			format:  LabelFormat64TASS,
+			want:    map[string]string{"reset": "E000", "loop": "E010"},
+		},
+		{
+			name:    "lwasm",
+			content: "; lwasm symbol dump\nreset EQU $E000\nloop equ $00E010\n",
+			format:  LabelFormatLWASM,
+			want:    map[string]string{"reset": "E000", "loop": "E010"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labelFile := filepath.Join(t.TempDir(), "labels")
+			if err := os.WriteFile(labelFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test label file: %v", err)
+			}
+
+			lf := NewLabelFile()
+			if err := lf.Load(labelFile); err != nil {
+				t.Fatalf("Failed to load label file: %v", err)
+			}
+			if lf.Format() != tt.format {
+				t.Errorf("Format() = %s, want %s", lf.Format(), tt.format)
+			}
+			if lf.Count() != len(tt.want) {
+				t.Errorf("Count() = %d, want %d", lf.Count(), len(tt.want))
+			}
+			for label, want := range tt.want {
+				if got, err := lf.Lookup(label); err != nil || got != want {
+					t.Errorf("Lookup(%s) = %s, %v, want %s", label, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLabelFileReverseLookup(t *testing.T) {
+	labelFile := filepath.Join(t.TempDir(), "test.lbl")
+	content := "start = $E000\nreset = $E000\nloop = $E010\nbad = $XYZ\n"
+	if err := os.WriteFile(labelFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test label file: %v", err)
+	}
+
+	lf := NewLabelFile()
+	if err := lf.Load(labelFile); err != nil {
+		t.Fatalf("Failed to load label file: %v", err)
+	}
+
+	tests := []struct {
+		address uint32
+		want    string
+		ok      bool
+	}{
+		{0xDFFF, "", false},
+		{0xE000, "reset", true},
+		{0xE001, "reset+0x1", true},
+		{0xE010, "loop", true},
+		{0x1F2A3, "loop+0x11293", true},
+	}
+	for _, tt := range tests {
+		got, ok := lf.ReverseLookup(tt.address)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ReverseLookup(%X) = %q, %v, want %q, %v", tt.address, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	labels := lf.Labels()
+	if len(labels) != 3 || labels[0].Name != "reset" || labels[1].Name != "start" || labels[2].Address != 0xE010 {
+		t.Errorf("Labels() = %v", labels)
+	}
+}
@@ -2,33 +2,99 @@
 package util
 
 import (
+	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
-const stopFileName = "f256.stp"
+// StopState records a machine whose CPU was left stopped in debug mode, e.g.
+// with the 'stop' command
+type StopState struct {
+	Port  string    `json:"port"`
+	Since time.Time `json:"since"`
+}
+
+// unsafeFileChars matches the characters of a port name that can't be used
+// in a file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// stopDir returns the directory holding a stop indicator file per port. It is
+// in the user's config directory, so the state is shared by every working
+// directory.
+func stopDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "foenixmgr", "stopped")
+}
+
+// stopFileName returns the stop indicator file of a port
+func stopFileName(port string) string {
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(port, "_"), "_")
+	if name == "" {
+		name = "default"
+	}
+	return filepath.Join(stopDir(), name+".stp")
+}
 
-// IsStopped returns true if the CPU is in a stopped state
-// This is indicated by the presence of the f256.stp file
-func IsStopped() bool {
-	_, err := os.Stat(stopFileName)
+// IsStopped returns true if the CPU of the machine on a port is in a stopped
+// state. This is indicated by the presence of the port's stop indicator file.
+func IsStopped(port string) bool {
+	_, err := os.Stat(stopFileName(port))
 	return err == nil // File exists = CPU is stopped
 }
 
-// SetStopIndicator creates the stop indicator file
+// SetStopIndicator creates the stop indicator file of a port
 // This marks the CPU as being in a stopped state
-func SetStopIndicator() error {
-	f, err := os.Create(stopFileName)
+func SetStopIndicator(port string) error {
+	data, err := json.Marshal(StopState{Port: port, Since: time.Now()})
 	if err != nil {
 		return err
 	}
-	return f.Close()
+	if err := os.MkdirAll(stopDir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(stopFileName(port), data, 0644)
 }
 
-// ClearStopIndicator removes the stop indicator file
+// ClearStopIndicator removes the stop indicator file of a port
 // This marks the CPU as no longer being in a stopped state
-func ClearStopIndicator() error {
-	if !IsStopped() {
+func ClearStopIndicator(port string) error {
+	err := os.Remove(stopFileName(port))
+	if errors.Is(err, fs.ErrNotExist) {
 		return nil // Already clear
 	}
-	return os.Remove(stopFileName)
+	return err
+}
+
+// StoppedPorts returns the ports whose CPU is in a stopped state, sorted by
+// port name
+func StoppedPorts() ([]StopState, error) {
+	files, err := filepath.Glob(filepath.Join(stopDir(), "*.stp"))
+	if err != nil {
+		return nil, err
+	}
+
+	states := []StopState{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var state StopState
+		if err := json.Unmarshal(data, &state); err != nil {
+			// Not written by SetStopIndicator; name the port after the file
+			state.Port = strings.TrimSuffix(filepath.Base(file), ".stp")
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Port < states[j].Port })
+	return states, nil
 }
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStopIndicatorPerPort(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("AppData", t.TempDir())
+
+	if IsStopped("/dev/ttyUSB0") {
+		t.Fatal("IsStopped() before SetStopIndicator")
+	}
+	if err := SetStopIndicator("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("SetStopIndicator() error: %v", err)
+	}
+	if !IsStopped("/dev/ttyUSB0") {
+		t.Error("IsStopped() = false after SetStopIndicator")
+	}
+	if IsStopped("/dev/ttyUSB1") {
+		t.Error("another port shares the stop state")
+	}
+
+	// The state doesn't depend on the working directory
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if !IsStopped("/dev/ttyUSB0") {
+		t.Error("IsStopped() = false in another directory")
+	}
+
+	if err := SetStopIndicator("COM3"); err != nil {
+		t.Fatal(err)
+	}
+	states, err := StoppedPorts()
+	if err != nil {
+		t.Fatalf("StoppedPorts() error: %v", err)
+	}
+	if len(states) != 2 || states[0].Port != "/dev/ttyUSB0" || states[1].Port != "COM3" || states[0].Since.IsZero() {
+		t.Errorf("StoppedPorts() = %+v", states)
+	}
+
+	if err := ClearStopIndicator("/dev/ttyUSB0"); err != nil {
+		t.Fatalf("ClearStopIndicator() error: %v", err)
+	}
+	if IsStopped("/dev/ttyUSB0") {
+		t.Error("IsStopped() after ClearStopIndicator")
+	}
+	if err := ClearStopIndicator("/dev/ttyUSB0"); err != nil {
+		t.Errorf("ClearStopIndicator() of a running CPU: %v", err)
+	}
+}
+
+func TestStopFileName(t *testing.T) {
+	tests := []struct {
+		port, want string
+	}{
+		{"/dev/ttyUSB0", "dev_ttyUSB0.stp"},
+		{"COM3", "COM3.stp"},
+		{"192.168.1.114:2560", "192.168.1.114_2560.stp"},
+		{"mock:", "mock.stp"},
+		{"", "default.stp"},
+	}
+
+	for _, tt := range tests {
+		if got := filepath.Base(stopFileName(tt.port)); got != tt.want {
+			t.Errorf("stopFileName(%q) = %q, want %q", tt.port, got, tt.want)
+		}
+	}
+}
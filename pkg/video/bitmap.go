@@ -0,0 +1,42 @@
+package video
+
+import (
+	"image"
+	"image/color"
+)
+
+// BitmapLUTSize is the size of a 256-colour bitmap look-up table
+const BitmapLUTSize = 256 * LUTEntrySize
+
+// Master control register bits that show a bitmap
+const (
+	MasterGraphics = 0x04
+	MasterBitmap   = 0x08
+)
+
+// BitmapControl returns the bitmap layer control register and address
+// registers that show a bitmap at address with a colour look-up table
+func BitmapControl(address uint32, lut int) []byte {
+	return []byte{0x01 | byte(lut&0x03)<<1, byte(address), byte(address >> 8), byte(address >> 16)}
+}
+
+// Bitmap is an 8-bit indexed bitmap, one byte per pixel row by row
+type Bitmap struct {
+	Width, Height int
+	Pixels        []byte
+	Palette       color.Palette
+}
+
+// Render converts the bitmap to an image using its palette
+func (b *Bitmap) Render() (*image.Paletted, error) {
+	if err := checkSize("bitmap memory", b.Pixels, b.Width*b.Height); err != nil {
+		return nil, err
+	}
+	if len(b.Palette) < 256 {
+		return nil, checkSize("bitmap LUT", nil, BitmapLUTSize)
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, b.Width, b.Height), b.Palette[:256])
+	copy(img.Pix, b.Pixels[:b.Width*b.Height])
+	return img, nil
+}
@@ -0,0 +1,155 @@
+package video
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+func init() {
+	image.RegisterFormat("bmp", "BM", DecodeBMP, decodeBMPConfig)
+}
+
+// bmpHeader is the part of a BMP file and info header that is used
+type bmpHeader struct {
+	dataOffset  uint32
+	width       int
+	height      int
+	topDown     bool
+	bits        uint16
+	compression uint32
+	colors      uint32
+	headerSize  uint32
+}
+
+// readBMPHeader reads the file header and the info header
+func readBMPHeader(r io.Reader) (bmpHeader, error) {
+	var buf [54]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return bmpHeader{}, fmt.Errorf("invalid BMP header: %w", err)
+	}
+	if buf[0] != 'B' || buf[1] != 'M' {
+		return bmpHeader{}, fmt.Errorf("not a BMP file")
+	}
+
+	h := bmpHeader{
+		dataOffset:  binary.LittleEndian.Uint32(buf[10:]),
+		headerSize:  binary.LittleEndian.Uint32(buf[14:]),
+		width:       int(int32(binary.LittleEndian.Uint32(buf[18:]))),
+		height:      int(int32(binary.LittleEndian.Uint32(buf[22:]))),
+		bits:        binary.LittleEndian.Uint16(buf[28:]),
+		compression: binary.LittleEndian.Uint32(buf[30:]),
+		colors:      binary.LittleEndian.Uint32(buf[46:]),
+	}
+	if h.headerSize < 40 {
+		return bmpHeader{}, fmt.Errorf("unsupported BMP header size %d", h.headerSize)
+	}
+	if h.height < 0 {
+		h.height = -h.height
+		h.topDown = true
+	}
+	if h.width <= 0 || h.height == 0 {
+		return bmpHeader{}, fmt.Errorf("invalid BMP size %dx%d", h.width, h.height)
+	}
+	// Compression 3 (bit fields) is accepted for 32-bit files in the usual
+	// B,G,R,A order
+	if h.compression != 0 && !(h.compression == 3 && h.bits == 32) {
+		return bmpHeader{}, fmt.Errorf("compressed BMP files are not supported")
+	}
+	if h.bits != 8 && h.bits != 24 && h.bits != 32 {
+		return bmpHeader{}, fmt.Errorf("unsupported BMP depth %d bits (8, 24 and 32 are supported)", h.bits)
+	}
+	return h, nil
+}
+
+// decodeBMPConfig returns the colour model and size of a BMP file
+func decodeBMPConfig(r io.Reader) (image.Config, error) {
+	h, err := readBMPHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.Model(color.RGBAModel)
+	if h.bits == 8 {
+		model = color.Palette{}
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}, nil
+}
+
+// DecodeBMP decodes an uncompressed 8, 24 or 32-bit BMP file. It is
+// registered with the image package, so image.Decode reads BMP files.
+func DecodeBMP(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readBMPHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// The palette follows the info header
+	if _, err := br.Discard(int(h.headerSize) - 40); err != nil {
+		return nil, fmt.Errorf("invalid BMP header: %w", err)
+	}
+	read := 54 + int(h.headerSize) - 40
+	var palette color.Palette
+	if h.bits == 8 {
+		count := int(h.colors)
+		if count == 0 || count > 256 {
+			count = 256
+		}
+		entries := make([]byte, count*4)
+		if _, err := io.ReadFull(br, entries); err != nil {
+			return nil, fmt.Errorf("invalid BMP palette: %w", err)
+		}
+		read += len(entries)
+		palette = make(color.Palette, count)
+		for i := range palette {
+			palette[i] = color.RGBA{R: entries[i*4+2], G: entries[i*4+1], B: entries[i*4], A: 0xFF}
+		}
+	}
+	if skip := int(h.dataOffset) - read; skip > 0 {
+		if _, err := br.Discard(skip); err != nil {
+			return nil, fmt.Errorf("invalid BMP data offset: %w", err)
+		}
+	}
+
+	bytesPerPixel := int(h.bits) / 8
+	stride := (h.width*bytesPerPixel + 3) &^ 3 // Rows are padded to 4 bytes
+	row := make([]byte, stride)
+	rect := image.Rect(0, 0, h.width, h.height)
+
+	var paletted *image.Paletted
+	var rgba *image.RGBA
+	if palette != nil {
+		paletted = image.NewPaletted(rect, palette)
+	} else {
+		rgba = image.NewRGBA(rect)
+	}
+
+	for i := 0; i < h.height; i++ {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("truncated BMP pixel data: %w", err)
+		}
+		y := h.height - 1 - i
+		if h.topDown {
+			y = i
+		}
+		for x := 0; x < h.width; x++ {
+			p := row[x*bytesPerPixel:]
+			if paletted != nil {
+				if int(p[0]) >= len(palette) {
+					return nil, fmt.Errorf("BMP pixel uses colour %d of a %d-colour palette", p[0], len(palette))
+				}
+				paletted.SetColorIndex(x, y, p[0])
+			} else {
+				rgba.SetRGBA(x, y, color.RGBA{R: p[2], G: p[1], B: p[0], A: 0xFF})
+			}
+		}
+	}
+
+	if paletted != nil {
+		return paletted, nil
+	}
+	return rgba, nil
+}
@@ -0,0 +1,83 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// bmpFile builds an uncompressed BMP file. A negative height stores the rows
+// top-down.
+func bmpFile(width, height int, bits uint16, palette []byte, pixels []byte) []byte {
+	offset := 54 + len(palette)
+	var data []byte
+	data = append(data, 'B', 'M')
+	data = binary.LittleEndian.AppendUint32(data, uint32(offset+len(pixels)))
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, uint32(offset))
+	data = binary.LittleEndian.AppendUint32(data, 40)
+	data = binary.LittleEndian.AppendUint32(data, uint32(int32(width)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(int32(height)))
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, bits)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(pixels)))
+	data = binary.LittleEndian.AppendUint32(data, 2835)
+	data = binary.LittleEndian.AppendUint32(data, 2835)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(palette)/4))
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = append(data, palette...)
+	return append(data, pixels...)
+}
+
+func TestDecodeBMP24(t *testing.T) {
+	// 1x2 bottom-up: the first row in the file is the bottom one. Rows are
+	// padded to 4 bytes.
+	pixels := []byte{
+		0xFF, 0x00, 0x00, 0x00, // Bottom: blue
+		0x00, 0x00, 0xFF, 0x00, // Top: red
+	}
+	img, format, err := image.Decode(bytes.NewReader(bmpFile(1, 2, 24, nil, pixels)))
+	if err != nil {
+		t.Fatalf("image.Decode() error: %v", err)
+	}
+	if format != "bmp" {
+		t.Errorf("format = %q, want bmp", format)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != (color.RGBA{R: 0xFF, A: 0xFF}) {
+		t.Errorf("top pixel = %v, want red", got)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 1)); got != (color.RGBA{B: 0xFF, A: 0xFF}) {
+		t.Errorf("bottom pixel = %v, want blue", got)
+	}
+}
+
+func TestDecodeBMP8TopDown(t *testing.T) {
+	palette := []byte{0, 0, 0, 0, 0x00, 0xFF, 0x00, 0}
+	pixels := []byte{1, 0, 0, 0, 0, 1, 0, 0}
+	img, err := DecodeBMP(bytes.NewReader(bmpFile(2, -2, 8, palette, pixels)))
+	if err != nil {
+		t.Fatalf("DecodeBMP() error: %v", err)
+	}
+	p, ok := img.(*image.Paletted)
+	if !ok {
+		t.Fatalf("DecodeBMP() returned %T, want *image.Paletted", img)
+	}
+	if p.ColorIndexAt(0, 0) != 1 || p.ColorIndexAt(1, 0) != 0 || p.ColorIndexAt(1, 1) != 1 {
+		t.Errorf("pixels = %v", p.Pix)
+	}
+	if p.Palette[1] != (color.RGBA{G: 0xFF, A: 0xFF}) {
+		t.Errorf("palette[1] = %v, want green", p.Palette[1])
+	}
+}
+
+func TestDecodeBMPUnsupported(t *testing.T) {
+	if _, err := DecodeBMP(bytes.NewReader(bmpFile(1, 1, 16, nil, []byte{0, 0, 0, 0}))); err == nil {
+		t.Error("DecodeBMP() of a 16-bit file should fail")
+	}
+	if _, err := DecodeBMP(bytes.NewReader([]byte("PNG"))); err == nil {
+		t.Error("DecodeBMP() of a non-BMP file should fail")
+	}
+}
@@ -0,0 +1,47 @@
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// FontFromImage converts a font sheet to 8x8 font data. The sheet is a grid
+// of 8x8 pixel characters read left to right, top to bottom, e.g. 16x16
+// characters in a 128x128 image. Pixels brighter than half intensity are set.
+func FontFromImage(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	if bounds.Dx()%CharWidth != 0 || bounds.Dy()%CharHeight != 0 || bounds.Empty() {
+		return nil, fmt.Errorf("font sheet is %dx%d, the size must be a multiple of %dx%d", bounds.Dx(), bounds.Dy(), CharWidth, CharHeight)
+	}
+	columns := bounds.Dx() / CharWidth
+	count := columns * (bounds.Dy() / CharHeight)
+	if count > FontSize/CharHeight {
+		return nil, fmt.Errorf("font sheet has %d characters, at most %d fit in a font", count, FontSize/CharHeight)
+	}
+
+	font := make([]byte, count*CharHeight)
+	for char := 0; char < count; char++ {
+		x0 := bounds.Min.X + char%columns*CharWidth
+		y0 := bounds.Min.Y + char/columns*CharHeight
+		for y := 0; y < CharHeight; y++ {
+			var row byte
+			for x := 0; x < CharWidth; x++ {
+				if isLit(img.At(x0+x, y0+y)) {
+					row |= 0x80 >> x
+				}
+			}
+			font[char*CharHeight+y] = row
+		}
+	}
+	return font, nil
+}
+
+// isLit returns true if a pixel is opaque and brighter than half intensity
+func isLit(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	if a < 0x8000 {
+		return false
+	}
+	return color.GrayModel.Convert(c).(color.Gray).Y >= 0x80
+}
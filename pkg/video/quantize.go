@@ -0,0 +1,126 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// colorCount is a colour and the number of pixels that use it
+type colorCount struct {
+	rgb   [3]uint8
+	count int
+}
+
+// Quantize converts an image to an indexed image of at most maxColors
+// colours. An indexed image that already fits keeps its palette; other images
+// get a palette chosen by median cut.
+func Quantize(img image.Image, maxColors int) *image.Paletted {
+	bounds := img.Bounds()
+	if p, ok := img.(*image.Paletted); ok && len(p.Palette) <= maxColors {
+		out := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), p.Palette)
+		for y := 0; y < bounds.Dy(); y++ {
+			copy(out.Pix[y*out.Stride:], p.Pix[p.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:bounds.Dx()])
+		}
+		return out
+	}
+
+	counts := make(map[[3]uint8]int)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			counts[rgbOf(img.At(x, y))]++
+		}
+	}
+	colors := make([]colorCount, 0, len(counts))
+	for rgb, count := range counts {
+		colors = append(colors, colorCount{rgb, count})
+	}
+	// Map iteration order is random; sort so the palette is repeatable
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].rgb, colors[j].rgb
+		return a[0] < b[0] || a[0] == b[0] && (a[1] < b[1] || a[1] == b[1] && a[2] < b[2])
+	})
+
+	palette := medianCut(colors, maxColors)
+	out := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+	index := make(map[[3]uint8]uint8, len(colors))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rgb := rgbOf(img.At(x, y))
+			i, ok := index[rgb]
+			if !ok {
+				i = uint8(palette.Index(color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF}))
+				index[rgb] = i
+			}
+			out.Pix[(y-bounds.Min.Y)*out.Stride+x-bounds.Min.X] = i
+		}
+	}
+	return out
+}
+
+// rgbOf returns the 8-bit red, green and blue of a colour, ignoring alpha
+func rgbOf(c color.Color) [3]uint8 {
+	rgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return [3]uint8{rgba.R, rgba.G, rgba.B}
+}
+
+// medianCut splits the colours into at most n boxes, repeatedly halving the
+// box with the widest channel range at its pixel-weighted median, and returns
+// the average colour of each box
+func medianCut(colors []colorCount, n int) color.Palette {
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		// Find the box with the widest range in any channel
+		widest, channel, span := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				lo, hi := box[0].rgb[c], box[0].rgb[c]
+				for _, cc := range box {
+					lo = min(lo, cc.rgb[c])
+					hi = max(hi, cc.rgb[c])
+				}
+				if int(hi-lo) > span || widest < 0 {
+					widest, channel, span = i, c, int(hi-lo)
+				}
+			}
+		}
+		if widest < 0 {
+			break // Every box holds a single colour
+		}
+
+		box := boxes[widest]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].rgb[channel] < box[j].rgb[channel] })
+		total := 0
+		for _, cc := range box {
+			total += cc.count
+		}
+		split, seen := 1, box[0].count
+		for split < len(box)-1 && seen*2 < total {
+			seen += box[split].count
+			split++
+		}
+		boxes[widest] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var sum [3]int
+		total := 0
+		for _, cc := range box {
+			for c := 0; c < 3; c++ {
+				sum[c] += int(cc.rgb[c]) * cc.count
+			}
+			total += cc.count
+		}
+		if total == 0 {
+			palette[i] = color.RGBA{A: 0xFF}
+			continue
+		}
+		palette[i] = color.RGBA{R: uint8(sum[0] / total), G: uint8(sum[1] / total), B: uint8(sum[2] / total), A: 0xFF}
+	}
+	return palette
+}
@@ -0,0 +1,68 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuantizeFewColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	red := color.RGBA{R: 0xFF, A: 0xFF}
+	blue := color.RGBA{B: 0xFF, A: 0xFF}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+	img.Set(2, 0, red)
+	img.Set(3, 0, blue)
+
+	out := Quantize(img, 256)
+	if len(out.Palette) != 2 {
+		t.Fatalf("len(palette) = %d, want 2", len(out.Palette))
+	}
+	for x := 0; x < 4; x++ {
+		if got, want := out.At(x, 0), img.At(x, 0); got != want {
+			t.Errorf("pixel %d = %v, want %v", x, got, want)
+		}
+	}
+}
+
+func TestQuantizeManyColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 0x80, A: 0xFF})
+		}
+	}
+
+	out := Quantize(img, 16)
+	if len(out.Palette) != 16 {
+		t.Fatalf("len(palette) = %d, want 16", len(out.Palette))
+	}
+	// Each pixel should be close to its original colour
+	for _, p := range []image.Point{{0, 0}, {63, 0}, {0, 63}, {63, 63}, {32, 32}} {
+		want := img.RGBAAt(p.X, p.Y)
+		got := color.RGBAModel.Convert(out.At(p.X, p.Y)).(color.RGBA)
+		if diff(got.R, want.R) > 40 || diff(got.G, want.G) > 40 || got.B != want.B {
+			t.Errorf("pixel %v = %v, want about %v", p, got, want)
+		}
+	}
+}
+
+func TestQuantizeKeepsPalette(t *testing.T) {
+	palette := color.Palette{color.RGBA{A: 0xFF}, color.RGBA{G: 0xFF, A: 0xFF}, color.RGBA{R: 0xFF, A: 0xFF}}
+	img := image.NewPaletted(image.Rect(0, 0, 2, 1), palette)
+	img.SetColorIndex(1, 0, 2)
+
+	out := Quantize(img, 256)
+	if len(out.Palette) != 3 || out.ColorIndexAt(1, 0) != 2 {
+		t.Errorf("palette %v, index %d", out.Palette, out.ColorIndexAt(1, 0))
+	}
+}
+
+// diff returns the absolute difference of two bytes
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,85 @@
+package video
+
+import (
+	"image"
+	"image/color"
+)
+
+// Font dimensions. A font has 256 characters of 8 rows, one byte per row
+// with the leftmost pixel in bit 7.
+const (
+	CharWidth  = 8
+	CharHeight = 8
+	FontSize   = 256 * CharHeight
+)
+
+// TextLUTSize is the size of a 16-colour text look-up table
+const TextLUTSize = 16 * LUTEntrySize
+
+// TextScreen is the contents of a text mode screen
+type TextScreen struct {
+	Columns, Rows int
+	Chars         []byte // Character codes, row by row
+	Colors        []byte // Colour of each character: foreground in the high nibble, background in the low
+	Font          []byte // FontSize bytes
+	Foreground    color.Palette
+	Background    color.Palette
+}
+
+// Render draws the screen with 8x8 pixel characters
+func (t *TextScreen) Render() (*image.RGBA, error) {
+	cells := t.Columns * t.Rows
+	if err := checkSize("text memory", t.Chars, cells); err != nil {
+		return nil, err
+	}
+	if err := checkSize("colour memory", t.Colors, cells); err != nil {
+		return nil, err
+	}
+	if err := checkSize("font", t.Font, FontSize); err != nil {
+		return nil, err
+	}
+	if len(t.Foreground) < 16 || len(t.Background) < 16 {
+		return nil, checkSize("text LUT", nil, TextLUTSize)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, t.Columns*CharWidth, t.Rows*CharHeight))
+	for cell := 0; cell < cells; cell++ {
+		fg := t.Foreground[t.Colors[cell]>>4]
+		bg := t.Background[t.Colors[cell]&0x0F]
+		glyph := t.Font[int(t.Chars[cell])*CharHeight:]
+		x0 := cell % t.Columns * CharWidth
+		y0 := cell / t.Columns * CharHeight
+
+		for y := 0; y < CharHeight; y++ {
+			for x := 0; x < CharWidth; x++ {
+				c := bg
+				if glyph[y]&(0x80>>x) != 0 {
+					c = fg
+				}
+				img.Set(x0+x, y0+y, c)
+			}
+		}
+	}
+	return img, nil
+}
+
+// TextLines converts text memory to lines of host text. Printable ASCII is
+// kept, character 0 becomes a space and other characters a dot.
+func TextLines(chars []byte, columns int) []string {
+	lines := make([]string, 0, len(chars)/columns)
+	line := make([]byte, columns)
+	for row := 0; (row+1)*columns <= len(chars); row++ {
+		for i, c := range chars[row*columns : (row+1)*columns] {
+			switch {
+			case c == 0:
+				line[i] = ' '
+			case c < 0x20 || c > 0x7E:
+				line[i] = '.'
+			default:
+				line[i] = c
+			}
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
@@ -0,0 +1,58 @@
+// Package video renders and converts images for the video memory of Foenix
+// machines: text screens, 8-bit indexed bitmaps, colour look-up tables and
+// 8x8 fonts
+package video
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// LUTEntrySize is the size of one colour look-up table entry: blue, green,
+// red and an unused byte
+const LUTEntrySize = 4
+
+// Region names of the video memory in a machine's memory map. Each is set
+// per machine as region.NAME in foenixmgr.ini.
+const (
+	RegionText      = "video.text"    // Text screen characters, one byte each
+	RegionColor     = "video.color"   // Text colours: foreground in the high nibble, background in the low
+	RegionFont      = "video.font"    // Font: 256 characters of 8 bytes
+	RegionTextFGLUT = "video.text_fg" // 16-entry LUT of text foreground colours
+	RegionTextBGLUT = "video.text_bg" // 16-entry LUT of text background colours
+	RegionBitmap    = "video.bitmap"  // 8-bit indexed bitmap pixels
+	RegionBitmapLUT = "video.lut"     // 256-entry LUT of bitmap colours
+
+	RegionMasterControl = "video.master"      // Master control register
+	RegionBitmapControl = "video.bitmap_ctrl" // Bitmap layer control register, then its 24-bit address
+)
+
+// DecodeLUT converts look-up table entries to a palette
+func DecodeLUT(data []byte) color.Palette {
+	palette := make(color.Palette, len(data)/LUTEntrySize)
+	for i := range palette {
+		entry := data[i*LUTEntrySize:]
+		palette[i] = color.RGBA{R: entry[2], G: entry[1], B: entry[0], A: 0xFF}
+	}
+	return palette
+}
+
+// EncodeLUT converts a palette to look-up table entries
+func EncodeLUT(palette color.Palette) []byte {
+	data := make([]byte, len(palette)*LUTEntrySize)
+	for i, c := range palette {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		data[i*LUTEntrySize] = rgba.B
+		data[i*LUTEntrySize+1] = rgba.G
+		data[i*LUTEntrySize+2] = rgba.R
+	}
+	return data
+}
+
+// checkSize returns an error if data is shorter than the size needed
+func checkSize(what string, data []byte, size int) error {
+	if len(data) < size {
+		return fmt.Errorf("%s has %d bytes, %d are needed", what, len(data), size)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package video
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestLUTRoundTrip(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x30, 0x00, 0xFF, 0x00, 0x80, 0x00}
+	palette := DecodeLUT(data)
+	if len(palette) != 2 {
+		t.Fatalf("len(palette) = %d, want 2", len(palette))
+	}
+	if palette[0] != (color.RGBA{R: 0x30, G: 0x20, B: 0x10, A: 0xFF}) {
+		t.Errorf("palette[0] = %v", palette[0])
+	}
+	if got := EncodeLUT(palette); string(got) != string(data) {
+		t.Errorf("EncodeLUT() = % X, want % X", got, data)
+	}
+}
+
+// grey returns a palette of n shades
+func grey(n int) color.Palette {
+	palette := make(color.Palette, n)
+	for i := range palette {
+		palette[i] = color.RGBA{R: uint8(i), G: uint8(i), B: uint8(i), A: 0xFF}
+	}
+	return palette
+}
+
+func TestTextScreenRender(t *testing.T) {
+	font := make([]byte, FontSize)
+	font['A'*CharHeight] = 0x81 // Top row: leftmost and rightmost pixels set
+
+	screen := &TextScreen{
+		Columns:    2,
+		Rows:       1,
+		Chars:      []byte{'A', ' '},
+		Colors:     []byte{0x52, 0x13},
+		Font:       font,
+		Foreground: grey(16),
+		Background: grey(16),
+	}
+	img, err := screen.Render()
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Fatalf("bounds = %v, want 16x8", b)
+	}
+
+	tests := []struct {
+		x, y  int
+		shade uint8
+	}{
+		{0, 0, 5},  // Set pixel: foreground
+		{7, 0, 5},  // Set pixel: foreground
+		{1, 0, 2},  // Clear pixel: background
+		{0, 1, 2},  // Clear row: background
+		{8, 0, 3},  // Second cell background
+		{15, 7, 3}, // Second cell background
+	}
+	for _, tt := range tests {
+		if got := img.RGBAAt(tt.x, tt.y).R; got != tt.shade {
+			t.Errorf("pixel (%d,%d) = %d, want %d", tt.x, tt.y, got, tt.shade)
+		}
+	}
+}
+
+func TestTextScreenRenderShortMemory(t *testing.T) {
+	screen := &TextScreen{Columns: 80, Rows: 60, Chars: make([]byte, 10)}
+	if _, err := screen.Render(); err == nil {
+		t.Error("Render() with short text memory should fail")
+	}
+}
+
+func TestBitmapRender(t *testing.T) {
+	bitmap := &Bitmap{Width: 2, Height: 2, Pixels: []byte{0, 1, 2, 255}, Palette: grey(256)}
+	img, err := bitmap.Render()
+	if err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	if got := img.ColorIndexAt(1, 1); got != 255 {
+		t.Errorf("pixel (1,1) = %d, want 255", got)
+	}
+
+	bitmap.Palette = grey(16)
+	if _, err := bitmap.Render(); err == nil {
+		t.Error("Render() with a short palette should fail")
+	}
+}
+
+func TestBitmapControl(t *testing.T) {
+	if got := BitmapControl(0x012345, 2); string(got) != "\x05\x45\x23\x01" {
+		t.Errorf("BitmapControl() = % X", got)
+	}
+}
+
+func TestFontFromImage(t *testing.T) {
+	// Two characters side by side: the first has its top-left pixel set,
+	// the second its bottom-right
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	img.SetGray(0, 0, color.Gray{Y: 0xFF})
+	img.SetGray(15, 7, color.Gray{Y: 0xC0})
+	img.SetGray(1, 0, color.Gray{Y: 0x40}) // Too dark
+
+	font, err := FontFromImage(img)
+	if err != nil {
+		t.Fatalf("FontFromImage() error: %v", err)
+	}
+	want := []byte{0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01}
+	if string(font) != string(want) {
+		t.Errorf("font = % X, want % X", font, want)
+	}
+
+	if _, err := FontFromImage(image.NewGray(image.Rect(0, 0, 12, 8))); err == nil {
+		t.Error("FontFromImage() with a width that isn't a multiple of 8 should fail")
+	}
+	if _, err := FontFromImage(image.NewGray(image.Rect(0, 0, 8, 8*257))); err == nil {
+		t.Error("FontFromImage() with more than 256 characters should fail")
+	}
+}
+
+func TestTextLines(t *testing.T) {
+	lines := TextLines([]byte("Hi\x00\x01\xA0OK!!x"), 5)
+	if len(lines) != 2 || lines[0] != "Hi .." || lines[1] != "OK!!x" {
+		t.Errorf("TextLines() = %q", lines)
+	}
+}
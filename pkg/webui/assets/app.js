@@ -0,0 +1,126 @@
+// FoenixMgr dashboard: talks to the JSON API under /api/
+
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+let polling = null;
+
+function showError(message) {
+  $("error").textContent = message || "";
+}
+
+async function api(method, path, body) {
+  const response = await fetch(path, { method, body });
+  const result = await response.json();
+  if (!response.ok) {
+    throw new Error(result.error || response.statusText);
+  }
+  return result;
+}
+
+function showStatus(status) {
+  const parts = [status.port, status.cpu];
+  if (status.target) {
+    parts.unshift(status.target);
+  }
+  $("machine").textContent = parts.join(" · ");
+
+  $("cpu-state").textContent = status.can_stop ? (status.stopped ? "stopped" : "running") : "held in debug mode";
+  $("cpu-stop").disabled = !status.can_stop || status.stopped;
+  $("cpu-start").disabled = !status.can_stop || !status.stopped;
+
+  showJob(status.job);
+}
+
+function showJob(job) {
+  if (!job) {
+    return;
+  }
+  let text = `${job.operation} of ${job.file}: ${job.stage}`;
+  if (job.total > 0) {
+    text += ` (${job.done} of ${job.total} bytes)`;
+    $("job-progress").max = job.total;
+    $("job-progress").value = job.done;
+  } else if (job.done > 0) {
+    text += ` (${job.done} bytes)`;
+  }
+  if (job.error) {
+    text = `${job.operation} of ${job.file} failed: ${job.error}`;
+  }
+  if (!job.running && !job.error) {
+    $("job-progress").max = 1;
+    $("job-progress").value = 1;
+  }
+  $("job").textContent = text;
+
+  for (const form of ["upload-form", "flash-form"]) {
+    $(form).querySelector("button").disabled = job.running;
+  }
+  if (job.running && !polling) {
+    polling = setInterval(refresh, 500);
+  } else if (!job.running && polling) {
+    clearInterval(polling);
+    polling = null;
+  }
+}
+
+async function refresh() {
+  try {
+    showStatus(await api("GET", "/api/status"));
+  } catch (e) {
+    showError(e.message);
+  }
+}
+
+async function readMemory() {
+  const address = $("memory-address").value;
+  const length = $("memory-length").value;
+  try {
+    const result = await api("GET", `/api/memory?address=${encodeURIComponent(address)}&length=${length}`);
+    $("memory-dump").textContent = result.dump;
+    showError();
+  } catch (e) {
+    showError(e.message);
+  }
+}
+
+function moveMemory(direction) {
+  const length = parseInt($("memory-length").value, 10);
+  const address = Math.max(0, parseInt($("memory-address").value, 16) + direction * length);
+  $("memory-address").value = address.toString(16).toUpperCase().padStart(6, "0");
+  readMemory();
+}
+
+async function setCPU(state) {
+  try {
+    showStatus(await api("POST", `/api/cpu/${state}`));
+    showError();
+  } catch (e) {
+    showError(e.message);
+  }
+}
+
+async function submitJob(event, path, question) {
+  event.preventDefault();
+  if (question && !confirm(question)) {
+    return;
+  }
+  try {
+    showJob(await api("POST", path, new FormData(event.target)));
+    showError();
+  } catch (e) {
+    showError(e.message);
+  }
+}
+
+$("memory-form").addEventListener("submit", (e) => { e.preventDefault(); readMemory(); });
+$("memory-prev").addEventListener("click", () => moveMemory(-1));
+$("memory-next").addEventListener("click", () => moveMemory(1));
+$("cpu-stop").addEventListener("click", () => setCPU("stop"));
+$("cpu-start").addEventListener("click", () => setCPU("start"));
+$("upload-form").addEventListener("submit", (e) => submitJob(e, "/api/upload"));
+$("flash-form").addEventListener("submit", (e) =>
+  submitJob(e, "/api/flash", "Are you sure you want to reprogram the flash memory?"));
+
+refresh();
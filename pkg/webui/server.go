@@ -0,0 +1,423 @@
+// Package webui serves a small web dashboard for a machine on the debug port:
+// a memory viewer, program uploads, CPU stop/start and flash programming with
+// its progress, so lab machines can be managed from a browser. The page and
+// its script are embedded in the binary; they talk to the JSON API under
+// /api/. Prometheus metrics are served at /metrics.
+package webui
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/daschewie/foenixmgr/pkg/metrics"
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+	"github.com/daschewie/foenixmgr/pkg/util"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// MaxReadLength is the most memory one viewer request reads
+const MaxReadLength = 4096
+
+// maxUploadSize is the largest file accepted by the upload and flash forms
+const maxUploadSize = 16 << 20
+
+// ReportFunc is called as an operation proceeds with its stage (e.g.
+// "erasing") and the bytes done out of total, or a total of 0 when it isn't
+// known
+type ReportFunc func(stage string, done, total int)
+
+// Machine is the machine the dashboard manages
+type Machine interface {
+	// ReadMemory reads length bytes from address
+	ReadMemory(address uint32, length int) ([]byte, error)
+
+	// Load uploads a program file, in a format told by its extension
+	Load(filename string, report ReportFunc) error
+
+	// Flash stages a flash image in RAM at ramAddress, then erases and
+	// programs the flash from it
+	Flash(image []byte, ramAddress uint32, report ReportFunc) error
+
+	// Halt stops the CPU
+	Halt() error
+
+	// Continue lets the CPU run
+	Continue() error
+
+	// Revision reads the debug port revision, which shows the machine
+	// responds
+	Revision() (byte, error)
+
+	// LinkStats returns the counts of debug port exchanges and errors
+	LinkStats() protocol.LinkStats
+}
+
+// Info describes the machine on the status line
+type Info struct {
+	Target  string `json:"target,omitempty"`
+	Port    string `json:"port"`
+	CPU     string `json:"cpu"`
+	CanStop bool   `json:"can_stop"` // The machine supports stop/start
+}
+
+// Job is the upload or flash operation in progress, or the last one
+type Job struct {
+	Operation string `json:"operation"` // upload or flash
+	File      string `json:"file"`
+	Stage     string `json:"stage"`
+	Done      int    `json:"done"`
+	Total     int    `json:"total"`
+	Running   bool   `json:"running"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Status is the response of /api/status
+type Status struct {
+	Info
+	Stopped bool `json:"stopped"`
+	Job     *Job `json:"job,omitempty"`
+}
+
+// Server serves the dashboard for a machine. Operations on the machine run
+// one at a time: while an upload or flash job runs, other requests are
+// refused as busy.
+type Server struct {
+	machine Machine
+	info    Info
+
+	// Logf, if set, receives a line for each operation and failure
+	Logf func(format string, args ...interface{})
+
+	machineMu sync.Mutex // Held while the machine is in use
+
+	mu      sync.Mutex
+	stopped bool
+	job     *Job
+
+	// Counts for /metrics
+	jobs         map[string]int // Jobs started, by operation
+	jobFailures  map[string]int
+	bytesRead    int64
+	bytesWritten int64
+	link         protocol.LinkStats // As of the last time the machine was free
+	up           bool               // The last revision request succeeded
+	revision     int                // Last revision read, -1 if none
+	lastResponse time.Time
+}
+
+// NewServer returns a dashboard server for a machine. stopped tells whether
+// the CPU is already stopped.
+func NewServer(machine Machine, info Info, stopped bool) *Server {
+	return &Server{
+		machine:     machine,
+		info:        info,
+		stopped:     stopped,
+		jobs:        make(map[string]int),
+		jobFailures: make(map[string]int),
+		revision:    -1,
+	}
+}
+
+// Handler returns the handler for the dashboard and its API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	static, _ := fs.Sub(assets, "assets")
+	mux.Handle("GET /", http.FileServer(http.FS(static)))
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/memory", s.handleMemory)
+	mux.HandleFunc("POST /api/cpu/stop", s.handleCPU(true))
+	mux.HandleFunc("POST /api/cpu/start", s.handleCPU(false))
+	mux.HandleFunc("POST /api/upload", s.handleUpload)
+	mux.HandleFunc("POST /api/flash", s.handleFlash)
+	mux.HandleFunc("GET /metrics", metrics.Handler(s.writeMetrics))
+	return mux
+}
+
+// handleStatus returns the machine and job status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status := Status{Info: s.info, Stopped: s.stopped}
+	if s.job != nil {
+		job := *s.job
+		status.Job = &job
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleMemory reads memory for the viewer: address in hex, length in bytes
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	address, err := util.ParseHexAddress(r.URL.Query().Get("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid address: %w", err))
+		return
+	}
+	length, err := strconv.Atoi(r.URL.Query().Get("length"))
+	if err != nil || length <= 0 || length > MaxReadLength {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("length must be 1 to %d bytes", MaxReadLength))
+		return
+	}
+
+	if !s.machineMu.TryLock() {
+		writeError(w, http.StatusConflict, fmt.Errorf("busy with another operation"))
+		return
+	}
+	data, err := s.machine.ReadMemory(address, length)
+	s.machineMu.Unlock()
+	if err != nil {
+		s.logf("Memory read at 0x%X failed: %v", address, err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	s.mu.Lock()
+	s.bytesRead += int64(len(data))
+	s.lastResponse = time.Now()
+	s.mu.Unlock()
+
+	var dump bytes.Buffer
+	util.FprintHexDump(&dump, data, address, nil)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"address": fmt.Sprintf("%06X", address),
+		"data":    fmt.Sprintf("%X", data),
+		"dump":    dump.String(),
+	})
+}
+
+// handleCPU returns the handler that stops or starts the CPU
+func (s *Server) handleCPU(stop bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.info.CanStop {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("the target doesn't support stopping and starting the CPU"))
+			return
+		}
+		if !s.machineMu.TryLock() {
+			writeError(w, http.StatusConflict, fmt.Errorf("busy with another operation"))
+			return
+		}
+		var err error
+		if stop {
+			err = s.machine.Halt()
+		} else {
+			err = s.machine.Continue()
+		}
+		s.machineMu.Unlock()
+		if err != nil {
+			s.logf("CPU stop/start failed: %v", err)
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+
+		s.mu.Lock()
+		s.stopped = stop
+		s.lastResponse = time.Now()
+		s.mu.Unlock()
+		s.handleStatus(w, r)
+	}
+}
+
+// handleUpload starts uploading the program file in the form's file field
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	name, data, err := formFile(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.startJob(w, "upload", name, func(report ReportFunc) error {
+		// Loaders read files, and tell the format from the extension
+		dir, err := os.MkdirTemp("", "foenixmgr-upload")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, data, 0o600); err != nil {
+			return err
+		}
+		return s.machine.Load(filename, report)
+	})
+}
+
+// handleFlash starts programming the flash with the image in the form's file
+// field, staged at the RAM address in its address field
+func (s *Server) handleFlash(w http.ResponseWriter, r *http.Request) {
+	name, data, err := formFile(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	address, err := util.ParseHexAddress(r.FormValue("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid RAM address: %w", err))
+		return
+	}
+
+	s.startJob(w, "flash", name, func(report ReportFunc) error {
+		return s.machine.Flash(data, address, report)
+	})
+}
+
+// startJob runs an upload or flash operation in the background, unless one is
+// already running
+func (s *Server) startJob(w http.ResponseWriter, operation, file string, run func(ReportFunc) error) {
+	if !s.machineMu.TryLock() {
+		writeError(w, http.StatusConflict, fmt.Errorf("busy with another operation"))
+		return
+	}
+
+	job := &Job{Operation: operation, File: file, Stage: "starting", Running: true}
+	s.mu.Lock()
+	s.job = job
+	s.jobs[operation]++
+	s.mu.Unlock()
+	s.logf("Starting %s of %s", operation, file)
+
+	report := func(stage string, done, total int) {
+		s.mu.Lock()
+		job.Stage, job.Done, job.Total = stage, done, total
+		s.mu.Unlock()
+	}
+	go func() {
+		defer s.machineMu.Unlock()
+		err := run(report)
+
+		s.mu.Lock()
+		job.Running = false
+		s.bytesWritten += int64(job.Done)
+		if err != nil {
+			job.Error = err.Error()
+			s.jobFailures[operation]++
+		} else {
+			job.Stage = "complete"
+			s.lastResponse = time.Now()
+		}
+		s.mu.Unlock()
+		if err != nil {
+			s.logf("%s of %s failed: %v", operation, file, err)
+		} else {
+			s.logf("Finished %s of %s", operation, file)
+		}
+	}()
+
+	s.mu.Lock()
+	accepted := *job
+	s.mu.Unlock()
+	writeJSON(w, http.StatusAccepted, accepted)
+}
+
+// Wait waits for the job in progress, if any, to finish
+func (s *Server) Wait() {
+	s.machineMu.Lock()
+	s.machineMu.Unlock()
+}
+
+// writeMetrics writes the dashboard's counts and the machine's link
+// statistics as Prometheus metrics. Each scrape reads the revision, unless the
+// machine is busy, so a machine that stops responding shows as down.
+func (s *Server) writeMetrics(m *metrics.Writer) {
+	s.probe()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up, running := 0.0, 0.0
+	if s.up {
+		up = 1
+	}
+	if s.job != nil && s.job.Running {
+		running = 1
+	}
+	var jobs, failures []metrics.Sample
+	for _, operation := range []string{"upload", "flash"} {
+		label := []metrics.Label{{Name: "operation", Value: operation}}
+		jobs = append(jobs, metrics.Sample{Labels: label, Value: float64(s.jobs[operation])})
+		failures = append(failures, metrics.Sample{Labels: label, Value: float64(s.jobFailures[operation])})
+	}
+
+	m.Gauge("foenixmgr_up", "1 if the machine answered the last revision request", up)
+	if s.revision >= 0 {
+		m.Gauge("foenixmgr_revision", "Debug port revision last read", float64(s.revision))
+	}
+	m.Timestamp("foenixmgr_last_response_timestamp_seconds", "When the machine last answered, 0 if never", s.lastResponse)
+	m.Counter("foenixmgr_transfers_total", "Debug port exchanges that succeeded", float64(s.link.Transfers))
+	m.Counter("foenixmgr_transfer_failures_total", "Debug port exchanges that failed, whether retried or not", float64(s.link.Failures))
+	m.Counter("foenixmgr_transfer_retries_total", "Debug port exchanges repeated after a failure", float64(s.link.Retries))
+	m.Counter("foenixmgr_lrc_errors_total", "Responses with a bad LRC", float64(s.link.LRCErrors))
+	m.Counter("foenixmgr_read_bytes_total", "Bytes read by the memory viewer", float64(s.bytesRead))
+	m.Counter("foenixmgr_written_bytes_total", "Bytes written by uploads and flash programming", float64(s.bytesWritten))
+	m.Counters("foenixmgr_jobs_total", "Uploads and flash programming started", jobs...)
+	m.Counters("foenixmgr_job_failures_total", "Uploads and flash programming that failed", failures...)
+	m.Gauge("foenixmgr_job_running", "1 while an upload or flash programming runs", running)
+}
+
+// probe reads the revision and the link statistics, unless the machine is
+// busy, in which case the last ones are kept
+func (s *Server) probe() {
+	if !s.machineMu.TryLock() {
+		return
+	}
+	revision, err := s.machine.Revision()
+	link := s.machine.LinkStats()
+	s.machineMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.link = link
+	s.up = err == nil
+	if err == nil {
+		s.revision = int(revision)
+		s.lastResponse = time.Now()
+	} else {
+		s.logf("Machine didn't answer a revision request: %v", err)
+	}
+}
+
+// formFile reads the file in a form's file field and returns its base name
+func formFile(w http.ResponseWriter, r *http.Request) (string, []byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return "", nil, fmt.Errorf("no file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the file: %w", err)
+	}
+	name := filepath.Base(header.Filename)
+	if name == "." || name == string(filepath.Separator) {
+		return "", nil, fmt.Errorf("invalid file name '%s'", header.Filename)
+	}
+	return name, data, nil
+}
+
+// logf logs a message if a Logf function was set
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
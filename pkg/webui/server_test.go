@@ -0,0 +1,291 @@
+package webui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daschewie/foenixmgr/pkg/protocol"
+)
+
+// fakeMachine records the operations of the dashboard. Flash blocks until
+// release is closed, if it is set.
+type fakeMachine struct {
+	memory  []byte
+	loaded  string
+	flashed []byte
+	staging uint32
+	halted  bool
+	release chan struct{}
+	down    bool // Revision fails
+}
+
+func (m *fakeMachine) ReadMemory(address uint32, length int) ([]byte, error) {
+	if int(address)+length > len(m.memory) {
+		return nil, fmt.Errorf("read past the end of memory")
+	}
+	return m.memory[address : int(address)+length], nil
+}
+
+func (m *fakeMachine) Load(filename string, report ReportFunc) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	m.loaded = filepath.Base(filename) + ":" + string(data)
+	report("uploading", len(data), 0)
+	return nil
+}
+
+func (m *fakeMachine) Flash(image []byte, ramAddress uint32, report ReportFunc) error {
+	report("erasing", 0, len(image))
+	if m.release != nil {
+		<-m.release
+	}
+	m.flashed, m.staging = image, ramAddress
+	return nil
+}
+
+func (m *fakeMachine) Halt() error     { m.halted = true; return nil }
+func (m *fakeMachine) Continue() error { m.halted = false; return nil }
+
+func (m *fakeMachine) Revision() (byte, error) {
+	if m.down {
+		return 0, fmt.Errorf("timeout")
+	}
+	return 3, nil
+}
+
+func (m *fakeMachine) LinkStats() protocol.LinkStats {
+	return protocol.LinkStats{Transfers: 10, Failures: 2, Retries: 2, LRCErrors: 1}
+}
+
+// postFile posts a file in a multipart form with extra fields
+func postFile(t *testing.T, server *httptest.Server, path, name, content string, fields map[string]string) *http.Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for k, v := range fields {
+		form.WriteField(k, v)
+	}
+	part, _ := form.CreateFormFile("file", name)
+	part.Write([]byte(content))
+	form.Close()
+
+	resp, err := http.Post(server.URL+path, form.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("POST %s error: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// getStatus returns the dashboard's status
+func getStatus(t *testing.T, server *httptest.Server) Status {
+	t.Helper()
+
+	resp, err := http.Get(server.URL + "/api/status")
+	if err != nil {
+		t.Fatalf("GET /api/status error: %v", err)
+	}
+	defer resp.Body.Close()
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("decoding status: %v", err)
+	}
+	return status
+}
+
+func TestDashboardPage(t *testing.T) {
+	server := httptest.NewServer(NewServer(&fakeMachine{}, Info{}, false).Handler())
+	defer server.Close()
+
+	for _, path := range []string{"/", "/app.js", "/style.css"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || len(body) == 0 {
+			t.Errorf("GET %s = %d with %d bytes", path, resp.StatusCode, len(body))
+		}
+	}
+}
+
+func TestMemoryViewer(t *testing.T) {
+	machine := &fakeMachine{memory: make([]byte, 0x100)}
+	copy(machine.memory[0x10:], "Foenix")
+	server := httptest.NewServer(NewServer(machine, Info{}, false).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/memory?address=10&length=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result map[string]string
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result["data"] != "466F656E6978" || !strings.Contains(result["dump"], "Foenix") {
+		t.Errorf("GET /api/memory = %d %v", resp.StatusCode, result)
+	}
+
+	for _, query := range []string{"address=zz&length=6", "address=10&length=0", "address=10&length=99999"} {
+		resp, err := http.Get(server.URL + "/api/memory?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /api/memory?%s = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestCPUButtons(t *testing.T) {
+	machine := &fakeMachine{}
+	server := httptest.NewServer(NewServer(machine, Info{CanStop: true}, false).Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/cpu/stop", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !machine.halted || !getStatus(t, server).Stopped {
+		t.Error("stop didn't halt the CPU")
+	}
+
+	resp, err = http.Post(server.URL+"/api/cpu/start", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if machine.halted || getStatus(t, server).Stopped {
+		t.Error("start didn't continue the CPU")
+	}
+
+	// Without stop/start support the buttons are refused
+	noStop := httptest.NewServer(NewServer(machine, Info{}, false).Handler())
+	defer noStop.Close()
+	resp, err = http.Post(noStop.URL+"/api/cpu/stop", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("stop without support = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	machine := &fakeMachine{}
+	s := NewServer(machine, Info{}, false)
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	resp := postFile(t, server, "/api/upload", "../game.pgz", "program", nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /api/upload = %d, want 202", resp.StatusCode)
+	}
+	s.Wait()
+
+	// The file keeps its base name, so the loader sees its extension
+	if machine.loaded != "game.pgz:program" {
+		t.Errorf("loaded %q, want game.pgz:program", machine.loaded)
+	}
+	job := getStatus(t, server).Job
+	if job == nil || job.Running || job.Stage != "complete" || job.Done != 7 {
+		t.Errorf("job = %+v, want a complete upload of 7 bytes", job)
+	}
+}
+
+func TestFlashProgress(t *testing.T) {
+	machine := &fakeMachine{memory: make([]byte, 16), release: make(chan struct{})}
+	s := NewServer(machine, Info{}, false)
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	if resp := postFile(t, server, "/api/flash", "rom.bin", "image", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /api/flash without an address = %d, want 400", resp.StatusCode)
+	}
+
+	resp := postFile(t, server, "/api/flash", "rom.bin", "image", map[string]string{"address": "010000"})
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST /api/flash = %d, want 202", resp.StatusCode)
+	}
+
+	// The machine is busy until the flash is programmed
+	busy, err := http.Get(server.URL + "/api/memory?address=0&length=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy.Body.Close()
+	if busy.StatusCode != http.StatusConflict {
+		t.Errorf("memory read during flash = %d, want 409", busy.StatusCode)
+	}
+	if again := postFile(t, server, "/api/upload", "game.pgz", "program", nil); again.StatusCode != http.StatusConflict {
+		t.Errorf("upload during flash = %d, want 409", again.StatusCode)
+	}
+
+	close(machine.release)
+	s.Wait()
+	if string(machine.flashed) != "image" || machine.staging != 0x10000 {
+		t.Errorf("flashed %q staged at 0x%X", machine.flashed, machine.staging)
+	}
+	if job := getStatus(t, server).Job; job == nil || job.Operation != "flash" || job.Stage != "complete" {
+		t.Errorf("job = %+v, want a complete flash", job)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	machine := &fakeMachine{}
+	s := NewServer(machine, Info{}, false)
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+	get := func() string {
+		resp, err := http.Get(server.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	postFile(t, server, "/api/upload", "game.pgz", "program", nil)
+	s.Wait()
+
+	body := get()
+	for _, want := range []string{
+		"foenixmgr_up 1\n",
+		"foenixmgr_revision 3\n",
+		"foenixmgr_transfers_total 10\n",
+		"foenixmgr_transfer_failures_total 2\n",
+		"foenixmgr_lrc_errors_total 1\n",
+		"foenixmgr_written_bytes_total 7\n",
+		`foenixmgr_jobs_total{operation="upload"} 1` + "\n",
+		`foenixmgr_job_failures_total{operation="upload"} 0` + "\n",
+		"foenixmgr_job_running 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, body)
+		}
+	}
+
+	// A machine that stops answering shows as down, keeping its last revision
+	machine.down = true
+	body = get()
+	if !strings.Contains(body, "foenixmgr_up 0\n") || !strings.Contains(body, "foenixmgr_revision 3\n") {
+		t.Errorf("metrics of a machine that stopped answering:\n%s", body)
+	}
+}